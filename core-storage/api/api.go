@@ -0,0 +1,74 @@
+// Package api 定义 Sealock HTTP API（/api/v1）的请求与响应类型
+// 服务端的处理器和 client 包共用这些类型，接口的完整描述见 OpenAPI 文档（openapi.yaml），
+// 服务端在 GET /api/v1/openapi.yaml 和 GET /api/v1/openapi.json 提供。
+// 服务层已经以 JSON 形式直接返回的类型在这里以别名导出，字段与服务层保持一致
+package api
+
+import "net/http"
+
+// 错误码，与 HTTP 状态码一起说明失败原因；message 面向用户，内容可能变化，客户端应按错误码判断
+const (
+	CodeInvalidRequest     = "invalid_request"     // 400 请求参数或请求体无效
+	CodeUnauthorized       = "unauthorized"        // 401 未认证
+	CodeForbidden          = "forbidden"           // 403 无权访问
+	CodeNotFound           = "not_found"           // 404 资源不存在
+	CodeConflict           = "conflict"            // 409 与现有资源冲突
+	CodeGone               = "gone"                // 410 资源已不存在（如复制游标对应的提交）
+	CodePreconditionFailed = "precondition_failed" // 412 前置条件不满足
+	CodeTooLarge           = "too_large"           // 413 请求体过大
+	CodeInternal           = "internal"            // 500 服务端错误
+	CodeUpstream           = "upstream"            // 502 上游（如复制的主服务器）请求失败
+
+	CodeQuotaExceeded     = "quota_exceeded"      // 413 存储配额不足
+	CodeReadOnlyReplica   = "read_only_replica"   // 403 库是只读副本
+	CodeCursorExpired     = "cursor_expired"      // 410 事件游标已过期，需要全量同步
+	CodeMissingChunks     = "missing_chunks"      // 400 完成上传时缺少分片
+	CodeChunkHashMismatch = "chunk_hash_mismatch" // 400 分片数据与声明的哈希不一致
+	CodeMissingBlocks     = "missing_blocks"      // 412 提交变更前需要先上传缺少的块
+)
+
+// Error 错误响应
+type Error struct {
+	Code    string `json:"code"`
+	Message string `json:"error"`
+}
+
+// CodeForStatus 返回 HTTP 状态码对应的通用错误码
+func CodeForStatus(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return CodeInvalidRequest
+	case http.StatusUnauthorized:
+		return CodeUnauthorized
+	case http.StatusForbidden:
+		return CodeForbidden
+	case http.StatusNotFound:
+		return CodeNotFound
+	case http.StatusConflict:
+		return CodeConflict
+	case http.StatusGone:
+		return CodeGone
+	case http.StatusPreconditionFailed:
+		return CodePreconditionFailed
+	case http.StatusRequestEntityTooLarge:
+		return CodeTooLarge
+	case http.StatusBadGateway:
+		return CodeUpstream
+	}
+	if status >= 500 {
+		return CodeInternal
+	}
+	return CodeInvalidRequest
+}
+
+// Message 只包含提示信息的响应
+type Message struct {
+	Message string `json:"message"`
+}
+
+// Page 分页列表的分页信息
+type Page struct {
+	Total  int `json:"total"`
+	Limit  int `json:"limit"`
+	Offset int `json:"offset"`
+}
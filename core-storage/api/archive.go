@@ -0,0 +1,36 @@
+package api
+
+// 支持导入的归档格式
+const (
+	ArchiveTar   = "tar"
+	ArchiveTarGz = "tar.gz"
+	ArchiveZip   = "zip"
+)
+
+// ArchiveImportResult POST /libraries/{libraryId}/import 的响应
+type ArchiveImportResult struct {
+	LibraryID uint     `json:"libraryId"`
+	Target    string   `json:"target"`  // 导入的目标目录，空字符串为库的根目录
+	Format    string   `json:"format"`  // 归档格式：tar、tar.gz 或 zip
+	Files     int      `json:"files"`   // 导入的文件数量
+	Bytes     int64    `json:"bytes"`   // 导入的总字节数
+	Skipped   []string `json:"skipped"` // 跳过的条目：链接、设备文件以及 macOS 的 __MACOSX 元数据
+}
+
+// BundleExportRequest POST /bundles/export 的请求体，响应为快照包（tar 流）
+type BundleExportRequest struct {
+	LibraryID  uint     `json:"libraryId"`
+	From       string   `json:"from,omitempty"`       // 起始快照ID或UUID，缺省为最早的快照
+	To         string   `json:"to,omitempty"`         // 结束快照ID或UUID，缺省为最新的快照
+	HaveBlocks []string `json:"haveBlocks,omitempty"` // 目标端已有的块，这些块不会随包携带
+}
+
+// BundleImportResult POST /bundles/import 的响应
+type BundleImportResult struct {
+	LibraryID         uint     `json:"libraryId"`
+	SnapshotsImported []string `json:"snapshotsImported"` // 新建的快照 UUID
+	SnapshotsSkipped  []string `json:"snapshotsSkipped"`  // 目标端已存在的快照 UUID
+	BlocksWritten     int      `json:"blocksWritten"`
+	BlocksSkipped     int      `json:"blocksSkipped"`
+	CheckedOut        bool     `json:"checkedOut"` // 库的当前文件是否已更新为包中最新的提交
+}
@@ -0,0 +1,24 @@
+package api
+
+import "github.com/sealock/core-storage/syncproto"
+
+// 变更事件的类型与服务层共用，定义在 syncproto 包中
+type (
+	Event     = syncproto.Event
+	EventType = syncproto.EventType
+)
+
+// EventReset 游标过期时事件流先发送的事件类型，data 为 {"cursor": 新游标}，客户端需要做一次全量同步
+const EventReset = "reset"
+
+// EventList GET /events/libraries/{libraryId} 的响应，cursor 为下次轮询使用的游标
+type EventList struct {
+	Events []Event `json:"events"`
+	Cursor uint64  `json:"cursor"`
+}
+
+// CursorExpiredError 轮询的游标已过期时的错误响应（410），cursor 为当前游标
+type CursorExpiredError struct {
+	Error
+	Cursor uint64 `json:"cursor"`
+}
@@ -0,0 +1,108 @@
+package api
+
+import "time"
+
+// Snapshot 快照（一次提交或命名快照）
+type Snapshot struct {
+	ID          uint      `json:"id"`
+	UUID        string    `json:"uuid"`
+	LibraryID   uint      `json:"libraryId"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Tag         string    `json:"tag"`
+	ParentID    *uint     `json:"parentId"`
+	RootHash    string    `json:"rootHash"`
+	FileCount   int       `json:"fileCount"`
+	Size        int64     `json:"size"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+// SnapshotFile 快照中的文件
+type SnapshotFile struct {
+	Path string `json:"path"`
+	Hash string `json:"hash"`
+	Size int64  `json:"size"`
+}
+
+// SnapshotList GET /libraries/{libraryId}/snapshots 的响应，最新的在前
+type SnapshotList struct {
+	LibraryID uint       `json:"libraryId"`
+	Snapshots []Snapshot `json:"snapshots"`
+	Page
+}
+
+// CreateSnapshotRequest POST /libraries/{libraryId}/snapshots 的请求体
+type CreateSnapshotRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Tag         string `json:"tag"`
+}
+
+// RevertRequest POST /libraries/{libraryId}/revert 的请求体
+type RevertRequest struct {
+	Snapshot string `json:"snapshot" binding:"required"` // 快照ID或UUID
+}
+
+// RevertResult POST /libraries/{libraryId}/revert 的响应
+type RevertResult struct {
+	LibraryID uint   `json:"libraryId"`
+	Snapshot  string `json:"snapshot"` // 回滚到的快照 UUID
+	Written   int    `json:"written"`  // 恢复或覆盖的文件数
+	Removed   int    `json:"removed"`  // 删除的文件数（快照之后新增的文件）
+}
+
+// SnapshotDetail GET /snapshots/{id} 的响应，files 按 limit/offset 分页
+type SnapshotDetail struct {
+	Snapshot Snapshot       `json:"snapshot"`
+	Files    []SnapshotFile `json:"files"`
+	Page
+}
+
+// SnapshotDiff GET /snapshots/{id}/diff 的响应，from 为 nil 时所有文件均为新增
+type SnapshotDiff struct {
+	From     *Snapshot      `json:"from"`
+	To       Snapshot       `json:"to"`
+	Added    []SnapshotFile `json:"added"`
+	Removed  []SnapshotFile `json:"removed"`
+	Modified []SnapshotFile `json:"modified"`
+}
+
+// TreeEntry 快照目录中的一个子项
+type TreeEntry struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+	Type string `json:"type"` // file 或 dir
+	Size int64  `json:"size"`
+	Hash string `json:"hash"`
+}
+
+// SnapshotTree GET /snapshots/{id}/tree 的响应
+type SnapshotTree struct {
+	Snapshot string      `json:"snapshot"` // 快照 UUID
+	Path     string      `json:"path"`
+	Entries  []TreeEntry `json:"entries"`
+}
+
+// RetentionPolicy 库的快照保留策略，计数规则为 0 表示不启用
+type RetentionPolicy struct {
+	LibraryID     uint  `json:"libraryId"`
+	Configured    bool  `json:"configured"` // 为 false 时库未配置策略，返回的是默认策略（保留全部快照）
+	KeepLast      int   `json:"keepLast"`
+	KeepHourly    int   `json:"keepHourly"`
+	KeepDaily     int   `json:"keepDaily"`
+	KeepWeekly    int   `json:"keepWeekly"`
+	KeepMonthly   int   `json:"keepMonthly"`
+	KeepTagged    bool  `json:"keepTagged"`
+	MaxAgeSeconds int64 `json:"maxAgeSeconds"` // 超过该时长的快照一律过期，0 表示不限制
+}
+
+// SetRetentionPolicyRequest PUT /libraries/{libraryId}/retention 的请求体
+type SetRetentionPolicyRequest struct {
+	KeepLast      int   `json:"keepLast"`
+	KeepHourly    int   `json:"keepHourly"`
+	KeepDaily     int   `json:"keepDaily"`
+	KeepWeekly    int   `json:"keepWeekly"`
+	KeepMonthly   int   `json:"keepMonthly"`
+	KeepTagged    *bool `json:"keepTagged,omitempty"` // 缺省为 true
+	MaxAgeSeconds int64 `json:"maxAgeSeconds"`
+}
@@ -0,0 +1,52 @@
+package api
+
+import "time"
+
+// Library 库
+type Library struct {
+	ID               uint      `json:"id"`
+	UUID             string    `json:"uuid"`
+	Name             string    `json:"name"`
+	Description      string    `json:"description"`
+	OwnerID          uint      `json:"ownerId"`
+	CurrentVersionID uint      `json:"currentVersionId"`
+	TotalSize        int64     `json:"totalSize"`
+	FileCount        int       `json:"fileCount"`
+	VersionCount     int       `json:"versionCount"`
+	CreatedAt        time.Time `json:"createdAt"`
+	UpdatedAt        time.Time `json:"updatedAt"`
+}
+
+// LibraryVersion 库的一个版本（提交）
+type LibraryVersion struct {
+	ID        uint      `json:"id"`
+	CommitID  string    `json:"commitId"`
+	RootHash  string    `json:"rootHash"`
+	Message   string    `json:"message"`
+	Author    string    `json:"author"`
+	Parents   []string  `json:"parents"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// CreateLibraryRequest POST /libraries 的请求体
+type CreateLibraryRequest struct {
+	Name        string `json:"name" binding:"required"`
+	Description string `json:"description"`
+}
+
+// UpdateLibraryRequest PATCH /libraries/{libraryId} 的请求体，为 nil 的字段保持不变
+type UpdateLibraryRequest struct {
+	Name        *string `json:"name,omitempty"`
+	Description *string `json:"description,omitempty"`
+}
+
+// LibraryList GET /libraries 的响应
+type LibraryList struct {
+	Libraries []Library `json:"libraries"`
+}
+
+// VersionList GET /libraries/{libraryId}/versions 的响应，最新的版本在前
+type VersionList struct {
+	LibraryID uint             `json:"libraryId"`
+	Versions  []LibraryVersion `json:"versions"`
+}
@@ -0,0 +1,37 @@
+package api
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed openapi.yaml
+var openAPIYAML []byte
+
+var (
+	openAPIJSONOnce sync.Once
+	openAPIJSON     []byte
+	openAPIJSONErr  error
+)
+
+// OpenAPIYAML 返回 OpenAPI 3 文档（YAML）
+func OpenAPIYAML() []byte {
+	return openAPIYAML
+}
+
+// OpenAPIJSON 返回 JSON 格式的 OpenAPI 3 文档，首次调用时由 YAML 转换并缓存
+func OpenAPIJSON() ([]byte, error) {
+	openAPIJSONOnce.Do(func() {
+		var doc interface{}
+		if err := yaml.Unmarshal(openAPIYAML, &doc); err != nil {
+			openAPIJSONErr = fmt.Errorf("failed to parse openapi.yaml: %w", err)
+			return
+		}
+		openAPIJSON, openAPIJSONErr = json.Marshal(doc)
+	})
+	return openAPIJSON, openAPIJSONErr
+}
@@ -0,0 +1,82 @@
+package api
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// errorCodes 返回 api.go 中定义的全部错误码常量的值
+func errorCodes(t *testing.T) []string {
+	t.Helper()
+	file, err := parser.ParseFile(token.NewFileSet(), "api.go", nil, 0)
+	if err != nil {
+		t.Fatalf("parse api.go: %v", err)
+	}
+	var codes []string
+	for _, decl := range file.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.CONST {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			value := spec.(*ast.ValueSpec)
+			for i, name := range value.Names {
+				if !strings.HasPrefix(name.Name, "Code") {
+					continue
+				}
+				code, err := strconv.Unquote(value.Values[i].(*ast.BasicLit).Value)
+				if err != nil {
+					t.Fatalf("%s: %v", name.Name, err)
+				}
+				codes = append(codes, code)
+			}
+		}
+	}
+	sort.Strings(codes)
+	return codes
+}
+
+func TestOpenAPIErrorCodes(t *testing.T) {
+	var doc struct {
+		Components struct {
+			Schemas struct {
+				Error struct {
+					Required   []string `yaml:"required"`
+					Properties struct {
+						Code struct {
+							Description string   `yaml:"description"`
+							Enum        []string `yaml:"enum"`
+						} `yaml:"code"`
+					} `yaml:"properties"`
+				} `yaml:"Error"`
+			} `yaml:"schemas"`
+		} `yaml:"components"`
+	}
+	if err := yaml.Unmarshal(OpenAPIYAML(), &doc); err != nil {
+		t.Fatalf("parse openapi.yaml: %v", err)
+	}
+	schema := doc.Components.Schemas.Error
+	if strings.Join(schema.Required, ",") != "code,error" {
+		t.Fatalf("Error schema requires %v, want code and error", schema.Required)
+	}
+
+	// 文档列出的错误码与 api 包中的常量一致，每个错误码都有说明
+	want := errorCodes(t)
+	got := append([]string(nil), schema.Properties.Code.Enum...)
+	sort.Strings(got)
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("documented codes %v, want %v", got, want)
+	}
+	for _, code := range want {
+		if !strings.Contains(schema.Properties.Code.Description, "`"+code+"`") {
+			t.Errorf("code %s is not described", code)
+		}
+	}
+}
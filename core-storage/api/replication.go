@@ -0,0 +1,91 @@
+package api
+
+import "time"
+
+// ReplicationStatus 副本状态与延迟指标
+type ReplicationStatus struct {
+	LibraryID        uint       `json:"libraryId"`
+	PrimaryURL       string     `json:"primaryUrl"`
+	PrimaryLibraryID uint       `json:"primaryLibraryId"`
+	Role             string     `json:"role"`
+	Running          bool       `json:"running"`
+	LastCommit       string     `json:"lastCommit"`
+	LastCommitAt     *time.Time `json:"lastCommitAt,omitempty"`
+	PrimaryHead      string     `json:"primaryHead"`
+	PrimaryHeadAt    *time.Time `json:"primaryHeadAt,omitempty"`
+	CommitsBehind    int        `json:"commitsBehind"`
+	LagSeconds       float64    `json:"lagSeconds"` // 已落后的提交跨越的时长，追平时为 0
+	CommitsApplied   int64      `json:"commitsApplied"`
+	BlocksFetched    int64      `json:"blocksFetched"`
+	BytesFetched     int64      `json:"bytesFetched"`
+	LastSyncAt       *time.Time `json:"lastSyncAt,omitempty"`
+	LastSuccessAt    *time.Time `json:"lastSuccessAt,omitempty"`
+	LastError        string     `json:"lastError,omitempty"`
+	PromotedAt       *time.Time `json:"promotedAt,omitempty"`
+}
+
+// ReplicationResult 一次复制的结果
+type ReplicationResult struct {
+	LibraryID      uint   `json:"libraryId"`
+	CommitsApplied int    `json:"commitsApplied"`
+	BlocksFetched  int    `json:"blocksFetched"`
+	BytesFetched   int64  `json:"bytesFetched"`
+	CommitsBehind  int    `json:"commitsBehind"`
+	LastCommit     string `json:"lastCommit"`
+}
+
+// ReplicationFeed 主服务器提交日志中的一页
+type ReplicationFeed struct {
+	LibraryID uint             `json:"libraryId"`
+	Head      string           `json:"head"` // 主服务器最新提交
+	HeadAt    *time.Time       `json:"headAt,omitempty"`
+	Behind    int              `json:"behind"`  // 游标之后的提交总数（含本页）
+	Commits   []BundleSnapshot `json:"commits"` // 按创建时间正序
+	Blocks    []BundleBlock    `json:"blocks"`  // 本页提交引用的所有块
+	More      bool             `json:"more"`    // 本页之后是否还有提交
+}
+
+// BundleSnapshot 包中的一次提交
+type BundleSnapshot struct {
+	UUID        string       `json:"uuid"`
+	ParentUUID  string       `json:"parentUuid,omitempty"`
+	Name        string       `json:"name"`
+	Description string       `json:"description"`
+	Tag         string       `json:"tag,omitempty"`
+	RootHash    string       `json:"rootHash"`
+	CreatedAt   time.Time    `json:"createdAt"`
+	Files       []BundleFile `json:"files"`
+}
+
+// BundleFile 提交中的文件（树条目）
+type BundleFile struct {
+	Path   string   `json:"path"`
+	Hash   string   `json:"hash"`
+	Size   int64    `json:"size"`
+	Blocks []string `json:"blocks"`
+}
+
+// BundleBlock 块描述
+type BundleBlock struct {
+	Hash     string `json:"hash"`
+	Size     int64  `json:"size"`
+	Included bool   `json:"included"` // 块数据是否随包携带
+}
+
+// ConfigureReplicationRequest PUT /replication/libraries/{libraryId} 的请求体
+type ConfigureReplicationRequest struct {
+	PrimaryURL       string `json:"primaryUrl" binding:"required"`
+	PrimaryLibraryID uint   `json:"primaryLibraryId"`
+	Token            string `json:"token,omitempty"` // 访问主服务器使用的令牌
+}
+
+// ReplicationStatusList GET /replication/status 的响应
+type ReplicationStatusList struct {
+	Replications []ReplicationStatus `json:"replications"`
+}
+
+// ReplicationError 立即复制失败时的错误响应（502），result 为失败前已完成的部分
+type ReplicationError struct {
+	Error
+	Result *ReplicationResult `json:"result"`
+}
@@ -0,0 +1,21 @@
+package api
+
+import "time"
+
+// S3AccessKey S3 网关的访问密钥
+type S3AccessKey struct {
+	AccessKeyID string    `json:"accessKeyId"`
+	SecretKey   string    `json:"secretKey,omitempty"` // 只在创建时返回
+	Description string    `json:"description,omitempty"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+// S3AccessKeyList 用户的 S3 访问密钥列表
+type S3AccessKeyList struct {
+	Keys []S3AccessKey `json:"keys"`
+}
+
+// CreateS3AccessKeyRequest 创建 S3 访问密钥的请求
+type CreateS3AccessKeyRequest struct {
+	Description string `json:"description,omitempty"`
+}
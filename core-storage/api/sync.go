@@ -0,0 +1,87 @@
+package api
+
+import (
+	"time"
+
+	"github.com/sealock/core-storage/syncproto"
+)
+
+// 增量同步协议的类型与服务层共用，定义在 syncproto 包中
+type (
+	SyncDiffRequest    = syncproto.SyncDiffRequest
+	SyncDiffResponse   = syncproto.SyncDiffResponse
+	SyncSubtree        = syncproto.SyncSubtree
+	SyncEntry          = syncproto.SyncEntry
+	SyncPushRequest    = syncproto.SyncPushRequest
+	SyncPushResponse   = syncproto.SyncPushResponse
+	SyncFile           = syncproto.SyncFile
+	SyncDeletion       = syncproto.SyncDeletion
+	SyncConflictResult = syncproto.SyncConflictResult
+)
+
+// ConflictPolicy 冲突策略
+type ConflictPolicy string
+
+// 可选的冲突策略，含义见 model.ConflictPolicy
+const (
+	ConflictKeepBoth   ConflictPolicy = "keep_both"
+	ConflictNewestWins ConflictPolicy = "newest_wins"
+	ConflictServerWins ConflictPolicy = "server_wins"
+	ConflictManual     ConflictPolicy = "manual"
+)
+
+// MissingBlocksError 提交变更时服务端缺少数据块的错误响应（412），客户端上传这些块后重试
+type MissingBlocksError struct {
+	Error
+	MissingBlocks []string `json:"missingBlocks"`
+}
+
+// CheckBlocksRequest POST /sync/blocks/check 的请求体
+type CheckBlocksRequest struct {
+	Hashes []string `json:"hashes"`
+}
+
+// CheckBlocksResponse POST /sync/blocks/check 的响应
+type CheckBlocksResponse struct {
+	Missing []string `json:"missing"`
+}
+
+// SetConflictPolicyRequest PUT /sync/libraries/{libraryId}/conflict-policy 的请求体
+type SetConflictPolicyRequest struct {
+	Policy ConflictPolicy `json:"policy"`
+}
+
+// ConflictPolicySetting 库的冲突策略
+type ConflictPolicySetting struct {
+	LibraryID uint           `json:"libraryId"`
+	Policy    ConflictPolicy `json:"policy"`
+}
+
+// Conflict 同步冲突记录
+type Conflict struct {
+	ID            uint       `json:"id"`
+	LibraryID     uint       `json:"libraryId"`
+	Path          string     `json:"path"`
+	BaseHash      string     `json:"baseHash"`
+	ServerHash    string     `json:"serverHash"`
+	ClientHash    string     `json:"clientHash"`
+	ClientSize    int64      `json:"clientSize"`
+	ClientModTime time.Time  `json:"clientModTime"`
+	ClientID      string     `json:"clientId"`
+	Policy        string     `json:"policy"`
+	Status        string     `json:"status"`     // open 或 resolved
+	Resolution    string     `json:"resolution"` // server、client 或 keep_both
+	CopyPath      string     `json:"copyPath"`
+	CreatedAt     time.Time  `json:"createdAt"`
+	ResolvedAt    *time.Time `json:"resolvedAt"`
+}
+
+// ConflictList GET /sync/libraries/{libraryId}/conflicts 的响应
+type ConflictList struct {
+	Conflicts []Conflict `json:"conflicts"`
+}
+
+// ResolveConflictRequest POST /sync/conflicts/{id}/resolve 的请求体
+type ResolveConflictRequest struct {
+	Resolution string `json:"resolution"` // server、client 或 keep_both
+}
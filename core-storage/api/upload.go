@@ -0,0 +1,80 @@
+package api
+
+import "time"
+
+// FileInfo 文件的基本信息
+type FileInfo struct {
+	ID        uint   `json:"id"`
+	LibraryID uint   `json:"libraryId"`
+	Name      string `json:"name"`
+	Size      int64  `json:"size"`
+	Hash      string `json:"hash"`
+}
+
+// CheckFileResponse GET /upload/check 的响应，exists 表示当前用户可以读取的库中是否有内容相同的文件
+type CheckFileResponse struct {
+	Exists bool `json:"exists"`
+}
+
+// CreateUploadSessionRequest POST /upload/sessions 的请求体
+type CreateUploadSessionRequest struct {
+	LibraryID   uint     `json:"libraryId"`
+	FileName    string   `json:"fileName" binding:"required"` // 库内路径，已存在时覆盖
+	FileSize    int64    `json:"fileSize"`
+	FileHash    string   `json:"fileHash,omitempty"` // 可选，分片哈希列表的 Merkle 哈希
+	ChunkHashes []string `json:"chunkHashes"`
+}
+
+// UploadSession 上传会话，客户端可凭 uploadId 断点续传
+type UploadSession struct {
+	UploadID    string    `json:"uploadId"`    // 上传会话的唯一标识符
+	LibraryID   uint      `json:"libraryId"`   // 目标库
+	FileName    string    `json:"fileName"`    // 库内目标路径
+	FileSize    int64     `json:"fileSize"`    // 文件大小（字节）
+	FileHash    string    `json:"fileHash"`    // 期望的文件内容哈希值（分片哈希列表的 Merkle 哈希）
+	TotalChunks int       `json:"totalChunks"` // 总分片数量
+	ChunkHashes []string  `json:"chunkHashes"` // 各个分片的哈希值列表
+	OwnerID     uint      `json:"ownerId"`     // 发起上传的用户，0 表示未认证
+	Reserved    int64     `json:"reserved"`    // 为本会话预留的配额（字节），会话结束时释放
+	CreatedAt   time.Time `json:"createdAt"`   // 创建时间
+	ExpiresAt   time.Time `json:"expiresAt"`   // 过期时间
+}
+
+// UploadSessionStatus 上传会话的进度，POST /upload/sessions 和 GET /upload/sessions/{uploadId} 的响应
+type UploadSessionStatus struct {
+	Session  *UploadSession `json:"session"`
+	Received []int          `json:"received"` // 已接收的分片索引（升序）
+	Missing  []int          `json:"missing"`  // 尚未接收的分片索引（升序）
+	Complete bool           `json:"complete"` // 分片已齐全，可以完成上传
+}
+
+// ChunkUploaded 上传分片的响应
+type ChunkUploaded struct {
+	ChunkIndex int    `json:"chunkIndex"`
+	ChunkHash  string `json:"chunkHash"`
+	Status     string `json:"status"` // 总是 uploaded
+}
+
+// ChunkHashMismatchError 分片数据与请求中的 chunkHash 不一致时的错误响应
+type ChunkHashMismatchError struct {
+	Error
+	Expected string `json:"expected"`
+	Actual   string `json:"actual"`
+}
+
+// FinishUploadRequest POST /upload/finish 的请求体
+type FinishUploadRequest struct {
+	UploadID string `json:"uploadId" binding:"required"`
+}
+
+// FinishUploadResponse POST /upload/finish 的响应
+type FinishUploadResponse struct {
+	File FileInfo `json:"file"`
+}
+
+// MissingChunksError 完成上传时仍缺少分片的错误响应
+type MissingChunksError struct {
+	Error
+	Missing     []int `json:"missing"`
+	TotalChunks int   `json:"totalChunks"`
+}
@@ -0,0 +1,64 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/sealock/core-storage/api"
+)
+
+// DownloadZip 把库中的文件和目录打包为 zip 下载，调用方负责关闭返回的 ReadCloser
+// paths 为空时打包整个库；snapshot 为快照ID或UUID，为空时打包当前版本
+func (c *Client) DownloadZip(ctx context.Context, libraryID uint, snapshot string, paths ...string) (io.ReadCloser, error) {
+	query := url.Values{}
+	for _, p := range paths {
+		query.Add("path", p)
+	}
+	if snapshot != "" {
+		query.Set("snapshot", snapshot)
+	}
+	return c.doStream(ctx, http.MethodGet, libraryPath(libraryID)+"/zip", query, nil, "", nil)
+}
+
+// ImportArchive 把 tar、tar.gz 或 zip 归档展开到库中的目录 target，整个导入记录为一个提交
+// format 为 api.ArchiveTar、api.ArchiveTarGz 或 api.ArchiveZip，为空时由服务端按内容识别
+func (c *Client) ImportArchive(ctx context.Context, libraryID uint, target, format string, archive io.Reader) (*api.ArchiveImportResult, error) {
+	query := url.Values{}
+	if target != "" {
+		query.Set("path", target)
+	}
+	if format != "" {
+		query.Set("format", format)
+	}
+
+	var result api.ArchiveImportResult
+	if err := c.doBody(ctx, http.MethodPost, libraryPath(libraryID)+"/import", query, archive, "application/octet-stream", nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// ExportBundle 导出一段提交为快照包（tar 流），调用方负责关闭返回的 ReadCloser
+func (c *Client) ExportBundle(ctx context.Context, req *api.BundleExportRequest) (io.ReadCloser, error) {
+	payload, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	return c.doStream(ctx, http.MethodPost, "/api/v1/bundles/export", nil, bytes.NewReader(payload), "application/json", nil)
+}
+
+// ImportBundle 把快照包导入到库
+func (c *Client) ImportBundle(ctx context.Context, libraryID uint, bundle io.Reader) (*api.BundleImportResult, error) {
+	query := url.Values{"libraryId": {strconv.FormatUint(uint64(libraryID), 10)}}
+	var result api.BundleImportResult
+	if err := c.doBody(ctx, http.MethodPost, "/api/v1/bundles/import", query, bundle, "application/x-tar", nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
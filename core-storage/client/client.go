@@ -0,0 +1,191 @@
+// Package client 是 Sealock HTTP API（/api/v1）的 Go 客户端
+// 请求与响应使用 api 包中的类型，与服务端处理器共用；接口的完整描述见 api 包中的 OpenAPI 文档。
+// 服务端返回的错误转换为 *Error，可按 Code 判断失败原因：
+//
+//	c := client.New("http://localhost:8080", token)
+//	lib, err := c.CreateLibrary(ctx, &api.CreateLibraryRequest{Name: "docs"})
+//	var apiErr *client.Error
+//	if errors.As(err, &apiErr) && apiErr.Code == api.CodeConflict {
+//		// 同名库已存在
+//	}
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/sealock/core-storage/api"
+)
+
+// Client Sealock HTTP API 客户端，可以被多个 goroutine 同时使用
+type Client struct {
+	baseURL string
+	token   string
+	http    *http.Client
+}
+
+// New 创建客户端
+// baseURL 形如 http://localhost:8080，token 为 JWT 访问令牌，可为空
+func New(baseURL, token string) *Client {
+	return &Client{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		token:   token,
+		http:    &http.Client{Timeout: 5 * time.Minute},
+	}
+}
+
+// SetHTTPClient 替换发送请求使用的 http.Client，用于自定义超时、代理或 TLS 配置
+func (c *Client) SetHTTPClient(httpClient *http.Client) {
+	c.http = httpClient
+}
+
+// Error 服务端返回的错误响应
+type Error struct {
+	StatusCode int    // HTTP 状态码
+	Code       string // 错误码，见 api 包中的 Code 常量
+	Message    string // 面向用户的提示
+	Body       []byte // 原始响应体，部分错误附带额外字段，可用 Decode 解析
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("server returned %d", e.StatusCode)
+	}
+	return fmt.Sprintf("server returned %d (%s): %s", e.StatusCode, e.Code, e.Message)
+}
+
+// Decode 把错误响应解析为带额外字段的错误类型，如 api.MissingChunksError、api.MissingBlocksError
+func (e *Error) Decode(v interface{}) error {
+	return json.Unmarshal(e.Body, v)
+}
+
+// IsCode 判断 err 是否为错误码为 code 的服务端错误
+func IsCode(err error, code string) bool {
+	var apiErr *Error
+	return errors.As(err, &apiErr) && apiErr.Code == code
+}
+
+// doJSON 发送 JSON 请求并解析 JSON 响应，in 为 nil 时不发送请求体，out 为 nil 时丢弃响应体
+func (c *Client) doJSON(ctx context.Context, method, path string, query url.Values, in, out interface{}) error {
+	var body io.Reader
+	contentType := ""
+	if in != nil {
+		payload, err := json.Marshal(in)
+		if err != nil {
+			return fmt.Errorf("failed to marshal request: %w", err)
+		}
+		body = bytes.NewReader(payload)
+		contentType = "application/json"
+	}
+	resp, err := c.do(ctx, method, path, query, body, contentType, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return decodeResponse(resp, path, out)
+}
+
+// doBody 发送原始请求体并解析 JSON 响应
+func (c *Client) doBody(ctx context.Context, method, path string, query url.Values, body io.Reader, contentType string, header http.Header, out interface{}) error {
+	resp, err := c.do(ctx, method, path, query, body, contentType, header)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return decodeResponse(resp, path, out)
+}
+
+// doStream 发送请求并返回响应体，调用方负责关闭
+func (c *Client) doStream(ctx context.Context, method, path string, query url.Values, body io.Reader, contentType string, header http.Header) (io.ReadCloser, error) {
+	resp, err := c.do(ctx, method, path, query, body, contentType, header)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// do 发送请求，非 2xx 响应转换为 *Error 并关闭响应体
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body io.Reader, contentType string, header http.Header) (*http.Response, error) {
+	req, err := c.newRequest(ctx, method, path, query, body)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s %s failed: %w", method, path, err)
+	}
+	if err := checkResponse(resp); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	return resp, nil
+}
+
+// newRequest 创建带认证头的请求
+func (c *Client) newRequest(ctx context.Context, method, path string, query url.Values, body io.Reader) (*http.Request, error) {
+	target := c.baseURL + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	return req, nil
+}
+
+// decodeResponse 解析 JSON 响应体
+func decodeResponse(resp *http.Response, path string, out interface{}) error {
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response of %s: %w", path, err)
+	}
+	return nil
+}
+
+// checkResponse 把非 2xx 响应转换为 *Error
+func checkResponse(resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	apiErr := &Error{StatusCode: resp.StatusCode, Body: data}
+	var body api.Error
+	if json.Unmarshal(data, &body) == nil {
+		apiErr.Code, apiErr.Message = body.Code, body.Message
+	}
+	if apiErr.Code == "" {
+		apiErr.Code = api.CodeForStatus(resp.StatusCode)
+	}
+	return apiErr
+}
+
+// escapePath 按段转义库内路径
+func escapePath(p string) string {
+	segments := strings.Split(strings.Trim(p, "/"), "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
@@ -0,0 +1,46 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sealock/core-storage/api"
+)
+
+func TestErrorCode(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Header.Get("Authorization") {
+		case "Bearer replica":
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(api.Error{Code: api.CodeReadOnlyReplica, Message: "库是只读副本"})
+		default:
+			// 代理等返回的非 JSON 错误没有错误码
+			http.Error(w, "bad gateway", http.StatusBadGateway)
+		}
+	}))
+	defer srv.Close()
+
+	// 响应中的错误码原样交给调用方，而不是按状态码推断为 forbidden
+	_, err := New(srv.URL, "replica").ListLibraries(context.Background())
+	var apiErr *Error
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("err = %v, want *Error", err)
+	}
+	if apiErr.StatusCode != http.StatusForbidden || apiErr.Code != api.CodeReadOnlyReplica || apiErr.Message != "库是只读副本" {
+		t.Fatalf("error = %+v", apiErr)
+	}
+	if !IsCode(err, api.CodeReadOnlyReplica) || IsCode(err, api.CodeForbidden) {
+		t.Fatal("IsCode does not match the code of the response")
+	}
+
+	// 没有错误码的响应按状态码给出通用错误码
+	_, err = New(srv.URL, "").ListLibraries(context.Background())
+	if !IsCode(err, api.CodeUpstream) {
+		t.Fatalf("err = %v, want code %s", err, api.CodeUpstream)
+	}
+}
@@ -0,0 +1,101 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/sealock/core-storage/api"
+)
+
+// ListEvents 获取库在 cursor 之后的事件，返回的 Cursor 用于下次轮询
+// 游标过期时返回错误码为 api.CodeCursorExpired 的 *Error，可解析为 api.CursorExpiredError 取得当前游标
+func (c *Client) ListEvents(ctx context.Context, libraryID uint, cursor uint64) (*api.EventList, error) {
+	var query url.Values
+	if cursor != 0 {
+		query = url.Values{"cursor": {strconv.FormatUint(cursor, 10)}}
+	}
+	var list api.EventList
+	if err := c.doJSON(ctx, http.MethodGet, eventLibraryPath(libraryID), query, nil, &list); err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
+// StreamEvents 订阅库的变更事件流（SSE），对每个事件调用 fn，直到连接断开或 ctx 取消
+// cursor 为上次收到的最后一个序号（0 表示只接收新事件）；游标过期时先收到类型为 api.EventReset 的事件，
+// 其 Seq 为新的游标，调用方应做一次全量同步。返回最后收到的序号，供重连时续传
+func (c *Client) StreamEvents(ctx context.Context, libraryID uint, cursor uint64, fn func(eventType string, event api.Event)) (uint64, error) {
+	var query url.Values
+	if cursor != 0 {
+		query = url.Values{"cursor": {strconv.FormatUint(cursor, 10)}}
+	}
+	req, err := c.newRequest(ctx, http.MethodGet, eventLibraryPath(libraryID)+"/stream", query, nil)
+	if err != nil {
+		return cursor, err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+
+	// 事件流是长连接，不能使用带整体超时的客户端
+	stream := &http.Client{Transport: c.http.Transport}
+	resp, err := stream.Do(req)
+	if err != nil {
+		return cursor, fmt.Errorf("failed to subscribe to events: %w", err)
+	}
+	defer resp.Body.Close()
+	if err := checkResponse(resp); err != nil {
+		return cursor, err
+	}
+
+	var id, eventType string
+	var data strings.Builder
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			// 空行结束一个事件
+			if eventType != "" {
+				var event api.Event
+				if eventType != api.EventReset {
+					if err := json.Unmarshal([]byte(data.String()), &event); err != nil {
+						return cursor, fmt.Errorf("invalid event: %w", err)
+					}
+				}
+				if seq, err := strconv.ParseUint(id, 10, 64); err == nil {
+					cursor = seq
+					event.Seq = seq
+				}
+				fn(eventType, event)
+			}
+			id, eventType = "", ""
+			data.Reset()
+		case strings.HasPrefix(line, ":"):
+			// 注释/心跳
+		case strings.HasPrefix(line, "id:"):
+			id = strings.TrimSpace(strings.TrimPrefix(line, "id:"))
+		case strings.HasPrefix(line, "event:"):
+			eventType = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			if data.Len() > 0 {
+				data.WriteByte('\n')
+			}
+			data.WriteString(strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+	if err := scanner.Err(); err != nil && ctx.Err() == nil {
+		return cursor, fmt.Errorf("event stream interrupted: %w", err)
+	}
+	return cursor, nil
+}
+
+// eventLibraryPath 返回库的事件接口路径
+func eventLibraryPath(libraryID uint) string {
+	return fmt.Sprintf("/api/v1/events/libraries/%d", libraryID)
+}
@@ -0,0 +1,114 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/sealock/core-storage/api"
+)
+
+// ListSnapshots 列出库的快照（提交历史），最新的在前；limit 为 0 时使用服务端默认值
+func (c *Client) ListSnapshots(ctx context.Context, libraryID uint, limit, offset int) (*api.SnapshotList, error) {
+	var list api.SnapshotList
+	if err := c.doJSON(ctx, http.MethodGet, libraryPath(libraryID)+"/snapshots", pageQuery(limit, offset), nil, &list); err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
+// CreateSnapshot 为库的当前状态创建命名快照
+func (c *Client) CreateSnapshot(ctx context.Context, libraryID uint, req *api.CreateSnapshotRequest) (*api.Snapshot, error) {
+	var snapshot api.Snapshot
+	if err := c.doJSON(ctx, http.MethodPost, libraryPath(libraryID)+"/snapshots", nil, req, &snapshot); err != nil {
+		return nil, err
+	}
+	return &snapshot, nil
+}
+
+// Revert 把库回滚到快照 snapshot（ID或UUID），回滚本身会生成一个新提交
+func (c *Client) Revert(ctx context.Context, libraryID uint, snapshot string) (*api.RevertResult, error) {
+	var result api.RevertResult
+	req := &api.RevertRequest{Snapshot: snapshot}
+	if err := c.doJSON(ctx, http.MethodPost, libraryPath(libraryID)+"/revert", nil, req, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// GetSnapshot 获取快照详情及一页文件列表，snapshot 为快照ID或UUID
+func (c *Client) GetSnapshot(ctx context.Context, snapshot string, limit, offset int) (*api.SnapshotDetail, error) {
+	var detail api.SnapshotDetail
+	if err := c.doJSON(ctx, http.MethodGet, snapshotPath(snapshot), pageQuery(limit, offset), nil, &detail); err != nil {
+		return nil, err
+	}
+	return &detail, nil
+}
+
+// DiffSnapshots 对比快照 from 与 to，from 为空时与 to 的父快照对比
+func (c *Client) DiffSnapshots(ctx context.Context, to, from string) (*api.SnapshotDiff, error) {
+	var query url.Values
+	if from != "" {
+		query = url.Values{"from": {from}}
+	}
+	var diff api.SnapshotDiff
+	if err := c.doJSON(ctx, http.MethodGet, snapshotPath(to)+"/diff", query, nil, &diff); err != nil {
+		return nil, err
+	}
+	return &diff, nil
+}
+
+// ListSnapshotTree 列出快照中目录 dir 的直接子项，dir 为空时列出根目录
+func (c *Client) ListSnapshotTree(ctx context.Context, snapshot, dir string) (*api.SnapshotTree, error) {
+	var query url.Values
+	if dir != "" {
+		query = url.Values{"path": {dir}}
+	}
+	var tree api.SnapshotTree
+	if err := c.doJSON(ctx, http.MethodGet, snapshotPath(snapshot)+"/tree", query, nil, &tree); err != nil {
+		return nil, err
+	}
+	return &tree, nil
+}
+
+// DownloadSnapshotFile 读取快照中的文件，调用方负责关闭返回的 ReadCloser
+func (c *Client) DownloadSnapshotFile(ctx context.Context, snapshot, filePath string) (io.ReadCloser, error) {
+	return c.doStream(ctx, http.MethodGet, snapshotPath(snapshot)+"/files/"+escapePath(filePath), nil, nil, "", nil)
+}
+
+// GetRetentionPolicy 获取库的快照保留策略，未配置时返回默认策略（Configured 为 false）
+func (c *Client) GetRetentionPolicy(ctx context.Context, libraryID uint) (*api.RetentionPolicy, error) {
+	var policy api.RetentionPolicy
+	if err := c.doJSON(ctx, http.MethodGet, libraryPath(libraryID)+"/retention", nil, nil, &policy); err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// SetRetentionPolicy 设置库的快照保留策略
+func (c *Client) SetRetentionPolicy(ctx context.Context, libraryID uint, req *api.SetRetentionPolicyRequest) (*api.RetentionPolicy, error) {
+	var policy api.RetentionPolicy
+	if err := c.doJSON(ctx, http.MethodPut, libraryPath(libraryID)+"/retention", nil, req, &policy); err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// snapshotPath 返回快照资源的路径
+func snapshotPath(snapshot string) string {
+	return "/api/v1/snapshots/" + url.PathEscape(snapshot)
+}
+
+// pageQuery 返回分页参数，为 0 的参数省略
+func pageQuery(limit, offset int) url.Values {
+	query := url.Values{}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+	if offset > 0 {
+		query.Set("offset", strconv.Itoa(offset))
+	}
+	return query
+}
@@ -0,0 +1,64 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/sealock/core-storage/api"
+)
+
+// CreateLibrary 创建库
+func (c *Client) CreateLibrary(ctx context.Context, req *api.CreateLibraryRequest) (*api.Library, error) {
+	var lib api.Library
+	if err := c.doJSON(ctx, http.MethodPost, "/api/v1/libraries", nil, req, &lib); err != nil {
+		return nil, err
+	}
+	return &lib, nil
+}
+
+// ListLibraries 列出当前用户的库
+func (c *Client) ListLibraries(ctx context.Context) ([]api.Library, error) {
+	var list api.LibraryList
+	if err := c.doJSON(ctx, http.MethodGet, "/api/v1/libraries", nil, nil, &list); err != nil {
+		return nil, err
+	}
+	return list.Libraries, nil
+}
+
+// GetLibrary 获取库详情
+func (c *Client) GetLibrary(ctx context.Context, libraryID uint) (*api.Library, error) {
+	var lib api.Library
+	if err := c.doJSON(ctx, http.MethodGet, libraryPath(libraryID), nil, nil, &lib); err != nil {
+		return nil, err
+	}
+	return &lib, nil
+}
+
+// UpdateLibrary 重命名库或修改描述，req 中为 nil 的字段保持不变
+func (c *Client) UpdateLibrary(ctx context.Context, libraryID uint, req *api.UpdateLibraryRequest) (*api.Library, error) {
+	var lib api.Library
+	if err := c.doJSON(ctx, http.MethodPatch, libraryPath(libraryID), nil, req, &lib); err != nil {
+		return nil, err
+	}
+	return &lib, nil
+}
+
+// DeleteLibrary 删除库及其全部文件和历史版本
+func (c *Client) DeleteLibrary(ctx context.Context, libraryID uint) error {
+	return c.doJSON(ctx, http.MethodDelete, libraryPath(libraryID), nil, nil, nil)
+}
+
+// ListVersions 列出库的版本，最新的在前
+func (c *Client) ListVersions(ctx context.Context, libraryID uint) ([]api.LibraryVersion, error) {
+	var list api.VersionList
+	if err := c.doJSON(ctx, http.MethodGet, libraryPath(libraryID)+"/versions", nil, nil, &list); err != nil {
+		return nil, err
+	}
+	return list.Versions, nil
+}
+
+// libraryPath 返回库资源的路径
+func libraryPath(libraryID uint) string {
+	return fmt.Sprintf("/api/v1/libraries/%d", libraryID)
+}
@@ -0,0 +1,99 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/sealock/core-storage/api"
+)
+
+// CommitFeed 获取主服务器上库在 after（提交 UUID）之后的提交，after 为空时从最早的提交开始
+// since 不为零时只返回该时间之后的提交；limit 为 0 时使用服务端默认值
+func (c *Client) CommitFeed(ctx context.Context, libraryID uint, after string, since time.Time, limit int) (*api.ReplicationFeed, error) {
+	query := url.Values{}
+	if after != "" {
+		query.Set("after", after)
+	}
+	if !since.IsZero() {
+		query.Set("since", since.Format(time.RFC3339Nano))
+	}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+	var feed api.ReplicationFeed
+	if err := c.doJSON(ctx, http.MethodGet, replicationLibraryPath(libraryID)+"/commits", query, nil, &feed); err != nil {
+		return nil, err
+	}
+	return &feed, nil
+}
+
+// GetReplicationBlock 从主服务器下载库引用的单个块
+func (c *Client) GetReplicationBlock(ctx context.Context, libraryID uint, hash string) ([]byte, error) {
+	body, err := c.doStream(ctx, http.MethodGet, replicationLibraryPath(libraryID)+"/blocks/"+url.PathEscape(hash), nil, nil, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	return io.ReadAll(body)
+}
+
+// ConfigureReplication 把本地库配置为主服务器上某个库的副本
+func (c *Client) ConfigureReplication(ctx context.Context, libraryID uint, req *api.ConfigureReplicationRequest) (*api.ReplicationStatus, error) {
+	var status api.ReplicationStatus
+	if err := c.doJSON(ctx, http.MethodPut, replicationLibraryPath(libraryID), nil, req, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// RemoveReplication 删除库的复制配置，已复制的数据保留
+func (c *Client) RemoveReplication(ctx context.Context, libraryID uint) error {
+	return c.doJSON(ctx, http.MethodDelete, replicationLibraryPath(libraryID), nil, nil, nil)
+}
+
+// ReplicationStatus 获取副本的复制状态与延迟
+func (c *Client) ReplicationStatus(ctx context.Context, libraryID uint) (*api.ReplicationStatus, error) {
+	var status api.ReplicationStatus
+	if err := c.doJSON(ctx, http.MethodGet, replicationLibraryPath(libraryID)+"/status", nil, nil, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// ListReplicationStatus 获取所有副本的复制状态
+func (c *Client) ListReplicationStatus(ctx context.Context) ([]api.ReplicationStatus, error) {
+	var list api.ReplicationStatusList
+	if err := c.doJSON(ctx, http.MethodGet, "/api/v1/replication/status", nil, nil, &list); err != nil {
+		return nil, err
+	}
+	return list.Replications, nil
+}
+
+// ReplicateNow 立即从主服务器拉取新提交
+// 访问主服务器失败时返回错误码为 api.CodeUpstream 的 *Error，可解析为 api.ReplicationError
+func (c *Client) ReplicateNow(ctx context.Context, libraryID uint) (*api.ReplicationResult, error) {
+	var result api.ReplicationResult
+	if err := c.doJSON(ctx, http.MethodPost, replicationLibraryPath(libraryID)+"/sync", nil, nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// PromoteReplica 把副本提升为主库
+func (c *Client) PromoteReplica(ctx context.Context, libraryID uint) (*api.ReplicationStatus, error) {
+	var status api.ReplicationStatus
+	if err := c.doJSON(ctx, http.MethodPost, replicationLibraryPath(libraryID)+"/promote", nil, nil, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// replicationLibraryPath 返回库的复制接口路径
+func replicationLibraryPath(libraryID uint) string {
+	return fmt.Sprintf("/api/v1/replication/libraries/%d", libraryID)
+}
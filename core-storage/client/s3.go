@@ -0,0 +1,32 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+
+	"github.com/sealock/core-storage/api"
+)
+
+// CreateS3AccessKey 创建 S3 网关的访问密钥，返回的 SecretKey 只在这一次可以获取
+func (c *Client) CreateS3AccessKey(ctx context.Context, description string) (*api.S3AccessKey, error) {
+	var key api.S3AccessKey
+	if err := c.doJSON(ctx, http.MethodPost, "/api/v1/s3/keys", nil, &api.CreateS3AccessKeyRequest{Description: description}, &key); err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// ListS3AccessKeys 列出当前用户的 S3 访问密钥（不含 secret key）
+func (c *Client) ListS3AccessKeys(ctx context.Context) ([]api.S3AccessKey, error) {
+	var list api.S3AccessKeyList
+	if err := c.doJSON(ctx, http.MethodGet, "/api/v1/s3/keys", nil, nil, &list); err != nil {
+		return nil, err
+	}
+	return list.Keys, nil
+}
+
+// DeleteS3AccessKey 删除 S3 访问密钥
+func (c *Client) DeleteS3AccessKey(ctx context.Context, accessKeyID string) error {
+	return c.doJSON(ctx, http.MethodDelete, "/api/v1/s3/keys/"+url.PathEscape(accessKeyID), nil, nil, nil)
+}
@@ -0,0 +1,99 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/sealock/core-storage/api"
+)
+
+// SyncDiff 上报目录树哈希，获取服务端哈希不一致的子树
+func (c *Client) SyncDiff(ctx context.Context, libraryID uint, req *api.SyncDiffRequest) (*api.SyncDiffResponse, error) {
+	var resp api.SyncDiffResponse
+	if err := c.doJSON(ctx, http.MethodPost, syncLibraryPath(libraryID)+"/diff", nil, req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// SyncPush 提交本地变更，冲突按库的冲突策略处理并在响应的 Conflicts 中返回
+// 服务端缺少数据块时返回错误码为 api.CodeMissingBlocks 的 *Error，可解析为 api.MissingBlocksError
+func (c *Client) SyncPush(ctx context.Context, libraryID uint, req *api.SyncPushRequest) (*api.SyncPushResponse, error) {
+	var resp api.SyncPushResponse
+	if err := c.doJSON(ctx, http.MethodPost, syncLibraryPath(libraryID)+"/push", nil, req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// CheckBlocks 返回 hashes 中服务端缺少的块
+func (c *Client) CheckBlocks(ctx context.Context, hashes []string) ([]string, error) {
+	var resp api.CheckBlocksResponse
+	req := &api.CheckBlocksRequest{Hashes: hashes}
+	if err := c.doJSON(ctx, http.MethodPost, "/api/v1/sync/blocks/check", nil, req, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Missing, nil
+}
+
+// PutBlock 上传单个块
+func (c *Client) PutBlock(ctx context.Context, hash string, data []byte) error {
+	return c.doBody(ctx, http.MethodPut, "/api/v1/sync/blocks/"+url.PathEscape(hash), nil, bytes.NewReader(data), "application/octet-stream", nil, nil)
+}
+
+// GetBlock 下载单个块
+func (c *Client) GetBlock(ctx context.Context, hash string) ([]byte, error) {
+	body, err := c.doStream(ctx, http.MethodGet, "/api/v1/sync/blocks/"+url.PathEscape(hash), nil, nil, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	return io.ReadAll(body)
+}
+
+// GetConflictPolicy 获取库的冲突策略
+func (c *Client) GetConflictPolicy(ctx context.Context, libraryID uint) (api.ConflictPolicy, error) {
+	var setting api.ConflictPolicySetting
+	if err := c.doJSON(ctx, http.MethodGet, syncLibraryPath(libraryID)+"/conflict-policy", nil, nil, &setting); err != nil {
+		return "", err
+	}
+	return setting.Policy, nil
+}
+
+// SetConflictPolicy 设置库的冲突策略
+func (c *Client) SetConflictPolicy(ctx context.Context, libraryID uint, policy api.ConflictPolicy) error {
+	req := &api.SetConflictPolicyRequest{Policy: policy}
+	return c.doJSON(ctx, http.MethodPut, syncLibraryPath(libraryID)+"/conflict-policy", nil, req, nil)
+}
+
+// ListConflicts 列出库的冲突记录，status 为 open 或 resolved，为空时列出全部
+func (c *Client) ListConflicts(ctx context.Context, libraryID uint, status string) ([]api.Conflict, error) {
+	var query url.Values
+	if status != "" {
+		query = url.Values{"status": {status}}
+	}
+	var list api.ConflictList
+	if err := c.doJSON(ctx, http.MethodGet, syncLibraryPath(libraryID)+"/conflicts", query, nil, &list); err != nil {
+		return nil, err
+	}
+	return list.Conflicts, nil
+}
+
+// ResolveConflict 处理挂起的冲突，resolution 为 server、client 或 keep_both
+func (c *Client) ResolveConflict(ctx context.Context, conflictID uint, resolution string) (*api.Conflict, error) {
+	var conflict api.Conflict
+	req := &api.ResolveConflictRequest{Resolution: resolution}
+	if err := c.doJSON(ctx, http.MethodPost, fmt.Sprintf("/api/v1/sync/conflicts/%d/resolve", conflictID), nil, req, &conflict); err != nil {
+		return nil, err
+	}
+	return &conflict, nil
+}
+
+// syncLibraryPath 返回库的同步接口路径
+func syncLibraryPath(libraryID uint) string {
+	return fmt.Sprintf("/api/v1/sync/libraries/%d", libraryID)
+}
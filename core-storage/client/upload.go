@@ -0,0 +1,73 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/sealock/core-storage/api"
+)
+
+// CheckFile 按内容哈希检查文件是否已存在（秒传）
+func (c *Client) CheckFile(ctx context.Context, fileHash string) (*api.CheckFileResponse, error) {
+	var resp api.CheckFileResponse
+	query := url.Values{"fileHash": {fileHash}}
+	if err := c.doJSON(ctx, http.MethodGet, "/api/v1/upload/check", query, nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// CreateUploadSession 创建上传会话
+// 当前用户可以读取的文件中已有的分片直接记为已接收，只需上传返回的 Missing 中的分片；Complete 为 true 时可直接完成上传
+func (c *Client) CreateUploadSession(ctx context.Context, req *api.CreateUploadSessionRequest) (*api.UploadSessionStatus, error) {
+	var status api.UploadSessionStatus
+	if err := c.doJSON(ctx, http.MethodPost, "/api/v1/upload/sessions", nil, req, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// GetUploadSession 查询上传进度
+func (c *Client) GetUploadSession(ctx context.Context, uploadID string) (*api.UploadSessionStatus, error) {
+	var status api.UploadSessionStatus
+	if err := c.doJSON(ctx, http.MethodGet, "/api/v1/upload/sessions/"+url.PathEscape(uploadID), nil, nil, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// UploadChunk 上传一个分片，分片可以按任意顺序、并发上传
+// 分片哈希随请求发送，数据在传输中损坏时服务端返回 api.CodeChunkHashMismatch
+func (c *Client) UploadChunk(ctx context.Context, uploadID string, chunkIndex int, data []byte) (*api.ChunkUploaded, error) {
+	sum := sha256.Sum256(data)
+	path := fmt.Sprintf("/api/v1/upload/sessions/%s/chunks/%d", url.PathEscape(uploadID), chunkIndex)
+	header := http.Header{"X-Chunk-Hash": {hex.EncodeToString(sum[:])}}
+
+	var uploaded api.ChunkUploaded
+	if err := c.doBody(ctx, http.MethodPut, path, nil, bytes.NewReader(data), "application/octet-stream", header, &uploaded); err != nil {
+		return nil, err
+	}
+	return &uploaded, nil
+}
+
+// FinishUpload 完成上传，返回创建的文件
+// 仍缺少分片时返回错误码为 api.CodeMissingChunks 的 *Error，可解析为 api.MissingChunksError
+func (c *Client) FinishUpload(ctx context.Context, uploadID string) (*api.FileInfo, error) {
+	var resp api.FinishUploadResponse
+	req := &api.FinishUploadRequest{UploadID: uploadID}
+	if err := c.doJSON(ctx, http.MethodPost, "/api/v1/upload/finish", nil, req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp.File, nil
+}
+
+// DownloadFile 下载文件内容，调用方负责关闭返回的 ReadCloser
+func (c *Client) DownloadFile(ctx context.Context, fileID uint) (io.ReadCloser, error) {
+	return c.doStream(ctx, http.MethodGet, fmt.Sprintf("/api/v1/files/%d/content", fileID), nil, nil, "", nil)
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// serverConfig sealock-server 的运行配置
+type serverConfig struct {
+	Addr              string
+	Mode              string
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration // 0 表示不限制，大文件上传需要长时间读取请求体
+	WriteTimeout      time.Duration // 0 表示不限制，下载和事件流需要长时间写响应
+	IdleTimeout       time.Duration
+	ShutdownTimeout   time.Duration // 收到退出信号后等待进行中请求（包括上传）完成的时间
+
+	DatabaseDSN string
+	StorageType string
+	CacheExpiry time.Duration
+
+	RedisAddr     string
+	RedisPassword string
+	RedisDB       int
+
+	ChunkSize           int
+	UploadQuota         int64 // 每个用户的存储配额（字节），0 表示不限制
+	UploadSweepInterval time.Duration
+	PruneInterval       time.Duration
+	ReplicationInterval time.Duration
+	EventHistory        int
+	MaxImportSize       int64 // 导入归档的大小上限（字节）
+	MaxExpandedSize     int64 // 导入时归档展开后的总大小上限（字节）
+	MaxImportEntries    int   // 导入归档的条目数上限
+
+	ReplicationPrimaries []string // 副本允许连接的主服务器（host 或 host:port），为空时不能配置副本
+	ReplicationOperators []uint   // 可以管理库复制的用户，为空时库的所有者都可以
+	ReplicationTokenKey  string   // 加密保存主服务器令牌的密钥，为空时使用 JWTSecret
+
+	S3SecretKey string // 加密保存 S3 secret key 的密钥，为空时使用 JWTSecret
+
+	JWTSecret string // 用户令牌的签名密钥，必须配置
+}
+
+// loadConfig 通过 viper 读取配置
+// 配置文件 config.yaml 按 -config 指定的路径或默认目录查找，找不到时只使用默认值和环境变量；
+// 环境变量以 SEALOCK_ 为前缀，层级用下划线分隔，如 SEALOCK_DATABASE_PASSWORD
+func loadConfig(path string) (*serverConfig, error) {
+	v := viper.New()
+	v.SetDefault("server.port", 8080)
+	v.SetDefault("server.mode", "release")
+	v.SetDefault("server.read_header_timeout", 10)
+	v.SetDefault("server.read_timeout", 0)
+	v.SetDefault("server.write_timeout", 0)
+	v.SetDefault("server.idle_timeout", 120)
+	v.SetDefault("server.shutdown_timeout", 30)
+	v.SetDefault("database.host", "localhost")
+	v.SetDefault("database.port", 5432)
+	v.SetDefault("database.ssl_mode", "disable")
+	v.SetDefault("redis.host", "localhost")
+	v.SetDefault("redis.port", 6379)
+	v.SetDefault("storage.type", "local")
+	v.SetDefault("storage.cache_expiry", "24h")
+	v.SetDefault("storage.chunk_size", 4*1024*1024)
+	v.SetDefault("upload.quota", 0)
+	v.SetDefault("upload.sweep_interval", "10m")
+	v.SetDefault("snapshot.prune_interval", "1h")
+	v.SetDefault("replication.interval", "30s")
+	v.SetDefault("events.history", 0)
+	v.SetDefault("archive.max_import_size", 4<<30)
+	v.SetDefault("archive.max_expanded_size", 16<<30)
+	v.SetDefault("archive.max_import_entries", 100000)
+
+	v.SetEnvPrefix("sealock")
+	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	v.AutomaticEnv()
+
+	if path != "" {
+		v.SetConfigFile(path)
+	} else {
+		v.SetConfigName("config")
+		v.SetConfigType("yaml")
+		v.AddConfigPath(".")
+		v.AddConfigPath("config")
+	}
+	if err := v.ReadInConfig(); err != nil {
+		if _, ok := err.(viper.ConfigFileNotFoundError); !ok || path != "" {
+			return nil, fmt.Errorf("failed to read config: %w", err)
+		}
+		log.Println("Info: config.yaml file not found, relying on defaults and environment variables")
+	} else {
+		log.Printf("Info: Using config file: %s", v.ConfigFileUsed())
+	}
+
+	cfg := &serverConfig{
+		Addr:              fmt.Sprintf(":%d", v.GetInt("server.port")),
+		Mode:              v.GetString("server.mode"),
+		ReadHeaderTimeout: seconds(v, "server.read_header_timeout"),
+		ReadTimeout:       seconds(v, "server.read_timeout"),
+		WriteTimeout:      seconds(v, "server.write_timeout"),
+		IdleTimeout:       seconds(v, "server.idle_timeout"),
+		ShutdownTimeout:   seconds(v, "server.shutdown_timeout"),
+
+		DatabaseDSN: fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%d sslmode=%s",
+			v.GetString("database.host"), v.GetString("database.user"), v.GetString("database.password"),
+			v.GetString("database.name"), v.GetInt("database.port"), v.GetString("database.ssl_mode")),
+		StorageType: v.GetString("storage.type"),
+		CacheExpiry: v.GetDuration("storage.cache_expiry"),
+
+		RedisAddr:     fmt.Sprintf("%s:%d", v.GetString("redis.host"), v.GetInt("redis.port")),
+		RedisPassword: v.GetString("redis.password"),
+		RedisDB:       v.GetInt("redis.db"),
+
+		ChunkSize:           v.GetInt("storage.chunk_size"),
+		UploadQuota:         v.GetInt64("upload.quota"),
+		UploadSweepInterval: v.GetDuration("upload.sweep_interval"),
+		PruneInterval:       v.GetDuration("snapshot.prune_interval"),
+		ReplicationInterval: v.GetDuration("replication.interval"),
+		EventHistory:        v.GetInt("events.history"),
+		MaxImportSize:       v.GetInt64("archive.max_import_size"),
+		MaxExpandedSize:     v.GetInt64("archive.max_expanded_size"),
+		MaxImportEntries:    v.GetInt("archive.max_import_entries"),
+
+		ReplicationPrimaries: v.GetStringSlice("replication.allowed_primaries"),
+		ReplicationTokenKey:  v.GetString("replication.token_key"),
+
+		S3SecretKey: v.GetString("s3.secret_key"),
+
+		JWTSecret: v.GetString("auth.jwt_secret"),
+	}
+	if cfg.ChunkSize <= 0 {
+		return nil, fmt.Errorf("invalid storage.chunk_size: %d", cfg.ChunkSize)
+	}
+	if cfg.MaxImportSize <= 0 {
+		return nil, fmt.Errorf("invalid archive.max_import_size: %d", cfg.MaxImportSize)
+	}
+	if cfg.MaxExpandedSize <= 0 {
+		return nil, fmt.Errorf("invalid archive.max_expanded_size: %d", cfg.MaxExpandedSize)
+	}
+	if cfg.MaxImportEntries <= 0 {
+		return nil, fmt.Errorf("invalid archive.max_import_entries: %d", cfg.MaxImportEntries)
+	}
+	if cfg.PruneInterval <= 0 {
+		return nil, fmt.Errorf("invalid snapshot.prune_interval: %s", cfg.PruneInterval)
+	}
+	if cfg.JWTSecret == "" {
+		return nil, fmt.Errorf("auth.jwt_secret is not set (use SEALOCK_AUTH_JWT_SECRET)")
+	}
+	for _, id := range v.GetIntSlice("replication.operators") {
+		if id <= 0 {
+			return nil, fmt.Errorf("invalid replication.operators entry: %d", id)
+		}
+		cfg.ReplicationOperators = append(cfg.ReplicationOperators, uint(id))
+	}
+	if cfg.ReplicationTokenKey == "" {
+		cfg.ReplicationTokenKey = cfg.JWTSecret
+	}
+	if cfg.S3SecretKey == "" {
+		cfg.S3SecretKey = cfg.JWTSecret
+	}
+	return cfg, nil
+}
+
+// seconds 读取以秒为单位的整数配置项
+func seconds(v *viper.Viper, key string) time.Duration {
+	return time.Duration(v.GetInt(key)) * time.Second
+}
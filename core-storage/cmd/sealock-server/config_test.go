@@ -0,0 +1,123 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeConfig 把 content 写入临时目录中的 config.yaml 并返回路径
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	return path
+}
+
+func TestLoadConfig(t *testing.T) {
+	t.Setenv("SEALOCK_AUTH_JWT_SECRET", "")
+	path := writeConfig(t, `
+server:
+  port: 9090
+database:
+  user: sealock
+  name: files
+auth:
+  jwt_secret: secret
+replication:
+  operators: [1, 2]
+`)
+
+	cfg, err := loadConfig(path)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if cfg.Addr != ":9090" || cfg.JWTSecret != "secret" {
+		t.Fatalf("addr %q, jwt secret %q", cfg.Addr, cfg.JWTSecret)
+	}
+	if !strings.Contains(cfg.DatabaseDSN, "user=sealock") || !strings.Contains(cfg.DatabaseDSN, "dbname=files") {
+		t.Fatalf("database DSN = %q", cfg.DatabaseDSN)
+	}
+	// 未配置的项使用默认值，未单独配置的加密密钥使用 JWT 密钥
+	if cfg.ChunkSize != 4*1024*1024 || cfg.MaxImportSize != 4<<30 || cfg.MaxExpandedSize != 16<<30 || cfg.MaxImportEntries != 100000 || cfg.PruneInterval != time.Hour || cfg.ShutdownTimeout != 30*time.Second {
+		t.Fatalf("defaults: %+v", cfg)
+	}
+	if cfg.ReplicationTokenKey != "secret" || cfg.S3SecretKey != "secret" {
+		t.Fatalf("derived keys: replication %q, s3 %q", cfg.ReplicationTokenKey, cfg.S3SecretKey)
+	}
+	if len(cfg.ReplicationOperators) != 2 || cfg.ReplicationOperators[1] != 2 {
+		t.Fatalf("replication operators = %v", cfg.ReplicationOperators)
+	}
+
+	// 环境变量覆盖配置文件
+	t.Setenv("SEALOCK_SERVER_PORT", "7070")
+	t.Setenv("SEALOCK_S3_SECRET_KEY", "s3-key")
+	cfg, err = loadConfig(path)
+	if err != nil {
+		t.Fatalf("load with environment: %v", err)
+	}
+	if cfg.Addr != ":7070" || cfg.S3SecretKey != "s3-key" {
+		t.Fatalf("environment overrides: addr %q, s3 key %q", cfg.Addr, cfg.S3SecretKey)
+	}
+}
+
+func TestLoadConfigRequiresJWTSecret(t *testing.T) {
+	t.Setenv("SEALOCK_AUTH_JWT_SECRET", "")
+	path := writeConfig(t, "server:\n  port: 8080\n")
+
+	// 没有 JWT 密钥时拒绝启动
+	if _, err := loadConfig(path); err == nil || !strings.Contains(err.Error(), "auth.jwt_secret") {
+		t.Fatalf("err = %v, want auth.jwt_secret is not set", err)
+	}
+
+	// 可以只通过环境变量提供
+	t.Setenv("SEALOCK_AUTH_JWT_SECRET", "from-env")
+	cfg, err := loadConfig(path)
+	if err != nil {
+		t.Fatalf("load with SEALOCK_AUTH_JWT_SECRET: %v", err)
+	}
+	if cfg.JWTSecret != "from-env" {
+		t.Fatalf("jwt secret = %q", cfg.JWTSecret)
+	}
+}
+
+func TestLoadConfigValidation(t *testing.T) {
+	t.Setenv("SEALOCK_AUTH_JWT_SECRET", "secret")
+
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"chunk size", "storage:\n  chunk_size: 0\n", "storage.chunk_size"},
+		{"import size", "archive:\n  max_import_size: -1\n", "archive.max_import_size"},
+		{"expanded size", "archive:\n  max_expanded_size: 0\n", "archive.max_expanded_size"},
+		{"import entries", "archive:\n  max_import_entries: -5\n", "archive.max_import_entries"},
+		{"prune interval", "snapshot:\n  prune_interval: 0s\n", "snapshot.prune_interval"},
+		{"replication operator", "replication:\n  operators: [0]\n", "replication.operators"},
+		{"malformed file", "server: [", "failed to read config"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := loadConfig(writeConfig(t, tt.content)); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("err = %v, want %s", err, tt.want)
+			}
+		})
+	}
+
+	// 显式指定的配置文件不存在时报错，而不是静默使用默认值
+	if _, err := loadConfig(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Fatal("missing config file accepted")
+	}
+}
+
+func TestLoadSampleConfig(t *testing.T) {
+	t.Setenv("SEALOCK_AUTH_JWT_SECRET", "secret")
+	if _, err := loadConfig(filepath.Join("..", "..", "config", "config.yaml")); err != nil {
+		t.Fatalf("sample config: %v", err)
+	}
+}
@@ -0,0 +1,285 @@
+// Package main 是 Sealock Doc 的存储服务端 sealock-server
+// 读取配置后初始化存储栈和各个服务，对外提供库管理、上传、tus、文件下载、打包下载、增量同步、历史版本与回滚、快照浏览、快照包、
+// 库复制、变更事件和归档导入的 HTTP API（接口文档见 GET /api/v1/openapi.yaml），以及挂载库的 WebDAV 服务和 S3 兼容网关，并在后台运行副本跟随、快照清理和过期上传清理任务。
+// 收到 SIGINT/SIGTERM 后停止接受新连接，等待进行中的请求（包括上传）完成，
+// 然后执行尚未完成的自动提交并关闭存储
+//
+// 用法:
+//
+//	sealock-server
+//	sealock-server -config /etc/sealock/config.yaml
+//	SEALOCK_SERVER_PORT=9000 SEALOCK_DATABASE_PASSWORD=secret SEALOCK_AUTH_JWT_SECRET=secret sealock-server
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/sealock/core-storage/chunker"
+	"github.com/sealock/core-storage/handler"
+	"github.com/sealock/core-storage/middleware"
+	"github.com/sealock/core-storage/model"
+	"github.com/sealock/core-storage/service"
+	"github.com/sealock/core-storage/storage"
+)
+
+func main() {
+	configPath := flag.String("config", "", "配置文件路径（默认在当前目录和 config/ 下查找 config.yaml）")
+	flag.Parse()
+
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		log.Fatalf("sealock-server: %v", err)
+	}
+	if err := run(cfg); err != nil {
+		log.Fatalf("sealock-server: %v", err)
+	}
+}
+
+// run 启动服务并阻塞到收到退出信号且关闭完成
+func run(cfg *serverConfig) error {
+	middleware.JWTSecret = []byte(cfg.JWTSecret)
+
+	stack, err := storage.InitializeStorage(storage.StorageConfig{
+		DatabaseDSN: cfg.DatabaseDSN,
+		StorageType: cfg.StorageType,
+		RedisAddr:   cfg.RedisAddr,
+		CacheExpiry: cfg.CacheExpiry,
+	})
+	if err != nil {
+		return err
+	}
+	defer stack.Close()
+
+	// 上传会话、tus 上传和配额预留保存在 Redis 中
+	redisClient := redis.NewClient(&redis.Options{
+		Addr:     cfg.RedisAddr,
+		Password: cfg.RedisPassword,
+		DB:       cfg.RedisDB,
+	})
+	defer redisClient.Close()
+	if err := redisClient.Ping(context.Background()).Err(); err != nil {
+		return fmt.Errorf("failed to connect Redis: %w", err)
+	}
+
+	events := service.NewEventBus(cfg.EventHistory)
+
+	fileService := service.NewFileService(
+		stack.BlockStore,
+		stack.FileRepository,
+		stack.BlockRepository,
+		chunker.NewFixedSizeChunker(cfg.ChunkSize),
+		stack.SnapshotRepository,
+		redisClient,
+		true,
+	)
+	fileService.SetEventBus(events)
+	fileService.SetTransactor(stack.Transactor)
+	if cfg.UploadQuota > 0 {
+		fileService.SetQuotaProvider(service.NewLibraryQuota(stack.LibraryRepository, stack.FileRepository, cfg.UploadQuota))
+	}
+
+	// 同步服务与文件服务共用自动提交调度器，同一库的变更合并为一次提交
+	syncService := service.NewSyncService(stack.FileRepository, stack.BlockStore, stack.BlockRepository, stack.ConflictRepo, fileService.CommitScheduler())
+	syncService.SetEventBus(events)
+	syncService.SetLibraryLocks(fileService.LibraryLocks())
+	syncService.SetTransactor(stack.Transactor)
+
+	replicationService := service.NewReplicationService(stack.SnapshotRepository, stack.BlockRepository, stack.BlockStore, stack.ReplicationRepo, syncService)
+	replicationService.SetAllowedPrimaries(cfg.ReplicationPrimaries)
+	replicationService.SetOperators(cfg.ReplicationOperators)
+	replicationService.SetTokenKey([]byte(cfg.ReplicationTokenKey))
+	// 只读副本由服务层的写入路径拒绝，覆盖 REST、WebDAV、S3 和 tus 等所有入口
+	fileService.SetReplication(replicationService)
+	syncService.SetReplication(replicationService)
+	gc := service.NewGarbageCollector(stack.BlockStore, stack.BlockRepository)
+	gc.SetTransactor(stack.Transactor)
+	retentionService := service.NewRetentionService(stack.SnapshotRepository, stack.RetentionRepo, stack.BlockRepository, gc)
+	retentionService.SetTransactor(stack.Transactor)
+	libraryService := service.NewLibraryService(stack.LibraryRepository, stack.LibraryVersionRepo, stack.FileRepository, stack.SnapshotRepository, stack.BlockRepository, gc)
+	libraryService.SetTransactor(stack.Transactor)
+	libraryService.SetLibraryLocks(fileService.LibraryLocks())
+	libraryService.SetCommitScheduler(fileService.CommitScheduler())
+	// 每次自动提交或由其他途径创建快照后记录库版本并刷新库的统计信息
+	fileService.CommitScheduler().OnCommit = func(commit *model.Commit) {
+		if err := libraryService.RecordCommit(context.Background(), commit); err != nil {
+			log.Printf("library %d: failed to record commit %s: %v", commit.RepoID, commit.CommitHash, err)
+		}
+	}
+	fileService.CommitScheduler().OnSnapshot = func(libraryID uint) {
+		if _, err := libraryService.RefreshStats(context.Background(), libraryID); err != nil {
+			log.Printf("library %d: failed to refresh stats: %v", libraryID, err)
+		}
+	}
+	// 清理快照后删除对应的版本并刷新库的统计信息
+	retentionService.OnPrune = func(libraryID uint, removed []string) {
+		if err := libraryService.RemoveVersions(context.Background(), libraryID, removed); err != nil {
+			log.Printf("library %d: failed to remove pruned versions: %v", libraryID, err)
+		}
+	}
+	historyService := service.NewHistoryService(fileService, syncService)
+	webdavFS := service.NewWebDAVFileSystem(fileService, stack.LibraryRepository, replicationService)
+	s3Gateway := service.NewS3Gateway(fileService, stack.LibraryRepository, replicationService)
+	s3Keys := service.NewS3KeyService(stack.S3KeyRepo)
+	s3Keys.SetSecretKey([]byte(cfg.S3SecretKey))
+	archiveService := service.NewArchiveService(fileService, stack.SnapshotRepository)
+	archiveService.SetMaxImportSize(cfg.MaxImportSize)
+	archiveService.SetMaxExpandedSize(cfg.MaxExpandedSize)
+	archiveService.SetMaxImportEntries(cfg.MaxImportEntries)
+	snapshotBrowser := service.NewSnapshotBrowser(stack.SnapshotRepository, stack.BlockStore)
+	bundleService := service.NewBundleService(stack.SnapshotRepository, stack.BlockRepository, stack.BlockStore, syncService)
+	access := service.NewLibraryAccess(stack.LibraryRepository)
+
+	gin.SetMode(cfg.Mode)
+	shutdown := make(chan struct{})
+	router := newRouter(shutdown, access, fileService, libraryService, syncService, replicationService, historyService, retentionService, archiveService, snapshotBrowser, bundleService, webdavFS, s3Gateway, s3Keys, events)
+
+	server := &http.Server{
+		Addr:              cfg.Addr,
+		Handler:           router,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		ReadTimeout:       cfg.ReadTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// 后台任务使用独立的上下文，在进行中的请求处理完之后才停止
+	jobCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+	var jobs sync.WaitGroup
+	startJob := func(job func(context.Context)) {
+		jobs.Add(1)
+		go func() {
+			defer jobs.Done()
+			job(jobCtx)
+		}()
+	}
+	startJob(func(ctx context.Context) { replicationService.RunFollower(ctx, cfg.ReplicationInterval) })
+	startJob(func(ctx context.Context) { retentionService.RunPruneJob(ctx, cfg.PruneInterval) })
+	startJob(func(ctx context.Context) { fileService.RunUploadSweeper(ctx, cfg.UploadSweepInterval) })
+
+	serveErr := make(chan error, 1)
+	go func() {
+		log.Printf("sealock-server: listening on %s (storage %s)", cfg.Addr, cfg.StorageType)
+		serveErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serveErr:
+		stopJobs()
+		jobs.Wait()
+		return fmt.Errorf("failed to serve: %w", err)
+	case <-ctx.Done():
+	}
+	stop()
+
+	log.Printf("sealock-server: shutting down, waiting up to %s for in-flight requests", cfg.ShutdownTimeout)
+	close(shutdown)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		// 超时后强制断开剩余连接；没有校验和的 tus PATCH 会保存已收到的部分，客户端可续传
+		log.Printf("sealock-server: in-flight requests did not finish: %v", err)
+		server.Close()
+	}
+	if err := <-serveErr; err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Printf("sealock-server: %v", err)
+	}
+
+	stopJobs()
+	jobs.Wait()
+
+	// 执行尚未完成的自动提交
+	flushCtx, cancelFlush := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancelFlush()
+	if err := fileService.Close(flushCtx); err != nil {
+		log.Printf("sealock-server: failed to flush pending commits: %v", err)
+	}
+	log.Println("sealock-server: stopped")
+	return nil
+}
+
+// newRouter 创建挂载全部 API 的路由，shutdown 关闭时结束事件流
+func newRouter(
+	shutdown <-chan struct{},
+	access *service.LibraryAccess,
+	fileService *service.FileService,
+	libraryService *service.LibraryService,
+	syncService *service.SyncService,
+	replicationService *service.ReplicationService,
+	historyService *service.HistoryService,
+	retentionService *service.RetentionService,
+	archiveService *service.ArchiveService,
+	snapshotBrowser *service.SnapshotBrowser,
+	bundleService *service.BundleService,
+	webdavFS *service.WebDAVFileSystem,
+	s3Gateway *service.S3Gateway,
+	s3Keys *service.S3KeyService,
+	events *service.EventBus,
+) *gin.Engine {
+	router := gin.New()
+	router.Use(gin.Logger(), gin.Recovery(), closeStreamsOnShutdown(shutdown))
+	router.GET("/healthz", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"status": "ok"})
+	})
+
+	handler.RegisterOpenAPIRoutes(router)
+
+	// WebDAV 网关自带令牌认证，S3 网关自带签名认证
+	handler.RegisterWebDAVRoutes(router, webdavFS)
+	handler.RegisterS3Routes(router, s3Gateway, s3Keys)
+
+	// 之后注册的 REST 路由都要求用户令牌，路径中的库只允许其所有者访问
+	router.Use(middleware.TokenAuth("Sealock"), middleware.LibraryAccess(access))
+
+	handler.RegisterReplicationRoutes(router, replicationService, access)
+	handler.RegisterEventRoutes(router, events, access)
+	handler.RegisterUploadRoutes(router, fileService, access)
+	handler.RegisterFileRoutes(router, fileService, access)
+	handler.RegisterLibraryRoutes(router, libraryService)
+	handler.RegisterSyncRoutes(router, syncService, access)
+	handler.RegisterHistoryRoutes(router, historyService, access)
+	handler.RegisterRetentionRoutes(router, retentionService)
+	handler.RegisterArchiveRoutes(router, archiveService)
+	handler.RegisterS3KeyRoutes(router, s3Keys)
+	handler.RegisterSnapshotRoutes(router, snapshotBrowser, access)
+	handler.RegisterBundleRoutes(router, bundleService, access)
+	return router
+}
+
+// closeStreamsOnShutdown 在关闭时结束事件流等长连接
+// http.Server.Shutdown 会等待所有请求结束，而 SSE 连接只在客户端断开时结束；
+// 这里在 shutdown 关闭时取消流式请求的上下文，普通请求和上传不受影响，继续处理完成
+func closeStreamsOnShutdown(shutdown <-chan struct{}) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !strings.HasSuffix(c.FullPath(), "/stream") {
+			c.Next()
+			return
+		}
+		ctx, cancel := context.WithCancel(c.Request.Context())
+		defer cancel()
+		go func() {
+			select {
+			case <-shutdown:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sealock/core-storage/api"
+	"gopkg.in/yaml.v3"
+)
+
+// specRoutes 返回 OpenAPI 文档中的全部接口，格式为 "METHOD /path"
+func specRoutes(t *testing.T) map[string]bool {
+	t.Helper()
+	var doc struct {
+		Paths map[string]map[string]yaml.Node `yaml:"paths"`
+	}
+	if err := yaml.Unmarshal(api.OpenAPIYAML(), &doc); err != nil {
+		t.Fatalf("parse openapi.yaml: %v", err)
+	}
+	routes := make(map[string]bool)
+	for path, operations := range doc.Paths {
+		for method := range operations {
+			if method == "parameters" {
+				continue
+			}
+			routes[strings.ToUpper(method)+" "+path] = true
+		}
+	}
+	return routes
+}
+
+// openAPIPath 把 gin 的路径参数（:id、*path）转换为 OpenAPI 的 {id}、{path}
+func openAPIPath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "*") {
+			segments[i] = "{" + segment[1:] + "}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+func TestRoutesMatchOpenAPI(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	// 只注册路由、不处理请求，处理器用到的服务可以为空
+	router := newRouter(make(chan struct{}), nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil)
+
+	// WebDAV 和 S3 网关遵循各自的协议，不在文档中描述
+	routes := make(map[string]bool)
+	for _, route := range router.Routes() {
+		if route.Path == "/dav" || strings.HasPrefix(route.Path, "/dav/") ||
+			route.Path == "/s3" || strings.HasPrefix(route.Path, "/s3/") {
+			continue
+		}
+		routes[route.Method+" "+openAPIPath(route.Path)] = true
+	}
+	if len(routes) == 0 {
+		t.Fatal("no routes registered")
+	}
+	spec := specRoutes(t)
+
+	var undocumented, unrouted []string
+	for route := range routes {
+		if !spec[route] {
+			undocumented = append(undocumented, route)
+		}
+	}
+	for route := range spec {
+		if !routes[route] {
+			unrouted = append(unrouted, route)
+		}
+	}
+	sort.Strings(undocumented)
+	sort.Strings(unrouted)
+	if len(undocumented) > 0 {
+		t.Errorf("routes missing from openapi.yaml:\n%s", strings.Join(undocumented, "\n"))
+	}
+	if len(unrouted) > 0 {
+		t.Errorf("documented operations without a route:\n%s", strings.Join(unrouted, "\n"))
+	}
+	if !routes[http.MethodGet+" /api/v1/libraries/{libraryId}"] {
+		t.Fatal("path parameters were not converted")
+	}
+}
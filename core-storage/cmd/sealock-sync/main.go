@@ -0,0 +1,90 @@
+// Package main 是 Sealock Doc 的桌面同步客户端 sealock-sync
+// 监听本地目录，把变化的文件分块后只上传服务端缺少的块，同时拉取远端变更；
+// 上次同步的目录树哈希保存在本地状态文件中，重启后无需全量重新扫描
+//
+// 用法:
+//
+//	sealock-sync -server http://localhost:8080 -library 1 -dir ~/Sealock
+//	sealock-sync -server http://localhost:8080 -library 1 -dir ~/Sealock -once
+//	sealock-sync -library 1 -dir ~/Sealock -only docs -only photos/2024 -ignore '*.mov'
+//
+// 忽略规则来自三处，按顺序合并（后者可用 ! 覆盖前者）：
+// 库根目录下随库同步的 .sealockignore、本地 .sealock/ignore 文件、-ignore 参数
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/sealock/core-storage/client"
+	"github.com/sealock/core-storage/syncclient"
+)
+
+// listFlag 可重复指定的字符串参数
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+func main() {
+	server := flag.String("server", "http://localhost:8080", "服务端地址")
+	token := flag.String("token", os.Getenv("SEALOCK_TOKEN"), "访问令牌（默认读取环境变量 SEALOCK_TOKEN）")
+	libraryID := flag.Uint("library", 0, "要同步的库ID")
+	dir := flag.String("dir", ".", "本地同步目录")
+	statePath := flag.String("state", "", "本地状态文件路径（默认 <dir>/.sealock/state.json）")
+	clientID := flag.String("client-id", "", "客户端标识，用于命名冲突副本（默认主机名）")
+	blockSize := flag.Int("block-size", syncclient.DefaultBlockSize, "分块大小（字节）")
+	debounce := flag.Duration("debounce", syncclient.DefaultDebounce, "本地变更后的防抖时间")
+	interval := flag.Duration("interval", syncclient.DefaultPollInterval, "拉取远端变更的轮询间隔")
+	once := flag.Bool("once", false, "只同步一次然后退出")
+	var ignoreRules, include listFlag
+	flag.Var(&ignoreRules, "ignore", "本客户端额外的忽略规则（gitignore 语法），可重复指定")
+	flag.Var(&include, "only", "只同步库中的该子树，可重复指定")
+	flag.Parse()
+
+	if *libraryID == 0 {
+		log.Fatal("sealock-sync: -library is required")
+	}
+
+	syncer, err := syncclient.NewSyncer(client.New(*server, *token), syncclient.Options{
+		Root:      *dir,
+		LibraryID: uint(*libraryID),
+		StatePath: *statePath,
+		BlockSize: *blockSize,
+		ClientID:  *clientID,
+		Ignore:    ignoreRules,
+		Include:   include,
+	})
+	if err != nil {
+		log.Fatalf("sealock-sync: %v", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if *once {
+		result, err := syncer.SyncOnce(ctx)
+		if err != nil {
+			log.Fatalf("sealock-sync: %v", err)
+		}
+		log.Printf("sealock-sync: up %d, remote deletes %d, down %d, local deletes %d, conflicts %d, blocks sent %d, root %s",
+			result.Uploaded, result.DeletedRemote, result.Downloaded, result.DeletedLocal, result.Conflicts, result.BlocksSent, result.Root)
+		return
+	}
+
+	log.Printf("sealock-sync: syncing %s with library %d on %s", syncer.Root(), *libraryID, *server)
+	if err := syncclient.Watch(ctx, syncer, *debounce, *interval); err != nil {
+		log.Fatalf("sealock-sync: %v", err)
+	}
+}
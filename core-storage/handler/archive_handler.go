@@ -0,0 +1,145 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sealock/core-storage/api"
+	"github.com/sealock/core-storage/model"
+	"github.com/sealock/core-storage/service"
+)
+
+// ArchiveHandler 处理库的归档请求：打包下载文件和目录，导入 tar、tar.gz 或 zip 归档
+type ArchiveHandler struct {
+	archives *service.ArchiveService
+}
+
+// NewArchiveHandler 创建新的ArchiveHandler实例
+func NewArchiveHandler(archives *service.ArchiveService) *ArchiveHandler {
+	return &ArchiveHandler{archives: archives}
+}
+
+// ZipHandler 把库中选中的文件和目录打包为 zip 下载
+// GET /libraries/{libraryId}/zip?path=docs&path=notes/a.txt&snapshot={id}
+// path 可重复，每一项为文件或目录，缺省时打包整个库；snapshot 为快照ID或UUID，缺省时打包当前版本。
+// 归档从块存储流式生成，不落盘；图片、视频、压缩包等已压缩的类型不再压缩，大归档自动使用 Zip64
+func (h *ArchiveHandler) ZipHandler(c *gin.Context) {
+	libraryID, ok := libraryIDParam(c)
+	if !ok {
+		return
+	}
+
+	var snapshot *model.Snapshot
+	if ref := c.Query("snapshot"); ref != "" {
+		var err error
+		if snapshot, err = h.archives.ResolveSnapshot(c.Request.Context(), ref); err != nil {
+			writeError(c, http.StatusNotFound, "快照不存在")
+			return
+		}
+	}
+	paths := c.QueryArray("path")
+
+	archive, err := h.archives.SelectZip(c.Request.Context(), libraryID, snapshot, paths)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrSnapshotNotInLibrary):
+			writeError(c, http.StatusBadRequest, "快照不属于该库")
+		case errors.Is(err, service.ErrPathNotFound):
+			writeError(c, http.StatusNotFound, "路径不存在")
+		default:
+			writeError(c, http.StatusInternalServerError, "读取文件列表失败")
+		}
+		return
+	}
+
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": zipName(libraryID, snapshot, paths)}))
+	c.Status(http.StatusOK)
+	if err := archive.Stream(c.Request.Context(), c.Writer); err != nil {
+		// 响应头已发送，只能中断传输并记录错误
+		_ = c.Error(err)
+		c.Abort()
+	}
+}
+
+// ImportHandler 把请求体中的归档展开到库中的目录
+// POST /libraries/{libraryId}/import?path=docs/imported&format=zip
+// 请求体为归档文件本身；path 为目标目录，缺省时导入到库的根目录；
+// format 为 tar、tar.gz 或 zip，缺省时按内容识别。
+// 同名文件被覆盖，整个导入记录为一个提交；任一条目失败时库保持不变。
+// 请求体超过配置的导入大小上限时返回 413
+func (h *ArchiveHandler) ImportHandler(c *gin.Context) {
+	libraryID, ok := libraryIDParam(c)
+	if !ok {
+		return
+	}
+	format := strings.ToLower(c.Query("format"))
+	switch format {
+	case "", service.ArchiveTar, service.ArchiveTarGz, service.ArchiveZip:
+	case "tgz":
+		format = service.ArchiveTarGz
+	default:
+		writeError(c, http.StatusBadRequest, "不支持的归档格式")
+		return
+	}
+
+	var author string
+	if userID := c.GetUint("user_id"); userID != 0 {
+		author = strconv.FormatUint(uint64(userID), 10)
+	}
+	body := http.MaxBytesReader(c.Writer, c.Request.Body, h.archives.MaxImportSize())
+	result, err := h.archives.Import(c.Request.Context(), libraryID, c.GetUint("user_id"), c.Query("path"), body, format, author)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		switch {
+		case errors.Is(err, service.ErrImportTooLarge), errors.As(err, &tooLarge):
+			writeError(c, http.StatusRequestEntityTooLarge, "归档超过导入大小上限")
+		case errors.Is(err, service.ErrUnsupportedArchive):
+			writeError(c, http.StatusBadRequest, "不支持的归档格式")
+		case errors.Is(err, service.ErrInvalidArchive), errors.Is(err, service.ErrUploadSizeMismatch):
+			writeError(c, http.StatusBadRequest, "归档内容损坏")
+		case errors.Is(err, service.ErrImportConflict):
+			writeError(c, http.StatusConflict, "文件与目录同名: "+err.Error())
+		case errors.Is(err, service.ErrQuotaExceeded):
+			c.JSON(http.StatusRequestEntityTooLarge, api.Error{Code: api.CodeQuotaExceeded, Message: "存储空间不足"})
+		case errors.Is(err, service.ErrReadOnlyReplica):
+			writeReadOnly(c)
+		default:
+			writeError(c, http.StatusInternalServerError, "导入失败")
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// zipName 归档的下载文件名：选中单个文件或目录时以其命名，否则以库命名
+func zipName(libraryID uint, snapshot *model.Snapshot, paths []string) string {
+	name := fmt.Sprintf("library-%d", libraryID)
+	if len(paths) == 1 {
+		if base := path.Base("/" + strings.Trim(paths[0], "/")); base != "/" {
+			name = base
+		}
+	}
+	if snapshot != nil {
+		name = fmt.Sprintf("%s-snapshot-%d", name, snapshot.ID)
+	}
+	return name + ".zip"
+}
+
+// RegisterArchiveRoutes 设置归档相关的路由
+func RegisterArchiveRoutes(r *gin.Engine, archives *service.ArchiveService) {
+	handler := NewArchiveHandler(archives)
+
+	libraryGroup := r.Group("/api/v1/libraries")
+	{
+		libraryGroup.GET("/:libraryId/zip", handler.ZipHandler)        // 打包下载文件和目录
+		libraryGroup.POST("/:libraryId/import", handler.ImportHandler) // 导入归档
+	}
+}
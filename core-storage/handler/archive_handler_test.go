@@ -0,0 +1,99 @@
+package handler
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sealock/core-storage/chunker"
+	"github.com/sealock/core-storage/service"
+	"github.com/sealock/core-storage/storage"
+)
+
+// testTar 返回包含给定文件的 tar 归档
+func testTar(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for name, content := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(content)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatalf("write tar header: %v", err)
+		}
+		tw.Write([]byte(content))
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("close tar: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// testZip 返回包含给定文件的 zip 归档
+func testZip(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range files {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store})
+		if err != nil {
+			t.Fatalf("create zip entry: %v", err)
+		}
+		w.Write([]byte(content))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("close zip: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestArchiveImportSizeLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+	fileRepo := storage.NewMockFileRepository()
+	files := service.NewFileService(storage.NewLocalBlockStore(), fileRepo, storage.NewMockBlockRepository(),
+		chunker.NewFixedSizeChunker(4), storage.NewMockSnapshotRepository(), newTestRedis(t), true)
+	t.Cleanup(func() { files.Close(ctx) })
+	archives := service.NewArchiveService(files, storage.NewMockSnapshotRepository())
+	archives.SetMaxImportSize(4096)
+
+	router := gin.New()
+	RegisterArchiveRoutes(router, archives)
+	importArchive := func(format string, body []byte) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/libraries/1/import?format="+format, bytes.NewReader(body)))
+		return w
+	}
+	large := strings.Repeat("x", 8192)
+
+	// 超过上限的归档（包括先写入临时文件的 zip）被拒绝，库中不创建任何文件
+	for format, body := range map[string][]byte{
+		"tar": testTar(t, map[string]string{"a.txt": "small", "b.txt": large}),
+		"zip": testZip(t, map[string]string{"a.txt": "small", "b.txt": large}),
+	} {
+		if w := importArchive(format, body); w.Code != http.StatusRequestEntityTooLarge {
+			t.Fatalf("%s over the limit: status %d: %s", format, w.Code, w.Body.String())
+		}
+	}
+	existing, err := fileRepo.ListFilesByLibrary(ctx, 1)
+	if err != nil {
+		t.Fatalf("list files: %v", err)
+	}
+	if len(existing) != 0 {
+		t.Fatalf("rejected imports created %d files", len(existing))
+	}
+
+	if w := importArchive("zip", testZip(t, map[string]string{"docs/a.txt": "hello", "docs/b.txt": "world"})); w.Code != http.StatusOK {
+		t.Fatalf("import: status %d: %s", w.Code, w.Body.String())
+	}
+	for _, name := range []string{"docs/a.txt", "docs/b.txt"} {
+		file, err := fileRepo.GetFileByPath(ctx, 1, name)
+		if err != nil || file == nil {
+			t.Fatalf("%s was not imported: %v", name, err)
+		}
+	}
+}
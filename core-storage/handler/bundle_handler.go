@@ -0,0 +1,130 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sealock/core-storage/api"
+	"github.com/sealock/core-storage/service"
+)
+
+// maxBundleSize 导入的快照包请求体上限
+const maxBundleSize = 8 << 30
+
+// BundleHandler 处理快照包的导出与导入
+// 用于在服务器之间迁移库或制作离线备份
+type BundleHandler struct {
+	bundles *service.BundleService
+	access  *service.LibraryAccess
+}
+
+// NewBundleHandler 创建新的BundleHandler实例
+func NewBundleHandler(bundles *service.BundleService, access *service.LibraryAccess) *BundleHandler {
+	return &BundleHandler{bundles: bundles, access: access}
+}
+
+// ExportHandler 导出一段提交为快照包（tar 流）
+// POST /bundles/export
+// 请求体:
+// {
+//   "libraryId": 1,
+//   "from": "...",          // 可选，起始快照ID或UUID，缺省为最早的快照
+//   "to": "...",            // 可选，结束快照ID或UUID，缺省为最新的快照
+//   "haveBlocks": ["..."]   // 可选，目标端已有的块，这些块不会随包携带
+// }
+func (h *BundleHandler) ExportHandler(c *gin.Context) {
+	var req api.BundleExportRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeError(c, http.StatusBadRequest, "无效的请求格式")
+		return
+	}
+	if !authorizeLibrary(c, h.access, req.LibraryID) {
+		return
+	}
+
+	snapshotIDs, err := h.bundles.SnapshotRange(c.Request.Context(), req.LibraryID, req.From, req.To)
+	if err != nil {
+		if errors.Is(err, service.ErrSnapshotNotFound) {
+			writeError(c, http.StatusNotFound, "快照不存在")
+			return
+		}
+		writeError(c, http.StatusInternalServerError, "查询快照失败")
+		return
+	}
+	if len(snapshotIDs) == 0 {
+		writeError(c, http.StatusNotFound, "没有可导出的快照")
+		return
+	}
+
+	have := make(map[string]bool, len(req.HaveBlocks))
+	for _, hash := range req.HaveBlocks {
+		have[hash] = true
+	}
+
+	c.Header("Content-Type", "application/x-tar")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="library-%d.bundle"`, req.LibraryID))
+	c.Status(http.StatusOK)
+	if _, err := h.bundles.Export(c.Request.Context(), c.Writer, snapshotIDs, service.ExportOptions{HaveBlocks: have}); err != nil {
+		// 响应头已发送，只能中断传输并记录错误
+		_ = c.Error(err)
+		c.Abort()
+	}
+}
+
+// ImportHandler 导入快照包，请求体为 tar 流
+// POST /bundles/import?libraryId=1
+func (h *BundleHandler) ImportHandler(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Query("libraryId"), 10, 64)
+	if err != nil || id == 0 {
+		writeError(c, http.StatusBadRequest, "无效的库ID")
+		return
+	}
+	libraryID := uint(id)
+	if !authorizeLibrary(c, h.access, libraryID) {
+		return
+	}
+
+	readable, ok := readableLibraries(c, h.access)
+	if !ok {
+		return
+	}
+
+	body := http.MaxBytesReader(c.Writer, c.Request.Body, maxBundleSize)
+	result, err := h.bundles.Import(c.Request.Context(), body, service.ImportOptions{LibraryID: libraryID, ReadableLibraries: readable})
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeError(c, http.StatusRequestEntityTooLarge, "快照包过大")
+			return
+		}
+		if errors.Is(err, service.ErrReadOnlyReplica) {
+			writeReadOnly(c)
+			return
+		}
+		writeError(c, http.StatusBadRequest, "导入快照包失败: "+err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, api.BundleImportResult{
+		LibraryID:         result.LibraryID,
+		SnapshotsImported: result.SnapshotsImported,
+		SnapshotsSkipped:  result.SnapshotsSkipped,
+		BlocksWritten:     result.BlocksWritten,
+		BlocksSkipped:     result.BlocksSkipped,
+		CheckedOut:        result.CheckedOut,
+	})
+}
+
+// RegisterBundleRoutes 设置快照包相关的路由
+func RegisterBundleRoutes(r *gin.Engine, bundles *service.BundleService, access *service.LibraryAccess) {
+	handler := NewBundleHandler(bundles, access)
+
+	bundleGroup := r.Group("/api/v1/bundles")
+	{
+		bundleGroup.POST("/export", handler.ExportHandler) // 导出快照包
+		bundleGroup.POST("/import", handler.ImportHandler) // 导入快照包
+	}
+}
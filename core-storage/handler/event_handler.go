@@ -0,0 +1,165 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sealock/core-storage/api"
+	"github.com/sealock/core-storage/service"
+)
+
+// eventHeartbeatInterval SSE 心跳间隔，防止代理断开空闲连接
+const eventHeartbeatInterval = 15 * time.Second
+
+// EventHandler 向客户端推送库的变更事件
+// 客户端按库订阅，断线后以最后收到的序号续传，收到 reset 事件时需要做一次全量同步
+type EventHandler struct {
+	events *service.EventBus
+	access *service.LibraryAccess
+}
+
+// NewEventHandler 创建新的EventHandler实例
+func NewEventHandler(events *service.EventBus, access *service.LibraryAccess) *EventHandler {
+	return &EventHandler{events: events, access: access}
+}
+
+// ListEventsHandler 返回游标之后的事件，供不支持长连接的客户端轮询
+// GET /events/libraries/{libraryId}?cursor=123
+// 不带 cursor 时只返回当前游标；游标过期时返回 410 和当前游标
+func (h *EventHandler) ListEventsHandler(c *gin.Context) {
+	libraryID, ok := libraryIDParam(c)
+	if !ok || !authorizeLibrary(c, h.access, libraryID) {
+		return
+	}
+	cursor, ok := eventCursor(c)
+	if !ok {
+		return
+	}
+
+	events, current, err := h.events.Since(libraryID, cursor)
+	if err != nil {
+		if errors.Is(err, service.ErrCursorExpired) {
+			c.JSON(http.StatusGone, api.CursorExpiredError{
+				Error:  api.Error{Code: api.CodeCursorExpired, Message: "游标已过期，请重新同步"},
+				Cursor: current,
+			})
+			return
+		}
+		writeError(c, http.StatusInternalServerError, "获取事件失败")
+		return
+	}
+	c.JSON(http.StatusOK, api.EventList{Events: events, Cursor: current})
+}
+
+// StreamEventsHandler 以 Server-Sent Events 推送库的变更事件
+// GET /events/libraries/{libraryId}/stream?cursor=123
+// 游标也可以通过 Last-Event-ID 请求头传递（浏览器 EventSource 重连时自动携带）。
+// 每个事件的 id 为其序号，event 为事件类型，data 为事件 JSON；
+// 游标过期时先发送 reset 事件（data 为 {"cursor": 新游标}），之后推送新事件。
+// 服务端在客户端消费过慢时会断开连接，客户端应以最后收到的序号重连
+func (h *EventHandler) StreamEventsHandler(c *gin.Context) {
+	libraryID, ok := libraryIDParam(c)
+	if !ok || !authorizeLibrary(c, h.access, libraryID) {
+		return
+	}
+	cursor, ok := eventCursor(c)
+	if !ok {
+		return
+	}
+
+	reset := false
+	sub, backlog, err := h.events.Subscribe(libraryID, cursor)
+	if errors.Is(err, service.ErrCursorExpired) {
+		reset = true
+		sub, backlog, err = h.events.Subscribe(libraryID, 0)
+	}
+	if err != nil {
+		writeError(c, http.StatusInternalServerError, "订阅事件失败")
+		return
+	}
+	defer sub.Close()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	w := c.Writer
+	if reset {
+		fmt.Fprintf(w, "id: %d\nevent: reset\ndata: {\"cursor\":%d}\n\n", sub.Start, sub.Start)
+	} else {
+		fmt.Fprintf(w, ": subscribed to library %d at %d\n\n", libraryID, sub.Start)
+	}
+	for _, event := range backlog {
+		if err := writeEvent(w, event); err != nil {
+			return
+		}
+	}
+	w.Flush()
+
+	heartbeat := time.NewTicker(eventHeartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case event, open := <-sub.C:
+			if !open {
+				return
+			}
+			if err := writeEvent(w, event); err != nil {
+				return
+			}
+			w.Flush()
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+			w.Flush()
+		}
+	}
+}
+
+// writeEvent 写出一个 SSE 事件
+func writeEvent(w gin.ResponseWriter, event service.Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.Seq, event.Type, data)
+	return err
+}
+
+// eventCursor 从 cursor 参数或 Last-Event-ID 请求头读取游标，缺省为 0
+func eventCursor(c *gin.Context) (uint64, bool) {
+	raw := c.Query("cursor")
+	if raw == "" {
+		raw = c.GetHeader("Last-Event-ID")
+	}
+	if raw == "" {
+		return 0, true
+	}
+	cursor, err := strconv.ParseUint(raw, 10, 64)
+	if err != nil {
+		writeError(c, http.StatusBadRequest, "无效的游标")
+		return 0, false
+	}
+	return cursor, true
+}
+
+// RegisterEventRoutes 设置变更事件相关的路由
+func RegisterEventRoutes(r *gin.Engine, events *service.EventBus, access *service.LibraryAccess) {
+	handler := NewEventHandler(events, access)
+
+	eventGroup := r.Group("/api/v1/events")
+	{
+		eventGroup.GET("/libraries/:libraryId", handler.ListEventsHandler)          // 轮询事件
+		eventGroup.GET("/libraries/:libraryId/stream", handler.StreamEventsHandler) // SSE 事件流
+	}
+}
@@ -0,0 +1,131 @@
+package handler
+
+import (
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sealock/core-storage/service"
+)
+
+// activeContentTypes 浏览器会执行脚本或样式的内容类型，这些文件总是作为附件下载
+var activeContentTypes = map[string]bool{
+	"text/html":                     true,
+	"application/xhtml+xml":         true,
+	"image/svg+xml":                 true,
+	"text/xml":                      true,
+	"application/xml":               true,
+	"text/xsl":                      true,
+	"text/javascript":               true,
+	"application/javascript":        true,
+	"application/x-javascript":      true,
+	"application/ecmascript":        true,
+	"text/css":                      true,
+	"multipart/x-mixed-replace":     true,
+	"application/x-shockwave-flash": true,
+}
+
+// FileHandler 处理文件内容的下载
+type FileHandler struct {
+	fileService *service.FileService
+	access      *service.LibraryAccess
+}
+
+// NewFileHandler 创建新的FileHandler实例
+func NewFileHandler(fileService *service.FileService, access *service.LibraryAccess) *FileHandler {
+	return &FileHandler{fileService: fileService, access: access}
+}
+
+// ContentHandler 从块存储流式读取文件内容
+// GET /files/{id}/content?download=true
+// 支持 Range 请求（含多段 Range，返回 multipart/byteranges）以便断点续传和视频拖动；
+// ETag 为文件内容哈希，支持 If-None-Match、If-Match、If-Range 以及基于修改时间的条件请求。
+// 默认以 inline 方式返回，download=true 时作为附件下载；HTML、SVG、脚本等类型总是作为附件下载
+func (h *FileHandler) ContentHandler(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		writeError(c, http.StatusBadRequest, "无效的文件ID")
+		return
+	}
+
+	reader, file, err := h.fileService.OpenFile(c.Request.Context(), uint(id))
+	if err != nil {
+		writeError(c, http.StatusInternalServerError, "读取文件失败")
+		return
+	}
+	if file == nil {
+		writeError(c, http.StatusNotFound, "文件不存在")
+		return
+	}
+	defer reader.Close()
+	if !authorizeLibrary(c, h.access, file.LibraryID) {
+		return
+	}
+
+	if file.Hash != "" {
+		c.Header("ETag", `"`+file.Hash+`"`)
+	}
+	c.Header("Cache-Control", "private, no-cache")
+	serveContent(c, path.Base(file.Name), file.UpdatedAt, reader, c.Query("download") == "true")
+}
+
+// serveContent 返回文件内容，支持 Range 和条件请求
+// 内容类型按扩展名确定，扩展名未知时按内容检测；浏览器会执行的类型总是作为附件下载，
+// 并禁止浏览器再次嗅探类型，避免用户上传的文件在本站点下运行脚本
+func serveContent(c *gin.Context, name string, modTime time.Time, content io.ReadSeeker, download bool) {
+	ctype, err := detectContentType(name, content)
+	if err != nil {
+		writeError(c, http.StatusInternalServerError, "读取文件失败")
+		return
+	}
+	disposition := "inline"
+	if download || isActiveContent(ctype) {
+		disposition = "attachment"
+	}
+	c.Header("Content-Type", ctype)
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Header("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": name}))
+	http.ServeContent(c.Writer, c.Request, name, modTime, content)
+}
+
+// detectContentType 按扩展名或内容的前 512 字节确定内容类型，检测后把读取位置移回开头
+func detectContentType(name string, content io.ReadSeeker) (string, error) {
+	if ctype := mime.TypeByExtension(path.Ext(name)); ctype != "" {
+		return ctype, nil
+	}
+	buf := make([]byte, 512)
+	n, err := io.ReadFull(content, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	return http.DetectContentType(buf[:n]), nil
+}
+
+// isActiveContent 判断内容类型是否会被浏览器当作网页、脚本或样式执行
+func isActiveContent(ctype string) bool {
+	mediaType, _, err := mime.ParseMediaType(ctype)
+	if err != nil {
+		// 无法解析的类型按最坏情况处理
+		return true
+	}
+	return activeContentTypes[mediaType] || strings.HasSuffix(mediaType, "+xml")
+}
+
+// RegisterFileRoutes 设置文件访问相关的路由
+func RegisterFileRoutes(r *gin.Engine, fileService *service.FileService, access *service.LibraryAccess) {
+	handler := NewFileHandler(fileService, access)
+
+	fileGroup := r.Group("/api/v1/files")
+	{
+		fileGroup.GET("/:id/content", handler.ContentHandler)  // 下载文件内容
+		fileGroup.HEAD("/:id/content", handler.ContentHandler) // 获取文件信息
+	}
+}
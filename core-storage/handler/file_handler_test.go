@@ -0,0 +1,90 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sealock/core-storage/chunker"
+	"github.com/sealock/core-storage/model"
+	"github.com/sealock/core-storage/service"
+	"github.com/sealock/core-storage/storage"
+)
+
+func TestFileContentHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+	files := service.NewFileService(storage.NewLocalBlockStore(), storage.NewMockFileRepository(), storage.NewMockBlockRepository(),
+		chunker.NewFixedSizeChunker(4), storage.NewMockSnapshotRepository(), newTestRedis(t), true)
+	t.Cleanup(func() { files.Close(ctx) })
+	libraries := storage.NewMockLibraryRepository()
+	lib := &model.Library{Name: "docs", OwnerID: 1}
+	if err := libraries.CreateLibrary(ctx, lib); err != nil {
+		t.Fatalf("create library: %v", err)
+	}
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		id, _ := strconv.ParseUint(c.GetHeader("X-Test-User"), 10, 64)
+		c.Set("user_id", uint(id))
+	})
+	RegisterFileRoutes(router, files, service.NewLibraryAccess(libraries))
+
+	tests := []struct {
+		name        string
+		content     string
+		query       string
+		disposition string
+		contentType string
+	}{
+		{"notes.txt", "plain text", "", "inline", "text/plain; charset=utf-8"},
+		{"notes.txt", "plain text", "?download=true", "attachment", "text/plain; charset=utf-8"},
+		{"page.html", "<p>hi</p>", "", "attachment", "text/html; charset=utf-8"},
+		{"logo.svg", "<svg xmlns='http://www.w3.org/2000/svg'/>", "", "attachment", "image/svg+xml"},
+		{"app.js", "alert(1)", "", "attachment", ""}, // 系统的 MIME 表可能把 .js 映射为不同的类型
+		{"noext", "<html><script>alert(1)</script></html>", "", "attachment", "text/html; charset=utf-8"},
+		{"blob", "\x00\x01\x02binary", "", "inline", "application/octet-stream"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name+tt.query, func(t *testing.T) {
+			file, err := files.PutFile(ctx, lib.ID, 1, tt.name, strings.NewReader(tt.content), int64(len(tt.content)))
+			if err != nil {
+				t.Fatalf("put file: %v", err)
+			}
+			req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/v1/files/%d/content%s", file.ID, tt.query), nil)
+			req.Header.Set("X-Test-User", "1")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if w.Code != http.StatusOK || w.Body.String() != tt.content {
+				t.Fatalf("status %d, body %q", w.Code, w.Body.String())
+			}
+			if got := w.Header().Get("Content-Disposition"); !strings.HasPrefix(got, tt.disposition+";") {
+				t.Errorf("Content-Disposition = %q, want %s", got, tt.disposition)
+			}
+			if got := w.Header().Get("Content-Type"); tt.contentType != "" && got != tt.contentType {
+				t.Errorf("Content-Type = %q, want %q", got, tt.contentType)
+			}
+			if got := w.Header().Get("X-Content-Type-Options"); got != "nosniff" {
+				t.Errorf("X-Content-Type-Options = %q", got)
+			}
+		})
+	}
+
+	// 其他用户不能读取库中的文件
+	file, err := files.PutFile(ctx, lib.ID, 1, "secret.txt", strings.NewReader("secret"), 6)
+	if err != nil {
+		t.Fatalf("put file: %v", err)
+	}
+	req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/v1/files/%d/content", file.ID), nil)
+	req.Header.Set("X-Test-User", "2")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusForbidden || strings.Contains(w.Body.String(), "secret") {
+		t.Fatalf("other user: status %d: %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,283 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sealock/core-storage/api"
+	"github.com/sealock/core-storage/model"
+	"github.com/sealock/core-storage/service"
+)
+
+const (
+	// defaultPageSize 列表接口未指定 limit 时的默认页大小
+	defaultPageSize = 50
+	// maxPageSize 列表接口允许的最大页大小
+	maxPageSize = 500
+)
+
+// HistoryHandler 处理库的历史版本请求：快照列表、创建快照、快照详情、快照对比和回滚
+type HistoryHandler struct {
+	history *service.HistoryService
+	access  *service.LibraryAccess
+}
+
+// NewHistoryHandler 创建新的HistoryHandler实例
+func NewHistoryHandler(history *service.HistoryService, access *service.LibraryAccess) *HistoryHandler {
+	return &HistoryHandler{history: history, access: access}
+}
+
+// ListSnapshotsHandler 分页列出库的快照（提交历史），最新的在前
+// GET /libraries/{libraryId}/snapshots?limit=50&offset=0
+func (h *HistoryHandler) ListSnapshotsHandler(c *gin.Context) {
+	libraryID, ok := libraryIDParam(c)
+	if !ok {
+		return
+	}
+	limit, offset, ok := pageParams(c)
+	if !ok {
+		return
+	}
+
+	snapshots, total, err := h.history.ListSnapshots(c.Request.Context(), libraryID, limit, offset)
+	if err != nil {
+		writeError(c, http.StatusInternalServerError, "获取历史版本失败")
+		return
+	}
+
+	items := make([]api.Snapshot, 0, len(snapshots))
+	for i := range snapshots {
+		items = append(items, snapshotJSON(&snapshots[i]))
+	}
+	c.JSON(http.StatusOK, api.SnapshotList{
+		LibraryID: libraryID,
+		Snapshots: items,
+		Page:      api.Page{Total: total, Limit: limit, Offset: offset},
+	})
+}
+
+// CreateSnapshotHandler 为库的当前状态创建命名快照
+// POST /libraries/{libraryId}/snapshots
+// 请求体:
+// {
+//   "name": "发布前",
+//   "description": "v1.0 发布前的版本",
+//   "tag": "v1.0"
+// }
+func (h *HistoryHandler) CreateSnapshotHandler(c *gin.Context) {
+	libraryID, ok := libraryIDParam(c)
+	if !ok {
+		return
+	}
+
+	var req api.CreateSnapshotRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeError(c, http.StatusBadRequest, "无效的请求格式")
+		return
+	}
+
+	snapshot, err := h.history.CreateSnapshot(c.Request.Context(), libraryID, req.Name, req.Description, req.Tag)
+	if err != nil {
+		if errors.Is(err, service.ErrReadOnlyReplica) {
+			writeReadOnly(c)
+			return
+		}
+		writeError(c, http.StatusInternalServerError, "创建快照失败")
+		return
+	}
+	c.JSON(http.StatusCreated, snapshotJSON(snapshot))
+}
+
+// RevertHandler 把库回滚到指定快照，回滚本身会生成一个新提交
+// POST /libraries/{libraryId}/revert
+// 请求体:
+// {
+//   "snapshot": "快照ID或UUID"
+// }
+func (h *HistoryHandler) RevertHandler(c *gin.Context) {
+	libraryID, ok := libraryIDParam(c)
+	if !ok {
+		return
+	}
+
+	var req api.RevertRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeError(c, http.StatusBadRequest, "无效的请求格式")
+		return
+	}
+	snapshot, err := h.history.ResolveSnapshot(c.Request.Context(), req.Snapshot)
+	if err != nil {
+		writeError(c, http.StatusNotFound, "快照不存在")
+		return
+	}
+
+	var author string
+	if userID := c.GetUint("user_id"); userID != 0 {
+		author = strconv.FormatUint(uint64(userID), 10)
+	}
+	result, err := h.history.Revert(c.Request.Context(), libraryID, snapshot, author)
+	if err != nil {
+		if errors.Is(err, service.ErrSnapshotNotInLibrary) {
+			writeError(c, http.StatusBadRequest, "快照不属于该库")
+			return
+		}
+		if errors.Is(err, service.ErrReadOnlyReplica) {
+			writeReadOnly(c)
+			return
+		}
+		writeError(c, http.StatusInternalServerError, "回滚失败")
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// GetSnapshotHandler 获取快照详情及其文件列表（分页）
+// GET /snapshots/{id}?limit=50&offset=0
+// id 可以是快照数字ID或UUID
+func (h *HistoryHandler) GetSnapshotHandler(c *gin.Context) {
+	snapshot, ok := h.resolveSnapshot(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	limit, offset, ok := pageParams(c)
+	if !ok {
+		return
+	}
+
+	files, err := h.history.ListFiles(c.Request.Context(), snapshot.ID, limit, offset)
+	if err != nil {
+		writeError(c, http.StatusInternalServerError, "获取快照文件失败")
+		return
+	}
+	c.JSON(http.StatusOK, api.SnapshotDetail{
+		Snapshot: snapshotJSON(snapshot),
+		Files:    snapshotFilesJSON(files),
+		Page:     api.Page{Total: snapshot.FileCount, Limit: limit, Offset: offset},
+	})
+}
+
+// DiffHandler 对比两个快照
+// GET /snapshots/{id}/diff?from={id}
+// 未指定 from 时与父快照对比，没有父快照时所有文件均为新增；from 必须与 id 属于同一个库
+func (h *HistoryHandler) DiffHandler(c *gin.Context) {
+	to, ok := h.resolveSnapshot(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	var from *model.Snapshot
+	if ref := c.Query("from"); ref != "" {
+		if from, ok = h.resolveSnapshot(c, ref); !ok {
+			return
+		}
+		if from.LibraryID != to.LibraryID {
+			writeError(c, http.StatusBadRequest, "两个快照不属于同一个库")
+			return
+		}
+	} else {
+		from, _ = h.history.Parent(c.Request.Context(), to)
+	}
+
+	diff, err := h.history.Diff(c.Request.Context(), from, to)
+	if err != nil {
+		writeError(c, http.StatusInternalServerError, "对比快照失败")
+		return
+	}
+
+	var fromJSON *api.Snapshot
+	if from != nil {
+		snapshot := snapshotJSON(from)
+		fromJSON = &snapshot
+	}
+	c.JSON(http.StatusOK, api.SnapshotDiff{
+		From:     fromJSON,
+		To:       snapshotJSON(to),
+		Added:    snapshotFilesJSON(diff.Added),
+		Removed:  snapshotFilesJSON(diff.Removed),
+		Modified: snapshotFilesJSON(diff.Modified),
+	})
+}
+
+// resolveSnapshot 解析快照标识并检查当前用户能否访问快照所属的库，失败时直接写入错误响应
+func (h *HistoryHandler) resolveSnapshot(c *gin.Context, ref string) (*model.Snapshot, bool) {
+	snapshot, err := h.history.ResolveSnapshot(c.Request.Context(), ref)
+	if err != nil {
+		writeError(c, http.StatusNotFound, "快照不存在")
+		return nil, false
+	}
+	if !authorizeLibrary(c, h.access, snapshot.LibraryID) {
+		return nil, false
+	}
+	return snapshot, true
+}
+
+// pageParams 解析 limit/offset 分页参数，失败时直接写入错误响应
+func pageParams(c *gin.Context) (int, int, bool) {
+	limit, offset := defaultPageSize, 0
+	if raw := c.Query("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 || n > maxPageSize {
+			writeError(c, http.StatusBadRequest, "无效的 limit 参数")
+			return 0, 0, false
+		}
+		limit = n
+	}
+	if raw := c.Query("offset"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 {
+			writeError(c, http.StatusBadRequest, "无效的 offset 参数")
+			return 0, 0, false
+		}
+		offset = n
+	}
+	return limit, offset, true
+}
+
+// snapshotJSON 将快照转换为响应结构
+func snapshotJSON(snapshot *model.Snapshot) api.Snapshot {
+	return api.Snapshot{
+		ID:          snapshot.ID,
+		UUID:        snapshot.UUID,
+		LibraryID:   snapshot.LibraryID,
+		Name:        snapshot.Name,
+		Description: snapshot.Description,
+		Tag:         snapshot.Tag,
+		ParentID:    snapshot.ParentID,
+		RootHash:    snapshot.RootHash,
+		FileCount:   snapshot.FileCount,
+		Size:        snapshot.Size,
+		CreatedAt:   snapshot.CreatedAt,
+	}
+}
+
+// snapshotFilesJSON 将快照文件列表转换为响应结构
+func snapshotFilesJSON(files []model.SnapshotFile) []api.SnapshotFile {
+	items := make([]api.SnapshotFile, 0, len(files))
+	for _, file := range files {
+		items = append(items, api.SnapshotFile{
+			Path: file.FileName,
+			Hash: file.FileHash,
+			Size: file.Size,
+		})
+	}
+	return items
+}
+
+// RegisterHistoryRoutes 设置历史版本相关的路由
+func RegisterHistoryRoutes(r *gin.Engine, history *service.HistoryService, access *service.LibraryAccess) {
+	handler := NewHistoryHandler(history, access)
+
+	libraryGroup := r.Group("/api/v1/libraries")
+	{
+		libraryGroup.GET("/:libraryId/snapshots", handler.ListSnapshotsHandler)   // 快照列表（提交历史）
+		libraryGroup.POST("/:libraryId/snapshots", handler.CreateSnapshotHandler) // 创建命名快照
+		libraryGroup.POST("/:libraryId/revert", handler.RevertHandler)            // 回滚到指定快照
+	}
+
+	snapshotGroup := r.Group("/api/v1/snapshots")
+	{
+		snapshotGroup.GET("/:id", handler.GetSnapshotHandler) // 快照详情
+		snapshotGroup.GET("/:id/diff", handler.DiffHandler)   // 对比快照
+	}
+}
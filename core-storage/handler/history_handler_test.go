@@ -0,0 +1,99 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sealock/core-storage/chunker"
+	"github.com/sealock/core-storage/middleware"
+	"github.com/sealock/core-storage/model"
+	"github.com/sealock/core-storage/service"
+	"github.com/sealock/core-storage/storage"
+)
+
+func TestHistoryLibraryAccess(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+	fileRepo := storage.NewMockFileRepository()
+	blockStore := storage.NewLocalBlockStore()
+	blockRepo := storage.NewMockBlockRepository()
+	files := service.NewFileService(blockStore, fileRepo, blockRepo,
+		chunker.NewFixedSizeChunker(4), storage.NewMockSnapshotRepository(), newTestRedis(t), true)
+	t.Cleanup(func() { files.Close(ctx) })
+	sync := service.NewSyncService(fileRepo, blockStore, blockRepo, storage.NewMockConflictRepository(), files.CommitScheduler())
+	sync.SetLibraryLocks(files.LibraryLocks())
+	history := service.NewHistoryService(files, sync)
+
+	// 用户 1 拥有库 mine，用户 2 拥有库 theirs，两个库各有一个快照
+	libraries := storage.NewMockLibraryRepository()
+	mine := &model.Library{Name: "mine", OwnerID: 1}
+	theirs := &model.Library{Name: "theirs", OwnerID: 2}
+	snapshots := make(map[uint]*model.Snapshot)
+	for _, lib := range []*model.Library{mine, theirs} {
+		if err := libraries.CreateLibrary(ctx, lib); err != nil {
+			t.Fatalf("create library: %v", err)
+		}
+		if _, err := files.PutFile(ctx, lib.ID, lib.OwnerID, lib.Name+".txt", strings.NewReader(lib.Name), int64(len(lib.Name))); err != nil {
+			t.Fatalf("put file: %v", err)
+		}
+		snapshot, err := history.CreateSnapshot(ctx, lib.ID, lib.Name, "", "")
+		if err != nil {
+			t.Fatalf("create snapshot: %v", err)
+		}
+		snapshots[lib.ID] = snapshot
+	}
+
+	access := service.NewLibraryAccess(libraries)
+	router := gin.New()
+	router.Use(func(c *gin.Context) { c.Set("user_id", uint(1)) }, middleware.LibraryAccess(access))
+	RegisterHistoryRoutes(router, history, access)
+	request := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return w
+	}
+	own, other := snapshots[mine.ID], snapshots[theirs.ID]
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		want   int
+	}{
+		{"own snapshot", http.MethodGet, fmt.Sprintf("/api/v1/snapshots/%d", own.ID), "", http.StatusOK},
+		{"own snapshot by UUID", http.MethodGet, "/api/v1/snapshots/" + own.UUID, "", http.StatusOK},
+		{"other snapshot", http.MethodGet, fmt.Sprintf("/api/v1/snapshots/%d", other.ID), "", http.StatusForbidden},
+		{"other snapshot by UUID", http.MethodGet, "/api/v1/snapshots/" + other.UUID, "", http.StatusForbidden},
+		{"diff other snapshot", http.MethodGet, fmt.Sprintf("/api/v1/snapshots/%d/diff", other.ID), "", http.StatusForbidden},
+		{"diff from other snapshot", http.MethodGet, fmt.Sprintf("/api/v1/snapshots/%d/diff?from=%d", own.ID, other.ID), "", http.StatusForbidden},
+		{"other library snapshots", http.MethodGet, fmt.Sprintf("/api/v1/libraries/%d/snapshots", theirs.ID), "", http.StatusForbidden},
+		{"create snapshot in other library", http.MethodPost, fmt.Sprintf("/api/v1/libraries/%d/snapshots", theirs.ID), `{}`, http.StatusForbidden},
+		{"revert other library", http.MethodPost, fmt.Sprintf("/api/v1/libraries/%d/revert", theirs.ID), fmt.Sprintf(`{"snapshot":"%s"}`, other.UUID), http.StatusForbidden},
+		// 用其他库的快照回滚自己的库会把其他库的内容复制进来
+		{"revert to other snapshot", http.MethodPost, fmt.Sprintf("/api/v1/libraries/%d/revert", mine.ID), fmt.Sprintf(`{"snapshot":"%s"}`, other.UUID), http.StatusBadRequest},
+		{"missing snapshot", http.MethodGet, "/api/v1/snapshots/999", "", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := request(tt.method, tt.path, tt.body); w.Code != tt.want {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+	if file, _ := fileRepo.GetFileByPath(ctx, mine.ID, theirs.Name+".txt"); file != nil {
+		t.Fatal("revert copied a file of another library")
+	}
+
+	// 本库的快照列表只包含本库的快照
+	w := request(http.MethodGet, "/api/v1/libraries/"+strconv.FormatUint(uint64(mine.ID), 10)+"/snapshots", "")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), own.UUID) || strings.Contains(w.Body.String(), other.UUID) {
+		t.Fatalf("own snapshots: status %d: %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,258 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sealock/core-storage/api"
+	"github.com/sealock/core-storage/model"
+	"github.com/sealock/core-storage/service"
+	"github.com/sealock/core-storage/storage"
+)
+
+// LibraryHandler 处理库的管理请求
+type LibraryHandler struct {
+	libraries *service.LibraryService
+}
+
+// NewLibraryHandler 创建新的LibraryHandler实例
+func NewLibraryHandler(libraries *service.LibraryService) *LibraryHandler {
+	return &LibraryHandler{libraries: libraries}
+}
+
+// CreateLibraryHandler 为当前用户创建库
+// POST /libraries
+// 请求体:
+// {
+//   "name": "文档",
+//   "description": "团队共享文档"
+// }
+func (h *LibraryHandler) CreateLibraryHandler(c *gin.Context) {
+	var req api.CreateLibraryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeError(c, http.StatusBadRequest, "无效的请求格式")
+		return
+	}
+
+	lib := &model.Library{
+		Name:        req.Name,
+		Description: req.Description,
+		OwnerID:     c.GetUint("user_id"),
+	}
+	if err := h.libraries.CreateLibrary(c.Request.Context(), lib); err != nil {
+		writeLibraryError(c, err, "创建库失败")
+		return
+	}
+	c.JSON(http.StatusCreated, libraryJSON(lib))
+}
+
+// ListLibrariesHandler 列出当前用户的库
+// GET /libraries
+func (h *LibraryHandler) ListLibrariesHandler(c *gin.Context) {
+	libs, err := h.libraries.ListLibraries(c.Request.Context(), c.GetUint("user_id"))
+	if err != nil {
+		writeError(c, http.StatusInternalServerError, "获取库列表失败")
+		return
+	}
+
+	items := make([]api.Library, 0, len(libs))
+	for _, lib := range libs {
+		items = append(items, libraryJSON(lib))
+	}
+	c.JSON(http.StatusOK, api.LibraryList{Libraries: items})
+}
+
+// GetLibraryHandler 获取库详情，统计信息为最近一次提交时的值
+// GET /libraries/{libraryId}
+func (h *LibraryHandler) GetLibraryHandler(c *gin.Context) {
+	lib, ok := h.library(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, libraryJSON(lib))
+}
+
+// UpdateLibraryHandler 重命名库或修改描述，未提供的字段保持不变
+// PATCH /libraries/{libraryId}
+// 请求体:
+// {
+//   "name": "新名称",
+//   "description": "新描述"
+// }
+func (h *LibraryHandler) UpdateLibraryHandler(c *gin.Context) {
+	lib, ok := h.library(c)
+	if !ok {
+		return
+	}
+
+	var req api.UpdateLibraryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeError(c, http.StatusBadRequest, "无效的请求格式")
+		return
+	}
+
+	lib, err := h.libraries.UpdateLibrary(c.Request.Context(), lib.ID, req.Name, req.Description)
+	if err != nil {
+		writeLibraryError(c, err, "更新库失败")
+		return
+	}
+	if lib == nil {
+		writeError(c, http.StatusNotFound, "库不存在")
+		return
+	}
+	c.JSON(http.StatusOK, libraryJSON(lib))
+}
+
+// DeleteLibraryHandler 删除库及其全部文件和历史版本
+// DELETE /libraries/{libraryId}
+func (h *LibraryHandler) DeleteLibraryHandler(c *gin.Context) {
+	lib, ok := h.library(c)
+	if !ok {
+		return
+	}
+	if err := h.libraries.DeleteLibrary(c.Request.Context(), lib.ID); err != nil {
+		writeError(c, http.StatusInternalServerError, "删除库失败")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// ListVersionsHandler 列出库的版本，最新的在前
+// GET /libraries/{libraryId}/versions
+func (h *LibraryHandler) ListVersionsHandler(c *gin.Context) {
+	lib, ok := h.library(c)
+	if !ok {
+		return
+	}
+
+	versions, err := h.libraries.ListVersions(c.Request.Context(), lib.ID)
+	if err != nil {
+		writeError(c, http.StatusInternalServerError, "获取版本列表失败")
+		return
+	}
+
+	items := make([]api.LibraryVersion, 0, len(versions))
+	for _, version := range versions {
+		items = append(items, versionJSON(version))
+	}
+	c.JSON(http.StatusOK, api.VersionList{
+		LibraryID: lib.ID,
+		Versions:  items,
+	})
+}
+
+// library 读取路径中的库并检查是否属于当前用户，失败时直接写入错误响应
+func (h *LibraryHandler) library(c *gin.Context) (*model.Library, bool) {
+	libraryID, ok := libraryIDParam(c)
+	if !ok {
+		return nil, false
+	}
+	lib, err := h.libraries.GetLibrary(c.Request.Context(), libraryID)
+	if err != nil {
+		writeError(c, http.StatusInternalServerError, "获取库失败")
+		return nil, false
+	}
+	if lib == nil {
+		writeError(c, http.StatusNotFound, "库不存在")
+		return nil, false
+	}
+	if lib.OwnerID != c.GetUint("user_id") {
+		writeError(c, http.StatusForbidden, "无权访问该库")
+		return nil, false
+	}
+	return lib, true
+}
+
+// authorizeLibrary 检查当前用户能否访问库，失败时直接写入错误响应
+// 用于通过文件、快照等其他资源或请求体访问库的接口；路径中带库ID的接口已由中间件检查
+func authorizeLibrary(c *gin.Context, access *service.LibraryAccess, libraryID uint) bool {
+	err := access.Check(c.Request.Context(), c.GetUint("user_id"), libraryID)
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, storage.ErrLibraryNotFound):
+		writeError(c, http.StatusNotFound, "库不存在")
+	case errors.Is(err, service.ErrLibraryAccessDenied):
+		writeError(c, http.StatusForbidden, "无权访问该库")
+	default:
+		writeError(c, http.StatusInternalServerError, "获取库失败")
+	}
+	return false
+}
+
+// readableLibraries 返回当前用户可以读取的库，失败时写入 500 响应
+func readableLibraries(c *gin.Context, access *service.LibraryAccess) ([]uint, bool) {
+	libraries, err := access.Libraries(c.Request.Context(), c.GetUint("user_id"))
+	if err != nil {
+		writeError(c, http.StatusInternalServerError, "获取库失败")
+		return nil, false
+	}
+	ids := make([]uint, 0, len(libraries))
+	for id := range libraries {
+		ids = append(ids, id)
+	}
+	return ids, true
+}
+
+// writeLibraryError 按错误类型写入创建或更新库失败的响应
+func writeLibraryError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, service.ErrInvalidLibrary):
+		writeError(c, http.StatusBadRequest, "无效的库名称")
+	case errors.Is(err, service.ErrLibraryNameConflict):
+		writeError(c, http.StatusConflict, "已存在同名的库")
+	default:
+		writeError(c, http.StatusInternalServerError, message)
+	}
+}
+
+// libraryJSON 将库转换为响应结构
+func libraryJSON(lib *model.Library) api.Library {
+	return api.Library{
+		ID:               lib.ID,
+		UUID:             lib.UUID,
+		Name:             lib.Name,
+		Description:      lib.Description,
+		OwnerID:          lib.OwnerID,
+		CurrentVersionID: lib.CurrentVersionID,
+		TotalSize:        lib.TotalSize,
+		FileCount:        lib.FileCount,
+		VersionCount:     lib.VersionCount,
+		CreatedAt:        lib.CreatedAt,
+		UpdatedAt:        lib.UpdatedAt,
+	}
+}
+
+// versionJSON 将库版本转换为响应结构
+func versionJSON(version *model.LibraryVersion) api.LibraryVersion {
+	parents := []string{}
+	if len(version.ParentCommits) > 0 {
+		_ = json.Unmarshal(version.ParentCommits, &parents)
+	}
+	return api.LibraryVersion{
+		ID:        version.ID,
+		CommitID:  version.CommitID,
+		RootHash:  version.RootHash,
+		Message:   version.Message,
+		Author:    version.Author,
+		Parents:   parents,
+		CreatedAt: version.CreatedAt,
+	}
+}
+
+// RegisterLibraryRoutes 设置库管理相关的路由
+func RegisterLibraryRoutes(r *gin.Engine, libraries *service.LibraryService) {
+	handler := NewLibraryHandler(libraries)
+
+	libraryGroup := r.Group("/api/v1/libraries")
+	{
+		libraryGroup.POST("", handler.CreateLibraryHandler)                   // 创建库
+		libraryGroup.GET("", handler.ListLibrariesHandler)                    // 库列表
+		libraryGroup.GET("/:libraryId", handler.GetLibraryHandler)            // 库详情
+		libraryGroup.PATCH("/:libraryId", handler.UpdateLibraryHandler)       // 重命名或修改描述
+		libraryGroup.DELETE("/:libraryId", handler.DeleteLibraryHandler)      // 删除库
+		libraryGroup.GET("/:libraryId/versions", handler.ListVersionsHandler) // 版本列表
+	}
+}
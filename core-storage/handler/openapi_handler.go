@@ -0,0 +1,31 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sealock/core-storage/api"
+)
+
+// OpenAPIYAMLHandler 返回 YAML 格式的 OpenAPI 文档
+// GET /api/v1/openapi.yaml
+func OpenAPIYAMLHandler(c *gin.Context) {
+	c.Data(http.StatusOK, "application/yaml; charset=utf-8", api.OpenAPIYAML())
+}
+
+// OpenAPIJSONHandler 返回 JSON 格式的 OpenAPI 文档
+// GET /api/v1/openapi.json
+func OpenAPIJSONHandler(c *gin.Context) {
+	doc, err := api.OpenAPIJSON()
+	if err != nil {
+		writeError(c, http.StatusInternalServerError, "读取接口文档失败")
+		return
+	}
+	c.Data(http.StatusOK, "application/json; charset=utf-8", doc)
+}
+
+// RegisterOpenAPIRoutes 设置 OpenAPI 文档的路由
+func RegisterOpenAPIRoutes(r *gin.Engine) {
+	r.GET("/api/v1/openapi.yaml", OpenAPIYAMLHandler) // YAML 文档
+	r.GET("/api/v1/openapi.json", OpenAPIJSONHandler) // JSON 文档
+}
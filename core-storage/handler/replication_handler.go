@@ -0,0 +1,321 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sealock/core-storage/api"
+	"github.com/sealock/core-storage/service"
+)
+
+// ReplicationHandler 处理跨服务器的库复制
+// 主服务器端提供提交日志和块下载；副本端提供复制配置、状态、手动触发和提升
+type ReplicationHandler struct {
+	replication *service.ReplicationService
+	access      *service.LibraryAccess
+}
+
+// NewReplicationHandler 创建新的ReplicationHandler实例
+func NewReplicationHandler(replication *service.ReplicationService, access *service.LibraryAccess) *ReplicationHandler {
+	return &ReplicationHandler{replication: replication, access: access}
+}
+
+// CommitFeedHandler 返回库在游标之后的提交（主服务器端）
+// GET /replication/libraries/{libraryId}/commits?after=<uuid>&since=<RFC3339>&limit=20
+func (h *ReplicationHandler) CommitFeedHandler(c *gin.Context) {
+	libraryID, ok := libraryIDParam(c)
+	if !ok {
+		return
+	}
+
+	var since *time.Time
+	if raw := c.Query("since"); raw != "" {
+		t, err := time.Parse(time.RFC3339Nano, raw)
+		if err != nil {
+			writeError(c, http.StatusBadRequest, "无效的 since 参数")
+			return
+		}
+		since = &t
+	}
+	limit := 0
+	if raw := c.Query("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			writeError(c, http.StatusBadRequest, "无效的 limit 参数")
+			return
+		}
+		limit = n
+	}
+
+	feed, err := h.replication.CommitFeed(c.Request.Context(), libraryID, c.Query("after"), since, limit)
+	if err != nil {
+		if errors.Is(err, service.ErrReplicationCursorLost) {
+			writeError(c, http.StatusGone, "复制进度对应的提交已不存在")
+			return
+		}
+		writeError(c, http.StatusInternalServerError, "获取提交日志失败")
+		return
+	}
+	c.JSON(http.StatusOK, feed)
+}
+
+// DownloadBlockHandler 下载库引用的单个块（主服务器端）
+// GET /replication/libraries/{libraryId}/blocks/{hash}
+func (h *ReplicationHandler) DownloadBlockHandler(c *gin.Context) {
+	libraryID, ok := libraryIDParam(c)
+	if !ok {
+		return
+	}
+	hash := c.Param("hash")
+	data, err := h.replication.GetBlock(c.Request.Context(), libraryID, hash)
+	if err != nil {
+		writeError(c, http.StatusNotFound, "数据块不存在")
+		return
+	}
+	c.Header("ETag", `"`+hash+`"`)
+	c.Data(http.StatusOK, "application/octet-stream", data)
+}
+
+// ConfigureHandler 把本地库配置为主服务器上某个库的副本
+// PUT /replication/libraries/{libraryId}
+// 请求体:
+// {
+//   "primaryUrl": "https://primary.example.com",
+//   "primaryLibraryId": 1,
+//   "token": "..."          // 访问主服务器使用的令牌
+// }
+func (h *ReplicationHandler) ConfigureHandler(c *gin.Context) {
+	libraryID, ok := libraryIDParam(c)
+	if !ok || !h.authorizeOperator(c) {
+		return
+	}
+
+	var req api.ConfigureReplicationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeError(c, http.StatusBadRequest, "无效的请求格式")
+		return
+	}
+
+	if _, err := h.replication.Configure(c.Request.Context(), libraryID, req.PrimaryURL, req.PrimaryLibraryID, req.Token); err != nil {
+		if errors.Is(err, service.ErrInvalidPrimaryURL) {
+			writeError(c, http.StatusBadRequest, "无效的主服务器地址")
+			return
+		}
+		if errors.Is(err, service.ErrPrimaryNotAllowed) {
+			writeError(c, http.StatusForbidden, "不允许连接该主服务器")
+			return
+		}
+		writeError(c, http.StatusInternalServerError, "保存复制配置失败")
+		return
+	}
+	status, err := h.replication.Status(c.Request.Context(), libraryID)
+	if err != nil {
+		writeError(c, http.StatusInternalServerError, "获取复制状态失败")
+		return
+	}
+	c.JSON(http.StatusOK, status)
+}
+
+// RemoveHandler 删除库的复制配置，已复制的数据保留
+// DELETE /replication/libraries/{libraryId}
+func (h *ReplicationHandler) RemoveHandler(c *gin.Context) {
+	libraryID, ok := libraryIDParam(c)
+	if !ok || !h.authorizeOperator(c) {
+		return
+	}
+	if err := h.replication.Remove(c.Request.Context(), libraryID); err != nil {
+		h.replicationError(c, err, "删除复制配置失败")
+		return
+	}
+	c.JSON(http.StatusOK, api.Message{Message: "复制配置已删除"})
+}
+
+// StatusHandler 返回库的复制状态与延迟
+// GET /replication/libraries/{libraryId}/status
+func (h *ReplicationHandler) StatusHandler(c *gin.Context) {
+	libraryID, ok := libraryIDParam(c)
+	if !ok {
+		return
+	}
+	status, err := h.replication.Status(c.Request.Context(), libraryID)
+	if err != nil {
+		h.replicationError(c, err, "获取复制状态失败")
+		return
+	}
+	c.JSON(http.StatusOK, status)
+}
+
+// ListStatusHandler 返回当前用户可以访问的库的副本状态
+// GET /replication/status
+func (h *ReplicationHandler) ListStatusHandler(c *gin.Context) {
+	statuses, err := h.visibleStatuses(c)
+	if err != nil {
+		writeError(c, http.StatusInternalServerError, "获取复制状态失败")
+		return
+	}
+	list := api.ReplicationStatusList{Replications: make([]api.ReplicationStatus, len(statuses))}
+	for i := range statuses {
+		list.Replications[i] = api.ReplicationStatus(statuses[i])
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+// SyncHandler 立即从主服务器拉取新提交
+// POST /replication/libraries/{libraryId}/sync
+func (h *ReplicationHandler) SyncHandler(c *gin.Context) {
+	libraryID, ok := libraryIDParam(c)
+	if !ok || !h.authorizeOperator(c) {
+		return
+	}
+	result, err := h.replication.ReplicateOnce(c.Request.Context(), libraryID)
+	if err != nil {
+		if errors.Is(err, service.ErrReplicationNotFound) || errors.Is(err, service.ErrReplicationPromoted) {
+			h.replicationError(c, err, "")
+			return
+		}
+		c.JSON(http.StatusBadGateway, api.ReplicationError{
+			Error:  api.Error{Code: api.CodeUpstream, Message: "复制失败: " + err.Error()},
+			Result: (*api.ReplicationResult)(result),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// PromoteHandler 把副本提升为主库，停止跟随并恢复可写
+// POST /replication/libraries/{libraryId}/promote
+func (h *ReplicationHandler) PromoteHandler(c *gin.Context) {
+	libraryID, ok := libraryIDParam(c)
+	if !ok || !h.authorizeOperator(c) {
+		return
+	}
+	if _, err := h.replication.Promote(c.Request.Context(), libraryID); err != nil {
+		h.replicationError(c, err, "提升副本失败")
+		return
+	}
+	status, err := h.replication.Status(c.Request.Context(), libraryID)
+	if err != nil {
+		writeError(c, http.StatusInternalServerError, "获取复制状态失败")
+		return
+	}
+	c.JSON(http.StatusOK, status)
+}
+
+// MetricsHandler 以 Prometheus 文本格式输出当前用户可以访问的库的复制延迟指标
+// GET /replication/metrics
+func (h *ReplicationHandler) MetricsHandler(c *gin.Context) {
+	statuses, err := h.visibleStatuses(c)
+	if err != nil {
+		c.String(http.StatusInternalServerError, "# failed to list replications\n")
+		return
+	}
+
+	var b strings.Builder
+	metric := func(name, help, kind string, value func(s *service.ReplicationStatus) float64) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+		for i := range statuses {
+			s := &statuses[i]
+			fmt.Fprintf(&b, "%s{library=\"%d\",role=\"%s\"} %g\n", name, s.LibraryID, s.Role, value(s))
+		}
+	}
+	metric("sealock_replication_commits_behind", "Commits on the primary not yet applied to the replica.", "gauge",
+		func(s *service.ReplicationStatus) float64 { return float64(s.CommitsBehind) })
+	metric("sealock_replication_lag_seconds", "Time span of primary commits not yet applied to the replica.", "gauge",
+		func(s *service.ReplicationStatus) float64 { return s.LagSeconds })
+	metric("sealock_replication_last_success_timestamp_seconds", "Unix time of the last successful replication round.", "gauge",
+		func(s *service.ReplicationStatus) float64 { return unixSeconds(s.LastSuccessAt) })
+	metric("sealock_replication_healthy", "1 if the last replication round succeeded.", "gauge",
+		func(s *service.ReplicationStatus) float64 {
+			if s.LastError == "" {
+				return 1
+			}
+			return 0
+		})
+	metric("sealock_replication_commits_applied_total", "Commits applied from the primary.", "counter",
+		func(s *service.ReplicationStatus) float64 { return float64(s.CommitsApplied) })
+	metric("sealock_replication_blocks_fetched_total", "Blocks downloaded from the primary.", "counter",
+		func(s *service.ReplicationStatus) float64 { return float64(s.BlocksFetched) })
+	metric("sealock_replication_bytes_fetched_total", "Block bytes downloaded from the primary.", "counter",
+		func(s *service.ReplicationStatus) float64 { return float64(s.BytesFetched) })
+
+	c.Data(http.StatusOK, "text/plain; version=0.0.4; charset=utf-8", []byte(b.String()))
+}
+
+// visibleStatuses 返回当前用户可以访问的库的复制状态
+func (h *ReplicationHandler) visibleStatuses(c *gin.Context) ([]service.ReplicationStatus, error) {
+	libraries, err := h.access.Libraries(c.Request.Context(), c.GetUint("user_id"))
+	if err != nil {
+		return nil, err
+	}
+	statuses, err := h.replication.ListStatus(c.Request.Context())
+	if err != nil {
+		return nil, err
+	}
+	visible := statuses[:0]
+	for _, status := range statuses {
+		if libraries[status.LibraryID] {
+			visible = append(visible, status)
+		}
+	}
+	return visible, nil
+}
+
+// authorizeOperator 检查当前用户能否修改复制配置，不能时写入 403 响应
+func (h *ReplicationHandler) authorizeOperator(c *gin.Context) bool {
+	if h.replication.CanOperate(c.GetUint("user_id")) {
+		return true
+	}
+	writeError(c, http.StatusForbidden, "无权管理库复制")
+	return false
+}
+
+// replicationError 把复制服务的错误转换为响应
+func (h *ReplicationHandler) replicationError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, service.ErrReplicationNotFound):
+		writeError(c, http.StatusNotFound, "库未配置复制")
+	case errors.Is(err, service.ErrReplicationPromoted):
+		writeError(c, http.StatusConflict, "副本已提升为主库")
+	default:
+		writeError(c, http.StatusInternalServerError, fallback)
+	}
+}
+
+// writeReadOnly 写入库是只读副本的错误响应（service.ErrReadOnlyReplica）
+func writeReadOnly(c *gin.Context) {
+	c.JSON(http.StatusForbidden, api.Error{Code: api.CodeReadOnlyReplica, Message: "该库是只读副本"})
+}
+
+// unixSeconds 时间转换为 Unix 秒，nil 为 0
+func unixSeconds(t *time.Time) float64 {
+	if t == nil {
+		return 0
+	}
+	return float64(t.UnixNano()) / float64(time.Second)
+}
+
+// RegisterReplicationRoutes 设置库复制相关的路由
+func RegisterReplicationRoutes(r *gin.Engine, replication *service.ReplicationService, access *service.LibraryAccess) {
+	handler := NewReplicationHandler(replication, access)
+
+	replicationGroup := r.Group("/api/v1/replication")
+	{
+		// 主服务器端
+		replicationGroup.GET("/libraries/:libraryId/commits", handler.CommitFeedHandler)         // 提交日志
+		replicationGroup.GET("/libraries/:libraryId/blocks/:hash", handler.DownloadBlockHandler) // 下载块
+
+		// 副本端
+		replicationGroup.PUT("/libraries/:libraryId", handler.ConfigureHandler)        // 配置副本
+		replicationGroup.DELETE("/libraries/:libraryId", handler.RemoveHandler)        // 删除复制配置
+		replicationGroup.GET("/libraries/:libraryId/status", handler.StatusHandler)    // 复制状态
+		replicationGroup.POST("/libraries/:libraryId/sync", handler.SyncHandler)       // 立即复制
+		replicationGroup.POST("/libraries/:libraryId/promote", handler.PromoteHandler) // 提升为主库
+		replicationGroup.GET("/status", handler.ListStatusHandler)                     // 所有副本状态
+		replicationGroup.GET("/metrics", handler.MetricsHandler)                       // 延迟指标
+	}
+}
@@ -0,0 +1,109 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sealock/core-storage/api"
+	"github.com/sealock/core-storage/model"
+	"github.com/sealock/core-storage/service"
+)
+
+// RetentionHandler 处理库的快照保留策略
+type RetentionHandler struct {
+	retention *service.RetentionService
+}
+
+// NewRetentionHandler 创建新的RetentionHandler实例
+func NewRetentionHandler(retention *service.RetentionService) *RetentionHandler {
+	return &RetentionHandler{retention: retention}
+}
+
+// GetPolicyHandler 返回库的保留策略，未配置时返回默认策略
+// GET /libraries/{libraryId}/retention
+func (h *RetentionHandler) GetPolicyHandler(c *gin.Context) {
+	libraryID, ok := libraryIDParam(c)
+	if !ok {
+		return
+	}
+	policy, err := h.retention.GetPolicy(c.Request.Context(), libraryID)
+	if err != nil {
+		writeError(c, http.StatusInternalServerError, "获取保留策略失败")
+		return
+	}
+	configured := policy != nil
+	if policy == nil {
+		policy = model.DefaultRetentionPolicy(libraryID)
+	}
+	c.JSON(http.StatusOK, retentionPolicyJSON(policy, configured))
+}
+
+// SetPolicyHandler 设置库的保留策略，下一次定期清理时生效
+// PUT /libraries/{libraryId}/retention
+// 请求体:
+// {
+//   "keepLast": 10,
+//   "keepDaily": 7,
+//   "keepTagged": true,      // 可选，默认为 true
+//   "maxAgeSeconds": 0
+// }
+func (h *RetentionHandler) SetPolicyHandler(c *gin.Context) {
+	libraryID, ok := libraryIDParam(c)
+	if !ok {
+		return
+	}
+	var req api.SetRetentionPolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeError(c, http.StatusBadRequest, "无效的请求格式")
+		return
+	}
+
+	policy := model.DefaultRetentionPolicy(libraryID)
+	policy.KeepLast = req.KeepLast
+	policy.KeepHourly = req.KeepHourly
+	policy.KeepDaily = req.KeepDaily
+	policy.KeepWeekly = req.KeepWeekly
+	policy.KeepMonthly = req.KeepMonthly
+	if req.KeepTagged != nil {
+		policy.KeepTagged = *req.KeepTagged
+	}
+	policy.MaxAge = time.Duration(req.MaxAgeSeconds) * time.Second
+
+	if err := h.retention.SetPolicy(c.Request.Context(), policy); err != nil {
+		if errors.Is(err, service.ErrInvalidRetentionPolicy) {
+			writeError(c, http.StatusBadRequest, "保留策略的数量和时长不能为负数")
+			return
+		}
+		writeError(c, http.StatusInternalServerError, "保存保留策略失败")
+		return
+	}
+	c.JSON(http.StatusOK, retentionPolicyJSON(policy, true))
+}
+
+// retentionPolicyJSON 将保留策略转换为响应结构
+func retentionPolicyJSON(policy *model.RetentionPolicy, configured bool) api.RetentionPolicy {
+	return api.RetentionPolicy{
+		LibraryID:     policy.LibraryID,
+		Configured:    configured,
+		KeepLast:      policy.KeepLast,
+		KeepHourly:    policy.KeepHourly,
+		KeepDaily:     policy.KeepDaily,
+		KeepWeekly:    policy.KeepWeekly,
+		KeepMonthly:   policy.KeepMonthly,
+		KeepTagged:    policy.KeepTagged,
+		MaxAgeSeconds: int64(policy.MaxAge / time.Second),
+	}
+}
+
+// RegisterRetentionRoutes 设置快照保留策略相关的路由
+func RegisterRetentionRoutes(r *gin.Engine, retention *service.RetentionService) {
+	handler := NewRetentionHandler(retention)
+
+	libraryGroup := r.Group("/api/v1/libraries")
+	{
+		libraryGroup.GET("/:libraryId/retention", handler.GetPolicyHandler) // 获取保留策略
+		libraryGroup.PUT("/:libraryId/retention", handler.SetPolicyHandler) // 设置保留策略
+	}
+}
@@ -0,0 +1,811 @@
+package handler
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sealock/core-storage/middleware"
+	"github.com/sealock/core-storage/service"
+)
+
+const (
+	// s3Prefix S3 网关的挂载路径，客户端以 path-style 访问 {s3Prefix}/{桶}/{键}
+	s3Prefix = "/s3"
+	// s3Namespace S3 响应的 XML 命名空间
+	s3Namespace = "http://s3.amazonaws.com/doc/2006-03-01/"
+	// s3MaxKeys ListObjectsV2 的默认及最大返回数量
+	s3MaxKeys = 1000
+	// s3TimeFormat S3 响应中的时间格式
+	s3TimeFormat = "2006-01-02T15:04:05.000Z"
+	// s3MaxXMLBody DeleteObjects、CompleteMultipartUpload 等 XML 请求体的大小上限
+	s3MaxXMLBody = 4 << 20
+)
+
+// S3Handler 以 S3 兼容的 API 提供用户的库：桶名为库名，对象键为库内文件路径
+// 支持 ListBuckets、HeadBucket、GetBucketLocation、ListObjectsV2、Get/Put/Head/DeleteObject、
+// DeleteObjects 和分段上传；对象的 ETag 为文件内容哈希，分段的 ETag 为该段的 MD5
+type S3Handler struct {
+	gateway *service.S3Gateway
+}
+
+// NewS3Handler 创建新的S3Handler实例
+func NewS3Handler(gateway *service.S3Gateway) *S3Handler {
+	return &S3Handler{gateway: gateway}
+}
+
+// s3ErrorResponse S3 错误响应
+type s3ErrorResponse struct {
+	XMLName  xml.Name `xml:"Error"`
+	Code     string   `xml:"Code"`
+	Message  string   `xml:"Message"`
+	Resource string   `xml:"Resource,omitempty"`
+}
+
+// s3Bucket ListBuckets 响应中的一个桶
+type s3Bucket struct {
+	Name         string `xml:"Name"`
+	CreationDate string `xml:"CreationDate"`
+}
+
+// s3ListBucketsResult ListBuckets 响应
+type s3ListBucketsResult struct {
+	XMLName xml.Name   `xml:"ListAllMyBucketsResult"`
+	Xmlns   string     `xml:"xmlns,attr"`
+	Owner   s3Owner    `xml:"Owner"`
+	Buckets []s3Bucket `xml:"Buckets>Bucket"`
+}
+
+// s3Owner 桶和对象的所有者
+type s3Owner struct {
+	ID          string `xml:"ID"`
+	DisplayName string `xml:"DisplayName"`
+}
+
+// s3Object ListObjectsV2 响应中的一个对象
+type s3Object struct {
+	Key          string `xml:"Key"`
+	LastModified string `xml:"LastModified"`
+	ETag         string `xml:"ETag"`
+	Size         int64  `xml:"Size"`
+	StorageClass string `xml:"StorageClass"`
+}
+
+// s3CommonPrefix ListObjectsV2 响应中的一个公共前缀
+type s3CommonPrefix struct {
+	Prefix string `xml:"Prefix"`
+}
+
+// s3ListObjectsResult ListObjectsV2 响应
+type s3ListObjectsResult struct {
+	XMLName               xml.Name         `xml:"ListBucketResult"`
+	Xmlns                 string           `xml:"xmlns,attr"`
+	Name                  string           `xml:"Name"`
+	Prefix                string           `xml:"Prefix"`
+	Delimiter             string           `xml:"Delimiter,omitempty"`
+	StartAfter            string           `xml:"StartAfter,omitempty"`
+	ContinuationToken     string           `xml:"ContinuationToken,omitempty"`
+	NextContinuationToken string           `xml:"NextContinuationToken,omitempty"`
+	EncodingType          string           `xml:"EncodingType,omitempty"`
+	MaxKeys               int              `xml:"MaxKeys"`
+	KeyCount              int              `xml:"KeyCount"`
+	IsTruncated           bool             `xml:"IsTruncated"`
+	Contents              []s3Object       `xml:"Contents"`
+	CommonPrefixes        []s3CommonPrefix `xml:"CommonPrefixes"`
+}
+
+// s3InitiateMultipartUploadResult CreateMultipartUpload 响应
+type s3InitiateMultipartUploadResult struct {
+	XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+	Xmlns    string   `xml:"xmlns,attr"`
+	Bucket   string   `xml:"Bucket"`
+	Key      string   `xml:"Key"`
+	UploadID string   `xml:"UploadId"`
+}
+
+// s3CompleteMultipartUpload CompleteMultipartUpload 请求体
+type s3CompleteMultipartUpload struct {
+	Parts []struct {
+		PartNumber int    `xml:"PartNumber"`
+		ETag       string `xml:"ETag"`
+	} `xml:"Part"`
+}
+
+// s3CompleteMultipartUploadResult CompleteMultipartUpload 响应
+type s3CompleteMultipartUploadResult struct {
+	XMLName  xml.Name `xml:"CompleteMultipartUploadResult"`
+	Xmlns    string   `xml:"xmlns,attr"`
+	Location string   `xml:"Location"`
+	Bucket   string   `xml:"Bucket"`
+	Key      string   `xml:"Key"`
+	ETag     string   `xml:"ETag"`
+}
+
+// s3Part ListParts 响应中的一段
+type s3Part struct {
+	PartNumber   int    `xml:"PartNumber"`
+	LastModified string `xml:"LastModified"`
+	ETag         string `xml:"ETag"`
+	Size         int64  `xml:"Size"`
+}
+
+// s3ListPartsResult ListParts 响应
+type s3ListPartsResult struct {
+	XMLName     xml.Name `xml:"ListPartsResult"`
+	Xmlns       string   `xml:"xmlns,attr"`
+	Bucket      string   `xml:"Bucket"`
+	Key         string   `xml:"Key"`
+	UploadID    string   `xml:"UploadId"`
+	IsTruncated bool     `xml:"IsTruncated"`
+	Parts       []s3Part `xml:"Part"`
+}
+
+// s3Delete DeleteObjects 请求体
+type s3Delete struct {
+	Quiet   bool `xml:"Quiet"`
+	Objects []struct {
+		Key string `xml:"Key"`
+	} `xml:"Object"`
+}
+
+// s3DeleteResult DeleteObjects 响应
+type s3DeleteResult struct {
+	XMLName xml.Name        `xml:"DeleteResult"`
+	Xmlns   string          `xml:"xmlns,attr"`
+	Deleted []s3Deleted     `xml:"Deleted"`
+	Errors  []s3DeleteError `xml:"Error"`
+}
+
+// s3Deleted DeleteObjects 响应中删除成功的对象
+type s3Deleted struct {
+	Key string `xml:"Key"`
+}
+
+// s3DeleteError DeleteObjects 响应中删除失败的对象
+type s3DeleteError struct {
+	Key     string `xml:"Key"`
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+// ServeS3Handler 按路径和查询参数把请求分派到对应的 S3 操作
+// GET /s3/                                 ListBuckets
+// HEAD /s3/{桶}                            HeadBucket
+// GET /s3/{桶}?list-type=2&prefix=&delimiter=&max-keys=&continuation-token=&start-after=
+// GET /s3/{桶}?location                    GetBucketLocation
+// POST /s3/{桶}?delete                     DeleteObjects
+// GET|HEAD|PUT|DELETE /s3/{桶}/{键}        Get/Head/Put/DeleteObject
+// POST /s3/{桶}/{键}?uploads               CreateMultipartUpload
+// PUT /s3/{桶}/{键}?partNumber=&uploadId=  UploadPart
+// GET /s3/{桶}/{键}?uploadId=              ListParts
+// POST /s3/{桶}/{键}?uploadId=             CompleteMultipartUpload
+// DELETE /s3/{桶}/{键}?uploadId=           AbortMultipartUpload
+func (h *S3Handler) ServeS3Handler(c *gin.Context) {
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(c.Param("path"), "/"), "/")
+	query := c.Request.URL.Query()
+	method := c.Request.Method
+
+	switch {
+	case bucket == "":
+		if method != http.MethodGet {
+			h.fail(c, http.StatusMethodNotAllowed, "MethodNotAllowed", "不支持的操作")
+			return
+		}
+		h.listBuckets(c)
+
+	case key == "":
+		switch {
+		case method == http.MethodHead:
+			h.headBucket(c, bucket)
+		case method == http.MethodGet && query.Has("location"):
+			h.getBucketLocation(c, bucket)
+		case method == http.MethodGet && query.Has("uploads"):
+			h.fail(c, http.StatusNotImplemented, "NotImplemented", "不支持列出进行中的分段上传")
+		case method == http.MethodGet:
+			h.listObjects(c, bucket)
+		case method == http.MethodPost && query.Has("delete"):
+			h.deleteObjects(c, bucket)
+		default:
+			// 桶即库，通过库管理接口创建和删除
+			h.fail(c, http.StatusNotImplemented, "NotImplemented", "不支持的桶操作，请通过库管理接口创建或删除库")
+		}
+
+	default:
+		switch {
+		case method == http.MethodPost && query.Has("uploads"):
+			h.createMultipartUpload(c, bucket, key)
+		case method == http.MethodPut && query.Has("uploadId"):
+			h.uploadPart(c, bucket, key, query.Get("uploadId"), query.Get("partNumber"))
+		case method == http.MethodGet && query.Has("uploadId"):
+			h.listParts(c, bucket, key, query.Get("uploadId"))
+		case method == http.MethodPost && query.Has("uploadId"):
+			h.completeMultipartUpload(c, bucket, key, query.Get("uploadId"))
+		case method == http.MethodDelete && query.Has("uploadId"):
+			h.abortMultipartUpload(c, bucket, key, query.Get("uploadId"))
+		case method == http.MethodPut && c.GetHeader("X-Amz-Copy-Source") != "":
+			h.fail(c, http.StatusNotImplemented, "NotImplemented", "不支持复制对象")
+		case method == http.MethodPut:
+			h.putObject(c, bucket, key)
+		case method == http.MethodGet || method == http.MethodHead:
+			h.getObject(c, bucket, key)
+		case method == http.MethodDelete:
+			h.deleteObject(c, bucket, key)
+		default:
+			h.fail(c, http.StatusMethodNotAllowed, "MethodNotAllowed", "不支持的操作")
+		}
+	}
+}
+
+// listBuckets 列出当前用户的库
+func (h *S3Handler) listBuckets(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	libs, err := h.gateway.Buckets(c.Request.Context(), userID)
+	if err != nil {
+		h.serviceError(c, err)
+		return
+	}
+
+	owner := strconv.FormatUint(uint64(userID), 10)
+	result := s3ListBucketsResult{Xmlns: s3Namespace, Owner: s3Owner{ID: owner, DisplayName: owner}, Buckets: []s3Bucket{}}
+	for _, lib := range libs {
+		result.Buckets = append(result.Buckets, s3Bucket{Name: lib.Name, CreationDate: s3Time(lib.CreatedAt)})
+	}
+	h.xml(c, http.StatusOK, result)
+}
+
+// headBucket 确认桶存在
+func (h *S3Handler) headBucket(c *gin.Context, bucket string) {
+	if _, err := h.gateway.Bucket(c.Request.Context(), c.GetUint("user_id"), bucket); err != nil {
+		h.serviceError(c, err)
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+// getBucketLocation 返回桶所在区域，始终为默认区域
+func (h *S3Handler) getBucketLocation(c *gin.Context, bucket string) {
+	if _, err := h.gateway.Bucket(c.Request.Context(), c.GetUint("user_id"), bucket); err != nil {
+		h.serviceError(c, err)
+		return
+	}
+	h.xml(c, http.StatusOK, struct {
+		XMLName xml.Name `xml:"LocationConstraint"`
+		Xmlns   string   `xml:"xmlns,attr"`
+	}{Xmlns: s3Namespace})
+}
+
+// listObjects ListObjectsV2：续页标记为上一页最后一个键的 base64 编码
+func (h *S3Handler) listObjects(c *gin.Context, bucket string) {
+	lib, err := h.gateway.Bucket(c.Request.Context(), c.GetUint("user_id"), bucket)
+	if err != nil {
+		h.serviceError(c, err)
+		return
+	}
+
+	maxKeys := s3MaxKeys
+	if raw := c.Query("max-keys"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 {
+			h.fail(c, http.StatusBadRequest, "InvalidArgument", "无效的 max-keys 参数")
+			return
+		}
+		maxKeys = min(n, s3MaxKeys)
+	}
+	prefix, delimiter := c.Query("prefix"), c.Query("delimiter")
+	token, startAfter := c.Query("continuation-token"), c.Query("start-after")
+	after := startAfter
+	if token != "" {
+		decoded, err := base64.RawURLEncoding.DecodeString(token)
+		if err != nil {
+			h.fail(c, http.StatusBadRequest, "InvalidArgument", "无效的 continuation-token 参数")
+			return
+		}
+		after = string(decoded)
+	}
+
+	listing, err := h.gateway.ListObjects(c.Request.Context(), lib.ID, prefix, delimiter, after, maxKeys)
+	if err != nil {
+		h.serviceError(c, err)
+		return
+	}
+
+	// encoding-type=url 时对键和前缀进行 URL 编码，客户端会解码
+	encode := func(s string) string { return s }
+	encodingType := c.Query("encoding-type")
+	if encodingType == "url" {
+		encode = url.QueryEscape
+	}
+	result := s3ListObjectsResult{
+		Xmlns:             s3Namespace,
+		Name:              bucket,
+		Prefix:            encode(prefix),
+		Delimiter:         encode(delimiter),
+		StartAfter:        encode(startAfter),
+		ContinuationToken: token,
+		EncodingType:      encodingType,
+		MaxKeys:           maxKeys,
+		KeyCount:          len(listing.Objects) + len(listing.CommonPrefixes),
+		IsTruncated:       listing.Truncated,
+	}
+	if listing.Truncated {
+		result.NextContinuationToken = base64.RawURLEncoding.EncodeToString([]byte(listing.NextAfter))
+	}
+	for _, file := range listing.Objects {
+		result.Contents = append(result.Contents, s3Object{
+			Key:          encode(file.Name),
+			LastModified: s3Time(file.UpdatedAt),
+			ETag:         s3ETag(file.Hash),
+			Size:         file.Size,
+			StorageClass: "STANDARD",
+		})
+	}
+	for _, p := range listing.CommonPrefixes {
+		result.CommonPrefixes = append(result.CommonPrefixes, s3CommonPrefix{Prefix: encode(p)})
+	}
+	h.xml(c, http.StatusOK, result)
+}
+
+// getObject GetObject/HeadObject，支持 Range 和条件请求
+func (h *S3Handler) getObject(c *gin.Context, bucket, key string) {
+	lib, err := h.gateway.Bucket(c.Request.Context(), c.GetUint("user_id"), bucket)
+	if err != nil {
+		h.serviceError(c, err)
+		return
+	}
+	reader, file, err := h.gateway.OpenObject(c.Request.Context(), lib.ID, key)
+	if err != nil {
+		h.serviceError(c, err)
+		return
+	}
+	if file == nil {
+		h.fail(c, http.StatusNotFound, "NoSuchKey", "对象不存在")
+		return
+	}
+	defer reader.Close()
+
+	c.Header("ETag", s3ETag(file.Hash))
+	http.ServeContent(c.Writer, c.Request, file.Name, file.UpdatedAt, reader)
+}
+
+// putObject PutObject：内容流式写入块存储，与其他上传方式一样分块去重
+func (h *S3Handler) putObject(c *gin.Context, bucket, key string) {
+	userID := c.GetUint("user_id")
+	lib, err := h.gateway.WritableBucket(c.Request.Context(), userID, bucket)
+	if err != nil {
+		h.serviceError(c, err)
+		return
+	}
+	body, size, err := s3Body(c)
+	if err != nil {
+		h.fail(c, http.StatusBadRequest, "InvalidArgument", "无效的 x-amz-decoded-content-length")
+		return
+	}
+
+	// 目录由文件路径隐含，客户端创建的目录占位对象无需保存
+	if strings.HasSuffix(key, "/") {
+		if _, err := io.Copy(io.Discard, body); err != nil {
+			h.bodyError(c, err)
+			return
+		}
+		c.Status(http.StatusOK)
+		return
+	}
+
+	file, err := h.gateway.PutObject(c.Request.Context(), lib, userID, key, body, size)
+	if err != nil {
+		h.serviceError(c, err)
+		return
+	}
+	c.Header("ETag", s3ETag(file.Hash))
+	c.Status(http.StatusOK)
+}
+
+// deleteObject DeleteObject，对象不存在时同样返回成功
+func (h *S3Handler) deleteObject(c *gin.Context, bucket, key string) {
+	lib, err := h.gateway.WritableBucket(c.Request.Context(), c.GetUint("user_id"), bucket)
+	if err != nil {
+		h.serviceError(c, err)
+		return
+	}
+	if err := h.gateway.DeleteObject(c.Request.Context(), lib, key); err != nil {
+		h.serviceError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// deleteObjects DeleteObjects：批量删除对象，每个对象单独报告结果
+func (h *S3Handler) deleteObjects(c *gin.Context, bucket string) {
+	lib, err := h.gateway.WritableBucket(c.Request.Context(), c.GetUint("user_id"), bucket)
+	if err != nil {
+		h.serviceError(c, err)
+		return
+	}
+	var req s3Delete
+	if !h.readXML(c, &req) {
+		return
+	}
+
+	result := s3DeleteResult{Xmlns: s3Namespace}
+	for _, object := range req.Objects {
+		if err := h.gateway.DeleteObject(c.Request.Context(), lib, object.Key); err != nil {
+			result.Errors = append(result.Errors, s3DeleteError{Key: object.Key, Code: "InternalError", Message: err.Error()})
+			continue
+		}
+		if !req.Quiet {
+			result.Deleted = append(result.Deleted, s3Deleted{Key: object.Key})
+		}
+	}
+	h.xml(c, http.StatusOK, result)
+}
+
+// createMultipartUpload CreateMultipartUpload
+func (h *S3Handler) createMultipartUpload(c *gin.Context, bucket, key string) {
+	userID := c.GetUint("user_id")
+	lib, err := h.gateway.WritableBucket(c.Request.Context(), userID, bucket)
+	if err != nil {
+		h.serviceError(c, err)
+		return
+	}
+	upload, err := h.gateway.CreateMultipartUpload(c.Request.Context(), lib, userID, key)
+	if err != nil {
+		h.serviceError(c, err)
+		return
+	}
+	h.xml(c, http.StatusOK, s3InitiateMultipartUploadResult{Xmlns: s3Namespace, Bucket: bucket, Key: key, UploadID: upload.ID})
+}
+
+// uploadPart UploadPart：请求带 Content-MD5 时校验段内容
+func (h *S3Handler) uploadPart(c *gin.Context, bucket, key, uploadID, partNumber string) {
+	upload, ok := h.multipartUpload(c, bucket, key, uploadID)
+	if !ok {
+		return
+	}
+	number, err := strconv.Atoi(partNumber)
+	if err != nil {
+		h.fail(c, http.StatusBadRequest, "InvalidArgument", "无效的 partNumber 参数")
+		return
+	}
+	var contentMD5 []byte
+	if raw := c.GetHeader("Content-MD5"); raw != "" {
+		if contentMD5, err = base64.StdEncoding.DecodeString(raw); err != nil {
+			h.fail(c, http.StatusBadRequest, "InvalidDigest", "无效的 Content-MD5")
+			return
+		}
+	}
+	body, size, err := s3Body(c)
+	if err != nil {
+		h.fail(c, http.StatusBadRequest, "InvalidArgument", "无效的 x-amz-decoded-content-length")
+		return
+	}
+
+	part, err := h.gateway.UploadPart(c.Request.Context(), upload, number, body, size, contentMD5)
+	if err != nil {
+		h.serviceError(c, err)
+		return
+	}
+	c.Header("ETag", s3ETag(part.ETag))
+	c.Status(http.StatusOK)
+}
+
+// listParts ListParts：一次返回全部已上传的段
+func (h *S3Handler) listParts(c *gin.Context, bucket, key, uploadID string) {
+	upload, ok := h.multipartUpload(c, bucket, key, uploadID)
+	if !ok {
+		return
+	}
+	parts, err := h.gateway.ListParts(c.Request.Context(), upload)
+	if err != nil {
+		h.serviceError(c, err)
+		return
+	}
+
+	result := s3ListPartsResult{Xmlns: s3Namespace, Bucket: bucket, Key: key, UploadID: upload.ID}
+	for _, part := range parts {
+		result.Parts = append(result.Parts, s3Part{
+			PartNumber:   part.Number,
+			LastModified: s3Time(part.UploadedAt),
+			ETag:         s3ETag(part.ETag),
+			Size:         part.Size,
+		})
+	}
+	h.xml(c, http.StatusOK, result)
+}
+
+// completeMultipartUpload CompleteMultipartUpload：按请求体中的段列表拼接内容创建对象
+func (h *S3Handler) completeMultipartUpload(c *gin.Context, bucket, key, uploadID string) {
+	upload, ok := h.multipartUpload(c, bucket, key, uploadID)
+	if !ok {
+		return
+	}
+	var req s3CompleteMultipartUpload
+	if !h.readXML(c, &req) {
+		return
+	}
+	parts := make([]service.CompletedPart, 0, len(req.Parts))
+	for _, part := range req.Parts {
+		parts = append(parts, service.CompletedPart{Number: part.PartNumber, ETag: strings.Trim(part.ETag, `"`)})
+	}
+
+	file, err := h.gateway.CompleteMultipartUpload(c.Request.Context(), upload, parts)
+	if err != nil {
+		h.serviceError(c, err)
+		return
+	}
+	h.xml(c, http.StatusOK, s3CompleteMultipartUploadResult{
+		Xmlns:    s3Namespace,
+		Location: s3Prefix + "/" + bucket + "/" + file.Name,
+		Bucket:   bucket,
+		Key:      key,
+		ETag:     s3ETag(file.Hash),
+	})
+}
+
+// abortMultipartUpload AbortMultipartUpload
+func (h *S3Handler) abortMultipartUpload(c *gin.Context, bucket, key, uploadID string) {
+	upload, ok := h.multipartUpload(c, bucket, key, uploadID)
+	if !ok {
+		return
+	}
+	if err := h.gateway.AbortMultipartUpload(c.Request.Context(), upload); err != nil {
+		h.serviceError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// multipartUpload 查找可写桶中对象的分段上传，失败时直接写入错误响应
+func (h *S3Handler) multipartUpload(c *gin.Context, bucket, key, uploadID string) (*service.MultipartUpload, bool) {
+	lib, err := h.gateway.WritableBucket(c.Request.Context(), c.GetUint("user_id"), bucket)
+	if err != nil {
+		h.serviceError(c, err)
+		return nil, false
+	}
+	upload, err := h.gateway.MultipartUpload(c.Request.Context(), lib, key, uploadID)
+	if err != nil {
+		h.serviceError(c, err)
+		return nil, false
+	}
+	return upload, true
+}
+
+// serviceError 把服务层错误转换为 S3 错误响应
+func (h *S3Handler) serviceError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrNoSuchBucket):
+		h.fail(c, http.StatusNotFound, "NoSuchBucket", "存储桶不存在")
+	case errors.Is(err, service.ErrBucketReadOnly), errors.Is(err, service.ErrReadOnlyReplica):
+		h.fail(c, http.StatusForbidden, "AccessDenied", "该库是只读副本")
+	case errors.Is(err, service.ErrNoSuchUpload):
+		h.fail(c, http.StatusNotFound, "NoSuchUpload", "分段上传不存在")
+	case errors.Is(err, service.ErrInvalidPart):
+		h.fail(c, http.StatusBadRequest, "InvalidPart", "分段不存在或 ETag 不一致")
+	case errors.Is(err, service.ErrInvalidPartOrder):
+		h.fail(c, http.StatusBadRequest, "InvalidPartOrder", "分段必须按段号升序排列")
+	case errors.Is(err, service.ErrPartDigestMismatch):
+		h.fail(c, http.StatusBadRequest, "BadDigest", "内容与 Content-MD5 不一致")
+	case errors.Is(err, service.ErrUploadSizeMismatch):
+		h.fail(c, http.StatusBadRequest, "IncompleteBody", "请求体长度与声明的长度不一致")
+	case errors.Is(err, service.ErrQuotaExceeded):
+		h.fail(c, http.StatusForbidden, "QuotaExceeded", "超出存储配额")
+	case errors.Is(err, service.ErrInvalidPath):
+		h.fail(c, http.StatusBadRequest, "InvalidArgument", "无效的对象键")
+	case errors.Is(err, middleware.ErrS3SignatureMismatch), errors.Is(err, middleware.ErrS3ContentSHA256Mismatch):
+		h.bodyError(c, err)
+	default:
+		h.fail(c, http.StatusInternalServerError, "InternalError", "服务器内部错误")
+	}
+}
+
+// bodyError 把读取请求体的错误转换为 S3 错误响应
+func (h *S3Handler) bodyError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, middleware.ErrS3SignatureMismatch):
+		h.fail(c, http.StatusForbidden, "SignatureDoesNotMatch", "请求体分块的签名与计算结果不一致")
+	case errors.Is(err, middleware.ErrS3ContentSHA256Mismatch):
+		h.fail(c, http.StatusBadRequest, "XAmzContentSHA256Mismatch", "请求体与 x-amz-content-sha256 不一致")
+	default:
+		h.fail(c, http.StatusBadRequest, "IncompleteBody", "读取请求体失败")
+	}
+}
+
+// readXML 读取完整的请求体并解析 XML，失败时直接写入错误响应
+// 读完整个请求体才能校验签名中声明的内容哈希
+func (h *S3Handler) readXML(c *gin.Context, v interface{}) bool {
+	body, _, err := s3Body(c)
+	if err != nil {
+		h.fail(c, http.StatusBadRequest, "InvalidArgument", "无效的 x-amz-decoded-content-length")
+		return false
+	}
+	data, err := io.ReadAll(io.LimitReader(body, s3MaxXMLBody+1))
+	if err != nil {
+		h.bodyError(c, err)
+		return false
+	}
+	if len(data) > s3MaxXMLBody {
+		h.fail(c, http.StatusBadRequest, "MaxMessageLengthExceeded", "请求体过大")
+		return false
+	}
+	if err := xml.Unmarshal(data, v); err != nil {
+		h.fail(c, http.StatusBadRequest, "MalformedXML", "无效的请求格式")
+		return false
+	}
+	return true
+}
+
+// fail 写入 S3 错误响应
+func (h *S3Handler) fail(c *gin.Context, status int, code, message string) {
+	h.xml(c, status, s3ErrorResponse{Code: code, Message: message, Resource: c.Request.URL.Path})
+}
+
+// xml 写入 XML 响应
+func (h *S3Handler) xml(c *gin.Context, status int, body interface{}) {
+	data, err := xml.Marshal(body)
+	if err != nil {
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	c.Data(status, "application/xml", append([]byte(xml.Header), data...))
+}
+
+// s3ETag 以 S3 的格式（带引号）返回 ETag
+func s3ETag(hash string) string {
+	return `"` + hash + `"`
+}
+
+// s3Time 以 S3 的格式返回时间
+func s3Time(t time.Time) string {
+	return t.UTC().Format(s3TimeFormat)
+}
+
+// s3Body 返回请求体及其长度（未知时为 -1）
+// SDK 以 aws-chunked 编码流式上传时，去掉分块头，长度取 x-amz-decoded-content-length；
+// 请求以 STREAMING-AWS4-HMAC-SHA256-PAYLOAD 签名时逐块校验签名。
+// 是否按 aws-chunked 解码只看签名中的 x-amz-content-sha256，未签名的 Content-Encoding 不能改变请求体的解释
+func s3Body(c *gin.Context) (io.Reader, int64, error) {
+	r := c.Request
+	if !middleware.S3ChunkedPayload(c) {
+		return r.Body, r.ContentLength, nil
+	}
+	signer := middleware.S3ChunkSignerFrom(c)
+	size := int64(-1)
+	if raw := r.Header.Get("X-Amz-Decoded-Content-Length"); raw != "" {
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || n < 0 {
+			return nil, 0, fmt.Errorf("invalid x-amz-decoded-content-length: %q", raw)
+		}
+		size = n
+	} else if signer != nil {
+		// 长度用于发现被截断的请求体，签名的分块上传必须声明
+		return nil, 0, errors.New("missing x-amz-decoded-content-length")
+	}
+	return &awsChunkedReader{r: bufio.NewReader(r.Body), signer: signer, hash: sha256.New()}, size, nil
+}
+
+// errAWSChunkedTrailingData aws-chunked 请求体的结束块之后还有数据
+var errAWSChunkedTrailingData = errors.New("unexpected data after the final aws-chunked chunk")
+
+// awsChunkedReader 解码 aws-chunked 编码的请求体
+// 每块为 "<十六进制长度>[;chunk-signature=...]\r\n<数据>\r\n"，以长度为 0 的块结束，其后可带校验和尾部。
+// signer 不为 nil 时每块读完即校验签名，不一致时返回 middleware.ErrS3SignatureMismatch，写入在提交前失败；
+// 读到结束块时读完请求体的剩余部分，尾部之后还有数据时返回错误。尾部校验和不做验证
+type awsChunkedReader struct {
+	r         *bufio.Reader
+	signer    *middleware.S3ChunkSigner
+	hash      hash.Hash // 当前块数据的 SHA-256
+	signature string    // 当前块的签名
+	remaining int64     // 当前块尚未读取的字节数
+	done      bool
+}
+
+// Read 读取解码后的数据
+func (a *awsChunkedReader) Read(p []byte) (int, error) {
+	if a.done {
+		return 0, io.EOF
+	}
+	if a.remaining == 0 {
+		line, err := a.r.ReadString('\n')
+		if err != nil {
+			return 0, io.ErrUnexpectedEOF
+		}
+		sizeField, extension, _ := strings.Cut(strings.TrimSpace(line), ";")
+		size, err := strconv.ParseInt(sizeField, 16, 64)
+		if err != nil || size < 0 {
+			return 0, fmt.Errorf("invalid aws-chunked chunk header %q", line)
+		}
+		a.signature = strings.TrimPrefix(extension, "chunk-signature=")
+		a.hash.Reset()
+		if size == 0 {
+			if err := a.verify(); err != nil {
+				return 0, err
+			}
+			if err := a.finish(); err != nil {
+				return 0, err
+			}
+			a.done = true
+			return 0, io.EOF
+		}
+		a.remaining = size
+	}
+
+	if int64(len(p)) > a.remaining {
+		p = p[:a.remaining]
+	}
+	n, err := a.r.Read(p)
+	a.hash.Write(p[:n])
+	a.remaining -= int64(n)
+	if a.remaining == 0 {
+		// 块数据之后的 \r\n
+		var crlf [2]byte
+		if _, err := io.ReadFull(a.r, crlf[:]); err != nil {
+			return n, io.ErrUnexpectedEOF
+		}
+		if string(crlf[:]) != "\r\n" {
+			return n, errors.New("invalid aws-chunked chunk terminator")
+		}
+		if err := a.verify(); err != nil {
+			return n, err
+		}
+	}
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+// finish 读完结束块之后的尾部：若干 "名称:值" 行和一个空行，尾部之后不能再有数据
+func (a *awsChunkedReader) finish() error {
+	for {
+		line, err := a.r.ReadString('\n')
+		if err == io.EOF && line == "" {
+			// 没有尾部，请求体在结束块后结束
+			return nil
+		}
+		if err != nil {
+			return io.ErrUnexpectedEOF
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			break
+		}
+		if !strings.Contains(line, ":") {
+			return errAWSChunkedTrailingData
+		}
+	}
+	if n, _ := io.Copy(io.Discard, a.r); n > 0 {
+		return errAWSChunkedTrailingData
+	}
+	return nil
+}
+
+// verify 校验刚读完的块的签名，请求未签名分块时不校验
+func (a *awsChunkedReader) verify() error {
+	if a.signer == nil {
+		return nil
+	}
+	return a.signer.Verify(a.hash.Sum(nil), a.signature)
+}
+
+// RegisterS3Routes 设置 S3 网关路由
+// 客户端以 path-style 访问，endpoint 设为 http(s)://{主机}/s3；access key 和 secret key 通过
+// POST /api/v1/s3/keys 创建，请求按 SigV4 签名（包括预签名 URL）
+func RegisterS3Routes(r *gin.Engine, gateway *service.S3Gateway, keys *service.S3KeyService) {
+	handler := NewS3Handler(gateway)
+
+	s3Group := r.Group(s3Prefix, middleware.S3Auth(keys))
+	for _, method := range []string{http.MethodGet, http.MethodHead, http.MethodPut, http.MethodPost, http.MethodDelete} {
+		s3Group.Handle(method, "", handler.ServeS3Handler)       // 桶列表
+		s3Group.Handle(method, "/*path", handler.ServeS3Handler) // 桶和对象
+	}
+}
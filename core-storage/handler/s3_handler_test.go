@@ -0,0 +1,265 @@
+package handler
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sealock/core-storage/chunker"
+	"github.com/sealock/core-storage/model"
+	"github.com/sealock/core-storage/service"
+	"github.com/sealock/core-storage/storage"
+)
+
+// signS3 按 SigV4 为请求添加 Authorization 头，x-amz-content-sha256 声明为 body 的哈希
+func signS3(req *http.Request, accessKey, secret, body string, when time.Time) {
+	amzDate := when.UTC().Format("20060102T150405Z")
+	sum := sha256.Sum256([]byte(body))
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(sum[:]))
+	scope := amzDate[:8] + "/us-east-1/s3/aws4_request"
+	canonical := strings.Join([]string{
+		req.Method, req.URL.EscapedPath(), testCanonicalQuery(req.URL.Query()),
+		"host:" + req.Host, "x-amz-content-sha256:" + hex.EncodeToString(sum[:]), "x-amz-date:" + amzDate, "",
+		"host;x-amz-content-sha256;x-amz-date", hex.EncodeToString(sum[:]),
+	}, "\n")
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+accessKey+"/"+scope+
+		", SignedHeaders=host;x-amz-content-sha256;x-amz-date, Signature="+testSignature(secret, amzDate, scope, canonical))
+}
+
+// presignS3 返回有效期为 expires 的预签名 GET URL
+func presignS3(target, accessKey, secret string, when time.Time, expires time.Duration) string {
+	u, _ := url.Parse(target)
+	amzDate := when.UTC().Format("20060102T150405Z")
+	scope := amzDate[:8] + "/us-east-1/s3/aws4_request"
+	query := url.Values{}
+	query.Set("X-Amz-Algorithm", "AWS4-HMAC-SHA256")
+	query.Set("X-Amz-Credential", accessKey+"/"+scope)
+	query.Set("X-Amz-Date", amzDate)
+	query.Set("X-Amz-Expires", strconv.Itoa(int(expires/time.Second)))
+	query.Set("X-Amz-SignedHeaders", "host")
+	canonical := strings.Join([]string{
+		http.MethodGet, u.EscapedPath(), testCanonicalQuery(query), "host:" + u.Host, "", "host", "UNSIGNED-PAYLOAD",
+	}, "\n")
+	query.Set("X-Amz-Signature", testSignature(secret, amzDate, scope, canonical))
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+func testCanonicalQuery(query url.Values) string {
+	pairs := make([]string, 0, len(query))
+	for name, values := range query {
+		for _, value := range values {
+			pairs = append(pairs, url.QueryEscape(name)+"="+strings.ReplaceAll(url.QueryEscape(value), "+", "%20"))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+func testSignature(secret, amzDate, scope, canonical string) string {
+	sum := sha256.Sum256([]byte(canonical))
+	return hex.EncodeToString(testHMAC(testSigningKey(secret, scope), strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, hex.EncodeToString(sum[:])}, "\n")))
+}
+
+func testSigningKey(secret, scope string) []byte {
+	key := []byte("AWS4" + secret)
+	for _, part := range strings.Split(scope, "/") {
+		key = testHMAC(key, part)
+	}
+	return key
+}
+
+func testHMAC(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// signS3Streaming 按 STREAMING-AWS4-HMAC-SHA256-PAYLOAD 签名请求，返回 aws-chunked 编码、逐块签名的请求体
+func signS3Streaming(req *http.Request, accessKey, secret string, chunks []string, when time.Time) string {
+	amzDate := when.UTC().Format("20060102T150405Z")
+	scope := amzDate[:8] + "/us-east-1/s3/aws4_request"
+	decoded := 0
+	for _, chunk := range chunks {
+		decoded += len(chunk)
+	}
+	const payload = "STREAMING-AWS4-HMAC-SHA256-PAYLOAD"
+	req.Header.Set("Content-Encoding", "aws-chunked")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payload)
+	req.Header.Set("X-Amz-Decoded-Content-Length", strconv.Itoa(decoded))
+	const signedHeaders = "content-encoding;host;x-amz-content-sha256;x-amz-date;x-amz-decoded-content-length"
+	canonical := strings.Join([]string{
+		req.Method, req.URL.EscapedPath(), testCanonicalQuery(req.URL.Query()),
+		"content-encoding:aws-chunked", "host:" + req.Host, "x-amz-content-sha256:" + payload, "x-amz-date:" + amzDate,
+		"x-amz-decoded-content-length:" + strconv.Itoa(decoded), "", signedHeaders, payload,
+	}, "\n")
+	signature := testSignature(secret, amzDate, scope, canonical)
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+accessKey+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+
+	key := testSigningKey(secret, scope)
+	empty := sha256.Sum256(nil)
+	var body strings.Builder
+	for _, chunk := range append(chunks, "") {
+		sum := sha256.Sum256([]byte(chunk))
+		signature = hex.EncodeToString(testHMAC(key, strings.Join([]string{
+			"AWS4-HMAC-SHA256-PAYLOAD", amzDate, scope, signature, hex.EncodeToString(empty[:]), hex.EncodeToString(sum[:]),
+		}, "\n")))
+		body.WriteString(strconv.FormatInt(int64(len(chunk)), 16) + ";chunk-signature=" + signature + "\r\n" + chunk + "\r\n")
+	}
+	return body.String()
+}
+
+func TestS3Auth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+	files := service.NewFileService(storage.NewLocalBlockStore(), storage.NewMockFileRepository(), storage.NewMockBlockRepository(),
+		chunker.NewFixedSizeChunker(4), storage.NewMockSnapshotRepository(), newTestRedis(t), true)
+	t.Cleanup(func() { files.Close(ctx) })
+	libraries := storage.NewMockLibraryRepository()
+	if err := libraries.CreateLibrary(ctx, &model.Library{Name: "docs", OwnerID: 1}); err != nil {
+		t.Fatalf("create library: %v", err)
+	}
+	keys := service.NewS3KeyService(storage.NewMockS3KeyRepository())
+	keys.SetSecretKey([]byte("test-key"))
+	key, secret, err := keys.CreateKey(ctx, 1, "test")
+	if err != nil {
+		t.Fatalf("create key: %v", err)
+	}
+
+	router := gin.New()
+	RegisterS3Routes(router, service.NewS3Gateway(files, libraries, nil), keys)
+	do := func(req *http.Request) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	put := func(body, signedBody, secret string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/s3/docs/notes.txt", strings.NewReader(body))
+		signS3(req, key.AccessKeyID, secret, signedBody, time.Now())
+		return do(req)
+	}
+	get := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/s3/docs/notes.txt", nil)
+		signS3(req, key.AccessKeyID, secret, "", time.Now())
+		return do(req)
+	}
+
+	if w := put("hello", "hello", secret); w.Code != http.StatusOK {
+		t.Fatalf("signed put: status %d: %s", w.Code, w.Body.String())
+	}
+	if w := get(); w.Code != http.StatusOK || w.Body.String() != "hello" {
+		t.Fatalf("signed get: status %d, body %q", w.Code, w.Body.String())
+	}
+
+	// 错误的 secret key、与签名不一致的请求体都被拒绝，对象保持不变
+	if w := put("evil", "evil", "wrong-secret"); w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), "SignatureDoesNotMatch") {
+		t.Fatalf("wrong secret: status %d: %s", w.Code, w.Body.String())
+	}
+	if w := put("evil", "hello", secret); w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "XAmzContentSHA256Mismatch") {
+		t.Fatalf("tampered body: status %d: %s", w.Code, w.Body.String())
+	}
+	if w := get(); w.Body.String() != "hello" {
+		t.Fatalf("object changed by a rejected put: %q", w.Body.String())
+	}
+
+	// 预签名 URL 只在 X-Amz-Expires 内有效
+	if w := do(httptest.NewRequest(http.MethodGet, presignS3("http://example.com/s3/docs/notes.txt", key.AccessKeyID, secret, time.Now(), time.Minute), nil)); w.Code != http.StatusOK {
+		t.Fatalf("presigned get: status %d: %s", w.Code, w.Body.String())
+	}
+	expired := presignS3("http://example.com/s3/docs/notes.txt", key.AccessKeyID, secret, time.Now().Add(-time.Hour), time.Minute)
+	if w := do(httptest.NewRequest(http.MethodGet, expired, nil)); w.Code != http.StatusForbidden {
+		t.Fatalf("expired presigned get: status %d", w.Code)
+	}
+
+	// 删除密钥后用它签名的请求被拒绝
+	if err := keys.DeleteKey(ctx, 1, key.AccessKeyID); err != nil {
+		t.Fatalf("delete key: %v", err)
+	}
+	if w := get(); w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), "InvalidAccessKeyId") {
+		t.Fatalf("deleted key: status %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestS3TamperedBody(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+	files := service.NewFileService(storage.NewLocalBlockStore(), storage.NewMockFileRepository(), storage.NewMockBlockRepository(),
+		chunker.NewFixedSizeChunker(4), storage.NewMockSnapshotRepository(), newTestRedis(t), true)
+	t.Cleanup(func() { files.Close(ctx) })
+	libraries := storage.NewMockLibraryRepository()
+	if err := libraries.CreateLibrary(ctx, &model.Library{Name: "docs", OwnerID: 1}); err != nil {
+		t.Fatalf("create library: %v", err)
+	}
+	keys := service.NewS3KeyService(storage.NewMockS3KeyRepository())
+	keys.SetSecretKey([]byte("test-key"))
+	key, secret, err := keys.CreateKey(ctx, 1, "test")
+	if err != nil {
+		t.Fatalf("create key: %v", err)
+	}
+
+	router := gin.New()
+	RegisterS3Routes(router, service.NewS3Gateway(files, libraries, nil), keys)
+	do := func(req *http.Request) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	streaming := func(chunks []string, edit func(string) string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/s3/docs/notes.txt", nil)
+		body := edit(signS3Streaming(req, key.AccessKeyID, secret, chunks, time.Now()))
+		req.Body = io.NopCloser(strings.NewReader(body))
+		req.ContentLength = int64(len(body))
+		return do(req)
+	}
+	object := func() string {
+		req := httptest.NewRequest(http.MethodGet, "/s3/docs/notes.txt", nil)
+		signS3(req, key.AccessKeyID, secret, "", time.Now())
+		return do(req).Body.String()
+	}
+	unchanged := func(s string) string { return s }
+
+	if w := streaming([]string{"hello ", "world"}, unchanged); w.Code != http.StatusOK {
+		t.Fatalf("streaming put: status %d: %s", w.Code, w.Body.String())
+	}
+	if got := object(); got != "hello world" {
+		t.Fatalf("object = %q", got)
+	}
+
+	// 修改某一块的数据：分块签名不一致
+	if w := streaming([]string{"hello ", "there"}, func(s string) string {
+		return strings.Replace(s, "there", "evil!", 1)
+	}); w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), "SignatureDoesNotMatch") {
+		t.Fatalf("tampered chunk: status %d: %s", w.Code, w.Body.String())
+	}
+
+	// 按内容哈希签名的请求体被改写为 aws-chunked 编码：未签名的 Content-Encoding 被拒绝，
+	// 也不能通过它让服务端按分块解码请求体
+	req := httptest.NewRequest(http.MethodPut, "/s3/docs/notes.txt", strings.NewReader("5\r\nevil!\r\n0\r\n\r\n"))
+	signS3(req, key.AccessKeyID, secret, "hello", time.Now())
+	req.Header.Set("Content-Encoding", "aws-chunked")
+	if w := do(req); w.Code != http.StatusForbidden {
+		t.Fatalf("unsigned content-encoding: status %d: %s", w.Code, w.Body.String())
+	}
+
+	// 结束块之后追加的数据
+	if w := streaming([]string{"evil"}, func(s string) string { return s + "appended" }); w.Code == http.StatusOK {
+		t.Fatalf("data after the final chunk accepted: %s", w.Body.String())
+	}
+	if got := object(); got != "hello world" {
+		t.Fatalf("object changed by a rejected put: %q", got)
+	}
+}
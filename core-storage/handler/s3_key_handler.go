@@ -0,0 +1,95 @@
+package handler
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sealock/core-storage/api"
+	"github.com/sealock/core-storage/model"
+	"github.com/sealock/core-storage/service"
+)
+
+// S3KeyHandler 管理当前用户的 S3 访问密钥
+type S3KeyHandler struct {
+	keys *service.S3KeyService
+}
+
+// NewS3KeyHandler 创建新的S3KeyHandler实例
+func NewS3KeyHandler(keys *service.S3KeyService) *S3KeyHandler {
+	return &S3KeyHandler{keys: keys}
+}
+
+// CreateKeyHandler 为当前用户创建访问密钥，secret key 只在响应中返回这一次
+// POST /s3/keys
+// 请求体（可选）:
+// {
+//   "description": "备份脚本"
+// }
+func (h *S3KeyHandler) CreateKeyHandler(c *gin.Context) {
+	var req api.CreateS3AccessKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		writeError(c, http.StatusBadRequest, "无效的请求格式")
+		return
+	}
+	key, secret, err := h.keys.CreateKey(c.Request.Context(), c.GetUint("user_id"), req.Description)
+	if err != nil {
+		writeError(c, http.StatusInternalServerError, "创建访问密钥失败")
+		return
+	}
+	resp := s3KeyJSON(key)
+	resp.SecretKey = secret
+	c.JSON(http.StatusCreated, resp)
+}
+
+// ListKeysHandler 列出当前用户的访问密钥（不含 secret key）
+// GET /s3/keys
+func (h *S3KeyHandler) ListKeysHandler(c *gin.Context) {
+	keys, err := h.keys.ListKeys(c.Request.Context(), c.GetUint("user_id"))
+	if err != nil {
+		writeError(c, http.StatusInternalServerError, "获取访问密钥失败")
+		return
+	}
+	list := api.S3AccessKeyList{Keys: make([]api.S3AccessKey, 0, len(keys))}
+	for i := range keys {
+		list.Keys = append(list.Keys, s3KeyJSON(&keys[i]))
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+// DeleteKeyHandler 删除当前用户的访问密钥，用它签名的预签名 URL 随之失效
+// DELETE /s3/keys/{accessKeyId}
+func (h *S3KeyHandler) DeleteKeyHandler(c *gin.Context) {
+	err := h.keys.DeleteKey(c.Request.Context(), c.GetUint("user_id"), c.Param("accessKeyId"))
+	if errors.Is(err, service.ErrS3KeyNotFound) {
+		writeError(c, http.StatusNotFound, "访问密钥不存在")
+		return
+	}
+	if err != nil {
+		writeError(c, http.StatusInternalServerError, "删除访问密钥失败")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// s3KeyJSON 将访问密钥转换为响应结构（不含 secret key）
+func s3KeyJSON(key *model.S3AccessKey) api.S3AccessKey {
+	return api.S3AccessKey{
+		AccessKeyID: key.AccessKeyID,
+		Description: key.Description,
+		CreatedAt:   key.CreatedAt,
+	}
+}
+
+// RegisterS3KeyRoutes 设置 S3 访问密钥的管理路由
+func RegisterS3KeyRoutes(r *gin.Engine, keys *service.S3KeyService) {
+	handler := NewS3KeyHandler(keys)
+
+	keyGroup := r.Group("/api/v1/s3/keys")
+	{
+		keyGroup.POST("", handler.CreateKeyHandler)                // 创建访问密钥
+		keyGroup.GET("", handler.ListKeysHandler)                  // 列出访问密钥
+		keyGroup.DELETE("/:accessKeyId", handler.DeleteKeyHandler) // 删除访问密钥
+	}
+}
@@ -0,0 +1,143 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sealock/core-storage/api"
+	"github.com/sealock/core-storage/model"
+	"github.com/sealock/core-storage/service"
+)
+
+// SnapshotHandler 处理快照（历史版本）浏览请求
+// 提供目录树列表、文件流式下载以及只读挂载视图
+type SnapshotHandler struct {
+	browser *service.SnapshotBrowser
+	access  *service.LibraryAccess
+}
+
+// NewSnapshotHandler 创建新的SnapshotHandler实例
+func NewSnapshotHandler(browser *service.SnapshotBrowser, access *service.LibraryAccess) *SnapshotHandler {
+	return &SnapshotHandler{browser: browser, access: access}
+}
+
+// ListTreeHandler 列出快照中某个目录的直接子项
+// GET /snapshots/{id}/tree?path=dir/sub
+// id 可以是快照数字ID或UUID
+func (h *SnapshotHandler) ListTreeHandler(c *gin.Context) {
+	snapshot, ok := h.resolveSnapshot(c)
+	if !ok {
+		return
+	}
+
+	dir := c.Query("path")
+	entries, err := h.browser.ListDir(c.Request.Context(), snapshot.ID, dir)
+	if err != nil {
+		if errors.Is(err, service.ErrPathNotFound) {
+			writeError(c, http.StatusNotFound, "路径不存在")
+			return
+		}
+		writeError(c, http.StatusBadRequest, "列出目录失败: "+err.Error())
+		return
+	}
+
+	items := make([]api.TreeEntry, 0, len(entries))
+	for _, entry := range entries {
+		items = append(items, directoryEntryJSON(dir, entry))
+	}
+
+	c.JSON(http.StatusOK, api.SnapshotTree{
+		Snapshot: snapshot.UUID,
+		Path:     strings.Trim(dir, "/"),
+		Entries:  items,
+	})
+}
+
+// DownloadFileHandler 流式读取快照中的文件，支持 Range 请求
+// GET /snapshots/{id}/files/{path}?download=true
+func (h *SnapshotHandler) DownloadFileHandler(c *gin.Context) {
+	snapshot, ok := h.resolveSnapshot(c)
+	if !ok {
+		return
+	}
+
+	reader, file, err := h.browser.OpenFile(c.Request.Context(), snapshot.ID, c.Param("path"))
+	if err != nil {
+		if errors.Is(err, service.ErrPathNotFound) {
+			writeError(c, http.StatusNotFound, "文件不存在")
+			return
+		}
+		writeError(c, http.StatusInternalServerError, "读取文件失败")
+		return
+	}
+	defer reader.Close()
+
+	if file.FileHash != "" {
+		c.Header("ETag", `"`+file.FileHash+`"`)
+	}
+	serveContent(c, path.Base(file.FileName), snapshot.CreatedAt, reader, c.Query("download") == "true")
+}
+
+// MountHandler 把快照作为只读文件系统暴露，浏览器可直接逐级浏览并下载
+// GET /snapshots/{id}/fs/{path}
+func (h *SnapshotHandler) MountHandler(c *gin.Context) {
+	snapshot, ok := h.resolveSnapshot(c)
+	if !ok {
+		return
+	}
+
+	fsys, err := h.browser.FS(c.Request.Context(), snapshot.ID)
+	if err != nil {
+		writeError(c, http.StatusInternalServerError, "挂载快照失败")
+		return
+	}
+
+	// 文件按原样返回，用沙箱 CSP 阻止快照中的 HTML、SVG 在本站点下运行脚本
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Header("Content-Security-Policy", "sandbox")
+	prefix := strings.TrimSuffix(c.Request.URL.Path, c.Param("path"))
+	http.StripPrefix(prefix, http.FileServer(http.FS(fsys))).ServeHTTP(c.Writer, c.Request)
+}
+
+// resolveSnapshot 解析路径中的快照标识并检查当前用户能否访问快照所属的库，失败时直接写入错误响应
+func (h *SnapshotHandler) resolveSnapshot(c *gin.Context) (*model.Snapshot, bool) {
+	snapshot, err := h.browser.ResolveSnapshot(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		writeError(c, http.StatusNotFound, "快照不存在")
+		return nil, false
+	}
+	if !authorizeLibrary(c, h.access, snapshot.LibraryID) {
+		return nil, false
+	}
+	return snapshot, true
+}
+
+// directoryEntryJSON 将目录条目转换为响应结构
+func directoryEntryJSON(dir string, entry model.DirectoryEntry) api.TreeEntry {
+	entryType := "file"
+	if entry.IsDir {
+		entryType = "dir"
+	}
+	return api.TreeEntry{
+		Name: entry.Name,
+		Path: strings.TrimPrefix(path.Join(strings.Trim(dir, "/"), entry.Name), "/"),
+		Type: entryType,
+		Size: entry.Size,
+		Hash: entry.Hash,
+	}
+}
+
+// RegisterSnapshotRoutes 设置快照浏览相关的路由
+func RegisterSnapshotRoutes(r *gin.Engine, browser *service.SnapshotBrowser, access *service.LibraryAccess) {
+	handler := NewSnapshotHandler(browser, access)
+
+	snapshotGroup := r.Group("/api/v1/snapshots")
+	{
+		snapshotGroup.GET("/:id/tree", handler.ListTreeHandler)            // 列出快照目录
+		snapshotGroup.GET("/:id/files/*path", handler.DownloadFileHandler) // 读取快照中的文件
+		snapshotGroup.GET("/:id/fs/*path", handler.MountHandler)           // 只读挂载视图
+	}
+}
@@ -0,0 +1,333 @@
+package handler
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sealock/core-storage/api"
+	"github.com/sealock/core-storage/model"
+	"github.com/sealock/core-storage/service"
+)
+
+// SyncHandler 处理客户端与服务端之间的增量同步请求
+type SyncHandler struct {
+	syncService *service.SyncService
+	access      *service.LibraryAccess
+}
+
+// NewSyncHandler 创建新的SyncHandler实例
+func NewSyncHandler(syncService *service.SyncService, access *service.LibraryAccess) *SyncHandler {
+	return &SyncHandler{syncService: syncService, access: access}
+}
+
+// DiffHandler 对比客户端目录树哈希，返回哈希不一致的子树
+// POST /sync/libraries/{libraryId}/diff
+// 请求体:
+// {
+//   "root": "...",                      // 客户端根哈希
+//   "trees": {"": "...", "docs": "..."} // 目录路径 → 目录哈希
+// }
+func (h *SyncHandler) DiffHandler(c *gin.Context) {
+	libraryID, ok := libraryIDParam(c)
+	if !ok {
+		return
+	}
+
+	var req api.SyncDiffRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeError(c, http.StatusBadRequest, "无效的请求格式")
+		return
+	}
+
+	resp, err := h.syncService.Diff(c.Request.Context(), libraryID, &req)
+	if err != nil {
+		writeError(c, http.StatusInternalServerError, "计算差异失败")
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// PushHandler 提交客户端的变更，冲突按库的冲突策略处理并在响应的 conflicts 中返回
+// POST /sync/libraries/{libraryId}/push
+// 请求体:
+// {
+//   "baseRoot": "...",   // 客户端上次同步到的服务端根哈希
+//   "clientId": "laptop",
+//   "files": [{"path": "docs/a.txt", "hash": "...", "size": 10, "blocks": ["..."], "baseHash": "...", "modTime": "..."}],
+//   "deleted": [{"path": "old.txt", "baseHash": "..."}]
+// }
+func (h *SyncHandler) PushHandler(c *gin.Context) {
+	libraryID, ok := libraryIDParam(c)
+	if !ok {
+		return
+	}
+
+	var req api.SyncPushRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeError(c, http.StatusBadRequest, "无效的请求格式")
+		return
+	}
+	scope, ok := h.blockScope(c)
+	if !ok {
+		return
+	}
+
+	resp, err := h.syncService.ApplyChanges(c.Request.Context(), scope, libraryID, &req)
+	if err != nil {
+		var missing *service.MissingBlocksError
+		if errors.As(err, &missing) {
+			c.JSON(http.StatusPreconditionFailed, api.MissingBlocksError{
+				Error:         api.Error{Code: api.CodeMissingBlocks, Message: "缺少数据块，请先上传"},
+				MissingBlocks: missing.Hashes,
+			})
+			return
+		}
+		if errors.Is(err, service.ErrReadOnlyReplica) {
+			writeReadOnly(c)
+			return
+		}
+		writeError(c, http.StatusBadRequest, "提交变更失败: "+err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// CheckBlocksHandler 返回需要上传的块
+// 不被当前用户可读的库引用、也不是该用户上传过的块都算缺少
+// POST /sync/blocks/check
+// 请求体: {"hashes": ["..."]}
+func (h *SyncHandler) CheckBlocksHandler(c *gin.Context) {
+	var req api.CheckBlocksRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeError(c, http.StatusBadRequest, "无效的请求格式")
+		return
+	}
+	scope, ok := h.blockScope(c)
+	if !ok {
+		return
+	}
+
+	missing, err := h.syncService.MissingBlocks(c.Request.Context(), scope, req.Hashes)
+	if err != nil {
+		writeError(c, http.StatusInternalServerError, "检查数据块失败")
+		return
+	}
+	c.JSON(http.StatusOK, api.CheckBlocksResponse{Missing: missing})
+}
+
+// UploadBlockHandler 上传单个块，请求体为块的原始数据，大小不超过分片上限
+// PUT /sync/blocks/{hash}
+func (h *SyncHandler) UploadBlockHandler(c *gin.Context) {
+	data, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxUploadChunkSize))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeError(c, http.StatusRequestEntityTooLarge, "数据块过大")
+			return
+		}
+		writeError(c, http.StatusBadRequest, "读取数据块失败")
+		return
+	}
+
+	if err := h.syncService.ReceiveBlock(c.Request.Context(), c.GetUint("user_id"), c.Param("hash"), data); err != nil {
+		writeError(c, http.StatusBadRequest, "保存数据块失败: "+err.Error())
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// DownloadBlockHandler 下载单个块，只能下载当前用户可读的库引用的块或自己上传过的块
+// GET /sync/blocks/{hash}
+func (h *SyncHandler) DownloadBlockHandler(c *gin.Context) {
+	scope, ok := h.blockScope(c)
+	if !ok {
+		return
+	}
+	hash := c.Param("hash")
+	data, err := h.syncService.GetBlock(c.Request.Context(), scope, hash)
+	if err != nil {
+		writeError(c, http.StatusNotFound, "数据块不存在")
+		return
+	}
+	c.Header("ETag", `"`+hash+`"`)
+	c.Header("Cache-Control", "private, max-age=31536000, immutable")
+	c.Data(http.StatusOK, "application/octet-stream", data)
+}
+
+// GetConflictPolicyHandler 获取库的冲突策略
+// GET /sync/libraries/{libraryId}/conflict-policy
+func (h *SyncHandler) GetConflictPolicyHandler(c *gin.Context) {
+	libraryID, ok := libraryIDParam(c)
+	if !ok {
+		return
+	}
+
+	policy, err := h.syncService.ConflictPolicy(c.Request.Context(), libraryID)
+	if err != nil {
+		writeError(c, http.StatusInternalServerError, "获取冲突策略失败")
+		return
+	}
+	c.JSON(http.StatusOK, api.ConflictPolicySetting{LibraryID: libraryID, Policy: api.ConflictPolicy(policy)})
+}
+
+// SetConflictPolicyHandler 设置库的冲突策略
+// PUT /sync/libraries/{libraryId}/conflict-policy
+// 请求体: {"policy": "keep_both"}，可选 keep_both、newest_wins、server_wins、manual
+func (h *SyncHandler) SetConflictPolicyHandler(c *gin.Context) {
+	libraryID, ok := libraryIDParam(c)
+	if !ok {
+		return
+	}
+
+	var req api.SetConflictPolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeError(c, http.StatusBadRequest, "无效的请求格式")
+		return
+	}
+
+	if err := h.syncService.SetConflictPolicy(c.Request.Context(), libraryID, model.ConflictPolicy(req.Policy)); err != nil {
+		if errors.Is(err, service.ErrInvalidConflictPolicy) {
+			writeError(c, http.StatusBadRequest, "不支持的冲突策略")
+			return
+		}
+		writeError(c, http.StatusInternalServerError, "设置冲突策略失败")
+		return
+	}
+	c.JSON(http.StatusOK, api.ConflictPolicySetting{LibraryID: libraryID, Policy: req.Policy})
+}
+
+// ListConflictsHandler 列出库的冲突记录
+// GET /sync/libraries/{libraryId}/conflicts?status=open
+func (h *SyncHandler) ListConflictsHandler(c *gin.Context) {
+	libraryID, ok := libraryIDParam(c)
+	if !ok {
+		return
+	}
+
+	conflicts, err := h.syncService.ListConflicts(c.Request.Context(), libraryID, c.Query("status"))
+	if err != nil {
+		writeError(c, http.StatusInternalServerError, "获取冲突列表失败")
+		return
+	}
+
+	items := make([]api.Conflict, 0, len(conflicts))
+	for i := range conflicts {
+		items = append(items, conflictJSON(&conflicts[i]))
+	}
+	c.JSON(http.StatusOK, api.ConflictList{Conflicts: items})
+}
+
+// ResolveConflictHandler 处理挂起的冲突，只有能访问冲突所在库的用户可以处理
+// POST /sync/conflicts/{id}/resolve
+// 请求体: {"resolution": "server"}，可选 server、client、keep_both
+func (h *SyncHandler) ResolveConflictHandler(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		writeError(c, http.StatusBadRequest, "无效的冲突ID")
+		return
+	}
+
+	var req api.ResolveConflictRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeError(c, http.StatusBadRequest, "无效的请求格式")
+		return
+	}
+
+	existing, err := h.syncService.GetConflict(c.Request.Context(), uint(id))
+	if err != nil {
+		if errors.Is(err, service.ErrConflictNotFound) {
+			writeError(c, http.StatusNotFound, "冲突不存在")
+			return
+		}
+		writeError(c, http.StatusInternalServerError, "获取冲突失败")
+		return
+	}
+	if !authorizeLibrary(c, h.access, existing.LibraryID) {
+		return
+	}
+
+	conflict, err := h.syncService.ResolveConflict(c.Request.Context(), uint(id), req.Resolution)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrConflictNotFound):
+			writeError(c, http.StatusNotFound, "冲突不存在")
+		case errors.Is(err, service.ErrConflictResolved):
+			writeError(c, http.StatusConflict, "冲突已处理")
+		case errors.Is(err, service.ErrInvalidResolution):
+			writeError(c, http.StatusBadRequest, "不支持的处理方式")
+		case errors.Is(err, service.ErrReadOnlyReplica):
+			writeReadOnly(c)
+		default:
+			writeError(c, http.StatusInternalServerError, "处理冲突失败")
+		}
+		return
+	}
+	c.JSON(http.StatusOK, conflictJSON(conflict))
+}
+
+// blockScope 返回当前用户可以使用的块范围，失败时写入 500 响应
+func (h *SyncHandler) blockScope(c *gin.Context) (service.BlockScope, bool) {
+	libraries, ok := readableLibraries(c, h.access)
+	if !ok {
+		return service.BlockScope{}, false
+	}
+	return service.BlockScope{UserID: c.GetUint("user_id"), Libraries: libraries}, true
+}
+
+// conflictJSON 将冲突记录转换为响应结构
+func conflictJSON(conflict *model.SyncConflict) api.Conflict {
+	return api.Conflict{
+		ID:            conflict.ID,
+		LibraryID:     conflict.LibraryID,
+		Path:          conflict.Path,
+		BaseHash:      conflict.BaseHash,
+		ServerHash:    conflict.ServerHash,
+		ClientHash:    conflict.ClientHash,
+		ClientSize:    conflict.ClientSize,
+		ClientModTime: conflict.ClientModTime,
+		ClientID:      conflict.ClientID,
+		Policy:        conflict.Policy,
+		Status:        conflict.Status,
+		Resolution:    conflict.Resolution,
+		CopyPath:      conflict.CopyPath,
+		CreatedAt:     conflict.CreatedAt,
+		ResolvedAt:    conflict.ResolvedAt,
+	}
+}
+
+// writeError 写入错误响应，错误码按状态码取通用值
+func writeError(c *gin.Context, status int, message string) {
+	c.JSON(status, api.Error{Code: api.CodeForStatus(status), Message: message})
+}
+
+// libraryIDParam 解析路径中的库ID，失败时直接写入错误响应
+func libraryIDParam(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("libraryId"), 10, 64)
+	if err != nil {
+		writeError(c, http.StatusBadRequest, "无效的库ID")
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// RegisterSyncRoutes 设置增量同步相关的路由
+func RegisterSyncRoutes(r *gin.Engine, syncService *service.SyncService, access *service.LibraryAccess) {
+	handler := NewSyncHandler(syncService, access)
+
+	syncGroup := r.Group("/api/v1/sync")
+	{
+		syncGroup.POST("/libraries/:libraryId/diff", handler.DiffHandler) // 对比目录树
+		syncGroup.POST("/libraries/:libraryId/push", handler.PushHandler) // 提交变更
+		syncGroup.POST("/blocks/check", handler.CheckBlocksHandler)       // 查询缺少的块
+		syncGroup.PUT("/blocks/:hash", handler.UploadBlockHandler)        // 上传块
+		syncGroup.GET("/blocks/:hash", handler.DownloadBlockHandler)      // 下载块
+
+		syncGroup.GET("/libraries/:libraryId/conflict-policy", handler.GetConflictPolicyHandler) // 获取冲突策略
+		syncGroup.PUT("/libraries/:libraryId/conflict-policy", handler.SetConflictPolicyHandler) // 设置冲突策略
+		syncGroup.GET("/libraries/:libraryId/conflicts", handler.ListConflictsHandler)           // 冲突列表
+		syncGroup.POST("/conflicts/:id/resolve", handler.ResolveConflictHandler)                 // 处理冲突
+	}
+}
@@ -0,0 +1,334 @@
+package handler
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"hash"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sealock/core-storage/service"
+)
+
+const (
+	// tusVersion 支持的 tus 协议版本
+	tusVersion = "1.0.0"
+	// tusExtensions 支持的 tus 扩展
+	tusExtensions = "creation,creation-with-upload,expiration,checksum,termination"
+	// tusChecksumAlgorithms Upload-Checksum 支持的算法
+	tusChecksumAlgorithms = "sha1,md5,sha256"
+	// statusChecksumMismatch tus checksum 扩展定义的校验失败状态码
+	statusChecksumMismatch = 460
+)
+
+// TusHandler 实现 tus 1.0 断点续传协议（https://tus.io/protocols/resumable-upload）
+// 支持 creation、creation-with-upload、expiration、checksum 和 termination 扩展，
+// 数据写入块存储，完成后与分片上传一样创建文件
+// Upload-Metadata 中 filename（或 path）为库内路径，libraryId 为目标库；
+// 上传完成后响应头 Upload-File-Hash 为所创建文件的内容哈希
+type TusHandler struct {
+	service *service.FileService
+	access  *service.LibraryAccess
+}
+
+// NewTusHandler 创建新的TusHandler实例
+func NewTusHandler(fileService *service.FileService, access *service.LibraryAccess) *TusHandler {
+	return &TusHandler{service: fileService, access: access}
+}
+
+// OptionsHandler 返回服务端支持的 tus 版本与扩展
+// OPTIONS /tus/files
+func (h *TusHandler) OptionsHandler(c *gin.Context) {
+	c.Header("Tus-Version", tusVersion)
+	c.Header("Tus-Extension", tusExtensions)
+	c.Header("Tus-Checksum-Algorithm", tusChecksumAlgorithms)
+	c.Status(http.StatusNoContent)
+}
+
+// CreateHandler 创建上传，请求体不为空时同时写入第一段数据
+// POST /tus/files
+// 请求头: Upload-Length、Upload-Metadata，可选 Content-Type: application/offset+octet-stream 与 Upload-Checksum
+func (h *TusHandler) CreateHandler(c *gin.Context) {
+	if c.GetHeader("Upload-Defer-Length") != "" {
+		c.String(http.StatusBadRequest, "Upload-Defer-Length is not supported")
+		return
+	}
+	length, err := strconv.ParseInt(c.GetHeader("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		c.String(http.StatusBadRequest, "invalid Upload-Length")
+		return
+	}
+	metadata, err := parseTusMetadata(c.GetHeader("Upload-Metadata"))
+	if err != nil {
+		c.String(http.StatusBadRequest, "invalid Upload-Metadata")
+		return
+	}
+
+	fileName := metadata["path"]
+	if fileName == "" {
+		fileName = metadata["filename"]
+	}
+	var libraryID uint64
+	if raw := metadata["libraryId"]; raw != "" {
+		if libraryID, err = strconv.ParseUint(raw, 10, 64); err != nil {
+			c.String(http.StatusBadRequest, "invalid libraryId metadata")
+			return
+		}
+	}
+	// 目标库来自 Upload-Metadata，不经过路由上的库权限检查
+	if !authorizeLibrary(c, h.access, uint(libraryID)) {
+		return
+	}
+
+	upload := &service.TusUpload{
+		LibraryID: uint(libraryID),
+		FileName:  fileName,
+		Length:    length,
+		Metadata:  metadata,
+		OwnerID:   c.GetUint("user_id"),
+	}
+	if err := h.service.CreateTusUpload(c.Request.Context(), upload); err != nil {
+		if errors.Is(err, service.ErrInvalidUploadSession) {
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+		if errors.Is(err, service.ErrQuotaExceeded) {
+			c.String(http.StatusRequestEntityTooLarge, "storage quota exceeded")
+			return
+		}
+		if errors.Is(err, service.ErrReadOnlyReplica) {
+			c.String(http.StatusForbidden, "library is a read-only replica")
+			return
+		}
+		c.String(http.StatusInternalServerError, "failed to create upload")
+		return
+	}
+
+	location := strings.TrimSuffix(c.Request.URL.Path, "/") + "/" + upload.ID
+	c.Header("Location", location)
+	c.Header("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+
+	// creation-with-upload：请求体携带第一段数据
+	if c.Request.ContentLength != 0 && c.ContentType() == "application/offset+octet-stream" {
+		written, ok := h.write(c, upload.ID, 0)
+		if !ok {
+			return
+		}
+		upload = written
+	}
+	if upload.FileHash != "" {
+		// 长度为 0 或随创建请求一次传完的上传已经完成
+		c.Header("Upload-File-Hash", upload.FileHash)
+	}
+	c.Header("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	c.Status(http.StatusCreated)
+}
+
+// HeadHandler 返回上传的当前偏移量，客户端据此续传
+// HEAD /tus/files/{id}
+func (h *TusHandler) HeadHandler(c *gin.Context) {
+	upload, ok := h.upload(c)
+	if !ok {
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+	c.Header("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	c.Header("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	c.Header("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	if metadata := formatTusMetadata(upload.Metadata); metadata != "" {
+		c.Header("Upload-Metadata", metadata)
+	}
+	if upload.FileHash != "" {
+		c.Header("Upload-File-Hash", upload.FileHash)
+	}
+	c.Status(http.StatusOK)
+}
+
+// PatchHandler 从 Upload-Offset 处追加数据
+// PATCH /tus/files/{id}
+// 请求头: Content-Type: application/offset+octet-stream、Upload-Offset，可选 Upload-Checksum: <算法> <Base64 摘要>
+func (h *TusHandler) PatchHandler(c *gin.Context) {
+	if c.ContentType() != "application/offset+octet-stream" {
+		c.String(http.StatusUnsupportedMediaType, "Content-Type must be application/offset+octet-stream")
+		return
+	}
+	offset, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		c.String(http.StatusBadRequest, "invalid Upload-Offset")
+		return
+	}
+	if _, ok := h.upload(c); !ok {
+		return
+	}
+
+	upload, ok := h.write(c, c.Param("id"), offset)
+	if !ok {
+		return
+	}
+	c.Header("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	c.Header("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	c.Status(http.StatusNoContent)
+}
+
+// DeleteHandler 终止上传
+// DELETE /tus/files/{id}
+func (h *TusHandler) DeleteHandler(c *gin.Context) {
+	if _, ok := h.upload(c); !ok {
+		return
+	}
+	if err := h.service.TerminateTusUpload(c.Request.Context(), c.Param("id")); err != nil {
+		c.String(http.StatusInternalServerError, "failed to terminate upload")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// write 把请求体写入上传，失败时写入响应并返回 false
+func (h *TusHandler) write(c *gin.Context, id string, offset int64) (*service.TusUpload, bool) {
+	checksum, expected, err := parseTusChecksum(c.GetHeader("Upload-Checksum"))
+	if err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return nil, false
+	}
+
+	upload, err := h.service.WriteTusUpload(c.Request.Context(), id, offset, c.Request.Body, checksum, expected)
+	switch {
+	case errors.Is(err, service.ErrTusOffsetMismatch):
+		c.String(http.StatusConflict, err.Error())
+		return nil, false
+	case errors.Is(err, service.ErrTusChecksumMismatch):
+		c.String(statusChecksumMismatch, "Checksum Mismatch")
+		return nil, false
+	case errors.Is(err, service.ErrTusUploadTooLarge):
+		c.String(http.StatusRequestEntityTooLarge, err.Error())
+		return nil, false
+	case errors.Is(err, service.ErrUploadChunkMismatch) || errors.Is(err, service.ErrUploadSizeMismatch):
+		c.String(http.StatusConflict, err.Error())
+		return nil, false
+	case errors.Is(err, service.ErrReadOnlyReplica):
+		c.String(http.StatusForbidden, "library is a read-only replica")
+		return nil, false
+	case err != nil && upload != nil:
+		// 请求体读取中断，已收到的部分已保存
+		c.Header("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+		c.String(http.StatusBadRequest, err.Error())
+		return nil, false
+	case err != nil:
+		c.String(http.StatusInternalServerError, "failed to write upload")
+		return nil, false
+	case upload == nil:
+		c.String(http.StatusNotFound, "upload not found")
+		return nil, false
+	}
+	if upload.FileHash != "" {
+		c.Header("Upload-File-Hash", upload.FileHash)
+	}
+	return upload, true
+}
+
+// upload 读取路径中的上传并校验当前用户是发起者，失败时写入响应并返回 false
+func (h *TusHandler) upload(c *gin.Context) (*service.TusUpload, bool) {
+	upload, err := h.service.GetTusUpload(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.String(http.StatusInternalServerError, "failed to read upload")
+		return nil, false
+	}
+	if upload == nil {
+		// 过期或已终止的上传与不存在的上传一样返回 404
+		c.Status(http.StatusNotFound)
+		return nil, false
+	}
+	if upload.OwnerID != 0 && upload.OwnerID != c.GetUint("user_id") {
+		c.Status(http.StatusForbidden)
+		return nil, false
+	}
+	return upload, true
+}
+
+// tusResumable 为所有响应加上 Tus-Resumable，并拒绝不支持的协议版本（OPTIONS 除外）
+func tusResumable(c *gin.Context) {
+	c.Header("Tus-Resumable", tusVersion)
+	if c.Request.Method != http.MethodOptions && c.GetHeader("Tus-Resumable") != tusVersion {
+		c.Header("Tus-Version", tusVersion)
+		c.AbortWithStatus(http.StatusPreconditionFailed)
+		return
+	}
+	c.Next()
+}
+
+// parseTusMetadata 解析 Upload-Metadata：逗号分隔的 "键 Base64值"，值可省略
+func parseTusMetadata(header string) (map[string]string, error) {
+	metadata := make(map[string]string)
+	for _, pair := range strings.Split(header, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		key, encoded, _ := strings.Cut(pair, " ")
+		value, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil {
+			return nil, err
+		}
+		metadata[key] = string(value)
+	}
+	return metadata, nil
+}
+
+// formatTusMetadata 将元数据编码为 Upload-Metadata
+func formatTusMetadata(metadata map[string]string) string {
+	keys := make([]string, 0, len(metadata))
+	for key := range metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, len(keys))
+	for i, key := range keys {
+		pairs[i] = key + " " + base64.StdEncoding.EncodeToString([]byte(metadata[key]))
+	}
+	return strings.Join(pairs, ",")
+}
+
+// parseTusChecksum 解析 Upload-Checksum，没有该请求头时返回 nil
+func parseTusChecksum(header string) (hash.Hash, []byte, error) {
+	if header == "" {
+		return nil, nil, nil
+	}
+	algorithm, encoded, ok := strings.Cut(strings.TrimSpace(header), " ")
+	if !ok {
+		return nil, nil, errors.New("invalid Upload-Checksum")
+	}
+	expected, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, nil, errors.New("invalid Upload-Checksum")
+	}
+	switch algorithm {
+	case "sha1":
+		return sha1.New(), expected, nil
+	case "md5":
+		return md5.New(), expected, nil
+	case "sha256":
+		return sha256.New(), expected, nil
+	default:
+		return nil, nil, errors.New("unsupported checksum algorithm")
+	}
+}
+
+// RegisterTusRoutes 设置 tus 断点续传协议的路由
+func RegisterTusRoutes(r *gin.Engine, fileService *service.FileService, access *service.LibraryAccess) {
+	handler := NewTusHandler(fileService, access)
+
+	tusGroup := r.Group("/api/v1/tus/files", tusResumable)
+	{
+		tusGroup.OPTIONS("", handler.OptionsHandler)   // 协议能力
+		tusGroup.POST("", handler.CreateHandler)       // 创建上传
+		tusGroup.HEAD("/:id", handler.HeadHandler)     // 查询偏移量
+		tusGroup.PATCH("/:id", handler.PatchHandler)   // 追加数据
+		tusGroup.DELETE("/:id", handler.DeleteHandler) // 终止上传
+	}
+}
@@ -1,228 +1,384 @@
 package handler
 
 import (
-	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
+	"github.com/sealock/core-storage/api"
+	"github.com/sealock/core-storage/model"
 	"github.com/sealock/core-storage/service"
 )
 
+// maxUploadChunkSize 单个分片请求体的上限
+const maxUploadChunkSize = 64 << 20
+
+// multipartOverhead multipart 分片请求中分隔符和元数据字段允许的额外字节
+const multipartOverhead = 1 << 20
+
 // UploadHandler 处理文件上传操作
 // 实现基于内容寻址的断点续传功能
 // 遵循RESTful设计，具有清晰的错误处理机制
 // 使用Redis进行上传会话跟踪
 type UploadHandler struct {
 	service *service.FileService
+	access  *service.LibraryAccess
 }
 
 // NewUploadHandler 创建新的UploadHandler实例
-func NewUploadHandler(fileService *service.FileService) *UploadHandler {
-	return &UploadHandler{service: fileService}
+func NewUploadHandler(fileService *service.FileService, access *service.LibraryAccess) *UploadHandler {
+	return &UploadHandler{service: fileService, access: access}
 }
 
-// CheckFileHandler 检查文件是否已存在于系统中
-// 当内容哈希匹配时实现"秒传"功能
+// CheckFileHandler 检查当前用户可以读取的库中是否已有内容相同的文件
+// 当内容哈希匹配时实现"秒传"功能：创建上传会话后即可直接完成上传；
+// 不存在时创建会话同样会返回已有的分片，只需上传缺失的部分。
+// 只返回是否存在，不返回文件信息
 // GET /check?fileHash={sha256}
 func (h *UploadHandler) CheckFileHandler(c *gin.Context) {
 	fileHash := c.Query("fileHash")
 	if fileHash == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "fileHash参数是必需的"})
+		writeError(c, http.StatusBadRequest, "fileHash参数是必需的")
 		return
 	}
-
-	// 检查文件是否已存在于系统中
-	fileNode, err := h.service.GetFileNodeByContentHash(context.Background(), fileHash)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "检查文件存在性失败"})
+	libraryIDs, ok := readableLibraries(c, h.access)
+	if !ok {
 		return
 	}
 
-	if fileNode != nil {
-		// 文件已存在，返回现有文件信息
-		c.JSON(http.StatusOK, gin.H{
-			"exists": true,
-			"file": map[string]interface{}{
-				"id":   fileNode.ID,
-				"name": fileNode.Name,
-				"size": fileNode.Size,
-				"hash": fileNode.ContentHash,
-			},
-		})
+	exists, err := h.service.ContentExistsInLibraries(c.Request.Context(), libraryIDs, fileHash)
+	if err != nil {
+		writeError(c, http.StatusInternalServerError, "检查文件存在性失败")
 		return
 	}
-
-	// 文件不存在，准备上传
-	c.JSON(http.StatusOK, gin.H{
-		"exists":       false,
-		"uploadId":     uuid.New().String(), // 生成上传会话ID
-		"requiredChunks": []int{},           // 将根据文件大小填充
-	})
+	c.JSON(http.StatusOK, api.CheckFileResponse{Exists: exists})
 }
 
-// UploadChunkHandler 处理单个文件分片上传
-// POST /upload/chunk
+// CreateSessionHandler 创建上传会话
+// POST /upload/sessions
 // 请求体:
 // {
-//   "uploadId": "...",
-//   "chunkIndex": 0,
-//   "totalChunks": 5,
-//   "chunkHash": "...",
-//   "fileHash": "..."
+//   "libraryId": 1,                 // 目标库，默认 0
+//   "fileName": "docs/example.pdf", // 库内路径，已存在时覆盖
+//   "fileSize": 123456,
+//   "fileHash": "...",              // 可选，分片哈希列表的 Merkle 哈希
+//   "chunkHashes": ["hash1", "hash2", ...]
 // }
-// 文件数据以原始二进制形式在请求体中发送
-func (h *UploadHandler) UploadChunkHandler(c *gin.Context) {
-	var req struct {
-		UploadID    string `json:"uploadId"`
-		ChunkIndex  int    `json:"chunkIndex"`
-		TotalChunks int    `json:"totalChunks"`
-		ChunkHash   string `json:"chunkHash"`
-		FileHash    string `json:"fileHash"`
+// 目标库需可访问；当前用户可以读取的文件中已有的分片直接记为已接收，响应与 GET /upload/sessions/{uploadId} 相同：
+// 客户端只需上传 missing 中的分片，complete 为 true 时可直接完成上传（秒传）；
+// session.uploadId 用于后续上传分片、查询进度和完成上传
+func (h *UploadHandler) CreateSessionHandler(c *gin.Context) {
+	var req api.CreateUploadSessionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeError(c, http.StatusBadRequest, "无效的请求格式")
+		return
+	}
+	if !authorizeLibrary(c, h.access, req.LibraryID) {
+		return
+	}
+	libraryIDs, ok := readableLibraries(c, h.access)
+	if !ok {
+		return
 	}
 
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求格式"})
+	session := &service.UploadSession{
+		LibraryID:   req.LibraryID,
+		FileName:    req.FileName,
+		FileSize:    req.FileSize,
+		FileHash:    req.FileHash,
+		ChunkHashes: req.ChunkHashes,
+		OwnerID:     c.GetUint("user_id"),
+	}
+	if err := h.service.CreateUploadSession(c.Request.Context(), session); err != nil {
+		if errors.Is(err, service.ErrInvalidUploadSession) {
+			writeError(c, http.StatusBadRequest, "无效的上传会话: "+err.Error())
+			return
+		}
+		if errors.Is(err, service.ErrQuotaExceeded) {
+			c.JSON(http.StatusRequestEntityTooLarge, api.Error{Code: api.CodeQuotaExceeded, Message: "存储空间不足"})
+			return
+		}
+		if errors.Is(err, service.ErrReadOnlyReplica) {
+			writeReadOnly(c)
+			return
+		}
+		writeError(c, http.StatusInternalServerError, "创建上传会话失败")
 		return
 	}
 
-	// 验证分片索引
-	if req.ChunkIndex < 0 || req.ChunkIndex >= req.TotalChunks {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的分片索引"})
+	// 块级秒传：当前用户可以读取的文件中已有的分片无需上传
+	if _, err := h.service.ReuseStoredChunks(c.Request.Context(), session, libraryIDs); err != nil {
+		writeError(c, http.StatusInternalServerError, "检查已有分片失败")
+		return
+	}
+	status, err := h.service.GetUploadSessionStatus(c.Request.Context(), session)
+	if err != nil {
+		writeError(c, http.StatusInternalServerError, "查询上传会话失败")
 		return
 	}
+	c.JSON(http.StatusCreated, status)
+}
 
-	// 从请求体读取分片数据
-	chunkData, err := io.ReadAll(c.Request.Body)
+// SessionStatusHandler 查询上传会话的进度，用于断点续传
+// GET /upload/sessions/{uploadId}
+func (h *UploadHandler) SessionStatusHandler(c *gin.Context) {
+	session, ok := h.uploadSession(c, c.Param("uploadId"))
+	if !ok {
+		return
+	}
+	status, err := h.service.GetUploadSessionStatus(c.Request.Context(), session)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "读取分片数据失败"})
+		writeError(c, http.StatusInternalServerError, "查询上传会话失败")
+		return
+	}
+	c.JSON(http.StatusOK, status)
+}
+
+// UploadChunkHandler 处理单个文件分片上传
+// 分片可以按任意顺序、并发上传；同一分片重复上传是幂等的
+// POST /upload/chunk?uploadId=...&chunkIndex=0&chunkHash=...
+// PUT /upload/sessions/{uploadId}/chunks/{chunkIndex}
+// 元数据可以放在路径、查询参数或请求头（X-Upload-Id、X-Chunk-Index、X-Chunk-Hash）中，
+// 请求体为分片的原始二进制数据；也可以使用 multipart/form-data，
+// 字段 uploadId、chunkIndex、chunkHash，分片数据放在文件字段 chunk 中。
+// chunkHash 可省略，服务端总会按会话中声明的分片哈希校验数据
+func (h *UploadHandler) UploadChunkHandler(c *gin.Context) {
+	req, chunkData, ok := readChunkRequest(c)
+	if !ok {
+		return
+	}
+
+	session, ok := h.uploadSession(c, req.UploadID)
+	if !ok {
 		return
 	}
 
 	// 验证分片哈希
 	computedHash := fmt.Sprintf("%x", h.service.ComputeSHA256(chunkData))
-	if computedHash != req.ChunkHash {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error":    "分片哈希不匹配",
-			"expected": req.ChunkHash,
-			"actual":   computedHash,
+	if req.ChunkHash != "" && computedHash != req.ChunkHash {
+		c.JSON(http.StatusBadRequest, api.ChunkHashMismatchError{
+			Error:    api.Error{Code: api.CodeChunkHashMismatch, Message: "分片哈希不匹配"},
+			Expected: req.ChunkHash,
+			Actual:   computedHash,
 		})
 		return
 	}
 
-	// 临时存储分片
-	if err := h.service.StoreTemporaryChunk(req.UploadID, req.ChunkIndex, chunkData); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "存储分片失败"})
+	// 验证分片索引与会话声明的分片哈希
+	if err := session.CheckChunk(req.ChunkIndex, computedHash); err != nil {
+		writeError(c, http.StatusBadRequest, "无效的分片: "+err.Error())
+		return
+	}
+
+	// 分片直接写入块存储（内容寻址，自动去重）
+	storedHash, err := h.service.StoreUploadChunk(c.Request.Context(), chunkData)
+	if err != nil {
+		writeError(c, http.StatusInternalServerError, "存储分片失败")
 		return
 	}
 
 	// 在Redis中跟踪分片接收情况，用于会话管理
-	if err := h.service.RecordChunkReceived(req.UploadID, req.ChunkIndex, req.TotalChunks); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "记录分片失败"})
+	if err := h.service.RecordChunkReceived(c.Request.Context(), session, req.ChunkIndex, storedHash); err != nil {
+		writeError(c, http.StatusInternalServerError, "记录分片失败")
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"chunkIndex": req.ChunkIndex,
-		"status":     "uploaded",
+	c.JSON(http.StatusOK, api.ChunkUploaded{
+		ChunkIndex: req.ChunkIndex,
+		ChunkHash:  storedHash,
+		Status:     "uploaded",
 	})
 }
 
+// chunkRequest 分片上传请求的元数据
+type chunkRequest struct {
+	UploadID   string
+	ChunkIndex int
+	ChunkHash  string
+}
+
+// readChunkRequest 读取分片上传请求的元数据和分片数据，失败时写入响应并返回 false
+func readChunkRequest(c *gin.Context) (*chunkRequest, []byte, bool) {
+	var data []byte
+	var field func(name, header string) string
+
+	if c.ContentType() == "multipart/form-data" {
+		// 限制整个请求体：ParseMultipartForm 只限制内存部分，超出的文件内容会写入临时文件
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxUploadChunkSize+multipartOverhead)
+		if err := c.Request.ParseMultipartForm(maxUploadChunkSize); err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				writeError(c, http.StatusRequestEntityTooLarge, "分片过大")
+				return nil, nil, false
+			}
+			writeError(c, http.StatusBadRequest, "无效的multipart请求")
+			return nil, nil, false
+		}
+		file, header, err := c.Request.FormFile("chunk")
+		if err != nil {
+			writeError(c, http.StatusBadRequest, "缺少分片数据字段chunk")
+			return nil, nil, false
+		}
+		defer file.Close()
+		if header.Size > maxUploadChunkSize {
+			writeError(c, http.StatusRequestEntityTooLarge, "分片过大")
+			return nil, nil, false
+		}
+		if data, err = io.ReadAll(file); err != nil {
+			writeError(c, http.StatusBadRequest, "读取分片数据失败")
+			return nil, nil, false
+		}
+		field = func(name, _ string) string {
+			if v := c.Param(name); v != "" {
+				return v
+			}
+			return c.PostForm(name)
+		}
+	} else {
+		var err error
+		data, err = io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxUploadChunkSize))
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				writeError(c, http.StatusRequestEntityTooLarge, "分片过大")
+				return nil, nil, false
+			}
+			writeError(c, http.StatusBadRequest, "读取分片数据失败")
+			return nil, nil, false
+		}
+		field = func(name, header string) string {
+			if v := c.Param(name); v != "" {
+				return v
+			}
+			if v := c.Query(name); v != "" {
+				return v
+			}
+			return c.GetHeader(header)
+		}
+	}
+
+	req := &chunkRequest{
+		UploadID:  field("uploadId", "X-Upload-Id"),
+		ChunkHash: field("chunkHash", "X-Chunk-Hash"),
+	}
+	index, err := strconv.Atoi(field("chunkIndex", "X-Chunk-Index"))
+	if err != nil || index < 0 {
+		writeError(c, http.StatusBadRequest, "无效的分片索引")
+		return nil, nil, false
+	}
+	req.ChunkIndex = index
+	return req, data, true
+}
+
 // FinishUploadHandler 完成文件上传过程
 // POST /upload/finish
 // 请求体:
 // {
-//   "uploadId": "...",
-//   "fileName": "example.pdf",
-//   "fileSize": 123456,
-//   "fileHash": "...",
-//   "chunkHashes": ["hash1", "hash2", ...]
+//   "uploadId": "..."
 // }
+// 文件的路径、大小和哈希均以创建会话时声明的为准
 func (h *UploadHandler) FinishUploadHandler(c *gin.Context) {
-	var req struct {
-		UploadID    string   `json:"uploadId"`
-		FileName    string   `json:"fileName"`
-		FileSize    int64    `json:"fileSize"`
-		FileHash    string   `json:"fileHash"`
-		ChunkHashes []string `json:"chunkHashes"`
+	var req api.FinishUploadRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeError(c, http.StatusBadRequest, "无效的请求格式")
+		return
 	}
 
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求格式"})
+	session, ok := h.uploadSession(c, req.UploadID)
+	if !ok {
 		return
 	}
 
 	// 验证所有分片是否都已接收
-	missingChunks, err := h.service.GetMissingChunks(req.UploadID)
+	missingChunks, err := h.service.GetMissingChunks(c.Request.Context(), session)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "验证分片失败"})
+		writeError(c, http.StatusInternalServerError, "验证分片失败")
 		return
 	}
 
 	if len(missingChunks) > 0 {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error":       "缺少分片",
-			"missing":     missingChunks,
-			"totalChunks": len(req.ChunkHashes),
+		c.JSON(http.StatusBadRequest, api.MissingChunksError{
+			Error:       api.Error{Code: api.CodeMissingChunks, Message: "缺少分片"},
+			Missing:     missingChunks,
+			TotalChunks: session.TotalChunks,
 		})
 		return
 	}
 
-	// 验证文件哈希
-	reconstructedHash, err := h.service.ReconstructFileHash(req.UploadID, req.ChunkHashes)
+	// 创建最终的文件条目（校验分片并增加块引用）
+	file, err := h.service.CreateFileNode(c.Request.Context(), session)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "验证文件哈希失败"})
+		if errors.Is(err, service.ErrUploadChunkMismatch) || errors.Is(err, service.ErrUploadSizeMismatch) {
+			writeError(c, http.StatusBadRequest, "分片校验失败: "+err.Error())
+			return
+		}
+		if errors.Is(err, service.ErrReadOnlyReplica) {
+			writeReadOnly(c)
+			return
+		}
+		writeError(c, http.StatusInternalServerError, "创建文件条目失败: "+err.Error())
 		return
 	}
 
-	if reconstructedHash != req.FileHash {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error":         "文件哈希不匹配",
-			"expected":      req.FileHash,
-			"reconstructed": reconstructedHash,
-		})
-		return
+	// 清理会话记录
+	if err := h.service.CleanupUploadSession(c.Request.Context(), req.UploadID); err != nil {
+		// 记录清理错误但不使请求失败
+		fmt.Printf("警告: 清理上传会话 %s 失败: %v\n", req.UploadID, err)
 	}
 
-	// 创建最终的文件条目
-	fileNode, err := h.service.CreateFileNode(
-		context.Background(),
-		req.FileName,
-		req.FileSize,
-		req.FileHash,
-		req.ChunkHashes,
-	)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建文件条目失败: " + err.Error()})
-		return
-	}
+	c.JSON(http.StatusOK, api.FinishUploadResponse{File: fileInfoJSON(file)})
+}
 
-	// 清理临时资源
-	if err := h.service.CleanupUploadSession(req.UploadID); err != nil {
-		// 记录清理错误但不使请求失败
-		fmt.Printf("警告: 清理上传会话 %s 失败: %v\n", req.UploadID, err)
+// fileInfoJSON 将文件转换为响应结构
+func fileInfoJSON(file *model.File) api.FileInfo {
+	return api.FileInfo{
+		ID:        file.ID,
+		LibraryID: file.LibraryID,
+		Name:      file.Name,
+		Size:      file.Size,
+		Hash:      file.Hash,
 	}
+}
 
-	c.JSON(http.StatusOK, gin.H{
-		"file": map[string]interface{}{
-			"id":   fileNode.ID,
-			"name": fileNode.Name,
-			"size": fileNode.Size,
-			"hash": fileNode.ContentHash,
-		},
-	})
+// uploadSession 读取上传会话并校验当前用户是发起者，失败时写入响应并返回 false
+func (h *UploadHandler) uploadSession(c *gin.Context, uploadID string) (*service.UploadSession, bool) {
+	if uploadID == "" {
+		writeError(c, http.StatusBadRequest, "uploadId是必需的")
+		return nil, false
+	}
+	session, err := h.service.GetUploadSession(c.Request.Context(), uploadID)
+	if err != nil {
+		writeError(c, http.StatusInternalServerError, "读取上传会话失败")
+		return nil, false
+	}
+	if session == nil {
+		writeError(c, http.StatusNotFound, "上传会话不存在或已过期")
+		return nil, false
+	}
+	if session.OwnerID != 0 && session.OwnerID != c.GetUint("user_id") {
+		writeError(c, http.StatusForbidden, "无权访问该上传会话")
+		return nil, false
+	}
+	return session, true
 }
 
 // RegisterUploadRoutes 设置上传相关的路由
-func RegisterUploadRoutes(r *gin.Engine, fileService *service.FileService) {
-	handler := NewUploadHandler(fileService)
+func RegisterUploadRoutes(r *gin.Engine, fileService *service.FileService, access *service.LibraryAccess) {
+	handler := NewUploadHandler(fileService, access)
 
 	uploadGroup := r.Group("/api/v1/upload")
 	{
-		uploadGroup.GET("/check", handler.CheckFileHandler)   // 检查文件是否存在
-		uploadGroup.POST("/chunk", handler.UploadChunkHandler) // 上传文件分片
-		uploadGroup.POST("/finish", handler.FinishUploadHandler) // 完成上传
+		uploadGroup.GET("/check", handler.CheckFileHandler)                                   // 检查文件是否存在
+		uploadGroup.POST("/sessions", handler.CreateSessionHandler)                           // 创建上传会话
+		uploadGroup.GET("/sessions/:uploadId", handler.SessionStatusHandler)                  // 查询上传进度
+		uploadGroup.PUT("/sessions/:uploadId/chunks/:chunkIndex", handler.UploadChunkHandler) // 上传文件分片
+		uploadGroup.POST("/chunk", handler.UploadChunkHandler)                                // 上传文件分片（元数据在查询参数、请求头或 multipart 中）
+		uploadGroup.POST("/finish", handler.FinishUploadHandler)                              // 完成上传
 	}
-}
\ No newline at end of file
+
+	// tus 断点续传协议，与分片上传共用上传会话和块存储
+	RegisterTusRoutes(r, fileService, access)
+}
@@ -0,0 +1,526 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/sealock/core-storage/chunker"
+	"github.com/sealock/core-storage/model"
+	"github.com/sealock/core-storage/service"
+	"github.com/sealock/core-storage/storage"
+)
+
+// newTestRedis 启动内存中的 Redis 并返回连接它的客户端，测试结束时关闭
+func newTestRedis(t *testing.T) *redis.Client {
+	t.Helper()
+	_, client := newTestRedisServer(t)
+	return client
+}
+
+// newTestRedisServer 与 newTestRedis 相同，同时返回服务端，用于快进时间等操作
+func newTestRedisServer(t *testing.T) (*miniredis.Miniredis, *redis.Client) {
+	t.Helper()
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return server, client
+}
+
+// uploadTestEnv 上传接口的测试环境
+// 用户 1 拥有库 1，用户 2 拥有库 2；请求默认以用户 1 发出，X-Test-User 请求头可以指定其他用户
+type uploadTestEnv struct {
+	router  *gin.Engine
+	service *service.FileService
+	files   storage.FileRepository
+	blocks  storage.BlockStore
+	redis   *miniredis.Miniredis
+}
+
+func newUploadTestEnv(t *testing.T) *uploadTestEnv {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	files := storage.NewMockFileRepository()
+	blocks := storage.NewLocalBlockStore()
+	redisServer, redisClient := newTestRedisServer(t)
+	fileService := service.NewFileService(
+		blocks,
+		files,
+		storage.NewMockBlockRepository(),
+		chunker.NewFixedSizeChunker(4),
+		storage.NewMockSnapshotRepository(),
+		redisClient,
+		true,
+	)
+	t.Cleanup(func() { fileService.Close(context.Background()) })
+
+	libraries := storage.NewMockLibraryRepository()
+	for _, owner := range []uint{1, 2} {
+		if err := libraries.CreateLibrary(context.Background(), &model.Library{Name: fmt.Sprintf("lib%d", owner), OwnerID: owner}); err != nil {
+			t.Fatalf("create library: %v", err)
+		}
+	}
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		userID := uint(1)
+		if raw := c.GetHeader("X-Test-User"); raw != "" {
+			id, _ := strconv.ParseUint(raw, 10, 64)
+			userID = uint(id)
+		}
+		c.Set("user_id", userID)
+	})
+	RegisterUploadRoutes(router, fileService, service.NewLibraryAccess(libraries))
+	return &uploadTestEnv{router: router, service: fileService, files: files, blocks: blocks, redis: redisServer}
+}
+
+func (e *uploadTestEnv) do(req *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	e.router.ServeHTTP(w, req)
+	return w
+}
+
+// createSession 以用户 1 在库 1 中创建上传会话，返回 uploadId
+func (e *uploadTestEnv) createSession(t *testing.T, fileName string, chunks [][]byte) string {
+	t.Helper()
+	status := e.createSessionAs(t, 1, fileName, chunks)
+	return status.Session.UploadID
+}
+
+// createSessionAs 以用户 userID 在其拥有的同号库中创建上传会话
+func (e *uploadTestEnv) createSessionAs(t *testing.T, userID uint, fileName string, chunks [][]byte) service.UploadSessionStatus {
+	t.Helper()
+	hashes := make([]string, len(chunks))
+	var size int
+	for i, chunk := range chunks {
+		hashes[i] = sha256Hex(chunk)
+		size += len(chunk)
+	}
+	body, _ := json.Marshal(map[string]interface{}{
+		"libraryId":   userID,
+		"fileName":    fileName,
+		"fileSize":    size,
+		"chunkHashes": hashes,
+	})
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/upload/sessions", bytes.NewReader(body))
+	req.Header.Set("X-Test-User", strconv.FormatUint(uint64(userID), 10))
+	w := e.do(req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create session: status %d: %s", w.Code, w.Body.String())
+	}
+	var status service.UploadSessionStatus
+	if err := json.Unmarshal(w.Body.Bytes(), &status); err != nil {
+		t.Fatalf("decode session: %v", err)
+	}
+	return status
+}
+
+func (e *uploadTestEnv) finish(uploadID string) *httptest.ResponseRecorder {
+	body := fmt.Sprintf(`{"uploadId":%q}`, uploadID)
+	return e.do(httptest.NewRequest(http.MethodPost, "/api/v1/upload/finish", strings.NewReader(body)))
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestUploadChunkMetadataSources(t *testing.T) {
+	env := newUploadTestEnv(t)
+	chunks := [][]byte{[]byte("aaaa"), []byte("bbbb"), []byte("cccc"), []byte("dd")}
+	uploadID := env.createSession(t, "docs/report.txt", chunks)
+
+	// 乱序上传，每个分片使用不同的元数据形式，请求体均为原始数据
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/upload/chunk", bytes.NewReader(chunks[3]))
+	req.Header.Set("X-Upload-Id", uploadID)
+	req.Header.Set("X-Chunk-Index", "3")
+	req.Header.Set("X-Chunk-Hash", sha256Hex(chunks[3]))
+	if w := env.do(req); w.Code != http.StatusOK {
+		t.Fatalf("headers: status %d: %s", w.Code, w.Body.String())
+	}
+
+	url := fmt.Sprintf("/api/v1/upload/chunk?uploadId=%s&chunkIndex=1&chunkHash=%s", uploadID, sha256Hex(chunks[1]))
+	if w := env.do(httptest.NewRequest(http.MethodPost, url, bytes.NewReader(chunks[1]))); w.Code != http.StatusOK {
+		t.Fatalf("query: status %d: %s", w.Code, w.Body.String())
+	}
+
+	url = fmt.Sprintf("/api/v1/upload/sessions/%s/chunks/2", uploadID)
+	req = httptest.NewRequest(http.MethodPut, url, bytes.NewReader(chunks[2]))
+	req.Header.Set("Content-Type", "application/octet-stream")
+	if w := env.do(req); w.Code != http.StatusOK {
+		t.Fatalf("path: status %d: %s", w.Code, w.Body.String())
+	}
+
+	var form bytes.Buffer
+	mw := multipart.NewWriter(&form)
+	mw.WriteField("uploadId", uploadID)
+	mw.WriteField("chunkIndex", "0")
+	mw.WriteField("chunkHash", sha256Hex(chunks[0]))
+	part, _ := mw.CreateFormFile("chunk", "chunk-0")
+	part.Write(chunks[0])
+	mw.Close()
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/upload/chunk", &form)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	if w := env.do(req); w.Code != http.StatusOK {
+		t.Fatalf("multipart: status %d: %s", w.Code, w.Body.String())
+	}
+
+	w := env.do(httptest.NewRequest(http.MethodGet, "/api/v1/upload/sessions/"+uploadID, nil))
+	var status service.UploadSessionStatus
+	if err := json.Unmarshal(w.Body.Bytes(), &status); err != nil || !status.Complete || len(status.Missing) != 0 {
+		t.Fatalf("status after all chunks: %s", w.Body.String())
+	}
+
+	if w := env.finish(uploadID); w.Code != http.StatusOK {
+		t.Fatalf("finish: status %d: %s", w.Code, w.Body.String())
+	}
+	file, err := env.files.GetFileByPath(context.Background(), 1, "docs/report.txt")
+	if err != nil || file == nil {
+		t.Fatalf("file not created: %v", err)
+	}
+	data, err := env.service.DownloadFile(context.Background(), file.Hash)
+	if err != nil {
+		t.Fatalf("download: %v", err)
+	}
+	if want := "aaaabbbbccccdd"; string(data) != want {
+		t.Fatalf("content = %q, want %q", data, want)
+	}
+}
+
+func TestUploadChunkParallel(t *testing.T) {
+	env := newUploadTestEnv(t)
+	chunks := make([][]byte, 16)
+	var want bytes.Buffer
+	for i := range chunks {
+		chunks[i] = []byte(fmt.Sprintf("%04d", i))
+		want.Write(chunks[i])
+	}
+	uploadID := env.createSession(t, "parallel.bin", chunks)
+
+	var wg sync.WaitGroup
+	errs := make(chan string, len(chunks))
+	for i := len(chunks) - 1; i >= 0; i-- {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			url := fmt.Sprintf("/api/v1/upload/sessions/%s/chunks/%d", uploadID, i)
+			if w := env.do(httptest.NewRequest(http.MethodPut, url, bytes.NewReader(chunks[i]))); w.Code != http.StatusOK {
+				errs <- fmt.Sprintf("chunk %d: status %d: %s", i, w.Code, w.Body.String())
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	if w := env.finish(uploadID); w.Code != http.StatusOK {
+		t.Fatalf("finish: status %d: %s", w.Code, w.Body.String())
+	}
+	file, _ := env.files.GetFileByPath(context.Background(), 1, "parallel.bin")
+	if file == nil {
+		t.Fatal("file not created")
+	}
+	data, err := env.service.DownloadFile(context.Background(), file.Hash)
+	if err != nil || !bytes.Equal(data, want.Bytes()) {
+		t.Fatalf("content = %q, %v", data, err)
+	}
+}
+
+func TestUploadChunkRejectsInvalidChunks(t *testing.T) {
+	env := newUploadTestEnv(t)
+	chunks := [][]byte{[]byte("aaaa"), []byte("bb")}
+	uploadID := env.createSession(t, "invalid.txt", chunks)
+
+	tests := []struct {
+		name string
+		url  string
+		body []byte
+		code int
+	}{
+		{"unknown session", "/api/v1/upload/sessions/missing/chunks/0", chunks[0], http.StatusNotFound},
+		{"missing index", "/api/v1/upload/chunk?uploadId=" + uploadID, chunks[0], http.StatusBadRequest},
+		{"index out of range", "/api/v1/upload/sessions/" + uploadID + "/chunks/2", chunks[0], http.StatusBadRequest},
+		{"wrong content for index", "/api/v1/upload/sessions/" + uploadID + "/chunks/1", chunks[0], http.StatusBadRequest},
+		{"declared hash mismatch", "/api/v1/upload/chunk?uploadId=" + uploadID + "&chunkIndex=0&chunkHash=" + sha256Hex(chunks[1]), chunks[0], http.StatusBadRequest},
+		{"empty body", "/api/v1/upload/sessions/" + uploadID + "/chunks/0", nil, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			method := http.MethodPut
+			if strings.HasPrefix(tt.url, "/api/v1/upload/chunk") {
+				method = http.MethodPost
+			}
+			if w := env.do(httptest.NewRequest(method, tt.url, bytes.NewReader(tt.body))); w.Code != tt.code {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.code, w.Body.String())
+			}
+		})
+	}
+
+	// 只上传了部分分片时不能完成上传，并返回缺失的分片
+	url := "/api/v1/upload/sessions/" + uploadID + "/chunks/0"
+	if w := env.do(httptest.NewRequest(http.MethodPut, url, bytes.NewReader(chunks[0]))); w.Code != http.StatusOK {
+		t.Fatalf("upload chunk 0: status %d: %s", w.Code, w.Body.String())
+	}
+	w := env.finish(uploadID)
+	var resp struct {
+		Missing []int `json:"missing"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if w.Code != http.StatusBadRequest || len(resp.Missing) != 1 || resp.Missing[0] != 1 {
+		t.Fatalf("finish with missing chunk: status %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestUploadReuseScopedToReadableLibraries(t *testing.T) {
+	env := newUploadTestEnv(t)
+	chunks := [][]byte{[]byte("aaaa"), []byte("bbbb")}
+	uploadID := env.createSession(t, "secret.txt", chunks)
+	for i, chunk := range chunks {
+		url := fmt.Sprintf("/api/v1/upload/sessions/%s/chunks/%d", uploadID, i)
+		if w := env.do(httptest.NewRequest(http.MethodPut, url, bytes.NewReader(chunk))); w.Code != http.StatusOK {
+			t.Fatalf("upload chunk %d: status %d: %s", i, w.Code, w.Body.String())
+		}
+	}
+	if w := env.finish(uploadID); w.Code != http.StatusOK {
+		t.Fatalf("finish: status %d: %s", w.Code, w.Body.String())
+	}
+	files, _ := env.files.ListFilesByLibrary(context.Background(), 1)
+	if len(files) != 1 {
+		t.Fatalf("files in library 1 = %d, want 1", len(files))
+	}
+
+	check := func(userID uint) string {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/upload/check?fileHash="+files[0].Hash, nil)
+		req.Header.Set("X-Test-User", strconv.FormatUint(uint64(userID), 10))
+		w := env.do(req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("check as user %d: status %d: %s", userID, w.Code, w.Body.String())
+		}
+		return strings.TrimSpace(w.Body.String())
+	}
+	if body := check(1); body != `{"exists":true}` {
+		t.Fatalf("check as owner = %s", body)
+	}
+	if body := check(2); body != `{"exists":false}` {
+		t.Fatalf("check as another user = %s", body)
+	}
+
+	// 同一用户复用自己库中的分片，其他用户只知道哈希时仍需上传全部分片
+	if status := env.createSessionAs(t, 1, "copy.txt", chunks); !status.Complete {
+		t.Fatalf("owner session missing %v, want complete", status.Missing)
+	}
+	if status := env.createSessionAs(t, 2, "stolen.txt", chunks); status.Complete || len(status.Missing) != 2 {
+		t.Fatalf("other user session: complete %v, missing %v", status.Complete, status.Missing)
+	}
+
+	// 不能在其他用户的库中创建上传会话
+	body := fmt.Sprintf(`{"libraryId":1,"fileName":"x.txt","fileSize":4,"chunkHashes":[%q]}`, sha256Hex(chunks[0]))
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/upload/sessions", strings.NewReader(body))
+	req.Header.Set("X-Test-User", "2")
+	if w := env.do(req); w.Code != http.StatusForbidden {
+		t.Fatalf("session in another library: status %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestUploadChunkMultipartTooLarge(t *testing.T) {
+	env := newUploadTestEnv(t)
+	uploadID := env.createSession(t, "large.bin", [][]byte{[]byte("aaaa")})
+
+	// 超出上限的 multipart 请求体在解析时被截断，而不是整体写入临时文件
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	form.WriteField("uploadId", uploadID)
+	form.WriteField("chunkIndex", "0")
+	part, _ := form.CreateFormFile("chunk", "chunk")
+	part.Write(make([]byte, maxUploadChunkSize+multipartOverhead))
+	form.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/upload/chunk", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	if w := env.do(req); w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("status %d, want 413: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestTusCreateRequiresLibraryAccess(t *testing.T) {
+	env := newUploadTestEnv(t)
+
+	// 用户 2 不能在用户 1 的库中创建上传
+	metadata := "filename " + base64.StdEncoding.EncodeToString([]byte("a.txt")) + ",libraryId " + base64.StdEncoding.EncodeToString([]byte("1"))
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/tus/files", nil)
+	req.Header.Set("Tus-Resumable", tusVersion)
+	req.Header.Set("Upload-Length", "8")
+	req.Header.Set("Upload-Metadata", metadata)
+	req.Header.Set("X-Test-User", "2")
+	if w := env.do(req); w.Code != http.StatusForbidden {
+		t.Fatalf("status %d, want 403: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestTusChecksumMismatchDiscardsBlocks(t *testing.T) {
+	env := newUploadTestEnv(t)
+	env.service.SetStagingGrace(0)
+
+	metadata := "filename " + base64.StdEncoding.EncodeToString([]byte("a.txt")) + ",libraryId " + base64.StdEncoding.EncodeToString([]byte("1"))
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/tus/files", nil)
+	req.Header.Set("Tus-Resumable", tusVersion)
+	req.Header.Set("Upload-Length", "10")
+	req.Header.Set("Upload-Metadata", metadata)
+	w := env.do(req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create: status %d: %s", w.Code, w.Body.String())
+	}
+
+	// 两个完整块写入块存储后校验失败，本次数据不保存，块也不应留在块存储中
+	data := []byte("aaaabbbb")
+	wrong := sha256.Sum256([]byte("other"))
+	req = httptest.NewRequest(http.MethodPatch, w.Header().Get("Location"), bytes.NewReader(data))
+	req.Header.Set("Tus-Resumable", tusVersion)
+	req.Header.Set("Content-Type", "application/offset+octet-stream")
+	req.Header.Set("Upload-Offset", "0")
+	req.Header.Set("Upload-Checksum", "sha256 "+base64.StdEncoding.EncodeToString(wrong[:]))
+	if w := env.do(req); w.Code != statusChecksumMismatch {
+		t.Fatalf("patch: status %d, want %d: %s", w.Code, statusChecksumMismatch, w.Body.String())
+	}
+	for _, block := range [][]byte{data[:4], data[4:]} {
+		if exists, err := env.blocks.Exists(context.Background(), sha256Hex(block)); err != nil || exists {
+			t.Fatalf("block %q exists = %v, %v, want discarded", block, exists, err)
+		}
+	}
+}
+
+// tusRequest 返回带 Tus-Resumable 头的请求
+func tusRequest(method, target string, body []byte) *http.Request {
+	req := httptest.NewRequest(method, target, bytes.NewReader(body))
+	req.Header.Set("Tus-Resumable", tusVersion)
+	if method == http.MethodPatch {
+		req.Header.Set("Content-Type", "application/offset+octet-stream")
+	}
+	return req
+}
+
+// createTus 在库 1 中创建长度为 length 的 tus 上传，返回其 URL
+func (e *uploadTestEnv) createTus(t *testing.T, fileName string, length int) string {
+	t.Helper()
+	req := tusRequest(http.MethodPost, "/api/v1/tus/files", nil)
+	req.Header.Set("Upload-Length", strconv.Itoa(length))
+	req.Header.Set("Upload-Metadata", "filename "+base64.StdEncoding.EncodeToString([]byte(fileName))+
+		",libraryId "+base64.StdEncoding.EncodeToString([]byte("1")))
+	w := e.do(req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create: status %d: %s", w.Code, w.Body.String())
+	}
+	return w.Header().Get("Location")
+}
+
+// patchTus 从 offset 处追加 data
+func (e *uploadTestEnv) patchTus(location string, offset int, data []byte, checksum string) *httptest.ResponseRecorder {
+	req := tusRequest(http.MethodPatch, location, data)
+	req.Header.Set("Upload-Offset", strconv.Itoa(offset))
+	if checksum != "" {
+		req.Header.Set("Upload-Checksum", checksum)
+	}
+	return e.do(req)
+}
+
+func TestTusProtocol(t *testing.T) {
+	env := newUploadTestEnv(t)
+	location := env.createTus(t, "docs/a.txt", 10)
+
+	// 偏移量与服务端记录的不一致时返回 409，数据不被接收
+	if w := env.patchTus(location, 4, []byte("aaaa"), ""); w.Code != http.StatusConflict {
+		t.Fatalf("offset mismatch: status %d, want 409: %s", w.Code, w.Body.String())
+	}
+	sum := sha256.Sum256([]byte("aaaa"))
+	w := env.patchTus(location, 0, []byte("aaaa"), "sha256 "+base64.StdEncoding.EncodeToString(sum[:]))
+	if w.Code != http.StatusNoContent || w.Header().Get("Upload-Offset") != "4" {
+		t.Fatalf("patch: status %d, offset %q: %s", w.Code, w.Header().Get("Upload-Offset"), w.Body.String())
+	}
+
+	// 校验和不符时返回 460，偏移量保持不变
+	if w := env.patchTus(location, 4, []byte("bbbb"), "sha256 "+base64.StdEncoding.EncodeToString(sum[:])); w.Code != statusChecksumMismatch {
+		t.Fatalf("bad checksum: status %d, want %d: %s", w.Code, statusChecksumMismatch, w.Body.String())
+	}
+	w = env.do(tusRequest(http.MethodHead, location, nil))
+	if w.Code != http.StatusOK || w.Header().Get("Upload-Offset") != "4" || w.Header().Get("Upload-Length") != "10" {
+		t.Fatalf("head: status %d, offset %q", w.Code, w.Header().Get("Upload-Offset"))
+	}
+
+	if w := env.patchTus(location, 4, []byte("bbbbcc"), ""); w.Code != http.StatusNoContent || w.Header().Get("Upload-File-Hash") == "" {
+		t.Fatalf("final patch: status %d: %s", w.Code, w.Body.String())
+	}
+	file, _ := env.files.GetFileByPath(context.Background(), 1, "docs/a.txt")
+	if file == nil || file.Size != 10 {
+		t.Fatalf("completed upload = %+v", file)
+	}
+
+	// 缺少 Tus-Resumable 的请求被拒绝
+	req := httptest.NewRequest(http.MethodHead, location, nil)
+	if w := env.do(req); w.Code != http.StatusPreconditionFailed {
+		t.Fatalf("without Tus-Resumable: status %d, want 412", w.Code)
+	}
+}
+
+func TestTusExpiredUpload(t *testing.T) {
+	env := newUploadTestEnv(t)
+	location := env.createTus(t, "a.txt", 8)
+	if w := env.patchTus(location, 0, []byte("aaaa"), ""); w.Code != http.StatusNoContent {
+		t.Fatalf("patch: status %d: %s", w.Code, w.Body.String())
+	}
+
+	// 上传状态过期后 HEAD、PATCH、DELETE 都按不存在处理
+	env.redis.FastForward(service.DefaultUploadSessionTTL + 2*time.Hour)
+	if w := env.do(tusRequest(http.MethodHead, location, nil)); w.Code != http.StatusNotFound {
+		t.Fatalf("head expired: status %d, want 404", w.Code)
+	}
+	if w := env.patchTus(location, 4, []byte("bbbb"), ""); w.Code != http.StatusNotFound {
+		t.Fatalf("patch expired: status %d, want 404: %s", w.Code, w.Body.String())
+	}
+	if w := env.do(tusRequest(http.MethodDelete, location, nil)); w.Code != http.StatusNotFound {
+		t.Fatalf("delete expired: status %d, want 404", w.Code)
+	}
+}
+
+func TestTusDeleteFreesBlocks(t *testing.T) {
+	env := newUploadTestEnv(t)
+	env.service.SetStagingGrace(0)
+	location := env.createTus(t, "a.txt", 12)
+	if w := env.patchTus(location, 0, []byte("aaaabbbb"), ""); w.Code != http.StatusNoContent {
+		t.Fatalf("patch: status %d: %s", w.Code, w.Body.String())
+	}
+	for _, block := range []string{"aaaa", "bbbb"} {
+		if exists, _ := env.blocks.Exists(context.Background(), sha256Hex([]byte(block))); !exists {
+			t.Fatalf("block %q was not stored", block)
+		}
+	}
+
+	if w := env.do(tusRequest(http.MethodDelete, location, nil)); w.Code != http.StatusNoContent {
+		t.Fatalf("delete: status %d: %s", w.Code, w.Body.String())
+	}
+	for _, block := range []string{"aaaa", "bbbb"} {
+		if exists, err := env.blocks.Exists(context.Background(), sha256Hex([]byte(block))); err != nil || exists {
+			t.Fatalf("block %q exists = %v, %v after delete", block, exists, err)
+		}
+	}
+	if w := env.do(tusRequest(http.MethodHead, location, nil)); w.Code != http.StatusNotFound {
+		t.Fatalf("head after delete: status %d, want 404", w.Code)
+	}
+}
@@ -0,0 +1,101 @@
+package handler
+
+import (
+	"log"
+	"mime"
+	"net/http"
+	"path"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sealock/core-storage/middleware"
+	"github.com/sealock/core-storage/service"
+	"golang.org/x/net/webdav"
+)
+
+// webdavPrefix WebDAV 服务的挂载路径
+const webdavPrefix = "/dav"
+
+// webdavMethods WebDAV 处理的全部请求方法
+var webdavMethods = []string{
+	http.MethodOptions, http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodDelete,
+	"PROPFIND", "PROPPATCH", "MKCOL", "COPY", "MOVE", "LOCK", "UNLOCK",
+}
+
+// WebDAVHandler 以 WebDAV 协议提供用户的库，可在 Finder、资源管理器或 davfs 中挂载
+type WebDAVHandler struct {
+	fs    *service.WebDAVFileSystem
+	locks sync.Map // 用户ID → webdav.LockSystem，不同用户的同名库互不影响
+}
+
+// NewWebDAVHandler 创建新的WebDAVHandler实例
+func NewWebDAVHandler(fs *service.WebDAVFileSystem) *WebDAVHandler {
+	return &WebDAVHandler{fs: fs}
+}
+
+// ServeDAVHandler 处理 WebDAV 请求
+// PROPFIND/GET/PUT/MKCOL/MOVE/COPY/DELETE/LOCK/UNLOCK /dav/{库名}/{路径}
+// 根目录列出当前用户的库；锁保存在内存中，服务重启后失效
+func (h *WebDAVHandler) ServeDAVHandler(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	locks, _ := h.locks.LoadOrStore(userID, webdav.NewMemLS())
+
+	var w http.ResponseWriter = c.Writer
+	switch c.Request.Method {
+	case http.MethodPut:
+		c.Request = service.WithDAVRequestBody(c.Request)
+	case http.MethodGet, http.MethodHead, http.MethodPost:
+		w = &davContentWriter{ResponseWriter: c.Writer, name: path.Base(c.Request.URL.Path)}
+	}
+
+	dav := &webdav.Handler{
+		Prefix:     webdavPrefix,
+		FileSystem: h.fs.ForUser(userID),
+		LockSystem: locks.(webdav.LockSystem),
+		Logger: func(r *http.Request, err error) {
+			if err != nil {
+				log.Printf("webdav: %s %s: %v", r.Method, r.URL.Path, err)
+			}
+		},
+	}
+	dav.ServeHTTP(w, c.Request)
+}
+
+// davContentWriter 与文件下载接口一样处理 WebDAV 读取的响应头：禁止内容嗅探，
+// 网页、SVG、脚本等会被浏览器执行的内容以附件形式返回，不在本站点下直接打开
+type davContentWriter struct {
+	http.ResponseWriter
+	name        string
+	wroteHeader bool
+}
+
+func (w *davContentWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		header := w.Header()
+		header.Set("X-Content-Type-Options", "nosniff")
+		if (code == http.StatusOK || code == http.StatusPartialContent) && isActiveContent(header.Get("Content-Type")) {
+			header.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": w.name}))
+		}
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *davContentWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// RegisterWebDAVRoutes 设置 WebDAV 路由
+// 使用用户令牌认证：Bearer 令牌，或在 Basic 认证的密码中填写 API 令牌（用户名任意）
+func RegisterWebDAVRoutes(r *gin.Engine, fs *service.WebDAVFileSystem) {
+	handler := NewWebDAVHandler(fs)
+
+	davGroup := r.Group(webdavPrefix, middleware.TokenAuth("Sealock"))
+	for _, method := range webdavMethods {
+		davGroup.Handle(method, "", handler.ServeDAVHandler)       // 根目录
+		davGroup.Handle(method, "/*path", handler.ServeDAVHandler) // 库及其中的文件和目录
+	}
+}
@@ -0,0 +1,89 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sealock/core-storage/chunker"
+	"github.com/sealock/core-storage/model"
+	"github.com/sealock/core-storage/service"
+	"github.com/sealock/core-storage/storage"
+)
+
+// failingBody 读出部分内容后连接中断的请求体
+type failingBody struct {
+	r io.Reader
+}
+
+func (b *failingBody) Read(p []byte) (int, error) {
+	n, err := b.r.Read(p)
+	if err == io.EOF {
+		return n, errors.New("connection reset")
+	}
+	return n, err
+}
+
+func TestWebDAVHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+	files := service.NewFileService(storage.NewLocalBlockStore(), storage.NewMockFileRepository(), storage.NewMockBlockRepository(),
+		chunker.NewFixedSizeChunker(4), storage.NewMockSnapshotRepository(), newTestRedis(t), true)
+	t.Cleanup(func() { files.Close(ctx) })
+	libraries := storage.NewMockLibraryRepository()
+	lib := &model.Library{Name: "docs", OwnerID: 1}
+	if err := libraries.CreateLibrary(ctx, lib); err != nil {
+		t.Fatalf("create library: %v", err)
+	}
+
+	// 跳过令牌认证，直接以用户 1 访问
+	handler := NewWebDAVHandler(service.NewWebDAVFileSystem(files, libraries, nil))
+	router := gin.New()
+	router.Use(func(c *gin.Context) { c.Set("user_id", uint(1)) })
+	for _, method := range webdavMethods {
+		router.Handle(method, webdavPrefix+"/*path", handler.ServeDAVHandler)
+	}
+	do := func(req *http.Request) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := do(httptest.NewRequest(http.MethodPut, "/dav/docs/notes.txt", strings.NewReader("original"))); w.Code != http.StatusCreated {
+		t.Fatalf("put: status %d: %s", w.Code, w.Body.String())
+	}
+
+	// 中断的上传和内容短于 Content-Length 的上传都不覆盖原有文件
+	req := httptest.NewRequest(http.MethodPut, "/dav/docs/notes.txt", &failingBody{r: strings.NewReader("trunc")})
+	req.ContentLength = -1
+	if w := do(req); w.Code < 400 {
+		t.Fatalf("interrupted put: status %d, want an error", w.Code)
+	}
+	req = httptest.NewRequest(http.MethodPut, "/dav/docs/notes.txt", strings.NewReader("short"))
+	req.ContentLength = 100
+	if w := do(req); w.Code < 400 {
+		t.Fatalf("short put: status %d, want an error", w.Code)
+	}
+	w := do(httptest.NewRequest(http.MethodGet, "/dav/docs/notes.txt", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "original" {
+		t.Fatalf("get: status %d, body %q, want the original content", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get("Content-Disposition"); got != "" {
+		t.Fatalf("text file Content-Disposition = %q, want inline", got)
+	}
+
+	// 网页以附件形式返回
+	if w := do(httptest.NewRequest(http.MethodPut, "/dav/docs/page.html", strings.NewReader("<script>alert(1)</script>"))); w.Code != http.StatusCreated {
+		t.Fatalf("put html: status %d: %s", w.Code, w.Body.String())
+	}
+	w = do(httptest.NewRequest(http.MethodGet, "/dav/docs/page.html", nil))
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Disposition"), "attachment") ||
+		w.Header().Get("X-Content-Type-Options") != "nosniff" {
+		t.Fatalf("get html: status %d, headers %v", w.Code, w.Header())
+	}
+}
@@ -0,0 +1,268 @@
+// Package ignore 实现 gitignore 风格的忽略规则和选择性同步过滤
+//
+// 支持的语法与 .gitignore 相同：
+//   - 空行和以 # 开头的行被忽略
+//   - 以 ! 开头表示取反（重新包含），后出现的规则优先
+//   - 以 / 结尾只匹配目录
+//   - 包含 /（末尾除外）的模式相对库根目录锚定，否则匹配任意层级的名称
+//   - 支持 *、?、[...] 和 **
+//
+// 被排除的目录下的文件无法再被取反规则重新包含（与 git 一致）
+package ignore
+
+import (
+	"bufio"
+	"bytes"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// FileName 库根目录下的忽略规则文件，随库一起版本化
+const FileName = ".sealockignore"
+
+// rule 单条忽略规则
+type rule struct {
+	pattern string
+	re      *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// Matcher 一组有序的忽略规则
+type Matcher struct {
+	rules []rule
+}
+
+// Parse 解析忽略文件内容
+func Parse(data []byte) *Matcher {
+	var lines []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	return ParseLines(lines)
+}
+
+// ParseLines 解析忽略规则列表，无效的模式被跳过
+func ParseLines(lines []string) *Matcher {
+	m := &Matcher{}
+	for _, line := range lines {
+		if r, ok := parseRule(line); ok {
+			m.rules = append(m.rules, r)
+		}
+	}
+	return m
+}
+
+// Merge 按顺序合并多组规则，后面的规则优先
+func Merge(matchers ...*Matcher) *Matcher {
+	merged := &Matcher{}
+	for _, m := range matchers {
+		if m != nil {
+			merged.rules = append(merged.rules, m.rules...)
+		}
+	}
+	return merged
+}
+
+// Empty 是否没有任何规则
+func (m *Matcher) Empty() bool {
+	return m == nil || len(m.rules) == 0
+}
+
+// Patterns 返回规则的原始文本
+func (m *Matcher) Patterns() []string {
+	if m == nil {
+		return nil
+	}
+	patterns := make([]string, len(m.rules))
+	for i, r := range m.rules {
+		patterns[i] = r.pattern
+	}
+	return patterns
+}
+
+// Ignored 判断库内路径是否被忽略，路径的任一上级目录被忽略时也视为忽略
+func (m *Matcher) Ignored(p string, isDir bool) bool {
+	if m.Empty() {
+		return false
+	}
+	p = strings.Trim(p, "/")
+	if p == "" {
+		return false
+	}
+	for i := 0; i < len(p); i++ {
+		if p[i] == '/' && m.match(p[:i], true) {
+			return true
+		}
+	}
+	return m.match(p, isDir)
+}
+
+// match 只判断路径本身，最后一条匹配的规则决定结果
+func (m *Matcher) match(p string, isDir bool) bool {
+	ignored := false
+	for _, r := range m.rules {
+		if r.dirOnly && !isDir {
+			continue
+		}
+		if r.re.MatchString(p) {
+			ignored = !r.negate
+		}
+	}
+	return ignored
+}
+
+// parseRule 把一行 gitignore 模式转换为正则表达式
+func parseRule(line string) (rule, bool) {
+	original := line
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return rule{}, false
+	}
+
+	r := rule{pattern: original}
+	if strings.HasPrefix(line, "!") {
+		r.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\`) {
+		line = line[1:] // \# 和 \! 表示字面量
+	}
+	if strings.HasSuffix(line, "/") {
+		r.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if line == "" {
+		return rule{}, false
+	}
+
+	anchored := strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+
+	var expr strings.Builder
+	expr.WriteString("^")
+	if !anchored {
+		expr.WriteString("(?:.*/)?")
+	}
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch c {
+		case '*':
+			if i+1 < len(line) && line[i+1] == '*' {
+				atStart := i == 0 || line[i-1] == '/'
+				switch {
+				case atStart && i+2 < len(line) && line[i+2] == '/':
+					expr.WriteString("(?:.*/)?") // **/
+					i += 2
+				case atStart && i+2 == len(line):
+					expr.WriteString(".*") // 末尾的 /**
+					i++
+				default:
+					expr.WriteString("[^/]*")
+					i++
+				}
+				continue
+			}
+			expr.WriteString("[^/]*")
+		case '?':
+			expr.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(line[i+1:], ']')
+			if end < 0 {
+				expr.WriteString(`\[`)
+				continue
+			}
+			class := line[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			expr.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		case '\\':
+			if i+1 < len(line) {
+				i++
+				expr.WriteString(regexp.QuoteMeta(string(line[i])))
+			}
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	expr.WriteString("$")
+
+	re, err := regexp.Compile(expr.String())
+	if err != nil {
+		return rule{}, false
+	}
+	r.re = re
+	return r, true
+}
+
+// Filter 同步范围过滤器：忽略规则 + 选择性同步的子树
+// 忽略文件本身始终参与同步，保证所有客户端看到同一份规则
+type Filter struct {
+	matcher *Matcher
+	include []string
+}
+
+// NewFilter 创建过滤器
+// include 为选择性同步的子树（库内目录或文件路径），为空表示同步整个库
+func NewFilter(matcher *Matcher, include []string) *Filter {
+	f := &Filter{matcher: matcher}
+	for _, p := range include {
+		p = strings.Trim(path.Clean("/"+p), "/")
+		if p == "" {
+			// 包含根目录等价于不限制
+			f.include = nil
+			break
+		}
+		f.include = append(f.include, p)
+	}
+	return f
+}
+
+// Excluded 判断文件是否不参与同步
+func (f *Filter) Excluded(filePath string) bool {
+	if f == nil {
+		return false
+	}
+	filePath = strings.Trim(filePath, "/")
+	if filePath == FileName {
+		return false
+	}
+	if len(f.include) > 0 && !f.underInclude(filePath) {
+		return true
+	}
+	return f.matcher.Ignored(filePath, false)
+}
+
+// ExcludedDir 判断目录下的所有内容是否都不参与同步（扫描时可整体跳过）
+func (f *Filter) ExcludedDir(dir string) bool {
+	if f == nil {
+		return false
+	}
+	dir = strings.Trim(dir, "/")
+	if dir == "" {
+		return false
+	}
+	if len(f.include) > 0 && !f.underInclude(dir) {
+		// 选中的子树位于该目录之下时仍需进入
+		for _, inc := range f.include {
+			if strings.HasPrefix(inc, dir+"/") {
+				return f.matcher.Ignored(dir, true)
+			}
+		}
+		return true
+	}
+	return f.matcher.Ignored(dir, true)
+}
+
+// underInclude 路径是否位于某个选中的子树中
+func (f *Filter) underInclude(p string) bool {
+	for _, inc := range f.include {
+		if p == inc || strings.HasPrefix(p, inc+"/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,97 @@
+package ignore
+
+import "testing"
+
+func TestMatcherIgnored(t *testing.T) {
+	tests := []struct {
+		name    string
+		rules   []string
+		path    string
+		isDir   bool
+		ignored bool
+	}{
+		{name: "extension", rules: []string{"*.log"}, path: "a.log", ignored: true},
+		{name: "extension in subdirectory", rules: []string{"*.log"}, path: "dir/sub/a.log", ignored: true},
+		{name: "extension is not a prefix match", rules: []string{"*.log"}, path: "a.logx"},
+		{name: "dot is literal", rules: []string{"a.b"}, path: "axb"},
+		{name: "leading slash anchors", rules: []string{"/build"}, path: "build", isDir: true, ignored: true},
+		{name: "anchored does not match deeper", rules: []string{"/build"}, path: "src/build", isDir: true},
+		{name: "directory only skips files", rules: []string{"build/"}, path: "build"},
+		{name: "directory only matches directory", rules: []string{"build/"}, path: "build", isDir: true, ignored: true},
+		{name: "files under ignored directory", rules: []string{"build/"}, path: "src/build/out.o", ignored: true},
+		{name: "inner slash anchors", rules: []string{"doc/*.txt"}, path: "doc/a.txt", ignored: true},
+		{name: "star does not cross directories", rules: []string{"doc/*.txt"}, path: "doc/sub/a.txt"},
+		{name: "inner slash pattern not matched deeper", rules: []string{"doc/*.txt"}, path: "x/doc/a.txt"},
+		{name: "leading double star at root", rules: []string{"**/tmp"}, path: "tmp", isDir: true, ignored: true},
+		{name: "leading double star nested", rules: []string{"**/tmp"}, path: "a/b/tmp", isDir: true, ignored: true},
+		{name: "trailing double star", rules: []string{"logs/**"}, path: "logs/a/b", ignored: true},
+		{name: "trailing double star excludes directory itself", rules: []string{"logs/**"}, path: "logs", isDir: true},
+		{name: "inner double star matches zero directories", rules: []string{"a/**/b"}, path: "a/b", ignored: true},
+		{name: "inner double star matches several directories", rules: []string{"a/**/b"}, path: "a/x/y/b", ignored: true},
+		{name: "question mark is one character", rules: []string{"file?.txt"}, path: "file1.txt", ignored: true},
+		{name: "question mark is not two characters", rules: []string{"file?.txt"}, path: "file12.txt"},
+		{name: "character class", rules: []string{"[abc].md"}, path: "a.md", ignored: true},
+		{name: "character class miss", rules: []string{"[abc].md"}, path: "d.md"},
+		{name: "negated character class", rules: []string{"[!abc].md"}, path: "d.md", ignored: true},
+		{name: "negated character class miss", rules: []string{"[!abc].md"}, path: "a.md"},
+		{name: "negation re-includes", rules: []string{"*.log", "!keep.log"}, path: "keep.log"},
+		{name: "negation leaves others ignored", rules: []string{"*.log", "!keep.log"}, path: "x.log", ignored: true},
+		{name: "later rule wins", rules: []string{"!keep.log", "*.log"}, path: "keep.log", ignored: true},
+		{name: "negation cannot re-include under ignored directory", rules: []string{"build/", "!build/keep.txt"}, path: "build/keep.txt", ignored: true},
+		{name: "escaped hash", rules: []string{`\#notes`}, path: "#notes", ignored: true},
+		{name: "escaped bang is not negation", rules: []string{`\!important`}, path: "!important", ignored: true},
+		{name: "trailing spaces trimmed", rules: []string{"*.tmp  "}, path: "a.tmp", ignored: true},
+		{name: "comments and blank lines", rules: []string{"# *.log", ""}, path: "a.log"},
+		{name: "root is never ignored", rules: []string{"*"}, path: "/", isDir: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := ParseLines(tt.rules)
+			if got := m.Ignored(tt.path, tt.isDir); got != tt.ignored {
+				t.Errorf("rules %q: Ignored(%q, %v) = %v, want %v", tt.rules, tt.path, tt.isDir, got, tt.ignored)
+			}
+		})
+	}
+}
+
+func TestFilter(t *testing.T) {
+	filter := NewFilter(ParseLines([]string{"*.log", ".sealockignore"}), []string{"docs", "src/app/"})
+
+	excluded := []struct {
+		path     string
+		excluded bool
+	}{
+		{path: "docs/readme.md"},
+		{path: "docs/debug.log", excluded: true},
+		{path: "src/app/main.go"},
+		{path: "src/lib/util.go", excluded: true},
+		{path: "README.md", excluded: true},
+		{path: FileName},
+	}
+	for _, tt := range excluded {
+		if got := filter.Excluded(tt.path); got != tt.excluded {
+			t.Errorf("Excluded(%q) = %v, want %v", tt.path, got, tt.excluded)
+		}
+	}
+
+	dirs := []struct {
+		dir      string
+		excluded bool
+	}{
+		{dir: ""},
+		{dir: "docs"},
+		{dir: "src"},
+		{dir: "src/lib", excluded: true},
+		{dir: "other", excluded: true},
+	}
+	for _, tt := range dirs {
+		if got := filter.ExcludedDir(tt.dir); got != tt.excluded {
+			t.Errorf("ExcludedDir(%q) = %v, want %v", tt.dir, got, tt.excluded)
+		}
+	}
+
+	if all := NewFilter(nil, []string{"docs", "/"}); all.Excluded("anything/else.txt") {
+		t.Error("including the root should not restrict the filter")
+	}
+}
@@ -61,6 +61,8 @@ func demonstrateLocalStorage(ctx context.Context) error {
 		redisClient,
 		true,
 	)
+	// 退出前执行尚未完成的自动提交
+	defer fileSvc.Close(context.Background())
 
 	// 创建上下文用于演示
 	demoCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
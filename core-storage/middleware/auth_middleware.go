@@ -16,6 +16,34 @@ const (
 	GuestRole        = "guest"
 )
 
+// JWTSecret 签发和校验用户令牌（JWT）的 HMAC 密钥，服务启动时可从配置覆盖
+var JWTSecret = []byte("your-secret-key")
+
+// ParseUserToken 校验用户令牌并返回其中的用户ID
+// 令牌为 HMAC 签名的 JWT，user_id 声明为用户ID；API 令牌即长期有效的同类 JWT
+func ParseUserToken(tokenString string) (uint, error) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		// 验证签名算法
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errors.New("无效的签名算法")
+		}
+		return JWTSecret, nil
+	})
+	if err != nil || !token.Valid {
+		return 0, errors.New("无效或过期的令牌")
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return 0, errors.New("无效的令牌声明")
+	}
+	userID, ok := claims["user_id"].(float64)
+	if !ok || userID <= 0 {
+		return 0, errors.New("令牌中缺少用户ID")
+	}
+	return uint(userID), nil
+}
+
 // AuthMiddleware JWT鉴权中间件
 // 实现资料库（Repo）级别的权限校验，支持Owner/Collaborator/Guest三种角色
 // 针对敏感操作（删除库、修改成员）增加二级验证逻辑
@@ -38,30 +66,10 @@ func AuthMiddleware() gin.HandlerFunc {
 		tokenString := tokenParts[1]
 
 		// 3. 解析并验证JWT
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			// 验证签名算法
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, errors.New("无效的签名算法")
-			}
-			// 返回密钥（应从配置获取）
-			return []byte("your-secret-key"), nil
-		})
-
-		if err != nil || !token.Valid {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "无效或过期的令牌"})
-			return
-		}
-
 		// 4. 提取用户信息
-		claims, ok := token.Claims.(jwt.MapClaims)
-		if !ok {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "无效的令牌声明"})
-			return
-		}
-
-		userID, ok := claims["user_id"].(float64)
-		if !ok {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "令牌中缺少用户ID"})
+		userID, err := ParseUserToken(tokenString)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 			return
 		}
 
@@ -98,7 +106,7 @@ func AuthMiddleware() gin.HandlerFunc {
 		}
 
 		// 9. 将用户ID和角色存入上下文
-		c.Set("user_id", uint(userID))
+		c.Set("user_id", userID)
 		c.Set("repo_role", role)
 		c.Set("repo_id", repoID)
 
@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sealock/core-storage/api"
+	"github.com/sealock/core-storage/service"
+	"github.com/sealock/core-storage/storage"
+)
+
+// LibraryAccess rejects requests for libraries the authenticated user cannot access
+// It applies to routes with a :libraryId parameter and must run after TokenAuth, which sets
+// "user_id". Routes that reach a library through another resource (a file, snapshot or
+// upload session) check access in their handlers.
+func LibraryAccess(access *service.LibraryAccess) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		raw := c.Param("libraryId")
+		if raw == "" {
+			c.Next()
+			return
+		}
+		id, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, api.Error{Code: api.CodeInvalidRequest, Message: "无效的库ID"})
+			return
+		}
+
+		err = access.Check(c.Request.Context(), c.GetUint("user_id"), uint(id))
+		switch {
+		case err == nil:
+			c.Next()
+		case errors.Is(err, storage.ErrLibraryNotFound):
+			c.AbortWithStatusJSON(http.StatusNotFound, api.Error{Code: api.CodeNotFound, Message: "库不存在"})
+		case errors.Is(err, service.ErrLibraryAccessDenied):
+			c.AbortWithStatusJSON(http.StatusForbidden, api.Error{Code: api.CodeForbidden, Message: "无权访问该库"})
+		default:
+			c.AbortWithStatusJSON(http.StatusInternalServerError, api.Error{Code: api.CodeInternal, Message: "获取库失败"})
+		}
+	}
+}
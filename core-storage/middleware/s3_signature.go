@@ -0,0 +1,424 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SigV4 签名相关的常量
+const (
+	s3Algorithm        = "AWS4-HMAC-SHA256"
+	s3DateFormat       = "20060102T150405Z"
+	s3MaxClockSkew     = 15 * time.Minute   // 签名时间与服务器时间允许的最大偏差
+	s3MaxPresignExpiry = 7 * 24 * time.Hour // 预签名 URL 的最长有效期，与 S3 一致
+
+	s3UnsignedPayload  = "UNSIGNED-PAYLOAD"
+	s3StreamingPayload = "STREAMING-AWS4-HMAC-SHA256-PAYLOAD"
+	s3StreamingTrailer = "STREAMING-AWS4-HMAC-SHA256-PAYLOAD-TRAILER"
+	s3UnsignedTrailer  = "STREAMING-UNSIGNED-PAYLOAD-TRAILER"
+)
+
+// 上下文中保存分块签名校验器和请求体哈希声明的键
+const (
+	s3ChunkSignerKey = "s3_chunk_signer"
+	s3PayloadHashKey = "s3_payload_hash"
+)
+
+var (
+	// ErrS3SignatureMismatch 请求体分块的签名与计算结果不一致
+	ErrS3SignatureMismatch = errors.New("s3 chunk signature does not match")
+	// ErrS3ContentSHA256Mismatch 请求体与签名中声明的 x-amz-content-sha256 不一致
+	ErrS3ContentSHA256Mismatch = errors.New("s3 payload does not match x-amz-content-sha256")
+)
+
+// emptySHA256 空内容的 SHA-256，分块签名的待签字符串中使用
+var emptySHA256 = hex.EncodeToString(sha256.New().Sum(nil))
+
+// s3AuthError 认证失败时返回的 S3 错误
+type s3AuthError struct {
+	status  int
+	code    string
+	message string
+}
+
+func (e *s3AuthError) Error() string {
+	return e.code + ": " + e.message
+}
+
+// s3Denied 返回 S3 认证错误
+func s3Denied(status int, code, message string) error {
+	return &s3AuthError{status: status, code: code, message: message}
+}
+
+// s3Signature 从请求中解析出的 SigV4 签名参数
+type s3Signature struct {
+	accessKey     string
+	amzDate       string   // 签名时间（ISO 8601 基本格式）
+	scope         string   // <日期>/<区域>/s3/aws4_request
+	signedHeaders []string // 参与签名的请求头（小写，已排序）
+	signature     string
+	payloadHash   string // x-amz-content-sha256，预签名 URL 为 UNSIGNED-PAYLOAD
+	presigned     bool
+}
+
+// isSigV4 请求是否带有 SigV4 签名（Authorization 头或预签名 URL）
+func isSigV4(r *http.Request) bool {
+	return strings.HasPrefix(r.Header.Get("Authorization"), s3Algorithm+" ") || r.URL.Query().Has("X-Amz-Signature")
+}
+
+// isSigV2 请求是否带有已不再支持的 SigV2 签名
+func isSigV2(r *http.Request) bool {
+	query := r.URL.Query()
+	return strings.HasPrefix(r.Header.Get("Authorization"), "AWS ") || query.Has("AWSAccessKeyId") || query.Has("Signature")
+}
+
+// parseS3Signature 解析并检查请求的 SigV4 签名参数，包括签名时间和预签名 URL 的有效期
+// 带 Content-Encoding 的请求必须对它签名：它决定请求体的解码方式，未签名时可被篡改
+func parseS3Signature(r *http.Request, now time.Time) (*s3Signature, error) {
+	var sig *s3Signature
+	var err error
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, s3Algorithm+" ") {
+		sig, err = parseS3AuthorizationHeader(r, auth, now)
+	} else {
+		sig, err = parseS3PresignedQuery(r, now)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if r.Header.Get("Content-Encoding") != "" && !contains(sig.signedHeaders, "content-encoding") {
+		return nil, s3Denied(http.StatusForbidden, "AccessDenied", "请求头 content-encoding 必须参与签名")
+	}
+	return sig, nil
+}
+
+// parseS3AuthorizationHeader 解析 Authorization 头中的签名
+// AWS4-HMAC-SHA256 Credential=<key>/<date>/<region>/s3/aws4_request, SignedHeaders=..., Signature=...
+func parseS3AuthorizationHeader(r *http.Request, auth string, now time.Time) (*s3Signature, error) {
+	fields := make(map[string]string)
+	for _, field := range strings.Split(strings.TrimPrefix(auth, s3Algorithm+" "), ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(field), "=")
+		fields[name] = value
+	}
+	if fields["Credential"] == "" || fields["SignedHeaders"] == "" || fields["Signature"] == "" {
+		return nil, s3Denied(http.StatusBadRequest, "AuthorizationHeaderMalformed", "Authorization 头缺少 Credential、SignedHeaders 或 Signature")
+	}
+
+	sig := &s3Signature{signature: fields["Signature"], payloadHash: r.Header.Get("X-Amz-Content-Sha256")}
+	dateHeader := "x-amz-date"
+	sig.amzDate = r.Header.Get("X-Amz-Date")
+	if sig.amzDate == "" {
+		date, err := http.ParseTime(r.Header.Get("Date"))
+		if err != nil {
+			return nil, s3Denied(http.StatusForbidden, "AccessDenied", "缺少 X-Amz-Date 或 Date 请求头")
+		}
+		dateHeader = "date"
+		sig.amzDate = date.UTC().Format(s3DateFormat)
+	}
+	if sig.payloadHash == "" {
+		return nil, s3Denied(http.StatusBadRequest, "InvalidRequest", "缺少 x-amz-content-sha256 请求头")
+	}
+	if err := sig.parseCredential(fields["Credential"], http.StatusBadRequest, "AuthorizationHeaderMalformed"); err != nil {
+		return nil, err
+	}
+	if err := sig.parseSignedHeaders(fields["SignedHeaders"], "host", dateHeader, "x-amz-content-sha256"); err != nil {
+		return nil, err
+	}
+
+	date, err := time.Parse(s3DateFormat, sig.amzDate)
+	if err != nil {
+		return nil, s3Denied(http.StatusForbidden, "AccessDenied", "无效的签名时间")
+	}
+	if skew := now.Sub(date); skew > s3MaxClockSkew || skew < -s3MaxClockSkew {
+		return nil, s3Denied(http.StatusForbidden, "RequestTimeTooSkewed", "请求时间与服务器时间相差过大")
+	}
+	return sig, nil
+}
+
+// parseS3PresignedQuery 解析预签名 URL 的查询参数，并检查 X-Amz-Expires 指定的有效期
+func parseS3PresignedQuery(r *http.Request, now time.Time) (*s3Signature, error) {
+	query := r.URL.Query()
+	if query.Get("X-Amz-Algorithm") != s3Algorithm {
+		return nil, s3Denied(http.StatusBadRequest, "AuthorizationQueryParametersError", "X-Amz-Algorithm 必须为 "+s3Algorithm)
+	}
+	for _, name := range []string{"X-Amz-Credential", "X-Amz-Date", "X-Amz-Expires", "X-Amz-SignedHeaders", "X-Amz-Signature"} {
+		if query.Get(name) == "" {
+			return nil, s3Denied(http.StatusBadRequest, "AuthorizationQueryParametersError", "预签名 URL 缺少 "+name)
+		}
+	}
+
+	sig := &s3Signature{
+		amzDate:     query.Get("X-Amz-Date"),
+		signature:   query.Get("X-Amz-Signature"),
+		payloadHash: s3UnsignedPayload,
+		presigned:   true,
+	}
+	if hash := query.Get("X-Amz-Content-Sha256"); hash != "" {
+		sig.payloadHash = hash
+	}
+	if err := sig.parseCredential(query.Get("X-Amz-Credential"), http.StatusBadRequest, "AuthorizationQueryParametersError"); err != nil {
+		return nil, err
+	}
+	if err := sig.parseSignedHeaders(query.Get("X-Amz-SignedHeaders"), "host"); err != nil {
+		return nil, err
+	}
+
+	date, err := time.Parse(s3DateFormat, sig.amzDate)
+	if err != nil {
+		return nil, s3Denied(http.StatusBadRequest, "AuthorizationQueryParametersError", "无效的 X-Amz-Date")
+	}
+	seconds, err := strconv.Atoi(query.Get("X-Amz-Expires"))
+	if err != nil || seconds <= 0 || time.Duration(seconds)*time.Second > s3MaxPresignExpiry {
+		return nil, s3Denied(http.StatusBadRequest, "AuthorizationQueryParametersError", "X-Amz-Expires 必须在 1 秒到 7 天之间")
+	}
+	if date.Sub(now) > s3MaxClockSkew {
+		return nil, s3Denied(http.StatusForbidden, "AccessDenied", "预签名 URL 尚未生效")
+	}
+	if now.After(date.Add(time.Duration(seconds) * time.Second)) {
+		return nil, s3Denied(http.StatusForbidden, "AccessDenied", "预签名 URL 已过期")
+	}
+	return sig, nil
+}
+
+// parseCredential 解析 <key>/<date>/<region>/s3/aws4_request，日期必须与签名时间一致
+func (sig *s3Signature) parseCredential(credential string, status int, code string) error {
+	parts := strings.Split(credential, "/")
+	if len(parts) != 5 || parts[0] == "" || parts[2] == "" || parts[3] != "s3" || parts[4] != "aws4_request" ||
+		!strings.HasPrefix(sig.amzDate, parts[1]) || len(parts[1]) != 8 {
+		return s3Denied(status, code, "无效的签名凭据范围")
+	}
+	sig.accessKey = parts[0]
+	sig.scope = strings.Join(parts[1:], "/")
+	return nil
+}
+
+// parseSignedHeaders 解析参与签名的请求头，required 中的请求头必须参与签名
+func (sig *s3Signature) parseSignedHeaders(signedHeaders string, required ...string) error {
+	sig.signedHeaders = strings.Split(strings.ToLower(signedHeaders), ";")
+	sort.Strings(sig.signedHeaders)
+	for _, name := range required {
+		if !contains(sig.signedHeaders, name) {
+			return s3Denied(http.StatusForbidden, "AccessDenied", "请求头 "+name+" 必须参与签名")
+		}
+	}
+	return nil
+}
+
+// verify 用 secret key 重新计算签名并与请求中的签名比较，一致时返回签名密钥
+func (sig *s3Signature) verify(r *http.Request, secret string) ([]byte, bool) {
+	key := s3SigningKey(secret, sig.scope)
+	canonical := s3CanonicalRequest(r, sig)
+	stringToSign := strings.Join([]string{s3Algorithm, sig.amzDate, sig.scope, sha256Hex([]byte(canonical))}, "\n")
+	expected := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	return key, hmac.Equal([]byte(expected), []byte(strings.ToLower(sig.signature)))
+}
+
+// s3CanonicalRequest 按 SigV4 规则构造规范请求
+func s3CanonicalRequest(r *http.Request, sig *s3Signature) string {
+	var b strings.Builder
+	b.WriteString(r.Method + "\n")
+	b.WriteString(s3URIEncode(r.URL.Path, false) + "\n")
+	b.WriteString(s3CanonicalQuery(r.URL.RawQuery, sig.presigned) + "\n")
+	for _, name := range sig.signedHeaders {
+		b.WriteString(name + ":" + s3CanonicalHeader(r, name) + "\n")
+	}
+	b.WriteString("\n" + strings.Join(sig.signedHeaders, ";") + "\n")
+	b.WriteString(sig.payloadHash)
+	return b.String()
+}
+
+// s3CanonicalQuery 按参数名和值排序并重新编码查询参数，预签名 URL 去掉 X-Amz-Signature
+func s3CanonicalQuery(rawQuery string, presigned bool) string {
+	values, _ := url.ParseQuery(rawQuery)
+	pairs := make([]string, 0, len(values))
+	for name, list := range values {
+		if presigned && name == "X-Amz-Signature" {
+			continue
+		}
+		for _, value := range list {
+			pairs = append(pairs, s3URIEncode(name, true)+"="+s3URIEncode(value, true))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+// s3CanonicalHeader 返回参与签名的请求头的规范值：多个值以逗号连接，去掉首尾空白并合并连续空格
+func s3CanonicalHeader(r *http.Request, name string) string {
+	if name == "host" {
+		return r.Host
+	}
+	values := r.Header.Values(textproto.CanonicalMIMEHeaderKey(name))
+	if len(values) == 0 && name == "content-length" && r.ContentLength >= 0 {
+		return strconv.FormatInt(r.ContentLength, 10)
+	}
+	for i, value := range values {
+		values[i] = strings.Join(strings.Fields(value), " ")
+	}
+	return strings.Join(values, ",")
+}
+
+// s3URIEncode 按 SigV4 规则编码：保留字母、数字和 -._~，其余字节编码为 %XX；encodeSlash 为 false 时保留 "/"
+func s3URIEncode(s string, encodeSlash bool) string {
+	const upperhex = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+			c == '-' || c == '_' || c == '.' || c == '~' || c == '/' && !encodeSlash {
+			b.WriteByte(c)
+			continue
+		}
+		b.WriteByte('%')
+		b.WriteByte(upperhex[c>>4])
+		b.WriteByte(upperhex[c&15])
+	}
+	return b.String()
+}
+
+// s3SigningKey 由 secret key 和凭据范围派生签名密钥
+func s3SigningKey(secret, scope string) []byte {
+	key := []byte("AWS4" + secret)
+	for _, part := range strings.Split(scope, "/") {
+		key = hmacSHA256(key, part)
+	}
+	return key
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// checkS3Payload 按签名中声明的 x-amz-content-sha256 处理请求体
+// 声明了内容哈希时，读到结尾发现不一致返回 ErrS3ContentSHA256Mismatch，写入在提交前失败；
+// 带签名的 aws-chunked 请求体把分块签名校验器放入上下文，由读取请求体的处理器逐块校验
+func checkS3Payload(c *gin.Context, sig *s3Signature, key []byte) error {
+	c.Set(s3PayloadHashKey, sig.payloadHash)
+	switch sig.payloadHash {
+	case s3UnsignedPayload, s3UnsignedTrailer:
+		return nil
+	case s3StreamingPayload, s3StreamingTrailer:
+		c.Set(s3ChunkSignerKey, &S3ChunkSigner{key: key, amzDate: sig.amzDate, scope: sig.scope, previous: sig.signature})
+		return nil
+	}
+	expected, err := hex.DecodeString(sig.payloadHash)
+	if err != nil || len(expected) != sha256.Size {
+		return s3Denied(http.StatusBadRequest, "InvalidArgument", "不支持的 x-amz-content-sha256")
+	}
+	if c.Request.Body != nil && c.Request.Body != http.NoBody {
+		c.Request.Body = &s3PayloadReader{ReadCloser: c.Request.Body, hash: sha256.New(), expected: expected, remaining: c.Request.ContentLength}
+	} else if !bytes.Equal(expected, sha256.New().Sum(nil)) {
+		return s3Denied(http.StatusBadRequest, "XAmzContentSHA256Mismatch", "请求体与 x-amz-content-sha256 不一致")
+	}
+	return nil
+}
+
+// s3PayloadReader 读取请求体的同时计算 SHA-256，读到结尾时与声明的哈希比较
+// 读满 Content-Length 时即读完剩余内容并校验，不一致时最后一次读取不返回数据、只返回
+// ErrS3ContentSHA256Mismatch：按长度读取（如 io.ReadFull）、不再等待 EOF 的调用方同样拿不到完整内容，
+// 不会提交未校验的内容
+type s3PayloadReader struct {
+	io.ReadCloser
+	hash      hash.Hash
+	expected  []byte
+	remaining int64 // 尚未读取的 Content-Length，未知时为 -1
+	err       error // 校验结束后的结果，之后的读取都返回它
+}
+
+func (p *s3PayloadReader) Read(b []byte) (int, error) {
+	if p.err != nil {
+		return 0, p.err
+	}
+	n, err := p.ReadCloser.Read(b)
+	p.hash.Write(b[:n])
+	if p.remaining >= 0 {
+		p.remaining -= int64(n)
+	}
+	if err == nil && p.remaining == 0 {
+		err = p.drain()
+	}
+	if err == io.EOF && !bytes.Equal(p.hash.Sum(nil), p.expected) {
+		p.err = ErrS3ContentSHA256Mismatch
+		return 0, p.err
+	}
+	if err != nil {
+		p.err = err
+	}
+	return n, err
+}
+
+// drain 读完请求体剩余的内容并计入哈希，读完时返回 io.EOF
+func (p *s3PayloadReader) drain() error {
+	if _, err := io.Copy(p.hash, p.ReadCloser); err != nil {
+		return err
+	}
+	return io.EOF
+}
+
+// S3ChunkSigner 校验 aws-chunked 请求体的分块签名
+// 每块的签名以前一块的签名（第一块为请求签名）为链，篡改、重排或截断分块都会使签名不一致
+type S3ChunkSigner struct {
+	key      []byte
+	amzDate  string
+	scope    string
+	previous string
+}
+
+// S3ChunkedPayload 返回请求体是否为 aws-chunked 编码
+// 只依据签名中的 x-amz-content-sha256（STREAMING-*）判断，不看 Content-Encoding；
+// 以令牌认证的请求没有签名，依据请求中的 X-Amz-Content-Sha256
+func S3ChunkedPayload(c *gin.Context) bool {
+	payloadHash, ok := c.Get(s3PayloadHashKey)
+	if !ok {
+		payloadHash = c.Request.Header.Get("X-Amz-Content-Sha256")
+	}
+	value, _ := payloadHash.(string)
+	return strings.HasPrefix(value, "STREAMING-")
+}
+
+// S3ChunkSignerFrom 返回请求的分块签名校验器，请求体不是带签名的 aws-chunked 编码时返回 nil
+func S3ChunkSignerFrom(c *gin.Context) *S3ChunkSigner {
+	signer, _ := c.Get(s3ChunkSignerKey)
+	s, _ := signer.(*S3ChunkSigner)
+	return s
+}
+
+// Verify 校验下一块的签名，chunkHash 为块数据的 SHA-256（最后的空块也要校验）
+func (s *S3ChunkSigner) Verify(chunkHash []byte, signature string) error {
+	stringToSign := strings.Join([]string{s3Algorithm + "-PAYLOAD", s.amzDate, s.scope, s.previous, emptySHA256, hex.EncodeToString(chunkHash)}, "\n")
+	expected := hex.EncodeToString(hmacSHA256(s.key, stringToSign))
+	if !hmac.Equal([]byte(expected), []byte(strings.ToLower(signature))) {
+		return ErrS3SignatureMismatch
+	}
+	s.previous = expected
+	return nil
+}
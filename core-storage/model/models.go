@@ -7,17 +7,20 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/sealock/core-storage/syncproto"
 	"gorm.io/datatypes"
+	"gorm.io/gorm"
 )
 
 // Block 代表存储中的最小单位
 // 每个 Block 由其内容的 SHA-256 哈希命名（内容寻址存储原理）
 type Block struct {
 	ID        uint      `gorm:"primaryKey"`
-	Hash      string    `gorm:"uniqueIndex;type:varchar(64)"` // SHA-256 hex string
-	Size      int64     `gorm:"type:bigint"`                  // 字节大小
-	Data      []byte    `gorm:"type:bytea"`                   // 实际数据（开发环境）
-	RefCount  int       `gorm:"default:0"`                    // 引用计数（垃圾回收）
+	Hash      string    `gorm:"uniqueIndex;type:varchar(64)"`    // SHA-256 hex string
+	Size      int64     `gorm:"type:bigint"`                     // 字节大小
+	Data      []byte    `gorm:"type:bytea"`                      // 实际数据（开发环境）
+	RefCount  int       `gorm:"default:0"`                       // 引用计数（垃圾回收）
+	StagedAt  time.Time `gorm:"index;default:CURRENT_TIMESTAMP"` // 最后一次写入的时间，引用计数为 0 的块在宽限期内不被回收
 	CreatedAt time.Time `gorm:"autoCreateTime"`
 }
 
@@ -35,6 +38,14 @@ type File struct {
 	LibraryID uint           `gorm:"index"`
 }
 
+// BeforeCreate 为没有指定 UUID 的文件生成 UUID，UUID 有唯一索引，留空的第二个文件会写入失败
+func (f *File) BeforeCreate(tx *gorm.DB) error {
+	if f.UUID == "" {
+		f.UUID = uuid.New().String()
+	}
+	return nil
+}
+
 // LibraryVersion 代表 Library 的一次提交（类似 Git Commit）
 type LibraryVersion struct {
 	ID            uint           `gorm:"primaryKey"`
@@ -66,15 +77,8 @@ type Library struct {
 }
 
 // DirectoryEntry 代表目录树中的一个条目（文件或目录）
-// 用于重建目录结构和计算 Merkle hash
-type DirectoryEntry struct {
-	Name     string            // 文件/目录名
-	IsDir    bool              // 是否为目录
-	Hash     string            // 目录条目的 hash（文件为 Block hash，目录为树 hash）
-	Size     int64             // 大小
-	Children []*DirectoryEntry // 子项（仅当 IsDir=true 时）
-	Metadata map[string]string // 额外元数据（权限、修改时间等）
-}
+// 与同步客户端共用，定义在 syncproto 包中
+type DirectoryEntry = syncproto.DirectoryEntry
 
 // ============ 辅助函数 ============
 
@@ -0,0 +1,38 @@
+package model
+
+import "time"
+
+// 副本角色
+const (
+	ReplicationRoleReplica  = "replica"  // 跟随主服务器，只读
+	ReplicationRolePromoted = "promoted" // 已提升为主库，不再跟随，可写
+)
+
+// Replication 库的跨服务器复制状态（保存在副本端）
+// 副本按主服务器的提交日志顺序拉取提交、目录树和缺失的块；
+// LastCommitUUID 是已完整应用的最后一个提交，中断后从这里继续
+type Replication struct {
+	ID               uint   `gorm:"primaryKey"`
+	LibraryID        uint   `gorm:"uniqueIndex"` // 本地（副本）库
+	PrimaryURL       string `gorm:"type:varchar(1024)"`
+	PrimaryLibraryID uint
+	PrimaryToken     string `gorm:"type:text"`
+	Role             string `gorm:"type:varchar(16);default:'replica'"`
+
+	LastCommitUUID string     `gorm:"type:varchar(36)"` // 已应用的最后一个提交
+	LastCommitAt   *time.Time // 该提交在主服务器上的创建时间
+	PrimaryHead    string     `gorm:"type:varchar(36)"` // 最近一次看到的主服务器最新提交
+	PrimaryHeadAt  *time.Time
+	CommitsBehind  int // 最近一次拉取时落后的提交数
+
+	CommitsApplied int64 // 累计应用的提交数
+	BlocksFetched  int64 // 累计拉取的块数
+	BytesFetched   int64 // 累计拉取的块字节数
+	LastSyncAt     *time.Time
+	LastSuccessAt  *time.Time
+	LastError      string `gorm:"type:text"`
+
+	PromotedAt *time.Time
+	CreatedAt  time.Time `gorm:"autoCreateTime"`
+	UpdatedAt  time.Time `gorm:"autoUpdateTime"`
+}
@@ -0,0 +1,14 @@
+package model
+
+import "time"
+
+// S3AccessKey S3 网关的访问密钥
+// 客户端用 AccessKeyID 和 secret key 按 SigV4 签名请求；SecretKey 加密保存，只在创建时返回一次
+type S3AccessKey struct {
+	ID          uint      `gorm:"primaryKey"`
+	AccessKeyID string    `gorm:"type:varchar(32);uniqueIndex"`
+	SecretKey   string    `gorm:"type:text"`
+	UserID      uint      `gorm:"index"` // 密钥所属用户，请求以该用户的身份执行
+	Description string    `gorm:"type:varchar(255)"`
+	CreatedAt   time.Time `gorm:"autoCreateTime"`
+}
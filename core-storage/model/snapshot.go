@@ -2,15 +2,19 @@ package model
 
 import (
 	"time"
+
+	"gorm.io/datatypes"
 )
 
 // Snapshot represents a point-in-time view of the file system
 type Snapshot struct {
 	ID          uint      `gorm:"primaryKey"`
 	UUID        string    `gorm:"uniqueIndex;type:varchar(36)"`
+	LibraryID   uint      `gorm:"index"`
 	CreatedAt   time.Time `gorm:"autoCreateTime"`
 	Name        string    `gorm:"type:varchar(255)"`
 	Description string    `gorm:"type:text"`
+	Tag         string    `gorm:"type:varchar(255);index"` // 非空表示被用户打了标签（保留策略可据此永久保留）
 	ParentID    *uint     `gorm:"index"`
 	RootHash    string    `gorm:"type:varchar(64)"`
 	FileCount   int
@@ -18,14 +22,17 @@ type Snapshot struct {
 }
 
 // SnapshotFile represents a file in a snapshot
+// BlockIDs 冗余保存文件的块列表，使快照在原文件被删除后仍可还原内容
 type SnapshotFile struct {
-	ID         uint      `gorm:"primaryKey"`
-	SnapshotID uint      `gorm:"index"`
-	FileID     uint      `gorm:"index"`
-	FileName   string    `gorm:"type:varchar(255);index:idx_snapshot_file_name"`
-	FileHash   string    `gorm:"type:varchar(64)"`
-	Status     string    `gorm:"type:varchar(20)"`
-	CreatedAt  time.Time `gorm:"autoCreateTime"`
+	ID         uint           `gorm:"primaryKey"`
+	SnapshotID uint           `gorm:"index"`
+	FileID     uint           `gorm:"index"`
+	FileName   string         `gorm:"type:varchar(255);index:idx_snapshot_file_name"`
+	FileHash   string         `gorm:"type:varchar(64)"`
+	Size       int64          `gorm:"type:bigint"`
+	BlockIDs   datatypes.JSON `gorm:"type:jsonb"`
+	Status     string         `gorm:"type:varchar(20)"`
+	CreatedAt  time.Time      `gorm:"autoCreateTime"`
 }
 
 // SnapshotDiff represents the differences between two snapshots
@@ -33,4 +40,25 @@ type SnapshotDiff struct {
 	Added    []SnapshotFile
 	Removed  []SnapshotFile
 	Modified []SnapshotFile
-}
\ No newline at end of file
+}
+
+// RetentionPolicy 快照保留策略（按库配置）
+// 各 Keep* 字段为 0 表示不启用该规则；所有计数规则均为 0 时保留全部快照（仅 MaxAge 生效）
+type RetentionPolicy struct {
+	ID          uint          `gorm:"primaryKey"`
+	LibraryID   uint          `gorm:"uniqueIndex"`
+	KeepLast    int           `gorm:"default:0"` // 保留最近 N 个快照
+	KeepHourly  int           `gorm:"default:0"` // 保留最近 N 个小时中每小时最新的一个
+	KeepDaily   int           `gorm:"default:0"` // 保留最近 N 天中每天最新的一个
+	KeepWeekly  int           `gorm:"default:0"` // 保留最近 N 周中每周最新的一个
+	KeepMonthly int           `gorm:"default:0"` // 保留最近 N 个月中每月最新的一个
+	KeepTagged  bool          // 带标签的快照永久保留，新策略默认开启（见 DefaultRetentionPolicy）
+	MaxAge      time.Duration `gorm:"type:bigint;default:0"` // 超过该时长的快照一律过期（0 表示不限制）
+	CreatedAt   time.Time     `gorm:"autoCreateTime"`
+	UpdatedAt   time.Time     `gorm:"autoUpdateTime"`
+}
+
+// DefaultRetentionPolicy 返回库的默认保留策略：保留全部快照，带标签的快照永久保留
+func DefaultRetentionPolicy(libraryID uint) *RetentionPolicy {
+	return &RetentionPolicy{LibraryID: libraryID, KeepTagged: true}
+}
@@ -0,0 +1,76 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/datatypes"
+)
+
+// ConflictPolicy 同一路径在两端被修改为不同内容时的处理策略
+type ConflictPolicy string
+
+const (
+	// ConflictKeepBoth 保留服务端版本，客户端版本另存为带后缀的冲突副本
+	ConflictKeepBoth ConflictPolicy = "keep_both"
+	// ConflictNewestWins 修改时间较新的版本胜出
+	ConflictNewestWins ConflictPolicy = "newest_wins"
+	// ConflictServerWins 始终保留服务端版本，丢弃客户端修改
+	ConflictServerWins ConflictPolicy = "server_wins"
+	// ConflictManual 保留服务端版本，客户端版本挂起等待用户处理
+	ConflictManual ConflictPolicy = "manual"
+)
+
+// DefaultConflictPolicy 未配置时使用的冲突策略
+const DefaultConflictPolicy = ConflictKeepBoth
+
+// Valid 是否为受支持的策略
+func (p ConflictPolicy) Valid() bool {
+	switch p {
+	case ConflictKeepBoth, ConflictNewestWins, ConflictServerWins, ConflictManual:
+		return true
+	}
+	return false
+}
+
+// 冲突状态
+const (
+	ConflictStatusOpen     = "open"     // 等待用户处理
+	ConflictStatusResolved = "resolved" // 已处理（自动或手动）
+)
+
+// 冲突处理结果
+const (
+	ResolutionServer   = "server"    // 保留服务端版本
+	ResolutionClient   = "client"    // 采用客户端版本
+	ResolutionKeepBoth = "keep_both" // 客户端版本另存为冲突副本
+)
+
+// SyncConflict 一次同步冲突记录
+// ClientHash 为空表示客户端删除了服务端已修改的文件
+type SyncConflict struct {
+	ID             uint           `gorm:"primaryKey"`
+	LibraryID      uint           `gorm:"index"`
+	Path           string         `gorm:"type:varchar(1024)"`
+	BaseHash       string         `gorm:"type:varchar(64)"` // 共同祖先版本
+	ServerHash     string         `gorm:"type:varchar(64)"` // 冲突发生时服务端的版本
+	ClientHash     string         `gorm:"type:varchar(64)"` // 客户端提交的版本
+	ClientSize     int64          `gorm:"type:bigint"`
+	ClientBlockIDs datatypes.JSON `gorm:"type:jsonb"` // 客户端版本的块列表（手动处理前保持引用）
+	ClientModTime  time.Time
+	ClientID       string    `gorm:"type:varchar(255)"`
+	Policy         string    `gorm:"type:varchar(32)"`
+	Status         string    `gorm:"type:varchar(16);index"`
+	Resolution     string    `gorm:"type:varchar(32)"`
+	CopyPath       string    `gorm:"type:varchar(1024)"` // keep_both 时冲突副本的路径
+	CreatedAt      time.Time `gorm:"autoCreateTime"`
+	ResolvedAt     *time.Time
+}
+
+// SyncSettings 库的同步配置
+type SyncSettings struct {
+	ID             uint      `gorm:"primaryKey"`
+	LibraryID      uint      `gorm:"uniqueIndex"`
+	ConflictPolicy string    `gorm:"type:varchar(32);default:'keep_both'"`
+	CreatedAt      time.Time `gorm:"autoCreateTime"`
+	UpdatedAt      time.Time `gorm:"autoUpdateTime"`
+}
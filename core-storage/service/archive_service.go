@@ -0,0 +1,672 @@
+package service
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/sealock/core-storage/chunker"
+	"github.com/sealock/core-storage/model"
+	"github.com/sealock/core-storage/storage"
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+// 支持导入的归档格式
+const (
+	ArchiveTar   = "tar"
+	ArchiveTarGz = "tar.gz"
+	ArchiveZip   = "zip"
+)
+
+var (
+	// ErrUnsupportedArchive 无法识别或不支持的归档格式（含加密或使用未知压缩算法的 zip 条目）
+	ErrUnsupportedArchive = errors.New("unsupported archive format")
+	// ErrInvalidArchive 归档内容损坏或被截断
+	ErrInvalidArchive = errors.New("invalid archive")
+	// ErrImportConflict 导入的文件与库中的文件或目录同名（文件与目录不能同名）
+	ErrImportConflict = errors.New("import path conflicts with existing entry")
+	// ErrImportTooLarge 归档超过导入大小上限、展开后的总大小上限或条目数上限
+	ErrImportTooLarge = errors.New("archive exceeds the import size limit")
+)
+
+const (
+	// DefaultMaxImportSize 导入归档的默认大小上限（按上传的归档本身计算）
+	DefaultMaxImportSize = 4 << 30
+	// DefaultMaxExpandedSize 导入时归档展开后的默认总大小上限，防止高压缩比的 zip/gzip 炸弹
+	DefaultMaxExpandedSize = 16 << 30
+	// DefaultMaxImportEntries 导入归档的默认条目数上限（包括目录和跳过的条目）
+	DefaultMaxImportEntries = 100000
+)
+
+// storedExtensions 已压缩的文件类型，打包时以存储方式写入，不再压缩
+var storedExtensions = map[string]bool{
+	// 压缩包
+	".zip": true, ".gz": true, ".tgz": true, ".bz2": true, ".xz": true, ".zst": true, ".7z": true, ".rar": true,
+	// 图片
+	".jpg": true, ".jpeg": true, ".png": true, ".gif": true, ".webp": true, ".heic": true, ".avif": true,
+	// 音视频
+	".mp3": true, ".m4a": true, ".aac": true, ".ogg": true, ".opus": true, ".flac": true,
+	".mp4": true, ".m4v": true, ".mov": true, ".mkv": true, ".webm": true, ".avi": true,
+	// 以 zip 为容器的文档
+	".docx": true, ".xlsx": true, ".pptx": true, ".odt": true, ".ods": true, ".odp": true,
+	".epub": true, ".jar": true, ".apk": true,
+}
+
+// ArchiveService 库的归档服务：把当前版本或任意快照中选中的文件和目录打包为 zip 下载，
+// 以及把上传的 tar、tar.gz 或 zip 归档展开到库中的目录
+type ArchiveService struct {
+	files            *FileService
+	snapshotRepo     storage.SnapshotRepository
+	maxImportSize    int64 // 导入归档的大小上限
+	maxExpandedSize  int64 // 导入时展开后的总大小上限
+	maxImportEntries int   // 导入归档的条目数上限
+}
+
+// NewArchiveService 创建归档服务，导入上限为 DefaultMaxImportSize、DefaultMaxExpandedSize 和 DefaultMaxImportEntries
+func NewArchiveService(files *FileService, sr storage.SnapshotRepository) *ArchiveService {
+	return &ArchiveService{
+		files:            files,
+		snapshotRepo:     sr,
+		maxImportSize:    DefaultMaxImportSize,
+		maxExpandedSize:  DefaultMaxExpandedSize,
+		maxImportEntries: DefaultMaxImportEntries,
+	}
+}
+
+// SetMaxImportSize 设置导入归档的大小上限（字节），不大于 0 时使用 DefaultMaxImportSize
+// 上限同时限制 zip 导入时写入临时文件的大小
+func (a *ArchiveService) SetMaxImportSize(size int64) {
+	if size <= 0 {
+		size = DefaultMaxImportSize
+	}
+	a.maxImportSize = size
+}
+
+// MaxImportSize 导入归档的大小上限（字节）
+func (a *ArchiveService) MaxImportSize() int64 {
+	return a.maxImportSize
+}
+
+// SetMaxExpandedSize 设置导入时归档展开后的总大小上限（字节），不大于 0 时使用 DefaultMaxExpandedSize
+func (a *ArchiveService) SetMaxExpandedSize(size int64) {
+	if size <= 0 {
+		size = DefaultMaxExpandedSize
+	}
+	a.maxExpandedSize = size
+}
+
+// SetMaxImportEntries 设置导入归档的条目数上限，不大于 0 时使用 DefaultMaxImportEntries
+func (a *ArchiveService) SetMaxImportEntries(n int) {
+	if n <= 0 {
+		n = DefaultMaxImportEntries
+	}
+	a.maxImportEntries = n
+}
+
+// ZipArchive 选出的待打包文件，由 SelectZip 创建，Stream 输出
+type ZipArchive struct {
+	Files int   // 文件数量
+	Size  int64 // 未压缩的总大小（字节）
+
+	entries    []archiveEntry
+	blockStore storage.BlockStore
+}
+
+// archiveEntry 归档中的一个文件
+type archiveEntry struct {
+	name    string // 归档内的路径
+	size    int64
+	blocks  []string
+	modTime time.Time
+}
+
+// ResolveSnapshot 根据数字 ID 或 UUID 查找快照
+func (a *ArchiveService) ResolveSnapshot(ctx context.Context, ref string) (*model.Snapshot, error) {
+	return resolveSnapshot(ctx, a.snapshotRepo, ref)
+}
+
+// SelectZip 选出要打包的文件
+// snapshot 为 nil 时打包库的当前版本，否则打包该快照（必须属于该库）；
+// paths 中每一项可以是文件或目录，为空时打包整个库，不存在的路径返回 ErrPathNotFound。
+// 归档内的路径相对于所有选中项的最近公共父目录，因此选中单个目录时归档以该目录为顶层
+func (a *ArchiveService) SelectZip(ctx context.Context, libraryID uint, snapshot *model.Snapshot, paths []string) (*ZipArchive, error) {
+	all, err := a.listEntries(ctx, libraryID, snapshot)
+	if err != nil {
+		return nil, err
+	}
+
+	selected := make(map[string]bool, len(paths))
+	base := ""
+	for i, p := range paths {
+		p = cleanPath(p)
+		selected[p] = false
+		parent := path.Dir(p)
+		if parent == "." {
+			parent = ""
+		}
+		if i == 0 {
+			base = parent
+		} else {
+			base = commonDir(base, parent)
+		}
+	}
+	if len(selected) == 0 {
+		selected[""] = false
+	}
+
+	archive := &ZipArchive{blockStore: a.files.blockStore}
+	for _, entry := range all {
+		// 文件本身或它的任一上级目录被选中即打包
+		match := ""
+		found := false
+		for dir := entry.name; ; dir = path.Dir(dir) {
+			if dir == "." {
+				dir = ""
+			}
+			if _, ok := selected[dir]; ok {
+				match, found = dir, true
+				break
+			}
+			if dir == "" {
+				break
+			}
+		}
+		if !found {
+			continue
+		}
+		selected[match] = true
+
+		if base != "" {
+			entry.name = strings.TrimPrefix(entry.name, base+"/")
+		}
+		archive.entries = append(archive.entries, entry)
+		archive.Files++
+		archive.Size += entry.size
+	}
+	for p, matched := range selected {
+		// 空库打包整个库时得到空归档
+		if !matched && p != "" {
+			return nil, fmt.Errorf("%w: %s", ErrPathNotFound, p)
+		}
+	}
+	sort.Slice(archive.entries, func(i, j int) bool { return archive.entries[i].name < archive.entries[j].name })
+	return archive, nil
+}
+
+// listEntries 列出库当前版本或快照中的全部文件
+func (a *ArchiveService) listEntries(ctx context.Context, libraryID uint, snapshot *model.Snapshot) ([]archiveEntry, error) {
+	if snapshot == nil {
+		files, err := a.files.ListLibraryFiles(ctx, libraryID)
+		if err != nil {
+			return nil, err
+		}
+		entries := make([]archiveEntry, 0, len(files))
+		for i := range files {
+			blocks, err := fileBlockHashes(&files[i])
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, archiveEntry{
+				name:    cleanPath(files[i].Name),
+				size:    files[i].Size,
+				blocks:  blocks,
+				modTime: files[i].UpdatedAt,
+			})
+		}
+		return entries, nil
+	}
+
+	if snapshot.LibraryID != libraryID {
+		return nil, ErrSnapshotNotInLibrary
+	}
+	files, err := a.snapshotRepo.ListSnapshotFiles(ctx, snapshot.ID, 0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list snapshot files: %w", err)
+	}
+	entries := make([]archiveEntry, 0, len(files))
+	for _, file := range files {
+		var blocks []string
+		if len(file.BlockIDs) > 0 {
+			if err := json.Unmarshal(file.BlockIDs, &blocks); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal block IDs: %w", err)
+			}
+		}
+		entries = append(entries, archiveEntry{
+			name:    cleanPath(file.FileName),
+			size:    file.Size,
+			blocks:  blocks,
+			modTime: snapshot.CreatedAt,
+		})
+	}
+	return entries, nil
+}
+
+// Stream 以 zip 格式把归档写入 w
+// 内容直接从块存储读取，不在磁盘上暂存；已压缩的类型以存储方式写入，其余使用 deflate。
+// 单个文件或归档总大小超过 4GB、文件数超过 65535 时自动写入 Zip64 扩展
+func (z *ZipArchive) Stream(ctx context.Context, w io.Writer) error {
+	zw := zip.NewWriter(w)
+	for _, entry := range z.entries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		method := zip.Deflate
+		if storedExtensions[strings.ToLower(path.Ext(entry.name))] {
+			method = zip.Store
+		}
+		header := &zip.FileHeader{
+			Name:     entry.name,
+			Method:   method,
+			Modified: entry.modTime,
+		}
+		header.SetMode(0644)
+		fw, err := zw.CreateHeader(header)
+		if err != nil {
+			return fmt.Errorf("failed to add %s to zip: %w", entry.name, err)
+		}
+		reader := NewBlockReader(ctx, z.blockStore, entry.blocks, entry.size)
+		_, err = io.Copy(fw, reader)
+		reader.Close()
+		if err != nil {
+			return fmt.Errorf("failed to write %s to zip: %w", entry.name, err)
+		}
+	}
+	return zw.Close()
+}
+
+// commonDir 返回两个库内目录的最近公共父目录，根目录为空字符串
+func commonDir(a, b string) string {
+	if a == "" || b == "" {
+		return ""
+	}
+	as, bs := strings.Split(a, "/"), strings.Split(b, "/")
+	n := 0
+	for n < len(as) && n < len(bs) && as[n] == bs[n] {
+		n++
+	}
+	return strings.Join(as[:n], "/")
+}
+
+// ArchiveImportResult 归档导入的结果
+type ArchiveImportResult struct {
+	LibraryID uint     `json:"libraryId"`
+	Target    string   `json:"target"`  // 导入的目标目录，空字符串为库的根目录
+	Format    string   `json:"format"`  // 归档格式：tar、tar.gz 或 zip
+	Files     int      `json:"files"`   // 导入的文件数量
+	Bytes     int64    `json:"bytes"`   // 导入的总字节数
+	Skipped   []string `json:"skipped"` // 跳过的条目：链接、设备文件以及 macOS 的 __MACOSX 元数据
+}
+
+// importEntry 内容已写入块存储、等待创建文件记录的归档条目
+type importEntry struct {
+	path   string
+	size   int64
+	hash   string
+	blocks []string
+	sizes  map[string]int64
+}
+
+// archiveImport 一次导入的暂存状态
+type archiveImport struct {
+	ctx      context.Context
+	files    *FileService
+	ownerID  uint
+	target   string
+	entries  []importEntry
+	index    map[string]int // 库内路径 → entries 下标，归档中重复的路径以最后一个为准
+	replaced []string       // 被重复路径替换掉的条目的块
+	reserved int64
+	result   *ArchiveImportResult
+
+	expanded    int64 // 已展开的字节数，包括被重复路径替换掉的条目
+	maxExpanded int64
+	count       int // 已读取的条目数
+	maxEntries  int
+}
+
+// Import 把归档展开到库中 target 目录下，已有的同名文件被覆盖
+// format 为空时按内容识别格式。每个条目流式读取后按块切分写入块存储并去重，
+// 目录层级由条目路径重建（不能越出 target）；全部条目读取成功后，持有库的写锁在同一事务中
+// 创建所有文件记录，整个导入记录为一个提交，任一步骤失败时库保持不变。
+// 归档超过 MaxImportSize、展开后的总大小超过 SetMaxExpandedSize 或条目数超过 SetMaxImportEntries
+// 设置的上限时返回 ErrImportTooLarge，展开的内容不超过上限：压缩比很高的归档在读到上限时即被拒绝。
+// zip 的目录位于文件末尾，需要先把归档写入临时文件；tar 和 tar.gz 全程流式处理
+func (a *ArchiveService) Import(ctx context.Context, libraryID, ownerID uint, target string, r io.Reader, format, author string) (*ArchiveImportResult, error) {
+	target = cleanPath(target)
+	if err := checkWritable(ctx, a.files.replication, libraryID); err != nil {
+		return nil, err
+	}
+	limit := &importLimitReader{r: r, remaining: a.maxImportSize}
+	br := bufio.NewReader(limit)
+	if format == "" {
+		format = detectArchiveFormat(br)
+	}
+
+	imp := &archiveImport{
+		ctx:     ctx,
+		files:   a.files,
+		ownerID: ownerID,
+		target:  target,
+		index:   make(map[string]int),
+		result:  &ArchiveImportResult{LibraryID: libraryID, Target: target, Format: format, Skipped: []string{}},
+
+		maxExpanded: a.maxExpandedSize,
+		maxEntries:  a.maxImportEntries,
+	}
+	committed := false
+	defer func() {
+		a.files.releaseQuota(ctx, ownerID, imp.reserved)
+		if !committed {
+			var blocks []string
+			for _, entry := range imp.entries {
+				blocks = append(blocks, entry.blocks...)
+			}
+			a.files.discardBlocks(ctx, append(blocks, imp.replaced...))
+		}
+	}()
+
+	var err error
+	switch format {
+	case ArchiveTar:
+		err = imp.readTar(tar.NewReader(br))
+	case ArchiveTarGz:
+		gz, gzErr := gzip.NewReader(br)
+		if gzErr != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidArchive, gzErr)
+		}
+		err = imp.readTar(tar.NewReader(gz))
+	case ArchiveZip:
+		err = imp.readZip(br)
+	default:
+		return nil, ErrUnsupportedArchive
+	}
+	if limit.exceeded {
+		return nil, ErrImportTooLarge
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := a.checkImportConflicts(ctx, libraryID, imp); err != nil {
+		return nil, err
+	}
+
+	// 暂停自动提交，导入的所有文件合并为一个提交
+	release := a.files.commitScheduler.Hold(libraryID)
+	defer release()
+	lock := a.files.locks.Get(libraryID)
+	lock.Lock()
+	defer lock.Unlock()
+	if err := checkWritable(ctx, a.files.replication, libraryID); err != nil {
+		return nil, err
+	}
+
+	// 所有文件记录在同一事务中创建：任一条目失败时回滚，库保持导入前的状态，
+	// 之后由 defer 把全部条目的块交给垃圾回收器
+	events := make([]Event, 0, len(imp.entries))
+	err = inTransaction(ctx, a.files.tx, func(ctx context.Context) error {
+		events = events[:0]
+		for _, entry := range imp.entries {
+			file, eventType, err := a.files.writeFileNode(ctx, libraryID, entry.path, entry.size, entry.hash, entry.blocks, entry.sizes)
+			if err != nil {
+				return err
+			}
+			events = append(events, Event{LibraryID: libraryID, Type: eventType, Path: file.Name, Hash: file.Hash, Size: file.Size})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	committed = true
+
+	for _, event := range events {
+		a.files.events.Publish(event)
+	}
+	a.files.discardBlocks(ctx, imp.replaced)
+	if len(imp.entries) > 0 {
+		a.files.commitScheduler.Notify(libraryID, author)
+	}
+	return imp.result, nil
+}
+
+// importLimitReader 读取超过 remaining 字节时返回 ErrImportTooLarge 并记录 exceeded
+// tar 和 gzip 会把读取错误包装为格式错误，Import 据 exceeded 判断是否超出上限
+type importLimitReader struct {
+	r         io.Reader
+	remaining int64
+	exceeded  bool
+}
+
+func (l *importLimitReader) Read(p []byte) (int, error) {
+	if l.exceeded {
+		return 0, ErrImportTooLarge
+	}
+	// 多读一个字节，区分恰好读完上限和超出上限
+	if int64(len(p)) > l.remaining+1 {
+		p = p[:l.remaining+1]
+	}
+	n, err := l.r.Read(p)
+	if int64(n) > l.remaining {
+		l.exceeded = true
+		return 0, ErrImportTooLarge
+	}
+	l.remaining -= int64(n)
+	return n, err
+}
+
+// readTar 逐个读取 tar 条目，普通文件写入块存储，目录由路径隐含，其他类型跳过
+func (imp *archiveImport) readTar(tr *tar.Reader) error {
+	for {
+		if err := imp.ctx.Err(); err != nil {
+			return err
+		}
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+		}
+		if err := imp.countEntry(); err != nil {
+			return err
+		}
+		switch header.Typeflag {
+		case tar.TypeReg:
+			if err := imp.stage(header.Name, tr, header.Size); err != nil {
+				return err
+			}
+		case tar.TypeDir, tar.TypeXGlobalHeader:
+		default:
+			imp.result.Skipped = append(imp.result.Skipped, header.Name)
+		}
+	}
+}
+
+// readZip 把 zip 写入临时文件后按目录读取各条目，临时文件的大小受导入上限约束
+func (imp *archiveImport) readZip(r io.Reader) error {
+	tmp, err := os.CreateTemp("", "sealock-import-*.zip")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	size, err := io.Copy(tmp, r)
+	if err != nil {
+		return fmt.Errorf("failed to receive zip: %w", err)
+	}
+	zr, err := zip.NewReader(tmp, size)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+	}
+
+	// 条目数在读取目录时即可确定，条目过多的归档不展开任何内容
+	if len(zr.File) > imp.maxEntries {
+		return fmt.Errorf("%w: more than %d entries", ErrImportTooLarge, imp.maxEntries)
+	}
+	for _, file := range zr.File {
+		if err := imp.ctx.Err(); err != nil {
+			return err
+		}
+		if err := imp.countEntry(); err != nil {
+			return err
+		}
+		name := file.Name
+		if file.NonUTF8 && !utf8.ValidString(name) {
+			// 中文 Windows 的压缩工具以 GBK 编码文件名且不设置 UTF-8 标志
+			if decoded, err := simplifiedchinese.GB18030.NewDecoder().String(name); err == nil {
+				name = decoded
+			}
+		}
+		mode := file.Mode()
+		if mode.IsDir() {
+			continue
+		}
+		if !mode.IsRegular() {
+			imp.result.Skipped = append(imp.result.Skipped, name)
+			continue
+		}
+
+		rc, err := file.Open()
+		if err != nil {
+			if errors.Is(err, zip.ErrAlgorithm) {
+				return fmt.Errorf("%w: %s", ErrUnsupportedArchive, name)
+			}
+			return fmt.Errorf("failed to open zip entry %s: %w", name, err)
+		}
+		err = imp.stage(name, rc, int64(file.UncompressedSize64))
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// stage 把一个条目的内容写入块存储并暂存，等待全部读取成功后创建文件记录
+func (imp *archiveImport) stage(name string, r io.Reader, size int64) error {
+	// 条目路径先单独规范化，".." 不能越出导入目录
+	name = cleanPath(strings.ReplaceAll(name, `\`, "/"))
+	if name == "" {
+		return nil
+	}
+	if name == "__MACOSX" || strings.HasPrefix(name, "__MACOSX/") {
+		imp.result.Skipped = append(imp.result.Skipped, name)
+		return nil
+	}
+	filePath := name
+	if imp.target != "" {
+		filePath = imp.target + "/" + name
+	}
+
+	// 按条目声明的大小先检查展开上限，读取时也不超过声明的大小，声明不实的条目由下面的长度检查拒绝
+	if size < 0 || size > imp.maxExpanded-imp.expanded {
+		return fmt.Errorf("%w: expanded size exceeds %d bytes", ErrImportTooLarge, imp.maxExpanded)
+	}
+	imp.expanded += size
+
+	reserved, err := imp.files.reserveQuota(imp.ctx, imp.ownerID, size)
+	if err != nil {
+		return err
+	}
+	imp.reserved += reserved
+
+	hashes, sizes, total, err := imp.files.storeContent(imp.ctx, io.LimitReader(r, size+1))
+	if err != nil {
+		return fmt.Errorf("failed to import %s: %w", name, err)
+	}
+	if total != size {
+		imp.files.discardBlocks(imp.ctx, hashes)
+		return fmt.Errorf("%w: %s has %d bytes, expected %d", ErrUploadSizeMismatch, name, total, size)
+	}
+	fileHash, err := chunker.ComputeFileMerkleHash(hashes)
+	if err != nil {
+		imp.files.discardBlocks(imp.ctx, hashes)
+		return fmt.Errorf("failed to compute file hash: %w", err)
+	}
+
+	entry := importEntry{path: filePath, size: total, hash: fileHash, blocks: hashes, sizes: sizes}
+	if i, ok := imp.index[filePath]; ok {
+		imp.replaced = append(imp.replaced, imp.entries[i].blocks...)
+		imp.result.Bytes -= imp.entries[i].size
+		imp.entries[i] = entry
+	} else {
+		imp.index[filePath] = len(imp.entries)
+		imp.entries = append(imp.entries, entry)
+		imp.result.Files++
+	}
+	imp.result.Bytes += total
+	return nil
+}
+
+// countEntry 记录读取了一个条目，超过条目数上限时返回 ErrImportTooLarge
+func (imp *archiveImport) countEntry() error {
+	imp.count++
+	if imp.count > imp.maxEntries {
+		return fmt.Errorf("%w: more than %d entries", ErrImportTooLarge, imp.maxEntries)
+	}
+	return nil
+}
+
+// checkImportConflicts 确认导入的文件不会与库中或归档中的其他文件形成文件与目录同名
+func (a *ArchiveService) checkImportConflicts(ctx context.Context, libraryID uint, imp *archiveImport) error {
+	existing, err := a.files.ListLibraryFiles(ctx, libraryID)
+	if err != nil {
+		return err
+	}
+	files := make(map[string]bool, len(existing)+len(imp.entries))
+	for _, file := range existing {
+		files[cleanPath(file.Name)] = true
+	}
+	for _, entry := range imp.entries {
+		files[entry.path] = true
+	}
+	dirs := make(map[string]bool)
+	for filePath := range files {
+		for dir := path.Dir(filePath); dir != "."; dir = path.Dir(dir) {
+			dirs[dir] = true
+		}
+	}
+
+	if imp.target != "" && files[imp.target] {
+		return fmt.Errorf("%w: %s", ErrImportConflict, imp.target)
+	}
+	for _, entry := range imp.entries {
+		if dirs[entry.path] {
+			return fmt.Errorf("%w: %s", ErrImportConflict, entry.path)
+		}
+		for dir := path.Dir(entry.path); dir != "."; dir = path.Dir(dir) {
+			if files[dir] {
+				return fmt.Errorf("%w: %s", ErrImportConflict, dir)
+			}
+		}
+	}
+	return nil
+}
+
+// detectArchiveFormat 按文件头识别归档格式，无法识别时返回空字符串
+func detectArchiveFormat(br *bufio.Reader) string {
+	head, _ := br.Peek(512)
+	switch {
+	case bytes.HasPrefix(head, []byte("PK\x03\x04")), bytes.HasPrefix(head, []byte("PK\x05\x06")):
+		return ArchiveZip
+	case bytes.HasPrefix(head, []byte{0x1f, 0x8b}):
+		return ArchiveTarGz
+	case len(head) >= 262 && bytes.HasPrefix(head[257:], []byte("ustar")):
+		return ArchiveTar
+	}
+	return ""
+}
@@ -0,0 +1,314 @@
+package service
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/sealock/core-storage/chunker"
+	"github.com/sealock/core-storage/storage"
+)
+
+// archiveTestEnv 归档测试使用的服务及其存储
+type archiveTestEnv struct {
+	files     *FileService
+	archives  *ArchiveService
+	repo      storage.FileRepository
+	snapshots storage.SnapshotRepository
+}
+
+func newArchiveTestEnv(t *testing.T) *archiveTestEnv {
+	t.Helper()
+	repo := storage.NewMockFileRepository()
+	snapshots := storage.NewMockSnapshotRepository()
+	files := NewFileService(storage.NewLocalBlockStore(), repo, storage.NewMockBlockRepository(),
+		chunker.NewFixedSizeChunker(4), snapshots, newTestRedis(t), true)
+	t.Cleanup(func() { files.Close(context.Background()) })
+	return &archiveTestEnv{files: files, archives: NewArchiveService(files, snapshots), repo: repo, snapshots: snapshots}
+}
+
+// put 把 content 写入库中的路径
+func (e *archiveTestEnv) put(t *testing.T, libraryID uint, filePath, content string) {
+	t.Helper()
+	if _, err := e.files.PutFile(context.Background(), libraryID, 1, filePath, strings.NewReader(content), int64(len(content))); err != nil {
+		t.Fatalf("put %s: %v", filePath, err)
+	}
+}
+
+// readZip 输出归档并返回其中的条目，键为归档内的路径
+func readZip(t *testing.T, archive *ZipArchive) map[string]*zip.File {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := archive.Stream(context.Background(), &buf); err != nil {
+		t.Fatalf("stream: %v", err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("open zip: %v", err)
+	}
+	entries := make(map[string]*zip.File, len(zr.File))
+	for _, f := range zr.File {
+		entries[f.Name] = f
+	}
+	return entries
+}
+
+// zipContent 返回 zip 条目解压后的内容
+func zipContent(t *testing.T, f *zip.File) string {
+	t.Helper()
+	rc, err := f.Open()
+	if err != nil {
+		t.Fatalf("open %s: %v", f.Name, err)
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatalf("read %s: %v", f.Name, err)
+	}
+	return string(data)
+}
+
+func TestZipStreamCompression(t *testing.T) {
+	env := newArchiveTestEnv(t)
+	contents := map[string]string{
+		"notes.txt":       strings.Repeat("plain text ", 100),
+		"photo.JPG":       "\xff\xd8\xff\xe0jpeg data",
+		"backup.tar.gz":   "\x1f\x8bgzip data",
+		"report.docx":     "PK\x03\x04docx data",
+		"Makefile":        "all:\n\tgo build\n",
+		"docs/readme.md":  "# readme",
+		"media/clip.webm": "webm data",
+	}
+	for name, content := range contents {
+		env.put(t, 1, name, content)
+	}
+	archive, err := env.archives.SelectZip(context.Background(), 1, nil, nil)
+	if err != nil {
+		t.Fatalf("select: %v", err)
+	}
+
+	// 已压缩的类型（不区分扩展名大小写）以存储方式写入，其余使用 deflate
+	want := map[string]uint16{
+		"notes.txt":       zip.Deflate,
+		"photo.JPG":       zip.Store,
+		"backup.tar.gz":   zip.Store,
+		"report.docx":     zip.Store,
+		"Makefile":        zip.Deflate,
+		"docs/readme.md":  zip.Deflate,
+		"media/clip.webm": zip.Store,
+	}
+	entries := readZip(t, archive)
+	if len(entries) != len(want) {
+		t.Fatalf("zip has %d entries, want %d", len(entries), len(want))
+	}
+	for name, method := range want {
+		f := entries[name]
+		if f == nil {
+			t.Fatalf("%s missing from zip", name)
+		}
+		if f.Method != method {
+			t.Errorf("%s method = %d, want %d", name, f.Method, method)
+		}
+		if got := zipContent(t, f); got != contents[name] {
+			t.Errorf("%s content = %q, want %q", name, got, contents[name])
+		}
+	}
+	if entries["notes.txt"].CompressedSize64 >= entries["notes.txt"].UncompressedSize64 {
+		t.Error("deflated text was not compressed")
+	}
+}
+
+func TestZipStreamSnapshot(t *testing.T) {
+	ctx := context.Background()
+	env := newArchiveTestEnv(t)
+	env.put(t, 1, "a.txt", "version 1")
+	env.put(t, 1, "docs/b.txt", "kept")
+	snapshots := NewSnapshotService(env.snapshots, env.repo, env.files.blockRepo)
+	snapshot, err := snapshots.CreateNamedSnapshot(ctx, 1, "v1", "", "")
+	if err != nil {
+		t.Fatalf("create snapshot: %v", err)
+	}
+	// 快照之后修改 a.txt、新增 c.txt
+	env.put(t, 1, "a.txt", "version 2")
+	env.put(t, 1, "c.txt", "new")
+
+	archive, err := env.archives.SelectZip(ctx, 1, snapshot, nil)
+	if err != nil {
+		t.Fatalf("select snapshot: %v", err)
+	}
+	if archive.Files != 2 || archive.Size != int64(len("version 1")+len("kept")) {
+		t.Fatalf("snapshot archive has %d files of %d bytes", archive.Files, archive.Size)
+	}
+	entries := readZip(t, archive)
+	if len(entries) != 2 || entries["a.txt"] == nil || entries["docs/b.txt"] == nil {
+		t.Fatalf("snapshot zip has %d entries, want a.txt and docs/b.txt", len(entries))
+	}
+	if got := zipContent(t, entries["a.txt"]); got != "version 1" {
+		t.Fatalf("a.txt from snapshot = %q", got)
+	}
+	// 快照中的文件以快照时间作为修改时间
+	if entries["a.txt"].Modified.Unix() != snapshot.CreatedAt.Unix() {
+		t.Fatalf("a.txt modified = %v, want the snapshot time %v", entries["a.txt"].Modified, snapshot.CreatedAt)
+	}
+
+	// 当前版本打包的是修改后的内容
+	current, err := env.archives.SelectZip(ctx, 1, nil, []string{"a.txt"})
+	if err != nil {
+		t.Fatalf("select current: %v", err)
+	}
+	if got := zipContent(t, readZip(t, current)["a.txt"]); got != "version 2" {
+		t.Fatalf("a.txt from the current version = %q", got)
+	}
+
+	// 其他库的快照不能用于打包
+	if _, err := env.archives.SelectZip(ctx, 2, snapshot, nil); !errors.Is(err, ErrSnapshotNotInLibrary) {
+		t.Fatalf("snapshot of another library: err = %v, want ErrSnapshotNotInLibrary", err)
+	}
+}
+
+func TestZipSelectNestedFolder(t *testing.T) {
+	ctx := context.Background()
+	env := newArchiveTestEnv(t)
+	for _, name := range []string{"docs/a.txt", "docs/sub/b.txt", "docs/sub/deep/c.txt", "docs/subway.txt", "other.txt"} {
+		env.put(t, 1, name, "content of "+name)
+	}
+
+	tests := []struct {
+		name  string
+		paths []string
+		want  []string
+	}{
+		// 选中单个目录时归档以该目录为顶层，同名前缀的 docs/subway.txt 不属于 docs/sub
+		{"folder", []string{"docs/sub"}, []string{"sub/b.txt", "sub/deep/c.txt"}},
+		{"folder with trailing slash", []string{"/docs/sub/"}, []string{"sub/b.txt", "sub/deep/c.txt"}},
+		{"nested folder", []string{"docs/sub/deep"}, []string{"deep/c.txt"}},
+		// 多个选中项相对于最近公共父目录
+		{"file and folder", []string{"docs/a.txt", "docs/sub/deep"}, []string{"a.txt", "sub/deep/c.txt"}},
+		{"across top level", []string{"docs/sub", "other.txt"}, []string{"docs/sub/b.txt", "docs/sub/deep/c.txt", "other.txt"}},
+		{"whole library", nil, []string{"docs/a.txt", "docs/sub/b.txt", "docs/sub/deep/c.txt", "docs/subway.txt", "other.txt"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			archive, err := env.archives.SelectZip(ctx, 1, nil, tt.paths)
+			if err != nil {
+				t.Fatalf("select: %v", err)
+			}
+			entries := readZip(t, archive)
+			for _, want := range tt.want {
+				if entries[want] == nil {
+					t.Fatalf("%s missing from zip", want)
+				}
+			}
+			if len(entries) != len(tt.want) || archive.Files != len(tt.want) {
+				t.Fatalf("zip has %d entries (%d files), want %v", len(entries), archive.Files, tt.want)
+			}
+			// 内容按归档内的路径对应到原文件
+			if f := entries["sub/deep/c.txt"]; f != nil {
+				if got := zipContent(t, f); got != "content of docs/sub/deep/c.txt" {
+					t.Fatalf("sub/deep/c.txt = %q", got)
+				}
+			}
+		})
+	}
+
+	if _, err := env.archives.SelectZip(ctx, 1, nil, []string{"docs/missing"}); !errors.Is(err, ErrPathNotFound) {
+		t.Fatalf("missing path: err = %v, want ErrPathNotFound", err)
+	}
+}
+
+// tarGz 把 entries 打包为 tar.gz，键为归档内的路径
+func tarGz(t *testing.T, entries map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for name, content := range entries {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatalf("tar header: %v", err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatalf("tar write: %v", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("close tar: %v", err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatalf("close gzip: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// zipArchive 把 entries 以 deflate 压缩为 zip，键为归档内的路径
+func zipArchive(t *testing.T, entries map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range entries {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatalf("zip create: %v", err)
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatalf("zip write: %v", err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("close zip: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestImportRejectsArchiveBombs(t *testing.T) {
+	ctx := context.Background()
+	env := newArchiveTestEnv(t)
+	env.archives.SetMaxExpandedSize(4 << 10)
+	env.archives.SetMaxImportEntries(3)
+
+	// 压缩后只有几百字节的条目展开后超过上限
+	bomb := strings.Repeat("\x00", 1<<20)
+	many := map[string]string{"a.txt": "a", "b.txt": "b", "c.txt": "c", "d.txt": "d"}
+	tests := []struct {
+		name    string
+		format  string
+		archive []byte
+	}{
+		{"gzip bomb", ArchiveTarGz, tarGz(t, map[string]string{"bomb.bin": bomb})},
+		{"zip bomb", ArchiveZip, zipArchive(t, map[string]string{"bomb.bin": bomb})},
+		// 每个条目都在上限内，合计超过上限
+		{"zip total", ArchiveZip, zipArchive(t, map[string]string{"a.bin": bomb[:3<<10], "b.bin": bomb[:3<<10]})},
+		{"tar entries", ArchiveTarGz, tarGz(t, many)},
+		{"zip entries", ArchiveZip, zipArchive(t, many)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if len(tt.archive) >= 4<<10 {
+				t.Fatalf("archive is %d bytes, want it under the expanded limit", len(tt.archive))
+			}
+			if _, err := env.archives.Import(ctx, 1, 1, "", bytes.NewReader(tt.archive), tt.format, "tester"); !errors.Is(err, ErrImportTooLarge) {
+				t.Fatalf("err = %v, want ErrImportTooLarge", err)
+			}
+			// 失败的导入不在库中留下任何文件
+			files, err := env.repo.ListFilesByLibrary(ctx, 1)
+			if err != nil || len(files) != 0 {
+				t.Fatalf("library has %d files after the rejected import: %v", len(files), err)
+			}
+		})
+	}
+
+	// 恰好在上限内的归档可以导入
+	within := map[string]string{"a.txt": "a", "b.bin": bomb[:4<<10-2], "c.txt": "c"}
+	result, err := env.archives.Import(ctx, 1, 1, "", bytes.NewReader(zipArchive(t, within)), ArchiveZip, "tester")
+	if err != nil {
+		t.Fatalf("import within the limits: %v", err)
+	}
+	if result.Files != 3 {
+		t.Fatalf("imported %d files, want 3", result.Files)
+	}
+}
@@ -0,0 +1,183 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/sealock/core-storage/storage"
+)
+
+// BlockReader 将一组按顺序排列的块呈现为一个连续的只读流
+// 块按需从 BlockStore 读取，顺序读取时每次只在内存中保留一个块；
+// 支持 Seek，首次随机定位时才查询各块大小建立偏移索引
+type BlockReader struct {
+	ctx    context.Context
+	store  storage.BlockStore
+	hashes []string
+	size   int64
+
+	offsets []int64 // offsets[i] 为第 i 个块的起始偏移，按需构建
+	pos     int64
+
+	cur      []byte // 当前已加载的块
+	curIdx   int    // 当前块下标，-1 表示未加载
+	curStart int64  // 当前块起始偏移
+}
+
+// NewBlockReader 创建块读取器
+// size 为所有块的总大小（即文件大小）
+func NewBlockReader(ctx context.Context, store storage.BlockStore, hashes []string, size int64) *BlockReader {
+	return &BlockReader{
+		ctx:    ctx,
+		store:  store,
+		hashes: hashes,
+		size:   size,
+		curIdx: -1,
+	}
+}
+
+// Size 返回流的总大小
+func (r *BlockReader) Size() int64 {
+	return r.size
+}
+
+// Read 实现 io.Reader
+func (r *BlockReader) Read(p []byte) (int, error) {
+	if r.pos >= r.size {
+		return 0, io.EOF
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	if !r.loaded(r.pos) {
+		if err := r.locate(r.pos); err != nil {
+			return 0, err
+		}
+		// 块的总大小小于声明的文件大小时，pos 之后已没有数据
+		if !r.loaded(r.pos) {
+			return 0, io.ErrUnexpectedEOF
+		}
+	}
+
+	n := copy(p, r.cur[r.pos-r.curStart:])
+	r.pos += int64(n)
+	return n, nil
+}
+
+// Seek 实现 io.Seeker
+func (r *BlockReader) Seek(offset int64, whence int) (int64, error) {
+	var abs int64
+	switch whence {
+	case io.SeekStart:
+		abs = offset
+	case io.SeekCurrent:
+		abs = r.pos + offset
+	case io.SeekEnd:
+		abs = r.size + offset
+	default:
+		return 0, errors.New("block reader: invalid whence")
+	}
+	if abs < 0 {
+		return 0, errors.New("block reader: negative position")
+	}
+	r.pos = abs
+	return abs, nil
+}
+
+// ReadAt 实现 io.ReaderAt（不改变当前读取位置）
+// 读到流末尾时返回 io.EOF；块数据短于声明的大小时返回 io.ErrUnexpectedEOF
+func (r *BlockReader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("block reader: negative offset")
+	}
+	if off >= r.size {
+		return 0, io.EOF
+	}
+	saved := r.pos
+	defer func() { r.pos = saved }()
+
+	want := p
+	if remaining := r.size - off; int64(len(p)) > remaining {
+		want = p[:remaining]
+	}
+	r.pos = off
+	n, err := io.ReadFull(r, want)
+	if err == nil && len(want) < len(p) {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// Close 释放当前缓存的块
+func (r *BlockReader) Close() error {
+	r.cur = nil
+	r.curIdx = -1
+	return nil
+}
+
+// loaded 判断 pos 是否落在当前已加载的块中
+func (r *BlockReader) loaded(pos int64) bool {
+	return r.cur != nil && pos >= r.curStart && pos < r.curStart+int64(len(r.cur))
+}
+
+// locate 加载包含 pos 的块
+// 调用方保证 pos 小于流的大小，因此找不到块说明块数据短于声明的大小
+func (r *BlockReader) locate(pos int64) error {
+	// 顺序读取：直接加载下一个块，无需偏移索引
+	if r.cur == nil && r.curIdx == -1 && pos == 0 {
+		return r.load(0, 0)
+	}
+	if r.cur != nil && pos == r.curStart+int64(len(r.cur)) && r.curIdx+1 < len(r.hashes) {
+		return r.load(r.curIdx+1, pos)
+	}
+
+	if err := r.buildOffsets(); err != nil {
+		return err
+	}
+	idx := sort.Search(len(r.offsets), func(i int) bool { return r.offsets[i] > pos }) - 1
+	if idx < 0 || idx >= len(r.hashes) {
+		return io.ErrUnexpectedEOF
+	}
+	return r.load(idx, r.offsets[idx])
+}
+
+// load 读取第 idx 个块
+func (r *BlockReader) load(idx int, start int64) error {
+	if idx >= len(r.hashes) {
+		return io.ErrUnexpectedEOF
+	}
+	data, err := r.store.Get(r.ctx, r.hashes[idx])
+	if err != nil {
+		return fmt.Errorf("failed to get block %s: %w", r.hashes[idx], err)
+	}
+	if len(data) == 0 {
+		return fmt.Errorf("block %s is empty", r.hashes[idx])
+	}
+	r.cur = data
+	r.curIdx = idx
+	r.curStart = start
+	return nil
+}
+
+// buildOffsets 查询每个块的大小，建立偏移索引
+func (r *BlockReader) buildOffsets() error {
+	if r.offsets != nil {
+		return nil
+	}
+	offsets := make([]int64, len(r.hashes))
+	var total int64
+	for i, hash := range r.hashes {
+		offsets[i] = total
+		size, err := r.store.GetSize(r.ctx, hash)
+		if err != nil {
+			return fmt.Errorf("failed to get size of block %s: %w", hash, err)
+		}
+		total += size
+	}
+	r.offsets = offsets
+	return nil
+}
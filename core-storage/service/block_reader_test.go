@@ -0,0 +1,85 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/sealock/core-storage/storage"
+)
+
+// newTestBlockReader 把 blocks 存入内存块存储，返回声明大小为 size 的读取器
+func newTestBlockReader(t *testing.T, blocks []string, size int64) *BlockReader {
+	t.Helper()
+	store := storage.NewLocalBlockStore()
+	hashes := make([]string, len(blocks))
+	for i, block := range blocks {
+		hash, err := store.Put(context.Background(), []byte(block))
+		if err != nil {
+			t.Fatalf("put block: %v", err)
+		}
+		hashes[i] = hash
+	}
+	return NewBlockReader(context.Background(), store, hashes, size)
+}
+
+func TestBlockReaderRead(t *testing.T) {
+	tests := []struct {
+		name    string
+		blocks  []string
+		size    int64
+		seek    int64
+		want    string
+		wantErr error
+	}{
+		{name: "sequential", blocks: []string{"abcd", "efgh", "ij"}, size: 10, want: "abcdefghij"},
+		{name: "seek into block", blocks: []string{"abcd", "efgh", "ij"}, size: 10, seek: 5, want: "fghij"},
+		{name: "seek to block boundary", blocks: []string{"abcd", "efgh", "ij"}, size: 10, seek: 8, want: "ij"},
+		{name: "seek to end", blocks: []string{"abcd"}, size: 4, seek: 4, want: ""},
+		{name: "seek past end", blocks: []string{"abcd"}, size: 4, seek: 9, want: ""},
+		{name: "empty", size: 0, want: ""},
+		{name: "blocks shorter than size", blocks: []string{"abcd", "ef"}, size: 10, want: "abcdef", wantErr: io.ErrUnexpectedEOF},
+		{name: "seek beyond blocks within size", blocks: []string{"abcd", "ef"}, size: 10, seek: 8, want: "", wantErr: io.ErrUnexpectedEOF},
+		{name: "no blocks", size: 3, want: "", wantErr: io.ErrUnexpectedEOF},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestBlockReader(t, tt.blocks, tt.size)
+			if _, err := r.Seek(tt.seek, io.SeekStart); err != nil {
+				t.Fatalf("seek: %v", err)
+			}
+			got, err := io.ReadAll(r)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if string(got) != tt.want {
+				t.Fatalf("read %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBlockReaderReadAt(t *testing.T) {
+	r := newTestBlockReader(t, []string{"abcd", "efgh", "ij"}, 10)
+
+	buf := make([]byte, 4)
+	if n, err := r.ReadAt(buf, 3); err != nil || string(buf[:n]) != "defg" {
+		t.Fatalf("ReadAt(3) = %q, %v", buf[:n], err)
+	}
+	if n, err := r.ReadAt(buf, 8); err != io.EOF || string(buf[:n]) != "ij" {
+		t.Fatalf("ReadAt(8) = %q, %v, want \"ij\", EOF", buf[:n], err)
+	}
+	if _, err := r.ReadAt(buf, 10); err != io.EOF {
+		t.Fatalf("ReadAt(10) err = %v, want EOF", err)
+	}
+	if _, err := r.ReadAt(buf, -1); err == nil {
+		t.Fatal("ReadAt(-1) succeeded")
+	}
+
+	short := newTestBlockReader(t, []string{"abcd"}, 10)
+	if _, err := short.ReadAt(buf, 2); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("ReadAt on short blocks err = %v, want ErrUnexpectedEOF", err)
+	}
+}
@@ -0,0 +1,567 @@
+package service
+
+import (
+	"archive/tar"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sealock/core-storage/chunker"
+	"github.com/sealock/core-storage/model"
+	"github.com/sealock/core-storage/storage"
+)
+
+const (
+	// BundleFormatVersion 快照包格式版本
+	BundleFormatVersion = 1
+	// bundleManifestName 清单条目名，必须是包中的第一个条目
+	bundleManifestName = "manifest.json"
+	// bundleBlockPrefix 块数据条目前缀，条目名为 blocks/<sha256>
+	bundleBlockPrefix = "blocks/"
+	// maxBundleBlockSize 单个块的大小上限，防止恶意包耗尽内存
+	maxBundleBlockSize = 64 << 20
+	// maxBundleManifestSize 清单的大小上限
+	maxBundleManifestSize = 64 << 20
+)
+
+// BundleManifest 快照包清单
+// 包是一个 tar 流：第一个条目为 manifest.json，随后是 blocks/<hash> 块数据条目
+type BundleManifest struct {
+	Version    int              `json:"version"`
+	LibraryID  uint             `json:"libraryId"`
+	ExportedAt time.Time        `json:"exportedAt"`
+	Snapshots  []BundleSnapshot `json:"snapshots"` // 按创建时间正序
+	Blocks     []BundleBlock    `json:"blocks"`    // 所有被引用的块（包括未随包携带的）
+}
+
+// BundleSnapshot 包中的一次提交
+type BundleSnapshot struct {
+	UUID        string       `json:"uuid"`
+	ParentUUID  string       `json:"parentUuid,omitempty"`
+	Name        string       `json:"name"`
+	Description string       `json:"description"`
+	Tag         string       `json:"tag,omitempty"`
+	RootHash    string       `json:"rootHash"`
+	CreatedAt   time.Time    `json:"createdAt"`
+	Files       []BundleFile `json:"files"`
+}
+
+// BundleFile 提交中的文件（树条目）
+type BundleFile struct {
+	Path   string   `json:"path"`
+	Hash   string   `json:"hash"`
+	Size   int64    `json:"size"`
+	Blocks []string `json:"blocks"`
+}
+
+// BundleBlock 块描述
+type BundleBlock struct {
+	Hash     string `json:"hash"`
+	Size     int64  `json:"size"`
+	Included bool   `json:"included"` // 块数据是否随包携带
+}
+
+// ExportOptions 导出选项
+type ExportOptions struct {
+	// HaveBlocks 目标端已有的块，导出时不携带其数据（增量导出）
+	HaveBlocks map[string]bool
+}
+
+// ImportOptions 导入选项
+type ImportOptions struct {
+	// LibraryID 导入到的目标库，为 0 时使用包中记录的库
+	LibraryID uint
+	// ReadableLibraries 调用方可以读取的库；未随包携带的块必须被这些库中的文件引用
+	ReadableLibraries []uint
+}
+
+// ImportResult 导入结果
+type ImportResult struct {
+	LibraryID         uint
+	SnapshotsImported []string // 新建的快照 UUID
+	SnapshotsSkipped  []string // 目标端已存在的快照 UUID
+	BlocksWritten     int      // 写入的块数量
+	BlocksSkipped     int      // 目标端已存在而跳过的块数量
+	CheckedOut        bool     // 库的当前文件是否已更新为包中最新的提交
+}
+
+// BundleService 快照导出/导入服务
+// 把一个或一段提交连同目录树、提交元数据和引用到的块打包成单个可移植文件，
+// 用于在服务器之间迁移库或制作离线备份
+type BundleService struct {
+	snapshotRepo storage.SnapshotRepository
+	blockRepo    storage.BlockRepository
+	blockStore   storage.BlockStore
+	syncService  *SyncService
+}
+
+// NewBundleService 创建快照包服务
+// syncService 用于把导入的最新提交写入库的当前文件
+func NewBundleService(sr storage.SnapshotRepository, br storage.BlockRepository, bs storage.BlockStore, syncService *SyncService) *BundleService {
+	return &BundleService{
+		snapshotRepo: sr,
+		blockRepo:    br,
+		blockStore:   bs,
+		syncService:  syncService,
+	}
+}
+
+// SnapshotRange 返回库中 from 到 to（含两端）之间的快照 ID，按创建时间正序
+// from 为空表示从最早的快照开始，to 为空表示到最新的快照为止；引用可以是数字ID或UUID
+func (s *BundleService) SnapshotRange(ctx context.Context, libraryID uint, from, to string) ([]uint, error) {
+	snapshots, err := s.snapshotRepo.ListSnapshotsByLibrary(ctx, libraryID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list snapshots: %w", err)
+	}
+
+	// 仓库返回倒序，这里转为正序
+	var ids []uint
+	started := from == ""
+	for i := len(snapshots) - 1; i >= 0; i-- {
+		snapshot := snapshots[i]
+		if !started && matchesSnapshotRef(&snapshot, from) {
+			started = true
+		}
+		if started {
+			ids = append(ids, snapshot.ID)
+		}
+		if started && to != "" && matchesSnapshotRef(&snapshot, to) {
+			return ids, nil
+		}
+	}
+	if !started || to != "" {
+		return nil, ErrSnapshotNotFound
+	}
+	return ids, nil
+}
+
+// Export 把给定快照导出为快照包写入 w
+func (s *BundleService) Export(ctx context.Context, w io.Writer, snapshotIDs []uint, opts ExportOptions) (*BundleManifest, error) {
+	if len(snapshotIDs) == 0 {
+		return nil, errors.New("no snapshots to export")
+	}
+
+	manifest := &BundleManifest{
+		Version:    BundleFormatVersion,
+		ExportedAt: time.Now().UTC(),
+	}
+	uuids := make(map[uint]string)
+	seenBlocks := make(map[string]bool)
+
+	for i, id := range snapshotIDs {
+		snapshot, err := s.snapshotRepo.GetSnapshotByID(ctx, id)
+		if err != nil || snapshot == nil {
+			return nil, fmt.Errorf("snapshot %d: %w", id, ErrSnapshotNotFound)
+		}
+		if i == 0 {
+			manifest.LibraryID = snapshot.LibraryID
+		} else if snapshot.LibraryID != manifest.LibraryID {
+			return nil, fmt.Errorf("snapshot %d belongs to library %d, expected %d", id, snapshot.LibraryID, manifest.LibraryID)
+		}
+		uuids[snapshot.ID] = snapshot.UUID
+
+		entry, err := s.snapshotEntry(ctx, snapshot, uuids)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range entry.Files {
+			for _, hash := range file.Blocks {
+				if seenBlocks[hash] {
+					continue
+				}
+				seenBlocks[hash] = true
+				size, err := s.blockStore.GetSize(ctx, hash)
+				if err != nil {
+					return nil, fmt.Errorf("failed to get size of block %s: %w", hash, err)
+				}
+				manifest.Blocks = append(manifest.Blocks, BundleBlock{
+					Hash:     hash,
+					Size:     size,
+					Included: !opts.HaveBlocks[hash],
+				})
+			}
+		}
+		manifest.Snapshots = append(manifest.Snapshots, *entry)
+	}
+
+	// 快照按创建时间正序排列，导入时父提交总是先于子提交
+	sort.SliceStable(manifest.Snapshots, func(i, j int) bool {
+		return manifest.Snapshots[i].CreatedAt.Before(manifest.Snapshots[j].CreatedAt)
+	})
+
+	tw := tar.NewWriter(w)
+	manifestJSON, err := json.Marshal(manifest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal manifest: %w", err)
+	}
+	if err := writeTarEntry(tw, bundleManifestName, manifestJSON); err != nil {
+		return nil, err
+	}
+	for _, block := range manifest.Blocks {
+		if !block.Included {
+			continue
+		}
+		data, err := s.blockStore.Get(ctx, block.Hash)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get block %s: %w", block.Hash, err)
+		}
+		if err := writeTarEntry(tw, bundleBlockPrefix+block.Hash, data); err != nil {
+			return nil, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to finish bundle: %w", err)
+	}
+
+	return manifest, nil
+}
+
+// snapshotEntry 把快照及其文件清单转换为包中的提交条目
+// uuids 缓存已知快照 ID → UUID，用于解析父提交
+func (s *BundleService) snapshotEntry(ctx context.Context, snapshot *model.Snapshot, uuids map[uint]string) (*BundleSnapshot, error) {
+	entry := &BundleSnapshot{
+		UUID:        snapshot.UUID,
+		Name:        snapshot.Name,
+		Description: snapshot.Description,
+		Tag:         snapshot.Tag,
+		RootHash:    snapshot.RootHash,
+		CreatedAt:   snapshot.CreatedAt,
+	}
+	if snapshot.ParentID != nil {
+		if parentUUID, ok := uuids[*snapshot.ParentID]; ok {
+			entry.ParentUUID = parentUUID
+		} else if parent, err := s.snapshotRepo.GetSnapshotByID(ctx, *snapshot.ParentID); err == nil && parent != nil {
+			entry.ParentUUID = parent.UUID
+		}
+	}
+
+	files, err := s.snapshotRepo.ListSnapshotFiles(ctx, snapshot.ID, 0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list snapshot files: %w", err)
+	}
+	for _, file := range files {
+		var blockHashes []string
+		if len(file.BlockIDs) > 0 {
+			if err := json.Unmarshal(file.BlockIDs, &blockHashes); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal block IDs: %w", err)
+			}
+		}
+		entry.Files = append(entry.Files, BundleFile{
+			Path:   cleanPath(file.FileName),
+			Hash:   file.FileHash,
+			Size:   file.Size,
+			Blocks: blockHashes,
+		})
+	}
+	return entry, nil
+}
+
+// Import 从快照包读取并导入提交
+// 每个随包携带的块都会重新计算 SHA-256 校验，目标端已存在的块校验后跳过，不重复写入；
+// 未随包携带的块必须已被调用方可读的库引用，大小以目标端存储的为准。
+// 所有被引用的块都确认可用后才创建快照记录，每个快照连同其文件记录和块引用在一个事务中创建。目标库中已存在的快照（UUID 相同）会被跳过，
+// UUID 已被其他库的快照占用时（例如把同一个包导入另一个库）导入的快照使用由目标库派生的新 UUID。
+// 包中最新的提交同时也是库的最新提交时，库的当前文件随之更新为该提交的目录树
+func (s *BundleService) Import(ctx context.Context, r io.Reader, opts ImportOptions) (*ImportResult, error) {
+	if s.syncService != nil {
+		if err := checkWritable(ctx, s.syncService.replication, opts.LibraryID); err != nil {
+			return nil, err
+		}
+	}
+	tr := tar.NewReader(r)
+
+	header, err := tr.Next()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read bundle: %w", err)
+	}
+	if header.Name != bundleManifestName {
+		return nil, fmt.Errorf("invalid bundle: first entry is %q, expected %q", header.Name, bundleManifestName)
+	}
+	var manifest BundleManifest
+	if err := json.NewDecoder(io.LimitReader(tr, maxBundleManifestSize)).Decode(&manifest); err != nil {
+		return nil, fmt.Errorf("invalid bundle manifest: %w", err)
+	}
+	if manifest.Version != BundleFormatVersion {
+		return nil, fmt.Errorf("unsupported bundle version %d", manifest.Version)
+	}
+
+	if err := validateManifest(&manifest); err != nil {
+		return nil, err
+	}
+	blockSizes := make(map[string]int64, len(manifest.Blocks))
+	for _, block := range manifest.Blocks {
+		blockSizes[block.Hash] = block.Size
+	}
+
+	result := &ImportResult{LibraryID: manifest.LibraryID}
+	if opts.LibraryID != 0 {
+		result.LibraryID = opts.LibraryID
+	}
+
+	// 1. 读取并校验块数据
+	available := make(map[string]bool, len(manifest.Blocks))
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return result, fmt.Errorf("failed to read bundle: %w", err)
+		}
+		if !strings.HasPrefix(header.Name, bundleBlockPrefix) {
+			return result, fmt.Errorf("invalid bundle entry %q", header.Name)
+		}
+		hash := strings.TrimPrefix(header.Name, bundleBlockPrefix)
+		if _, listed := blockSizes[hash]; !listed {
+			return result, fmt.Errorf("block %s is not listed in manifest", hash)
+		}
+		if header.Size > maxBundleBlockSize {
+			return result, fmt.Errorf("block %s exceeds maximum size", hash)
+		}
+
+		// 目标端已有的块同样要校验包中的数据，包不能借用一个哈希来引用它没有的块
+		data, err := io.ReadAll(io.LimitReader(tr, maxBundleBlockSize))
+		if err != nil {
+			return result, fmt.Errorf("failed to read block %s: %w", hash, err)
+		}
+		sum := sha256.Sum256(data)
+		if hex.EncodeToString(sum[:]) != hash {
+			return result, fmt.Errorf("block %s failed hash verification", hash)
+		}
+		if int64(len(data)) != blockSizes[hash] {
+			return result, fmt.Errorf("block %s size mismatch: manifest %d, actual %d", hash, blockSizes[hash], len(data))
+		}
+
+		exists, err := s.blockStore.Exists(ctx, hash)
+		if err != nil {
+			return result, fmt.Errorf("failed to check block %s: %w", hash, err)
+		}
+		if exists {
+			result.BlocksSkipped++
+			available[hash] = true
+			continue
+		}
+		if _, err := s.blockStore.Put(ctx, data); err != nil {
+			return result, fmt.Errorf("failed to store block %s: %w", hash, err)
+		}
+		// 先登记引用计数为 0 的元数据：导入中途失败时这些块可被 GC 回收
+		if err := s.blockRepo.SaveBlockMetadata(ctx, &model.Block{Hash: hash, Size: int64(len(data))}); err != nil {
+			return result, fmt.Errorf("failed to save block metadata %s: %w", hash, err)
+		}
+		result.BlocksWritten++
+		available[hash] = true
+	}
+
+	// 2. 确认未随包携带的块被调用方可读的库引用，与秒传一样，块哈希不能用来读取其他库的内容
+	var missing []string
+	for _, block := range manifest.Blocks {
+		if !available[block.Hash] {
+			missing = append(missing, block.Hash)
+		}
+	}
+	if len(missing) > 0 {
+		readable, err := s.syncService.fileRepository.FindBlocksInLibraries(ctx, opts.ReadableLibraries, missing)
+		if err != nil {
+			return result, err
+		}
+		for _, hash := range missing {
+			if !readable[hash] {
+				return result, fmt.Errorf("block %s is neither in the bundle nor in a library you can read", hash)
+			}
+			size, err := s.blockStore.GetSize(ctx, hash)
+			if err != nil {
+				return result, fmt.Errorf("failed to get size of block %s: %w", hash, err)
+			}
+			if size != blockSizes[hash] {
+				return result, fmt.Errorf("block %s size mismatch: manifest %d, stored %d", hash, blockSizes[hash], size)
+			}
+		}
+	}
+
+	// 3. 创建快照记录
+	uuids := make(map[string]string, len(manifest.Snapshots)) // 包中的 UUID → 目标库中的 UUID
+	for _, entry := range manifest.Snapshots {
+		local := entry
+		if entry.ParentUUID != "" && uuids[entry.ParentUUID] != "" {
+			local.ParentUUID = uuids[entry.ParentUUID]
+		}
+		existing, err := s.snapshotRepo.GetSnapshotByUUID(ctx, entry.UUID)
+		if err == nil && existing != nil && existing.LibraryID != result.LibraryID {
+			// UUID 已属于其他库：改用由目标库和原 UUID 派生的 UUID，重复导入时仍能识别
+			local.UUID = importedSnapshotUUID(result.LibraryID, entry.UUID)
+			existing, err = s.snapshotRepo.GetSnapshotByUUID(ctx, local.UUID)
+		}
+		if err == nil && existing != nil {
+			if existing.LibraryID != result.LibraryID {
+				return result, fmt.Errorf("snapshot %s already exists in library %d", local.UUID, existing.LibraryID)
+			}
+			uuids[entry.UUID] = local.UUID
+			result.SnapshotsSkipped = append(result.SnapshotsSkipped, local.UUID)
+			continue
+		}
+		if err := s.importSnapshot(ctx, result.LibraryID, &local, blockSizes); err != nil {
+			return result, err
+		}
+		uuids[entry.UUID] = local.UUID
+		result.SnapshotsImported = append(result.SnapshotsImported, local.UUID)
+	}
+
+	// 4. 包中最新的提交是库的最新提交时，更新库的当前文件
+	if len(manifest.Snapshots) > 0 {
+		latest := manifest.Snapshots[len(manifest.Snapshots)-1]
+		snapshots, err := s.snapshotRepo.ListSnapshotsByLibrary(ctx, result.LibraryID)
+		if err != nil {
+			return result, fmt.Errorf("failed to list snapshots: %w", err)
+		}
+		if len(snapshots) > 0 && snapshots[0].UUID == uuids[latest.UUID] {
+			if err := s.syncService.checkout(ctx, result.LibraryID, latest.Files, blockSizes); err != nil {
+				return result, err
+			}
+			result.CheckedOut = true
+		}
+	}
+	if s.syncService != nil && len(result.SnapshotsImported) > 0 {
+		s.syncService.commitScheduler.SnapshotCreated(result.LibraryID)
+	}
+
+	return result, nil
+}
+
+// importedSnapshotUUID 返回把快照导入另一个库时使用的 UUID
+func importedSnapshotUUID(libraryID uint, snapshotUUID string) string {
+	return uuid.NewSHA1(uuid.NameSpaceURL, []byte(fmt.Sprintf("sealock:library/%d/snapshot/%s", libraryID, snapshotUUID))).String()
+}
+
+// importSnapshot 在一个事务中创建单个快照及其文件记录，并为引用的块增加引用计数
+// 中途失败时整体回滚，不会留下只导入了一部分的快照
+func (s *BundleService) importSnapshot(ctx context.Context, libraryID uint, entry *BundleSnapshot, blockSizes map[string]int64) error {
+	var tx storage.Transactor
+	if s.syncService != nil {
+		tx = s.syncService.tx
+	}
+	return inTransaction(ctx, tx, func(ctx context.Context) error {
+		return s.createSnapshot(ctx, libraryID, entry, blockSizes)
+	})
+}
+
+// createSnapshot 创建快照及其文件记录并保留引用的块
+func (s *BundleService) createSnapshot(ctx context.Context, libraryID uint, entry *BundleSnapshot, blockSizes map[string]int64) error {
+	snapshot := &model.Snapshot{
+		UUID:        entry.UUID,
+		LibraryID:   libraryID,
+		Name:        entry.Name,
+		Description: entry.Description,
+		Tag:         entry.Tag,
+		RootHash:    entry.RootHash,
+		CreatedAt:   entry.CreatedAt,
+		FileCount:   len(entry.Files),
+	}
+	if entry.ParentUUID != "" {
+		parent, err := s.snapshotRepo.GetSnapshotByUUID(ctx, entry.ParentUUID)
+		if err == nil && parent != nil && parent.LibraryID == libraryID {
+			snapshot.ParentID = &parent.ID
+		}
+	}
+	for _, file := range entry.Files {
+		snapshot.Size += file.Size
+	}
+	if err := s.snapshotRepo.CreateSnapshot(ctx, snapshot); err != nil {
+		return fmt.Errorf("failed to create snapshot %s: %w", entry.UUID, err)
+	}
+
+	for _, file := range entry.Files {
+		blockIDs, err := json.Marshal(file.Blocks)
+		if err != nil {
+			return fmt.Errorf("failed to marshal block IDs: %w", err)
+		}
+		snapshotFile := &model.SnapshotFile{
+			SnapshotID: snapshot.ID,
+			FileName:   file.Path,
+			FileHash:   file.Hash,
+			Size:       file.Size,
+			BlockIDs:   blockIDs,
+		}
+		if err := s.snapshotRepo.CreateSnapshotFile(ctx, snapshotFile); err != nil {
+			return fmt.Errorf("failed to create snapshot file: %w", err)
+		}
+		for _, hash := range file.Blocks {
+			if err := retainBlock(ctx, s.blockRepo, hash, blockSizes[hash]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// validateManifest 检查清单内部一致性：文件引用的块必须在块列表中，且块大小之和等于文件大小；
+// 文件哈希和快照根哈希按块列表和目录树重新计算，与清单声明的不一致时拒绝导入
+func validateManifest(manifest *BundleManifest) error {
+	blockSizes := make(map[string]int64, len(manifest.Blocks))
+	for _, block := range manifest.Blocks {
+		if len(block.Hash) != sha256.Size*2 {
+			return fmt.Errorf("invalid block hash %q in manifest", block.Hash)
+		}
+		blockSizes[block.Hash] = block.Size
+	}
+	for _, snapshot := range manifest.Snapshots {
+		if snapshot.UUID == "" {
+			return errors.New("snapshot without UUID in manifest")
+		}
+		tree := make([]model.File, 0, len(snapshot.Files))
+		for _, file := range snapshot.Files {
+			var total int64
+			for _, hash := range file.Blocks {
+				size, ok := blockSizes[hash]
+				if !ok {
+					return fmt.Errorf("file %s references unlisted block %s", file.Path, hash)
+				}
+				total += size
+			}
+			if total != file.Size {
+				return fmt.Errorf("file %s size mismatch: blocks add up to %d, manifest says %d", file.Path, total, file.Size)
+			}
+			fileHash, err := chunker.ComputeFileMerkleHash(file.Blocks)
+			if err != nil {
+				return fmt.Errorf("failed to compute hash of file %s: %w", file.Path, err)
+			}
+			if fileHash != file.Hash {
+				return fmt.Errorf("file %s hash mismatch: blocks hash to %s, manifest says %s", file.Path, fileHash, file.Hash)
+			}
+			tree = append(tree, model.File{Name: file.Path, Hash: file.Hash})
+		}
+		if rootHash := rootTreeHash(tree); rootHash != snapshot.RootHash {
+			return fmt.Errorf("snapshot %s root hash mismatch: files hash to %s, manifest says %s", snapshot.UUID, rootHash, snapshot.RootHash)
+		}
+	}
+	return nil
+}
+
+// writeTarEntry 向 tar 流写入一个普通文件条目
+func writeTarEntry(tw *tar.Writer, name string, data []byte) error {
+	header := &tar.Header{
+		Name:     name,
+		Mode:     0o644,
+		Size:     int64(len(data)),
+		Typeflag: tar.TypeReg,
+	}
+	if err := tw.WriteHeader(header); err != nil {
+		return fmt.Errorf("failed to write bundle entry %s: %w", name, err)
+	}
+	if _, err := tw.Write(data); err != nil {
+		return fmt.Errorf("failed to write bundle entry %s: %w", name, err)
+	}
+	return nil
+}
+
+// matchesSnapshotRef 判断快照是否匹配数字ID或UUID引用
+func matchesSnapshotRef(snapshot *model.Snapshot, ref string) bool {
+	return snapshot.UUID == ref || fmt.Sprint(snapshot.ID) == ref
+}
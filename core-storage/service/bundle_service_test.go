@@ -0,0 +1,205 @@
+package service
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sealock/core-storage/chunker"
+	"github.com/sealock/core-storage/model"
+	"github.com/sealock/core-storage/storage"
+)
+
+func TestBundleImportIntoAnotherLibrary(t *testing.T) {
+	ctx := context.Background()
+	files := storage.NewMockFileRepository()
+	blockStore := storage.NewLocalBlockStore()
+	blockRepo := storage.NewMockBlockRepository()
+	snapshotRepo := storage.NewMockSnapshotRepository()
+	syncService := NewSyncService(files, blockStore, blockRepo, storage.NewMockConflictRepository(), nil)
+	bundles := NewBundleService(snapshotRepo, blockRepo, blockStore, syncService)
+
+	// 库 1 中有一个包含 docs/a.txt 的快照
+	hash, err := blockStore.Put(ctx, []byte("hello"))
+	if err != nil {
+		t.Fatalf("put block: %v", err)
+	}
+	if err := blockRepo.SaveBlockMetadata(ctx, &model.Block{Hash: hash, Size: 5}); err != nil {
+		t.Fatalf("save block: %v", err)
+	}
+	fileHash, _ := chunker.ComputeFileMerkleHash([]string{hash})
+	source := &model.Snapshot{
+		UUID: "2f1c9a9e-0000-4000-8000-000000000001", LibraryID: 1, CreatedAt: time.Now(),
+		RootHash: rootTreeHash([]model.File{{Name: "docs/a.txt", Hash: fileHash}}),
+	}
+	if err := snapshotRepo.CreateSnapshot(ctx, source); err != nil {
+		t.Fatalf("create snapshot: %v", err)
+	}
+	blockIDs, _ := json.Marshal([]string{hash})
+	err = snapshotRepo.CreateSnapshotFile(ctx, &model.SnapshotFile{
+		SnapshotID: source.ID, FileName: "docs/a.txt", FileHash: fileHash, Size: 5, BlockIDs: blockIDs,
+	})
+	if err != nil {
+		t.Fatalf("create snapshot file: %v", err)
+	}
+
+	var bundle bytes.Buffer
+	if _, err := bundles.Export(ctx, &bundle, []uint{source.ID}, ExportOptions{}); err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	data := bundle.Bytes()
+
+	// 导入库 2：快照使用新的 UUID，库的当前文件随之更新
+	result, err := bundles.Import(ctx, bytes.NewReader(data), ImportOptions{LibraryID: 2})
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	if len(result.SnapshotsImported) != 1 || result.SnapshotsImported[0] == source.UUID {
+		t.Fatalf("imported %v, want one snapshot with a new UUID", result.SnapshotsImported)
+	}
+	if !result.CheckedOut {
+		t.Fatal("library 2 was not checked out")
+	}
+	head, err := files.GetFileByPath(ctx, 2, "docs/a.txt")
+	if err != nil || head == nil || head.Hash != fileHash {
+		t.Fatalf("library 2 file = %+v, %v", head, err)
+	}
+
+	// 再次导入库 2 时跳过已导入的快照
+	result, err = bundles.Import(ctx, bytes.NewReader(data), ImportOptions{LibraryID: 2})
+	if err != nil {
+		t.Fatalf("reimport: %v", err)
+	}
+	if len(result.SnapshotsImported) != 0 || len(result.SnapshotsSkipped) != 1 {
+		t.Fatalf("reimport imported %v, skipped %v", result.SnapshotsImported, result.SnapshotsSkipped)
+	}
+
+	// 导入源库时按 UUID 跳过
+	result, err = bundles.Import(ctx, bytes.NewReader(data), ImportOptions{LibraryID: 1})
+	if err != nil {
+		t.Fatalf("import into source: %v", err)
+	}
+	if len(result.SnapshotsSkipped) != 1 || result.SnapshotsSkipped[0] != source.UUID {
+		t.Fatalf("import into source skipped %v", result.SnapshotsSkipped)
+	}
+
+	// 不携带块数据的包只能引用调用方可读的库中的块
+	var thin bytes.Buffer
+	if _, err := bundles.Export(ctx, &thin, []uint{source.ID}, ExportOptions{HaveBlocks: map[string]bool{hash: true}}); err != nil {
+		t.Fatalf("export without blocks: %v", err)
+	}
+	_, err = bundles.Import(ctx, bytes.NewReader(thin.Bytes()), ImportOptions{LibraryID: 3, ReadableLibraries: []uint{3}})
+	if err == nil {
+		t.Fatal("imported a block of a library the caller cannot read")
+	}
+	if snapshots, _ := snapshotRepo.ListSnapshotsByLibrary(ctx, 3); len(snapshots) != 0 {
+		t.Fatalf("rejected import created %d snapshots", len(snapshots))
+	}
+	result, err = bundles.Import(ctx, bytes.NewReader(thin.Bytes()), ImportOptions{LibraryID: 3, ReadableLibraries: []uint{2, 3}})
+	if err != nil || len(result.SnapshotsImported) != 1 {
+		t.Fatalf("import with a readable block = %+v, %v", result, err)
+	}
+}
+
+// rewriteManifest 返回清单经 edit 修改后的快照包，块条目保持不变
+func rewriteManifest(t *testing.T, bundle []byte, edit func(*BundleManifest)) []byte {
+	t.Helper()
+	tr := tar.NewReader(bytes.NewReader(bundle))
+	var out bytes.Buffer
+	tw := tar.NewWriter(&out)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("read bundle: %v", err)
+		}
+		data, _ := io.ReadAll(tr)
+		if header.Name == bundleManifestName {
+			var manifest BundleManifest
+			if err := json.Unmarshal(data, &manifest); err != nil {
+				t.Fatalf("decode manifest: %v", err)
+			}
+			edit(&manifest)
+			data, _ = json.Marshal(&manifest)
+		}
+		if err := writeTarEntry(tw, header.Name, data); err != nil {
+			t.Fatalf("write bundle: %v", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("close bundle: %v", err)
+	}
+	return out.Bytes()
+}
+
+func TestBundleImportRejectsTamperedManifest(t *testing.T) {
+	ctx := context.Background()
+	blockStore := storage.NewLocalBlockStore()
+	blockRepo := storage.NewMockBlockRepository()
+	snapshotRepo := storage.NewMockSnapshotRepository()
+	syncService := NewSyncService(storage.NewMockFileRepository(), blockStore, blockRepo, storage.NewMockConflictRepository(), nil)
+	bundles := NewBundleService(snapshotRepo, blockRepo, blockStore, syncService)
+
+	// 库 1 中有一个包含 a.txt、b.txt 的快照
+	var tree []model.File
+	source := &model.Snapshot{UUID: "2f1c9a9e-0000-4000-8000-000000000002", LibraryID: 1, CreatedAt: time.Now()}
+	if err := snapshotRepo.CreateSnapshot(ctx, source); err != nil {
+		t.Fatalf("create snapshot: %v", err)
+	}
+	for _, name := range []string{"a.txt", "b.txt"} {
+		hash, err := blockStore.Put(ctx, []byte(name))
+		if err != nil {
+			t.Fatalf("put block: %v", err)
+		}
+		if err := blockRepo.SaveBlockMetadata(ctx, &model.Block{Hash: hash, Size: int64(len(name))}); err != nil {
+			t.Fatalf("save block: %v", err)
+		}
+		fileHash, _ := chunker.ComputeFileMerkleHash([]string{hash})
+		blockIDs, _ := json.Marshal([]string{hash})
+		err = snapshotRepo.CreateSnapshotFile(ctx, &model.SnapshotFile{
+			SnapshotID: source.ID, FileName: name, FileHash: fileHash, Size: int64(len(name)), BlockIDs: blockIDs,
+		})
+		if err != nil {
+			t.Fatalf("create snapshot file: %v", err)
+		}
+		tree = append(tree, model.File{Name: name, Hash: fileHash})
+	}
+	source.RootHash = rootTreeHash(tree)
+
+	var bundle bytes.Buffer
+	if _, err := bundles.Export(ctx, &bundle, []uint{source.ID}, ExportOptions{}); err != nil {
+		t.Fatalf("export: %v", err)
+	}
+
+	// 文件哈希与块列表不符、交换两个文件的块（目录树与根哈希不符）的清单都被拒绝
+	tampered := map[string]func(*BundleManifest){
+		"file hash": func(m *BundleManifest) {
+			m.Snapshots[0].Files[0].Hash = strings.Repeat("0", 64)
+		},
+		"root hash": func(m *BundleManifest) {
+			files := m.Snapshots[0].Files
+			files[0].Hash, files[1].Hash = files[1].Hash, files[0].Hash
+			files[0].Blocks, files[1].Blocks = files[1].Blocks, files[0].Blocks
+		},
+	}
+	for name, edit := range tampered {
+		_, err := bundles.Import(ctx, bytes.NewReader(rewriteManifest(t, bundle.Bytes(), edit)), ImportOptions{LibraryID: 2})
+		if err == nil || !strings.Contains(err.Error(), "mismatch") {
+			t.Fatalf("%s tampered: err = %v, want a mismatch", name, err)
+		}
+	}
+	if snapshots, _ := snapshotRepo.ListSnapshotsByLibrary(ctx, 2); len(snapshots) != 0 {
+		t.Fatalf("tampered bundles created %d snapshots", len(snapshots))
+	}
+
+	if _, err := bundles.Import(ctx, bytes.NewReader(bundle.Bytes()), ImportOptions{LibraryID: 2}); err != nil {
+		t.Fatalf("import untampered bundle: %v", err)
+	}
+}
@@ -0,0 +1,311 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sealock/core-storage/model"
+)
+
+const (
+	// DefaultCommitQuietPeriod 默认静默窗口：库在该时间内没有新变更才触发提交
+	DefaultCommitQuietPeriod = 2 * time.Second
+	// DefaultCommitMaxDelay 默认最长延迟：持续有变更时，最迟在首个变更后该时间提交一次
+	DefaultCommitMaxDelay = 30 * time.Second
+	// commitTimeout 单次提交的超时时间
+	commitTimeout = time.Minute
+)
+
+// CommitError 自动提交失败信息
+type CommitError struct {
+	LibraryID uint
+	Err       error
+	At        time.Time
+}
+
+func (e *CommitError) Error() string {
+	return fmt.Sprintf("auto commit for library %d failed: %v", e.LibraryID, e.Err)
+}
+
+func (e *CommitError) Unwrap() error {
+	return e.Err
+}
+
+// CommitScheduler 按库合并、去抖的自动提交调度器
+// 上传/删除只需调用 Notify 标记库已变更；同一库在静默窗口内的多次变更合并为一次提交，
+// 同一库的提交串行执行，提交使用调度器自己的生命周期上下文而非请求上下文
+type CommitScheduler struct {
+	snapshotService *SnapshotService
+	quietPeriod     time.Duration
+	maxDelay        time.Duration
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu        sync.Mutex
+	pending   map[uint]*pendingCommit
+	libLocks  map[uint]*sync.Mutex
+	lastError map[uint]*CommitError
+	holds     map[uint]int // 库 ID → 暂停自动提交的次数
+	running   map[uint]int // 库 ID → 已取出但尚未结束的提交数
+	idle      *sync.Cond   // 某个库的提交全部结束时广播，与 mu 配合使用
+	stopped   bool
+
+	// OnError 提交失败时回调（可选），未设置时仅记录日志
+	OnError func(*CommitError)
+	// OnCommit 生成新提交后回调（可选），在提交所在的 goroutine 中执行
+	OnCommit func(*model.Commit)
+	// OnSnapshot 由自动提交以外的途径（手动快照、快照包导入、复制）创建快照后回调（可选）
+	OnSnapshot func(libraryID uint)
+}
+
+// pendingCommit 一个库待执行的合并提交
+type pendingCommit struct {
+	timer    *time.Timer
+	first    time.Time // 本轮第一次变更的时间
+	author   string
+	deferred bool // 到期时库的自动提交被暂停，恢复后执行
+}
+
+// NewCommitScheduler 创建自动提交调度器
+// quietPeriod/maxDelay 不大于 0 时使用默认值
+func NewCommitScheduler(snapshotService *SnapshotService, quietPeriod, maxDelay time.Duration) *CommitScheduler {
+	if quietPeriod <= 0 {
+		quietPeriod = DefaultCommitQuietPeriod
+	}
+	if maxDelay <= 0 {
+		maxDelay = DefaultCommitMaxDelay
+	}
+	if maxDelay < quietPeriod {
+		maxDelay = quietPeriod
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cs := &CommitScheduler{
+		snapshotService: snapshotService,
+		quietPeriod:     quietPeriod,
+		maxDelay:        maxDelay,
+		ctx:             ctx,
+		cancel:          cancel,
+		pending:         make(map[uint]*pendingCommit),
+		libLocks:        make(map[uint]*sync.Mutex),
+		lastError:       make(map[uint]*CommitError),
+		holds:           make(map[uint]int),
+		running:         make(map[uint]int),
+	}
+	cs.idle = sync.NewCond(&cs.mu)
+	return cs
+}
+
+// Notify 标记库发生了变更，在静默窗口结束后触发一次合并提交
+// author 为空时沿用本轮已记录的作者
+func (cs *CommitScheduler) Notify(libraryID uint, author string) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	if cs.stopped {
+		return
+	}
+
+	p, exists := cs.pending[libraryID]
+	if !exists {
+		p = &pendingCommit{first: time.Now()}
+		cs.pending[libraryID] = p
+		p.timer = time.AfterFunc(cs.quietPeriod, func() { cs.fire(libraryID, p) })
+	} else {
+		// 未超过最长延迟时顺延，否则保持原定时间，避免持续写入导致永不提交
+		delay := cs.quietPeriod
+		if remaining := cs.maxDelay - time.Since(p.first); remaining < delay {
+			delay = remaining
+		}
+		if delay > 0 {
+			p.timer.Reset(delay)
+		}
+	}
+	if author != "" {
+		p.author = author
+	}
+}
+
+// Hold 暂停库的自动提交，直到调用返回的函数恢复
+// 暂停期间的变更照常登记，恢复后立即合并为一次提交；用于归档导入等需要把大批变更记录为一个提交的操作。
+// 可以多次暂停同一库，全部恢复后才提交
+func (cs *CommitScheduler) Hold(libraryID uint) (release func()) {
+	cs.mu.Lock()
+	cs.holds[libraryID]++
+	cs.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			cs.mu.Lock()
+			cs.holds[libraryID]--
+			if cs.holds[libraryID] > 0 {
+				cs.mu.Unlock()
+				return
+			}
+			delete(cs.holds, libraryID)
+			p := cs.pending[libraryID]
+			cs.mu.Unlock()
+			if p != nil {
+				p.timer.Stop()
+				cs.fire(libraryID, p)
+			}
+		})
+	}
+}
+
+// Flush 立即执行所有待提交的库并等待完成
+// 自动提交被暂停的库仍保持待提交，恢复后执行。
+// 定时器已到期但 fire 尚未取走的库仍在 pending 中，由这里直接执行；
+// fire 只会执行一次同一个 pendingCommit，之后到达的定时器回调直接返回
+func (cs *CommitScheduler) Flush() {
+	cs.mu.Lock()
+	due := make(map[uint]*pendingCommit, len(cs.pending))
+	for libraryID, p := range cs.pending {
+		p.timer.Stop()
+		due[libraryID] = p
+	}
+	cs.mu.Unlock()
+
+	for libraryID, p := range due {
+		cs.fire(libraryID, p)
+	}
+	cs.wg.Wait()
+}
+
+// Stop 停止调度器：不再接受新的变更通知，执行所有待提交的变更后取消生命周期上下文
+// ctx 到期时放弃等待并直接取消正在执行的提交
+func (cs *CommitScheduler) Stop(ctx context.Context) error {
+	cs.mu.Lock()
+	cs.stopped = true
+	cs.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		cs.Flush()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		cs.cancel()
+		return nil
+	case <-ctx.Done():
+		cs.cancel()
+		return ctx.Err()
+	}
+}
+
+// Cancel 丢弃库待执行的自动提交，并等待库已开始的提交结束
+// 用于删除库，调用方应持有库的写锁，使之后不再有新的变更通知
+func (cs *CommitScheduler) Cancel(libraryID uint) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if p, ok := cs.pending[libraryID]; ok {
+		p.timer.Stop()
+		delete(cs.pending, libraryID)
+	}
+	for cs.running[libraryID] > 0 {
+		cs.idle.Wait()
+	}
+	delete(cs.lastError, libraryID)
+}
+
+// LastError 返回库最近一次自动提交的错误，成功提交后清空
+func (cs *CommitScheduler) LastError(libraryID uint) *CommitError {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	return cs.lastError[libraryID]
+}
+
+// fire 从待提交队列取出库并异步执行提交
+func (cs *CommitScheduler) fire(libraryID uint, p *pendingCommit) {
+	cs.mu.Lock()
+	if cs.pending[libraryID] != p {
+		cs.mu.Unlock()
+		return
+	}
+	if cs.holds[libraryID] > 0 {
+		p.deferred = true
+		cs.mu.Unlock()
+		return
+	}
+	delete(cs.pending, libraryID)
+	lock, exists := cs.libLocks[libraryID]
+	if !exists {
+		lock = &sync.Mutex{}
+		cs.libLocks[libraryID] = lock
+	}
+	cs.running[libraryID]++
+	cs.wg.Add(1)
+	cs.mu.Unlock()
+
+	go func() {
+		defer cs.wg.Done()
+		defer cs.finished(libraryID)
+		lock.Lock()
+		defer lock.Unlock()
+		cs.commit(libraryID, p.author)
+	}()
+}
+
+// finished 记录库的一次提交已结束
+func (cs *CommitScheduler) finished(libraryID uint) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cs.running[libraryID]--
+	if cs.running[libraryID] == 0 {
+		delete(cs.running, libraryID)
+		cs.idle.Broadcast()
+	}
+}
+
+// SnapshotCreated 通知调度器库中由其他途径创建了快照，调度器为 nil 时不做任何事
+func (cs *CommitScheduler) SnapshotCreated(libraryID uint) {
+	if cs == nil {
+		return
+	}
+	cs.mu.Lock()
+	onSnapshot := cs.OnSnapshot
+	cs.mu.Unlock()
+	if onSnapshot != nil {
+		onSnapshot(libraryID)
+	}
+}
+
+// commit 执行一次提交并记录结果
+func (cs *CommitScheduler) commit(libraryID uint, author string) {
+	ctx, cancel := context.WithTimeout(cs.ctx, commitTimeout)
+	defer cancel()
+
+	repoID := strconv.FormatUint(uint64(libraryID), 10)
+	commit, err := cs.snapshotService.CreateCommit(ctx, repoID, author)
+
+	cs.mu.Lock()
+	if err == nil || errors.Is(err, ErrNoChanges) {
+		delete(cs.lastError, libraryID)
+		onCommit := cs.OnCommit
+		cs.mu.Unlock()
+		if commit != nil && onCommit != nil {
+			onCommit(commit)
+		}
+		return
+	}
+	commitErr := &CommitError{LibraryID: libraryID, Err: err, At: time.Now()}
+	cs.lastError[libraryID] = commitErr
+	onError := cs.OnError
+	cs.mu.Unlock()
+
+	if onError != nil {
+		onError(commitErr)
+	} else {
+		log.Println(commitErr.Error())
+	}
+}
@@ -0,0 +1,144 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sealock/core-storage/model"
+	"github.com/sealock/core-storage/storage"
+)
+
+// schedulerTestEnv 自动提交调度器的测试环境，提交写入内存仓库
+type schedulerTestEnv struct {
+	scheduler *CommitScheduler
+	files     storage.FileRepository
+	commits   atomic.Int32
+	nextFile  atomic.Int32
+}
+
+func newSchedulerTestEnv(t *testing.T, quietPeriod, maxDelay time.Duration) *schedulerTestEnv {
+	t.Helper()
+	env := &schedulerTestEnv{files: storage.NewMockFileRepository()}
+	snapshots := NewSnapshotService(storage.NewMockSnapshotRepository(), env.files, storage.NewMockBlockRepository())
+	env.scheduler = NewCommitScheduler(snapshots, quietPeriod, maxDelay)
+	env.scheduler.OnCommit = func(*model.Commit) { env.commits.Add(1) }
+	env.scheduler.OnError = func(err *CommitError) { t.Errorf("commit failed: %v", err) }
+	t.Cleanup(func() { env.scheduler.Stop(context.Background()) })
+	return env
+}
+
+// change 在库中新建一个文件并通知调度器
+func (e *schedulerTestEnv) change(t *testing.T, libraryID uint) {
+	t.Helper()
+	n := e.nextFile.Add(1)
+	file := &model.File{Name: fmt.Sprintf("file-%d.txt", n), Hash: fmt.Sprintf("hash-%d", n), LibraryID: libraryID}
+	if err := e.files.CreateFile(context.Background(), file); err != nil {
+		t.Fatalf("create file: %v", err)
+	}
+	e.scheduler.Notify(libraryID, "tester")
+}
+
+func TestCommitSchedulerCoalescesChanges(t *testing.T) {
+	env := newSchedulerTestEnv(t, 50*time.Millisecond, time.Minute)
+	for i := 0; i < 5; i++ {
+		env.change(t, 1)
+	}
+	env.change(t, 2)
+
+	time.Sleep(200 * time.Millisecond)
+	env.scheduler.Flush()
+	if got := env.commits.Load(); got != 2 {
+		t.Fatalf("commits = %d, want one per library", got)
+	}
+}
+
+func TestCommitSchedulerMaxDelay(t *testing.T) {
+	env := newSchedulerTestEnv(t, 50*time.Millisecond, 150*time.Millisecond)
+
+	// 持续写入时静默窗口永远不会结束，最长延迟到期后仍要提交
+	deadline := time.Now().Add(400 * time.Millisecond)
+	for time.Now().Before(deadline) {
+		env.change(t, 1)
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := env.commits.Load(); got < 2 {
+		t.Fatalf("commits during continuous writes = %d, want at least 2", got)
+	}
+}
+
+func TestCommitSchedulerHold(t *testing.T) {
+	env := newSchedulerTestEnv(t, 10*time.Millisecond, 20*time.Millisecond)
+
+	release := env.scheduler.Hold(1)
+	releaseAgain := env.scheduler.Hold(1)
+	env.change(t, 1)
+	env.change(t, 1)
+	time.Sleep(50 * time.Millisecond)
+	env.scheduler.Flush()
+	if got := env.commits.Load(); got != 0 {
+		t.Fatalf("commits while held = %d, want 0", got)
+	}
+
+	release()
+	release() // 重复调用不影响计数
+	env.scheduler.Flush()
+	if got := env.commits.Load(); got != 0 {
+		t.Fatalf("commits while still held once = %d, want 0", got)
+	}
+
+	releaseAgain()
+	env.scheduler.Flush()
+	if got := env.commits.Load(); got != 1 {
+		t.Fatalf("commits after release = %d, want 1", got)
+	}
+}
+
+func TestCommitSchedulerFlushWaitsForFiredCommits(t *testing.T) {
+	env := newSchedulerTestEnv(t, time.Millisecond, time.Millisecond)
+
+	// 定时器可能恰好在 Flush 时到期，Flush 返回前这次变更也必须已经提交
+	for i := 1; i <= 50; i++ {
+		env.change(t, 1)
+		time.Sleep(time.Millisecond)
+		env.scheduler.Flush()
+		if got := env.commits.Load(); got != int32(i) {
+			t.Fatalf("after flush %d: commits = %d", i, got)
+		}
+	}
+}
+
+func TestCommitSchedulerStop(t *testing.T) {
+	env := newSchedulerTestEnv(t, time.Minute, time.Minute)
+	env.change(t, 1)
+	env.change(t, 2)
+
+	if err := env.scheduler.Stop(context.Background()); err != nil {
+		t.Fatalf("stop: %v", err)
+	}
+	if got := env.commits.Load(); got != 2 {
+		t.Fatalf("commits after stop = %d, want pending changes committed", got)
+	}
+
+	env.change(t, 1)
+	env.scheduler.Flush()
+	if got := env.commits.Load(); got != 2 {
+		t.Fatalf("commits after notify on stopped scheduler = %d, want 2", got)
+	}
+}
+
+func TestCommitSchedulerCancel(t *testing.T) {
+	env := newSchedulerTestEnv(t, 50*time.Millisecond, time.Minute)
+	env.change(t, 1)
+	env.change(t, 2)
+
+	// 被取消的库不再提交，其他库不受影响
+	env.scheduler.Cancel(1)
+	time.Sleep(200 * time.Millisecond)
+	env.scheduler.Flush()
+	if got := env.commits.Load(); got != 1 {
+		t.Fatalf("commits = %d, want only library 2", got)
+	}
+}
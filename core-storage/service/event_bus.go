@@ -0,0 +1,287 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/sealock/core-storage/syncproto"
+)
+
+// DefaultEventHistory 每个库在内存中保留的事件数，断线重连的客户端可从中补发
+const DefaultEventHistory = 1024
+
+// subscriberBuffer 每个订阅者的事件缓冲，写满说明客户端跟不上，订阅会被关闭
+const subscriberBuffer = 256
+
+// seqBits 游标中库内序号占用的低位，高位为事件总线的纪元；单个库在一次运行中最多约 40 亿个事件
+const seqBits = 32
+
+// ErrCursorExpired 游标对应的事件已不在保留范围内（或来自服务重启之前），客户端需要做一次全量同步
+var ErrCursorExpired = errors.New("event cursor expired")
+
+// 变更事件的类型与客户端共用，定义在 syncproto 包中
+type (
+	EventType = syncproto.EventType
+	Event     = syncproto.Event
+)
+
+const (
+	EventFileCreated   = syncproto.EventFileCreated
+	EventFileUpdated   = syncproto.EventFileUpdated
+	EventFileDeleted   = syncproto.EventFileDeleted
+	EventFileMoved     = syncproto.EventFileMoved
+	EventCommitCreated = syncproto.EventCommitCreated
+)
+
+// EventBus 进程内的变更事件总线
+// 各服务在文件或提交变化后发布事件，HTTP 层按库订阅并推送给客户端；
+// 每个库在环形缓冲中保留最近的事件用于断线续传。
+// 游标（即事件的 Seq）高 32 位是总线创建时随机生成的纪元，低 32 位是库内从 1 开始的序号，
+// 服务重启后纪元改变，旧游标总是返回 ErrCursorExpired 而不会漏掉事件
+type EventBus struct {
+	mu        sync.Mutex
+	history   int
+	epoch     uint64
+	libraries map[uint]*libraryEvents
+}
+
+// libraryEvents 单个库的事件序号、保留的事件和订阅者
+// 只有发布过事件或有订阅者的库才有状态，没有订阅者且未发布过事件的库不占用内存
+type libraryEvents struct {
+	seq    uint64  // 最后一个事件的库内序号
+	events []Event // 环形缓冲，未写满时按序号递增
+	next   int     // 缓冲写满后下一个被覆盖的位置，即最早的事件
+	subs   map[*Subscription]struct{}
+}
+
+// Subscription 一个库的事件订阅
+// 订阅者消费过慢导致缓冲写满时，C 会被关闭，客户端应以最后收到的序号重新订阅
+type Subscription struct {
+	C <-chan Event
+	// Start 订阅建立时库的游标，C 中的事件都在它之后
+	Start uint64
+
+	ch        chan Event
+	bus       *EventBus
+	libraryID uint
+	closed    bool
+}
+
+// NewEventBus 创建事件总线，history 不大于 0 时使用默认值
+func NewEventBus(history int) *EventBus {
+	if history <= 0 {
+		history = DefaultEventHistory
+	}
+	return &EventBus{
+		history:   history,
+		epoch:     newEventEpoch(),
+		libraries: make(map[uint]*libraryEvents),
+	}
+}
+
+// newEventEpoch 生成非零的随机纪元
+func newEventEpoch() uint64 {
+	var buf [4]byte
+	for {
+		if _, err := rand.Read(buf[:]); err != nil {
+			// 随机数不可用时退回到时间，仍能区分绝大多数重启
+			return uint64(uint32(time.Now().UnixNano())) | 1
+		}
+		if epoch := uint64(binary.BigEndian.Uint32(buf[:])); epoch != 0 {
+			return epoch
+		}
+	}
+}
+
+// Publish 发布事件，按顺序分配序号并投递给订阅者
+// 总线为 nil 时不做任何事，未配置事件总线的服务可直接调用
+func (b *EventBus) Publish(events ...Event) {
+	if b == nil || len(events) == 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	for _, event := range events {
+		lib := b.library(event.LibraryID)
+		lib.seq++
+		event.Seq = b.cursor(lib.seq)
+		if event.Time.IsZero() {
+			event.Time = now
+		}
+
+		if len(lib.events) < b.history {
+			lib.events = append(lib.events, event)
+		} else {
+			lib.events[lib.next] = event
+			lib.next = (lib.next + 1) % b.history
+		}
+
+		for sub := range lib.subs {
+			select {
+			case sub.ch <- event:
+			default:
+				b.closeLocked(sub)
+			}
+		}
+	}
+}
+
+// Subscribe 订阅库的事件
+// after 为客户端收到的最后一个游标，返回其后仍保留的事件（需先于 C 中的事件处理）；
+// after 为 0 表示只接收新事件；游标已过期时返回 ErrCursorExpired，
+// 调用方可以 after=0 重新订阅，并以 Subscription.Start 作为新的游标。
+// 调用方需先确认用户可以访问该库
+func (b *EventBus) Subscribe(libraryID uint, after uint64) (*Subscription, []Event, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	backlog, err := b.since(b.libraries[libraryID], after)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	lib := b.library(libraryID)
+	ch := make(chan Event, subscriberBuffer)
+	sub := &Subscription{C: ch, Start: b.cursor(lib.seq), ch: ch, bus: b, libraryID: libraryID}
+	lib.subs[sub] = struct{}{}
+	return sub, backlog, nil
+}
+
+// Since 返回库在 after 之后仍保留的事件和当前游标，用于不支持长连接的客户端轮询
+func (b *EventBus) Since(libraryID uint, after uint64) ([]Event, uint64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	lib := b.libraries[libraryID]
+	current := b.cursor(0)
+	if lib != nil {
+		current = b.cursor(lib.seq)
+	}
+	events, err := b.since(lib, after)
+	if err != nil {
+		return nil, current, err
+	}
+	if events == nil {
+		events = []Event{}
+	}
+	return events, current, nil
+}
+
+// Cursor 返回库当前的游标
+func (b *EventBus) Cursor(libraryID uint) uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if lib := b.libraries[libraryID]; lib != nil {
+		return b.cursor(lib.seq)
+	}
+	return b.cursor(0)
+}
+
+// Close 取消订阅，可重复调用
+func (s *Subscription) Close() {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+	s.bus.closeLocked(s)
+}
+
+// since 返回 after 之后仍保留的事件，lib 为 nil 表示库还没有事件，调用方需持有 mu
+func (b *EventBus) since(lib *libraryEvents, after uint64) ([]Event, error) {
+	if after == 0 {
+		return nil, nil
+	}
+	if after>>seqBits != b.epoch {
+		return nil, ErrCursorExpired
+	}
+	from := after & (1<<seqBits - 1)
+	if lib == nil {
+		if from != 0 {
+			return nil, ErrCursorExpired
+		}
+		return nil, nil
+	}
+	if from > lib.seq || lib.seq-from > uint64(len(lib.events)) {
+		return nil, ErrCursorExpired
+	}
+	missing := lib.seq - from
+	if missing == 0 {
+		return nil, nil
+	}
+	// 序号连续，after 之后的事件就是缓冲中最新的 missing 个
+	events := make([]Event, 0, missing)
+	for i := len(lib.events) - int(missing); i < len(lib.events); i++ {
+		events = append(events, lib.events[(lib.next+i)%len(lib.events)])
+	}
+	return events, nil
+}
+
+// cursor 把库内序号和纪元组合为游标
+func (b *EventBus) cursor(seq uint64) uint64 {
+	return b.epoch<<seqBits | seq
+}
+
+// closeLocked 移除订阅并关闭其通道，库既没有订阅者也没有事件时释放其状态，调用方需持有 mu
+func (b *EventBus) closeLocked(sub *Subscription) {
+	if sub.closed {
+		return
+	}
+	sub.closed = true
+	if lib := b.libraries[sub.libraryID]; lib != nil {
+		delete(lib.subs, sub)
+		if len(lib.subs) == 0 && lib.seq == 0 {
+			delete(b.libraries, sub.libraryID)
+		}
+	}
+	close(sub.ch)
+}
+
+// library 返回库的事件状态，不存在时创建，调用方需持有 mu
+// 只在发布事件和订阅时调用：发布来自已存在库的写入，订阅前 HTTP 层已校验库的访问权限
+func (b *EventBus) library(libraryID uint) *libraryEvents {
+	lib, ok := b.libraries[libraryID]
+	if !ok {
+		lib = &libraryEvents{subs: make(map[*Subscription]struct{})}
+		b.libraries[libraryID] = lib
+	}
+	return lib
+}
+
+// fileEvents 把一次变更中的文件事件合并：删除旧路径并以相同内容新建的一对事件合并为 file.moved
+func fileEvents(events []Event) []Event {
+	deleted := make(map[string][]int) // 内容哈希 → 删除事件下标
+	for i, event := range events {
+		if event.Type == EventFileDeleted && event.Hash != "" {
+			deleted[event.Hash] = append(deleted[event.Hash], i)
+		}
+	}
+	if len(deleted) == 0 {
+		return events
+	}
+
+	moved := make(map[int]bool)
+	merged := make([]Event, 0, len(events))
+	for _, event := range events {
+		if event.Type == EventFileCreated {
+			if candidates := deleted[event.Hash]; len(candidates) > 0 {
+				from := events[candidates[0]]
+				deleted[event.Hash] = candidates[1:]
+				moved[candidates[0]] = true
+				event.Type = EventFileMoved
+				event.OldPath = from.Path
+			}
+		}
+		merged = append(merged, event)
+	}
+
+	result := merged[:0]
+	for i, event := range merged {
+		if !moved[i] {
+			result = append(result, event)
+		}
+	}
+	return result
+}
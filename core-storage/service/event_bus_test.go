@@ -0,0 +1,97 @@
+package service
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestEventBusHistory(t *testing.T) {
+	bus := NewEventBus(3)
+	start := bus.Cursor(1)
+	for _, path := range []string{"a", "b", "c", "d", "e"} {
+		bus.Publish(Event{Type: EventFileCreated, LibraryID: 1, Path: path})
+	}
+
+	// 只保留最后 3 个事件，更早的游标已过期
+	if _, _, err := bus.Since(1, start); !errors.Is(err, ErrCursorExpired) {
+		t.Fatalf("since start: error = %v, want ErrCursorExpired", err)
+	}
+	events, current, err := bus.Since(1, start+2)
+	if err != nil {
+		t.Fatalf("since: %v", err)
+	}
+	var paths []string
+	for _, event := range events {
+		paths = append(paths, event.Path)
+	}
+	if len(paths) != 3 || paths[0] != "c" || paths[2] != "e" {
+		t.Fatalf("paths = %v, want [c d e]", paths)
+	}
+	if current != events[2].Seq || current != start+5 {
+		t.Fatalf("cursor = %d, want %d", current, start+5)
+	}
+	if events, _, err := bus.Since(1, current); err != nil || len(events) != 0 {
+		t.Fatalf("since current = %v, %v", events, err)
+	}
+	if _, _, err := bus.Since(1, current+1); !errors.Is(err, ErrCursorExpired) {
+		t.Fatalf("future cursor: error = %v, want ErrCursorExpired", err)
+	}
+}
+
+func TestEventBusEpoch(t *testing.T) {
+	before := NewEventBus(0)
+	before.Publish(Event{Type: EventFileCreated, LibraryID: 1, Path: "a"})
+	cursor := before.Cursor(1)
+
+	// 重启后的总线序号从头开始，旧游标不能误用
+	after := NewEventBus(0)
+	for _, path := range []string{"a", "b"} {
+		after.Publish(Event{Type: EventFileCreated, LibraryID: 1, Path: path})
+	}
+	if after.epoch == before.epoch {
+		t.Skip("random epochs collided")
+	}
+	if _, _, err := after.Since(1, cursor); !errors.Is(err, ErrCursorExpired) {
+		t.Fatalf("old cursor: error = %v, want ErrCursorExpired", err)
+	}
+	if _, _, err := after.Subscribe(1, cursor); !errors.Is(err, ErrCursorExpired) {
+		t.Fatalf("subscribe with old cursor: error = %v, want ErrCursorExpired", err)
+	}
+}
+
+func TestEventBusLibraryState(t *testing.T) {
+	bus := NewEventBus(0)
+
+	// 读取没有事件的库不创建状态
+	bus.Cursor(7)
+	if _, _, err := bus.Since(7, bus.Cursor(7)); err != nil {
+		t.Fatalf("since: %v", err)
+	}
+	if len(bus.libraries) != 0 {
+		t.Fatalf("libraries = %d, want 0", len(bus.libraries))
+	}
+
+	sub, _, err := bus.Subscribe(7, 0)
+	if err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+	bus.Publish(Event{Type: EventFileCreated, LibraryID: 7, Path: "a"})
+	if event := <-sub.C; event.Path != "a" || event.Seq != sub.Start+1 {
+		t.Fatalf("event = %+v, start %d", event, sub.Start)
+	}
+	sub.Close()
+	sub.Close()
+	if len(bus.libraries) != 1 {
+		t.Fatalf("libraries = %d, want 1 (the library has retained events)", len(bus.libraries))
+	}
+
+	// 没有事件的库在最后一个订阅关闭后释放
+	idle, _, err := bus.Subscribe(8, 0)
+	if err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+	idle.Close()
+	if _, ok := bus.libraries[8]; ok {
+		t.Fatal("idle library state was not released")
+	}
+}
@@ -3,8 +3,13 @@ package service
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"sort"
+	"sync"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/redis/go-redis/v9"
 	"github.com/sealock/core-storage/chunker"
 	"github.com/sealock/core-storage/model"
@@ -19,9 +24,17 @@ type FileService struct {
 	blockRepo          storage.BlockRepository   // 块仓库接口，用于管理块的引用计数等元数据
 	chunker            chunker.Chunker           // 分块器，用于将文件流切分成固定或动态大小的数据块
 	snapshotService    *SnapshotService          // 快照服务，用于创建和管理系统在某一时刻的状态快照
+	commitScheduler    *CommitScheduler          // 自动提交调度器，合并短时间内的多次变更
 	snapshotRepo       storage.SnapshotRepository // 快照仓库接口，用于持久化快照元数据
 	autoUpdateRefCount bool                      // 标志位，指示是否自动管理块的引用计数
 	redisClient        *redis.Client             // Redis客户端，用于跟踪上传会话等临时状态
+	events             *EventBus                 // 变更事件总线，为 nil 时不发布事件
+	tusLocks           sync.Map                  // tus 上传 ID → *sync.Mutex，串行化同一上传的写入
+	quota              QuotaProvider             // 用户配额，为 nil 时上传不检查配额
+	tx                 storage.Transactor        // 数据库事务，为 nil 时不使用事务
+	locks              *LibraryLocks             // 库的写锁，与同步服务共用
+	replication        *ReplicationService       // 用于拒绝对只读副本的写入，为 nil 时不限制
+	stagingGrace       time.Duration             // 上传清理不回收在这段时间内写入的块
 }
 
 // NewFileService 创建并初始化一个新的文件服务实例
@@ -43,26 +56,70 @@ func NewFileService(
 	redisClient *redis.Client,
 	autoUpdateRefCount bool,
 ) *FileService {
-	snapshotService := NewSnapshotService(sr, fr)
+	snapshotService := NewSnapshotService(sr, fr, br)
 	return &FileService{
 		blockStore:         bs,
 		fileRepo:           fr,
 		blockRepo:          br,
 		chunker:            c,
 		snapshotService:    snapshotService,
+		commitScheduler:    NewCommitScheduler(snapshotService, DefaultCommitQuietPeriod, DefaultCommitMaxDelay),
 		snapshotRepo:       sr,
 		autoUpdateRefCount: autoUpdateRefCount,
 		redisClient:        redisClient,
+		locks:              NewLibraryLocks(),
+		stagingGrace:       DefaultStagingGrace,
 	}
 }
 
+// CommitScheduler 返回文件服务使用的自动提交调度器
+// 调用方可通过它查询提交失败信息或设置 OnError 回调
+func (s *FileService) CommitScheduler() *CommitScheduler {
+	return s.commitScheduler
+}
+
+// LibraryLocks 返回库的写锁
+// 同步服务等其他修改库文件的服务应通过 SetLibraryLocks 共用这组锁
+func (s *FileService) LibraryLocks() *LibraryLocks {
+	return s.locks
+}
+
+// SetReplication 设置复制服务，对只读副本的上传、删除和移动返回 ErrReadOnlyReplica
+// 检查按库进行：不属于任何库的 UploadFile 不受影响
+func (s *FileService) SetReplication(replication *ReplicationService) {
+	s.replication = replication
+}
+
+// SetEventBus 设置变更事件总线，文件的新建、删除以及自动提交都会发布事件
+func (s *FileService) SetEventBus(events *EventBus) {
+	s.events = events
+	s.snapshotService.SetEventBus(events)
+}
+
+// SetTransactor 设置数据库事务，快照等跨表写入在同一事务中完成
+func (s *FileService) SetTransactor(tx storage.Transactor) {
+	s.tx = tx
+	s.snapshotService.SetTransactor(tx)
+}
+
+// SetStagingGrace 设置上传清理回收过期、终止或写入失败的上传的块时，最近写入的块受保护的时长
+func (s *FileService) SetStagingGrace(grace time.Duration) {
+	s.stagingGrace = grace
+}
+
+// Close 停止自动提交调度器，执行所有尚未提交的变更
+func (s *FileService) Close(ctx context.Context) error {
+	return s.commitScheduler.Stop(ctx)
+}
+
 // UploadFile 上传一个新文件到存储系统
 // 实现步骤:
 // 1. 使用分块器将文件数据切分成多个块
 // 2. 将每个块独立存储，利用内容寻址(CAS)实现自动去重
 // 3. 更新每个块的引用计数
 // 4. 将所有块的哈希值序列化后与文件名、大小等信息一起作为元数据保存
-// 5. 成功后触发创建一个自动快照
+// 5. 成功后通知自动提交调度器，由其合并后创建快照
+// 文件不属于任何库（LibraryID 为 0），因此不做只读副本检查；写入库的上传走上传会话、tus 或库文件接口
 // 参数:
 // - ctx: 上下文，用于控制超时和取消
 // - fileName: 文件的原始名称
@@ -109,10 +166,15 @@ func (s *FileService) UploadFile(ctx context.Context, fileName string, data []by
 	}
 
 	// 步骤3: 记录文件元数据
+	fileHash, err := chunker.ComputeFileMerkleHash(blockHashes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute file hash: %w", err)
+	}
 	file := &model.File{
+		UUID: uuid.New().String(),
 		Name: fileName,
 		Size: int64(len(data)),
-		Hash: calculateFileHash(data), // Calculate file hash from content
+		Hash: fileHash, // 文件指纹 = 块哈希列表的 Merkle 哈希，与分片上传和同步协议一致
 	}
 
 	// 将块ID序列化为JSON并存储到BlockIDs字段
@@ -127,10 +189,10 @@ func (s *FileService) UploadFile(ctx context.Context, fileName string, data []by
 		return nil, fmt.Errorf("failed to create file record: %w", err)
 	}
 
-	// 创建自动快照（异步）
-	go func() {
-		_, _ = s.snapshotService.CreateCommit(ctx, "", "")
-	}()
+	s.events.Publish(Event{LibraryID: file.LibraryID, Type: EventFileCreated, Path: file.Name, Hash: file.Hash, Size: file.Size})
+
+	// 登记自动提交（由调度器合并执行）
+	s.commitScheduler.Notify(file.LibraryID, "")
 
 	// 步骤4: 返回文件
 	return file, nil
@@ -266,6 +328,26 @@ func (s *FileService) GetFileByHash(ctx context.Context, hash string) (*model.Fi
 	return file, nil
 }
 
+// OpenFile 打开文件内容用于流式读取
+// 返回按块读取的 BlockReader（支持 Seek，可用于 Range 请求）和文件元数据；文件不存在时均返回 nil
+func (s *FileService) OpenFile(ctx context.Context, fileID uint) (*BlockReader, *model.File, error) {
+	file, err := s.fileRepo.GetFileByID(ctx, fileID)
+	if err != nil {
+		if errors.Is(err, storage.ErrFileNotFound) {
+			return nil, nil, nil
+		}
+		return nil, nil, fmt.Errorf("failed to get file: %w", err)
+	}
+	if file == nil {
+		return nil, nil, nil
+	}
+	blockHashes, err := fileBlockHashes(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	return NewBlockReader(ctx, s.blockStore, blockHashes, file.Size), file, nil
+}
+
 // GetAllFiles 获取系统中存储的所有文件的元数据
 // 返回一个包含所有文件对象的切片
 // 注意：此操作可能在文件数量巨大时消耗较多资源
@@ -294,7 +376,8 @@ func (s *FileService) GetAllFiles(ctx context.Context) ([]*model.File, error) {
 // 2. 解析出其所依赖的所有数据块
 // 3. 对每个块的引用计数进行递减
 // 4. 删除文件自身的元数据记录
-// 5. 成功后触发创建一个自动快照
+// 5. 成功后通知自动提交调度器，由其合并后创建快照
+// 文件不属于任何库（LibraryID 为 0），因此不做只读副本检查；写入库的上传走上传会话、tus 或库文件接口
 // 参数:
 // - ctx: 上下文
 // - fileHash: 待删除文件的哈希
@@ -305,6 +388,12 @@ func (s *FileService) DeleteFile(ctx context.Context, fileHash string) error {
 	if err != nil {
 		return fmt.Errorf("failed to get file: %w", err)
 	}
+	lock := s.locks.Get(file.LibraryID)
+	lock.Lock()
+	defer lock.Unlock()
+	if err := checkWritable(ctx, s.replication, file.LibraryID); err != nil {
+		return err
+	}
 
 	// 2. 解析块ID列表
 	var blockHashes []string
@@ -325,11 +414,10 @@ func (s *FileService) DeleteFile(ctx context.Context, fileHash string) error {
 	if err := s.fileRepo.DeleteFile(ctx, file.ID); err != nil {
 		return fmt.Errorf("failed to delete file record: %w", err)
 	}
+	s.events.Publish(Event{LibraryID: file.LibraryID, Type: EventFileDeleted, Path: file.Name, Hash: file.Hash, Size: file.Size})
 
-	// 创建自动快照（异步）
-	go func() {
-		_, _ = s.snapshotService.CreateCommit(ctx, "", "")
-	}()
+	// 登记自动提交（由调度器合并执行）
+	s.commitScheduler.Notify(file.LibraryID, "")
 
 	return nil
 }
@@ -348,34 +436,23 @@ func (s *FileService) CreateSnapshot(ctx context.Context, name, description stri
 		return nil, fmt.Errorf("failed to get files: %w", err)
 	}
 
-	// Create snapshot record
+	// Create snapshot record and link files to it
 	snapshot := &model.Snapshot{
+		UUID:        uuid.New().String(),
 		Name:        name,
 		Description: description,
 	}
 
-	err = s.snapshotRepo.CreateSnapshot(ctx, snapshot)
-	if err != nil {
+	if err := s.snapshotService.saveSnapshot(ctx, snapshot, files); err != nil {
 		return nil, err
 	}
 
-	// Link files to the snapshot
-	for _, file := range files {
-		snapshotFile := &model.SnapshotFile{
-			SnapshotID: snapshot.ID,
-			FileID:     file.ID,
-			FileName:   file.Name,
-		}
-		if err := s.snapshotRepo.CreateSnapshotFile(ctx, snapshotFile); err != nil {
-			return nil, fmt.Errorf("failed to create snapshot file: %w", err)
-		}
-	}
-
 	return snapshot, nil
 }
 
 // CompareSnapshots 比较两个快照之间的差异
-// 用于分析两次备份之间文件的变化情况
+// 用于分析两次备份之间文件的变化情况，按文件路径对比：
+// 只在新快照中存在的为新增，只在旧快照中存在的为删除，路径相同但内容哈希不同的为修改（记录新版本）
 // 参数:
 // - ctx: 上下文
 // - oldSnapshotID: 旧快照的ID
@@ -384,22 +461,18 @@ func (s *FileService) CreateSnapshot(ctx context.Context, name, description stri
 func (s *FileService) CompareSnapshots(ctx context.Context, oldSnapshotID, newSnapshotID uint) (*model.SnapshotDiff, error) {
 	// Get snapshots
 	oldSnapshot, err := s.snapshotRepo.GetSnapshotByID(ctx, oldSnapshotID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get old snapshot: %w", err)
+	if err != nil || oldSnapshot == nil {
+		return nil, fmt.Errorf("failed to get old snapshot %d: %w", oldSnapshotID, ErrSnapshotNotFound)
 	}
 
 	newSnapshot, err := s.snapshotRepo.GetSnapshotByID(ctx, newSnapshotID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get new snapshot: %w", err)
+	if err != nil || newSnapshot == nil {
+		return nil, fmt.Errorf("failed to get new snapshot %d: %w", newSnapshotID, ErrSnapshotNotFound)
 	}
 
 	// If root hashes are the same, no changes
-	if oldSnapshot.RootHash == newSnapshot.RootHash {
-		return &model.SnapshotDiff{
-			Added:    []model.SnapshotFile{},
-			Removed:  []model.SnapshotFile{},
-			Modified: []model.SnapshotFile{},
-		}, nil
+	if oldSnapshot.RootHash != "" && oldSnapshot.RootHash == newSnapshot.RootHash {
+		return diffSnapshotFiles(nil, nil), nil
 	}
 
 	// Get files in both snapshots
@@ -413,57 +486,41 @@ func (s *FileService) CompareSnapshots(ctx context.Context, oldSnapshotID, newSn
 		return nil, fmt.Errorf("failed to get files for new snapshot: %w", err)
 	}
 
-	// Build file hash maps for comparison
-	oldFileMap := make(map[string]model.SnapshotFile)
-	for _, file := range oldFiles {
-		oldFileMap[file.FileHash] = file
-	}
+	return diffSnapshotFiles(oldFiles, newFiles), nil
+}
 
-	newFileMap := make(map[string]model.SnapshotFile)
-	for _, file := range newFiles {
-		newFileMap[file.FileHash] = file
+// diffSnapshotFiles 按路径对比两组快照文件，结果按路径排序
+func diffSnapshotFiles(oldFiles, newFiles []model.SnapshotFile) *model.SnapshotDiff {
+	oldFileMap := make(map[string]model.SnapshotFile, len(oldFiles))
+	for _, file := range oldFiles {
+		oldFileMap[cleanPath(file.FileName)] = file
 	}
 
-	// Detect changes
 	diff := &model.SnapshotDiff{
 		Added:    []model.SnapshotFile{},
 		Removed:  []model.SnapshotFile{},
 		Modified: []model.SnapshotFile{},
 	}
-
-	// Files in new but not in old -> Added
-	for hash, file := range newFileMap {
-		if _, exists := oldFileMap[hash]; !exists {
+	seen := make(map[string]bool, len(newFiles))
+	for _, file := range newFiles {
+		filePath := cleanPath(file.FileName)
+		seen[filePath] = true
+		old, exists := oldFileMap[filePath]
+		switch {
+		case !exists:
 			diff.Added = append(diff.Added, file)
+		case old.FileHash != file.FileHash:
+			diff.Modified = append(diff.Modified, file)
 		}
 	}
-
-	// Files in old but not in new -> Removed
-	for hash, file := range oldFileMap {
-		if _, exists := newFileMap[hash]; !exists {
+	for filePath, file := range oldFileMap {
+		if !seen[filePath] {
 			diff.Removed = append(diff.Removed, file)
 		}
 	}
 
-	// Files with same hash but different names or other attributes could be considered modified
-	// For now, we only consider hash differences
-
-	return diff, nil
-}
-
-// calculateFileHash 根据文件内容计算其唯一哈希值
-// 在实际生产环境中，这里应使用真正的哈希算法如SHA-256
-// 当前实现仅为占位符，使用数据长度生成伪哈希
-// 参数:
-// - data: 文件的原始字节数据
-// 返回计算出的哈希字符串
-func calculateFileHash(data []byte) string {
-	// In a real implementation, this would calculate the actual hash
-	// For now, we'll return a placeholder
-	return fmt.Sprintf("hash_%d", len(data))
+	for _, files := range [][]model.SnapshotFile{diff.Added, diff.Removed, diff.Modified} {
+		sort.Slice(files, func(i, j int) bool { return files[i].FileName < files[j].FileName })
+	}
+	return diff
 }
-
-
-
-
-
@@ -0,0 +1,116 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sealock/core-storage/storage"
+)
+
+// DefaultBlockGracePeriod 引用计数为 0 的块写入后不被回收的时长
+// 块先写入存储（引用计数为 0）再由文件引用，上传会话中的分片最长要等到会话过期才被引用，
+// 宽限期长于上传会话的有效期，回收器不会删除仍在上传中或刚写入尚未引用的块
+const DefaultBlockGracePeriod = DefaultUploadSessionTTL + uploadKeyGrace
+
+// GarbageCollector 块垃圾回收器
+// 负责删除引用计数已归零的块数据及其元数据
+type GarbageCollector struct {
+	blockStore storage.BlockStore
+	blockRepo  storage.BlockRepository
+	tx         storage.Transactor
+	grace      time.Duration
+}
+
+// NewGarbageCollector 创建垃圾回收器，宽限期为 DefaultBlockGracePeriod
+func NewGarbageCollector(bs storage.BlockStore, br storage.BlockRepository) *GarbageCollector {
+	return &GarbageCollector{
+		blockStore: bs,
+		blockRepo:  br,
+		grace:      DefaultBlockGracePeriod,
+	}
+}
+
+// SetTransactor 设置删除块元数据与块数据时使用的事务
+func (gc *GarbageCollector) SetTransactor(tx storage.Transactor) {
+	gc.tx = tx
+}
+
+// SetGracePeriod 设置引用计数为 0 的块写入后不被回收的时长
+func (gc *GarbageCollector) SetGracePeriod(grace time.Duration) {
+	gc.grace = grace
+}
+
+// Collect 回收给定块中引用计数已归零的部分
+// 调用方在释放引用后把可能变为孤儿的块交给回收器，仍被引用或仍在宽限期内的块会被跳过
+// 返回实际删除的块数量
+func (gc *GarbageCollector) Collect(ctx context.Context, hashes []string) (int, error) {
+	stagedBefore := time.Now().Add(-gc.grace)
+	removed := 0
+	for _, hash := range hashes {
+		block, err := gc.blockRepo.GetBlockMetadata(ctx, hash)
+		if err != nil || block == nil || block.RefCount > 0 {
+			continue
+		}
+		deleted, err := gc.remove(ctx, hash, stagedBefore)
+		if err != nil {
+			return removed, err
+		}
+		if deleted {
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+// Sweep 全量扫描孤儿块并回收，仍在宽限期内的块会被跳过
+func (gc *GarbageCollector) Sweep(ctx context.Context) (int, error) {
+	stagedBefore := time.Now().Add(-gc.grace)
+	orphans, err := gc.blockRepo.ListOrphanBlocks(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list orphan blocks: %w", err)
+	}
+
+	removed := 0
+	for _, hash := range orphans {
+		deleted, err := gc.remove(ctx, hash, stagedBefore)
+		if err != nil {
+			return removed, err
+		}
+		if deleted {
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+// remove 在一个事务中删除块元数据和块数据，返回是否删除
+// 元数据只在引用计数仍为 0 且写入早于 stagedBefore 时删除，删除成功才删除块数据，删除数据失败时元数据随事务回滚；
+// 读取引用计数之后被重新引用或重新写入的块不会被删除
+func (gc *GarbageCollector) remove(ctx context.Context, hash string, stagedBefore time.Time) (bool, error) {
+	var deleted bool
+	err := inTransaction(ctx, gc.tx, func(ctx context.Context) error {
+		var err error
+		deleted, err = gc.blockRepo.DeleteBlockMetadata(ctx, hash, stagedBefore)
+		if err != nil {
+			return fmt.Errorf("failed to delete block metadata %s: %w", hash, err)
+		}
+		if !deleted {
+			return nil
+		}
+		exists, err := gc.blockStore.Exists(ctx, hash)
+		if err != nil {
+			return fmt.Errorf("failed to check block %s: %w", hash, err)
+		}
+		if exists {
+			if err := gc.blockStore.Delete(ctx, hash); err != nil {
+				return fmt.Errorf("failed to delete block %s: %w", hash, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return deleted, nil
+}
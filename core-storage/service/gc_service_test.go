@@ -0,0 +1,55 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sealock/core-storage/model"
+	"github.com/sealock/core-storage/storage"
+)
+
+func TestGarbageCollectorSkipsReferencedAndStagedBlocks(t *testing.T) {
+	ctx := context.Background()
+	blockStore := storage.NewLocalBlockStore()
+	blockRepo := storage.NewMockBlockRepository()
+
+	put := func(data string) string {
+		hash, err := blockStore.Put(ctx, []byte(data))
+		if err != nil {
+			t.Fatalf("put block: %v", err)
+		}
+		if err := blockRepo.SaveBlockMetadata(ctx, &model.Block{Hash: hash, Size: int64(len(data))}); err != nil {
+			t.Fatalf("save block: %v", err)
+		}
+		return hash
+	}
+	referenced, staged := put("referenced"), put("staged")
+	if err := blockRepo.IncrementRefCount(ctx, referenced, 1); err != nil {
+		t.Fatalf("retain block: %v", err)
+	}
+
+	// 刚写入、引用计数为 0 的块在宽限期内不被回收
+	gc := NewGarbageCollector(blockStore, blockRepo)
+	if removed, err := gc.Collect(ctx, []string{referenced, staged}); err != nil || removed != 0 {
+		t.Fatalf("collect within grace period = %d, %v, want 0", removed, err)
+	}
+	if ok, _ := blockStore.Exists(ctx, staged); !ok {
+		t.Fatal("staged block was collected within the grace period")
+	}
+
+	// 宽限期过后只回收未被引用的块
+	gc.SetGracePeriod(-time.Second)
+	if removed, err := gc.Sweep(ctx); err != nil || removed != 1 {
+		t.Fatalf("sweep = %d, %v, want 1", removed, err)
+	}
+	if ok, _ := blockStore.Exists(ctx, staged); ok {
+		t.Error("unreferenced block was not collected")
+	}
+	if ok, _ := blockStore.Exists(ctx, referenced); !ok {
+		t.Error("referenced block was collected")
+	}
+	if block, _ := blockRepo.GetBlockMetadata(ctx, referenced); block == nil {
+		t.Error("metadata of the referenced block was deleted")
+	}
+}
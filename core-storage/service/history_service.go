@@ -0,0 +1,168 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/sealock/core-storage/model"
+	"github.com/sealock/core-storage/storage"
+)
+
+// ErrSnapshotNotInLibrary 快照不属于目标库，不能用于回滚或打包下载
+var ErrSnapshotNotInLibrary = errors.New("snapshot does not belong to library")
+
+// HistoryService 历史版本服务：分页浏览库的快照、手动创建命名快照、对比快照和回滚
+type HistoryService struct {
+	snapshotService *SnapshotService
+	fileService     *FileService
+	syncService     *SyncService
+	snapshotRepo    storage.SnapshotRepository
+}
+
+// RevertResult 回滚结果
+type RevertResult struct {
+	LibraryID uint   `json:"libraryId"`
+	Snapshot  string `json:"snapshot"` // 回滚到的快照 UUID
+	Written   int    `json:"written"`  // 恢复或覆盖的文件数
+	Removed   int    `json:"removed"`  // 删除的文件数（快照之后新增的文件）
+}
+
+// NewHistoryService 创建历史版本服务
+// 回滚通过同步服务写入文件，与同步、复制共用库锁，并由同一个自动提交调度器生成新提交
+func NewHistoryService(fileService *FileService, syncService *SyncService) *HistoryService {
+	return &HistoryService{
+		snapshotService: fileService.snapshotService,
+		fileService:     fileService,
+		syncService:     syncService,
+		snapshotRepo:    fileService.snapshotRepo,
+	}
+}
+
+// ResolveSnapshot 根据数字 ID 或 UUID 查找快照
+func (s *HistoryService) ResolveSnapshot(ctx context.Context, ref string) (*model.Snapshot, error) {
+	return resolveSnapshot(ctx, s.snapshotRepo, ref)
+}
+
+// ListSnapshots 分页列出库的快照（即提交历史），最新的在前，同时返回总数
+func (s *HistoryService) ListSnapshots(ctx context.Context, libraryID uint, limit, offset int) ([]model.Snapshot, int, error) {
+	return s.snapshotService.ListLibrarySnapshots(ctx, libraryID, limit, offset)
+}
+
+// CreateSnapshot 为库的当前状态创建命名快照
+func (s *HistoryService) CreateSnapshot(ctx context.Context, libraryID uint, name, description, tag string) (*model.Snapshot, error) {
+	// 副本的提交历史只来自主服务器
+	if err := checkWritable(ctx, s.syncService.replication, libraryID); err != nil {
+		return nil, err
+	}
+	snapshot, err := s.snapshotService.CreateNamedSnapshot(ctx, libraryID, name, description, tag)
+	if err != nil {
+		return nil, err
+	}
+	s.syncService.commitScheduler.SnapshotCreated(libraryID)
+	return snapshot, nil
+}
+
+// ListFiles 分页列出快照中的文件，limit 不大于 0 表示不限制
+func (s *HistoryService) ListFiles(ctx context.Context, snapshotID uint, limit, offset int) ([]model.SnapshotFile, error) {
+	files, err := s.snapshotRepo.ListSnapshotFiles(ctx, snapshotID, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list snapshot files: %w", err)
+	}
+	return files, nil
+}
+
+// Parent 返回快照的父快照，没有父快照或父快照已被清理时返回 nil
+func (s *HistoryService) Parent(ctx context.Context, snapshot *model.Snapshot) (*model.Snapshot, error) {
+	if snapshot.ParentID == nil {
+		return nil, nil
+	}
+	parent, err := s.snapshotRepo.GetSnapshotByID(ctx, *snapshot.ParentID)
+	if err != nil || parent == nil {
+		return nil, nil
+	}
+	return parent, nil
+}
+
+// Diff 对比两个快照，from 为 nil 时视为空快照，to 中的文件全部为新增
+func (s *HistoryService) Diff(ctx context.Context, from, to *model.Snapshot) (*model.SnapshotDiff, error) {
+	if from != nil {
+		return s.fileService.CompareSnapshots(ctx, from.ID, to.ID)
+	}
+	files, err := s.snapshotRepo.ListSnapshotFiles(ctx, to.ID, 0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list snapshot files: %w", err)
+	}
+	return diffSnapshotFiles(nil, files), nil
+}
+
+// Revert 把库恢复到快照时的状态
+// 内容与快照不同的文件被恢复，快照之后新增的文件被删除；历史不会被改写，
+// 回滚本身由自动提交调度器记录为一个新提交，之后仍可回滚到回滚前的任意版本
+func (s *HistoryService) Revert(ctx context.Context, libraryID uint, snapshot *model.Snapshot, author string) (*RevertResult, error) {
+	if snapshot.LibraryID != libraryID {
+		return nil, ErrSnapshotNotInLibrary
+	}
+	files, err := s.snapshotRepo.ListSnapshotFiles(ctx, snapshot.ID, 0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list snapshot files: %w", err)
+	}
+
+	lock := s.syncService.libraryLock(libraryID)
+	lock.Lock()
+	defer lock.Unlock()
+	defer s.syncService.flushEvents(libraryID)
+	if err := checkWritable(ctx, s.syncService.replication, libraryID); err != nil {
+		return nil, err
+	}
+
+	tree, err := s.syncService.LoadLibraryTree(ctx, libraryID, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// 所有写入在同一事务中完成：中途失败时库保持回滚前的状态，块引用的释放随事务一起撤销
+	result := &RevertResult{LibraryID: libraryID, Snapshot: snapshot.UUID}
+	err = inTransaction(ctx, s.syncService.tx, func(ctx context.Context) error {
+		result.Written, result.Removed = 0, 0
+		wanted := make(map[string]bool, len(files))
+		for _, file := range files {
+			filePath := cleanPath(file.FileName)
+			wanted[filePath] = true
+			if currentHash(tree, filePath) == file.FileHash {
+				continue
+			}
+			var blocks []string
+			if len(file.BlockIDs) > 0 {
+				if err := json.Unmarshal(file.BlockIDs, &blocks); err != nil {
+					return fmt.Errorf("failed to unmarshal block IDs of %s: %w", filePath, err)
+				}
+			}
+			syncFile := SyncFile{Path: filePath, Hash: file.FileHash, Size: file.Size, Blocks: blocks}
+			if err := s.syncService.writeFile(ctx, libraryID, tree, filePath, syncFile, nil); err != nil {
+				return err
+			}
+			result.Written++
+		}
+		for filePath, file := range tree.Files {
+			if wanted[filePath] {
+				continue
+			}
+			if err := s.syncService.removeFile(ctx, file); err != nil {
+				return err
+			}
+			result.Removed++
+		}
+		return nil
+	})
+	if err != nil {
+		s.syncService.discardEvents(libraryID)
+		return nil, err
+	}
+
+	if (result.Written > 0 || result.Removed > 0) && s.syncService.commitScheduler != nil {
+		s.syncService.commitScheduler.Notify(libraryID, author)
+	}
+	return result, nil
+}
@@ -0,0 +1,160 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sealock/core-storage/chunker"
+	"github.com/sealock/core-storage/model"
+	"github.com/sealock/core-storage/storage"
+)
+
+// historyTestEnv 历史版本测试使用的服务及其存储
+type historyTestEnv struct {
+	files   *FileService
+	history *HistoryService
+	repo    storage.FileRepository
+	blocks  storage.BlockRepository
+}
+
+func newHistoryTestEnv(t *testing.T) *historyTestEnv {
+	t.Helper()
+	repo := storage.NewMockFileRepository()
+	blocks := storage.NewMockBlockRepository()
+	store := storage.NewLocalBlockStore()
+	files := NewFileService(store, repo, blocks, chunker.NewFixedSizeChunker(4),
+		storage.NewMockSnapshotRepository(), newTestRedis(t), true)
+	t.Cleanup(func() { files.Close(context.Background()) })
+	sync := NewSyncService(repo, store, blocks, storage.NewMockConflictRepository(), files.CommitScheduler())
+	sync.SetLibraryLocks(files.LibraryLocks())
+	return &historyTestEnv{files: files, history: NewHistoryService(files, sync), repo: repo, blocks: blocks}
+}
+
+// put 把 content 写入库中的路径
+func (e *historyTestEnv) put(t *testing.T, libraryID uint, filePath, content string) *model.File {
+	t.Helper()
+	file, err := e.files.PutFile(context.Background(), libraryID, 1, filePath, strings.NewReader(content), int64(len(content)))
+	if err != nil {
+		t.Fatalf("put %s: %v", filePath, err)
+	}
+	return file
+}
+
+func TestRevert(t *testing.T) {
+	ctx := context.Background()
+	env := newHistoryTestEnv(t)
+	originalHash := env.put(t, 1, "a.txt", "hello").Hash
+	env.put(t, 1, "keep.txt", "same")
+	snapshot, err := env.history.CreateSnapshot(ctx, 1, "before", "", "")
+	if err != nil {
+		t.Fatalf("create snapshot: %v", err)
+	}
+
+	// 快照之后修改 a.txt、新增 b.txt
+	// 仓库返回的文件记录会随之后的写入变化，先记下块列表
+	var replaced []string
+	for filePath, content := range map[string]string{"a.txt": "changed!", "b.txt": "new file"} {
+		hashes, _ := fileBlockHashes(env.put(t, 1, filePath, content))
+		replaced = append(replaced, hashes...)
+	}
+	env.files.CommitScheduler().Flush()
+
+	result, err := env.history.Revert(ctx, 1, snapshot, "tester")
+	if err != nil {
+		t.Fatalf("revert: %v", err)
+	}
+	if result.Written != 1 || result.Removed != 1 || result.Snapshot != snapshot.UUID {
+		t.Fatalf("revert = %+v, want one file written and one removed", result)
+	}
+	restored, _ := env.repo.GetFileByPath(ctx, 1, "a.txt")
+	if restored == nil || restored.Hash != originalHash || restored.Size != 5 {
+		t.Fatalf("a.txt after revert = %+v", restored)
+	}
+	if file, _ := env.repo.GetFileByPath(ctx, 1, "b.txt"); file != nil {
+		t.Fatal("file added after the snapshot was not removed")
+	}
+	// 库中的文件对修改和新增内容的引用被释放，只剩回滚前的提交中的引用
+	for _, hash := range replaced {
+		if block, _ := env.blocks.GetBlockMetadata(ctx, hash); block == nil || block.RefCount != 1 {
+			t.Fatalf("block %s = %+v, want one reference", hash, block)
+		}
+	}
+	// 回滚本身记录为一个新提交，内容与快照相同
+	env.files.CommitScheduler().Flush()
+	latest, total, err := env.history.ListSnapshots(ctx, 1, 1, 0)
+	if err != nil || len(latest) != 1 {
+		t.Fatalf("list snapshots: %v, %v", latest, err)
+	}
+	if total != 3 || latest[0].UUID == snapshot.UUID || latest[0].RootHash != snapshot.RootHash {
+		t.Fatalf("latest snapshot = %+v of %d, want a new commit with the reverted tree", latest[0], total)
+	}
+
+	// 已是快照状态时不做任何修改
+	result, err = env.history.Revert(ctx, 1, snapshot, "tester")
+	if err != nil || result.Written != 0 || result.Removed != 0 {
+		t.Fatalf("second revert = %+v, %v", result, err)
+	}
+}
+
+func TestRevertRejectsSnapshotOfAnotherLibrary(t *testing.T) {
+	ctx := context.Background()
+	env := newHistoryTestEnv(t)
+	env.put(t, 2, "secret.txt", "secret")
+	snapshot, err := env.history.CreateSnapshot(ctx, 2, "other", "", "")
+	if err != nil {
+		t.Fatalf("create snapshot: %v", err)
+	}
+
+	// 不能用其他库的快照覆盖本库，也就不会把其他库的内容复制进来
+	if _, err := env.history.Revert(ctx, 1, snapshot, "tester"); !errors.Is(err, ErrSnapshotNotInLibrary) {
+		t.Fatalf("err = %v, want ErrSnapshotNotInLibrary", err)
+	}
+	if file, _ := env.repo.GetFileByPath(ctx, 1, "secret.txt"); file != nil {
+		t.Fatal("revert copied a file of another library")
+	}
+}
+
+func TestListSnapshotsPages(t *testing.T) {
+	ctx := context.Background()
+	snapshots := storage.NewMockSnapshotRepository()
+	service := NewSnapshotService(snapshots, storage.NewMockFileRepository(), storage.NewMockBlockRepository())
+
+	// 库 1 有 5 个依次提交的快照，库 2 的快照不计入
+	now := time.Now()
+	var parent *uint
+	var uuids []string
+	for i := 0; i < 5; i++ {
+		snapshot := &model.Snapshot{UUID: string(rune('a' + i)), LibraryID: 1, ParentID: parent, CreatedAt: now.Add(time.Duration(i) * time.Minute)}
+		if err := snapshots.CreateSnapshot(ctx, snapshot); err != nil {
+			t.Fatalf("create snapshot: %v", err)
+		}
+		parent = &snapshot.ID
+		uuids = append(uuids, snapshot.UUID)
+	}
+	if err := snapshots.CreateSnapshot(ctx, &model.Snapshot{UUID: "other", LibraryID: 2, CreatedAt: now}); err != nil {
+		t.Fatalf("create snapshot: %v", err)
+	}
+
+	page, total, err := service.ListLibrarySnapshots(ctx, 1, 2, 1)
+	if err != nil {
+		t.Fatalf("list snapshots: %v", err)
+	}
+	if total != 5 || len(page) != 2 || page[0].UUID != uuids[3] || page[1].UUID != uuids[2] {
+		t.Fatalf("page = %v, total %d", page, total)
+	}
+	if page, total, _ := service.ListLibrarySnapshots(ctx, 1, 2, 10); len(page) != 0 || total != 5 {
+		t.Fatalf("page past the end = %v, total %d", page, total)
+	}
+
+	// 页内最后一个提交的父提交不在本页，仍能给出其哈希
+	commits, total, err := service.GetCommitHistory(ctx, "1", 2, 0)
+	if err != nil {
+		t.Fatalf("commit history: %v", err)
+	}
+	if total != 5 || len(commits) != 2 || commits[1].ParentCommitHash == nil || *commits[1].ParentCommitHash != uuids[2] {
+		t.Fatalf("commits = %+v, total %d", commits, total)
+	}
+}
@@ -0,0 +1,49 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/sealock/core-storage/storage"
+)
+
+// ErrLibraryAccessDenied 用户无权访问库
+var ErrLibraryAccessDenied = errors.New("library access denied")
+
+// LibraryAccess 判断用户能否访问库，目前只有库的所有者可以读写
+// 路径中带库ID的接口由中间件统一检查；按文件、快照、上传会话等其他资源访问库的接口在处理函数中检查
+type LibraryAccess struct {
+	libraryRepo storage.LibraryRepository
+}
+
+// NewLibraryAccess 创建新的LibraryAccess实例
+func NewLibraryAccess(libraryRepo storage.LibraryRepository) *LibraryAccess {
+	return &LibraryAccess{libraryRepo: libraryRepo}
+}
+
+// Check 检查用户能否访问库
+// 库不存在时返回 storage.ErrLibraryNotFound，不是所有者时返回 ErrLibraryAccessDenied
+func (a *LibraryAccess) Check(ctx context.Context, userID, libraryID uint) error {
+	lib, err := a.libraryRepo.GetLibraryByID(ctx, libraryID)
+	if err != nil {
+		return err
+	}
+	if userID == 0 || lib.OwnerID != userID {
+		return fmt.Errorf("%w: %d", ErrLibraryAccessDenied, libraryID)
+	}
+	return nil
+}
+
+// Libraries 返回用户可以访问的库ID集合
+func (a *LibraryAccess) Libraries(ctx context.Context, userID uint) (map[uint]bool, error) {
+	libs, err := a.libraryRepo.ListLibrariesByOwner(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list libraries: %w", err)
+	}
+	ids := make(map[uint]bool, len(libs))
+	for _, lib := range libs {
+		ids[lib.ID] = true
+	}
+	return ids, nil
+}
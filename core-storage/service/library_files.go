@@ -0,0 +1,199 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/sealock/core-storage/chunker"
+	"github.com/sealock/core-storage/model"
+)
+
+// ErrInvalidPath 库内路径为空或指向库根目录
+var ErrInvalidPath = errors.New("invalid file path")
+
+// ListLibraryFiles 列出库中的所有文件，按路径排序
+func (s *FileService) ListLibraryFiles(ctx context.Context, libraryID uint) ([]model.File, error) {
+	files, err := s.fileRepo.ListFilesByLibrary(ctx, libraryID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list library files: %w", err)
+	}
+	return files, nil
+}
+
+// GetFileByPath 获取库中指定路径的文件，不存在时返回 nil
+func (s *FileService) GetFileByPath(ctx context.Context, libraryID uint, filePath string) (*model.File, error) {
+	filePath = cleanPath(filePath)
+	if filePath == "" {
+		return nil, nil
+	}
+	return s.fileRepo.GetFileByPath(ctx, libraryID, filePath)
+}
+
+// PutFile 从 r 流式读取内容写入库中的路径，已有文件时覆盖
+// 内容按分块器的块大小切分后存入块存储，与分片上传一样按块去重；
+// size 为声明的长度（未知时传 -1），已知时先为 ownerID 预留配额且实际读取的长度必须与之一致；
+// 未知时在读完内容后按实际长度检查配额
+func (s *FileService) PutFile(ctx context.Context, libraryID, ownerID uint, filePath string, r io.Reader, size int64) (*model.File, error) {
+	filePath = cleanPath(filePath)
+	if filePath == "" {
+		return nil, ErrInvalidPath
+	}
+	reserved, err := s.reserveQuota(ctx, ownerID, size)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { s.releaseQuota(ctx, ownerID, reserved) }()
+
+	hashes, sizes, total, err := s.storeContent(ctx, r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store content of %s: %w", filePath, err)
+	}
+	if size >= 0 && total != size {
+		s.discardBlocks(ctx, hashes)
+		return nil, fmt.Errorf("%w: read %d bytes, expected %d", ErrUploadSizeMismatch, total, size)
+	}
+	if size < 0 {
+		if reserved, err = s.reserveQuota(ctx, ownerID, total); err != nil {
+			s.discardBlocks(ctx, hashes)
+			return nil, err
+		}
+	}
+
+	fileHash, err := chunker.ComputeFileMerkleHash(hashes)
+	if err != nil {
+		s.discardBlocks(ctx, hashes)
+		return nil, fmt.Errorf("failed to compute file hash: %w", err)
+	}
+	file, err := s.saveFileNode(ctx, libraryID, filePath, total, fileHash, hashes, sizes)
+	if err != nil {
+		s.discardBlocks(ctx, hashes)
+		return nil, err
+	}
+	return file, nil
+}
+
+// RemoveFile 删除库中指定路径的文件并释放其块，文件不存在时返回 false
+func (s *FileService) RemoveFile(ctx context.Context, libraryID uint, filePath string) (bool, error) {
+	lock := s.locks.Get(libraryID)
+	lock.Lock()
+	defer lock.Unlock()
+	if err := checkWritable(ctx, s.replication, libraryID); err != nil {
+		return false, err
+	}
+
+	file, err := s.GetFileByPath(ctx, libraryID, filePath)
+	if err != nil {
+		return false, fmt.Errorf("failed to look up %s: %w", filePath, err)
+	}
+	if file == nil {
+		return false, nil
+	}
+
+	blocks, err := fileBlockHashes(file)
+	if err != nil {
+		fmt.Printf("Warning: failed to read block list of %s: %v\n", file.Name, err)
+	}
+	if err := s.fileRepo.DeleteFile(ctx, file.ID); err != nil {
+		return false, fmt.Errorf("failed to delete file record: %w", err)
+	}
+	s.releaseBlocks(ctx, blocks)
+	s.events.Publish(Event{LibraryID: libraryID, Type: EventFileDeleted, Path: file.Name, Hash: file.Hash, Size: file.Size})
+
+	// 登记自动提交（由调度器合并执行）
+	s.commitScheduler.Notify(libraryID, "")
+	return true, nil
+}
+
+// MoveFile 在库内移动或重命名文件，内容和块引用保持不变；目标路径已有文件时被覆盖
+// 源文件不存在时返回 nil
+func (s *FileService) MoveFile(ctx context.Context, libraryID uint, oldPath, newPath string) (*model.File, error) {
+	oldPath, newPath = cleanPath(oldPath), cleanPath(newPath)
+	if oldPath == "" || newPath == "" {
+		return nil, ErrInvalidPath
+	}
+	lock := s.locks.Get(libraryID)
+	lock.Lock()
+	defer lock.Unlock()
+	if err := checkWritable(ctx, s.replication, libraryID); err != nil {
+		return nil, err
+	}
+
+	file, err := s.GetFileByPath(ctx, libraryID, oldPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up %s: %w", oldPath, err)
+	}
+	if file == nil || oldPath == newPath {
+		return file, nil
+	}
+
+	// 旧路径的删除事件在前，与新路径的创建事件合并为 file.moved
+	events := []Event{{LibraryID: libraryID, Type: EventFileDeleted, Path: oldPath, Hash: file.Hash, Size: file.Size}}
+	target, err := s.GetFileByPath(ctx, libraryID, newPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up %s: %w", newPath, err)
+	}
+	if target != nil {
+		blocks, err := fileBlockHashes(target)
+		if err != nil {
+			fmt.Printf("Warning: failed to read block list of %s: %v\n", target.Name, err)
+		}
+		if err := s.fileRepo.DeleteFile(ctx, target.ID); err != nil {
+			return nil, fmt.Errorf("failed to delete file record: %w", err)
+		}
+		s.releaseBlocks(ctx, blocks)
+		events = append(events, Event{LibraryID: libraryID, Type: EventFileDeleted, Path: target.Name, Hash: target.Hash, Size: target.Size})
+	}
+
+	file.Name = newPath
+	if err := s.fileRepo.UpdateFile(ctx, file); err != nil {
+		return nil, fmt.Errorf("failed to update file record: %w", err)
+	}
+	events = append(events, Event{LibraryID: libraryID, Type: EventFileCreated, Path: newPath, Hash: file.Hash, Size: file.Size})
+	s.events.Publish(fileEvents(events)...)
+
+	// 登记自动提交（由调度器合并执行）
+	s.commitScheduler.Notify(libraryID, "")
+	return file, nil
+}
+
+// storeContent 把 r 的全部内容按分块器的块大小切分后存入块存储，返回块哈希列表、各块大小和总长度
+// 读取失败时把已存入的块交给 discardBlocks
+func (s *FileService) storeContent(ctx context.Context, r io.Reader) ([]string, map[string]int64, int64, error) {
+	blockSize := s.chunker.ChunkSize()
+	var hashes []string
+	sizes := make(map[string]int64)
+	var total int64
+	buf := make([]byte, blockSize)
+	for {
+		n, readErr := io.ReadFull(r, buf)
+		if n > 0 {
+			// 复制一份，块存储可能持有数据，而缓冲区会被下一块覆盖
+			hash, err := s.StoreUploadChunk(ctx, append([]byte(nil), buf[:n]...))
+			if err != nil {
+				s.discardBlocks(ctx, hashes)
+				return nil, nil, 0, err
+			}
+			hashes = append(hashes, hash)
+			sizes[hash] = int64(n)
+			total += int64(n)
+		}
+		if readErr == io.EOF || readErr == io.ErrUnexpectedEOF {
+			return hashes, sizes, total, nil
+		}
+		if readErr != nil {
+			s.discardBlocks(ctx, hashes)
+			return nil, nil, 0, readErr
+		}
+	}
+}
+
+// discardBlocks 把写入失败时已存入但未被引用的块交给垃圾回收器，失败时只记录警告
+// 内容寻址的块可能同时被其他写入方存入、尚未引用，因此在 stagingGrace 内写入的块（通常就是调用方刚存入的块）
+// 不会在此删除，而是留给上传清理任务在超过宽限期后的全量扫描回收
+func (s *FileService) discardBlocks(ctx context.Context, hashes []string) {
+	if _, err := s.collectUploadBlocks(ctx, hashes); err != nil {
+		fmt.Printf("Warning: failed to collect unreferenced blocks: %v\n", err)
+	}
+}
@@ -0,0 +1,28 @@
+package service
+
+import "sync"
+
+// LibraryLocks 按库划分的写锁
+// 所有修改库当前文件的写入方（上传、tus、WebDAV、S3、归档导入、同步推送、回滚、复制）共用同一组锁，
+// 保证同一库的写入串行执行，读取-比较-写入之间不会被其他写入插入
+type LibraryLocks struct {
+	mu    sync.Mutex
+	locks map[uint]*sync.Mutex
+}
+
+// NewLibraryLocks 创建新的LibraryLocks实例
+func NewLibraryLocks() *LibraryLocks {
+	return &LibraryLocks{locks: make(map[uint]*sync.Mutex)}
+}
+
+// Get 返回库的写锁
+func (l *LibraryLocks) Get(libraryID uint) *sync.Mutex {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	lock, ok := l.locks[libraryID]
+	if !ok {
+		lock = &sync.Mutex{}
+		l.locks[libraryID] = lock
+	}
+	return lock
+}
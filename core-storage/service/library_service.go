@@ -0,0 +1,442 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/sealock/core-storage/model"
+	"github.com/sealock/core-storage/storage"
+)
+
+// maxLibraryNameLength 库名称的最大长度（字符）
+const maxLibraryNameLength = 255
+
+var (
+	// ErrInvalidLibrary 库名称为空、过长或包含路径分隔符
+	ErrInvalidLibrary = errors.New("invalid library")
+	// ErrLibraryNameConflict 同一用户已有同名的库
+	ErrLibraryNameConflict = errors.New("library name already exists")
+)
+
+// LibraryService 库管理服务
+// 负责库的创建、重命名、删除以及版本列表，并维护库的统计信息（总大小、文件数、版本数）：
+// 每次自动提交后通过 RecordCommit 记录版本并刷新统计，其他途径创建快照后通过 RefreshStats 刷新；
+// 读取库详情和版本列表只返回保存的值
+type LibraryService struct {
+	libraryRepo  storage.LibraryRepository
+	versionRepo  storage.LibraryVersionRepository
+	fileRepo     storage.FileRepository
+	snapshotRepo storage.SnapshotRepository
+	blockRepo    storage.BlockRepository
+	gc           *GarbageCollector
+	tx           storage.Transactor
+	libraryLocks *LibraryLocks    // 与其他写入方共用的库写锁，删除库时持有
+	scheduler    *CommitScheduler // 删除库时取消其待执行的自动提交，可以为 nil
+
+	locks sync.Map // 库ID → *sync.Mutex，串行化同一库的版本记录和统计刷新
+}
+
+// NewLibraryService 创建库管理服务
+// gc 为 nil 时删除库只释放块引用，不立即回收块
+func NewLibraryService(
+	lr storage.LibraryRepository,
+	vr storage.LibraryVersionRepository,
+	fr storage.FileRepository,
+	sr storage.SnapshotRepository,
+	br storage.BlockRepository,
+	gc *GarbageCollector,
+) *LibraryService {
+	return &LibraryService{
+		libraryRepo:  lr,
+		versionRepo:  vr,
+		fileRepo:     fr,
+		snapshotRepo: sr,
+		blockRepo:    br,
+		gc:           gc,
+		libraryLocks: NewLibraryLocks(),
+	}
+}
+
+// SetLibraryLocks 设置与其他写入方共用的库写锁（见 FileService.LibraryLocks），默认使用自己的锁
+func (s *LibraryService) SetLibraryLocks(locks *LibraryLocks) {
+	s.libraryLocks = locks
+}
+
+// SetCommitScheduler 设置自动提交调度器，删除库时丢弃库待执行的提交
+func (s *LibraryService) SetCommitScheduler(scheduler *CommitScheduler) {
+	s.scheduler = scheduler
+}
+
+// SetTransactor 设置数据库事务，删除库的所有记录在同一事务中完成；nil 表示不使用事务
+func (s *LibraryService) SetTransactor(tx storage.Transactor) {
+	s.tx = tx
+}
+
+// CreateLibrary 创建库
+// lib 需要填写名称和所有者，描述可选；同一用户的库名称不能重复
+func (s *LibraryService) CreateLibrary(ctx context.Context, lib *model.Library) error {
+	name, err := validateLibraryName(lib.Name)
+	if err != nil {
+		return err
+	}
+	if err := s.checkNameAvailable(ctx, lib.OwnerID, name, 0); err != nil {
+		return err
+	}
+
+	lib.Name = name
+	lib.UUID = uuid.New().String()
+	lib.CurrentVersionID = 0
+	lib.TotalSize = 0
+	lib.FileCount = 0
+	lib.VersionCount = 0
+	return s.libraryRepo.CreateLibrary(ctx, lib)
+}
+
+// GetLibrary 获取库，不存在时返回 nil
+// 统计信息为最近一次提交时的值
+func (s *LibraryService) GetLibrary(ctx context.Context, id uint) (*model.Library, error) {
+	return s.getLibrary(ctx, id)
+}
+
+// ListLibraries 列出用户的所有库
+// 统计信息为最近一次提交时的值
+func (s *LibraryService) ListLibraries(ctx context.Context, ownerID uint) ([]*model.Library, error) {
+	libs, err := s.libraryRepo.ListLibrariesByOwner(ctx, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	if libs == nil {
+		libs = []*model.Library{}
+	}
+	return libs, nil
+}
+
+// UpdateLibrary 重命名库或修改描述，参数为 nil 表示不修改；库不存在时返回 nil
+func (s *LibraryService) UpdateLibrary(ctx context.Context, id uint, name, description *string) (*model.Library, error) {
+	unlock := s.lock(id)
+	defer unlock()
+
+	lib, err := s.getLibrary(ctx, id)
+	if err != nil || lib == nil {
+		return nil, err
+	}
+	if name != nil {
+		newName, err := validateLibraryName(*name)
+		if err != nil {
+			return nil, err
+		}
+		if newName != lib.Name {
+			if err := s.checkNameAvailable(ctx, lib.OwnerID, newName, lib.ID); err != nil {
+				return nil, err
+			}
+		}
+		lib.Name = newName
+	}
+	if description != nil {
+		lib.Description = *description
+	}
+	if err := s.libraryRepo.UpdateLibrary(ctx, lib); err != nil {
+		return nil, err
+	}
+	return lib, nil
+}
+
+// DeleteLibrary 删除库及其全部内容
+// 在一个事务中删除库中的文件和快照并释放它们持有的块引用，删除版本记录后删除库本身，
+// 任何一步失败时整体回滚；事务提交后，配置了垃圾回收器时立即回收不再被引用的块
+func (s *LibraryService) DeleteLibrary(ctx context.Context, id uint) error {
+	// 持有库的写锁，删除过程中上传、同步和复制不会向库写入；
+	// 然后取消库待执行的自动提交并等待进行中的提交结束，避免为已删除的库生成快照
+	writeLock := s.libraryLocks.Get(id)
+	writeLock.Lock()
+	defer writeLock.Unlock()
+	if s.scheduler != nil {
+		s.scheduler.Cancel(id)
+	}
+
+	unlock := s.lock(id)
+	defer unlock()
+
+	var released []string
+	err := inTransaction(ctx, s.tx, func(ctx context.Context) error {
+		released = nil
+		files, err := s.fileRepo.ListFilesByLibrary(ctx, id)
+		if err != nil {
+			return fmt.Errorf("failed to list files: %w", err)
+		}
+		for i := range files {
+			blockHashes, err := fileBlockHashes(&files[i])
+			if err != nil {
+				return err
+			}
+			for _, blockHash := range blockHashes {
+				if err := s.blockRepo.DecrementBlockRefCount(ctx, blockHash); err != nil {
+					return fmt.Errorf("failed to release block %s: %w", blockHash, err)
+				}
+				released = append(released, blockHash)
+			}
+			if err := s.fileRepo.DeleteFile(ctx, files[i].ID); err != nil {
+				return fmt.Errorf("failed to delete file record: %w", err)
+			}
+		}
+
+		snapshots, err := s.snapshotRepo.ListSnapshotsByLibrary(ctx, id)
+		if err != nil {
+			return fmt.Errorf("failed to list snapshots: %w", err)
+		}
+		for _, snapshot := range snapshots {
+			hashes, err := releaseSnapshot(ctx, s.tx, s.snapshotRepo, s.blockRepo, snapshot.ID)
+			if err != nil {
+				return err
+			}
+			released = append(released, hashes...)
+		}
+
+		if err := s.versionRepo.DeleteVersionsByLibrary(ctx, id); err != nil {
+			return err
+		}
+		return s.libraryRepo.DeleteLibrary(ctx, id)
+	})
+	if err != nil {
+		return err
+	}
+
+	if s.gc != nil && len(released) > 0 {
+		if _, err := s.gc.Collect(ctx, released); err != nil {
+			log.Printf("library %d: failed to collect blocks: %v", id, err)
+		}
+	}
+	return nil
+}
+
+// ListVersions 列出库的版本，按创建时间倒序；库不存在时返回 nil
+func (s *LibraryService) ListVersions(ctx context.Context, id uint) ([]*model.LibraryVersion, error) {
+	lib, err := s.getLibrary(ctx, id)
+	if err != nil || lib == nil {
+		return nil, err
+	}
+	versions, err := s.versionRepo.ListVersionsByLibrary(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if versions == nil {
+		versions = []*model.LibraryVersion{}
+	}
+	return versions, nil
+}
+
+// RemoveVersions 删除已被清理的快照对应的版本并刷新库的统计信息，库不存在时忽略
+// 用作 RetentionService.OnPrune 回调，commitIDs 为被删除的快照 UUID
+func (s *LibraryService) RemoveVersions(ctx context.Context, libraryID uint, commitIDs []string) error {
+	unlock := s.lock(libraryID)
+	defer unlock()
+
+	lib, err := s.getLibrary(ctx, libraryID)
+	if err != nil || lib == nil {
+		return err
+	}
+	for _, commitID := range commitIDs {
+		if err := s.versionRepo.DeleteVersion(ctx, libraryID, commitID); err != nil {
+			return err
+		}
+	}
+	return s.refreshStats(ctx, lib)
+}
+
+// RecordCommit 为一次提交记录库版本并刷新库的统计信息
+// 用作 CommitScheduler.OnCommit 回调；库不存在（如未通过本服务创建）时忽略
+func (s *LibraryService) RecordCommit(ctx context.Context, commit *model.Commit) error {
+	unlock := s.lock(commit.RepoID)
+	defer unlock()
+
+	lib, err := s.getLibrary(ctx, commit.RepoID)
+	if err != nil || lib == nil {
+		return err
+	}
+
+	// 其他途径创建快照后刷新统计时可能已经补记过这次提交
+	versions, err := s.versionRepo.ListVersionsByLibrary(ctx, commit.RepoID)
+	if err != nil {
+		return err
+	}
+	recorded := false
+	for _, version := range versions {
+		recorded = recorded || version.CommitID == commit.CommitHash
+	}
+	if !recorded {
+		var parents []string
+		if commit.ParentCommitHash != nil {
+			parents = append(parents, *commit.ParentCommitHash)
+		}
+		version, err := newLibraryVersion(commit.RepoID, commit.CommitHash, commit.RootTreeHash, commit.Message, commit.Author, parents)
+		if err != nil {
+			return err
+		}
+		version.CreatedAt = commit.CreatedAt
+		if err := s.versionRepo.CreateVersion(ctx, version); err != nil {
+			return err
+		}
+	}
+	return s.refreshStats(ctx, lib)
+}
+
+// RefreshStats 重新计算库的统计信息并保存，不存在时返回 nil
+// 用作 CommitScheduler.OnSnapshot 回调：由其他途径生成的快照（手动快照、快照包导入、复制）在这里补记为版本
+func (s *LibraryService) RefreshStats(ctx context.Context, id uint) (*model.Library, error) {
+	unlock := s.lock(id)
+	defer unlock()
+
+	lib, err := s.getLibrary(ctx, id)
+	if err != nil || lib == nil {
+		return nil, err
+	}
+	if err := s.refreshStats(ctx, lib); err != nil {
+		return nil, err
+	}
+	return lib, nil
+}
+
+// refreshStats 补记缺失的版本，重新计算文件数、总大小、版本数和当前版本（调用方需持有库锁）
+func (s *LibraryService) refreshStats(ctx context.Context, lib *model.Library) error {
+	if err := s.recordMissingVersions(ctx, lib.ID); err != nil {
+		return err
+	}
+
+	files, err := s.fileRepo.ListFilesByLibrary(ctx, lib.ID)
+	if err != nil {
+		return fmt.Errorf("failed to list files: %w", err)
+	}
+	versions, err := s.versionRepo.ListVersionsByLibrary(ctx, lib.ID)
+	if err != nil {
+		return err
+	}
+
+	lib.FileCount = len(files)
+	lib.TotalSize = 0
+	for _, file := range files {
+		lib.TotalSize += file.Size
+	}
+	lib.VersionCount = len(versions)
+	lib.CurrentVersionID = 0
+	if len(versions) > 0 {
+		lib.CurrentVersionID = versions[0].ID
+	}
+	return s.libraryRepo.UpdateLibrary(ctx, lib)
+}
+
+// recordMissingVersions 为库中尚未记录为版本的快照创建版本
+func (s *LibraryService) recordMissingVersions(ctx context.Context, libraryID uint) error {
+	snapshots, err := s.snapshotRepo.ListSnapshotsByLibrary(ctx, libraryID)
+	if err != nil {
+		return fmt.Errorf("failed to list snapshots: %w", err)
+	}
+	if len(snapshots) == 0 {
+		return nil
+	}
+	versions, err := s.versionRepo.ListVersionsByLibrary(ctx, libraryID)
+	if err != nil {
+		return err
+	}
+	recorded := make(map[string]bool, len(versions))
+	for _, version := range versions {
+		recorded[version.CommitID] = true
+	}
+	uuids := make(map[uint]string, len(snapshots))
+	for _, snapshot := range snapshots {
+		uuids[snapshot.ID] = snapshot.UUID
+	}
+
+	// 从最早的快照开始补记，使版本的创建顺序与快照一致
+	for i := len(snapshots) - 1; i >= 0; i-- {
+		snapshot := snapshots[i]
+		if recorded[snapshot.UUID] {
+			continue
+		}
+		var parents []string
+		if snapshot.ParentID != nil && uuids[*snapshot.ParentID] != "" {
+			parents = append(parents, uuids[*snapshot.ParentID])
+		}
+		version, err := newLibraryVersion(libraryID, snapshot.UUID, snapshot.RootHash, snapshot.Description, "", parents)
+		if err != nil {
+			return err
+		}
+		version.CreatedAt = snapshot.CreatedAt
+		if err := s.versionRepo.CreateVersion(ctx, version); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getLibrary 读取库，不存在时返回 nil
+func (s *LibraryService) getLibrary(ctx context.Context, id uint) (*model.Library, error) {
+	lib, err := s.libraryRepo.GetLibraryByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, storage.ErrLibraryNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return lib, nil
+}
+
+// checkNameAvailable 检查用户是否已有同名的库，exceptID 为正在重命名的库
+func (s *LibraryService) checkNameAvailable(ctx context.Context, ownerID uint, name string, exceptID uint) error {
+	libs, err := s.libraryRepo.ListLibrariesByOwner(ctx, ownerID)
+	if err != nil {
+		return err
+	}
+	for _, lib := range libs {
+		if lib.ID != exceptID && lib.Name == name {
+			return fmt.Errorf("%w: %q", ErrLibraryNameConflict, name)
+		}
+	}
+	return nil
+}
+
+// lock 获取库的锁，返回解锁函数
+func (s *LibraryService) lock(id uint) func() {
+	lock, _ := s.locks.LoadOrStore(id, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	return lock.(*sync.Mutex).Unlock
+}
+
+// validateLibraryName 去掉首尾空白并检查库名称
+func validateLibraryName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	switch {
+	case name == "":
+		return "", fmt.Errorf("%w: empty name", ErrInvalidLibrary)
+	case utf8.RuneCountInString(name) > maxLibraryNameLength:
+		return "", fmt.Errorf("%w: name longer than %d characters", ErrInvalidLibrary, maxLibraryNameLength)
+	case strings.ContainsAny(name, "/\\"):
+		return "", fmt.Errorf("%w: name contains a path separator", ErrInvalidLibrary)
+	}
+	return name, nil
+}
+
+// newLibraryVersion 创建版本记录，parents 为父提交ID
+func newLibraryVersion(libraryID uint, commitID, rootHash, message, author string, parents []string) (*model.LibraryVersion, error) {
+	if parents == nil {
+		parents = []string{}
+	}
+	parentJSON, err := json.Marshal(parents)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal parent commits: %w", err)
+	}
+	return &model.LibraryVersion{
+		CommitID:      commitID,
+		LibraryID:     libraryID,
+		RootHash:      rootHash,
+		Message:       message,
+		Author:        author,
+		ParentCommits: parentJSON,
+	}, nil
+}
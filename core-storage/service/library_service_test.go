@@ -0,0 +1,141 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sealock/core-storage/model"
+	"github.com/sealock/core-storage/storage"
+)
+
+// stageBlock 把 data 写入块存储并登记 refs 次引用，返回块哈希
+func stageBlock(t *testing.T, store storage.BlockStore, blocks storage.BlockRepository, data string, refs int) string {
+	t.Helper()
+	ctx := context.Background()
+	hash, err := store.Put(ctx, []byte(data))
+	if err != nil {
+		t.Fatalf("put block: %v", err)
+	}
+	if err := blocks.SaveBlockMetadata(ctx, &model.Block{Hash: hash, Size: int64(len(data))}); err != nil {
+		t.Fatalf("save block: %v", err)
+	}
+	if err := blocks.IncrementRefCount(ctx, hash, refs); err != nil {
+		t.Fatalf("retain block: %v", err)
+	}
+	return hash
+}
+
+// blockIDs 返回文件记录中保存的块列表
+func blockIDs(hashes ...string) []byte {
+	data, _ := json.Marshal(hashes)
+	return data
+}
+
+func TestDeleteLibraryCancelsPendingCommit(t *testing.T) {
+	ctx := context.Background()
+	libraries := storage.NewMockLibraryRepository()
+	versions := storage.NewMockLibraryVersionRepository()
+	files := storage.NewMockFileRepository()
+	snapshots := storage.NewMockSnapshotRepository()
+	blocks := storage.NewMockBlockRepository()
+	libraryService := NewLibraryService(libraries, versions, files, snapshots, blocks, nil)
+
+	scheduler := NewCommitScheduler(NewSnapshotService(snapshots, files, blocks), 50*time.Millisecond, time.Minute)
+	t.Cleanup(func() { scheduler.Stop(ctx) })
+	scheduler.OnCommit = func(commit *model.Commit) {
+		if err := libraryService.RecordCommit(ctx, commit); err != nil {
+			t.Errorf("record commit: %v", err)
+		}
+	}
+	libraryService.SetCommitScheduler(scheduler)
+
+	lib := &model.Library{Name: "lib", OwnerID: 1}
+	if err := libraries.CreateLibrary(ctx, lib); err != nil {
+		t.Fatalf("create library: %v", err)
+	}
+	if err := files.CreateFile(ctx, &model.File{Name: "a.txt", Hash: "h1", LibraryID: lib.ID}); err != nil {
+		t.Fatalf("create file: %v", err)
+	}
+	scheduler.Notify(lib.ID, "tester")
+
+	// 删除时丢弃待执行的提交：静默期过后不再为已删除的库生成快照和版本
+	if err := libraryService.DeleteLibrary(ctx, lib.ID); err != nil {
+		t.Fatalf("delete library: %v", err)
+	}
+	time.Sleep(200 * time.Millisecond)
+	scheduler.Flush()
+
+	if list, _ := snapshots.ListSnapshotsByLibrary(ctx, lib.ID); len(list) != 0 {
+		t.Fatalf("deleted library has %d snapshots", len(list))
+	}
+	if list, _ := versions.ListVersionsByLibrary(ctx, lib.ID); len(list) != 0 {
+		t.Fatalf("deleted library has %d versions", len(list))
+	}
+	if got, err := libraries.GetLibraryByID(ctx, lib.ID); !errors.Is(err, storage.ErrLibraryNotFound) {
+		t.Fatalf("deleted library = %+v, %v", got, err)
+	}
+}
+
+func TestDeleteLibraryReleasesBlocks(t *testing.T) {
+	ctx := context.Background()
+	libraries := storage.NewMockLibraryRepository()
+	files := storage.NewMockFileRepository()
+	snapshots := storage.NewMockSnapshotRepository()
+	blocks := storage.NewMockBlockRepository()
+	store := storage.NewLocalBlockStore()
+	gc := NewGarbageCollector(store, blocks)
+	gc.SetGracePeriod(0)
+	libraryService := NewLibraryService(libraries, storage.NewMockLibraryVersionRepository(), files, snapshots, blocks, gc)
+
+	lib := &model.Library{Name: "lib", OwnerID: 1}
+	other := &model.Library{Name: "other", OwnerID: 1}
+	for _, l := range []*model.Library{lib, other} {
+		if err := libraries.CreateLibrary(ctx, l); err != nil {
+			t.Fatalf("create library: %v", err)
+		}
+	}
+
+	// a 被当前文件和快照引用，b 同时被另一个库引用，c 只被快照引用
+	a := stageBlock(t, store, blocks, "aaaa", 2)
+	b := stageBlock(t, store, blocks, "bbbb", 2)
+	c := stageBlock(t, store, blocks, "cccc", 1)
+	for _, file := range []*model.File{
+		{Name: "a.txt", LibraryID: lib.ID, BlockIDs: blockIDs(a, b)},
+		{Name: "b.txt", LibraryID: other.ID, BlockIDs: blockIDs(b)},
+	} {
+		if err := files.CreateFile(ctx, file); err != nil {
+			t.Fatalf("create file: %v", err)
+		}
+	}
+	snapshot := &model.Snapshot{UUID: "snapshot-1", LibraryID: lib.ID, CreatedAt: time.Now()}
+	if err := snapshots.CreateSnapshot(ctx, snapshot); err != nil {
+		t.Fatalf("create snapshot: %v", err)
+	}
+	if err := snapshots.CreateSnapshotFile(ctx, &model.SnapshotFile{SnapshotID: snapshot.ID, FileName: "a.txt", BlockIDs: blockIDs(a, c)}); err != nil {
+		t.Fatalf("create snapshot file: %v", err)
+	}
+
+	if err := libraryService.DeleteLibrary(ctx, lib.ID); err != nil {
+		t.Fatalf("delete library: %v", err)
+	}
+	for _, hash := range []string{a, c} {
+		if ok, _ := store.Exists(ctx, hash); ok {
+			t.Fatalf("block %s of the deleted library was not collected", hash)
+		}
+	}
+	if block, _ := blocks.GetBlockMetadata(ctx, b); block == nil || block.RefCount != 1 {
+		t.Fatalf("shared block = %+v, want one reference left", block)
+	}
+	if ok, _ := store.Exists(ctx, b); !ok {
+		t.Fatal("block still used by another library was collected")
+	}
+	if remaining, _ := files.ListFilesByLibrary(ctx, lib.ID); len(remaining) != 0 {
+		t.Fatalf("deleted library has %d files", len(remaining))
+	}
+	if list, _ := snapshots.ListSnapshotsByLibrary(ctx, lib.ID); len(list) != 0 {
+		t.Fatalf("deleted library has %d snapshots", len(list))
+	}
+}
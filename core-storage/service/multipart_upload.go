@@ -0,0 +1,346 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"github.com/sealock/core-storage/chunker"
+	"github.com/sealock/core-storage/model"
+)
+
+// MaxMultipartParts 分段上传允许的最大段号（与 S3 一致）
+const MaxMultipartParts = 10000
+
+var (
+	// ErrNoSuchUpload 分段上传不存在、已完成、已终止或已过期
+	ErrNoSuchUpload = errors.New("no such multipart upload")
+	// ErrInvalidPart 段号超出范围，或完成上传时指定的段不存在、ETag 不一致
+	ErrInvalidPart = errors.New("invalid multipart part")
+	// ErrInvalidPartOrder 完成上传时段号不是严格递增
+	ErrInvalidPartOrder = errors.New("multipart parts not in ascending order")
+	// ErrPartDigestMismatch 段内容的 MD5 与请求声明的 Content-MD5 不一致
+	ErrPartDigestMismatch = errors.New("part content MD5 mismatch")
+)
+
+// MultipartUpload 一个 S3 风格的分段上传
+// 各段可以并发、乱序、重复上传，每段的内容按块存储的固定块大小切分后直接写入块存储；
+// 完成时按指定的段依次拼接块列表创建文件，块与其他上传方式一样去重。
+// 段的长度是块大小的整数倍时（客户端的默认段长通常如此），切分结果与整体上传完全相同
+type MultipartUpload struct {
+	ID        string    `json:"id"`
+	LibraryID uint      `json:"libraryId"` // 目标库
+	FileName  string    `json:"fileName"`  // 库内目标路径
+	OwnerID   uint      `json:"ownerId"`   // 发起上传的用户，0 表示未认证
+	CreatedAt time.Time `json:"createdAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// MultipartPart 分段上传中已接收的一段
+type MultipartPart struct {
+	Number      int       `json:"number"`
+	ETag        string    `json:"etag"` // 段内容的 MD5（十六进制），客户端完成上传时回传
+	Size        int64     `json:"size"`
+	BlockHashes []string  `json:"blockHashes"`
+	Reserved    int64     `json:"reserved"` // 为本段预留的配额（字节），上传完成或终止时释放
+	UploadedAt  time.Time `json:"uploadedAt"`
+}
+
+// CompletedPart 完成上传时客户端指定的一段
+type CompletedPart struct {
+	Number int
+	ETag   string
+}
+
+// CreateMultipartUpload 创建分段上传
+// 总长度要到完成时才知道，配额在每段上传时按段的长度预留
+func (s *FileService) CreateMultipartUpload(ctx context.Context, libraryID, ownerID uint, fileName string) (*MultipartUpload, error) {
+	fileName = cleanPath(fileName)
+	if fileName == "" {
+		return nil, ErrInvalidPath
+	}
+	if err := checkWritable(ctx, s.replication, libraryID); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	upload := &MultipartUpload{
+		ID:        uuid.New().String(),
+		LibraryID: libraryID,
+		FileName:  fileName,
+		OwnerID:   ownerID,
+		CreatedAt: now,
+		ExpiresAt: now.Add(DefaultUploadSessionTTL),
+	}
+	data, err := json.Marshal(upload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal multipart upload: %w", err)
+	}
+	if err := s.redisClient.Set(ctx, multipartUploadKey(upload.ID), data, time.Until(upload.ExpiresAt.Add(uploadKeyGrace))).Err(); err != nil {
+		return nil, fmt.Errorf("failed to save multipart upload: %w", err)
+	}
+	if err := s.indexUpload(ctx, "multipart:"+upload.ID, upload.ExpiresAt); err != nil {
+		return nil, err
+	}
+	return upload, nil
+}
+
+// GetMultipartUpload 读取分段上传，不存在或已过期时返回 nil
+func (s *FileService) GetMultipartUpload(ctx context.Context, id string) (*MultipartUpload, error) {
+	upload, err := s.loadMultipartUpload(ctx, id)
+	if err != nil || upload == nil || time.Now().After(upload.ExpiresAt) {
+		return nil, err
+	}
+	return upload, nil
+}
+
+// loadMultipartUpload 读取分段上传，包括已过期但尚未被清理的上传
+func (s *FileService) loadMultipartUpload(ctx context.Context, id string) (*MultipartUpload, error) {
+	data, err := s.redisClient.Get(ctx, multipartUploadKey(id)).Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var upload MultipartUpload
+	if err := json.Unmarshal(data, &upload); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal multipart upload: %w", err)
+	}
+	return &upload, nil
+}
+
+// UploadPart 从 r 读取一段内容写入块存储并记录到分段上传，同一段号重复上传时替换之前的内容
+// size 为声明的长度（未知时传 -1），已知时实际读取的长度必须与之一致；
+// contentMD5 不为 nil 时段内容的 MD5 必须与之一致，否则返回 ErrPartDigestMismatch 且不保存本段
+func (s *FileService) UploadPart(ctx context.Context, upload *MultipartUpload, number int, r io.Reader, size int64, contentMD5 []byte) (*MultipartPart, error) {
+	if number < 1 || number > MaxMultipartParts {
+		return nil, fmt.Errorf("%w: part number %d out of range [1, %d]", ErrInvalidPart, number, MaxMultipartParts)
+	}
+	reserved, err := s.reserveQuota(ctx, upload.OwnerID, size)
+	if err != nil {
+		return nil, err
+	}
+	saved := false
+	defer func() {
+		if !saved {
+			s.releaseQuota(ctx, upload.OwnerID, reserved)
+		}
+	}()
+
+	digest := md5.New()
+	hashes, _, total, err := s.storeContent(ctx, io.TeeReader(r, digest))
+	if err != nil {
+		return nil, fmt.Errorf("failed to store part %d: %w", number, err)
+	}
+	if size >= 0 && total != size {
+		s.discardBlocks(ctx, hashes)
+		return nil, fmt.Errorf("%w: read %d bytes, expected %d", ErrUploadSizeMismatch, total, size)
+	}
+	sum := digest.Sum(nil)
+	if contentMD5 != nil && !bytes.Equal(sum, contentMD5) {
+		s.discardBlocks(ctx, hashes)
+		return nil, ErrPartDigestMismatch
+	}
+	if size < 0 {
+		if reserved, err = s.reserveQuota(ctx, upload.OwnerID, total); err != nil {
+			s.discardBlocks(ctx, hashes)
+			return nil, err
+		}
+	}
+
+	part := &MultipartPart{
+		Number:      number,
+		ETag:        hex.EncodeToString(sum),
+		Size:        total,
+		BlockHashes: hashes,
+		Reserved:    reserved,
+		UploadedAt:  time.Now(),
+	}
+	if part.BlockHashes == nil {
+		part.BlockHashes = []string{}
+	}
+	data, err := json.Marshal(part)
+	if err != nil {
+		s.discardBlocks(ctx, hashes)
+		return nil, fmt.Errorf("failed to marshal part: %w", err)
+	}
+
+	parts, err := s.multipartParts(ctx, upload.ID)
+	if err != nil {
+		s.discardBlocks(ctx, hashes)
+		return nil, err
+	}
+	key := multipartPartsKey(upload.ID)
+	if err := s.redisClient.HSet(ctx, key, strconv.Itoa(number), data).Err(); err != nil {
+		s.discardBlocks(ctx, hashes)
+		return nil, fmt.Errorf("failed to save part: %w", err)
+	}
+	saved = true
+	if err := s.redisClient.ExpireAt(ctx, key, upload.ExpiresAt.Add(uploadKeyGrace)).Err(); err != nil {
+		fmt.Printf("Warning: failed to set expiry of multipart upload %s: %v\n", upload.ID, err)
+	}
+
+	// 被替换的段：释放其配额预留，并把不再被任何上传使用的块交给垃圾回收器
+	for _, old := range parts {
+		if old.Number == number {
+			s.releaseQuota(ctx, upload.OwnerID, old.Reserved)
+			s.discardBlocks(ctx, old.BlockHashes)
+		}
+	}
+	return part, nil
+}
+
+// ListParts 列出分段上传已接收的段，按段号升序
+func (s *FileService) ListParts(ctx context.Context, id string) ([]MultipartPart, error) {
+	return s.multipartParts(ctx, id)
+}
+
+// CompleteMultipartUpload 按 parts 指定的段依次拼接内容创建文件，已有文件时覆盖
+// parts 的段号必须严格递增，且每段都已上传、ETag 一致；未被使用的段的块交给垃圾回收器，超过宽限期后回收
+func (s *FileService) CompleteMultipartUpload(ctx context.Context, upload *MultipartUpload, parts []CompletedPart) (*model.File, error) {
+	if len(parts) == 0 {
+		return nil, fmt.Errorf("%w: no parts specified", ErrInvalidPart)
+	}
+	received, err := s.multipartParts(ctx, upload.ID)
+	if err != nil {
+		return nil, err
+	}
+	byNumber := make(map[int]*MultipartPart, len(received))
+	for i := range received {
+		byNumber[received[i].Number] = &received[i]
+	}
+
+	blockSize := s.chunker.ChunkSize()
+	var hashes []string
+	var total int64
+	sizes := make(map[string]int64)
+	used := make(map[int]bool, len(parts))
+	for i, p := range parts {
+		if i > 0 && p.Number <= parts[i-1].Number {
+			return nil, ErrInvalidPartOrder
+		}
+		part := byNumber[p.Number]
+		if part == nil || (p.ETag != "" && p.ETag != part.ETag) {
+			return nil, fmt.Errorf("%w: part %d", ErrInvalidPart, p.Number)
+		}
+		used[p.Number] = true
+		// 段内除最后一块外都是完整的块
+		for j, hash := range part.BlockHashes {
+			size := int64(blockSize)
+			if j == len(part.BlockHashes)-1 {
+				size = part.Size - int64(blockSize)*int64(j)
+			}
+			sizes[hash] = size
+		}
+		hashes = append(hashes, part.BlockHashes...)
+		total += part.Size
+	}
+	fileHash, err := chunker.ComputeFileMerkleHash(hashes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute file hash: %w", err)
+	}
+
+	// 从过期索引中移除成功的一方负责完成上传，避免与终止、清理任务或重复的完成请求冲突
+	claimed, err := s.unindexUpload(ctx, "multipart:"+upload.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !claimed {
+		return nil, ErrNoSuchUpload
+	}
+	defer s.dropMultipartUpload(ctx, upload, received)
+
+	file, err := s.saveFileNode(ctx, upload.LibraryID, upload.FileName, total, fileHash, hashes, sizes)
+	if err != nil {
+		s.discardBlocks(ctx, hashes)
+		return nil, err
+	}
+
+	var unused []string
+	for _, part := range received {
+		if !used[part.Number] {
+			unused = append(unused, part.BlockHashes...)
+		}
+	}
+	s.discardBlocks(ctx, unused)
+	return file, nil
+}
+
+// AbortMultipartUpload 终止分段上传，释放配额预留并回收只被它引用的块
+// 宽限期内写入的块不立即删除，由上传清理任务的全量扫描回收
+func (s *FileService) AbortMultipartUpload(ctx context.Context, id string) error {
+	upload, err := s.loadMultipartUpload(ctx, id)
+	if err != nil {
+		return err
+	}
+	claimed, err := s.unindexUpload(ctx, "multipart:"+id)
+	if err != nil {
+		return err
+	}
+	if !claimed || upload == nil {
+		return ErrNoSuchUpload
+	}
+	parts, err := s.multipartParts(ctx, id)
+	if err != nil {
+		return err
+	}
+	s.dropMultipartUpload(ctx, upload, parts)
+
+	var hashes []string
+	for _, part := range parts {
+		hashes = append(hashes, part.BlockHashes...)
+	}
+	if _, err := s.collectUploadBlocks(ctx, hashes); err != nil {
+		fmt.Printf("Warning: failed to collect blocks of multipart upload %s: %v\n", id, err)
+	}
+	return nil
+}
+
+// dropMultipartUpload 释放各段的配额预留并删除分段上传的状态
+func (s *FileService) dropMultipartUpload(ctx context.Context, upload *MultipartUpload, parts []MultipartPart) {
+	for _, part := range parts {
+		s.releaseQuota(ctx, upload.OwnerID, part.Reserved)
+	}
+	if err := s.redisClient.Del(ctx, multipartUploadKey(upload.ID), multipartPartsKey(upload.ID)).Err(); err != nil {
+		fmt.Printf("Warning: failed to clean up multipart upload %s: %v\n", upload.ID, err)
+	}
+}
+
+// multipartParts 读取分段上传已接收的段，按段号升序
+func (s *FileService) multipartParts(ctx context.Context, id string) ([]MultipartPart, error) {
+	fields, err := s.redisClient.HGetAll(ctx, multipartPartsKey(id)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load multipart parts: %w", err)
+	}
+	parts := make([]MultipartPart, 0, len(fields))
+	for _, data := range fields {
+		var part MultipartPart
+		if err := json.Unmarshal([]byte(data), &part); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal multipart part: %w", err)
+		}
+		parts = append(parts, part)
+	}
+	sort.Slice(parts, func(i, j int) bool { return parts[i].Number < parts[j].Number })
+	return parts, nil
+}
+
+// multipartUploadKey 分段上传状态在 Redis 中的键
+func multipartUploadKey(id string) string {
+	return fmt.Sprintf("multipart:%s", id)
+}
+
+// multipartPartsKey 分段上传已接收的段在 Redis 中的键（哈希表，字段为段号）
+func multipartPartsKey(id string) string {
+	return fmt.Sprintf("multipart:%s:parts", id)
+}
@@ -0,0 +1,166 @@
+package service
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+var (
+	// ErrReadOnlyReplica 库是只读副本，只接受来自主服务器的复制
+	ErrReadOnlyReplica = errors.New("library is a read-only replica")
+	// ErrPrimaryNotAllowed 主服务器不在允许连接的列表中
+	ErrPrimaryNotAllowed = errors.New("primary host is not allowed")
+)
+
+// sealedTokenPrefix 加密保存的凭据（主服务器令牌、S3 secret key）的前缀，没有前缀的是明文
+const sealedTokenPrefix = "enc:v1:"
+
+// maxPrimaryRedirects 访问主服务器时跟随的重定向次数上限
+const maxPrimaryRedirects = 5
+
+// SetAllowedPrimaries 设置副本可以连接的主服务器，每项为 host 或 host:port（不区分大小写）
+// 列表为空时不能配置副本，已配置的副本也不再拉取：复制配置由用户提交，
+// 不加限制时可以让服务器向任意内网地址发送请求
+func (s *ReplicationService) SetAllowedPrimaries(hosts []string) {
+	s.allowedPrimaries = make(map[string]bool, len(hosts))
+	for _, host := range hosts {
+		if host = strings.ToLower(strings.TrimSpace(host)); host != "" {
+			s.allowedPrimaries[host] = true
+		}
+	}
+}
+
+// SetOperators 限制可以配置、删除、提升副本和触发复制的用户，为空时库的所有者均可操作
+func (s *ReplicationService) SetOperators(userIDs []uint) {
+	s.operators = make(map[uint]bool, len(userIDs))
+	for _, id := range userIDs {
+		s.operators[id] = true
+	}
+}
+
+// CanOperate 用户能否修改复制配置
+func (s *ReplicationService) CanOperate(userID uint) bool {
+	if userID == 0 {
+		return false
+	}
+	return len(s.operators) == 0 || s.operators[userID]
+}
+
+// SetTokenKey 设置加密保存主服务器令牌的密钥，经 SHA-256 派生为 AES-256 密钥
+// 未设置时令牌以明文保存；更换密钥后已保存的令牌无法解密，需要重新配置副本
+func (s *ReplicationService) SetTokenKey(key []byte) {
+	s.tokenKey = deriveSecretKey(key)
+}
+
+// checkPrimary 检查主服务器地址是否在允许连接的列表中
+func (s *ReplicationService) checkPrimary(target *url.URL) error {
+	host := strings.ToLower(target.Host)
+	if s.allowedPrimaries[host] || s.allowedPrimaries[strings.ToLower(target.Hostname())] {
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrPrimaryNotAllowed, target.Host)
+}
+
+// checkRedirect 只跟随指向允许的主服务器的重定向
+func (s *ReplicationService) checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxPrimaryRedirects {
+		return fmt.Errorf("stopped after %d redirects", len(via))
+	}
+	return s.checkPrimary(req.URL)
+}
+
+// sealToken 加密令牌用于保存
+func (s *ReplicationService) sealToken(token string) (string, error) {
+	return sealSecret(s.tokenKey, token)
+}
+
+// openToken 解密保存的令牌，明文令牌原样返回
+func (s *ReplicationService) openToken(stored string) (string, error) {
+	return openSecret(s.tokenKey, stored)
+}
+
+// deriveSecretKey 把配置的密钥经 SHA-256 派生为 AES-256 密钥，为空时返回 nil
+func deriveSecretKey(key []byte) []byte {
+	if len(key) == 0 {
+		return nil
+	}
+	sum := sha256.Sum256(key)
+	return sum[:]
+}
+
+// sealSecret 用 AES-GCM 加密需要保存的凭据，key 为 nil 时原样返回
+func sealSecret(key []byte, secret string) (string, error) {
+	if secret == "" || key == nil {
+		return secret, nil
+	}
+	gcm, err := secretCipher(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(secret), nil)
+	return sealedTokenPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// openSecret 解密 sealSecret 保存的凭据，没有加密前缀的原样返回
+func openSecret(key []byte, stored string) (string, error) {
+	if !strings.HasPrefix(stored, sealedTokenPrefix) {
+		return stored, nil
+	}
+	if key == nil {
+		return "", errors.New("secret is encrypted but no key is configured")
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(stored, sealedTokenPrefix))
+	if err != nil {
+		return "", fmt.Errorf("invalid sealed secret: %w", err)
+	}
+	gcm, err := secretCipher(key)
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return "", errors.New("invalid sealed secret")
+	}
+	secret, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt secret: %w", err)
+	}
+	return string(secret), nil
+}
+
+// secretCipher 返回加密凭据使用的 AES-GCM
+func secretCipher(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create secret cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// checkWritable 库是只读副本时返回 ErrReadOnlyReplica，replication 为 nil 时不限制
+// 文件上传、同步推送、回滚、快照包导入等写入路径在修改库之前调用；复制本身不经过这些路径
+func checkWritable(ctx context.Context, replication *ReplicationService, libraryID uint) error {
+	if replication == nil {
+		return nil
+	}
+	readOnly, err := replication.IsReadOnly(ctx, libraryID)
+	if err != nil {
+		return err
+	}
+	if readOnly {
+		return fmt.Errorf("%w: %d", ErrReadOnlyReplica, libraryID)
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/sealock/core-storage/model"
+	"github.com/sealock/core-storage/storage"
+)
+
+func TestReplicationTokenSealing(t *testing.T) {
+	s := &ReplicationService{}
+	s.SetTokenKey([]byte("secret"))
+
+	sealed, err := s.sealToken("primary-token")
+	if err != nil {
+		t.Fatalf("seal: %v", err)
+	}
+	if !strings.HasPrefix(sealed, sealedTokenPrefix) || strings.Contains(sealed, "primary-token") {
+		t.Fatalf("token is not sealed: %q", sealed)
+	}
+	token, err := s.openToken(sealed)
+	if err != nil || token != "primary-token" {
+		t.Fatalf("open = %q, %v", token, err)
+	}
+
+	// 更换密钥后无法解密
+	other := &ReplicationService{}
+	other.SetTokenKey([]byte("another secret"))
+	if _, err := other.openToken(sealed); err == nil {
+		t.Fatal("expected decryption with another key to fail")
+	}
+
+	// 升级前保存的明文令牌原样返回
+	if token, err := s.openToken("plain"); err != nil || token != "plain" {
+		t.Fatalf("open plain = %q, %v", token, err)
+	}
+}
+
+func TestCheckPrimary(t *testing.T) {
+	s := &ReplicationService{}
+	s.SetAllowedPrimaries([]string{"Primary.example.com", "backup.example.com:8443"})
+
+	tests := []struct {
+		url     string
+		allowed bool
+	}{
+		{"https://primary.example.com", true},
+		{"https://primary.example.com:9000", true},
+		{"https://backup.example.com:8443", true},
+		{"https://backup.example.com", false},
+		{"http://169.254.169.254", false},
+		{"http://localhost:8080", false},
+	}
+	for _, tt := range tests {
+		target, err := url.Parse(tt.url)
+		if err != nil {
+			t.Fatalf("parse %s: %v", tt.url, err)
+		}
+		err = s.checkPrimary(target)
+		if tt.allowed && err != nil {
+			t.Errorf("%s: unexpected error %v", tt.url, err)
+		}
+		if !tt.allowed && !errors.Is(err, ErrPrimaryNotAllowed) {
+			t.Errorf("%s: error = %v, want ErrPrimaryNotAllowed", tt.url, err)
+		}
+	}
+
+	// 未配置允许的主服务器时全部拒绝
+	if err := (&ReplicationService{}).checkPrimary(&url.URL{Host: "primary.example.com"}); !errors.Is(err, ErrPrimaryNotAllowed) {
+		t.Errorf("empty allow list: error = %v", err)
+	}
+}
+
+func TestReplicationBlockScopedToLibrary(t *testing.T) {
+	ctx := context.Background()
+	files := storage.NewMockFileRepository()
+	snapshots := storage.NewMockSnapshotRepository()
+	blockStore := storage.NewLocalBlockStore()
+	blockRepo := storage.NewMockBlockRepository()
+	syncService := NewSyncService(files, blockStore, blockRepo, storage.NewMockConflictRepository(), nil)
+	s := NewReplicationService(snapshots, blockRepo, blockStore, nil, syncService)
+
+	current, _ := blockStore.Put(ctx, []byte("current"))
+	old, _ := blockStore.Put(ctx, []byte("old"))
+	currentIDs, _ := json.Marshal([]string{current})
+	oldIDs, _ := json.Marshal([]string{old})
+	if err := files.CreateFile(ctx, &model.File{LibraryID: 1, Name: "a.txt", Hash: current, Size: 7, BlockIDs: currentIDs}); err != nil {
+		t.Fatalf("create file: %v", err)
+	}
+	// 只有快照还引用的旧版本块
+	snapshot := &model.Snapshot{LibraryID: 1}
+	if err := snapshots.CreateSnapshot(ctx, snapshot); err != nil {
+		t.Fatalf("create snapshot: %v", err)
+	}
+	if err := snapshots.CreateSnapshotFile(ctx, &model.SnapshotFile{SnapshotID: snapshot.ID, FileName: "a.txt", BlockIDs: oldIDs}); err != nil {
+		t.Fatalf("create snapshot file: %v", err)
+	}
+
+	for _, hash := range []string{current, old} {
+		if _, err := s.GetBlock(ctx, 1, hash); err != nil {
+			t.Fatalf("get block %s of library 1: %v", hash, err)
+		}
+		if _, err := s.GetBlock(ctx, 2, hash); !errors.Is(err, ErrBlockNotFound) {
+			t.Fatalf("get block %s of library 2: error = %v, want ErrBlockNotFound", hash, err)
+		}
+	}
+}
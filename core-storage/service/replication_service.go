@@ -0,0 +1,671 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sealock/core-storage/model"
+	"github.com/sealock/core-storage/storage"
+)
+
+const (
+	// DefaultReplicationInterval 默认的拉取间隔
+	DefaultReplicationInterval = 30 * time.Second
+	// DefaultReplicationPageSize 每次拉取的提交数
+	DefaultReplicationPageSize = 20
+	// maxReplicationPageSize 单页提交数上限
+	maxReplicationPageSize = 200
+	// replicationRequestTimeout 访问主服务器的单次请求超时
+	replicationRequestTimeout = 2 * time.Minute
+)
+
+var (
+	// ErrReplicationNotFound 库没有配置复制
+	ErrReplicationNotFound = errors.New("replication not configured")
+	// ErrReplicationPromoted 副本已提升为主库，不再跟随主服务器
+	ErrReplicationPromoted = errors.New("replica has been promoted")
+	// ErrReplicationCursorLost 副本的进度提交在主服务器上已不存在（例如被保留策略清理）
+	ErrReplicationCursorLost = errors.New("replication cursor not found on primary")
+	// ErrInvalidPrimaryURL 主服务器地址无效
+	ErrInvalidPrimaryURL = errors.New("invalid primary URL")
+)
+
+// ReplicationFeed 主服务器提交日志中的一页
+type ReplicationFeed struct {
+	LibraryID uint             `json:"libraryId"`
+	Head      string           `json:"head"` // 主服务器最新提交
+	HeadAt    *time.Time       `json:"headAt,omitempty"`
+	Behind    int              `json:"behind"`  // 游标之后的提交总数（含本页）
+	Commits   []BundleSnapshot `json:"commits"` // 按创建时间正序
+	Blocks    []BundleBlock    `json:"blocks"`  // 本页提交引用的所有块
+	More      bool             `json:"more"`    // 本页之后是否还有提交
+}
+
+// ReplicationStatus 副本状态与延迟指标
+type ReplicationStatus struct {
+	LibraryID        uint       `json:"libraryId"`
+	PrimaryURL       string     `json:"primaryUrl"`
+	PrimaryLibraryID uint       `json:"primaryLibraryId"`
+	Role             string     `json:"role"`
+	Running          bool       `json:"running"`
+	LastCommit       string     `json:"lastCommit"`
+	LastCommitAt     *time.Time `json:"lastCommitAt,omitempty"`
+	PrimaryHead      string     `json:"primaryHead"`
+	PrimaryHeadAt    *time.Time `json:"primaryHeadAt,omitempty"`
+	CommitsBehind    int        `json:"commitsBehind"`
+	LagSeconds       float64    `json:"lagSeconds"` // 已落后的提交跨越的时长，追平时为 0
+	CommitsApplied   int64      `json:"commitsApplied"`
+	BlocksFetched    int64      `json:"blocksFetched"`
+	BytesFetched     int64      `json:"bytesFetched"`
+	LastSyncAt       *time.Time `json:"lastSyncAt,omitempty"`
+	LastSuccessAt    *time.Time `json:"lastSuccessAt,omitempty"`
+	LastError        string     `json:"lastError,omitempty"`
+	PromotedAt       *time.Time `json:"promotedAt,omitempty"`
+}
+
+// ReplicationResult 一次复制的结果
+type ReplicationResult struct {
+	LibraryID      uint   `json:"libraryId"`
+	CommitsApplied int    `json:"commitsApplied"`
+	BlocksFetched  int    `json:"blocksFetched"`
+	BytesFetched   int64  `json:"bytesFetched"`
+	CommitsBehind  int    `json:"commitsBehind"`
+	LastCommit     string `json:"lastCommit"`
+}
+
+// ReplicationService 跨服务器的库复制
+// 主服务器端提供按游标分页的提交日志和块下载；副本端按顺序拉取每个提交，
+// 先取回缺失的块并校验，再创建同 UUID 的快照并把库的当前文件更新为该提交的目录树，
+// 最后推进游标。每个提交应用完成后立即保存进度，中断后从最后一个完整提交继续
+type ReplicationService struct {
+	snapshotRepo storage.SnapshotRepository
+	blockStore   storage.BlockStore
+	repo         storage.ReplicationRepository
+	bundles      *BundleService
+	syncService  *SyncService
+	client       *http.Client
+
+	allowedPrimaries map[string]bool // 允许连接的主服务器，见 SetAllowedPrimaries
+	operators        map[uint]bool   // 允许修改复制配置的用户，为空时不限制
+	tokenKey         []byte          // 加密保存主服务器令牌的密钥
+
+	mu       sync.Mutex
+	libLocks map[uint]*sync.Mutex
+	running  map[uint]bool
+}
+
+// NewReplicationService 创建复制服务
+// syncService 用于把复制来的提交写入库的当前文件
+func NewReplicationService(sr storage.SnapshotRepository, br storage.BlockRepository, bs storage.BlockStore, repo storage.ReplicationRepository, syncService *SyncService) *ReplicationService {
+	s := &ReplicationService{
+		snapshotRepo: sr,
+		blockStore:   bs,
+		repo:         repo,
+		bundles:      NewBundleService(sr, br, bs, syncService),
+		syncService:  syncService,
+		libLocks:     make(map[uint]*sync.Mutex),
+		running:      make(map[uint]bool),
+	}
+	s.client = &http.Client{Timeout: replicationRequestTimeout, CheckRedirect: s.checkRedirect}
+	return s
+}
+
+// CommitFeed 返回库在游标之后的提交（主服务器端）
+// after 为副本已应用的最后一个提交 UUID，为空表示从最早的提交开始；
+// after 已被清理时改用 since（该提交的创建时间）定位，两者都无法定位时返回 ErrReplicationCursorLost
+func (s *ReplicationService) CommitFeed(ctx context.Context, libraryID uint, after string, since *time.Time, limit int) (*ReplicationFeed, error) {
+	if limit <= 0 {
+		limit = DefaultReplicationPageSize
+	}
+	if limit > maxReplicationPageSize {
+		limit = maxReplicationPageSize
+	}
+
+	snapshots, err := s.snapshotRepo.ListSnapshotsByLibrary(ctx, libraryID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list snapshots: %w", err)
+	}
+	// 仓库返回倒序，这里转为正序
+	for i, j := 0, len(snapshots)-1; i < j; i, j = i+1, j-1 {
+		snapshots[i], snapshots[j] = snapshots[j], snapshots[i]
+	}
+
+	feed := &ReplicationFeed{LibraryID: libraryID, Commits: []BundleSnapshot{}, Blocks: []BundleBlock{}}
+	if len(snapshots) > 0 {
+		head := snapshots[len(snapshots)-1]
+		feed.Head = head.UUID
+		feed.HeadAt = &head.CreatedAt
+	}
+
+	start := 0
+	if after != "" {
+		start = -1
+		for i, snapshot := range snapshots {
+			if snapshot.UUID == after {
+				start = i + 1
+				break
+			}
+		}
+		if start < 0 {
+			if since == nil {
+				return nil, ErrReplicationCursorLost
+			}
+			start = len(snapshots)
+			for i, snapshot := range snapshots {
+				if snapshot.CreatedAt.After(*since) {
+					start = i
+					break
+				}
+			}
+		}
+	}
+
+	end := start + limit
+	if end > len(snapshots) {
+		end = len(snapshots)
+	}
+	feed.Behind = len(snapshots) - start
+	feed.More = end < len(snapshots)
+
+	uuids := make(map[uint]string, len(snapshots))
+	for _, snapshot := range snapshots {
+		uuids[snapshot.ID] = snapshot.UUID
+	}
+	seenBlocks := make(map[string]bool)
+	for i := start; i < end; i++ {
+		entry, err := s.bundles.snapshotEntry(ctx, &snapshots[i], uuids)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range entry.Files {
+			for _, hash := range file.Blocks {
+				if seenBlocks[hash] {
+					continue
+				}
+				seenBlocks[hash] = true
+				size, err := s.blockStore.GetSize(ctx, hash)
+				if err != nil {
+					return nil, fmt.Errorf("failed to get size of block %s: %w", hash, err)
+				}
+				feed.Blocks = append(feed.Blocks, BundleBlock{Hash: hash, Size: size})
+			}
+		}
+		feed.Commits = append(feed.Commits, *entry)
+	}
+	return feed, nil
+}
+
+// GetBlock 读取库引用的块数据（主服务器端）
+// 块必须被库的当前文件或某个快照引用，否则返回 ErrBlockNotFound，块哈希不能用来读取其他库的数据
+func (s *ReplicationService) GetBlock(ctx context.Context, libraryID uint, hash string) ([]byte, error) {
+	referenced, err := s.syncService.fileRepository.FindBlocksInLibraries(ctx, []uint{libraryID}, []string{hash})
+	if err != nil {
+		return nil, err
+	}
+	if !referenced[hash] {
+		inSnapshot, err := s.snapshotRepo.SnapshotsReferenceBlock(ctx, libraryID, hash)
+		if err != nil {
+			return nil, err
+		}
+		if !inSnapshot {
+			return nil, ErrBlockNotFound
+		}
+	}
+	return s.blockStore.Get(ctx, hash)
+}
+
+// Configure 把本地库配置为主服务器上某个库的副本
+// 更换主服务器或主库时复制进度从头开始；已提升的库重新配置后恢复为只读副本。
+// 主服务器必须在允许连接的列表中（SetAllowedPrimaries），令牌加密后保存
+func (s *ReplicationService) Configure(ctx context.Context, libraryID uint, primaryURL string, primaryLibraryID uint, token string) (*model.Replication, error) {
+	primaryURL = strings.TrimRight(primaryURL, "/")
+	parsed, err := url.Parse(primaryURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" || parsed.User != nil {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidPrimaryURL, primaryURL)
+	}
+	if err := s.checkPrimary(parsed); err != nil {
+		return nil, err
+	}
+	sealed, err := s.sealToken(token)
+	if err != nil {
+		return nil, err
+	}
+
+	lock := s.libraryLock(libraryID)
+	lock.Lock()
+	defer lock.Unlock()
+
+	replication, err := s.repo.GetReplication(ctx, libraryID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load replication: %w", err)
+	}
+	if replication == nil || replication.PrimaryURL != primaryURL || replication.PrimaryLibraryID != primaryLibraryID {
+		replication = &model.Replication{LibraryID: libraryID}
+	}
+	replication.PrimaryURL = primaryURL
+	replication.PrimaryLibraryID = primaryLibraryID
+	replication.PrimaryToken = sealed
+	replication.Role = model.ReplicationRoleReplica
+	replication.PromotedAt = nil
+	if err := s.repo.SaveReplication(ctx, replication); err != nil {
+		return nil, fmt.Errorf("failed to save replication: %w", err)
+	}
+	return replication, nil
+}
+
+// Remove 删除库的复制配置，库中已复制的数据保持不变
+func (s *ReplicationService) Remove(ctx context.Context, libraryID uint) error {
+	lock := s.libraryLock(libraryID)
+	lock.Lock()
+	defer lock.Unlock()
+
+	replication, err := s.repo.GetReplication(ctx, libraryID)
+	if err != nil {
+		return fmt.Errorf("failed to load replication: %w", err)
+	}
+	if replication == nil {
+		return ErrReplicationNotFound
+	}
+	if err := s.repo.DeleteReplication(ctx, libraryID); err != nil {
+		return fmt.Errorf("failed to delete replication: %w", err)
+	}
+	return nil
+}
+
+// Promote 把副本提升为主库：停止跟随主服务器，库恢复可写
+// 正在进行的复制会先完成当前提交
+func (s *ReplicationService) Promote(ctx context.Context, libraryID uint) (*model.Replication, error) {
+	lock := s.libraryLock(libraryID)
+	lock.Lock()
+	defer lock.Unlock()
+
+	replication, err := s.repo.GetReplication(ctx, libraryID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load replication: %w", err)
+	}
+	if replication == nil {
+		return nil, ErrReplicationNotFound
+	}
+	if replication.Role == model.ReplicationRolePromoted {
+		return replication, nil
+	}
+	now := time.Now()
+	replication.Role = model.ReplicationRolePromoted
+	replication.PromotedAt = &now
+	if err := s.repo.SaveReplication(ctx, replication); err != nil {
+		return nil, fmt.Errorf("failed to save replication: %w", err)
+	}
+	return replication, nil
+}
+
+// IsReadOnly 库是否为只读副本
+func (s *ReplicationService) IsReadOnly(ctx context.Context, libraryID uint) (bool, error) {
+	replication, err := s.repo.GetReplication(ctx, libraryID)
+	if err != nil {
+		return false, fmt.Errorf("failed to load replication: %w", err)
+	}
+	return replication != nil && replication.Role == model.ReplicationRoleReplica, nil
+}
+
+// Status 返回库的复制状态
+func (s *ReplicationService) Status(ctx context.Context, libraryID uint) (*ReplicationStatus, error) {
+	replication, err := s.repo.GetReplication(ctx, libraryID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load replication: %w", err)
+	}
+	if replication == nil {
+		return nil, ErrReplicationNotFound
+	}
+	return s.status(replication, time.Now()), nil
+}
+
+// ListStatus 返回所有复制配置的状态
+func (s *ReplicationService) ListStatus(ctx context.Context) ([]ReplicationStatus, error) {
+	replications, err := s.repo.ListReplications(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list replications: %w", err)
+	}
+	now := time.Now()
+	statuses := make([]ReplicationStatus, 0, len(replications))
+	for i := range replications {
+		statuses = append(statuses, *s.status(&replications[i], now))
+	}
+	return statuses, nil
+}
+
+// status 计算复制状态和延迟
+// 延迟为主服务器最新提交与已应用的最后一个提交之间的时间差；从未应用过提交时按配置以来的时长计算
+func (s *ReplicationService) status(replication *model.Replication, now time.Time) *ReplicationStatus {
+	s.mu.Lock()
+	running := s.running[replication.LibraryID]
+	s.mu.Unlock()
+
+	status := &ReplicationStatus{
+		LibraryID:        replication.LibraryID,
+		PrimaryURL:       replication.PrimaryURL,
+		PrimaryLibraryID: replication.PrimaryLibraryID,
+		Role:             replication.Role,
+		Running:          running,
+		LastCommit:       replication.LastCommitUUID,
+		LastCommitAt:     replication.LastCommitAt,
+		PrimaryHead:      replication.PrimaryHead,
+		PrimaryHeadAt:    replication.PrimaryHeadAt,
+		CommitsBehind:    replication.CommitsBehind,
+		CommitsApplied:   replication.CommitsApplied,
+		BlocksFetched:    replication.BlocksFetched,
+		BytesFetched:     replication.BytesFetched,
+		LastSyncAt:       replication.LastSyncAt,
+		LastSuccessAt:    replication.LastSuccessAt,
+		LastError:        replication.LastError,
+		PromotedAt:       replication.PromotedAt,
+	}
+	if replication.CommitsBehind > 0 {
+		switch {
+		case replication.LastCommitAt != nil && replication.PrimaryHeadAt != nil:
+			status.LagSeconds = replication.PrimaryHeadAt.Sub(*replication.LastCommitAt).Seconds()
+		case replication.LastCommitAt == nil:
+			status.LagSeconds = now.Sub(replication.CreatedAt).Seconds()
+		}
+	}
+	return status
+}
+
+// ReplicateOnce 从主服务器拉取并应用库的所有新提交
+func (s *ReplicationService) ReplicateOnce(ctx context.Context, libraryID uint) (*ReplicationResult, error) {
+	lock := s.libraryLock(libraryID)
+	lock.Lock()
+	defer lock.Unlock()
+
+	replication, err := s.repo.GetReplication(ctx, libraryID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load replication: %w", err)
+	}
+	if replication == nil {
+		return nil, ErrReplicationNotFound
+	}
+	if replication.Role == model.ReplicationRolePromoted {
+		return nil, ErrReplicationPromoted
+	}
+
+	s.setRunning(libraryID, true)
+	defer s.setRunning(libraryID, false)
+
+	result := &ReplicationResult{LibraryID: libraryID}
+	err = s.replicate(ctx, replication, result)
+
+	now := time.Now()
+	replication.LastSyncAt = &now
+	if err != nil {
+		replication.LastError = err.Error()
+	} else {
+		replication.LastError = ""
+		replication.LastSuccessAt = &now
+	}
+	if saveErr := s.repo.SaveReplication(ctx, replication); saveErr != nil && err == nil {
+		err = fmt.Errorf("failed to save replication: %w", saveErr)
+	}
+	result.CommitsBehind = replication.CommitsBehind
+	result.LastCommit = replication.LastCommitUUID
+	return result, err
+}
+
+// replicate 逐页拉取提交并依次应用，每个提交完成后保存进度
+func (s *ReplicationService) replicate(ctx context.Context, replication *model.Replication, result *ReplicationResult) error {
+	for {
+		feed, err := s.fetchFeed(ctx, replication)
+		if err != nil {
+			return err
+		}
+		replication.PrimaryHead = feed.Head
+		replication.PrimaryHeadAt = feed.HeadAt
+		replication.CommitsBehind = feed.Behind
+
+		blockSizes := make(map[string]int64, len(feed.Blocks))
+		for _, block := range feed.Blocks {
+			blockSizes[block.Hash] = block.Size
+		}
+		for i := range feed.Commits {
+			commit := &feed.Commits[i]
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if err := s.applyCommit(ctx, replication, commit, blockSizes, result); err != nil {
+				return fmt.Errorf("commit %s: %w", commit.UUID, err)
+			}
+			createdAt := commit.CreatedAt
+			replication.LastCommitUUID = commit.UUID
+			replication.LastCommitAt = &createdAt
+			replication.CommitsApplied++
+			replication.CommitsBehind--
+			result.CommitsApplied++
+			if err := s.repo.SaveReplication(ctx, replication); err != nil {
+				return fmt.Errorf("failed to save replication progress: %w", err)
+			}
+		}
+		if !feed.More || len(feed.Commits) == 0 {
+			return nil
+		}
+	}
+}
+
+// applyCommit 应用单个提交：补齐块 → 创建快照 → 更新库的当前文件
+// 每一步都是幂等的，中断后重新应用同一提交是安全的
+func (s *ReplicationService) applyCommit(ctx context.Context, replication *model.Replication, commit *BundleSnapshot, blockSizes map[string]int64, result *ReplicationResult) error {
+	for _, file := range commit.Files {
+		var total int64
+		for _, hash := range file.Blocks {
+			size, listed := blockSizes[hash]
+			if !listed {
+				return fmt.Errorf("file %s references unlisted block %s", file.Path, hash)
+			}
+			total += size
+		}
+		if total != file.Size {
+			return fmt.Errorf("file %s size mismatch: blocks add up to %d, commit says %d", file.Path, total, file.Size)
+		}
+	}
+
+	// 1. 拉取本地缺少的块
+	fetched := make(map[string]bool)
+	for _, file := range commit.Files {
+		for _, hash := range file.Blocks {
+			if fetched[hash] {
+				continue
+			}
+			fetched[hash] = true
+			exists, err := s.blockStore.Exists(ctx, hash)
+			if err != nil {
+				return fmt.Errorf("failed to check block %s: %w", hash, err)
+			}
+			if exists {
+				continue
+			}
+			data, err := s.fetchBlock(ctx, replication, hash)
+			if err != nil {
+				return err
+			}
+			if int64(len(data)) != blockSizes[hash] {
+				return fmt.Errorf("block %s size mismatch: expected %d, got %d", hash, blockSizes[hash], len(data))
+			}
+			// PutBlock 校验 SHA-256 并以引用计数 0 登记元数据，中途失败时可被 GC 回收
+			if err := s.syncService.PutBlock(ctx, hash, data); err != nil {
+				return err
+			}
+			replication.BlocksFetched++
+			replication.BytesFetched += int64(len(data))
+			result.BlocksFetched++
+			result.BytesFetched += int64(len(data))
+		}
+	}
+
+	// 2. 以相同 UUID 创建快照，已存在时跳过
+	if existing, err := s.snapshotRepo.GetSnapshotByUUID(ctx, commit.UUID); err != nil || existing == nil {
+		if err := s.bundles.importSnapshot(ctx, replication.LibraryID, commit, blockSizes); err != nil {
+			return err
+		}
+	}
+
+	// 3. 库的当前文件与该提交保持一致
+	if err := s.syncService.checkout(ctx, replication.LibraryID, commit.Files, blockSizes); err != nil {
+		return err
+	}
+	s.syncService.events.Publish(Event{
+		LibraryID: replication.LibraryID,
+		Type:      EventCommitCreated,
+		Hash:      commit.RootHash,
+		CommitID:  commit.UUID,
+	})
+	s.syncService.commitScheduler.SnapshotCreated(replication.LibraryID)
+	return nil
+}
+
+// RunFollower 在后台持续跟随主服务器，直到 ctx 被取消
+// 启动时立即执行一轮，之后按 interval 轮询所有未提升的副本
+func (s *ReplicationService) RunFollower(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = DefaultReplicationInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		s.followAll(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// followAll 对所有副本执行一次复制，单个库失败不影响其他库
+func (s *ReplicationService) followAll(ctx context.Context) {
+	replications, err := s.repo.ListReplications(ctx)
+	if err != nil {
+		log.Printf("replication: failed to list replications: %v", err)
+		return
+	}
+	for _, replication := range replications {
+		if replication.Role != model.ReplicationRoleReplica || ctx.Err() != nil {
+			continue
+		}
+		result, err := s.ReplicateOnce(ctx, replication.LibraryID)
+		if err != nil {
+			log.Printf("replication: library %d: %v", replication.LibraryID, err)
+			continue
+		}
+		if result.CommitsApplied > 0 {
+			log.Printf("replication: library %d: applied %d commits, fetched %d blocks (%d bytes), %d behind",
+				result.LibraryID, result.CommitsApplied, result.BlocksFetched, result.BytesFetched, result.CommitsBehind)
+		}
+	}
+}
+
+// fetchFeed 从主服务器拉取游标之后的一页提交
+func (s *ReplicationService) fetchFeed(ctx context.Context, replication *model.Replication) (*ReplicationFeed, error) {
+	query := url.Values{}
+	query.Set("limit", strconv.Itoa(DefaultReplicationPageSize))
+	if replication.LastCommitUUID != "" {
+		query.Set("after", replication.LastCommitUUID)
+	}
+	if replication.LastCommitAt != nil {
+		query.Set("since", replication.LastCommitAt.UTC().Format(time.RFC3339Nano))
+	}
+	endpoint := fmt.Sprintf("%s/api/v1/replication/libraries/%d/commits?%s", replication.PrimaryURL, replication.PrimaryLibraryID, query.Encode())
+
+	body, err := s.get(ctx, replication, endpoint)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	var feed ReplicationFeed
+	if err := json.NewDecoder(body).Decode(&feed); err != nil {
+		return nil, fmt.Errorf("invalid commit feed from primary: %w", err)
+	}
+	return &feed, nil
+}
+
+// fetchBlock 从主服务器下载块
+func (s *ReplicationService) fetchBlock(ctx context.Context, replication *model.Replication, hash string) ([]byte, error) {
+	endpoint := fmt.Sprintf("%s/api/v1/replication/libraries/%d/blocks/%s", replication.PrimaryURL, replication.PrimaryLibraryID, url.PathEscape(hash))
+	body, err := s.get(ctx, replication, endpoint)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	data, err := io.ReadAll(io.LimitReader(body, maxBundleBlockSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to download block %s: %w", hash, err)
+	}
+	if len(data) > maxBundleBlockSize {
+		return nil, fmt.Errorf("block %s exceeds maximum size", hash)
+	}
+	return data, nil
+}
+
+// get 向主服务器发送带令牌的 GET 请求，非 200 响应转换为错误
+func (s *ReplicationService) get(ctx context.Context, replication *model.Replication, endpoint string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkPrimary(req.URL); err != nil {
+		return nil, err
+	}
+	token, err := s.openToken(replication.PrimaryToken)
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("primary request failed: %w", err)
+	}
+	if resp.StatusCode == http.StatusOK {
+		return resp.Body, nil
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusGone {
+		return nil, ErrReplicationCursorLost
+	}
+	var payload struct {
+		Error string `json:"error"`
+	}
+	_ = json.NewDecoder(io.LimitReader(resp.Body, 4096)).Decode(&payload)
+	return nil, fmt.Errorf("primary returned %s: %s", resp.Status, payload.Error)
+}
+
+// libraryLock 返回库的复制锁，同一库的复制、配置和提升串行执行
+func (s *ReplicationService) libraryLock(libraryID uint) *sync.Mutex {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	lock, ok := s.libLocks[libraryID]
+	if !ok {
+		lock = &sync.Mutex{}
+		s.libLocks[libraryID] = lock
+	}
+	return lock
+}
+
+// setRunning 记录库是否正在复制
+func (s *ReplicationService) setRunning(libraryID uint, running bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if running {
+		s.running[libraryID] = true
+	} else {
+		delete(s.running, libraryID)
+	}
+}
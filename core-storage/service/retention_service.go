@@ -0,0 +1,296 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/sealock/core-storage/model"
+	"github.com/sealock/core-storage/storage"
+)
+
+// ErrInvalidRetentionPolicy 保留策略的计数或时长为负数
+var ErrInvalidRetentionPolicy = errors.New("invalid retention policy: counts and max age must not be negative")
+
+// RetentionService 快照保留策略服务
+// 每次上传、删除都会生成自动提交，快照数量会无限增长；
+// 该服务按库配置的保留策略清理过期快照，释放其持有的块引用并交给垃圾回收器
+type RetentionService struct {
+	snapshotRepo storage.SnapshotRepository
+	policyRepo   storage.RetentionPolicyRepository
+	blockRepo    storage.BlockRepository
+	gc           *GarbageCollector
+	tx           storage.Transactor
+
+	// OnPrune 库的快照被清理后回调（可选），removed 为被删除的快照 UUID，用于同步库的版本记录与统计
+	OnPrune func(libraryID uint, removed []string)
+}
+
+// PruneResult 单个库的一次清理结果
+type PruneResult struct {
+	LibraryID       uint     // 库ID
+	Removed         []string // 被删除的快照 UUID
+	ReleasedBlocks  int      // 释放引用的块数量（去重后）
+	CollectedBlocks int      // 被垃圾回收实际删除的块数量
+}
+
+// NewRetentionService 创建保留策略服务
+// gc 为 nil 时只释放引用，不立即回收块
+func NewRetentionService(
+	sr storage.SnapshotRepository,
+	pr storage.RetentionPolicyRepository,
+	br storage.BlockRepository,
+	gc *GarbageCollector,
+) *RetentionService {
+	return &RetentionService{
+		snapshotRepo: sr,
+		policyRepo:   pr,
+		blockRepo:    br,
+		gc:           gc,
+	}
+}
+
+// SetTransactor 设置删除快照时使用的事务，快照的块引用与快照记录一起释放
+func (s *RetentionService) SetTransactor(tx storage.Transactor) {
+	s.tx = tx
+}
+
+// SetPolicy 设置库的保留策略
+func (s *RetentionService) SetPolicy(ctx context.Context, policy *model.RetentionPolicy) error {
+	if policy.KeepLast < 0 || policy.KeepHourly < 0 || policy.KeepDaily < 0 ||
+		policy.KeepWeekly < 0 || policy.KeepMonthly < 0 || policy.MaxAge < 0 {
+		return ErrInvalidRetentionPolicy
+	}
+	if err := s.policyRepo.SavePolicy(ctx, policy); err != nil {
+		return fmt.Errorf("failed to save retention policy: %w", err)
+	}
+	return nil
+}
+
+// GetPolicy 获取库的保留策略，未配置时返回 nil
+func (s *RetentionService) GetPolicy(ctx context.Context, libraryID uint) (*model.RetentionPolicy, error) {
+	policy, err := s.policyRepo.GetPolicy(ctx, libraryID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get retention policy: %w", err)
+	}
+	return policy, nil
+}
+
+// Prune 按保留策略清理指定库的过期快照
+// 未配置策略的库保留全部快照
+func (s *RetentionService) Prune(ctx context.Context, libraryID uint) (*PruneResult, error) {
+	result := &PruneResult{LibraryID: libraryID}
+
+	policy, err := s.GetPolicy(ctx, libraryID)
+	if err != nil || policy == nil {
+		return result, err
+	}
+
+	snapshots, err := s.snapshotRepo.ListSnapshotsByLibrary(ctx, libraryID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list snapshots: %w", err)
+	}
+
+	released := make(map[string]struct{})
+	// 中途失败时已删除的快照同样需要同步到版本记录
+	defer func() {
+		if s.OnPrune != nil && len(result.Removed) > 0 {
+			s.OnPrune(libraryID, result.Removed)
+		}
+	}()
+	for _, snapshot := range ExpiredSnapshots(policy, snapshots, time.Now()) {
+		hashes, err := releaseSnapshot(ctx, s.tx, s.snapshotRepo, s.blockRepo, snapshot.ID)
+		if err != nil {
+			return result, err
+		}
+		for _, hash := range hashes {
+			released[hash] = struct{}{}
+		}
+		result.Removed = append(result.Removed, snapshot.UUID)
+	}
+
+	result.ReleasedBlocks = len(released)
+	if s.gc != nil && len(released) > 0 {
+		hashes := make([]string, 0, len(released))
+		for hash := range released {
+			hashes = append(hashes, hash)
+		}
+		collected, err := s.gc.Collect(ctx, hashes)
+		result.CollectedBlocks = collected
+		if err != nil {
+			return result, fmt.Errorf("failed to collect released blocks: %w", err)
+		}
+	}
+
+	return result, nil
+}
+
+// PruneAll 对所有配置了保留策略的库执行清理
+// 单个库失败不会中断其他库，错误会在最后汇总返回
+func (s *RetentionService) PruneAll(ctx context.Context) ([]*PruneResult, error) {
+	policies, err := s.policyRepo.ListPolicies(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list retention policies: %w", err)
+	}
+
+	var results []*PruneResult
+	var firstErr error
+	for _, policy := range policies {
+		result, err := s.Prune(ctx, policy.LibraryID)
+		if err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("prune library %d: %w", policy.LibraryID, err)
+		}
+		if result != nil {
+			results = append(results, result)
+		}
+	}
+	return results, firstErr
+}
+
+// RunPruneJob 以固定间隔在后台执行清理，直到 ctx 被取消
+func (s *RetentionService) RunPruneJob(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			results, err := s.PruneAll(ctx)
+			if err != nil {
+				log.Printf("snapshot prune failed: %v", err)
+			}
+			for _, result := range results {
+				if len(result.Removed) > 0 {
+					log.Printf("library %d: pruned %d snapshots, released %d blocks, collected %d blocks",
+						result.LibraryID, len(result.Removed), result.ReleasedBlocks, result.CollectedBlocks)
+				}
+			}
+		}
+	}
+}
+
+// releaseSnapshot 在一个事务中释放快照持有的块引用并删除快照及其 SnapshotFile 记录
+// 任一步失败时整体回滚，重试时不会重复释放引用；返回被释放引用的块哈希
+func releaseSnapshot(ctx context.Context, tx storage.Transactor, sr storage.SnapshotRepository, br storage.BlockRepository, snapshotID uint) ([]string, error) {
+	var released []string
+	err := inTransaction(ctx, tx, func(ctx context.Context) error {
+		released = nil
+		files, err := sr.ListSnapshotFiles(ctx, snapshotID, 0, 0)
+		if err != nil {
+			return fmt.Errorf("failed to list snapshot files: %w", err)
+		}
+		for _, file := range files {
+			var blockHashes []string
+			if len(file.BlockIDs) > 0 {
+				if err := json.Unmarshal(file.BlockIDs, &blockHashes); err != nil {
+					return fmt.Errorf("failed to unmarshal block IDs: %w", err)
+				}
+			}
+			for _, blockHash := range blockHashes {
+				if err := br.DecrementBlockRefCount(ctx, blockHash); err != nil {
+					return fmt.Errorf("snapshot %d: failed to release block %s: %w", snapshotID, blockHash, err)
+				}
+				released = append(released, blockHash)
+			}
+		}
+		if err := sr.DeleteSnapshot(ctx, snapshotID); err != nil {
+			return fmt.Errorf("failed to delete snapshot %d: %w", snapshotID, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return released, nil
+}
+
+// ExpiredSnapshots 根据保留策略计算应被清理的快照
+// snapshots 须按创建时间倒序排列；最新快照（HEAD）永远保留
+// 规则：
+//   - KeepTagged 为真时带标签的快照永久保留
+//   - MaxAge 之外的快照一律过期
+//   - 其余快照只要命中 KeepLast 或任一时间桶（小时/天/周/月）规则即保留；
+//     未配置任何计数规则时全部保留
+func ExpiredSnapshots(policy *model.RetentionPolicy, snapshots []model.Snapshot, now time.Time) []model.Snapshot {
+	if policy == nil || len(snapshots) == 0 {
+		return nil
+	}
+
+	keep := make([]bool, len(snapshots))
+	candidate := make([]bool, len(snapshots))
+	keep[0] = true
+	for i, snapshot := range snapshots {
+		if policy.KeepTagged && snapshot.Tag != "" {
+			keep[i] = true
+		}
+		candidate[i] = policy.MaxAge <= 0 || now.Sub(snapshot.CreatedAt) <= policy.MaxAge
+	}
+
+	countRules := policy.KeepLast > 0 || policy.KeepHourly > 0 || policy.KeepDaily > 0 ||
+		policy.KeepWeekly > 0 || policy.KeepMonthly > 0
+
+	if !countRules {
+		for i := range snapshots {
+			keep[i] = keep[i] || candidate[i]
+		}
+	} else {
+		kept := 0
+		for i := range snapshots {
+			if kept >= policy.KeepLast {
+				break
+			}
+			if candidate[i] {
+				keep[i] = true
+				kept++
+			}
+		}
+
+		buckets := []struct {
+			limit int
+			key   func(time.Time) string
+		}{
+			{policy.KeepHourly, func(t time.Time) string { return t.Format("2006-01-02 15") }},
+			{policy.KeepDaily, func(t time.Time) string { return t.Format("2006-01-02") }},
+			{policy.KeepWeekly, func(t time.Time) string {
+				year, week := t.ISOWeek()
+				return fmt.Sprintf("%d-W%02d", year, week)
+			}},
+			{policy.KeepMonthly, func(t time.Time) string { return t.Format("2006-01") }},
+		}
+		for _, bucket := range buckets {
+			if bucket.limit <= 0 {
+				continue
+			}
+			lastKey := ""
+			count := 0
+			for i, snapshot := range snapshots {
+				if count >= bucket.limit {
+					break
+				}
+				if !candidate[i] {
+					continue
+				}
+				// 倒序遍历时每个桶遇到的第一个快照即为该桶内最新的快照
+				key := bucket.key(snapshot.CreatedAt)
+				if key != lastKey {
+					keep[i] = true
+					lastKey = key
+					count++
+				}
+			}
+		}
+	}
+
+	var expired []model.Snapshot
+	for i, snapshot := range snapshots {
+		if !keep[i] {
+			expired = append(expired, snapshot)
+		}
+	}
+	return expired
+}
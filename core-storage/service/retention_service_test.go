@@ -0,0 +1,221 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sealock/core-storage/model"
+	"github.com/sealock/core-storage/storage"
+)
+
+func TestExpiredSnapshots(t *testing.T) {
+	now := time.Date(2024, 6, 15, 12, 0, 0, 0, time.UTC)
+	snapshot := func(id uint, age time.Duration, tag string) model.Snapshot {
+		return model.Snapshot{ID: id, Tag: tag, CreatedAt: now.Add(-age)}
+	}
+	hour := time.Hour
+	day := 24 * time.Hour
+
+	tests := []struct {
+		name      string
+		policy    *model.RetentionPolicy
+		snapshots []model.Snapshot
+		expired   []uint
+	}{
+		{
+			name:      "no policy keeps everything",
+			policy:    nil,
+			snapshots: []model.Snapshot{snapshot(2, hour, ""), snapshot(1, day, "")},
+		},
+		{
+			name:      "default policy keeps everything",
+			policy:    model.DefaultRetentionPolicy(1),
+			snapshots: []model.Snapshot{snapshot(3, hour, ""), snapshot(2, day, ""), snapshot(1, 400*day, "")},
+		},
+		{
+			name:   "keep last",
+			policy: &model.RetentionPolicy{KeepLast: 2},
+			snapshots: []model.Snapshot{
+				snapshot(4, hour, ""), snapshot(3, 2*hour, ""), snapshot(2, 3*hour, ""), snapshot(1, 4*hour, ""),
+			},
+			expired: []uint{2, 1},
+		},
+		{
+			name:   "tagged snapshots are kept",
+			policy: &model.RetentionPolicy{KeepLast: 1, KeepTagged: true},
+			snapshots: []model.Snapshot{
+				snapshot(3, hour, ""), snapshot(2, 2*hour, "release"), snapshot(1, 3*hour, ""),
+			},
+			expired: []uint{1},
+		},
+		{
+			name:   "tags ignored when keep tagged is off",
+			policy: &model.RetentionPolicy{KeepLast: 1},
+			snapshots: []model.Snapshot{
+				snapshot(3, hour, ""), snapshot(2, 2*hour, "release"), snapshot(1, 3*hour, ""),
+			},
+			expired: []uint{2, 1},
+		},
+		{
+			name:   "max age without count rules",
+			policy: &model.RetentionPolicy{MaxAge: 2 * day},
+			snapshots: []model.Snapshot{
+				snapshot(3, hour, ""), snapshot(2, day, ""), snapshot(1, 3*day, ""),
+			},
+			expired: []uint{1},
+		},
+		{
+			name:   "head survives max age",
+			policy: &model.RetentionPolicy{MaxAge: day},
+			snapshots: []model.Snapshot{
+				snapshot(2, 10*day, ""), snapshot(1, 11*day, ""),
+			},
+			expired: []uint{1},
+		},
+		{
+			name:   "max age limits keep last",
+			policy: &model.RetentionPolicy{KeepLast: 3, MaxAge: 2 * day},
+			snapshots: []model.Snapshot{
+				snapshot(3, hour, ""), snapshot(2, 3*day, ""), snapshot(1, 4*day, ""),
+			},
+			expired: []uint{2, 1},
+		},
+		{
+			name:   "keep daily keeps the newest of each day",
+			policy: &model.RetentionPolicy{KeepDaily: 2},
+			snapshots: []model.Snapshot{
+				snapshot(5, hour, ""), snapshot(4, 2*hour, ""), // 6月15日
+				snapshot(3, day, ""), snapshot(2, day+hour, ""), // 6月14日
+				snapshot(1, 2*day, ""), // 6月13日
+			},
+			expired: []uint{4, 2, 1},
+		},
+		{
+			name:   "keep hourly",
+			policy: &model.RetentionPolicy{KeepHourly: 2},
+			snapshots: []model.Snapshot{
+				snapshot(4, 10*time.Minute, ""), snapshot(3, 20*time.Minute, ""), // 11 点
+				snapshot(2, 70*time.Minute, ""),  // 10 点
+				snapshot(1, 130*time.Minute, ""), // 9 点
+			},
+			expired: []uint{3, 1},
+		},
+		{
+			name:   "rules combine",
+			policy: &model.RetentionPolicy{KeepLast: 1, KeepMonthly: 2},
+			snapshots: []model.Snapshot{
+				snapshot(4, hour, ""), snapshot(3, 2*hour, ""),
+				snapshot(2, 20*day, ""), // 5月
+				snapshot(1, 50*day, ""), // 4月
+			},
+			expired: []uint{3, 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []uint
+			for _, snapshot := range ExpiredSnapshots(tt.policy, tt.snapshots, now) {
+				got = append(got, snapshot.ID)
+			}
+			if !reflect.DeepEqual(got, tt.expired) {
+				t.Errorf("expired = %v, want %v", got, tt.expired)
+			}
+		})
+	}
+}
+
+func TestPruneRemovesLibraryVersions(t *testing.T) {
+	ctx := context.Background()
+	snapshots := storage.NewMockSnapshotRepository()
+	policies := storage.NewMockRetentionPolicyRepository()
+	blocks := storage.NewMockBlockRepository()
+	libraries := storage.NewMockLibraryRepository()
+	versions := storage.NewMockLibraryVersionRepository()
+	libraryService := NewLibraryService(libraries, versions, storage.NewMockFileRepository(), snapshots, blocks, nil)
+	retention := NewRetentionService(snapshots, policies, blocks, nil)
+	retention.OnPrune = func(libraryID uint, removed []string) {
+		if err := libraryService.RemoveVersions(ctx, libraryID, removed); err != nil {
+			t.Errorf("remove versions: %v", err)
+		}
+	}
+
+	lib := &model.Library{Name: "lib", OwnerID: 1}
+	if err := libraries.CreateLibrary(ctx, lib); err != nil {
+		t.Fatalf("create library: %v", err)
+	}
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		snapshot := &model.Snapshot{UUID: fmt.Sprintf("snapshot-%d", i), LibraryID: lib.ID, CreatedAt: now.Add(time.Duration(i) * time.Minute)}
+		if err := snapshots.CreateSnapshot(ctx, snapshot); err != nil {
+			t.Fatalf("create snapshot: %v", err)
+		}
+	}
+	if _, err := libraryService.RefreshStats(ctx, lib.ID); err != nil {
+		t.Fatalf("refresh stats: %v", err)
+	}
+	if err := policies.SavePolicy(ctx, &model.RetentionPolicy{LibraryID: lib.ID, KeepLast: 1}); err != nil {
+		t.Fatalf("save policy: %v", err)
+	}
+
+	result, err := retention.Prune(ctx, lib.ID)
+	if err != nil || len(result.Removed) != 2 {
+		t.Fatalf("prune = %+v, %v, want two snapshots removed", result, err)
+	}
+	list, err := libraryService.ListVersions(ctx, lib.ID)
+	if err != nil || len(list) != 1 || list[0].CommitID != "snapshot-2" {
+		t.Fatalf("versions = %+v, %v, want only the kept snapshot", list, err)
+	}
+	got, err := libraries.GetLibraryByID(ctx, lib.ID)
+	if err != nil || got.VersionCount != 1 || got.CurrentVersionID != list[0].ID {
+		t.Fatalf("library = %+v, %v, want stats of the kept version", got, err)
+	}
+}
+
+func TestPruneReleasesSnapshotBlocks(t *testing.T) {
+	ctx := context.Background()
+	snapshots := storage.NewMockSnapshotRepository()
+	policies := storage.NewMockRetentionPolicyRepository()
+	blocks := storage.NewMockBlockRepository()
+	store := storage.NewLocalBlockStore()
+	gc := NewGarbageCollector(store, blocks)
+	gc.SetGracePeriod(0)
+	retention := NewRetentionService(snapshots, policies, blocks, gc)
+
+	// 旧快照引用 a、b，新快照只引用 b
+	a := stageBlock(t, store, blocks, "aaaa", 1)
+	b := stageBlock(t, store, blocks, "bbbb", 2)
+	now := time.Now()
+	for i, hashes := range [][]string{{a, b}, {b}} {
+		snapshot := &model.Snapshot{UUID: fmt.Sprintf("snapshot-%d", i), LibraryID: 1, CreatedAt: now.Add(time.Duration(i) * time.Minute)}
+		if err := snapshots.CreateSnapshot(ctx, snapshot); err != nil {
+			t.Fatalf("create snapshot: %v", err)
+		}
+		if err := snapshots.CreateSnapshotFile(ctx, &model.SnapshotFile{SnapshotID: snapshot.ID, FileName: "a.txt", BlockIDs: blockIDs(hashes...)}); err != nil {
+			t.Fatalf("create snapshot file: %v", err)
+		}
+	}
+	if err := policies.SavePolicy(ctx, &model.RetentionPolicy{LibraryID: 1, KeepLast: 1}); err != nil {
+		t.Fatalf("save policy: %v", err)
+	}
+
+	result, err := retention.Prune(ctx, 1)
+	if err != nil {
+		t.Fatalf("prune: %v", err)
+	}
+	if len(result.Removed) != 1 || result.ReleasedBlocks != 2 || result.CollectedBlocks != 1 {
+		t.Fatalf("prune = %+v, want one snapshot removed, two blocks released and one collected", result)
+	}
+	if ok, _ := store.Exists(ctx, a); ok {
+		t.Fatal("block only referenced by the pruned snapshot was not collected")
+	}
+	if block, _ := blocks.GetBlockMetadata(ctx, b); block == nil || block.RefCount != 1 {
+		t.Fatalf("block kept by the newest snapshot = %+v, want one reference", block)
+	}
+	if files, _ := snapshots.ListSnapshotFiles(ctx, 1, 0, 0); len(files) != 0 {
+		t.Fatalf("pruned snapshot still has %d files", len(files))
+	}
+}
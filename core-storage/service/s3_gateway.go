@@ -0,0 +1,184 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/sealock/core-storage/model"
+	"github.com/sealock/core-storage/storage"
+)
+
+var (
+	// ErrNoSuchBucket 存储桶（库）不存在或不属于当前用户
+	ErrNoSuchBucket = errors.New("no such bucket")
+	// ErrBucketReadOnly 存储桶对应的库是只读副本
+	ErrBucketReadOnly = errors.New("bucket is a read-only replica")
+)
+
+// S3Gateway 把用户的库映射为 S3 存储桶：桶名为库名，对象键为库内文件路径
+// 读写都经过 FileService，写入的内容与其他上传方式一样分块去重，变更同样发布事件并登记自动提交。
+// 目录由文件路径隐含，以 "/" 结尾的目录占位对象不会被保存
+type S3Gateway struct {
+	files       *FileService
+	libraryRepo storage.LibraryRepository
+	replication *ReplicationService // 可为 nil；非 nil 时拒绝写入只读副本
+}
+
+// ObjectListing ListObjectsV2 的一页结果
+type ObjectListing struct {
+	Objects        []model.File
+	CommonPrefixes []string // 按分隔符合并的公共前缀（含分隔符）
+	Truncated      bool
+	NextAfter      string // 下一页从该键之后开始，没有下一页时为空
+}
+
+// NewS3Gateway 创建 S3 网关，replication 可为 nil
+func NewS3Gateway(files *FileService, lr storage.LibraryRepository, replication *ReplicationService) *S3Gateway {
+	return &S3Gateway{files: files, libraryRepo: lr, replication: replication}
+}
+
+// Buckets 列出用户拥有的库
+func (g *S3Gateway) Buckets(ctx context.Context, ownerID uint) ([]*model.Library, error) {
+	libs, err := g.libraryRepo.ListLibrariesByOwner(ctx, ownerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list libraries: %w", err)
+	}
+	sort.Slice(libs, func(i, j int) bool { return libs[i].Name < libs[j].Name })
+	return libs, nil
+}
+
+// Bucket 按名称查找用户拥有的库，不存在时返回 ErrNoSuchBucket
+func (g *S3Gateway) Bucket(ctx context.Context, ownerID uint, name string) (*model.Library, error) {
+	libs, err := g.libraryRepo.ListLibrariesByOwner(ctx, ownerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list libraries: %w", err)
+	}
+	for _, lib := range libs {
+		if lib.Name == name {
+			return lib, nil
+		}
+	}
+	return nil, ErrNoSuchBucket
+}
+
+// WritableBucket 按名称查找用户拥有的库并确认可以写入，只读副本返回 ErrBucketReadOnly
+func (g *S3Gateway) WritableBucket(ctx context.Context, ownerID uint, name string) (*model.Library, error) {
+	lib, err := g.Bucket(ctx, ownerID, name)
+	if err != nil {
+		return nil, err
+	}
+	if g.replication != nil {
+		readOnly, err := g.replication.IsReadOnly(ctx, lib.ID)
+		if err != nil {
+			return nil, err
+		}
+		if readOnly {
+			return nil, ErrBucketReadOnly
+		}
+	}
+	return lib, nil
+}
+
+// ListObjects 按 S3 ListObjectsV2 的语义列出库中的对象
+// 只列出以 prefix 开头且大于 after 的键，按字节序排列；delimiter 不为空时，前缀之后含分隔符的键
+// 合并为一个公共前缀。对象和公共前缀合计最多 maxKeys 个
+func (g *S3Gateway) ListObjects(ctx context.Context, libraryID uint, prefix, delimiter, after string, maxKeys int) (*ObjectListing, error) {
+	files, err := g.files.ListLibraryFiles(ctx, libraryID)
+	if err != nil {
+		return nil, err
+	}
+	// 数据库按排序规则排序，S3 要求按 UTF-8 字节序
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+
+	listing := &ObjectListing{}
+	var current string // 正在合并的公共前缀
+	for _, file := range files {
+		key := file.Name
+		if !strings.HasPrefix(key, prefix) || key <= after {
+			continue
+		}
+		if current != "" && strings.HasPrefix(key, current) {
+			// 公共前缀下的键全部归入同一项，续页标记指向最后一个被合并的键
+			listing.NextAfter = key
+			continue
+		}
+		if len(listing.Objects)+len(listing.CommonPrefixes) >= maxKeys {
+			listing.Truncated = true
+			break
+		}
+		listing.NextAfter = key
+		if delimiter != "" {
+			if i := strings.Index(key[len(prefix):], delimiter); i >= 0 {
+				current = key[:len(prefix)+i+len(delimiter)]
+				listing.CommonPrefixes = append(listing.CommonPrefixes, current)
+				continue
+			}
+		}
+		listing.Objects = append(listing.Objects, file)
+	}
+	if !listing.Truncated {
+		listing.NextAfter = ""
+	}
+	return listing, nil
+}
+
+// OpenObject 打开库中的对象，不存在时均返回 nil
+func (g *S3Gateway) OpenObject(ctx context.Context, libraryID uint, key string) (*BlockReader, *model.File, error) {
+	file, err := g.files.GetFileByPath(ctx, libraryID, key)
+	if err != nil || file == nil {
+		return nil, nil, err
+	}
+	return g.files.OpenFile(ctx, file.ID)
+}
+
+// PutObject 把 r 的内容写入库中的对象，size 未知时传 -1
+func (g *S3Gateway) PutObject(ctx context.Context, lib *model.Library, ownerID uint, key string, r io.Reader, size int64) (*model.File, error) {
+	return g.files.PutFile(ctx, lib.ID, ownerID, key, r, size)
+}
+
+// DeleteObject 删除库中的对象，对象不存在时不报错
+func (g *S3Gateway) DeleteObject(ctx context.Context, lib *model.Library, key string) error {
+	_, err := g.files.RemoveFile(ctx, lib.ID, key)
+	return err
+}
+
+// CreateMultipartUpload 为库中的对象创建分段上传
+func (g *S3Gateway) CreateMultipartUpload(ctx context.Context, lib *model.Library, ownerID uint, key string) (*MultipartUpload, error) {
+	return g.files.CreateMultipartUpload(ctx, lib.ID, ownerID, key)
+}
+
+// MultipartUpload 获取库中对象的分段上传，不存在、已过期或不属于该对象时返回 ErrNoSuchUpload
+func (g *S3Gateway) MultipartUpload(ctx context.Context, lib *model.Library, key, uploadID string) (*MultipartUpload, error) {
+	upload, err := g.files.GetMultipartUpload(ctx, uploadID)
+	if err != nil {
+		return nil, err
+	}
+	if upload == nil || upload.LibraryID != lib.ID || upload.FileName != cleanPath(key) {
+		return nil, ErrNoSuchUpload
+	}
+	return upload, nil
+}
+
+// UploadPart 上传分段上传的一段
+func (g *S3Gateway) UploadPart(ctx context.Context, upload *MultipartUpload, number int, r io.Reader, size int64, contentMD5 []byte) (*MultipartPart, error) {
+	return g.files.UploadPart(ctx, upload, number, r, size, contentMD5)
+}
+
+// ListParts 列出分段上传已接收的段
+func (g *S3Gateway) ListParts(ctx context.Context, upload *MultipartUpload) ([]MultipartPart, error) {
+	return g.files.ListParts(ctx, upload.ID)
+}
+
+// CompleteMultipartUpload 完成分段上传并创建对象
+func (g *S3Gateway) CompleteMultipartUpload(ctx context.Context, upload *MultipartUpload, parts []CompletedPart) (*model.File, error) {
+	return g.files.CompleteMultipartUpload(ctx, upload, parts)
+}
+
+// AbortMultipartUpload 终止分段上传
+func (g *S3Gateway) AbortMultipartUpload(ctx context.Context, upload *MultipartUpload) error {
+	return g.files.AbortMultipartUpload(ctx, upload.ID)
+}
@@ -0,0 +1,106 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	"github.com/sealock/core-storage/model"
+	"github.com/sealock/core-storage/storage"
+)
+
+// ErrS3KeyNotFound S3 访问密钥不存在或不属于当前用户
+var ErrS3KeyNotFound = errors.New("s3 access key not found")
+
+// s3AccessKeyPrefix 访问密钥 ID 的前缀，便于在日志和配置中辨认
+const s3AccessKeyPrefix = "SLAK"
+
+// S3KeyService 管理 S3 网关的访问密钥
+// 每个密钥由 access key ID 和 secret key 组成，客户端用 secret key 按 SigV4 签名请求，
+// 服务端用同一个 secret key 重新计算签名校验；secret key 加密保存，只在创建时返回一次
+type S3KeyService struct {
+	repo      storage.S3KeyRepository
+	secretKey []byte // 加密保存 secret key 的密钥，为 nil 时明文保存
+}
+
+// NewS3KeyService 创建 S3 访问密钥服务
+func NewS3KeyService(repo storage.S3KeyRepository) *S3KeyService {
+	return &S3KeyService{repo: repo}
+}
+
+// SetSecretKey 设置加密保存 secret key 的密钥，经 SHA-256 派生为 AES-256 密钥
+// 更换密钥后已保存的 secret key 无法解密，对应的访问密钥需要重新创建
+func (s *S3KeyService) SetSecretKey(key []byte) {
+	s.secretKey = deriveSecretKey(key)
+}
+
+// CreateKey 为用户创建访问密钥，返回保存的记录和明文 secret key
+func (s *S3KeyService) CreateKey(ctx context.Context, userID uint, description string) (*model.S3AccessKey, string, error) {
+	id := make([]byte, 10)
+	secret := make([]byte, 30)
+	if _, err := rand.Read(id); err != nil {
+		return nil, "", fmt.Errorf("failed to generate access key: %w", err)
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return nil, "", fmt.Errorf("failed to generate secret key: %w", err)
+	}
+	secretKey := base64.StdEncoding.EncodeToString(secret)
+	sealed, err := sealSecret(s.secretKey, secretKey)
+	if err != nil {
+		return nil, "", err
+	}
+
+	key := &model.S3AccessKey{
+		AccessKeyID: s3AccessKeyPrefix + base32.StdEncoding.EncodeToString(id),
+		SecretKey:   sealed,
+		UserID:      userID,
+		Description: description,
+	}
+	if err := s.repo.CreateKey(ctx, key); err != nil {
+		return nil, "", fmt.Errorf("failed to save access key: %w", err)
+	}
+	return key, secretKey, nil
+}
+
+// ListKeys 列出用户的访问密钥（不含 secret key）
+func (s *S3KeyService) ListKeys(ctx context.Context, userID uint) ([]model.S3AccessKey, error) {
+	keys, err := s.repo.ListKeys(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list access keys: %w", err)
+	}
+	for i := range keys {
+		keys[i].SecretKey = ""
+	}
+	return keys, nil
+}
+
+// DeleteKey 删除用户的访问密钥，之后用它签名的请求（包括已生成的预签名 URL）都被拒绝
+func (s *S3KeyService) DeleteKey(ctx context.Context, userID uint, accessKeyID string) error {
+	deleted, err := s.repo.DeleteKey(ctx, userID, accessKeyID)
+	if err != nil {
+		return fmt.Errorf("failed to delete access key: %w", err)
+	}
+	if !deleted {
+		return ErrS3KeyNotFound
+	}
+	return nil
+}
+
+// Lookup 返回访问密钥所属的用户和明文 secret key，不存在时返回 ErrS3KeyNotFound
+func (s *S3KeyService) Lookup(ctx context.Context, accessKeyID string) (uint, string, error) {
+	key, err := s.repo.GetKey(ctx, accessKeyID)
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to get access key: %w", err)
+	}
+	if key == nil {
+		return 0, "", ErrS3KeyNotFound
+	}
+	secret, err := openSecret(s.secretKey, key.SecretKey)
+	if err != nil {
+		return 0, "", err
+	}
+	return key.UserID, secret, nil
+}
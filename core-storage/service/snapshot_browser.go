@@ -0,0 +1,327 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sealock/core-storage/model"
+	"github.com/sealock/core-storage/storage"
+)
+
+var (
+	// ErrSnapshotNotFound 快照不存在
+	ErrSnapshotNotFound = errors.New("snapshot not found")
+	// ErrPathNotFound 快照中不存在该路径
+	ErrPathNotFound = errors.New("path not found in snapshot")
+)
+
+// SnapshotBrowser 快照浏览服务：提供历史版本的只读访问
+// 可列出任意快照的目录树、流式读取其中的文件，或把快照作为只读文件系统挂载
+type SnapshotBrowser struct {
+	snapshotRepo storage.SnapshotRepository
+	blockStore   storage.BlockStore
+}
+
+// NewSnapshotBrowser 创建快照浏览服务
+func NewSnapshotBrowser(sr storage.SnapshotRepository, bs storage.BlockStore) *SnapshotBrowser {
+	return &SnapshotBrowser{
+		snapshotRepo: sr,
+		blockStore:   bs,
+	}
+}
+
+// ResolveSnapshot 根据数字 ID 或 UUID 查找快照
+func (b *SnapshotBrowser) ResolveSnapshot(ctx context.Context, ref string) (*model.Snapshot, error) {
+	return resolveSnapshot(ctx, b.snapshotRepo, ref)
+}
+
+// resolveSnapshot 根据数字 ID 或 UUID 查找快照，不存在时返回 ErrSnapshotNotFound
+func resolveSnapshot(ctx context.Context, sr storage.SnapshotRepository, ref string) (*model.Snapshot, error) {
+	var snapshot *model.Snapshot
+	var err error
+	if id, parseErr := strconv.ParseUint(ref, 10, 64); parseErr == nil {
+		snapshot, err = sr.GetSnapshotByID(ctx, uint(id))
+	} else {
+		snapshot, err = sr.GetSnapshotByUUID(ctx, ref)
+	}
+	if err != nil || snapshot == nil {
+		return nil, ErrSnapshotNotFound
+	}
+	return snapshot, nil
+}
+
+// ListDir 列出快照中某个目录的直接子项，dir 为空表示根目录
+// 目录条目的 Size 为其下所有文件大小之和
+func (b *SnapshotBrowser) ListDir(ctx context.Context, snapshotID uint, dir string) ([]model.DirectoryEntry, error) {
+	files, err := b.snapshotRepo.ListSnapshotFiles(ctx, snapshotID, 0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list snapshot files: %w", err)
+	}
+	return listDirectory(files, dir)
+}
+
+// OpenFile 打开快照中的文件，返回可随机访问的读取器和文件记录
+func (b *SnapshotBrowser) OpenFile(ctx context.Context, snapshotID uint, filePath string) (*BlockReader, *model.SnapshotFile, error) {
+	files, err := b.snapshotRepo.ListSnapshotFiles(ctx, snapshotID, 0, 0)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list snapshot files: %w", err)
+	}
+
+	target := cleanPath(filePath)
+	for i := range files {
+		if cleanPath(files[i].FileName) == target {
+			reader, err := b.newReader(ctx, &files[i])
+			if err != nil {
+				return nil, nil, err
+			}
+			return reader, &files[i], nil
+		}
+	}
+	return nil, nil, ErrPathNotFound
+}
+
+// FS 将快照挂载为只读文件系统（io/fs.FS）
+// 可直接交给 http.FS、fs.WalkDir 等标准库工具使用，无需回滚即可取回旧版本目录
+func (b *SnapshotBrowser) FS(ctx context.Context, snapshotID uint) (fs.FS, error) {
+	snapshot, err := b.snapshotRepo.GetSnapshotByID(ctx, snapshotID)
+	if err != nil || snapshot == nil {
+		return nil, ErrSnapshotNotFound
+	}
+	files, err := b.snapshotRepo.ListSnapshotFiles(ctx, snapshotID, 0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list snapshot files: %w", err)
+	}
+
+	sfs := &snapshotFS{
+		ctx:     ctx,
+		browser: b,
+		modTime: snapshot.CreatedAt,
+		files:   make(map[string]*model.SnapshotFile, len(files)),
+		dirs:    map[string]bool{".": true},
+	}
+	for i := range files {
+		name := cleanPath(files[i].FileName)
+		if name == "" {
+			continue
+		}
+		sfs.files[name] = &files[i]
+		for dir := path.Dir(name); dir != "."; dir = path.Dir(dir) {
+			sfs.dirs[dir] = true
+		}
+	}
+	sfs.all = files
+	return sfs, nil
+}
+
+// newReader 为快照文件创建块读取器
+func (b *SnapshotBrowser) newReader(ctx context.Context, file *model.SnapshotFile) (*BlockReader, error) {
+	var blockHashes []string
+	if len(file.BlockIDs) > 0 {
+		if err := json.Unmarshal(file.BlockIDs, &blockHashes); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal block IDs: %w", err)
+		}
+	}
+	return NewBlockReader(ctx, b.blockStore, blockHashes, file.Size), nil
+}
+
+// ============ 目录树辅助函数 ============
+
+// cleanPath 规范化库内路径：去掉首尾斜杠，根目录为空字符串
+func cleanPath(p string) string {
+	return strings.Trim(path.Clean("/"+p), "/")
+}
+
+// listDirectory 根据扁平的文件路径列表计算某个目录的直接子项
+func listDirectory(files []model.SnapshotFile, dir string) ([]model.DirectoryEntry, error) {
+	dir = cleanPath(dir)
+	prefix := ""
+	if dir != "" {
+		prefix = dir + "/"
+	}
+
+	found := dir == ""
+	dirs := make(map[string]*model.DirectoryEntry)
+	var entries []model.DirectoryEntry
+	for _, file := range files {
+		name := cleanPath(file.FileName)
+		if name == dir && dir != "" {
+			return nil, fmt.Errorf("%s is a file", dir)
+		}
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		found = true
+		rest := strings.TrimPrefix(name, prefix)
+		if i := strings.Index(rest, "/"); i >= 0 {
+			child := rest[:i]
+			entry, exists := dirs[child]
+			if !exists {
+				entry = &model.DirectoryEntry{Name: child, IsDir: true}
+				dirs[child] = entry
+			}
+			entry.Size += file.Size
+			continue
+		}
+		entries = append(entries, model.DirectoryEntry{
+			Name: rest,
+			Hash: file.FileHash,
+			Size: file.Size,
+		})
+	}
+	if !found {
+		return nil, ErrPathNotFound
+	}
+
+	for _, entry := range dirs {
+		entries = append(entries, *entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].IsDir != entries[j].IsDir {
+			return entries[i].IsDir
+		}
+		return entries[i].Name < entries[j].Name
+	})
+	return entries, nil
+}
+
+// ============ 只读文件系统视图 ============
+
+// snapshotFS 快照的只读文件系统视图
+type snapshotFS struct {
+	ctx     context.Context
+	browser *SnapshotBrowser
+	modTime time.Time
+	all     []model.SnapshotFile
+	files   map[string]*model.SnapshotFile
+	dirs    map[string]bool
+}
+
+// Open 实现 fs.FS
+func (s *snapshotFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+
+	if file, exists := s.files[name]; exists {
+		reader, err := s.browser.newReader(s.ctx, file)
+		if err != nil {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+		return &snapshotFile{
+			BlockReader: reader,
+			info:        fileInfo{name: path.Base(name), size: file.Size, modTime: s.modTime},
+		}, nil
+	}
+
+	if s.dirs[name] {
+		dir := name
+		if dir == "." {
+			dir = ""
+		}
+		entries, err := listDirectory(s.all, dir)
+		if err != nil {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+		return &snapshotDir{
+			info:    fileInfo{name: path.Base(name), dir: true, modTime: s.modTime},
+			entries: entries,
+			modTime: s.modTime,
+		}, nil
+	}
+
+	return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+}
+
+// snapshotFile 快照中的文件句柄
+type snapshotFile struct {
+	*BlockReader
+	info fileInfo
+}
+
+func (f *snapshotFile) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+// snapshotDir 快照中的目录句柄
+type snapshotDir struct {
+	info    fileInfo
+	entries []model.DirectoryEntry
+	modTime time.Time
+	offset  int
+}
+
+func (d *snapshotDir) Stat() (fs.FileInfo, error) {
+	return d.info, nil
+}
+
+func (d *snapshotDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.name, Err: errors.New("is a directory")}
+}
+
+func (d *snapshotDir) Close() error {
+	return nil
+}
+
+// ReadDir 实现 fs.ReadDirFile
+func (d *snapshotDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	remaining := d.entries[d.offset:]
+	if n > 0 {
+		if len(remaining) == 0 {
+			return nil, io.EOF
+		}
+		if n < len(remaining) {
+			remaining = remaining[:n]
+		}
+	}
+
+	result := make([]fs.DirEntry, len(remaining))
+	for i, entry := range remaining {
+		result[i] = fs.FileInfoToDirEntry(fileInfo{
+			name:    entry.Name,
+			size:    entry.Size,
+			dir:     entry.IsDir,
+			modTime: d.modTime,
+		})
+	}
+	d.offset += len(remaining)
+	return result, nil
+}
+
+// fileInfo 实现 fs.FileInfo
+type fileInfo struct {
+	name    string
+	size    int64
+	dir     bool
+	modTime time.Time
+}
+
+func (fi fileInfo) Name() string { return fi.name }
+
+func (fi fileInfo) Size() int64 {
+	if fi.dir {
+		return 0
+	}
+	return fi.size
+}
+
+func (fi fileInfo) Mode() fs.FileMode {
+	if fi.dir {
+		return fs.ModeDir | 0o555
+	}
+	return 0o444
+}
+
+func (fi fileInfo) ModTime() time.Time { return fi.modTime }
+
+func (fi fileInfo) IsDir() bool { return fi.dir }
+
+func (fi fileInfo) Sys() any { return nil }
@@ -3,66 +3,93 @@ package service
 import (
 	"context"
 	"crypto/sha256"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"sort"
+	"strconv"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/sealock/core-storage/model"
 	"github.com/sealock/core-storage/storage"
+	"gorm.io/gorm"
 )
 
+// ErrNoChanges 当前状态与最新提交相同，无需生成新提交
+var ErrNoChanges = errors.New("无变化: 当前状态与最新提交相同")
+
 // SnapshotService 快照服务，处理版本控制相关业务逻辑
 type SnapshotService struct {
 	SnapshotRepo storage.SnapshotRepository
 	FileRepo     storage.FileRepository
+	BlockRepo    storage.BlockRepository
+
+	events *EventBus
+	tx     storage.Transactor
 }
 
 // NewSnapshotService 创建快照服务实例
-func NewSnapshotService(snapshotRepo storage.SnapshotRepository, fileRepo storage.FileRepository) *SnapshotService {
+func NewSnapshotService(snapshotRepo storage.SnapshotRepository, fileRepo storage.FileRepository, blockRepo storage.BlockRepository) *SnapshotService {
 	return &SnapshotService{
 		SnapshotRepo: snapshotRepo,
 		FileRepo:     fileRepo,
+		BlockRepo:    blockRepo,
 	}
 }
 
+// SetEventBus 设置接收提交事件的事件总线，nil 表示不发布事件
+func (s *SnapshotService) SetEventBus(events *EventBus) {
+	s.events = events
+}
+
+// SetTransactor 设置数据库事务，快照及其文件清单和块引用在同一事务中写入；nil 表示不使用事务
+func (s *SnapshotService) SetTransactor(tx storage.Transactor) {
+	s.tx = tx
+}
+
 // CreateCommit 创建新的版本提交
 // 当用户修改文件夹内容并点击保存时，递归扫描目录生成Merkle Tree哈希
 // 对比上一个Commit的Root Hash，无变化则不生成新记录
 // 整个操作在数据库事务中完成，保证原子性
 func (s *SnapshotService) CreateCommit(ctx context.Context, repoID string, userID string) (*model.Commit, error) {
-	// 1. 获取当前仓库的所有文件
-	files, err := s.FileRepo.GetAllFiles(ctx)
+	libraryID, err := parseLibraryID(repoID)
 	if err != nil {
-		return nil, fmt.Errorf("获取文件列表失败: %w", err)
+		return nil, err
 	}
 
-	// 2. 计算所有文件的Merkle根哈希
-	var allHashes []byte
-	for _, file := range files {
-		allHashes = append(allHashes, []byte(file.Hash)...) // 追加每个文件的哈希
+	// 1. 获取当前仓库的所有文件
+	files, err := s.libraryFiles(ctx, libraryID)
+	if err != nil {
+		return nil, err
 	}
 
-	// 计算父目录哈希
-	h := sha256.Sum256(allHashes)
-	currentRootTreeHash := fmt.Sprintf("%x", h)
+	// 2. 计算所有文件的Merkle根哈希
+	currentRootTreeHash := rootTreeHash(files)
 
 	// 3. 获取上一个Commit记录
-	lastCommit, err := s.getLastCommit(ctx, repoID)
+	lastCommit, err := s.getLastCommit(ctx, libraryID)
 	if err != nil {
 		return nil, fmt.Errorf("获取最新提交记录失败: %w", err)
 	}
 
 	// 4. 对比Root Tree Hash，无变化则跳过
 	if lastCommit != nil && lastCommit.RootTreeHash == currentRootTreeHash {
-		return nil, fmt.Errorf("无变化: 当前状态与最新提交相同")
+		return nil, ErrNoChanges
 	}
 
 	// 5. 创建新Commit记录
 	commitUUID := uuid.New().String()
+	var parentCommitHash *string
+	var parentID *uint
+	if lastCommit != nil {
+		parentCommitHash = &lastCommit.CommitHash
+		parentID = &lastCommit.ID
+	}
 	newCommit := &model.Commit{
-		RepoID:           1, // 简化实现，实际应根据repoID确定
+		RepoID:           libraryID,
 		CommitHash:       commitUUID,
-		ParentCommitHash: nil, // 简化实现
+		ParentCommitHash: parentCommitHash,
 		RootTreeHash:     currentRootTreeHash,
 		Author:           userID,
 		Message:          "Auto commit",
@@ -72,25 +99,168 @@ func (s *SnapshotService) CreateCommit(ctx context.Context, repoID string, userI
 	// 6. 转换为Snapshot并保存
 	snapshot := &model.Snapshot{
 		UUID:        newCommit.CommitHash,
+		LibraryID:   libraryID,
 		Name:        newCommit.RootTreeHash,
 		Description: newCommit.Message,
+		ParentID:    parentID,
 		RootHash:    newCommit.RootTreeHash,
 		CreatedAt:   newCommit.CreatedAt,
 	}
 
-	err = s.SnapshotRepo.CreateSnapshot(ctx, snapshot)
-	if err != nil {
+	if err := s.saveSnapshot(ctx, snapshot, files); err != nil {
 		return nil, fmt.Errorf("创建提交记录失败: %w", err)
 	}
 
 	return newCommit, nil
 }
 
+// CreateNamedSnapshot 为库的当前状态创建一个命名快照
+// 与自动提交不同，即使内容与最新提交相同也会生成新快照；tag 非空时保留策略可据此永久保留
+func (s *SnapshotService) CreateNamedSnapshot(ctx context.Context, libraryID uint, name, description, tag string) (*model.Snapshot, error) {
+	files, err := s.libraryFiles(ctx, libraryID)
+	if err != nil {
+		return nil, err
+	}
+	lastCommit, err := s.getLastCommit(ctx, libraryID)
+	if err != nil {
+		return nil, fmt.Errorf("获取最新提交记录失败: %w", err)
+	}
+
+	rootHash := rootTreeHash(files)
+	if name == "" {
+		name = rootHash
+	}
+	snapshot := &model.Snapshot{
+		UUID:        uuid.New().String(),
+		LibraryID:   libraryID,
+		Name:        name,
+		Description: description,
+		Tag:         tag,
+		RootHash:    rootHash,
+		CreatedAt:   time.Now(),
+	}
+	if lastCommit != nil {
+		snapshot.ParentID = &lastCommit.ID
+	}
+	if err := s.saveSnapshot(ctx, snapshot, files); err != nil {
+		return nil, fmt.Errorf("创建快照失败: %w", err)
+	}
+	return snapshot, nil
+}
+
+// libraryFiles 获取库中的所有文件，按路径排序
+func (s *SnapshotService) libraryFiles(ctx context.Context, libraryID uint) ([]model.File, error) {
+	files, err := s.FileRepo.ListFilesByLibrary(ctx, libraryID)
+	if err != nil {
+		return nil, fmt.Errorf("获取文件列表失败: %w", err)
+	}
+	return files, nil
+}
+
+// rootTreeHash 计算文件列表的根哈希
+// 按路径排序后对每个 (路径, 内容哈希) 计算，重命名或移动文件同样改变根哈希
+func rootTreeHash(files []model.File) string {
+	entries := make([]string, 0, len(files))
+	for _, file := range files {
+		// 路径中不会出现 NUL，以它分隔路径和哈希
+		entries = append(entries, cleanPath(file.Name)+"\x00"+file.Hash+"\n")
+	}
+	sort.Strings(entries)
+	h := sha256.New()
+	for _, entry := range entries {
+		h.Write([]byte(entry))
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+// saveSnapshot 保存快照及其文件清单
+// 快照对其引用的每个块持有一次引用计数，保证源文件删除后历史版本仍可还原；
+// 快照被保留策略清理时再释放这些引用（见 RetentionService）
+func (s *SnapshotService) saveSnapshot(ctx context.Context, snapshot *model.Snapshot, files []model.File) error {
+	snapshot.FileCount = len(files)
+	snapshot.Size = 0
+	for _, file := range files {
+		snapshot.Size += file.Size
+	}
+
+	err := inTransaction(ctx, s.tx, func(ctx context.Context) error {
+		if err := s.SnapshotRepo.CreateSnapshot(ctx, snapshot); err != nil {
+			return err
+		}
+		for _, file := range files {
+			snapshotFile := &model.SnapshotFile{
+				SnapshotID: snapshot.ID,
+				FileID:     file.ID,
+				FileName:   file.Name,
+				FileHash:   file.Hash,
+				Size:       file.Size,
+				BlockIDs:   file.BlockIDs,
+			}
+			if err := s.SnapshotRepo.CreateSnapshotFile(ctx, snapshotFile); err != nil {
+				return fmt.Errorf("failed to create snapshot file: %w", err)
+			}
+
+			var blockHashes []string
+			if len(file.BlockIDs) > 0 {
+				if err := json.Unmarshal(file.BlockIDs, &blockHashes); err != nil {
+					return fmt.Errorf("failed to unmarshal block IDs: %w", err)
+				}
+			}
+			for _, blockHash := range blockHashes {
+				if err := retainBlock(ctx, s.BlockRepo, blockHash, 0); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	s.events.Publish(Event{
+		LibraryID: snapshot.LibraryID,
+		Type:      EventCommitCreated,
+		Hash:      snapshot.RootHash,
+		CommitID:  snapshot.UUID,
+	})
+	return nil
+}
+
+// inTransaction 在数据库事务中执行 fn，tx 为 nil 时直接执行
+func inTransaction(ctx context.Context, tx storage.Transactor, fn func(ctx context.Context) error) error {
+	if tx == nil {
+		return fn(ctx)
+	}
+	return tx.InTransaction(ctx, fn)
+}
+
+// retainBlock 为块增加一次引用，块元数据不存在时先创建
+func retainBlock(ctx context.Context, br storage.BlockRepository, hash string, size int64) error {
+	if err := br.SaveBlockMetadata(ctx, &model.Block{Hash: hash, Size: size}); err != nil {
+		return fmt.Errorf("failed to save block metadata %s: %w", hash, err)
+	}
+	if err := br.IncrementRefCount(ctx, hash, 1); err != nil {
+		return fmt.Errorf("failed to retain block %s: %w", hash, err)
+	}
+	return nil
+}
+
+// parseLibraryID 将字符串形式的仓库ID解析为库ID，空字符串表示默认库 0
+func parseLibraryID(repoID string) (uint, error) {
+	if repoID == "" {
+		return 0, nil
+	}
+	id, err := strconv.ParseUint(repoID, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("无效的仓库ID %q: %w", repoID, err)
+	}
+	return uint(id), nil
+}
+
 // getLastCommit 获取指定仓库的最新提交记录
-func (s *SnapshotService) getLastCommit(ctx context.Context, _ string) (*model.Commit, error) {
-	// 简化实现：获取最新的Commit
-	// 在实际应用中，应该根据repoID查询最新Commit
-	snapshots, err := s.SnapshotRepo.ListSnapshots(ctx, 1, 0)
+func (s *SnapshotService) getLastCommit(ctx context.Context, libraryID uint) (*model.Commit, error) {
+	snapshots, err := s.SnapshotRepo.ListSnapshotsByLibrary(ctx, libraryID)
 	if err != nil {
 		return nil, err
 	}
@@ -99,49 +269,79 @@ func (s *SnapshotService) getLastCommit(ctx context.Context, _ string) (*model.C
 		return nil, nil
 	}
 
-	// 假设第一个是最新提交
-	latestSnapshot := snapshots[0]
-	// 尝试转换为Commit结构
-	commit := &model.Commit{
-		CommitHash:   latestSnapshot.UUID,
-		RootTreeHash: latestSnapshot.Name, // 假设Name存储了RootTreeHash
-		CreatedAt:    latestSnapshot.CreatedAt,
-	}
-
-	return commit, nil
+	// 列表按创建时间倒序，第一个即最新提交
+	return snapshotCommit(snapshots[0], ""), nil
 }
 
-// GetCommitHistory 获取提交历史记录
-func (s *SnapshotService) GetCommitHistory(ctx context.Context, repoID string, limit int) ([]*model.Commit, error) {
-	// 获取快照列表
-	snapshots, err := s.SnapshotRepo.ListSnapshots(ctx, limit, 0)
+// GetCommitHistory 分页获取库的提交历史，最新的在前
+// 返回本页的提交和提交总数
+func (s *SnapshotService) GetCommitHistory(ctx context.Context, repoID string, limit, offset int) ([]*model.Commit, int, error) {
+	libraryID, err := parseLibraryID(repoID)
 	if err != nil {
-		return nil, fmt.Errorf("获取快照列表失败: %w", err)
+		return nil, 0, err
+	}
+	page, total, err := s.ListLibrarySnapshots(ctx, libraryID, limit, offset)
+	if err != nil {
+		return nil, 0, err
 	}
 
-	// 转换为Commit列表
-	var commits []*model.Commit
-	for _, snapshot := range snapshots {
-		commit := &model.Commit{
-			CommitHash:   snapshot.UUID,
-			RootTreeHash: snapshot.Name,
-			CreatedAt:    snapshot.CreatedAt,
+	// 父提交可能不在当前页，不在页内的父快照单独查询
+	uuids := make(map[uint]string, len(page))
+	for _, snapshot := range page {
+		uuids[snapshot.ID] = snapshot.UUID
+	}
+	commits := make([]*model.Commit, 0, len(page))
+	for _, snapshot := range page {
+		var parentHash string
+		if snapshot.ParentID != nil {
+			parentHash = s.snapshotUUID(ctx, uuids, *snapshot.ParentID)
 		}
-		commits = append(commits, commit)
+		commits = append(commits, snapshotCommit(snapshot, parentHash))
 	}
+	return commits, total, nil
+}
 
-	return commits, nil
+// snapshotUUID 返回快照的 UUID 并缓存到 uuids，快照已被清理时为空
+func (s *SnapshotService) snapshotUUID(ctx context.Context, uuids map[uint]string, id uint) string {
+	if uuid, ok := uuids[id]; ok {
+		return uuid
+	}
+	var uuid string
+	if snapshot, err := s.SnapshotRepo.GetSnapshotByID(ctx, id); err == nil && snapshot != nil {
+		uuid = snapshot.UUID
+	}
+	uuids[id] = uuid
+	return uuid
 }
 
-// RevertToCommit 回滚到指定提交
-func (s *SnapshotService) RevertToCommit(ctx context.Context, commitID string) error {
-	// 获取指定Commit
-	_, err := s.SnapshotRepo.GetSnapshotByUUID(ctx, commitID)
+// ListLibrarySnapshots 分页列出库的快照，最新的在前，limit 不大于 0 表示不限制
+// 返回本页的快照和快照总数
+func (s *SnapshotService) ListLibrarySnapshots(ctx context.Context, libraryID uint, limit, offset int) ([]model.Snapshot, int, error) {
+	if offset < 0 {
+		offset = 0
+	}
+	snapshots, total, err := s.SnapshotRepo.PageSnapshotsByLibrary(ctx, libraryID, limit, offset)
 	if err != nil {
-		return fmt.Errorf("获取提交记录失败: %w", err)
+		return nil, 0, fmt.Errorf("获取快照列表失败: %w", err)
+	}
+	if snapshots == nil {
+		snapshots = []model.Snapshot{}
 	}
+	return snapshots, int(total), nil
+}
 
-	// 在事务中执行回滚
-	// 简化实现：直接返回，实际应更新文件系统状态
-	return nil
+// snapshotCommit 将快照转换为提交记录，parentHash 为空表示没有父提交或未知
+func snapshotCommit(snapshot model.Snapshot, parentHash string) *model.Commit {
+	commit := &model.Commit{
+		Model:        gorm.Model{ID: snapshot.ID},
+		RepoID:       snapshot.LibraryID,
+		CommitHash:   snapshot.UUID,
+		RootTreeHash: snapshot.RootHash,
+		Message:      snapshot.Description,
+		CreatedAt:    snapshot.CreatedAt,
+	}
+	if parentHash != "" {
+		commit.ParentCommitHash = &parentHash
+	}
+	return commit
 }
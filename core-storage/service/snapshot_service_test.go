@@ -0,0 +1,55 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/sealock/core-storage/model"
+	"github.com/sealock/core-storage/storage"
+)
+
+func TestRootTreeHashIncludesPaths(t *testing.T) {
+	a := []model.File{{Name: "a.txt", Hash: "h1"}, {Name: "b.txt", Hash: "h2"}}
+	swapped := []model.File{{Name: "a.txt", Hash: "h2"}, {Name: "b.txt", Hash: "h1"}}
+	renamed := []model.File{{Name: "docs/a.txt", Hash: "h1"}, {Name: "b.txt", Hash: "h2"}}
+	reordered := []model.File{{Name: "b.txt", Hash: "h2"}, {Name: "a.txt", Hash: "h1"}}
+
+	root := rootTreeHash(a)
+	if rootTreeHash(swapped) == root || rootTreeHash(renamed) == root {
+		t.Fatal("root hash ignores file paths")
+	}
+	if rootTreeHash(reordered) != root {
+		t.Fatal("root hash depends on listing order")
+	}
+}
+
+func TestCreateCommitRecordsRename(t *testing.T) {
+	ctx := context.Background()
+	files := storage.NewMockFileRepository()
+	snapshots := NewSnapshotService(storage.NewMockSnapshotRepository(), files, storage.NewMockBlockRepository())
+
+	file := &model.File{Name: "a.txt", Hash: "h1", LibraryID: 1}
+	if err := files.CreateFile(ctx, file); err != nil {
+		t.Fatalf("create file: %v", err)
+	}
+	if _, err := snapshots.CreateCommit(ctx, "1", "tester"); err != nil {
+		t.Fatalf("first commit: %v", err)
+	}
+	if _, err := snapshots.CreateCommit(ctx, "1", "tester"); !errors.Is(err, ErrNoChanges) {
+		t.Fatalf("unchanged commit: err = %v, want ErrNoChanges", err)
+	}
+
+	// 只移动文件、内容不变，也要生成新提交
+	file.Name = "docs/a.txt"
+	if err := files.UpdateFile(ctx, file); err != nil {
+		t.Fatalf("rename file: %v", err)
+	}
+	commit, err := snapshots.CreateCommit(ctx, "1", "tester")
+	if err != nil {
+		t.Fatalf("commit after rename: %v", err)
+	}
+	if commit == nil {
+		t.Fatal("rename was not committed")
+	}
+}
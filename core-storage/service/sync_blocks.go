@@ -0,0 +1,96 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrBlockNotFound 块不存在，或不在调用方可以读取的范围内
+var ErrBlockNotFound = errors.New("block not found")
+
+// BlockScope 同步请求可以使用的块范围
+// 与秒传一样，块哈希不是读取凭证：只有被调用方可读的库引用的块，或调用方自己上传过的块，才算服务端"已有"
+type BlockScope struct {
+	UserID    uint   // 调用方，为 0 时不计入上传记录
+	Libraries []uint // 调用方可以读取的库
+}
+
+// blockUploads 记录用户通过同步接口上传过的块
+// 上传时已校验内容哈希，证明用户持有块的数据；记录保留到块可能被回收为止，之后需要重新上传
+type blockUploads struct {
+	mu    sync.Mutex
+	users map[uint]*userBlockUploads
+}
+
+// userBlockUploads 单个用户上传过的块及其上传时间
+type userBlockUploads struct {
+	hashes  map[string]time.Time
+	pruneAt int // 记录数达到该值时清理过期记录
+}
+
+// newBlockUploads 创建空的上传记录
+func newBlockUploads() *blockUploads {
+	return &blockUploads{users: make(map[uint]*userBlockUploads)}
+}
+
+// record 记录用户上传了块
+func (u *blockUploads) record(userID uint, hash string) {
+	if userID == 0 {
+		return
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	uploads, ok := u.users[userID]
+	if !ok {
+		uploads = &userBlockUploads{hashes: make(map[string]time.Time), pruneAt: 1024}
+		u.users[userID] = uploads
+	}
+	now := time.Now()
+	uploads.hashes[hash] = now
+	if len(uploads.hashes) >= uploads.pruneAt {
+		for h, at := range uploads.hashes {
+			if now.Sub(at) > DefaultBlockGracePeriod {
+				delete(uploads.hashes, h)
+			}
+		}
+		uploads.pruneAt = 2 * len(uploads.hashes)
+		if uploads.pruneAt < 1024 {
+			uploads.pruneAt = 1024
+		}
+	}
+}
+
+// uploaded 返回 hashes 中用户上传过且记录未过期的块
+func (u *blockUploads) uploaded(userID uint, hashes []string) map[string]bool {
+	found := make(map[string]bool)
+	if userID == 0 {
+		return found
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	uploads, ok := u.users[userID]
+	if !ok {
+		return found
+	}
+	now := time.Now()
+	for _, hash := range hashes {
+		if at, ok := uploads.hashes[hash]; ok && now.Sub(at) <= DefaultBlockGracePeriod {
+			found[hash] = true
+		}
+	}
+	return found
+}
+
+// readableBlocks 返回 hashes 中调用方可以使用的块：被可读库的文件引用，或由调用方上传过
+func (s *SyncService) readableBlocks(ctx context.Context, scope BlockScope, hashes []string) (map[string]bool, error) {
+	readable, err := s.fileRepository.FindBlocksInLibraries(ctx, scope.Libraries, hashes)
+	if err != nil {
+		return nil, err
+	}
+	for hash := range s.uploads.uploaded(scope.UserID, hashes) {
+		readable[hash] = true
+	}
+	return readable, nil
+}
@@ -0,0 +1,55 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/sealock/core-storage/model"
+	"github.com/sealock/core-storage/storage"
+)
+
+func TestSyncBlocksScopedToReadableLibraries(t *testing.T) {
+	ctx := context.Background()
+	files := storage.NewMockFileRepository()
+	blockStore := storage.NewLocalBlockStore()
+	syncService := NewSyncService(files, blockStore, storage.NewMockBlockRepository(), storage.NewMockConflictRepository(), nil)
+
+	// 库 1 的文件引用了一个块
+	data := []byte("secret")
+	hash, err := blockStore.Put(ctx, data)
+	if err != nil {
+		t.Fatalf("put block: %v", err)
+	}
+	blockIDs, _ := json.Marshal([]string{hash})
+	if err := files.CreateFile(ctx, &model.File{LibraryID: 1, Name: "a.txt", Hash: hash, Size: 6, BlockIDs: blockIDs}); err != nil {
+		t.Fatalf("create file: %v", err)
+	}
+
+	owner := BlockScope{UserID: 1, Libraries: []uint{1}}
+	other := BlockScope{UserID: 2, Libraries: []uint{2}}
+
+	if missing, err := syncService.MissingBlocks(ctx, owner, []string{hash}); err != nil || len(missing) != 0 {
+		t.Fatalf("owner missing = %v, %v, want none", missing, err)
+	}
+	if _, err := syncService.GetBlock(ctx, owner, hash); err != nil {
+		t.Fatalf("owner get block: %v", err)
+	}
+
+	// 其他用户只知道哈希时既看不到块存在，也读不到数据
+	if missing, err := syncService.MissingBlocks(ctx, other, []string{hash}); err != nil || len(missing) != 1 {
+		t.Fatalf("other missing = %v, %v, want the block", missing, err)
+	}
+	if _, err := syncService.GetBlock(ctx, other, hash); !errors.Is(err, ErrBlockNotFound) {
+		t.Fatalf("other get block: error = %v, want ErrBlockNotFound", err)
+	}
+
+	// 上传过数据之后可以使用该块
+	if err := syncService.ReceiveBlock(ctx, other.UserID, hash, data); err != nil {
+		t.Fatalf("receive block: %v", err)
+	}
+	if missing, err := syncService.MissingBlocks(ctx, other, []string{hash}); err != nil || len(missing) != 0 {
+		t.Fatalf("missing after upload = %v, %v, want none", missing, err)
+	}
+}
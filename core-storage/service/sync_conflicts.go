@@ -0,0 +1,322 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/sealock/core-storage/model"
+)
+
+var (
+	// ErrConflictNotFound 冲突记录不存在
+	ErrConflictNotFound = errors.New("conflict not found")
+	// ErrConflictResolved 冲突已经处理过
+	ErrConflictResolved = errors.New("conflict already resolved")
+	// ErrInvalidConflictPolicy 不支持的冲突策略
+	ErrInvalidConflictPolicy = errors.New("invalid conflict policy")
+	// ErrInvalidResolution 不支持的冲突处理方式
+	ErrInvalidResolution = errors.New("invalid conflict resolution")
+)
+
+// ConflictPolicy 返回库的冲突策略，未配置时返回默认策略
+func (s *SyncService) ConflictPolicy(ctx context.Context, libraryID uint) (model.ConflictPolicy, error) {
+	if s.conflictRepo == nil {
+		return model.DefaultConflictPolicy, nil
+	}
+	settings, err := s.conflictRepo.GetSettings(ctx, libraryID)
+	if err != nil {
+		return "", fmt.Errorf("failed to load sync settings: %w", err)
+	}
+	if settings == nil || !model.ConflictPolicy(settings.ConflictPolicy).Valid() {
+		return model.DefaultConflictPolicy, nil
+	}
+	return model.ConflictPolicy(settings.ConflictPolicy), nil
+}
+
+// SetConflictPolicy 设置库的冲突策略
+func (s *SyncService) SetConflictPolicy(ctx context.Context, libraryID uint, policy model.ConflictPolicy) error {
+	if !policy.Valid() {
+		return ErrInvalidConflictPolicy
+	}
+	if s.conflictRepo == nil {
+		return errors.New("conflict repository not configured")
+	}
+	settings, err := s.conflictRepo.GetSettings(ctx, libraryID)
+	if err != nil {
+		return fmt.Errorf("failed to load sync settings: %w", err)
+	}
+	if settings == nil {
+		settings = &model.SyncSettings{LibraryID: libraryID}
+	}
+	settings.ConflictPolicy = string(policy)
+	if err := s.conflictRepo.SaveSettings(ctx, settings); err != nil {
+		return fmt.Errorf("failed to save sync settings: %w", err)
+	}
+	return nil
+}
+
+// ListConflicts 列出库的冲突记录，status 为空时返回全部
+func (s *SyncService) ListConflicts(ctx context.Context, libraryID uint, status string) ([]model.SyncConflict, error) {
+	if s.conflictRepo == nil {
+		return []model.SyncConflict{}, nil
+	}
+	conflicts, err := s.conflictRepo.ListConflicts(ctx, libraryID, status)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list conflicts: %w", err)
+	}
+	return conflicts, nil
+}
+
+// GetConflict 读取冲突记录，不存在时返回 ErrConflictNotFound
+func (s *SyncService) GetConflict(ctx context.Context, conflictID uint) (*model.SyncConflict, error) {
+	if s.conflictRepo == nil {
+		return nil, ErrConflictNotFound
+	}
+	conflict, err := s.conflictRepo.GetConflict(ctx, conflictID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load conflict: %w", err)
+	}
+	if conflict == nil {
+		return nil, ErrConflictNotFound
+	}
+	return conflict, nil
+}
+
+// ResolveConflict 手动处理一个挂起的冲突
+// resolution 为 server（保留服务端版本）、client（采用客户端版本）或 keep_both（客户端版本另存为冲突副本）
+func (s *SyncService) ResolveConflict(ctx context.Context, conflictID uint, resolution string) (*model.SyncConflict, error) {
+	if s.conflictRepo == nil {
+		return nil, ErrConflictNotFound
+	}
+	switch resolution {
+	case model.ResolutionServer, model.ResolutionClient, model.ResolutionKeepBoth:
+	default:
+		return nil, ErrInvalidResolution
+	}
+
+	conflict, err := s.GetConflict(ctx, conflictID)
+	if err != nil {
+		return nil, err
+	}
+
+	lock := s.libraryLock(conflict.LibraryID)
+	lock.Lock()
+	defer lock.Unlock()
+	defer s.flushEvents(conflict.LibraryID)
+	if err := checkWritable(ctx, s.replication, conflict.LibraryID); err != nil {
+		return nil, err
+	}
+
+	// 重新读取，避免并发处理同一冲突
+	if conflict, err = s.conflictRepo.GetConflict(ctx, conflictID); err != nil || conflict == nil {
+		return nil, ErrConflictNotFound
+	}
+	if conflict.Status != model.ConflictStatusOpen {
+		return nil, ErrConflictResolved
+	}
+
+	tree, err := s.LoadLibraryTree(ctx, conflict.LibraryID, nil)
+	if err != nil {
+		return nil, err
+	}
+	var clientBlocks []string
+	if len(conflict.ClientBlockIDs) > 0 {
+		if err := json.Unmarshal(conflict.ClientBlockIDs, &clientBlocks); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal block IDs: %w", err)
+		}
+	}
+	clientFile := SyncFile{Hash: conflict.ClientHash, Size: conflict.ClientSize, Blocks: clientBlocks}
+	deleted := conflict.ClientHash == ""
+
+	// 文件写入、冲突记录持有的块引用的释放和冲突状态的更新在同一事务中完成
+	changed := false
+	err = inTransaction(ctx, s.tx, func(ctx context.Context) error {
+		switch {
+		case resolution == model.ResolutionClient && deleted:
+			if existing := tree.Files[conflict.Path]; existing != nil {
+				if err := s.removeFile(ctx, existing); err != nil {
+					return err
+				}
+				changed = true
+			}
+		case resolution == model.ResolutionClient:
+			if err := s.writeFile(ctx, conflict.LibraryID, tree, conflict.Path, clientFile, map[string]int64{}); err != nil {
+				return err
+			}
+			changed = true
+		case resolution == model.ResolutionKeepBoth && !deleted:
+			conflict.CopyPath = conflictCopyPath(tree, conflict.Path, conflict.ClientID, conflict.CreatedAt)
+			if err := s.writeFile(ctx, conflict.LibraryID, tree, conflict.CopyPath, clientFile, map[string]int64{}); err != nil {
+				return err
+			}
+			changed = true
+		}
+
+		// 冲突记录持有的块引用已转移给文件（或不再需要）
+		for _, hash := range clientBlocks {
+			if err := s.blockRepo.DecrementBlockRefCount(ctx, hash); err != nil {
+				return fmt.Errorf("failed to release block %s: %w", hash, err)
+			}
+		}
+
+		now := time.Now()
+		conflict.Status = model.ConflictStatusResolved
+		conflict.Resolution = resolution
+		conflict.ResolvedAt = &now
+		if err := s.conflictRepo.UpdateConflict(ctx, conflict); err != nil {
+			return fmt.Errorf("failed to update conflict: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		s.discardEvents(conflict.LibraryID)
+		return nil, err
+	}
+	if changed {
+		s.notifyCommit(conflict.LibraryID)
+	}
+	return conflict, nil
+}
+
+// resolvePushConflict 按库的冲突策略处理一次提交中的修改冲突，返回处理结果和实际写入的文件数
+func (s *SyncService) resolvePushConflict(ctx context.Context, libraryID uint, tree *LibraryTree, clientID, base string, file SyncFile, blockSizes map[string]int64) (*SyncConflictResult, int, error) {
+	policy, err := s.ConflictPolicy(ctx, libraryID)
+	if err != nil {
+		return nil, 0, err
+	}
+	if policy == model.ConflictManual && s.conflictRepo == nil {
+		policy = model.ConflictKeepBoth
+	}
+
+	filePath := cleanPath(file.Path)
+	existing := tree.Files[filePath]
+	conflict := &model.SyncConflict{
+		LibraryID:     libraryID,
+		Path:          filePath,
+		BaseHash:      base,
+		ServerHash:    existing.Hash,
+		ClientHash:    file.Hash,
+		ClientSize:    file.Size,
+		ClientModTime: file.ModTime,
+		ClientID:      clientID,
+		Policy:        string(policy),
+		Status:        model.ConflictStatusResolved,
+	}
+
+	updated := 0
+	switch policy {
+	case model.ConflictKeepBoth:
+		conflict.Resolution = model.ResolutionKeepBoth
+		conflict.CopyPath = conflictCopyPath(tree, filePath, clientID, time.Now())
+		if err := s.writeFile(ctx, libraryID, tree, conflict.CopyPath, file, blockSizes); err != nil {
+			return nil, 0, err
+		}
+		updated++
+	case model.ConflictNewestWins:
+		conflict.Resolution = model.ResolutionServer
+		if file.ModTime.After(existing.UpdatedAt) {
+			conflict.Resolution = model.ResolutionClient
+			if err := s.writeFile(ctx, libraryID, tree, filePath, file, blockSizes); err != nil {
+				return nil, 0, err
+			}
+			updated++
+		}
+	case model.ConflictServerWins:
+		conflict.Resolution = model.ResolutionServer
+	case model.ConflictManual:
+		// 客户端版本的块由冲突记录持有，直到用户处理
+		for _, hash := range file.Blocks {
+			if err := retainBlock(ctx, s.blockRepo, hash, blockSizes[hash]); err != nil {
+				return nil, 0, err
+			}
+		}
+		blockIDs, err := json.Marshal(file.Blocks)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to marshal block hashes: %w", err)
+		}
+		conflict.ClientBlockIDs = blockIDs
+		conflict.Status = model.ConflictStatusOpen
+	}
+
+	if err := s.saveConflict(ctx, conflict); err != nil {
+		return nil, 0, err
+	}
+	return conflictResult(conflict), updated, nil
+}
+
+// recordDeleteConflict 记录删除冲突：客户端删除了服务端已修改的文件，服务端版本始终保留
+// manual 策略下记录为待处理，用户可选择仍然删除
+func (s *SyncService) recordDeleteConflict(ctx context.Context, libraryID uint, clientID, base string, existing *model.File) (*SyncConflictResult, error) {
+	policy, err := s.ConflictPolicy(ctx, libraryID)
+	if err != nil {
+		return nil, err
+	}
+	conflict := &model.SyncConflict{
+		LibraryID:  libraryID,
+		Path:       cleanPath(existing.Name),
+		BaseHash:   base,
+		ServerHash: existing.Hash,
+		ClientID:   clientID,
+		Policy:     string(policy),
+		Status:     model.ConflictStatusResolved,
+		Resolution: model.ResolutionServer,
+	}
+	if policy == model.ConflictManual {
+		conflict.Status = model.ConflictStatusOpen
+		conflict.Resolution = ""
+	}
+
+	if err := s.saveConflict(ctx, conflict); err != nil {
+		return nil, err
+	}
+	return conflictResult(conflict), nil
+}
+
+// saveConflict 保存冲突记录（未配置仓库时跳过）
+func (s *SyncService) saveConflict(ctx context.Context, conflict *model.SyncConflict) error {
+	if conflict.Status == model.ConflictStatusResolved {
+		now := time.Now()
+		conflict.ResolvedAt = &now
+	}
+	if s.conflictRepo == nil {
+		return nil
+	}
+	if err := s.conflictRepo.CreateConflict(ctx, conflict); err != nil {
+		return fmt.Errorf("failed to record conflict: %w", err)
+	}
+	return nil
+}
+
+// conflictResult 把冲突记录转换为提交响应中的条目
+func conflictResult(conflict *model.SyncConflict) *SyncConflictResult {
+	return &SyncConflictResult{
+		ID:         conflict.ID,
+		Path:       conflict.Path,
+		Status:     conflict.Status,
+		Resolution: conflict.Resolution,
+		CopyPath:   conflict.CopyPath,
+	}
+}
+
+// conflictCopyPath 生成库中尚不存在的冲突副本路径
+// 如 "docs/report (conflict laptop 2026-01-02 150405).txt"
+func conflictCopyPath(tree *LibraryTree, filePath, clientID string, at time.Time) string {
+	ext := path.Ext(filePath)
+	stem := strings.TrimSuffix(filePath, ext)
+	label := "conflict"
+	if clientID != "" {
+		label += " " + clientID
+	}
+	label += " " + at.Format("2006-01-02 150405")
+
+	candidate := fmt.Sprintf("%s (%s)%s", stem, label, ext)
+	for i := 2; tree.Files[candidate] != nil; i++ {
+		candidate = fmt.Sprintf("%s (%s %d)%s", stem, label, i, ext)
+	}
+	return candidate
+}
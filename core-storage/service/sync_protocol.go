@@ -0,0 +1,619 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/sealock/core-storage/chunker"
+	"github.com/sealock/core-storage/ignore"
+	"github.com/sealock/core-storage/model"
+	"github.com/sealock/core-storage/syncproto"
+)
+
+// ============ 增量同步协议 ============
+// 协议流程：
+//  1. 客户端上报根哈希和各目录哈希（SyncDiffRequest），服务端返回哈希不一致的子树（SyncDiffResponse）
+//  2. 客户端据此下载缺少的块，或通过 MissingBlocks 询问服务端缺少哪些块并上传
+//  3. 客户端提交变更（SyncPushRequest），每个文件附带共同祖先哈希（BaseHash），
+//     服务端据此区分普通更新和冲突，冲突按库的冲突策略处理（见 sync_conflicts.go）
+
+// MissingBlocksError 提交的文件引用了服务端不存在的块
+type MissingBlocksError struct {
+	Hashes []string
+}
+
+func (e *MissingBlocksError) Error() string {
+	return fmt.Sprintf("%d referenced blocks are missing on server", len(e.Hashes))
+}
+
+// 同步协议的消息类型与客户端共用，定义在 syncproto 包中
+type (
+	SyncEntry          = syncproto.SyncEntry
+	SyncSubtree        = syncproto.SyncSubtree
+	SyncDiffRequest    = syncproto.SyncDiffRequest
+	SyncDiffResponse   = syncproto.SyncDiffResponse
+	SyncFile           = syncproto.SyncFile
+	SyncDeletion       = syncproto.SyncDeletion
+	SyncPushRequest    = syncproto.SyncPushRequest
+	SyncConflictResult = syncproto.SyncConflictResult
+	SyncPushResponse   = syncproto.SyncPushResponse
+)
+
+// LibraryTree 库的目录树及哈希索引
+type LibraryTree struct {
+	Root    string                           // 根哈希
+	Entries []model.DirectoryEntry           // 根目录的子项
+	Dirs    map[string]*model.DirectoryEntry // 目录路径 → 目录条目（不含根目录）
+	Files   map[string]*model.File           // 文件路径 → 文件
+}
+
+// LoadLibraryTree 读取库的当前文件并构建目录树
+// filter 不为 nil 时被排除的文件不进入目录树，目录哈希只覆盖参与同步的文件
+func (s *SyncService) LoadLibraryTree(ctx context.Context, libraryID uint, filter *ignore.Filter) (*LibraryTree, error) {
+	all, err := s.fileRepository.ListFilesByLibrary(ctx, libraryID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list library files: %w", err)
+	}
+	files := all[:0]
+	for _, file := range all {
+		if !filter.Excluded(cleanPath(file.Name)) {
+			files = append(files, file)
+		}
+	}
+
+	tree := &LibraryTree{
+		Entries: syncproto.BuildTree(treeFiles(files)),
+		Dirs:    make(map[string]*model.DirectoryEntry),
+		Files:   make(map[string]*model.File, len(files)),
+	}
+	tree.Root = s.BuildDirectoryMerkleTree(tree.Entries)
+	for i := range files {
+		tree.Files[cleanPath(files[i].Name)] = &files[i]
+	}
+
+	var index func(prefix string, children []model.DirectoryEntry)
+	index = func(prefix string, children []model.DirectoryEntry) {
+		for i := range children {
+			if !children[i].IsDir {
+				continue
+			}
+			dirPath := path.Join(prefix, children[i].Name)
+			tree.Dirs[dirPath] = &children[i]
+			index(dirPath, syncproto.Entries(children[i].Children))
+		}
+	}
+	index("", tree.Entries)
+	return tree, nil
+}
+
+// Diff 对比客户端上报的目录哈希，返回服务端与之不一致的子树
+// 只下钻哈希不同的目录，哈希相同的子树整棵跳过
+func (s *SyncService) Diff(ctx context.Context, libraryID uint, req *SyncDiffRequest) (*SyncDiffResponse, error) {
+	filter, err := s.SyncFilter(ctx, libraryID, req.Ignore, req.Include)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := s.LoadLibraryTree(ctx, libraryID, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &SyncDiffResponse{Root: tree.Root, Subtrees: []SyncSubtree{}}
+	if req.Root == tree.Root {
+		resp.UpToDate = true
+		return resp, nil
+	}
+
+	var visit func(dirPath, hash string, children []model.DirectoryEntry) error
+	visit = func(dirPath, hash string, children []model.DirectoryEntry) error {
+		subtree := SyncSubtree{Path: dirPath, Hash: hash, Entries: make([]SyncEntry, 0, len(children))}
+		for _, child := range children {
+			childPath := path.Join(dirPath, child.Name)
+			entry := SyncEntry{Name: child.Name, Hash: child.Hash, Size: child.Size}
+			if child.IsDir {
+				entry.Type = "dir"
+			} else {
+				entry.Type = "file"
+				blocks, err := fileBlockHashes(tree.Files[childPath])
+				if err != nil {
+					return err
+				}
+				entry.Blocks = blocks
+			}
+			subtree.Entries = append(subtree.Entries, entry)
+		}
+		resp.Subtrees = append(resp.Subtrees, subtree)
+
+		for _, child := range children {
+			childPath := path.Join(dirPath, child.Name)
+			if child.IsDir && req.Trees[childPath] != child.Hash {
+				if err := visit(childPath, child.Hash, syncproto.Entries(child.Children)); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+
+	if err := visit("", tree.Root, tree.Entries); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// LibraryIgnore 读取库根目录下的忽略文件（.sealockignore），不存在时返回空规则
+func (s *SyncService) LibraryIgnore(ctx context.Context, libraryID uint) (*ignore.Matcher, error) {
+	file, err := s.fileRepository.GetFileByPath(ctx, libraryID, ignore.FileName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load ignore file: %w", err)
+	}
+	if file == nil {
+		return ignore.ParseLines(nil), nil
+	}
+
+	blocks, err := fileBlockHashes(file)
+	if err != nil {
+		return nil, err
+	}
+	reader := NewBlockReader(ctx, s.blockStore, blocks, file.Size)
+	defer reader.Close()
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ignore file: %w", err)
+	}
+	return ignore.Parse(data), nil
+}
+
+// SyncFilter 组合库的忽略规则、客户端的忽略规则和选择性同步的子树
+// 客户端规则排在库规则之后，可以用 ! 重新包含被库规则忽略的文件
+func (s *SyncService) SyncFilter(ctx context.Context, libraryID uint, clientIgnore, include []string) (*ignore.Filter, error) {
+	rules, err := s.LibraryIgnore(ctx, libraryID)
+	if err != nil {
+		return nil, err
+	}
+	return ignore.NewFilter(ignore.Merge(rules, ignore.ParseLines(clientIgnore)), include), nil
+}
+
+// MissingBlocks 返回给定块中调用方需要上传的部分
+// 只有在 scope 内的块才算服务端已有，不在范围内的块即使存在也要求上传，不透露其他库中有哪些块
+func (s *SyncService) MissingBlocks(ctx context.Context, scope BlockScope, hashes []string) ([]string, error) {
+	readable, err := s.readableBlocks(ctx, scope, uniqueHashes(hashes))
+	if err != nil {
+		return nil, err
+	}
+	missing := []string{}
+	seen := make(map[string]bool, len(hashes))
+	for _, hash := range hashes {
+		if seen[hash] {
+			continue
+		}
+		seen[hash] = true
+		if !readable[hash] {
+			missing = append(missing, hash)
+			continue
+		}
+		exists, err := s.blockStore.Exists(ctx, hash)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check block %s: %w", hash, err)
+		}
+		if !exists {
+			missing = append(missing, hash)
+		}
+	}
+	return missing, nil
+}
+
+// ReceiveBlock 校验并保存用户通过同步接口上传的块，并记录该用户持有这个块
+func (s *SyncService) ReceiveBlock(ctx context.Context, userID uint, hash string, data []byte) error {
+	if err := s.PutBlock(ctx, hash, data); err != nil {
+		return err
+	}
+	s.uploads.record(userID, hash)
+	return nil
+}
+
+// PutBlock 校验并保存块
+// 块在被某个提交引用前引用计数为 0
+func (s *SyncService) PutBlock(ctx context.Context, hash string, data []byte) error {
+	sum := sha256.Sum256(data)
+	if hex.EncodeToString(sum[:]) != hash {
+		return fmt.Errorf("block hash mismatch: expected %s", hash)
+	}
+	if _, err := s.blockStore.Put(ctx, data); err != nil {
+		return fmt.Errorf("failed to store block: %w", err)
+	}
+	if err := s.blockRepo.SaveBlockMetadata(ctx, &model.Block{Hash: hash, Size: int64(len(data))}); err != nil {
+		return fmt.Errorf("failed to save block metadata: %w", err)
+	}
+	return nil
+}
+
+// GetBlock 读取 scope 内的块数据，不在范围内的块返回 ErrBlockNotFound
+func (s *SyncService) GetBlock(ctx context.Context, scope BlockScope, hash string) ([]byte, error) {
+	readable, err := s.readableBlocks(ctx, scope, []string{hash})
+	if err != nil {
+		return nil, err
+	}
+	if !readable[hash] {
+		return nil, ErrBlockNotFound
+	}
+	return s.blockStore.Get(ctx, hash)
+}
+
+// ApplyChanges 应用客户端提交的变更
+// 每个路径以客户端提供的 BaseHash 为共同祖先做三方对比：服务端版本仍是祖先时直接应用，
+// 两端都改成不同内容时按库的冲突策略处理；
+// 所有引用的块必须在 scope 内（被调用方可读的库引用或由调用方上传过），否则返回 *MissingBlocksError 且不做任何修改
+func (s *SyncService) ApplyChanges(ctx context.Context, scope BlockScope, libraryID uint, req *SyncPushRequest) (*SyncPushResponse, error) {
+	lock := s.libraryLock(libraryID)
+	lock.Lock()
+	defer lock.Unlock()
+	defer s.flushEvents(libraryID)
+	if err := checkWritable(ctx, s.replication, libraryID); err != nil {
+		return nil, err
+	}
+
+	tree, err := s.LoadLibraryTree(ctx, libraryID, nil)
+	if err != nil {
+		return nil, err
+	}
+	rules, err := s.LibraryIgnore(ctx, libraryID)
+	if err != nil {
+		return nil, err
+	}
+
+	// 1. 校验：块齐全且在调用方的范围内、文件哈希与块列表一致
+	var referenced []string
+	for _, file := range req.Files {
+		referenced = append(referenced, file.Blocks...)
+	}
+	readable, err := s.readableBlocks(ctx, scope, uniqueHashes(referenced))
+	if err != nil {
+		return nil, err
+	}
+	blockSizes := make(map[string]int64)
+	var missing []string
+	for _, file := range req.Files {
+		if cleanPath(file.Path) == "" {
+			return nil, fmt.Errorf("invalid file path %q", file.Path)
+		}
+		fileHash, err := chunker.ComputeFileMerkleHash(file.Blocks)
+		if err != nil {
+			return nil, err
+		}
+		if fileHash != file.Hash {
+			return nil, fmt.Errorf("file %s hash does not match its block list", file.Path)
+		}
+		var total int64
+		for _, hash := range file.Blocks {
+			size, known := blockSizes[hash]
+			if !known {
+				if !readable[hash] {
+					missing = append(missing, hash)
+					blockSizes[hash] = -1
+					continue
+				}
+				size, err = s.blockStore.GetSize(ctx, hash)
+				if err != nil {
+					missing = append(missing, hash)
+					blockSizes[hash] = -1
+					continue
+				}
+				blockSizes[hash] = size
+			}
+			total += size
+		}
+		if len(missing) == 0 && total != file.Size {
+			return nil, fmt.Errorf("file %s size mismatch: blocks add up to %d, got %d", file.Path, total, file.Size)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, &MissingBlocksError{Hashes: missing}
+	}
+
+	// 本次提交修改了忽略文件时按新规则过滤，避免同一次提交中新包含的文件被旧规则拒收
+	for _, file := range req.Files {
+		if cleanPath(file.Path) != ignore.FileName {
+			continue
+		}
+		reader := NewBlockReader(ctx, s.blockStore, file.Blocks, file.Size)
+		data, err := io.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read ignore file: %w", err)
+		}
+		rules = ignore.Parse(data)
+	}
+	for _, deletion := range req.Deleted {
+		if cleanPath(deletion.Path) == ignore.FileName {
+			rules = ignore.ParseLines(nil)
+		}
+	}
+
+	// 客户端基于服务端当前状态提交时不可能冲突，以服务端版本作为祖先（兼容不带 BaseHash 的客户端）
+	upToDate := req.BaseRoot != "" && req.BaseRoot == tree.Root
+	baseHash := func(filePath, claimed string) string {
+		if upToDate {
+			return currentHash(tree, filePath)
+		}
+		return claimed
+	}
+
+	// 2. 写入变更
+	resp := &SyncPushResponse{Ignored: []string{}, Conflicts: []SyncConflictResult{}}
+	// 所有写入在同一事务中完成：中途失败时库保持推送前的状态
+	err = inTransaction(ctx, s.tx, func(ctx context.Context) error {
+		for _, file := range req.Files {
+			filePath := cleanPath(file.Path)
+			if filePath != ignore.FileName && rules.Ignored(filePath, false) {
+				resp.Ignored = append(resp.Ignored, filePath)
+				continue
+			}
+			existing := tree.Files[filePath]
+			base := baseHash(filePath, file.BaseHash)
+
+			switch syncproto.ClassifyChange(base, file.Hash, currentHash(tree, filePath)) {
+			case syncproto.ChangeLocal:
+				if err := s.writeFile(ctx, libraryID, tree, filePath, file, blockSizes); err != nil {
+					return err
+				}
+				resp.Updated++
+			case syncproto.ChangeConflict:
+				if existing == nil {
+					// 服务端删除、客户端修改：保留修改
+					if err := s.writeFile(ctx, libraryID, tree, filePath, file, blockSizes); err != nil {
+						return err
+					}
+					resp.Updated++
+					continue
+				}
+				result, updated, err := s.resolvePushConflict(ctx, libraryID, tree, req.ClientID, base, file, blockSizes)
+				if err != nil {
+					return err
+				}
+				resp.Conflicts = append(resp.Conflicts, *result)
+				resp.Updated += updated
+			}
+		}
+
+		for _, deletion := range req.Deleted {
+			filePath := cleanPath(deletion.Path)
+			existing := tree.Files[filePath]
+			if existing == nil {
+				continue
+			}
+			base := baseHash(filePath, deletion.BaseHash)
+
+			switch syncproto.ClassifyChange(base, "", existing.Hash) {
+			case syncproto.ChangeLocal:
+				if err := s.removeFile(ctx, existing); err != nil {
+					return err
+				}
+				delete(tree.Files, filePath)
+				resp.Deleted++
+			case syncproto.ChangeConflict:
+				// 服务端修改、客户端删除：保留服务端版本
+				result, err := s.recordDeleteConflict(ctx, libraryID, req.ClientID, base, existing)
+				if err != nil {
+					return err
+				}
+				resp.Conflicts = append(resp.Conflicts, *result)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		s.discardEvents(libraryID)
+		return nil, err
+	}
+
+	// 3. 返回新的根哈希并登记自动提交
+	newTree, err := s.LoadLibraryTree(ctx, libraryID, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp.Root = newTree.Root
+	if resp.Updated > 0 || resp.Deleted > 0 {
+		s.notifyCommit(libraryID)
+	}
+	return resp, nil
+}
+
+// writeFile 在库中新建或覆盖文件：引用新块、释放旧块，并更新 tree 中的索引
+func (s *SyncService) writeFile(ctx context.Context, libraryID uint, tree *LibraryTree, filePath string, file SyncFile, blockSizes map[string]int64) error {
+	for _, hash := range file.Blocks {
+		size, known := blockSizes[hash]
+		if !known {
+			var err error
+			if size, err = s.blockStore.GetSize(ctx, hash); err != nil {
+				return fmt.Errorf("failed to read block %s: %w", hash, err)
+			}
+		}
+		if err := retainBlock(ctx, s.blockRepo, hash, size); err != nil {
+			return err
+		}
+	}
+	blockIDs, err := json.Marshal(file.Blocks)
+	if err != nil {
+		return fmt.Errorf("failed to marshal block hashes: %w", err)
+	}
+
+	if existing := tree.Files[filePath]; existing != nil {
+		if err := s.releaseFileBlocks(ctx, existing); err != nil {
+			return err
+		}
+		existing.Hash = file.Hash
+		existing.Size = file.Size
+		existing.BlockIDs = blockIDs
+		if err := s.fileRepository.UpdateFile(ctx, existing); err != nil {
+			return fmt.Errorf("failed to update file %s: %w", filePath, err)
+		}
+		s.recordEvent(Event{LibraryID: libraryID, Type: EventFileUpdated, Path: filePath, Hash: file.Hash, Size: file.Size})
+		return nil
+	}
+
+	newFile := &model.File{
+		UUID:      uuid.New().String(),
+		Name:      filePath,
+		Size:      file.Size,
+		Hash:      file.Hash,
+		BlockIDs:  blockIDs,
+		LibraryID: libraryID,
+	}
+	if err := s.fileRepository.CreateFile(ctx, newFile); err != nil {
+		return fmt.Errorf("failed to create file %s: %w", filePath, err)
+	}
+	tree.Files[filePath] = newFile
+	s.recordEvent(Event{LibraryID: libraryID, Type: EventFileCreated, Path: filePath, Hash: file.Hash, Size: file.Size})
+	return nil
+}
+
+// removeFile 删除文件并释放其块
+func (s *SyncService) removeFile(ctx context.Context, file *model.File) error {
+	if err := s.releaseFileBlocks(ctx, file); err != nil {
+		return err
+	}
+	if err := s.fileRepository.DeleteFile(ctx, file.ID); err != nil {
+		return fmt.Errorf("failed to delete file %s: %w", file.Name, err)
+	}
+	s.recordEvent(Event{LibraryID: file.LibraryID, Type: EventFileDeleted, Path: cleanPath(file.Name), Hash: file.Hash, Size: file.Size})
+	return nil
+}
+
+// checkout 把库的当前文件更新为提交的目录树，用于复制和快照包导入
+// 不通知自动提交调度器：提交本身已随快照导入，否则会生成一个内容相同的新提交
+func (s *SyncService) checkout(ctx context.Context, libraryID uint, files []BundleFile, blockSizes map[string]int64) error {
+	lock := s.libraryLock(libraryID)
+	lock.Lock()
+	defer lock.Unlock()
+	defer s.flushEvents(libraryID)
+
+	err := inTransaction(ctx, s.tx, func(ctx context.Context) error {
+		return s.checkoutFiles(ctx, libraryID, files, blockSizes)
+	})
+	if err != nil {
+		s.discardEvents(libraryID)
+	}
+	return err
+}
+
+// checkoutFiles 执行 checkout 的写入，调用方持有库的写锁并负责事务
+func (s *SyncService) checkoutFiles(ctx context.Context, libraryID uint, files []BundleFile, blockSizes map[string]int64) error {
+	tree, err := s.LoadLibraryTree(ctx, libraryID, nil)
+	if err != nil {
+		return err
+	}
+	wanted := make(map[string]bool, len(files))
+	for _, file := range files {
+		filePath := cleanPath(file.Path)
+		if filePath == "" {
+			return fmt.Errorf("invalid file path %q", file.Path)
+		}
+		wanted[filePath] = true
+		if currentHash(tree, filePath) == file.Hash {
+			continue
+		}
+		syncFile := SyncFile{Path: filePath, Hash: file.Hash, Size: file.Size, Blocks: file.Blocks}
+		if err := s.writeFile(ctx, libraryID, tree, filePath, syncFile, blockSizes); err != nil {
+			return err
+		}
+	}
+	for filePath, file := range tree.Files {
+		if wanted[filePath] {
+			continue
+		}
+		if err := s.removeFile(ctx, file); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// notifyCommit 登记自动提交
+func (s *SyncService) notifyCommit(libraryID uint) {
+	if s.commitScheduler != nil {
+		s.commitScheduler.Notify(libraryID, "")
+	}
+}
+
+// recordEvent 暂存一次文件变更事件，在本次变更结束时由 flushEvents 统一发布
+func (s *SyncService) recordEvent(event Event) {
+	if s.events == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pendingEvents[event.LibraryID] = append(s.pendingEvents[event.LibraryID], event)
+}
+
+// discardEvents 丢弃库暂存的文件事件，用于变更被回滚时
+func (s *SyncService) discardEvents(libraryID uint) {
+	s.mu.Lock()
+	delete(s.pendingEvents, libraryID)
+	s.mu.Unlock()
+}
+
+// flushEvents 发布库暂存的文件事件，同一次变更中的删除+新建会合并为移动
+func (s *SyncService) flushEvents(libraryID uint) {
+	s.mu.Lock()
+	events := s.pendingEvents[libraryID]
+	delete(s.pendingEvents, libraryID)
+	s.mu.Unlock()
+	s.events.Publish(fileEvents(events)...)
+}
+
+// releaseFileBlocks 释放文件对其块的引用
+// 调用方在事务中执行，失败时返回错误，由事务回滚已释放的引用
+func (s *SyncService) releaseFileBlocks(ctx context.Context, file *model.File) error {
+	blocks, err := fileBlockHashes(file)
+	if err != nil {
+		return err
+	}
+	for _, hash := range blocks {
+		if err := s.blockRepo.DecrementBlockRefCount(ctx, hash); err != nil {
+			return fmt.Errorf("failed to release block %s of %s: %w", hash, file.Name, err)
+		}
+	}
+	return nil
+}
+
+// libraryLock 返回库的写锁，与文件服务等其他写入方共用
+func (s *SyncService) libraryLock(libraryID uint) *sync.Mutex {
+	return s.locks.Get(libraryID)
+}
+
+// currentHash 返回路径在服务端的当前哈希，不存在时为空
+func currentHash(tree *LibraryTree, filePath string) string {
+	if file := tree.Files[filePath]; file != nil {
+		return file.Hash
+	}
+	return ""
+}
+
+// fileBlockHashes 解析文件的块哈希列表
+func fileBlockHashes(file *model.File) ([]string, error) {
+	if file == nil || len(file.BlockIDs) == 0 {
+		return []string{}, nil
+	}
+	var blocks []string
+	if err := json.Unmarshal(file.BlockIDs, &blocks); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal block IDs: %w", err)
+	}
+	return blocks, nil
+}
+
+// treeFiles 转换为构建目录树所需的文件列表
+func treeFiles(files []model.File) []syncproto.File {
+	result := make([]syncproto.File, len(files))
+	for i, file := range files {
+		result[i] = syncproto.File{Path: file.Name, Hash: file.Hash, Size: file.Size}
+	}
+	return result
+}
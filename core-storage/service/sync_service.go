@@ -4,26 +4,69 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"sort"
-	"strconv"
+	"sync"
 
 	"github.com/sealock/core-storage/model"
 	"github.com/sealock/core-storage/storage"
+	"github.com/sealock/core-storage/syncproto"
 )
 
 // SyncService provides synchronization functionality using Merkle Tree comparison
 type SyncService struct {
-	fileRepository storage.FileRepository
-	blockStore     storage.BlockStore
+	fileRepository  storage.FileRepository
+	blockStore      storage.BlockStore
+	blockRepo       storage.BlockRepository
+	conflictRepo    storage.ConflictRepository
+	commitScheduler *CommitScheduler
+	events          *EventBus
+	locks           *LibraryLocks
+	tx              storage.Transactor
+	replication     *ReplicationService
+	uploads         *blockUploads
+
+	mu            sync.Mutex
+	pendingEvents map[uint][]Event
 }
 
 // NewSyncService creates a new synchronization service
-func NewSyncService(fileRepo storage.FileRepository, blockStore storage.BlockStore) *SyncService {
+// blockRepo, conflictRepo and commitScheduler are only needed when the service
+// accepts pushes from clients (ApplyChanges); conflictRepo and commitScheduler
+// may be nil, in which case conflicts use the default policy and are not recorded
+func NewSyncService(fileRepo storage.FileRepository, blockStore storage.BlockStore, blockRepo storage.BlockRepository, conflictRepo storage.ConflictRepository, commitScheduler *CommitScheduler) *SyncService {
 	return &SyncService{
-		fileRepository: fileRepo,
-		blockStore:     blockStore,
+		fileRepository:  fileRepo,
+		blockStore:      blockStore,
+		blockRepo:       blockRepo,
+		conflictRepo:    conflictRepo,
+		commitScheduler: commitScheduler,
+		locks:           NewLibraryLocks(),
+		uploads:         newBlockUploads(),
+		pendingEvents:   make(map[uint][]Event),
 	}
 }
 
+// SetEventBus sets the bus that receives file change events; nil disables events
+func (s *SyncService) SetEventBus(events *EventBus) {
+	s.events = events
+}
+
+// SetLibraryLocks sets the per-library write locks shared with the other writers of a library
+// (see FileService.LibraryLocks); by default the service uses locks of its own
+func (s *SyncService) SetLibraryLocks(locks *LibraryLocks) {
+	s.locks = locks
+}
+
+// SetTransactor sets the database transactions pushes are applied in; nil disables transactions
+func (s *SyncService) SetTransactor(tx storage.Transactor) {
+	s.tx = tx
+}
+
+// SetReplication sets the replication service used to reject writes to read-only replicas;
+// pushes, conflict resolutions and reverts then fail with ErrReadOnlyReplica
+func (s *SyncService) SetReplication(replication *ReplicationService) {
+	s.replication = replication
+}
+
 // BuildMerkleTree constructs a Merkle Tree for a given file list
 func (s *SyncService) BuildMerkleTree(files []model.File) string {
 	if len(files) == 0 {
@@ -45,54 +88,7 @@ func (s *SyncService) BuildMerkleTree(files []model.File) string {
 
 // BuildDirectoryMerkleTree 构建目录树的Merkle树，支持目录层次结构
 func (s *SyncService) BuildDirectoryMerkleTree(entries []model.DirectoryEntry) string {
-	if len(entries) == 0 {
-		emptyHash := sha256.Sum256([]byte{})
-		return hex.EncodeToString(emptyHash[:])
-	}
-
-	// 按名称排序确保一致性
-	sortedEntries := make([]model.DirectoryEntry, len(entries))
-	copy(sortedEntries, entries)
-	sort.Slice(sortedEntries, func(i, j int) bool {
-		return sortedEntries[i].Name < sortedEntries[j].Name
-	})
-
-	// 计算每个条目的哈希值
-	entryHashes := make([]string, len(sortedEntries))
-	for i, entry := range sortedEntries {
-		var contentHash string
-		if entry.IsDir && entry.Children != nil {
-			// 转换指针切片为值切片
-			children := make([]model.DirectoryEntry, len(entry.Children))
-			for j, child := range entry.Children {
-				children[j] = *child
-			}
-			contentHash = s.BuildDirectoryMerkleTree(children)
-		} else {
-			contentHash = entry.Hash
-		}
-
-		// 组合名称、类型和内容哈希
-		combined := entry.Name + strconv.FormatBool(entry.IsDir) + contentHash
-		h := sha256.Sum256([]byte(combined))
-		entryHashes[i] = hex.EncodeToString(h[:])
-	}
-
-	// 递归构建Merkle树
-	for len(entryHashes) > 1 {
-		if len(entryHashes)%2 == 1 {
-			entryHashes = append(entryHashes, entryHashes[len(entryHashes)-1])
-		}
-
-		var newLevel []string
-		for i := 0; i < len(entryHashes); i += 2 {
-			pairHash := sha256.Sum256([]byte(entryHashes[i] + entryHashes[i+1]))
-			newLevel = append(newLevel, hex.EncodeToString(pairHash[:]))
-		}
-		entryHashes = newLevel
-	}
-
-	return entryHashes[0]
+	return syncproto.MerkleRoot(entries)
 }
 
 // CompareMerkleTrees compares two Merkle roots and returns the differences
@@ -0,0 +1,321 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"github.com/sealock/core-storage/model"
+)
+
+var (
+	// ErrTusOffsetMismatch PATCH 的 Upload-Offset 与服务端已接收的字节数不一致
+	ErrTusOffsetMismatch = errors.New("tus upload offset mismatch")
+	// ErrTusChecksumMismatch 请求体的校验和与 Upload-Checksum 不一致，本次数据被丢弃
+	ErrTusChecksumMismatch = errors.New("tus checksum mismatch")
+	// ErrTusUploadTooLarge 写入的数据超过声明的 Upload-Length
+	ErrTusUploadTooLarge = errors.New("tus upload exceeds declared length")
+)
+
+// TusUpload 一个 tus 协议的上传
+// 数据按块存储的固定块大小切分后直接写入块存储，只有不足一块的尾部数据暂存在 Redis 中；
+// 全部字节到齐后转换为上传会话，按分片上传的同一流程校验并创建文件
+type TusUpload struct {
+	ID          string            `json:"id"`
+	LibraryID   uint              `json:"libraryId"`   // 目标库
+	FileName    string            `json:"fileName"`    // 库内目标路径
+	Length      int64             `json:"length"`      // Upload-Length
+	Offset      int64             `json:"offset"`      // 已接收的字节数（含尾部缓冲）
+	BlockHashes []string          `json:"blockHashes"` // 已写入块存储的完整块
+	Metadata    map[string]string `json:"metadata"`    // Upload-Metadata（已解码）
+	OwnerID     uint              `json:"ownerId"`     // 发起上传的用户，0 表示未认证
+	Reserved    int64             `json:"reserved"`    // 为本上传预留的配额（字节），完成或终止时释放
+	CreatedAt   time.Time         `json:"createdAt"`
+	ExpiresAt   time.Time         `json:"expiresAt"`
+	// FileHash 上传完成后创建的文件的内容哈希，未完成时为空；完成的上传保留到过期，供客户端 HEAD 确认
+	FileHash string `json:"fileHash,omitempty"`
+	// File 本次请求完成上传时创建的文件，其他情况为 nil
+	File *model.File `json:"-"`
+}
+
+// CreateTusUpload 创建 tus 上传
+// upload 需要填写目标库、路径和长度；按长度预留用户配额，超出时返回 ErrQuotaExceeded；
+// 长度为 0 的上传立即完成
+func (s *FileService) CreateTusUpload(ctx context.Context, upload *TusUpload) error {
+	upload.FileName = cleanPath(upload.FileName)
+	if upload.FileName == "" {
+		return fmt.Errorf("%w: empty file name", ErrInvalidUploadSession)
+	}
+	if upload.Length < 0 {
+		return fmt.Errorf("%w: negative upload length", ErrInvalidUploadSession)
+	}
+	if err := checkWritable(ctx, s.replication, upload.LibraryID); err != nil {
+		return err
+	}
+
+	reserved, err := s.reserveQuota(ctx, upload.OwnerID, upload.Length)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	upload.ID = uuid.New().String()
+	upload.Offset = 0
+	upload.BlockHashes = []string{}
+	upload.Reserved = reserved
+	upload.CreatedAt = now
+	upload.ExpiresAt = now.Add(DefaultUploadSessionTTL)
+	if err := s.saveTusUpload(ctx, upload); err != nil {
+		s.releaseQuota(ctx, upload.OwnerID, upload.Reserved)
+		return err
+	}
+	if err := s.indexUpload(ctx, "tus:"+upload.ID, upload.ExpiresAt); err != nil {
+		s.releaseQuota(ctx, upload.OwnerID, upload.Reserved)
+		return err
+	}
+
+	if upload.Length == 0 {
+		return s.finishTusUpload(ctx, upload, nil)
+	}
+	return nil
+}
+
+// GetTusUpload 读取 tus 上传，不存在或已过期时返回 nil
+func (s *FileService) GetTusUpload(ctx context.Context, id string) (*TusUpload, error) {
+	upload, err := s.loadTusUpload(ctx, id)
+	if err != nil || upload == nil || time.Now().After(upload.ExpiresAt) {
+		return nil, err
+	}
+	return upload, nil
+}
+
+// loadTusUpload 读取 tus 上传，包括已过期但尚未被清理的上传
+func (s *FileService) loadTusUpload(ctx context.Context, id string) (*TusUpload, error) {
+	data, err := s.redisClient.Get(ctx, tusUploadKey(id)).Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var upload TusUpload
+	if err := json.Unmarshal(data, &upload); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal tus upload: %w", err)
+	}
+	return &upload, nil
+}
+
+// WriteTusUpload 从 offset 处追加请求体中的数据，返回更新后的上传
+// checksum 不为 nil 时请求体的摘要必须等于 expected，否则返回 ErrTusChecksumMismatch 且不保存本次数据；
+// 没有校验和时读取中断（如连接断开）会保存已收到的部分，客户端可通过 HEAD 获取偏移量后续传。
+// 最后一个字节到达时创建文件，结果放在返回值的 File 中
+func (s *FileService) WriteTusUpload(ctx context.Context, id string, offset int64, body io.Reader, checksum hash.Hash, expected []byte) (*TusUpload, error) {
+	// 同一上传的写入串行执行，避免并发 PATCH 破坏偏移量
+	lock, _ := s.tusLocks.LoadOrStore(id, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	defer lock.(*sync.Mutex).Unlock()
+
+	upload, err := s.GetTusUpload(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if upload == nil {
+		return nil, nil
+	}
+	if offset != upload.Offset {
+		return nil, fmt.Errorf("%w: got %d, expected %d", ErrTusOffsetMismatch, offset, upload.Offset)
+	}
+
+	tail, err := s.redisClient.Get(ctx, tusTailKey(id)).Bytes()
+	if err != nil && err != redis.Nil {
+		return nil, fmt.Errorf("failed to read tus buffer: %w", err)
+	}
+
+	// 多读一个字节以发现超出声明长度的请求体
+	remaining := upload.Length - upload.Offset
+	reader := io.LimitReader(body, remaining+1)
+	if checksum != nil {
+		reader = io.TeeReader(reader, checksum)
+	}
+
+	blockSize := s.chunker.ChunkSize()
+	buf := bytes.NewBuffer(tail)
+	var hashes []string
+	// 本次写入的块只有保存到上传状态后才会被上传引用，其他情况（校验失败、超长、保存失败）立即尝试回收
+	recorded := false
+	defer func() {
+		if !recorded {
+			s.discardTusBlocks(ctx, id, hashes)
+		}
+	}()
+	var received int64
+	var readErr error
+	chunk := make([]byte, 32*1024)
+	for {
+		n, err := reader.Read(chunk)
+		received += int64(n)
+		if received > remaining {
+			return nil, fmt.Errorf("%w: %d bytes declared", ErrTusUploadTooLarge, upload.Length)
+		}
+		buf.Write(chunk[:n])
+		for buf.Len() >= blockSize {
+			// 复制一份，块存储可能持有数据，而缓冲区会被后续写入覆盖
+			block := append([]byte(nil), buf.Next(blockSize)...)
+			hash, err := s.StoreUploadChunk(ctx, block)
+			if err != nil {
+				return nil, err
+			}
+			hashes = append(hashes, hash)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			readErr = err
+			break
+		}
+	}
+
+	if checksum != nil && (readErr != nil || !bytes.Equal(checksum.Sum(nil), expected)) {
+		return nil, ErrTusChecksumMismatch
+	}
+
+	upload.Offset += received
+	upload.BlockHashes = append(upload.BlockHashes, hashes...)
+	if upload.FileHash != "" {
+		// 已完成的上传，没有可写入的数据
+		return upload, nil
+	}
+	if upload.Offset == upload.Length {
+		if err := s.finishTusUpload(ctx, upload, buf.Bytes()); err != nil {
+			return nil, err
+		}
+		recorded = true
+		return upload, nil
+	}
+	if err := s.redisClient.Set(ctx, tusTailKey(id), buf.Bytes(), time.Until(upload.ExpiresAt.Add(uploadKeyGrace))).Err(); err != nil {
+		return nil, fmt.Errorf("failed to save tus buffer: %w", err)
+	}
+	if err := s.saveTusUpload(ctx, upload); err != nil {
+		return nil, err
+	}
+	recorded = true
+	if readErr != nil {
+		return upload, fmt.Errorf("failed to read upload body: %w", readErr)
+	}
+	return upload, nil
+}
+
+// TerminateTusUpload 终止 tus 上传并删除其状态，释放配额预留，并回收只被它引用的块
+// 宽限期内写入的块不立即删除，由上传清理任务的全量扫描回收
+func (s *FileService) TerminateTusUpload(ctx context.Context, id string) error {
+	defer s.tusLocks.Delete(id)
+
+	upload, err := s.loadTusUpload(ctx, id)
+	if err != nil {
+		return err
+	}
+	claimed, err := s.unindexUpload(ctx, "tus:"+id)
+	if err != nil {
+		return err
+	}
+	if err := s.redisClient.Del(ctx, tusUploadKey(id), tusTailKey(id)).Err(); err != nil {
+		return err
+	}
+	if claimed && upload != nil {
+		s.releaseQuota(ctx, upload.OwnerID, upload.Reserved)
+		if upload.FileHash == "" {
+			if _, err := s.collectUploadBlocks(ctx, upload.BlockHashes); err != nil {
+				fmt.Printf("Warning: failed to collect blocks of tus upload %s: %v\n", id, err)
+			}
+		}
+	}
+	return nil
+}
+
+// discardTusBlocks 回收写入失败的 PATCH 已存入块存储的块
+// 宽限期内的块由垃圾回收器保留（可能正被其他上传使用），之后由上传清理任务的全量回收删除
+func (s *FileService) discardTusBlocks(ctx context.Context, id string, hashes []string) {
+	if len(hashes) == 0 {
+		return
+	}
+	if _, err := s.collectUploadBlocks(ctx, hashes); err != nil {
+		log.Printf("tus upload %s: failed to collect discarded blocks: %v", id, err)
+	}
+}
+
+// finishTusUpload 写入最后一块，以上传会话的流程校验并创建文件，然后把 tus 上传标记为完成
+func (s *FileService) finishTusUpload(ctx context.Context, upload *TusUpload, tail []byte) error {
+	if len(tail) > 0 {
+		hash, err := s.StoreUploadChunk(ctx, tail)
+		if err != nil {
+			return err
+		}
+		upload.BlockHashes = append(upload.BlockHashes, hash)
+	}
+
+	session := &UploadSession{
+		LibraryID:   upload.LibraryID,
+		FileName:    upload.FileName,
+		FileSize:    upload.Length,
+		ChunkHashes: upload.BlockHashes,
+		OwnerID:     upload.OwnerID,
+	}
+	// 配额已在创建 tus 上传时预留
+	if err := s.createUploadSession(ctx, session, false); err != nil {
+		return err
+	}
+	defer func() {
+		if err := s.CleanupUploadSession(ctx, session.UploadID); err != nil {
+			fmt.Printf("Warning: failed to clean up upload session %s: %v\n", session.UploadID, err)
+		}
+	}()
+	// 块都由本次 tus 上传写入，全部记为已接收
+	if _, err := s.markStoredChunks(ctx, session, func(string) bool { return true }); err != nil {
+		return err
+	}
+	file, err := s.CreateFileNode(ctx, session)
+	if err != nil {
+		return err
+	}
+	upload.File = file
+	upload.FileHash = file.Hash
+	s.releaseQuota(ctx, upload.OwnerID, upload.Reserved)
+	upload.Reserved = 0
+
+	if err := s.redisClient.Del(ctx, tusTailKey(upload.ID)).Err(); err != nil {
+		fmt.Printf("Warning: failed to clean up tus buffer %s: %v\n", upload.ID, err)
+	}
+	return s.saveTusUpload(ctx, upload)
+}
+
+// saveTusUpload 保存 tus 上传状态，与上传同时过期
+func (s *FileService) saveTusUpload(ctx context.Context, upload *TusUpload) error {
+	data, err := json.Marshal(upload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal tus upload: %w", err)
+	}
+	if err := s.redisClient.Set(ctx, tusUploadKey(upload.ID), data, time.Until(upload.ExpiresAt.Add(uploadKeyGrace))).Err(); err != nil {
+		return fmt.Errorf("failed to save tus upload: %w", err)
+	}
+	return nil
+}
+
+// tusUploadKey tus 上传状态在 Redis 中的键
+func tusUploadKey(id string) string {
+	return fmt.Sprintf("tus:%s", id)
+}
+
+// tusTailKey tus 上传中不足一块的尾部数据在 Redis 中的键
+func tusTailKey(id string) string {
+	return fmt.Sprintf("tus:%s:tail", id)
+}
@@ -0,0 +1,110 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/sealock/core-storage/storage"
+)
+
+// ErrQuotaExceeded 上传的文件大小加上已用空间和其他进行中上传的预留超出了用户配额
+var ErrQuotaExceeded = errors.New("storage quota exceeded")
+
+// QuotaProvider 提供用户的存储配额
+type QuotaProvider interface {
+	// Quota 返回用户的配额上限和已用空间（字节），limit 不大于 0 表示不限制
+	Quota(ctx context.Context, ownerID uint) (limit, used int64, err error)
+}
+
+// LibraryQuota 所有用户使用相同配额上限，已用空间为用户拥有的库中文件大小之和
+type LibraryQuota struct {
+	libraryRepo storage.LibraryRepository
+	fileRepo    storage.FileRepository
+	limit       int64
+}
+
+// NewLibraryQuota 创建按库统计已用空间的配额，limit 不大于 0 表示不限制
+func NewLibraryQuota(lr storage.LibraryRepository, fr storage.FileRepository, limit int64) *LibraryQuota {
+	return &LibraryQuota{libraryRepo: lr, fileRepo: fr, limit: limit}
+}
+
+// Quota 实现 QuotaProvider
+func (q *LibraryQuota) Quota(ctx context.Context, ownerID uint) (int64, int64, error) {
+	if q.limit <= 0 {
+		return 0, 0, nil
+	}
+	libraries, err := q.libraryRepo.ListLibrariesByOwner(ctx, ownerID)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to list libraries: %w", err)
+	}
+	ids := make([]uint, len(libraries))
+	for i, lib := range libraries {
+		ids[i] = lib.ID
+	}
+	used, err := q.fileRepo.SumFileSizes(ctx, ids)
+	if err != nil {
+		return 0, 0, err
+	}
+	return q.limit, used, nil
+}
+
+// SetQuotaProvider 设置用户配额，创建上传会话时按声明的文件大小预留配额；未设置时不限制
+func (s *FileService) SetQuotaProvider(quota QuotaProvider) {
+	s.quota = quota
+}
+
+// ReservedQuota 返回用户进行中的上传预留的配额（字节）
+func (s *FileService) ReservedQuota(ctx context.Context, ownerID uint) (int64, error) {
+	reserved, err := s.redisClient.Get(ctx, uploadReservedKey(ownerID)).Int64()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	return reserved, err
+}
+
+// reserveQuota 为用户预留 size 字节的配额，返回实际预留的字节数
+// 未设置配额或配额不限时不预留；启用配额时拒绝无法归属到用户的匿名上传，否则可以绕过配额。
+// 预留先原子地累加再检查，并发的上传不会一起越过上限
+func (s *FileService) reserveQuota(ctx context.Context, ownerID uint, size int64) (int64, error) {
+	if s.quota == nil || size <= 0 {
+		return 0, nil
+	}
+	limit, used, err := s.quota.Quota(ctx, ownerID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read quota: %w", err)
+	}
+	if limit <= 0 {
+		return 0, nil
+	}
+	if ownerID == 0 {
+		return 0, fmt.Errorf("%w: upload has no owner to charge", ErrQuotaExceeded)
+	}
+
+	key := uploadReservedKey(ownerID)
+	reserved, err := s.redisClient.IncrBy(ctx, key, size).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to reserve quota: %w", err)
+	}
+	if used+reserved > limit {
+		s.releaseQuota(ctx, ownerID, size)
+		return 0, fmt.Errorf("%w: %d bytes used, %d bytes reserved, limit %d", ErrQuotaExceeded, used, reserved-size, limit)
+	}
+	return size, nil
+}
+
+// releaseQuota 释放预留的配额，失败时只记录警告
+func (s *FileService) releaseQuota(ctx context.Context, ownerID uint, size int64) {
+	if size <= 0 {
+		return
+	}
+	if err := s.redisClient.DecrBy(ctx, uploadReservedKey(ownerID), size).Err(); err != nil {
+		fmt.Printf("Warning: failed to release %d reserved bytes of user %d: %v\n", size, ownerID, err)
+	}
+}
+
+// uploadReservedKey 用户配额预留在 Redis 中的键
+func uploadReservedKey(ownerID uint) string {
+	return fmt.Sprintf("upload:reserved:%d", ownerID)
+}
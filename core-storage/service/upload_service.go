@@ -4,22 +4,69 @@ import (
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/redis/go-redis/v9"
+	"github.com/sealock/core-storage/chunker"
 	"github.com/sealock/core-storage/model"
+	"github.com/sealock/core-storage/storage"
+)
+
+const (
+	// DefaultUploadSessionTTL 上传会话的有效期，过期后由清理任务删除会话、回收分片并释放配额预留
+	DefaultUploadSessionTTL = 24 * time.Hour
+	// uploadKeyGrace 会话在 Redis 中比有效期多保留的时间，留给清理任务读取；清理任务未运行时由 Redis 自行删除
+	uploadKeyGrace = time.Hour
+	// uploadIndexKey 所有分片上传会话、tus 上传与分段上传的过期时间索引（有序集合，成员为 "session:<id>"、"tus:<id>" 或 "multipart:<id>"）
+	uploadIndexKey = "upload:expiry"
+)
+
+var (
+	// ErrInvalidUploadSession 创建上传会话的参数不合法
+	ErrInvalidUploadSession = errors.New("invalid upload session")
+	// ErrUploadChunkMismatch 分片与会话声明的分片列表不符
+	ErrUploadChunkMismatch = errors.New("upload chunks do not match session")
+	// ErrUploadSizeMismatch 分片大小之和与声明的文件大小不一致
+	ErrUploadSizeMismatch = errors.New("upload size mismatch")
 )
 
 // UploadSession 表示一个正在进行的文件上传会话
+// 创建时即保存在 Redis 中，包含完成上传所需的全部信息，客户端可凭 UploadID 断点续传
 type UploadSession struct {
-	UploadID    string   `json:"uploadId"`     // 上传会话的唯一标识符
-	FileName    string   `json:"fileName"`     // 文件名
-	FileSize    int64    `json:"fileSize"`     // 文件大小（字节）
-	FileHash    string   `json:"fileHash"`     // 文件内容哈希值
-	TotalChunks int      `json:"totalChunks"`  // 总分片数量
-	ChunkHashes []string `json:"chunkHashes"`  // 各个分片的哈希值列表
-	CreatedAt   time.Time `json:"createdAt"`    // 创建时间
+	UploadID    string    `json:"uploadId"`    // 上传会话的唯一标识符
+	LibraryID   uint      `json:"libraryId"`   // 目标库
+	FileName    string    `json:"fileName"`    // 库内目标路径
+	FileSize    int64     `json:"fileSize"`    // 文件大小（字节）
+	FileHash    string    `json:"fileHash"`    // 期望的文件内容哈希值（分片哈希列表的 Merkle 哈希）
+	TotalChunks int       `json:"totalChunks"` // 总分片数量
+	ChunkHashes []string  `json:"chunkHashes"` // 各个分片的哈希值列表
+	OwnerID     uint      `json:"ownerId"`     // 发起上传的用户，0 表示未认证
+	Reserved    int64     `json:"reserved"`    // 为本会话预留的配额（字节），会话结束时释放
+	CreatedAt   time.Time `json:"createdAt"`   // 创建时间
+	ExpiresAt   time.Time `json:"expiresAt"`   // 过期时间
+}
+
+// CheckChunk 校验分片索引在范围内且内容哈希与会话声明一致
+func (u *UploadSession) CheckChunk(chunkIndex int, chunkHash string) error {
+	if chunkIndex < 0 || chunkIndex >= u.TotalChunks {
+		return fmt.Errorf("%w: chunk index %d out of range [0, %d)", ErrUploadChunkMismatch, chunkIndex, u.TotalChunks)
+	}
+	if u.ChunkHashes[chunkIndex] != chunkHash {
+		return fmt.Errorf("%w: chunk %d hash %s, expected %s", ErrUploadChunkMismatch, chunkIndex, chunkHash, u.ChunkHashes[chunkIndex])
+	}
+	return nil
+}
+
+// UploadSessionStatus 上传会话的进度，供客户端断点续传
+type UploadSessionStatus struct {
+	Session  *UploadSession `json:"session"`
+	Received []int          `json:"received"` // 已接收的分片索引（升序）
+	Missing  []int          `json:"missing"`  // 尚未接收的分片索引（升序）
+	Complete bool           `json:"complete"` // 分片已齐全，可以完成上传
 }
 
 // GetFileNodeByContentHash 根据内容哈希值获取文件节点
@@ -28,13 +75,19 @@ type UploadSession struct {
 //   - hash: 文件内容的哈希值
 //
 // 返回值:
-//   - *model.Node: 找到的文件节点，如果不存在则返回nil
+//   - *model.File: 任意一个内容相同的文件，如果不存在则返回nil
 //   - error: 错误信息，如果没有错误则返回nil
 //
-// 说明: 这是一个简化的实现，在实际应用中应该查询数据库中的Node表
-// 目前返回nil表示文件不存在
-func (s *FileService) GetFileNodeByContentHash(ctx context.Context, hash string) (*model.Node, error) {
-	return nil, nil
+// 说明: 文件存在时其所有块都在块存储中，客户端创建上传会话后无需上传任何分片即可完成（秒传）
+func (s *FileService) GetFileNodeByContentHash(ctx context.Context, hash string) (*model.File, error) {
+	file, err := s.fileRepo.GetFileByHash(ctx, hash)
+	if err != nil {
+		if errors.Is(err, storage.ErrFileNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return file, nil
 }
 
 // ComputeSHA256 计算给定数据的SHA-256哈希值
@@ -48,98 +101,319 @@ func (s *FileService) ComputeSHA256(data []byte) []byte {
 	return hash[:]
 }
 
-// StoreTemporaryChunk 将分片临时存储在Redis或本地存储中
+// StoreUploadChunk 将上传的分片直接写入块存储
 // 参数:
-//   - uploadID: 上传会话ID
-//   - chunkIndex: 分片索引（从0开始）
+//   - ctx: 上下文对象
 //   - data: 分片数据
 //
 // 返回值:
+//   - string: 分片的内容哈希
 //   - error: 错误信息，如果没有错误则返回nil
 //
-// 说明: 在真实实现中，这会将分片存储在Redis或临时存储中
-// 目前仅模拟成功情况
-func (s *FileService) StoreTemporaryChunk(uploadID string, chunkIndex int, data []byte) error {
+// 说明: 分片即块，相同内容只存储一份；块元数据以引用计数 0 登记，
+// 完成上传创建文件时才增加引用
+func (s *FileService) StoreUploadChunk(ctx context.Context, data []byte) (string, error) {
+	hash, err := s.blockStore.Put(ctx, data)
+	if err != nil {
+		return "", fmt.Errorf("failed to store chunk: %w", err)
+	}
+	// 并发上传同一分片时元数据只会创建一次
+	if err := s.blockRepo.SaveBlockMetadata(ctx, &model.Block{Hash: hash, Size: int64(len(data))}); err != nil {
+		return "", fmt.Errorf("failed to save block metadata: %w", err)
+	}
+	return hash, nil
+}
+
+// CreateUploadSession 创建并保存上传会话
+// 参数:
+//   - ctx: 上下文对象
+//   - session: 会话信息，需要填写目标库、路径、文件大小、分片哈希列表和期望的文件哈希（可为空，由分片列表计算）
+//
+// 返回值:
+//   - error: 参数不合法时返回 ErrInvalidUploadSession，超出用户配额时返回 ErrQuotaExceeded
+//
+// 功能:
+//   - 校验分片哈希格式以及分片列表与文件哈希一致
+//   - 按声明的文件大小预留用户配额，避免并发上传超出配额
+//   - 分配 UploadID，设置创建与过期时间，以 JSON 保存到 Redis 并登记到过期索引
+func (s *FileService) CreateUploadSession(ctx context.Context, session *UploadSession) error {
+	return s.createUploadSession(ctx, session, true)
+}
+
+// createUploadSession 创建上传会话，reserve 为 false 时不预留配额（调用方已持有预留）
+func (s *FileService) createUploadSession(ctx context.Context, session *UploadSession, reserve bool) error {
+	session.FileName = cleanPath(session.FileName)
+	if session.FileName == "" {
+		return fmt.Errorf("%w: empty file name", ErrInvalidUploadSession)
+	}
+	if session.FileSize < 0 {
+		return fmt.Errorf("%w: negative file size", ErrInvalidUploadSession)
+	}
+	if session.FileSize > 0 && len(session.ChunkHashes) == 0 {
+		return fmt.Errorf("%w: chunk hashes required", ErrInvalidUploadSession)
+	}
+	for i, hash := range session.ChunkHashes {
+		if !isContentHash(hash) {
+			return fmt.Errorf("%w: invalid hash for chunk %d", ErrInvalidUploadSession, i)
+		}
+	}
+	if err := checkWritable(ctx, s.replication, session.LibraryID); err != nil {
+		return err
+	}
+	fileHash, err := chunker.ComputeFileMerkleHash(session.ChunkHashes)
+	if err != nil {
+		return err
+	}
+	if session.FileHash == "" {
+		session.FileHash = fileHash
+	} else if session.FileHash != fileHash {
+		return fmt.Errorf("%w: file hash does not match chunk hashes", ErrInvalidUploadSession)
+	}
+
+	session.Reserved = 0
+	if reserve {
+		reserved, err := s.reserveQuota(ctx, session.OwnerID, session.FileSize)
+		if err != nil {
+			return err
+		}
+		session.Reserved = reserved
+	}
+
+	now := time.Now()
+	session.UploadID = uuid.New().String()
+	session.TotalChunks = len(session.ChunkHashes)
+	session.CreatedAt = now
+	session.ExpiresAt = now.Add(DefaultUploadSessionTTL)
+
+	data, err := json.Marshal(session)
+	if err != nil {
+		s.releaseQuota(ctx, session.OwnerID, session.Reserved)
+		return fmt.Errorf("failed to marshal upload session: %w", err)
+	}
+	if err := s.redisClient.Set(ctx, uploadSessionKey(session.UploadID), data, DefaultUploadSessionTTL+uploadKeyGrace).Err(); err != nil {
+		s.releaseQuota(ctx, session.OwnerID, session.Reserved)
+		return fmt.Errorf("failed to save upload session: %w", err)
+	}
+	if err := s.indexUpload(ctx, "session:"+session.UploadID, session.ExpiresAt); err != nil {
+		s.releaseQuota(ctx, session.OwnerID, session.Reserved)
+		return err
+	}
 	return nil
 }
 
-// RecordChunkReceived 记录上传会话中已接收的分片
+// GetUploadSession 读取上传会话
 // 参数:
+//   - ctx: 上下文对象
 //   - uploadID: 上传会话ID
-//   - chunkIndex: 已接收的分片索引
-//   - totalChunks: 总分片数量
 //
 // 返回值:
+//   - *UploadSession: 上传会话，不存在或已过期时返回nil
 //   - error: 错误信息，如果没有错误则返回nil
+func (s *FileService) GetUploadSession(ctx context.Context, uploadID string) (*UploadSession, error) {
+	session, err := s.loadUploadSession(ctx, uploadID)
+	if err != nil || session == nil || time.Now().After(session.ExpiresAt) {
+		return nil, err
+	}
+	return session, nil
+}
+
+// loadUploadSession 读取上传会话，包括已过期但尚未被清理的会话
+func (s *FileService) loadUploadSession(ctx context.Context, uploadID string) (*UploadSession, error) {
+	data, err := s.redisClient.Get(ctx, uploadSessionKey(uploadID)).Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var session UploadSession
+	if err := json.Unmarshal(data, &session); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal upload session: %w", err)
+	}
+	return &session, nil
+}
+
+// RecordChunkReceived 记录上传会话中已接收的分片
+// 参数:
+//   - ctx: 上下文对象
+//   - session: 上传会话
+//   - chunkIndex: 已接收的分片索引
+//   - chunkHash: 分片写入块存储后的哈希
+//
+// 返回值:
+//   - error: 分片与会话不符时返回 ErrUploadChunkMismatch
 //
 // 功能:
-//   - 使用Redis跟踪哪些分片已被接收
-//   - 为上传会话设置过期时间（例如24小时）
-func (s *FileService) RecordChunkReceived(uploadID string, chunkIndex, totalChunks int) error {
-	// 使用Redis的哈希结构记录已接收的分片
-	key := fmt.Sprintf("upload:%s:chunks", uploadID)
+//   - 使用Redis跟踪哪些分片已被接收以及各分片的内容哈希
+//   - 分片记录与会话同时过期
+func (s *FileService) RecordChunkReceived(ctx context.Context, session *UploadSession, chunkIndex int, chunkHash string) error {
+	if err := session.CheckChunk(chunkIndex, chunkHash); err != nil {
+		return err
+	}
+
+	// 使用Redis的哈希结构记录已接收的分片，值为分片哈希，完成上传时据此校验
+	key := uploadChunksKey(session.UploadID)
 	field := fmt.Sprintf("chunk:%d", chunkIndex)
-	
-	// 在Redis中记录该分片已接收
-	if err := s.redisClient.HSet(context.Background(), key, field, "received").Err(); err != nil {
+	if err := s.redisClient.HSet(ctx, key, field, chunkHash).Err(); err != nil {
 		return err
 	}
-	
-	// 设置上传会话的过期时间（24小时）
-	if err := s.redisClient.Expire(context.Background(), key, 24*time.Hour).Err(); err != nil {
+	if err := s.redisClient.ExpireAt(ctx, key, session.ExpiresAt.Add(uploadKeyGrace)).Err(); err != nil {
 		return err
 	}
-	
+
 	return nil
 }
 
-// GetMissingChunks 获取上传会话中缺失的分片索引列表
+// ContentExistsInLibraries 判断这些库中是否已有内容哈希为 hash 的文件（秒传检查）
+// libraryIDs 应为调用者可以读取的库：只回答是否存在，不暴露其他用户的文件
+func (s *FileService) ContentExistsInLibraries(ctx context.Context, libraryIDs []uint, hash string) (bool, error) {
+	return s.fileRepo.HashExistsInLibraries(ctx, libraryIDs, hash)
+}
+
+// ReuseStoredChunks 把已有的分片直接记为已接收（块级秒传）
+// 参数:
+//   - ctx: 上下文对象
+//   - session: 上传会话
+//   - libraryIDs: 调用者可以读取的库
+//
+// 返回值:
+//   - int: 无需上传的分片数量
+//   - error: 错误信息，如果没有错误则返回nil
+//
+// 说明: 编辑过的文档、追加写入的日志等与已有内容部分相同的文件，只需上传新的分片；
+// 只复用 libraryIDs 中的文件引用的块：只知道哈希不能证明持有内容，否则可以借秒传读取其他用户的数据。
+// 复用的块在完成上传时才增加引用，期间被垃圾回收的块会在完成时报告为缺失，客户端重新上传即可
+func (s *FileService) ReuseStoredChunks(ctx context.Context, session *UploadSession, libraryIDs []uint) (int, error) {
+	readable, err := s.fileRepo.FindBlocksInLibraries(ctx, libraryIDs, uniqueHashes(session.ChunkHashes))
+	if err != nil {
+		return 0, err
+	}
+	return s.markStoredChunks(ctx, session, func(hash string) bool { return readable[hash] })
+}
+
+// uniqueHashes 返回去重后的哈希列表，保持首次出现的顺序
+func uniqueHashes(hashes []string) []string {
+	seen := make(map[string]bool, len(hashes))
+	unique := make([]string, 0, len(hashes))
+	for _, hash := range hashes {
+		if !seen[hash] {
+			seen[hash] = true
+			unique = append(unique, hash)
+		}
+	}
+	return unique
+}
+
+// markStoredChunks 把块存储中已有且 reusable 返回 true 的分片记为已接收，返回记录的分片数量
+func (s *FileService) markStoredChunks(ctx context.Context, session *UploadSession, reusable func(hash string) bool) (int, error) {
+	exists := make(map[string]bool, session.TotalChunks)
+	fields := make([]interface{}, 0, session.TotalChunks*2)
+	for i, hash := range session.ChunkHashes {
+		found, checked := exists[hash]
+		if !checked {
+			if reusable(hash) {
+				var err error
+				if found, err = s.blockStore.Exists(ctx, hash); err != nil {
+					return 0, fmt.Errorf("failed to check block %s: %w", hash, err)
+				}
+			}
+			exists[hash] = found
+		}
+		if found {
+			fields = append(fields, fmt.Sprintf("chunk:%d", i), hash)
+		}
+	}
+	if len(fields) == 0 {
+		return 0, nil
+	}
+
+	key := uploadChunksKey(session.UploadID)
+	if err := s.redisClient.HSet(ctx, key, fields...).Err(); err != nil {
+		return 0, err
+	}
+	if err := s.redisClient.ExpireAt(ctx, key, session.ExpiresAt.Add(uploadKeyGrace)).Err(); err != nil {
+		return 0, err
+	}
+	return len(fields) / 2, nil
+}
+
+// ReceivedChunks 返回上传会话中已接收的分片
 // 参数:
+//   - ctx: 上下文对象
 //   - uploadID: 上传会话ID
 //
 // 返回值:
-//   - []int: 缺失分片的索引列表
+//   - map[int]string: 分片索引到分片哈希的映射
+//   - error: 错误信息，如果没有错误则返回nil
+func (s *FileService) ReceivedChunks(ctx context.Context, uploadID string) (map[int]string, error) {
+	fields, err := s.redisClient.HGetAll(ctx, uploadChunksKey(uploadID)).Result()
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+	chunks := make(map[int]string, len(fields))
+	for field, hash := range fields {
+		var index int
+		if _, err := fmt.Sscanf(field, "chunk:%d", &index); err != nil {
+			continue
+		}
+		chunks[index] = hash
+	}
+	return chunks, nil
+}
+
+// GetMissingChunks 获取上传会话中缺失的分片索引列表
+// 参数:
+//   - ctx: 上下文对象
+//   - session: 上传会话
+//
+// 返回值:
+//   - []int: 缺失分片的索引列表（升序），没有缺失时为空切片
 //   - error: 错误信息，如果没有错误则返回nil
 //
 // 功能:
-//   - 从Redis中检索所有已接收的分片
-//   - 确定哪些分片尚未接收
-//   - 返回缺失分片的索引数组
-func (s *FileService) GetMissingChunks(uploadID string) ([]int, error) {
-	var missingChunks []int
-	
-	// 从Redis获取所有已接收的分片信息
-	key := fmt.Sprintf("upload:%s:chunks", uploadID)
-	receivedChunks, err := s.redisClient.HGetAll(context.Background(), key).Result()
+//   - 按会话保存的总分片数逐个检查，已记录且哈希与会话一致的分片才算已接收
+func (s *FileService) GetMissingChunks(ctx context.Context, session *UploadSession) ([]int, error) {
+	received, err := s.ReceivedChunks(ctx, session.UploadID)
 	if err != nil {
-		if err == redis.Nil {
-			return []int{}, nil // 尚未接收到任何分片
-		}
 		return nil, err
 	}
-	
-	// 如果没有接收到任何分片，返回空列表（所有分片都缺失）
-	if len(receivedChunks) == 0 {
-		return missingChunks, nil
+	missing := []int{}
+	for i := 0; i < session.TotalChunks; i++ {
+		if received[i] != session.ChunkHashes[i] {
+			missing = append(missing, i)
+		}
 	}
-	
-	// 从字段名中解析出总分片数
-	// 注意：这是一个简化实现，实际上总分片数应该单独存储
-	var totalChunks int
-	for field := range receivedChunks {
-		fmt.Sscanf(field, "chunk:%d", &totalChunks)
-		break
+	return missing, nil
+}
+
+// GetUploadSessionStatus 返回上传会话的进度
+// 参数:
+//   - ctx: 上下文对象
+//   - session: 上传会话
+//
+// 返回值:
+//   - *UploadSessionStatus: 会话信息以及已接收、缺失的分片
+//   - error: 错误信息，如果没有错误则返回nil
+func (s *FileService) GetUploadSessionStatus(ctx context.Context, session *UploadSession) (*UploadSessionStatus, error) {
+	missing, err := s.GetMissingChunks(ctx, session)
+	if err != nil {
+		return nil, err
 	}
-	
-	// 检查哪些分片缺失
-	for i := 0; i < totalChunks; i++ {
-		fieldName := fmt.Sprintf("chunk:%d", i)
-		if _, exists := receivedChunks[fieldName]; !exists {
-			missingChunks = append(missingChunks, i)
+	received := make([]int, 0, session.TotalChunks-len(missing))
+	next := 0
+	for i := 0; i < session.TotalChunks; i++ {
+		if next < len(missing) && missing[next] == i {
+			next++
+			continue
 		}
+		received = append(received, i)
 	}
-	
-	return missingChunks, nil
+	return &UploadSessionStatus{
+		Session:  session,
+		Received: received,
+		Missing:  missing,
+		Complete: len(missing) == 0,
+	}, nil
 }
 
 // ReconstructFileHash 从分片哈希值重建文件哈希值
@@ -151,73 +425,187 @@ func (s *FileService) GetMissingChunks(uploadID string) ([]int, error) {
 //   - string: 重建后的文件哈希值
 //   - error: 错误信息，如果没有错误则返回nil
 //
-// 说明: 在真实实现中，这会验证分片哈希值并重建文件哈希
-// 目前只是简单地将所有哈希值连接后再次哈希
+// 说明: 文件哈希是分片哈希列表的 Merkle 哈希，与 UploadFile 和同步协议一致
 func (s *FileService) ReconstructFileHash(uploadID string, chunkHashes []string) (string, error) {
-	// 将所有分片哈希值连接成一个字符串
-	concatenated := ""
-	for _, hash := range chunkHashes {
-		concatenated += hash
-	}
-	
-	// 对连接后的字符串计算SHA-256哈希
-	hash := sha256.Sum256([]byte(concatenated))
-	return hex.EncodeToString(hash[:]), nil
+	return chunker.ComputeFileMerkleHash(chunkHashes)
 }
 
-// CreateFileNode 在上传成功后创建最终的文件节点条目
+// CreateFileNode 在上传成功后创建最终的文件条目
 // 参数:
 //   - ctx: 上下文对象
-//   - fileName: 文件名
-//   - fileSize: 文件大小（字节）
-//   - fileHash: 文件内容哈希值
-//   - chunkHashes: 各个分片的哈希值列表
+//   - session: 上传会话，提供目标库、路径、大小、文件哈希和分片列表
 //
 // 返回值:
-//   - *model.Node: 创建的文件节点
-//   - error: 错误信息，如果没有错误则返回nil
+//   - *model.File: 保存的文件记录
+//   - error: 错误信息，分片未齐全或大小不一致时返回 ErrUploadChunkMismatch / ErrUploadSizeMismatch
 //
 // 功能:
-//   - 为文件创建新的节点
-//   - 在真实实现中，会将节点保存到数据库
-func (s *FileService) CreateFileNode(
-	ctx context.Context,
-	fileName string,
-	fileSize int64,
-	fileHash string,
-	chunkHashes []string,
-) (*model.Node, error) {
-	// 创建新的文件节点
-	node := &model.Node{
-		Name:        fileName,
-		Size:        fileSize,
-		Type:        "file",
-		ContentHash: &fileHash,
-		BlockHashes: chunkHashes,
-	}
-
-	// 在真实实现中，这会将节点保存到数据库
-	// 目前只是返回一个填充好的节点
-	return node, nil
+//   - 校验每个分片都已在本会话中上传且哈希一致，并且仍在块存储中
+//   - 校验分片大小之和等于文件大小
+//   - 为每个分片增加一次块引用后保存文件记录；同一路径已有文件时覆盖并释放旧内容的块
+//   - 发布文件事件并登记自动提交
+func (s *FileService) CreateFileNode(ctx context.Context, session *UploadSession) (*model.File, error) {
+	libraryID := session.LibraryID
+	fileName := session.FileName
+	fileSize := session.FileSize
+	fileHash := session.FileHash
+	chunkHashes := session.ChunkHashes
+
+	// 校验分片：必须是本会话上传的内容，且块仍然存在
+	received, err := s.ReceivedChunks(ctx, session.UploadID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read upload session: %w", err)
+	}
+	sizes := make(map[string]int64, len(chunkHashes))
+	var total int64
+	for i, hash := range chunkHashes {
+		if received[i] != hash {
+			return nil, fmt.Errorf("%w: chunk %d was not uploaded", ErrUploadChunkMismatch, i)
+		}
+		size, known := sizes[hash]
+		if !known {
+			if size, err = s.blockStore.GetSize(ctx, hash); err != nil {
+				return nil, fmt.Errorf("%w: chunk %d is missing from block store", ErrUploadChunkMismatch, i)
+			}
+			sizes[hash] = size
+		}
+		total += size
+	}
+	if total != fileSize {
+		return nil, fmt.Errorf("%w: chunks add up to %d bytes, expected %d", ErrUploadSizeMismatch, total, fileSize)
+	}
+
+	return s.saveFileNode(ctx, libraryID, fileName, fileSize, fileHash, chunkHashes, sizes)
+}
+
+// saveFileNode 为每个块增加一次引用后在库的路径上保存文件记录
+// 同一路径已有文件时覆盖并释放旧内容的块；成功后发布文件事件并登记自动提交。
+// 持有库的写锁，与同步推送、回滚等其他写入串行执行
+func (s *FileService) saveFileNode(ctx context.Context, libraryID uint, fileName string, fileSize int64, fileHash string, chunkHashes []string, sizes map[string]int64) (*model.File, error) {
+	lock := s.locks.Get(libraryID)
+	lock.Lock()
+	defer lock.Unlock()
+	if err := checkWritable(ctx, s.replication, libraryID); err != nil {
+		return nil, err
+	}
+
+	file, eventType, err := s.writeFileNode(ctx, libraryID, fileName, fileSize, fileHash, chunkHashes, sizes)
+	if err != nil {
+		return nil, err
+	}
+	s.events.Publish(Event{LibraryID: libraryID, Type: eventType, Path: file.Name, Hash: file.Hash, Size: file.Size})
+
+	// 登记自动提交（由调度器合并执行）
+	s.commitScheduler.Notify(libraryID, "")
+
+	return file, nil
+}
+
+// writeFileNode 保存文件记录和块引用，返回文件及对应的事件类型，不加锁也不发布事件
+// 调用方持有库的写锁；在事务中调用时，失败后由回滚撤销已做的修改
+func (s *FileService) writeFileNode(ctx context.Context, libraryID uint, fileName string, fileSize int64, fileHash string, chunkHashes []string, sizes map[string]int64) (*model.File, EventType, error) {
+	// 每个分片对应文件的一次块引用
+	for i, hash := range chunkHashes {
+		if err := retainBlock(ctx, s.blockRepo, hash, sizes[hash]); err != nil {
+			s.releaseBlocks(ctx, chunkHashes[:i])
+			return nil, "", err
+		}
+	}
+	blockIDs, err := json.Marshal(chunkHashes)
+	if err != nil {
+		s.releaseBlocks(ctx, chunkHashes)
+		return nil, "", fmt.Errorf("failed to marshal block hashes: %w", err)
+	}
+
+	existing, err := s.fileRepo.GetFileByPath(ctx, libraryID, fileName)
+	if err != nil {
+		s.releaseBlocks(ctx, chunkHashes)
+		return nil, "", fmt.Errorf("failed to look up %s: %w", fileName, err)
+	}
+	if file := existing; file != nil {
+		// 读不出旧的块列表时不覆盖，否则旧内容的块引用永远无法释放
+		oldBlocks, err := fileBlockHashes(file)
+		if err != nil {
+			s.releaseBlocks(ctx, chunkHashes)
+			return nil, "", fmt.Errorf("failed to read block list of %s: %w", file.Name, err)
+		}
+		file.Size = fileSize
+		file.Hash = fileHash
+		file.BlockIDs = blockIDs
+		if err := s.fileRepo.UpdateFile(ctx, file); err != nil {
+			s.releaseBlocks(ctx, chunkHashes)
+			return nil, "", fmt.Errorf("failed to update file record: %w", err)
+		}
+		s.releaseBlocks(ctx, oldBlocks)
+		return file, EventFileUpdated, nil
+	}
+
+	file := &model.File{
+		UUID:      uuid.New().String(),
+		Name:      fileName,
+		Size:      fileSize,
+		Hash:      fileHash,
+		BlockIDs:  blockIDs,
+		LibraryID: libraryID,
+	}
+	if err := s.fileRepo.CreateFile(ctx, file); err != nil {
+		s.releaseBlocks(ctx, chunkHashes)
+		return nil, "", fmt.Errorf("failed to create file record: %w", err)
+	}
+	return file, EventFileCreated, nil
+}
+
+// releaseBlocks 逐个减少块的引用计数，失败时只记录警告
+func (s *FileService) releaseBlocks(ctx context.Context, hashes []string) {
+	for _, hash := range hashes {
+		if err := s.blockRepo.DecrementBlockRefCount(ctx, hash); err != nil {
+			fmt.Printf("Warning: failed to decrement ref count for block %s: %v\n", hash, err)
+		}
+	}
 }
 
 // CleanupUploadSession 清理上传会话的临时资源
 // 参数:
+//   - ctx: 上下文对象
 //   - uploadID: 上传会话ID
 //
 // 返回值:
 //   - error: 错误信息，如果没有错误则返回nil
 //
 // 功能:
-//   - 从Redis中删除所有与上传会话相关的分片跟踪信息
-//   - 在真实实现中，还会清理任何临时文件
-func (s *FileService) CleanupUploadSession(uploadID string) error {
-	// 删除Redis中所有的分片跟踪信息
-	key := fmt.Sprintf("upload:%s:chunks", uploadID)
-	if err := s.redisClient.Del(context.Background(), key).Err(); err != nil {
+//   - 从Redis中删除上传会话及其分片跟踪信息，并释放会话的配额预留
+//   - 分片数据保存在块存储中，不在此处删除（完成上传后已被文件引用）
+func (s *FileService) CleanupUploadSession(ctx context.Context, uploadID string) error {
+	session, err := s.loadUploadSession(ctx, uploadID)
+	if err != nil {
 		return err
 	}
-	
-	// 在真实实现中，这也会清理任何临时文件
-	return nil
-}
\ No newline at end of file
+	// 从过期索引中移除成功的一方负责释放配额，避免与清理任务重复释放
+	claimed, err := s.unindexUpload(ctx, "session:"+uploadID)
+	if err != nil {
+		return err
+	}
+	if claimed && session != nil {
+		s.releaseQuota(ctx, session.OwnerID, session.Reserved)
+	}
+	return s.redisClient.Del(ctx, uploadSessionKey(uploadID), uploadChunksKey(uploadID)).Err()
+}
+
+// uploadSessionKey 上传会话在 Redis 中的键
+func uploadSessionKey(uploadID string) string {
+	return fmt.Sprintf("upload:%s:session", uploadID)
+}
+
+// uploadChunksKey 上传会话已接收分片在 Redis 中的键
+func uploadChunksKey(uploadID string) string {
+	return fmt.Sprintf("upload:%s:chunks", uploadID)
+}
+
+// isContentHash 判断是否为 sha256 十六进制哈希
+func isContentHash(hash string) bool {
+	if len(hash) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(hash)
+	return err == nil
+}
@@ -0,0 +1,194 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/sealock/core-storage/chunker"
+	"github.com/sealock/core-storage/storage"
+)
+
+// uploadTestService 上传会话测试使用的文件服务及其存储
+type uploadTestService struct {
+	*FileService
+	files  storage.FileRepository
+	blocks storage.BlockRepository
+}
+
+func newUploadTestService(t *testing.T) *uploadTestService {
+	t.Helper()
+	files := storage.NewMockFileRepository()
+	blocks := storage.NewMockBlockRepository()
+	s := NewFileService(storage.NewLocalBlockStore(), files, blocks, chunker.NewFixedSizeChunker(4),
+		storage.NewMockSnapshotRepository(), newTestRedis(t), true)
+	t.Cleanup(func() { s.Close(context.Background()) })
+	return &uploadTestService{FileService: s, files: files, blocks: blocks}
+}
+
+// upload 为 chunks 创建上传会话并上传 indexes 指定的分片
+func (s *uploadTestService) upload(t *testing.T, fileName string, chunks [][]byte, indexes ...int) *UploadSession {
+	t.Helper()
+	ctx := context.Background()
+	session := &UploadSession{LibraryID: 1, FileName: fileName}
+	for _, chunk := range chunks {
+		session.ChunkHashes = append(session.ChunkHashes, sha256Hex(chunk))
+		session.FileSize += int64(len(chunk))
+	}
+	if err := s.CreateUploadSession(ctx, session); err != nil {
+		t.Fatalf("create session: %v", err)
+	}
+	for _, i := range indexes {
+		hash, err := s.StoreUploadChunk(ctx, chunks[i])
+		if err != nil {
+			t.Fatalf("store chunk %d: %v", i, err)
+		}
+		if err := s.RecordChunkReceived(ctx, session, i, hash); err != nil {
+			t.Fatalf("record chunk %d: %v", i, err)
+		}
+	}
+	return session
+}
+
+// refCount 返回块的引用计数，块不存在时为 0
+func (s *uploadTestService) refCount(t *testing.T, chunk []byte) int {
+	t.Helper()
+	block, err := s.blocks.GetBlockMetadata(context.Background(), sha256Hex(chunk))
+	if err != nil || block == nil {
+		return 0
+	}
+	return block.RefCount
+}
+
+func TestUploadSessionProgress(t *testing.T) {
+	ctx := context.Background()
+	s := newUploadTestService(t)
+	chunks := [][]byte{[]byte("aaaa"), []byte("bbbb"), []byte("cc")}
+	session := s.upload(t, "a.txt", chunks, 2, 0)
+
+	received, err := s.ReceivedChunks(ctx, session.UploadID)
+	if err != nil {
+		t.Fatalf("received chunks: %v", err)
+	}
+	if want := map[int]string{0: sha256Hex(chunks[0]), 2: sha256Hex(chunks[2])}; !reflect.DeepEqual(received, want) {
+		t.Fatalf("received = %v, want %v", received, want)
+	}
+	missing, err := s.GetMissingChunks(ctx, session)
+	if err != nil || !reflect.DeepEqual(missing, []int{1}) {
+		t.Fatalf("missing = %v, %v, want [1]", missing, err)
+	}
+	status, err := s.GetUploadSessionStatus(ctx, session)
+	if err != nil {
+		t.Fatalf("status: %v", err)
+	}
+	if status.Complete || !reflect.DeepEqual(status.Received, []int{0, 2}) || !reflect.DeepEqual(status.Missing, []int{1}) {
+		t.Fatalf("status = %+v", status)
+	}
+
+	// 与会话不符的分片不被记录
+	if err := s.RecordChunkReceived(ctx, session, 1, sha256Hex(chunks[0])); !errors.Is(err, ErrUploadChunkMismatch) {
+		t.Fatalf("wrong chunk hash: err = %v, want ErrUploadChunkMismatch", err)
+	}
+	if err := s.RecordChunkReceived(ctx, session, 3, sha256Hex(chunks[0])); !errors.Is(err, ErrUploadChunkMismatch) {
+		t.Fatalf("chunk index out of range: err = %v, want ErrUploadChunkMismatch", err)
+	}
+
+	// 记录的哈希与会话不一致的分片（例如会话被替换后遗留的记录）仍算缺失
+	s.redisClient.HSet(ctx, uploadChunksKey(session.UploadID), "chunk:1", sha256Hex(chunks[0]))
+	if missing, _ := s.GetMissingChunks(ctx, session); !reflect.DeepEqual(missing, []int{1}) {
+		t.Fatalf("missing with a stale record = %v, want [1]", missing)
+	}
+
+	hash, _ := s.StoreUploadChunk(ctx, chunks[1])
+	if err := s.RecordChunkReceived(ctx, session, 1, hash); err != nil {
+		t.Fatalf("record chunk 1: %v", err)
+	}
+	status, err = s.GetUploadSessionStatus(ctx, session)
+	if err != nil || !status.Complete || len(status.Missing) != 0 || len(status.Received) != 3 {
+		t.Fatalf("complete status = %+v, %v", status, err)
+	}
+
+	// 不存在的会话没有已接收的分片
+	if received, err := s.ReceivedChunks(ctx, "missing"); err != nil || len(received) != 0 {
+		t.Fatalf("unknown session: %v, %v", received, err)
+	}
+}
+
+func TestCreateFileNode(t *testing.T) {
+	ctx := context.Background()
+	s := newUploadTestService(t)
+	a, b, c := []byte("aaaa"), []byte("bbbb"), []byte("cc")
+
+	// 分片未齐全时不创建文件
+	partial := s.upload(t, "docs/a.txt", [][]byte{a, b}, 0)
+	if _, err := s.CreateFileNode(ctx, partial); !errors.Is(err, ErrUploadChunkMismatch) {
+		t.Fatalf("partial upload: err = %v, want ErrUploadChunkMismatch", err)
+	}
+	if file, _ := s.files.GetFileByPath(ctx, 1, "docs/a.txt"); file != nil {
+		t.Fatal("partial upload created a file")
+	}
+
+	// 分片大小之和与声明的大小不一致
+	wrongSize := s.upload(t, "docs/a.txt", [][]byte{a, b}, 0, 1)
+	wrongSize.FileSize = 9
+	if _, err := s.CreateFileNode(ctx, wrongSize); !errors.Is(err, ErrUploadSizeMismatch) {
+		t.Fatalf("size mismatch: err = %v, want ErrUploadSizeMismatch", err)
+	}
+
+	session := s.upload(t, "docs/a.txt", [][]byte{a, b, a}, 0, 1, 2)
+	file, err := s.CreateFileNode(ctx, session)
+	if err != nil {
+		t.Fatalf("create file node: %v", err)
+	}
+	if file.LibraryID != 1 || file.Size != 12 || file.Hash != session.FileHash {
+		t.Fatalf("file = %+v", file)
+	}
+	// 每个分片对应一次块引用
+	if s.refCount(t, a) != 2 || s.refCount(t, b) != 1 {
+		t.Fatalf("ref counts a=%d b=%d, want 2 and 1", s.refCount(t, a), s.refCount(t, b))
+	}
+
+	// 覆盖同一路径时释放旧内容的块
+	replace := s.upload(t, "docs/a.txt", [][]byte{c}, 0)
+	updated, err := s.CreateFileNode(ctx, replace)
+	if err != nil {
+		t.Fatalf("overwrite: %v", err)
+	}
+	if updated.ID != file.ID || updated.Size != 2 {
+		t.Fatalf("overwritten file = %+v", updated)
+	}
+	if s.refCount(t, a) != 0 || s.refCount(t, b) != 0 || s.refCount(t, c) != 1 {
+		t.Fatalf("ref counts a=%d b=%d c=%d, want 0, 0 and 1", s.refCount(t, a), s.refCount(t, b), s.refCount(t, c))
+	}
+}
+
+func TestCreateFileNodeKeepsUnreadableFile(t *testing.T) {
+	ctx := context.Background()
+	s := newUploadTestService(t)
+	a, b := []byte("aaaa"), []byte("bbbb")
+
+	file, err := s.CreateFileNode(ctx, s.upload(t, "a.txt", [][]byte{a}, 0))
+	if err != nil {
+		t.Fatalf("create file node: %v", err)
+	}
+	file.BlockIDs = []byte("not json")
+	if err := s.files.UpdateFile(ctx, file); err != nil {
+		t.Fatalf("corrupt block list: %v", err)
+	}
+
+	// 旧文件的块列表无法读取时拒绝覆盖，新分片的引用随之释放
+	if _, err := s.CreateFileNode(ctx, s.upload(t, "a.txt", [][]byte{b}, 0)); err == nil {
+		t.Fatal("overwrote a file whose block list cannot be read")
+	}
+	if s.refCount(t, b) != 0 {
+		t.Fatalf("ref count of the rejected upload = %d, want 0", s.refCount(t, b))
+	}
+	if s.refCount(t, a) != 1 {
+		t.Fatalf("ref count of the existing file = %d, want 1", s.refCount(t, a))
+	}
+	existing, _ := s.files.GetFileByPath(ctx, 1, "a.txt")
+	if existing == nil || existing.Size != 4 {
+		t.Fatalf("existing file = %+v", existing)
+	}
+}
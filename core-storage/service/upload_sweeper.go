@@ -0,0 +1,248 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// DefaultUploadSweepInterval 上传会话清理任务的默认执行间隔
+const DefaultUploadSweepInterval = 10 * time.Minute
+
+// DefaultStagingGrace 上传清理回收过期上传的块时，在这段时间内写入过的块仍被保留
+// WebDAV、S3、归档导入等写入方在一次请求内先写入块再引用，这些块不在上传索引中，由宽限期保护
+const DefaultStagingGrace = time.Hour
+
+// UploadSweepResult 一次上传会话清理的结果
+type UploadSweepResult struct {
+	Sessions        int   // 过期的分片上传会话数量
+	TusUploads      int   // 过期的 tus 上传数量
+	Multipart       int   // 过期的 S3 分段上传数量
+	CollectedBlocks int   // 被垃圾回收实际删除的块数量
+	ReleasedQuota   int64 // 释放的配额预留（字节）
+}
+
+// SweepUploads 清理已过期的分片上传会话、tus 上传和分段上传
+// 删除会话状态、释放配额预留，并回收只被这些上传引用的块：
+// 仍被文件引用（引用计数大于 0）或仍被其他未过期上传使用的块会被保留
+func (s *FileService) SweepUploads(ctx context.Context) (*UploadSweepResult, error) {
+	now := time.Now()
+	expired, err := s.redisClient.ZRangeByScore(ctx, uploadIndexKey, &redis.ZRangeBy{
+		Min: "-inf",
+		Max: strconv.FormatInt(now.Unix(), 10),
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list expired uploads: %w", err)
+	}
+
+	result := &UploadSweepResult{}
+	var candidates []string
+	for _, member := range expired {
+		// 从索引中移除成功才处理，避免与完成上传或其他清理实例重复释放
+		claimed, err := s.unindexUpload(ctx, member)
+		if err != nil {
+			return result, err
+		}
+		if !claimed {
+			continue
+		}
+
+		kind, id, _ := strings.Cut(member, ":")
+		switch kind {
+		case "session":
+			session, err := s.loadUploadSession(ctx, id)
+			if err != nil {
+				return result, err
+			}
+			received, err := s.ReceivedChunks(ctx, id)
+			if err != nil {
+				return result, err
+			}
+			for _, hash := range received {
+				candidates = append(candidates, hash)
+			}
+			if session != nil {
+				s.releaseQuota(ctx, session.OwnerID, session.Reserved)
+				result.ReleasedQuota += session.Reserved
+			}
+			if err := s.redisClient.Del(ctx, uploadSessionKey(id), uploadChunksKey(id)).Err(); err != nil {
+				return result, err
+			}
+			result.Sessions++
+
+		case "tus":
+			upload, err := s.loadTusUpload(ctx, id)
+			if err != nil {
+				return result, err
+			}
+			if upload != nil {
+				if upload.FileHash == "" {
+					candidates = append(candidates, upload.BlockHashes...)
+				}
+				s.releaseQuota(ctx, upload.OwnerID, upload.Reserved)
+				result.ReleasedQuota += upload.Reserved
+			}
+			if err := s.redisClient.Del(ctx, tusUploadKey(id), tusTailKey(id)).Err(); err != nil {
+				return result, err
+			}
+			s.tusLocks.Delete(id)
+			result.TusUploads++
+
+		case "multipart":
+			upload, err := s.loadMultipartUpload(ctx, id)
+			if err != nil {
+				return result, err
+			}
+			parts, err := s.multipartParts(ctx, id)
+			if err != nil {
+				return result, err
+			}
+			for _, part := range parts {
+				candidates = append(candidates, part.BlockHashes...)
+				if upload != nil {
+					s.releaseQuota(ctx, upload.OwnerID, part.Reserved)
+					result.ReleasedQuota += part.Reserved
+				}
+			}
+			if err := s.redisClient.Del(ctx, multipartUploadKey(id), multipartPartsKey(id)).Err(); err != nil {
+				return result, err
+			}
+			result.Multipart++
+		}
+	}
+
+	collected, err := s.collectUploadBlocks(ctx, candidates)
+	result.CollectedBlocks = collected
+	if err != nil {
+		return result, err
+	}
+
+	// 宽限期内被跳过、写入失败后未回收的块在超过上传有效期后由全量扫描回收
+	gc := NewGarbageCollector(s.blockStore, s.blockRepo)
+	gc.SetTransactor(s.tx)
+	swept, err := gc.Sweep(ctx)
+	result.CollectedBlocks += swept
+	return result, err
+}
+
+// RunUploadSweeper 以固定间隔在后台清理过期的上传，直到 ctx 被取消
+func (s *FileService) RunUploadSweeper(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = DefaultUploadSweepInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			result, err := s.SweepUploads(ctx)
+			if err != nil {
+				log.Printf("upload sweep failed: %v", err)
+			}
+			if result != nil && result.Sessions+result.TusUploads+result.Multipart > 0 {
+				log.Printf("expired %d upload sessions, %d tus uploads and %d multipart uploads, collected %d blocks, released %d reserved bytes",
+					result.Sessions, result.TusUploads, result.Multipart, result.CollectedBlocks, result.ReleasedQuota)
+			}
+		}
+	}
+}
+
+// collectUploadBlocks 回收被放弃的上传写入的块，跳过仍被未过期上传使用的块
+// 块是否仍被文件引用由垃圾回收器按引用计数判断，在 stagingGrace 内写入的块保留，留给之后的全量扫描
+func (s *FileService) collectUploadBlocks(ctx context.Context, hashes []string) (int, error) {
+	if len(hashes) == 0 {
+		return 0, nil
+	}
+	active, err := s.activeUploadBlocks(ctx)
+	if err != nil {
+		return 0, err
+	}
+	seen := make(map[string]bool, len(hashes))
+	var orphans []string
+	for _, hash := range hashes {
+		if seen[hash] || active[hash] {
+			continue
+		}
+		seen[hash] = true
+		orphans = append(orphans, hash)
+	}
+	gc := NewGarbageCollector(s.blockStore, s.blockRepo)
+	gc.SetTransactor(s.tx)
+	gc.SetGracePeriod(s.stagingGrace)
+	return gc.Collect(ctx, orphans)
+}
+
+// activeUploadBlocks 返回所有未过期上传声明或已写入的块
+func (s *FileService) activeUploadBlocks(ctx context.Context) (map[string]bool, error) {
+	members, err := s.redisClient.ZRangeByScore(ctx, uploadIndexKey, &redis.ZRangeBy{
+		Min: "(" + strconv.FormatInt(time.Now().Unix(), 10),
+		Max: "+inf",
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list active uploads: %w", err)
+	}
+
+	active := make(map[string]bool)
+	for _, member := range members {
+		kind, id, _ := strings.Cut(member, ":")
+		switch kind {
+		case "session":
+			session, err := s.loadUploadSession(ctx, id)
+			if err != nil {
+				return nil, err
+			}
+			if session != nil {
+				for _, hash := range session.ChunkHashes {
+					active[hash] = true
+				}
+			}
+		case "tus":
+			upload, err := s.loadTusUpload(ctx, id)
+			if err != nil {
+				return nil, err
+			}
+			if upload != nil {
+				for _, hash := range upload.BlockHashes {
+					active[hash] = true
+				}
+			}
+		case "multipart":
+			parts, err := s.multipartParts(ctx, id)
+			if err != nil {
+				return nil, err
+			}
+			for _, part := range parts {
+				for _, hash := range part.BlockHashes {
+					active[hash] = true
+				}
+			}
+		}
+	}
+	return active, nil
+}
+
+// indexUpload 把上传登记到过期索引
+func (s *FileService) indexUpload(ctx context.Context, member string, expiresAt time.Time) error {
+	err := s.redisClient.ZAdd(ctx, uploadIndexKey, redis.Z{Score: float64(expiresAt.Unix()), Member: member}).Err()
+	if err != nil {
+		return fmt.Errorf("failed to index upload: %w", err)
+	}
+	return nil
+}
+
+// unindexUpload 把上传从过期索引中移除，返回是否由本次调用移除
+func (s *FileService) unindexUpload(ctx context.Context, member string) (bool, error) {
+	removed, err := s.redisClient.ZRem(ctx, uploadIndexKey, member).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to unindex upload: %w", err)
+	}
+	return removed > 0, nil
+}
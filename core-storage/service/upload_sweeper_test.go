@@ -0,0 +1,202 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/sealock/core-storage/chunker"
+	"github.com/sealock/core-storage/storage"
+)
+
+// newTestRedis 启动内存中的 Redis 并返回连接它的客户端，测试结束时关闭
+func newTestRedis(t *testing.T) *redis.Client {
+	t.Helper()
+	client := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// fixedQuota 所有用户使用相同上限和已用空间的配额
+type fixedQuota struct{ limit, used int64 }
+
+func (q fixedQuota) Quota(ctx context.Context, ownerID uint) (int64, int64, error) {
+	return q.limit, q.used, nil
+}
+
+// newQuotaTestService 创建配额为 100 字节、已用 10 字节的文件服务
+func newQuotaTestService(t *testing.T) (*FileService, *redis.Client, storage.BlockStore) {
+	t.Helper()
+	rc := newTestRedis(t)
+	blocks := storage.NewLocalBlockStore()
+	files := NewFileService(blocks, storage.NewMockFileRepository(), storage.NewMockBlockRepository(),
+		chunker.NewFixedSizeChunker(4), storage.NewMockSnapshotRepository(), rc, true)
+	t.Cleanup(func() { files.Close(context.Background()) })
+	files.SetQuotaProvider(fixedQuota{limit: 100, used: 10})
+	return files, rc, blocks
+}
+
+// chunkHashes 返回 n 个互不相同的分片哈希
+func chunkHashes(n int) []string {
+	hashes := make([]string, n)
+	for i := range hashes {
+		hashes[i] = sha256Hex([]byte{byte(i)})
+	}
+	return hashes
+}
+
+func TestUploadQuotaReservation(t *testing.T) {
+	ctx := context.Background()
+	files, _, _ := newQuotaTestService(t)
+
+	session := &UploadSession{FileName: "a.bin", FileSize: 60, ChunkHashes: chunkHashes(15), OwnerID: 7}
+	if err := files.CreateUploadSession(ctx, session); err != nil {
+		t.Fatalf("create session: %v", err)
+	}
+	if reserved, _ := files.ReservedQuota(ctx, 7); reserved != 60 {
+		t.Fatalf("reserved = %d, want 60", reserved)
+	}
+
+	// 已用 10 + 预留 60 + 40 超出 100
+	err := files.CreateUploadSession(ctx, &UploadSession{FileName: "b.bin", FileSize: 40, ChunkHashes: chunkHashes(10), OwnerID: 7})
+	if !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("over quota: error = %v, want ErrQuotaExceeded", err)
+	}
+	if reserved, _ := files.ReservedQuota(ctx, 7); reserved != 60 {
+		t.Fatalf("reserved after rejection = %d, want 60", reserved)
+	}
+
+	// 其他用户的预留互不影响，匿名上传无法计入配额而被拒绝
+	if err := files.CreateUploadSession(ctx, &UploadSession{FileName: "c.bin", FileSize: 40, ChunkHashes: chunkHashes(10), OwnerID: 8}); err != nil {
+		t.Fatalf("another owner: %v", err)
+	}
+	err = files.CreateUploadSession(ctx, &UploadSession{FileName: "d.bin", FileSize: 4, ChunkHashes: chunkHashes(1)})
+	if !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("anonymous upload: error = %v, want ErrQuotaExceeded", err)
+	}
+
+	if err := files.CleanupUploadSession(ctx, session.UploadID); err != nil {
+		t.Fatalf("cleanup: %v", err)
+	}
+	if reserved, _ := files.ReservedQuota(ctx, 7); reserved != 0 {
+		t.Fatalf("reserved after cleanup = %d, want 0", reserved)
+	}
+}
+
+func TestUploadQuotaConcurrentReservations(t *testing.T) {
+	ctx := context.Background()
+	files, _, _ := newQuotaTestService(t)
+
+	// 剩余 90 字节，每个会话 20 字节，最多 4 个成功
+	var created int32
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			session := &UploadSession{FileName: "p.bin", FileSize: 20, ChunkHashes: chunkHashes(5), OwnerID: 7}
+			if files.CreateUploadSession(ctx, session) == nil {
+				atomic.AddInt32(&created, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	if created != 4 {
+		t.Fatalf("created %d sessions, want 4", created)
+	}
+	if reserved, _ := files.ReservedQuota(ctx, 7); reserved != 80 {
+		t.Fatalf("reserved = %d, want 80", reserved)
+	}
+}
+
+func TestSweepUploads(t *testing.T) {
+	ctx := context.Background()
+	files, rc, blocks := newQuotaTestService(t)
+	// 测试中没有其他写入方，过期会话的块写入后即可回收
+	files.SetStagingGrace(0)
+
+	a, b, c := []byte("aaaa"), []byte("bbbb"), []byte("cccc")
+	expired := &UploadSession{FileName: "x.bin", FileSize: 8, ChunkHashes: []string{sha256Hex(a), sha256Hex(b)}, OwnerID: 7}
+	active := &UploadSession{FileName: "y.bin", FileSize: 8, ChunkHashes: []string{sha256Hex(b), sha256Hex(c)}, OwnerID: 7}
+	for _, session := range []*UploadSession{expired, active} {
+		if err := files.CreateUploadSession(ctx, session); err != nil {
+			t.Fatalf("create session: %v", err)
+		}
+	}
+	for i, chunk := range [][]byte{a, b} {
+		hash, err := files.StoreUploadChunk(ctx, chunk)
+		if err != nil {
+			t.Fatalf("store chunk: %v", err)
+		}
+		if err := files.RecordChunkReceived(ctx, expired, i, hash); err != nil {
+			t.Fatalf("record chunk: %v", err)
+		}
+	}
+
+	// 让第一个会话过期
+	rc.ZAdd(ctx, uploadIndexKey, redis.Z{Score: 1, Member: "session:" + expired.UploadID})
+	result, err := files.SweepUploads(ctx)
+	if err != nil {
+		t.Fatalf("sweep: %v", err)
+	}
+	if result.Sessions != 1 || result.ReleasedQuota != 8 || result.CollectedBlocks != 1 {
+		t.Fatalf("result = %+v, want 1 session, 8 bytes released and 1 block collected", result)
+	}
+
+	// 只被过期会话使用的块被回收，仍被进行中的会话声明的块保留
+	if ok, _ := blocks.Exists(ctx, sha256Hex(a)); ok {
+		t.Error("block of the expired session was not collected")
+	}
+	if ok, _ := blocks.Exists(ctx, sha256Hex(b)); !ok {
+		t.Error("block shared with an active session was collected")
+	}
+	if session, _ := files.GetUploadSession(ctx, expired.UploadID); session != nil {
+		t.Error("expired session still exists")
+	}
+	if reserved, _ := files.ReservedQuota(ctx, 7); reserved != 8 {
+		t.Fatalf("reserved = %d, want 8", reserved)
+	}
+
+	// 再次清理不会重复释放
+	if result, err := files.SweepUploads(ctx); err != nil || result.Sessions != 0 || result.ReleasedQuota != 0 {
+		t.Fatalf("second sweep = %+v, %v", result, err)
+	}
+}
+
+func TestDiscardBlocksKeepsRecentBlocks(t *testing.T) {
+	ctx := context.Background()
+	s := newUploadTestService(t)
+	if s.stagingGrace <= 0 {
+		t.Fatal("test requires the default non-zero staging grace")
+	}
+
+	// 刚存入的块可能正被其他写入方使用，放弃写入时不立即删除
+	hash, err := s.StoreUploadChunk(ctx, []byte("aaaa"))
+	if err != nil {
+		t.Fatalf("store chunk: %v", err)
+	}
+	s.discardBlocks(ctx, []string{hash})
+	if ok, _ := s.blockStore.Exists(ctx, hash); !ok {
+		t.Fatal("block within the staging grace was collected")
+	}
+
+	// 超过宽限期后仍未被引用的块被回收
+	block, _ := s.blocks.GetBlockMetadata(ctx, hash)
+	block.StagedAt = time.Now().Add(-2 * s.stagingGrace)
+	s.discardBlocks(ctx, []string{hash})
+	if ok, _ := s.blockStore.Exists(ctx, hash); ok {
+		t.Fatal("unreferenced block past the staging grace was not collected")
+	}
+}
@@ -0,0 +1,567 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sealock/core-storage/model"
+	"github.com/sealock/core-storage/storage"
+	"golang.org/x/net/webdav"
+)
+
+// WebDAVFileSystem 把用户的库映射为 WebDAV 目录树：根目录下每个库是一个目录，库内按文件路径展开
+// 读写都经过 FileService，写入的内容与其他上传方式一样分块去重，变更同样发布事件并登记自动提交。
+// 目录由文件路径隐含，MKCOL 创建的空目录只保存在内存中，放入文件后即成为真实目录
+type WebDAVFileSystem struct {
+	files       *FileService
+	libraryRepo storage.LibraryRepository
+	replication *ReplicationService // 可为 nil；非 nil 时拒绝写入只读副本
+
+	mu   sync.Mutex
+	dirs map[uint]map[string]bool // 库 ID → MKCOL 创建的空目录
+}
+
+// NewWebDAVFileSystem 创建 WebDAV 文件系统，replication 可为 nil
+func NewWebDAVFileSystem(files *FileService, lr storage.LibraryRepository, replication *ReplicationService) *WebDAVFileSystem {
+	return &WebDAVFileSystem{
+		files:       files,
+		libraryRepo: lr,
+		replication: replication,
+		dirs:        make(map[uint]map[string]bool),
+	}
+}
+
+// ForUser 返回用户视角的文件系统，只能看到和修改该用户拥有的库
+func (w *WebDAVFileSystem) ForUser(ownerID uint) webdav.FileSystem {
+	return &userDAV{WebDAVFileSystem: w, ownerID: ownerID}
+}
+
+// userDAV 某个用户的 WebDAV 文件系统视图
+type userDAV struct {
+	*WebDAVFileSystem
+	ownerID uint
+}
+
+// davTarget 解析后的 WebDAV 路径；lib 为 nil 表示根目录，path 为空表示库的根目录
+type davTarget struct {
+	lib  *model.Library
+	path string
+}
+
+// resolve 把 WebDAV 路径解析为库和库内路径
+func (u *userDAV) resolve(ctx context.Context, name string) (*davTarget, error) {
+	name = cleanPath(name)
+	if name == "" {
+		return &davTarget{}, nil
+	}
+	libName, rest, _ := strings.Cut(name, "/")
+	libs, err := u.libraryRepo.ListLibrariesByOwner(ctx, u.ownerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list libraries: %w", err)
+	}
+	for _, lib := range libs {
+		if lib.Name == libName {
+			return &davTarget{lib: lib, path: rest}, nil
+		}
+	}
+	return nil, os.ErrNotExist
+}
+
+// writable 解析路径并确认可以写入库中的文件或目录（不能是根目录或库本身，库不能是只读副本）
+func (u *userDAV) writable(ctx context.Context, name string) (*davTarget, error) {
+	target, err := u.resolve(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if target.lib == nil || target.path == "" {
+		return nil, os.ErrPermission
+	}
+	if u.replication != nil {
+		readOnly, err := u.replication.IsReadOnly(ctx, target.lib.ID)
+		if err != nil {
+			return nil, err
+		}
+		if readOnly {
+			return nil, os.ErrPermission
+		}
+	}
+	return target, nil
+}
+
+// Mkdir 在库中创建空目录，父目录必须存在
+func (u *userDAV) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+	target, err := u.writable(ctx, name)
+	if err != nil {
+		return err
+	}
+	if _, err := u.stat(ctx, target); err == nil {
+		return os.ErrExist
+	}
+	if parent := path.Dir(target.path); parent != "." {
+		info, err := u.stat(ctx, &davTarget{lib: target.lib, path: parent})
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return os.ErrNotExist
+		}
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.dirs[target.lib.ID] == nil {
+		u.dirs[target.lib.ID] = make(map[string]bool)
+	}
+	u.dirs[target.lib.ID][target.path] = true
+	return nil
+}
+
+// OpenFile 打开文件或目录；以写方式打开时内容在 Close 时写入库中
+func (u *userDAV) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_APPEND) != 0 {
+		return u.create(ctx, name, flag)
+	}
+
+	target, err := u.resolve(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := u.stat(ctx, target)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		children, err := u.readDir(ctx, target)
+		if err != nil {
+			return nil, err
+		}
+		return &davDir{info: info, children: children}, nil
+	}
+
+	reader, file, err := u.files.OpenFile(ctx, info.(*davFileInfo).id)
+	if err != nil {
+		return nil, err
+	}
+	if file == nil {
+		return nil, os.ErrNotExist
+	}
+	return &davReader{BlockReader: reader, info: info}, nil
+}
+
+// create 以写方式打开文件：只支持整体覆盖，写入的数据经管道流式交给 FileService.PutFile
+func (u *userDAV) create(ctx context.Context, name string, flag int) (webdav.File, error) {
+	target, err := u.writable(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if flag&os.O_APPEND != 0 {
+		return nil, os.ErrPermission
+	}
+	info, err := u.stat(ctx, target)
+	switch {
+	case err == nil && info.IsDir():
+		return nil, os.ErrPermission
+	case err != nil && flag&os.O_CREATE == 0:
+		return nil, err
+	case err == nil && flag&os.O_TRUNC == 0:
+		// 不支持在原有内容上部分改写
+		return nil, os.ErrPermission
+	}
+
+	// 请求体的声明长度交给 PutFile 校验，读取到的内容不足时不保存
+	body, _ := ctx.Value(davBodyKey{}).(*davBody)
+	size := int64(-1)
+	if body != nil {
+		size = body.size
+	}
+	pr, pw := io.Pipe()
+	w := &davWriter{
+		pipe: pw,
+		done: make(chan error, 1),
+		body: body,
+		info: &davFileInfo{name: path.Base(target.path), modTime: time.Now()},
+	}
+	go func() {
+		_, err := u.files.PutFile(ctx, target.lib.ID, u.ownerID, target.path, pr, size)
+		pr.CloseWithError(err)
+		w.done <- err
+	}()
+	return w, nil
+}
+
+// errDAVBodyIncomplete PUT 请求体读取失败，已收到的内容不保存
+var errDAVBodyIncomplete = errors.New("webdav: request body incomplete")
+
+// davBodyKey 请求上下文中 PUT 请求体的键
+type davBodyKey struct{}
+
+// davBody 记录 PUT 请求体的声明长度和读取错误
+// webdav.Handler 在复制请求体失败后仍会关闭文件，写入方据此放弃保存
+type davBody struct {
+	io.ReadCloser
+	size int64 // Content-Length，未知时为 -1
+
+	mu  sync.Mutex
+	err error
+}
+
+func (b *davBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil && err != io.EOF {
+		b.mu.Lock()
+		b.err = err
+		b.mu.Unlock()
+	}
+	return n, err
+}
+
+// readErr 返回读取请求体时遇到的错误
+func (b *davBody) readErr() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.err
+}
+
+// WithDAVRequestBody 包装 WebDAV PUT 请求的请求体，使写入文件时按 Content-Length 校验长度，
+// 并在请求体读取失败（如连接中断）时放弃保存，不会用不完整的内容覆盖原有文件
+func WithDAVRequestBody(r *http.Request) *http.Request {
+	body := &davBody{ReadCloser: r.Body, size: r.ContentLength}
+	r = r.WithContext(context.WithValue(r.Context(), davBodyKey{}, body))
+	r.Body = body
+	return r
+}
+
+// RemoveAll 删除文件或目录及其下的所有文件
+func (u *userDAV) RemoveAll(ctx context.Context, name string) error {
+	target, err := u.writable(ctx, name)
+	if err != nil {
+		return err
+	}
+	files, err := u.files.ListLibraryFiles(ctx, target.lib.ID)
+	if err != nil {
+		return err
+	}
+	prefix := target.path + "/"
+	for _, file := range files {
+		filePath := cleanPath(file.Name)
+		if filePath != target.path && !strings.HasPrefix(filePath, prefix) {
+			continue
+		}
+		if _, err := u.files.RemoveFile(ctx, target.lib.ID, filePath); err != nil {
+			return err
+		}
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	for dir := range u.dirs[target.lib.ID] {
+		if dir == target.path || strings.HasPrefix(dir, prefix) {
+			delete(u.dirs[target.lib.ID], dir)
+		}
+	}
+	return nil
+}
+
+// Rename 在同一个库内移动文件或目录，目标已存在时由调用方（webdav.Handler）先行删除
+func (u *userDAV) Rename(ctx context.Context, oldName, newName string) error {
+	from, err := u.writable(ctx, oldName)
+	if err != nil {
+		return err
+	}
+	to, err := u.writable(ctx, newName)
+	if err != nil {
+		return err
+	}
+	if from.lib.ID != to.lib.ID || to.path == from.path || strings.HasPrefix(to.path, from.path+"/") {
+		return os.ErrPermission
+	}
+	info, err := u.stat(ctx, from)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		_, err := u.files.MoveFile(ctx, from.lib.ID, from.path, to.path)
+		return err
+	}
+
+	files, err := u.files.ListLibraryFiles(ctx, from.lib.ID)
+	if err != nil {
+		return err
+	}
+	prefix := from.path + "/"
+	for _, file := range files {
+		filePath := cleanPath(file.Name)
+		if !strings.HasPrefix(filePath, prefix) {
+			continue
+		}
+		if _, err := u.files.MoveFile(ctx, from.lib.ID, filePath, to.path+"/"+strings.TrimPrefix(filePath, prefix)); err != nil {
+			return err
+		}
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	dirs := u.dirs[from.lib.ID]
+	for dir := range dirs {
+		if dir == from.path || strings.HasPrefix(dir, prefix) {
+			delete(dirs, dir)
+			dirs[to.path+strings.TrimPrefix(dir, from.path)] = true
+		}
+	}
+	return nil
+}
+
+// Stat 返回文件或目录的信息
+func (u *userDAV) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	target, err := u.resolve(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return u.stat(ctx, target)
+}
+
+// stat 返回解析后路径的信息：库中的文件、由文件路径隐含的目录或 MKCOL 创建的空目录
+func (u *userDAV) stat(ctx context.Context, target *davTarget) (os.FileInfo, error) {
+	if target.lib == nil {
+		return &davFileInfo{name: "/", dir: true, modTime: time.Now()}, nil
+	}
+	if target.path == "" {
+		return &davFileInfo{name: target.lib.Name, dir: true, modTime: target.lib.UpdatedAt}, nil
+	}
+
+	file, err := u.files.GetFileByPath(ctx, target.lib.ID, target.path)
+	if err != nil {
+		return nil, err
+	}
+	if file != nil {
+		return davInfoOf(path.Base(target.path), file), nil
+	}
+
+	if u.hasDir(target.lib.ID, target.path) {
+		return &davFileInfo{name: path.Base(target.path), dir: true, modTime: time.Now()}, nil
+	}
+	files, err := u.files.ListLibraryFiles(ctx, target.lib.ID)
+	if err != nil {
+		return nil, err
+	}
+	prefix := target.path + "/"
+	dir := &davFileInfo{name: path.Base(target.path), dir: true}
+	found := false
+	for _, file := range files {
+		if !strings.HasPrefix(cleanPath(file.Name), prefix) {
+			continue
+		}
+		found = true
+		if file.UpdatedAt.After(dir.modTime) {
+			dir.modTime = file.UpdatedAt
+		}
+	}
+	if !found {
+		return nil, os.ErrNotExist
+	}
+	return dir, nil
+}
+
+// readDir 列出目录的直接子项：根目录列出用户的库，库内目录由文件路径和空目录计算
+func (u *userDAV) readDir(ctx context.Context, target *davTarget) ([]os.FileInfo, error) {
+	if target.lib == nil {
+		libs, err := u.libraryRepo.ListLibrariesByOwner(ctx, u.ownerID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list libraries: %w", err)
+		}
+		children := make([]os.FileInfo, 0, len(libs))
+		for _, lib := range libs {
+			children = append(children, &davFileInfo{name: lib.Name, dir: true, modTime: lib.UpdatedAt})
+		}
+		sortInfos(children)
+		return children, nil
+	}
+
+	files, err := u.files.ListLibraryFiles(ctx, target.lib.ID)
+	if err != nil {
+		return nil, err
+	}
+	prefix := ""
+	if target.path != "" {
+		prefix = target.path + "/"
+	}
+	dirs := make(map[string]*davFileInfo)
+	var children []os.FileInfo
+	for i := range files {
+		filePath := cleanPath(files[i].Name)
+		if !strings.HasPrefix(filePath, prefix) {
+			continue
+		}
+		rest := strings.TrimPrefix(filePath, prefix)
+		if child, _, nested := strings.Cut(rest, "/"); nested {
+			dir, exists := dirs[child]
+			if !exists {
+				dir = &davFileInfo{name: child, dir: true}
+				dirs[child] = dir
+			}
+			if files[i].UpdatedAt.After(dir.modTime) {
+				dir.modTime = files[i].UpdatedAt
+			}
+			continue
+		}
+		children = append(children, davInfoOf(rest, &files[i]))
+	}
+
+	u.mu.Lock()
+	for dir := range u.dirs[target.lib.ID] {
+		if !strings.HasPrefix(dir, prefix) {
+			continue
+		}
+		child, _, _ := strings.Cut(strings.TrimPrefix(dir, prefix), "/")
+		if _, exists := dirs[child]; !exists {
+			dirs[child] = &davFileInfo{name: child, dir: true, modTime: time.Now()}
+		}
+	}
+	u.mu.Unlock()
+
+	for _, dir := range dirs {
+		children = append(children, dir)
+	}
+	sortInfos(children)
+	return children, nil
+}
+
+// hasDir 判断是否为 MKCOL 创建的空目录或其上级目录
+func (u *userDAV) hasDir(libraryID uint, dirPath string) bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	for dir := range u.dirs[libraryID] {
+		if dir == dirPath || strings.HasPrefix(dir, dirPath+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// sortInfos 目录在前，同类按名称排序
+func sortInfos(infos []os.FileInfo) {
+	sort.Slice(infos, func(i, j int) bool {
+		if infos[i].IsDir() != infos[j].IsDir() {
+			return infos[i].IsDir()
+		}
+		return infos[i].Name() < infos[j].Name()
+	})
+}
+
+// davFileInfo 文件或目录的信息，文件的 ETag 为内容哈希
+type davFileInfo struct {
+	id      uint
+	name    string
+	size    int64
+	hash    string
+	dir     bool
+	modTime time.Time
+}
+
+// davInfoOf 由库中的文件记录生成文件信息
+func davInfoOf(name string, file *model.File) *davFileInfo {
+	return &davFileInfo{id: file.ID, name: name, size: file.Size, hash: file.Hash, modTime: file.UpdatedAt}
+}
+
+func (i *davFileInfo) Name() string       { return i.name }
+func (i *davFileInfo) Size() int64        { return i.size }
+func (i *davFileInfo) ModTime() time.Time { return i.modTime }
+func (i *davFileInfo) IsDir() bool        { return i.dir }
+func (i *davFileInfo) Sys() interface{}   { return nil }
+
+func (i *davFileInfo) Mode() fs.FileMode {
+	if i.dir {
+		return fs.ModeDir | 0755
+	}
+	return 0644
+}
+
+// ETag 实现 webdav.ETager，文件以内容哈希作为 ETag
+func (i *davFileInfo) ETag(ctx context.Context) (string, error) {
+	if i.dir || i.hash == "" {
+		return "", webdav.ErrNotImplemented
+	}
+	return `"` + i.hash + `"`, nil
+}
+
+// davDir 以只读方式打开的目录
+type davDir struct {
+	info     os.FileInfo
+	children []os.FileInfo
+	pos      int
+}
+
+func (d *davDir) Close() error                                 { return nil }
+func (d *davDir) Read(p []byte) (int, error)                   { return 0, fs.ErrInvalid }
+func (d *davDir) Seek(offset int64, whence int) (int64, error) { return 0, fs.ErrInvalid }
+func (d *davDir) Write(p []byte) (int, error)                  { return 0, fs.ErrPermission }
+func (d *davDir) Stat() (os.FileInfo, error)                   { return d.info, nil }
+
+// Readdir 按 os.File.Readdir 的约定返回子项
+func (d *davDir) Readdir(count int) ([]os.FileInfo, error) {
+	remaining := d.children[d.pos:]
+	if count <= 0 {
+		d.pos = len(d.children)
+		return remaining, nil
+	}
+	if len(remaining) == 0 {
+		return nil, io.EOF
+	}
+	if count > len(remaining) {
+		count = len(remaining)
+	}
+	d.pos += count
+	return remaining[:count], nil
+}
+
+// davReader 以只读方式打开的文件，从块存储按需读取
+type davReader struct {
+	*BlockReader
+	info os.FileInfo
+}
+
+func (r *davReader) Readdir(count int) ([]os.FileInfo, error) { return nil, fs.ErrInvalid }
+func (r *davReader) Write(p []byte) (int, error)              { return 0, fs.ErrPermission }
+func (r *davReader) Stat() (os.FileInfo, error)               { return r.info, nil }
+
+// davWriter 以写方式打开的文件，写入的数据经管道交给后台的 PutFile，Close 时等待其完成
+type davWriter struct {
+	pipe *io.PipeWriter
+	done chan error
+	body *davBody // 请求体，未经 WithDAVRequestBody 包装时为 nil
+	info *davFileInfo
+}
+
+func (w *davWriter) Read(p []byte) (int, error)                   { return 0, fs.ErrInvalid }
+func (w *davWriter) Seek(offset int64, whence int) (int64, error) { return 0, fs.ErrInvalid }
+func (w *davWriter) Readdir(count int) ([]os.FileInfo, error)     { return nil, fs.ErrInvalid }
+func (w *davWriter) Stat() (os.FileInfo, error)                   { return w.info, nil }
+
+func (w *davWriter) Write(p []byte) (int, error) {
+	n, err := w.pipe.Write(p)
+	w.info.size += int64(n)
+	return n, err
+}
+
+// Close 结束写入并返回保存文件的结果；请求体读取失败时中止 PutFile，文件保持不变
+func (w *davWriter) Close() error {
+	if w.body != nil {
+		if err := w.body.readErr(); err != nil {
+			w.pipe.CloseWithError(fmt.Errorf("%w: %v", errDAVBodyIncomplete, err))
+			<-w.done
+			return err
+		}
+	}
+	w.pipe.Close()
+	return <-w.done
+}
@@ -3,9 +3,11 @@ package storage
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/sealock/core-storage/model"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // blockRepository implements BlockRepository interface
@@ -18,9 +20,14 @@ func NewBlockRepository(db *gorm.DB) BlockRepository {
 	return &blockRepository{db: db}
 }
 
-// SaveBlockMetadata 保存 Block 的元数据
+// SaveBlockMetadata 保存 Block 的元数据，已存在同一哈希的块时只刷新写入时间
 func (r *blockRepository) SaveBlockMetadata(ctx context.Context, block *model.Block) error {
-	if err := r.db.WithContext(ctx).Create(block).Error; err != nil {
+	block.StagedAt = time.Now()
+	err := conn(ctx, r.db).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "hash"}},
+		DoUpdates: clause.AssignmentColumns([]string{"staged_at"}),
+	}).Create(block).Error
+	if err != nil {
 		return fmt.Errorf("failed to save block metadata: %w", err)
 	}
 	return nil
@@ -29,7 +36,7 @@ func (r *blockRepository) SaveBlockMetadata(ctx context.Context, block *model.Bl
 // GetBlockMetadata 获取 Block 元数据
 func (r *blockRepository) GetBlockMetadata(ctx context.Context, hash string) (*model.Block, error) {
 	var block model.Block
-	if err := r.db.WithContext(ctx).Where("hash = ?", hash).First(&block).Error; err != nil {
+	if err := conn(ctx, r.db).Where("hash = ?", hash).First(&block).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return nil, fmt.Errorf("block not found: %s", hash)
 		}
@@ -39,26 +46,23 @@ func (r *blockRepository) GetBlockMetadata(ctx context.Context, hash string) (*m
 }
 
 // IncrementRefCount 增加引用计数
+// 在数据库中原子地累加，并发的引用与释放不会互相覆盖
 func (r *blockRepository) IncrementRefCount(ctx context.Context, hash string, delta int) error {
-	var block model.Block
-	err := r.db.WithContext(ctx).Where("hash = ?", hash).First(&block).Error
-	if err != nil {
-		return fmt.Errorf("failed to find block: %w", err)
+	result := conn(ctx, r.db).Model(&model.Block{}).Where("hash = ?", hash).
+		UpdateColumn("ref_count", gorm.Expr("ref_count + ?", delta))
+	if result.Error != nil {
+		return fmt.Errorf("failed to increment ref count: %w", result.Error)
 	}
-
-	block.RefCount += delta
-	err = r.db.WithContext(ctx).Save(&block).Error
-	if err != nil {
-		return fmt.Errorf("failed to increment ref count: %w", err)
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("failed to find block: %s", hash)
 	}
-
 	return nil
 }
 
 // ListOrphanBlocks 列出引用计数为 0 的 Block
 func (r *blockRepository) ListOrphanBlocks(ctx context.Context) ([]string, error) {
 	var blocks []model.Block
-	err := r.db.WithContext(ctx).Where("ref_count = 0").Find(&blocks).Error
+	err := conn(ctx, r.db).Where("ref_count = 0").Find(&blocks).Error
 	if err != nil {
 		return nil, fmt.Errorf("failed to list orphan blocks: %w", err)
 	}
@@ -71,20 +75,30 @@ func (r *blockRepository) ListOrphanBlocks(ctx context.Context) ([]string, error
 	return hashes, nil
 }
 
-// DecrementBlockRefCount 减少块的引用计数
-func (r *blockRepository) DecrementBlockRefCount(ctx context.Context, hash string) error {
-	var block model.Block
-	err := r.db.WithContext(ctx).Where("hash = ?", hash).First(&block).Error
-	if err != nil {
-		return fmt.Errorf("failed to find block: %w", err)
+// DeleteBlockMetadata 在块引用计数为 0 且最后写入早于 stagedBefore 时删除其元数据，返回是否删除
+func (r *blockRepository) DeleteBlockMetadata(ctx context.Context, hash string, stagedBefore time.Time) (bool, error) {
+	result := conn(ctx, r.db).Where("hash = ? AND ref_count = 0 AND staged_at < ?", hash, stagedBefore).Delete(&model.Block{})
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to delete block metadata: %w", result.Error)
 	}
+	return result.RowsAffected > 0, nil
+}
 
-	if block.RefCount > 0 {
-		block.RefCount--
-		err = r.db.WithContext(ctx).Save(&block).Error
-		if err != nil {
-			return fmt.Errorf("failed to decrement ref count: %w", err)
+// DecrementBlockRefCount 减少块的引用计数，已为 0 时保持不变
+func (r *blockRepository) DecrementBlockRefCount(ctx context.Context, hash string) error {
+	result := conn(ctx, r.db).Model(&model.Block{}).Where("hash = ? AND ref_count > 0", hash).
+		UpdateColumn("ref_count", gorm.Expr("ref_count - 1"))
+	if result.Error != nil {
+		return fmt.Errorf("failed to decrement ref count: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		var count int64
+		if err := conn(ctx, r.db).Model(&model.Block{}).Where("hash = ?", hash).Count(&count).Error; err != nil {
+			return fmt.Errorf("failed to find block: %w", err)
+		}
+		if count == 0 {
+			return fmt.Errorf("failed to find block: %s", hash)
 		}
 	}
 	return nil
-}
\ No newline at end of file
+}
@@ -0,0 +1,74 @@
+package storage
+
+import (
+	"context"
+	"errors"
+
+	"github.com/sealock/core-storage/model"
+	"gorm.io/gorm"
+)
+
+type conflictRepository struct {
+	db *gorm.DB
+}
+
+// NewConflictRepository creates a new sync conflict repository
+func NewConflictRepository(db *gorm.DB) ConflictRepository {
+	return &conflictRepository{db: db}
+}
+
+func (r *conflictRepository) CreateConflict(ctx context.Context, conflict *model.SyncConflict) error {
+	return conn(ctx, r.db).Create(conflict).Error
+}
+
+func (r *conflictRepository) GetConflict(ctx context.Context, id uint) (*model.SyncConflict, error) {
+	var conflict model.SyncConflict
+	err := conn(ctx, r.db).First(&conflict, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &conflict, nil
+}
+
+func (r *conflictRepository) ListConflicts(ctx context.Context, libraryID uint, status string) ([]model.SyncConflict, error) {
+	var conflicts []model.SyncConflict
+	query := conn(ctx, r.db).Where("library_id = ?", libraryID)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if err := query.Order("created_at DESC, id DESC").Find(&conflicts).Error; err != nil {
+		return nil, err
+	}
+	return conflicts, nil
+}
+
+func (r *conflictRepository) UpdateConflict(ctx context.Context, conflict *model.SyncConflict) error {
+	return conn(ctx, r.db).Save(conflict).Error
+}
+
+func (r *conflictRepository) GetSettings(ctx context.Context, libraryID uint) (*model.SyncSettings, error) {
+	var settings model.SyncSettings
+	err := conn(ctx, r.db).Where("library_id = ?", libraryID).First(&settings).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &settings, nil
+}
+
+func (r *conflictRepository) SaveSettings(ctx context.Context, settings *model.SyncSettings) error {
+	existing, err := r.GetSettings(ctx, settings.LibraryID)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		settings.ID = existing.ID
+		settings.CreatedAt = existing.CreatedAt
+	}
+	return conn(ctx, r.db).Save(settings).Error
+}
@@ -29,6 +29,11 @@ type StorageStack struct {
 	LibraryVersionRepo LibraryVersionRepository
 	BlockRepository    BlockRepository
 	SnapshotRepository SnapshotRepository
+	RetentionRepo      RetentionPolicyRepository
+	ConflictRepo       ConflictRepository
+	ReplicationRepo    ReplicationRepository
+	S3KeyRepo          S3KeyRepository
+	Transactor         Transactor // 跨仓库的数据库事务
 	CloseFunc          func() error // 清理函数
 }
 
@@ -41,6 +46,10 @@ func (sf *StorageFactory) CreateLocalStack() (*StorageStack, error) {
 	libVersionRepo := NewGormLibraryVersionRepository(sf.db)
 	blockRepo := NewBlockRepository(sf.db)  // 使用接口实现
 	snapshotRepo := NewSnapshotRepository(sf.db)
+	retentionRepo := NewRetentionPolicyRepository(sf.db)
+	conflictRepo := NewConflictRepository(sf.db)
+	replicationRepo := NewReplicationRepository(sf.db)
+	s3KeyRepo := NewS3KeyRepository(sf.db)
 
 	return &StorageStack{
 		BlockStore:         blockStore,
@@ -49,6 +58,11 @@ func (sf *StorageFactory) CreateLocalStack() (*StorageStack, error) {
 		LibraryVersionRepo: libVersionRepo,
 		BlockRepository:    blockRepo,
 		SnapshotRepository: snapshotRepo,
+		RetentionRepo:      retentionRepo,
+		ConflictRepo:       conflictRepo,
+		ReplicationRepo:    replicationRepo,
+		S3KeyRepo:          s3KeyRepo,
+		Transactor:         NewTransactor(sf.db),
 	}, nil
 }
 
@@ -71,6 +85,10 @@ func (sf *StorageFactory) CreateCachedLocalStack(
 	libVersionRepo := NewGormLibraryVersionRepository(sf.db)
 	blockRepo := NewBlockRepository(sf.db)  // 使用接口实现
 	snapshotRepo := NewSnapshotRepository(sf.db)
+	retentionRepo := NewRetentionPolicyRepository(sf.db)
+	conflictRepo := NewConflictRepository(sf.db)
+	replicationRepo := NewReplicationRepository(sf.db)
+	s3KeyRepo := NewS3KeyRepository(sf.db)
 
 	return &StorageStack{
 		BlockStore:         cachedStore,
@@ -79,6 +97,11 @@ func (sf *StorageFactory) CreateCachedLocalStack(
 		LibraryVersionRepo: libVersionRepo,
 		BlockRepository:    blockRepo,
 		SnapshotRepository: snapshotRepo,
+		RetentionRepo:      retentionRepo,
+		ConflictRepo:       conflictRepo,
+		ReplicationRepo:    replicationRepo,
+		S3KeyRepo:          s3KeyRepo,
+		Transactor:         NewTransactor(sf.db),
 		CloseFunc: func() error {
 		return cachedStore.Close()
 		},
@@ -107,7 +130,7 @@ func InitializeStorage(cfg StorageConfig) (*StorageStack, error) {
 	}
 
 	// 自动迁移模式
-	err = db.AutoMigrate(&model.File{}, &model.Block{}, &model.Library{}, &model.LibraryVersion{}, &model.Snapshot{})
+	err = db.AutoMigrate(&model.File{}, &model.Block{}, &model.Library{}, &model.LibraryVersion{}, &model.Snapshot{}, &model.SnapshotFile{}, &model.RetentionPolicy{}, &model.SyncConflict{}, &model.SyncSettings{}, &model.Replication{}, &model.S3AccessKey{})
 	if err != nil {
 		return nil, fmt.Errorf("failed to migrate database: %w", err)
 	}
@@ -145,6 +168,10 @@ func InitializeStorage(cfg StorageConfig) (*StorageStack, error) {
 		libVersionRepo := NewGormLibraryVersionRepository(db)
 		blockRepo := NewBlockRepository(db)  // 使用接口实现
 		snapshotRepo := NewSnapshotRepository(db)
+		retentionRepo := NewRetentionPolicyRepository(db)
+		conflictRepo := NewConflictRepository(db)
+		replicationRepo := NewReplicationRepository(db)
+		s3KeyRepo := NewS3KeyRepository(db)
 
 		return &StorageStack{
 			BlockStore:         cachedStore,
@@ -153,6 +180,11 @@ func InitializeStorage(cfg StorageConfig) (*StorageStack, error) {
 			LibraryVersionRepo: libVersionRepo,
 			BlockRepository:    blockRepo,
 			SnapshotRepository: snapshotRepo,
+			RetentionRepo:      retentionRepo,
+			ConflictRepo:       conflictRepo,
+			ReplicationRepo:    replicationRepo,
+			S3KeyRepo:          s3KeyRepo,
+			Transactor:         NewTransactor(db),
 			CloseFunc: func() error {
 				return redisClient.Close()
 			},
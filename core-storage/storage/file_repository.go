@@ -2,12 +2,16 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"fmt"
 
 	"github.com/sealock/core-storage/model"
 	"gorm.io/gorm"
 )
 
+// ErrFileNotFound is returned by GetFileByHash and GetFileByID when no file matches
+var ErrFileNotFound = errors.New("file not found")
+
 // fileRepository implements FileRepository interface
 type fileRepository struct {
 	db *gorm.DB
@@ -20,7 +24,7 @@ func NewFileRepository(db *gorm.DB) FileRepository {
 
 // CreateFile creates a file record
 func (r *fileRepository) CreateFile(ctx context.Context, file *model.File) error {
-	if err := r.db.WithContext(ctx).Create(file).Error; err != nil {
+	if err := conn(ctx, r.db).Create(file).Error; err != nil {
 		return fmt.Errorf("failed to create file: %w", err)
 	}
 	return nil
@@ -29,9 +33,9 @@ func (r *fileRepository) CreateFile(ctx context.Context, file *model.File) error
 // GetFileByHash retrieves a file by its hash
 func (r *fileRepository) GetFileByHash(ctx context.Context, hash string) (*model.File, error) {
 	var file model.File
-	if err := r.db.WithContext(ctx).Where("hash = ?", hash).First(&file).Error; err != nil {
+	if err := conn(ctx, r.db).Where("hash = ?", hash).First(&file).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			return nil, fmt.Errorf("file not found: %s", hash)
+			return nil, fmt.Errorf("%w: %s", ErrFileNotFound, hash)
 		}
 		return nil, fmt.Errorf("failed to query file: %w", err)
 	}
@@ -40,7 +44,7 @@ func (r *fileRepository) GetFileByHash(ctx context.Context, hash string) (*model
 
 // UpdateFile updates a file record
 func (r *fileRepository) UpdateFile(ctx context.Context, file *model.File) error {
-	if err := r.db.WithContext(ctx).Save(file).Error; err != nil {
+	if err := conn(ctx, r.db).Save(file).Error; err != nil {
 		return fmt.Errorf("failed to update file: %w", err)
 	}
 	return nil
@@ -48,7 +52,7 @@ func (r *fileRepository) UpdateFile(ctx context.Context, file *model.File) error
 
 // DeleteFile deletes a file by ID
 func (r *fileRepository) DeleteFile(ctx context.Context, fileID uint) error {
-	err := r.db.WithContext(ctx).Delete(&model.File{}, fileID).Error
+	err := conn(ctx, r.db).Delete(&model.File{}, fileID).Error
 	if err != nil {
 		return fmt.Errorf("failed to delete file: %w", err)
 	}
@@ -58,9 +62,58 @@ func (r *fileRepository) DeleteFile(ctx context.Context, fileID uint) error {
 // GetAllFiles 获取所有文件
 func (r *fileRepository) GetAllFiles(ctx context.Context) ([]model.File, error) {
 	var files []model.File
-	err := r.db.WithContext(ctx).Find(&files).Error
+	err := conn(ctx, r.db).Find(&files).Error
 	if err != nil {
 		return nil, fmt.Errorf("failed to get all files: %w", err)
 	}
 	return files, nil
-}
\ No newline at end of file
+}
+
+// GetFileByID retrieves a file by its ID
+func (r *fileRepository) GetFileByID(ctx context.Context, fileID uint) (*model.File, error) {
+	var file model.File
+	if err := conn(ctx, r.db).First(&file, fileID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("%w: %d", ErrFileNotFound, fileID)
+		}
+		return nil, fmt.Errorf("failed to query file: %w", err)
+	}
+	return &file, nil
+}
+
+// GetFileByPath retrieves a file by its path inside a library, nil if absent
+func (r *fileRepository) GetFileByPath(ctx context.Context, libraryID uint, path string) (*model.File, error) {
+	var file model.File
+	err := conn(ctx, r.db).Where("library_id = ? AND name = ?", libraryID, path).First(&file).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query file: %w", err)
+	}
+	return &file, nil
+}
+
+// ListFilesByLibrary lists all files of a library ordered by path
+func (r *fileRepository) ListFilesByLibrary(ctx context.Context, libraryID uint) ([]model.File, error) {
+	var files []model.File
+	if err := conn(ctx, r.db).Where("library_id = ?", libraryID).Order("name").Find(&files).Error; err != nil {
+		return nil, fmt.Errorf("failed to list files: %w", err)
+	}
+	return files, nil
+}
+
+// HashExistsInLibraries reports whether any file in the libraries has the content hash
+func (r *fileRepository) HashExistsInLibraries(ctx context.Context, libraryIDs []uint, hash string) (bool, error) {
+	return hashExistsInLibraries(conn(ctx, r.db), libraryIDs, hash)
+}
+
+// SumFileSizes returns the total size of the files in the libraries
+func (r *fileRepository) SumFileSizes(ctx context.Context, libraryIDs []uint) (int64, error) {
+	return sumFileSizes(conn(ctx, r.db), libraryIDs)
+}
+
+// FindBlocksInLibraries returns the hashes referenced by files in the libraries
+func (r *fileRepository) FindBlocksInLibraries(ctx context.Context, libraryIDs []uint, hashes []string) (map[string]bool, error) {
+	return findBlocksInLibraries(conn(ctx, r.db), libraryIDs, hashes)
+}
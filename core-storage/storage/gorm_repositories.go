@@ -2,12 +2,18 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"time"
 
 	"github.com/sealock/core-storage/model"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// ErrLibraryNotFound GetLibraryByID 找不到库时返回
+var ErrLibraryNotFound = errors.New("library not found")
+
 // GormFileRepository 基于 GORM 的文件仓储实现
 type GormFileRepository struct {
 	db *gorm.DB
@@ -50,7 +56,7 @@ func NewGormLibraryVersionRepository(db *gorm.DB) *GormLibraryVersionRepository
 
 // CreateFile 创建文件记录
 func (r *GormFileRepository) CreateFile(ctx context.Context, file *model.File) error {
-	if err := r.db.WithContext(ctx).Create(file).Error; err != nil {
+	if err := conn(ctx, r.db).Create(file).Error; err != nil {
 		return fmt.Errorf("failed to create file: %w", err)
 	}
 	return nil
@@ -59,9 +65,9 @@ func (r *GormFileRepository) CreateFile(ctx context.Context, file *model.File) e
 // GetFileByHash 通过文件 hash 获取文件
 func (r *GormFileRepository) GetFileByHash(ctx context.Context, hash string) (*model.File, error) {
 	var file model.File
-	if err := r.db.WithContext(ctx).Where("hash = ?", hash).First(&file).Error; err != nil {
+	if err := conn(ctx, r.db).Where("hash = ?", hash).First(&file).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			return nil, fmt.Errorf("file not found: %s", hash)
+			return nil, fmt.Errorf("%w: %s", ErrFileNotFound, hash)
 		}
 		return nil, fmt.Errorf("failed to query file: %w", err)
 	}
@@ -70,7 +76,7 @@ func (r *GormFileRepository) GetFileByHash(ctx context.Context, hash string) (*m
 
 // UpdateFile 更新文件
 func (r *GormFileRepository) UpdateFile(ctx context.Context, file *model.File) error {
-	if err := r.db.WithContext(ctx).Save(file).Error; err != nil {
+	if err := conn(ctx, r.db).Save(file).Error; err != nil {
 		return fmt.Errorf("failed to update file: %w", err)
 	}
 	return nil
@@ -78,7 +84,7 @@ func (r *GormFileRepository) UpdateFile(ctx context.Context, file *model.File) e
 
 // DeleteFile 删除文件
 func (r *GormFileRepository) DeleteFile(ctx context.Context, fileID uint) error {
-	err := r.db.WithContext(ctx).Delete(&model.File{}, fileID).Error
+	err := conn(ctx, r.db).Delete(&model.File{}, fileID).Error
 	if err != nil {
 		return fmt.Errorf("failed to delete file: %w", err)
 	}
@@ -88,16 +94,114 @@ func (r *GormFileRepository) DeleteFile(ctx context.Context, fileID uint) error
 // GetAllFiles 获取所有文件
 func (r *GormFileRepository) GetAllFiles(ctx context.Context) ([]model.File, error) {
 	var files []model.File
-	err := r.db.WithContext(ctx).Find(&files).Error
+	err := conn(ctx, r.db).Find(&files).Error
 	if err != nil {
 		return nil, fmt.Errorf("failed to get all files: %w", err)
 	}
 	return files, nil
 }
 
-// SaveBlockMetadata 保存 Block 的元数据
+// GetFileByID 通过 ID 获取文件
+func (r *GormFileRepository) GetFileByID(ctx context.Context, fileID uint) (*model.File, error) {
+	var file model.File
+	if err := conn(ctx, r.db).First(&file, fileID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("%w: %d", ErrFileNotFound, fileID)
+		}
+		return nil, fmt.Errorf("failed to query file: %w", err)
+	}
+	return &file, nil
+}
+
+// GetFileByPath 通过库内路径获取文件，不存在时返回 nil
+func (r *GormFileRepository) GetFileByPath(ctx context.Context, libraryID uint, path string) (*model.File, error) {
+	var file model.File
+	err := conn(ctx, r.db).Where("library_id = ? AND name = ?", libraryID, path).First(&file).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query file: %w", err)
+	}
+	return &file, nil
+}
+
+// ListFilesByLibrary 列出库中的所有文件
+func (r *GormFileRepository) ListFilesByLibrary(ctx context.Context, libraryID uint) ([]model.File, error) {
+	var files []model.File
+	if err := conn(ctx, r.db).Where("library_id = ?", libraryID).Order("name").Find(&files).Error; err != nil {
+		return nil, fmt.Errorf("failed to list files: %w", err)
+	}
+	return files, nil
+}
+
+// HashExistsInLibraries 判断这些库中是否有内容哈希为 hash 的文件
+func (r *GormFileRepository) HashExistsInLibraries(ctx context.Context, libraryIDs []uint, hash string) (bool, error) {
+	return hashExistsInLibraries(conn(ctx, r.db), libraryIDs, hash)
+}
+
+// FindBlocksInLibraries 返回 hashes 中被这些库的文件引用的块
+func (r *GormFileRepository) FindBlocksInLibraries(ctx context.Context, libraryIDs []uint, hashes []string) (map[string]bool, error) {
+	return findBlocksInLibraries(conn(ctx, r.db), libraryIDs, hashes)
+}
+
+// SumFileSizes 返回这些库中文件大小之和
+func (r *GormFileRepository) SumFileSizes(ctx context.Context, libraryIDs []uint) (int64, error) {
+	return sumFileSizes(conn(ctx, r.db), libraryIDs)
+}
+
+// sumFileSizes 两个文件仓库实现共用的文件大小统计
+func sumFileSizes(db *gorm.DB, libraryIDs []uint) (int64, error) {
+	if len(libraryIDs) == 0 {
+		return 0, nil
+	}
+	var total int64
+	err := db.Model(&model.File{}).Where("library_id IN ?", libraryIDs).Select("COALESCE(SUM(size), 0)").Scan(&total).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to sum file sizes: %w", err)
+	}
+	return total, nil
+}
+
+// hashExistsInLibraries 两个文件仓库实现共用的内容哈希查询
+func hashExistsInLibraries(db *gorm.DB, libraryIDs []uint, hash string) (bool, error) {
+	if len(libraryIDs) == 0 {
+		return false, nil
+	}
+	var count int64
+	err := db.Model(&model.File{}).Where("library_id IN ? AND hash = ?", libraryIDs, hash).Limit(1).Count(&count).Error
+	if err != nil {
+		return false, fmt.Errorf("failed to query file hash: %w", err)
+	}
+	return count > 0, nil
+}
+
+// findBlocksInLibraries 两个文件仓库实现共用的块引用查询，展开文件的 block_ids 数组后按块哈希过滤
+func findBlocksInLibraries(db *gorm.DB, libraryIDs []uint, hashes []string) (map[string]bool, error) {
+	found := make(map[string]bool)
+	if len(libraryIDs) == 0 || len(hashes) == 0 {
+		return found, nil
+	}
+	var rows []string
+	err := db.Raw(`SELECT DISTINCT b.hash FROM files, jsonb_array_elements_text(files.block_ids) AS b(hash)
+		WHERE files.library_id IN ? AND b.hash IN ?`, libraryIDs, hashes).Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to query file blocks: %w", err)
+	}
+	for _, hash := range rows {
+		found[hash] = true
+	}
+	return found, nil
+}
+
+// SaveBlockMetadata 保存 Block 的元数据，已存在同一哈希的块时只刷新写入时间
 func (r *GormBlockRepository) SaveBlockMetadata(ctx context.Context, block *model.Block) error {
-	if err := r.db.WithContext(ctx).Create(block).Error; err != nil {
+	block.StagedAt = time.Now()
+	err := conn(ctx, r.db).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "hash"}},
+		DoUpdates: clause.AssignmentColumns([]string{"staged_at"}),
+	}).Create(block).Error
+	if err != nil {
 		return fmt.Errorf("failed to save block metadata: %w", err)
 	}
 	return nil
@@ -106,7 +210,7 @@ func (r *GormBlockRepository) SaveBlockMetadata(ctx context.Context, block *mode
 // GetBlockMetadata 获取 Block 元数据
 func (r *GormBlockRepository) GetBlockMetadata(ctx context.Context, hash string) (*model.Block, error) {
 	var block model.Block
-	if err := r.db.WithContext(ctx).Where("hash = ?", hash).First(&block).Error; err != nil {
+	if err := conn(ctx, r.db).Where("hash = ?", hash).First(&block).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return nil, fmt.Errorf("block not found: %s", hash)
 		}
@@ -116,26 +220,23 @@ func (r *GormBlockRepository) GetBlockMetadata(ctx context.Context, hash string)
 }
 
 // IncrementRefCount 增加引用计数
+// 在数据库中原子地累加，并发的引用与释放不会互相覆盖
 func (r *GormBlockRepository) IncrementRefCount(ctx context.Context, hash string, delta int) error {
-	var block model.Block
-	err := r.db.WithContext(ctx).Where("hash = ?", hash).First(&block).Error
-	if err != nil {
-		return fmt.Errorf("failed to find block: %w", err)
+	result := conn(ctx, r.db).Model(&model.Block{}).Where("hash = ?", hash).
+		UpdateColumn("ref_count", gorm.Expr("ref_count + ?", delta))
+	if result.Error != nil {
+		return fmt.Errorf("failed to increment ref count: %w", result.Error)
 	}
-
-	block.RefCount += delta
-	err = r.db.WithContext(ctx).Save(&block).Error
-	if err != nil {
-		return fmt.Errorf("failed to increment ref count: %w", err)
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("failed to find block: %s", hash)
 	}
-
 	return nil
 }
 
 // ListOrphanBlocks 列出引用计数为 0 的 Block
 func (r *GormBlockRepository) ListOrphanBlocks(ctx context.Context) ([]string, error) {
 	var blocks []model.Block
-	err := r.db.WithContext(ctx).Where("ref_count = 0").Find(&blocks).Error
+	err := conn(ctx, r.db).Where("ref_count = 0").Find(&blocks).Error
 	if err != nil {
 		return nil, fmt.Errorf("failed to list orphan blocks: %w", err)
 	}
@@ -148,19 +249,29 @@ func (r *GormBlockRepository) ListOrphanBlocks(ctx context.Context) ([]string, e
 	return hashes, nil
 }
 
-// DecrementBlockRefCount 减少块的引用计数
-func (r *GormBlockRepository) DecrementBlockRefCount(ctx context.Context, hash string) error {
-	var block model.Block
-	err := r.db.WithContext(ctx).Where("hash = ?", hash).First(&block).Error
-	if err != nil {
-		return fmt.Errorf("failed to find block: %w", err)
+// DeleteBlockMetadata 在块引用计数为 0 且最后写入早于 stagedBefore 时删除其元数据，返回是否删除
+func (r *GormBlockRepository) DeleteBlockMetadata(ctx context.Context, hash string, stagedBefore time.Time) (bool, error) {
+	result := conn(ctx, r.db).Where("hash = ? AND ref_count = 0 AND staged_at < ?", hash, stagedBefore).Delete(&model.Block{})
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to delete block metadata: %w", result.Error)
 	}
+	return result.RowsAffected > 0, nil
+}
 
-	if block.RefCount > 0 {
-		block.RefCount--
-		err = r.db.WithContext(ctx).Save(&block).Error
-		if err != nil {
-			return fmt.Errorf("failed to decrement ref count: %w", err)
+// DecrementBlockRefCount 减少块的引用计数，已为 0 时保持不变
+func (r *GormBlockRepository) DecrementBlockRefCount(ctx context.Context, hash string) error {
+	result := conn(ctx, r.db).Model(&model.Block{}).Where("hash = ? AND ref_count > 0", hash).
+		UpdateColumn("ref_count", gorm.Expr("ref_count - 1"))
+	if result.Error != nil {
+		return fmt.Errorf("failed to decrement ref count: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		var count int64
+		if err := conn(ctx, r.db).Model(&model.Block{}).Where("hash = ?", hash).Count(&count).Error; err != nil {
+			return fmt.Errorf("failed to find block: %w", err)
+		}
+		if count == 0 {
+			return fmt.Errorf("failed to find block: %s", hash)
 		}
 	}
 	return nil
@@ -168,7 +279,7 @@ func (r *GormBlockRepository) DecrementBlockRefCount(ctx context.Context, hash s
 
 // CreateLibrary 创建库
 func (r *GormLibraryRepository) CreateLibrary(ctx context.Context, lib *model.Library) error {
-	if err := r.db.WithContext(ctx).Create(lib).Error; err != nil {
+	if err := conn(ctx, r.db).Create(lib).Error; err != nil {
 		return fmt.Errorf("failed to create library: %w", err)
 	}
 	return nil
@@ -177,9 +288,9 @@ func (r *GormLibraryRepository) CreateLibrary(ctx context.Context, lib *model.Li
 // GetLibraryByID 获取库
 func (r *GormLibraryRepository) GetLibraryByID(ctx context.Context, id uint) (*model.Library, error) {
 	var lib model.Library
-	if err := r.db.WithContext(ctx).First(&lib, id).Error; err != nil {
+	if err := conn(ctx, r.db).First(&lib, id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			return nil, fmt.Errorf("library not found: %d", id)
+			return nil, fmt.Errorf("%w: %d", ErrLibraryNotFound, id)
 		}
 		return nil, fmt.Errorf("failed to query library: %w", err)
 	}
@@ -189,7 +300,7 @@ func (r *GormLibraryRepository) GetLibraryByID(ctx context.Context, id uint) (*m
 // ListLibrariesByOwner 列出用户的所有库
 func (r *GormLibraryRepository) ListLibrariesByOwner(ctx context.Context, ownerID uint) ([]*model.Library, error) {
 	var libs []*model.Library
-	if err := r.db.WithContext(ctx).Where("owner_id = ?", ownerID).Find(&libs).Error; err != nil {
+	if err := conn(ctx, r.db).Where("owner_id = ?", ownerID).Find(&libs).Error; err != nil {
 		return nil, fmt.Errorf("failed to list libraries: %w", err)
 	}
 	return libs, nil
@@ -197,7 +308,7 @@ func (r *GormLibraryRepository) ListLibrariesByOwner(ctx context.Context, ownerI
 
 // UpdateLibrary 更新库信息
 func (r *GormLibraryRepository) UpdateLibrary(ctx context.Context, lib *model.Library) error {
-	if err := r.db.WithContext(ctx).Save(lib).Error; err != nil {
+	if err := conn(ctx, r.db).Save(lib).Error; err != nil {
 		return fmt.Errorf("failed to update library: %w", err)
 	}
 	return nil
@@ -205,7 +316,7 @@ func (r *GormLibraryRepository) UpdateLibrary(ctx context.Context, lib *model.Li
 
 // DeleteLibrary 删除库
 func (r *GormLibraryRepository) DeleteLibrary(ctx context.Context, id uint) error {
-	if err := r.db.WithContext(ctx).Delete(&model.Library{}, id).Error; err != nil {
+	if err := conn(ctx, r.db).Delete(&model.Library{}, id).Error; err != nil {
 		return fmt.Errorf("failed to delete library: %w", err)
 	}
 	return nil
@@ -213,7 +324,7 @@ func (r *GormLibraryRepository) DeleteLibrary(ctx context.Context, id uint) erro
 
 // CreateVersion 创建版本
 func (r *GormLibraryVersionRepository) CreateVersion(ctx context.Context, version *model.LibraryVersion) error {
-	if err := r.db.WithContext(ctx).Create(version).Error; err != nil {
+	if err := conn(ctx, r.db).Create(version).Error; err != nil {
 		return fmt.Errorf("failed to create version: %w", err)
 	}
 	return nil
@@ -222,7 +333,7 @@ func (r *GormLibraryVersionRepository) CreateVersion(ctx context.Context, versio
 // GetVersionByCommitID 通过 commit ID 获取版本
 func (r *GormLibraryVersionRepository) GetVersionByCommitID(ctx context.Context, commitID string) (*model.LibraryVersion, error) {
 	var version model.LibraryVersion
-	if err := r.db.WithContext(ctx).Where("commit_id = ?", commitID).First(&version).Error; err != nil {
+	if err := conn(ctx, r.db).Where("commit_id = ?", commitID).First(&version).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return nil, fmt.Errorf("version not found: %s", commitID)
 		}
@@ -234,7 +345,7 @@ func (r *GormLibraryVersionRepository) GetVersionByCommitID(ctx context.Context,
 // ListVersionsByLibrary 列出库的所有版本
 func (r *GormLibraryVersionRepository) ListVersionsByLibrary(ctx context.Context, libraryID uint) ([]*model.LibraryVersion, error) {
 	var versions []*model.LibraryVersion
-	if err := r.db.WithContext(ctx).
+	if err := conn(ctx, r.db).
 		Where("library_id = ?", libraryID).
 		Order("created_at DESC").
 		Find(&versions).Error; err != nil {
@@ -246,7 +357,7 @@ func (r *GormLibraryVersionRepository) ListVersionsByLibrary(ctx context.Context
 // GetLatestVersion 获取库的最新版本
 func (r *GormLibraryVersionRepository) GetLatestVersion(ctx context.Context, libraryID uint) (*model.LibraryVersion, error) {
 	var version model.LibraryVersion
-	if err := r.db.WithContext(ctx).
+	if err := conn(ctx, r.db).
 		Where("library_id = ?", libraryID).
 		Order("created_at DESC").
 		First(&version).Error; err != nil {
@@ -256,4 +367,20 @@ func (r *GormLibraryVersionRepository) GetLatestVersion(ctx context.Context, lib
 		return nil, fmt.Errorf("failed to query latest version: %w", err)
 	}
 	return &version, nil
-}
\ No newline at end of file
+}
+
+// DeleteVersionsByLibrary 删除库的所有版本
+func (r *GormLibraryVersionRepository) DeleteVersionsByLibrary(ctx context.Context, libraryID uint) error {
+	if err := conn(ctx, r.db).Where("library_id = ?", libraryID).Delete(&model.LibraryVersion{}).Error; err != nil {
+		return fmt.Errorf("failed to delete versions: %w", err)
+	}
+	return nil
+}
+
+// DeleteVersion 删除库中指定 commit ID 的版本
+func (r *GormLibraryVersionRepository) DeleteVersion(ctx context.Context, libraryID uint, commitID string) error {
+	if err := conn(ctx, r.db).Where("library_id = ? AND commit_id = ?", libraryID, commitID).Delete(&model.LibraryVersion{}).Error; err != nil {
+		return fmt.Errorf("failed to delete version: %w", err)
+	}
+	return nil
+}
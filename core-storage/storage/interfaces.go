@@ -2,6 +2,7 @@ package storage
 
 import (
 	"context"
+	"time"
 
 	"github.com/sealock/core-storage/model"
 )
@@ -41,6 +42,24 @@ type FileRepository interface {
 
 	// GetAllFiles 获取所有文件
 	GetAllFiles(ctx context.Context) ([]model.File, error)
+
+	// GetFileByID 通过 ID 获取文件
+	GetFileByID(ctx context.Context, fileID uint) (*model.File, error)
+
+	// GetFileByPath 通过库内路径获取文件，不存在时返回 nil
+	GetFileByPath(ctx context.Context, libraryID uint, path string) (*model.File, error)
+
+	// ListFilesByLibrary 列出库中的所有文件
+	ListFilesByLibrary(ctx context.Context, libraryID uint) ([]model.File, error)
+
+	// HashExistsInLibraries 判断这些库中是否有内容哈希为 hash 的文件
+	HashExistsInLibraries(ctx context.Context, libraryIDs []uint, hash string) (bool, error)
+
+	// FindBlocksInLibraries 返回 hashes 中被这些库的文件引用的块
+	FindBlocksInLibraries(ctx context.Context, libraryIDs []uint, hashes []string) (map[string]bool, error)
+
+	// SumFileSizes 返回这些库中文件大小之和
+	SumFileSizes(ctx context.Context, libraryIDs []uint) (int64, error)
 }
 
 // LibraryRepository 库的数据访问层
@@ -74,11 +93,18 @@ type LibraryVersionRepository interface {
 
 	// GetLatestVersion 获取库的最新版本
 	GetLatestVersion(ctx context.Context, libraryID uint) (*model.LibraryVersion, error)
+
+	// DeleteVersionsByLibrary 删除库的所有版本
+	DeleteVersionsByLibrary(ctx context.Context, libraryID uint) error
+
+	// DeleteVersion 删除库中指定 commit ID 的版本，不存在时不报错
+	DeleteVersion(ctx context.Context, libraryID uint, commitID string) error
 }
 
 // BlockRepository Block 数据访问层（元数据存储）
 type BlockRepository interface {
-	// SaveBlockMetadata 保存 Block 的元数据（hash, size, ref_count）
+	// SaveBlockMetadata 保存 Block 的元数据（hash, size, ref_count）并把写入时间记为现在
+	// 已存在同一哈希的块时只刷新写入时间，并发写入同一个块是安全的
 	SaveBlockMetadata(ctx context.Context, block *model.Block) error
 
 	// GetBlockMetadata 获取 Block 元数据
@@ -92,6 +118,10 @@ type BlockRepository interface {
 
 	// ListOrphanBlocks 列出引用计数为 0 的 Block（可被删除）
 	ListOrphanBlocks(ctx context.Context) ([]string, error)
+
+	// DeleteBlockMetadata 在块引用计数为 0 且最后写入早于 stagedBefore 时删除其元数据（GC 用）
+	// 返回是否实际删除；块在此之前被重新引用或重新写入时不删除
+	DeleteBlockMetadata(ctx context.Context, hash string, stagedBefore time.Time) (bool, error)
 }
 
 // SnapshotRepository manages snapshot persistence
@@ -113,4 +143,79 @@ type SnapshotRepository interface {
 	
 	// CreateSnapshotFile creates a new snapshot file entry
 	CreateSnapshotFile(ctx context.Context, snapshotFile *model.SnapshotFile) error
+
+	// ListSnapshotsByLibrary lists all snapshots of a library, newest first
+	ListSnapshotsByLibrary(ctx context.Context, libraryID uint) ([]model.Snapshot, error)
+
+	// PageSnapshotsByLibrary 分页列出库的快照，最新的在前，同时返回快照总数；limit 不大于 0 表示不限制
+	PageSnapshotsByLibrary(ctx context.Context, libraryID uint, limit, offset int) ([]model.Snapshot, int64, error)
+
+	// DeleteSnapshot deletes a snapshot together with its SnapshotFile rows
+	DeleteSnapshot(ctx context.Context, id uint) error
+
+	// SnapshotsReferenceBlock 返回库的快照中是否有文件引用了该块
+	SnapshotsReferenceBlock(ctx context.Context, libraryID uint, hash string) (bool, error)
+}
+
+// RetentionPolicyRepository 快照保留策略数据访问层
+type RetentionPolicyRepository interface {
+	// GetPolicy 获取库的保留策略，未配置时返回 nil
+	GetPolicy(ctx context.Context, libraryID uint) (*model.RetentionPolicy, error)
+
+	// SavePolicy 创建或更新库的保留策略
+	SavePolicy(ctx context.Context, policy *model.RetentionPolicy) error
+
+	// ListPolicies 列出所有已配置的保留策略
+	ListPolicies(ctx context.Context) ([]model.RetentionPolicy, error)
+}
+
+// ConflictRepository 同步冲突与库同步配置的数据访问层
+type ConflictRepository interface {
+	// CreateConflict 创建冲突记录
+	CreateConflict(ctx context.Context, conflict *model.SyncConflict) error
+
+	// GetConflict 获取冲突记录，不存在时返回 nil
+	GetConflict(ctx context.Context, id uint) (*model.SyncConflict, error)
+
+	// ListConflicts 列出库的冲突记录（最新的在前），status 为空时返回全部
+	ListConflicts(ctx context.Context, libraryID uint, status string) ([]model.SyncConflict, error)
+
+	// UpdateConflict 更新冲突记录
+	UpdateConflict(ctx context.Context, conflict *model.SyncConflict) error
+
+	// GetSettings 获取库的同步配置，未配置时返回 nil
+	GetSettings(ctx context.Context, libraryID uint) (*model.SyncSettings, error)
+
+	// SaveSettings 保存库的同步配置（按 LibraryID 覆盖）
+	SaveSettings(ctx context.Context, settings *model.SyncSettings) error
+}
+
+// ReplicationRepository 库复制状态的数据访问层
+type ReplicationRepository interface {
+	// GetReplication 获取库的复制状态，未配置时返回 nil
+	GetReplication(ctx context.Context, libraryID uint) (*model.Replication, error)
+
+	// ListReplications 列出所有复制配置
+	ListReplications(ctx context.Context) ([]model.Replication, error)
+
+	// SaveReplication 创建或更新复制状态（按 LibraryID 覆盖）
+	SaveReplication(ctx context.Context, replication *model.Replication) error
+
+	// DeleteReplication 删除库的复制配置
+	DeleteReplication(ctx context.Context, libraryID uint) error
+}
+
+// S3KeyRepository S3 网关访问密钥的数据访问层
+type S3KeyRepository interface {
+	// CreateKey 保存新的访问密钥
+	CreateKey(ctx context.Context, key *model.S3AccessKey) error
+
+	// GetKey 按 access key ID 获取访问密钥，不存在时返回 nil
+	GetKey(ctx context.Context, accessKeyID string) (*model.S3AccessKey, error)
+
+	// ListKeys 列出用户的访问密钥
+	ListKeys(ctx context.Context, userID uint) ([]model.S3AccessKey, error)
+
+	// DeleteKey 删除用户的访问密钥，返回是否存在
+	DeleteKey(ctx context.Context, userID uint, accessKeyID string) (bool, error)
 }
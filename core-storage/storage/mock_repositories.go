@@ -2,71 +2,169 @@ package storage
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/sealock/core-storage/model"
 )
 
 // MockFileRepository 内存中的文件仓库实现，用于测试
 type MockFileRepository struct {
-	files map[string]*model.File
-	mutex sync.RWMutex
+	files  map[uint]*model.File
+	nextID uint
+	mutex  sync.RWMutex
 }
 
 // NewMockFileRepository 创建新的 Mock 文件仓库
 func NewMockFileRepository() FileRepository {
 	return &MockFileRepository{
-		files: make(map[string]*model.File),
+		files:  make(map[uint]*model.File),
+		nextID: 1,
 	}
 }
 
 func (m *MockFileRepository) CreateFile(ctx context.Context, file *model.File) error {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
-	m.files[file.Hash] = file
+	if file.ID == 0 {
+		file.ID = m.nextID
+		m.nextID++
+	}
+	// 与 gorm 一样调用 BeforeCreate 钩子生成 UUID
+	if err := file.BeforeCreate(nil); err != nil {
+		return err
+	}
+	file.CreatedAt = time.Now()
+	file.UpdatedAt = file.CreatedAt
+	m.files[file.ID] = file
 	return nil
 }
 
 func (m *MockFileRepository) GetFileByHash(ctx context.Context, hash string) (*model.File, error) {
 	m.mutex.RLock()
 	defer m.mutex.RUnlock()
-	file, exists := m.files[hash]
-	if !exists {
-		return nil, nil // 模拟 GORM 的行为，找不到返回 nil
+	for _, file := range m.sortedFiles() {
+		if file.Hash == hash {
+			return file, nil
+		}
 	}
-	return file, nil
+	return nil, nil // 模拟 GORM 的行为，找不到返回 nil
 }
 
 func (m *MockFileRepository) UpdateFile(ctx context.Context, file *model.File) error {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
-	m.files[file.Hash] = file
+	file.UpdatedAt = time.Now()
+	m.files[file.ID] = file
 	return nil
 }
 
 func (m *MockFileRepository) DeleteFile(ctx context.Context, fileID uint) error {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
-	// 简化实现：根据 ID 查找并删除
-	for hash, file := range m.files {
-		if file.ID == fileID {
-			delete(m.files, hash)
-			break
-		}
-	}
+	delete(m.files, fileID)
 	return nil
 }
 
 func (m *MockFileRepository) GetAllFiles(ctx context.Context) ([]model.File, error) {
 	m.mutex.RLock()
 	defer m.mutex.RUnlock()
-	files := make([]model.File, 0, len(m.files))
-	for _, file := range m.files {
+	sorted := m.sortedFiles()
+	files := make([]model.File, 0, len(sorted))
+	for _, file := range sorted {
 		files = append(files, *file)
 	}
 	return files, nil
 }
 
+func (m *MockFileRepository) GetFileByID(ctx context.Context, fileID uint) (*model.File, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.files[fileID], nil
+}
+
+func (m *MockFileRepository) GetFileByPath(ctx context.Context, libraryID uint, path string) (*model.File, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	for _, file := range m.files {
+		if file.LibraryID == libraryID && file.Name == path {
+			return file, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *MockFileRepository) ListFilesByLibrary(ctx context.Context, libraryID uint) ([]model.File, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	var files []model.File
+	for _, file := range m.sortedFiles() {
+		if file.LibraryID == libraryID {
+			files = append(files, *file)
+		}
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+	return files, nil
+}
+
+func (m *MockFileRepository) HashExistsInLibraries(ctx context.Context, libraryIDs []uint, hash string) (bool, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	for _, file := range m.files {
+		if file.Hash == hash && slices.Contains(libraryIDs, file.LibraryID) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *MockFileRepository) SumFileSizes(ctx context.Context, libraryIDs []uint) (int64, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	var total int64
+	for _, file := range m.files {
+		if slices.Contains(libraryIDs, file.LibraryID) {
+			total += file.Size
+		}
+	}
+	return total, nil
+}
+
+func (m *MockFileRepository) FindBlocksInLibraries(ctx context.Context, libraryIDs []uint, hashes []string) (map[string]bool, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	found := make(map[string]bool)
+	for _, file := range m.files {
+		if !slices.Contains(libraryIDs, file.LibraryID) {
+			continue
+		}
+		var blocks []string
+		if err := json.Unmarshal(file.BlockIDs, &blocks); err != nil {
+			continue
+		}
+		for _, hash := range blocks {
+			if slices.Contains(hashes, hash) {
+				found[hash] = true
+			}
+		}
+	}
+	return found, nil
+}
+
+// sortedFiles 按 ID 顺序返回所有文件（调用方需持有读锁）
+func (m *MockFileRepository) sortedFiles() []*model.File {
+	files := make([]*model.File, 0, len(m.files))
+	for _, file := range m.files {
+		files = append(files, file)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].ID < files[j].ID })
+	return files
+}
+
 // MockBlockRepository 内存中的块仓库实现，用于测试
 type MockBlockRepository struct {
 	blocks map[string]*model.Block
@@ -83,6 +181,11 @@ func NewMockBlockRepository() BlockRepository {
 func (m *MockBlockRepository) SaveBlockMetadata(ctx context.Context, block *model.Block) error {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
+	if existing, exists := m.blocks[block.Hash]; exists {
+		existing.StagedAt = time.Now()
+		return nil
+	}
+	block.StagedAt = time.Now()
 	m.blocks[block.Hash] = block
 	return nil
 }
@@ -115,6 +218,17 @@ func (m *MockBlockRepository) DecrementBlockRefCount(ctx context.Context, hash s
 	return nil
 }
 
+func (m *MockBlockRepository) DeleteBlockMetadata(ctx context.Context, hash string, stagedBefore time.Time) (bool, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	block, exists := m.blocks[hash]
+	if !exists || block.RefCount > 0 || !block.StagedAt.Before(stagedBefore) {
+		return false, nil
+	}
+	delete(m.blocks, hash)
+	return true, nil
+}
+
 func (m *MockBlockRepository) ListOrphanBlocks(ctx context.Context) ([]string, error) {
 	m.mutex.RLock()
 	defer m.mutex.RUnlock()
@@ -129,16 +243,20 @@ func (m *MockBlockRepository) ListOrphanBlocks(ctx context.Context) ([]string, e
 
 // MockSnapshotRepository 内存中的快照仓库实现，用于测试
 type MockSnapshotRepository struct {
-	snapshots map[uint]*model.Snapshot
-	nextID    uint
-	mutex     sync.RWMutex
+	snapshots  map[uint]*model.Snapshot
+	files      map[uint][]model.SnapshotFile
+	nextID     uint
+	nextFileID uint
+	mutex      sync.RWMutex
 }
 
 // NewMockSnapshotRepository 创建新的 Mock 快照仓库
 func NewMockSnapshotRepository() SnapshotRepository {
 	return &MockSnapshotRepository{
-		snapshots: make(map[uint]*model.Snapshot),
-		nextID:    1,
+		snapshots:  make(map[uint]*model.Snapshot),
+		files:      make(map[uint][]model.SnapshotFile),
+		nextID:     1,
+		nextFileID: 1,
 	}
 }
 
@@ -176,27 +294,532 @@ func (m *MockSnapshotRepository) GetSnapshotByUUID(ctx context.Context, uuid str
 func (m *MockSnapshotRepository) ListSnapshots(ctx context.Context, limit, offset int) ([]model.Snapshot, error) {
 	m.mutex.RLock()
 	defer m.mutex.RUnlock()
+	return paginateSnapshots(m.sortedSnapshots(func(*model.Snapshot) bool { return true }), limit, offset), nil
+}
+
+func (m *MockSnapshotRepository) ListSnapshotFiles(ctx context.Context, snapshotID uint, limit, offset int) ([]model.SnapshotFile, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	files := m.files[snapshotID]
+	if offset > len(files) {
+		offset = len(files)
+	}
+	files = files[offset:]
+	if limit > 0 && limit < len(files) {
+		files = files[:limit]
+	}
+	result := make([]model.SnapshotFile, len(files))
+	copy(result, files)
+	return result, nil
+}
+
+func (m *MockSnapshotRepository) CreateSnapshotFile(ctx context.Context, snapshotFile *model.SnapshotFile) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	snapshotFile.ID = m.nextFileID
+	m.nextFileID++
+	m.files[snapshotFile.SnapshotID] = append(m.files[snapshotFile.SnapshotID], *snapshotFile)
+	return nil
+}
+
+func (m *MockSnapshotRepository) ListSnapshotsByLibrary(ctx context.Context, libraryID uint) ([]model.Snapshot, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.sortedSnapshots(func(s *model.Snapshot) bool { return s.LibraryID == libraryID }), nil
+}
+
+func (m *MockSnapshotRepository) PageSnapshotsByLibrary(ctx context.Context, libraryID uint, limit, offset int) ([]model.Snapshot, int64, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	snapshots := m.sortedSnapshots(func(s *model.Snapshot) bool { return s.LibraryID == libraryID })
+	return paginateSnapshots(snapshots, limit, offset), int64(len(snapshots)), nil
+}
+
+func (m *MockSnapshotRepository) DeleteSnapshot(ctx context.Context, id uint) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	delete(m.snapshots, id)
+	delete(m.files, id)
+	return nil
+}
+
+func (m *MockSnapshotRepository) SnapshotsReferenceBlock(ctx context.Context, libraryID uint, hash string) (bool, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	for id, snapshot := range m.snapshots {
+		if snapshot.LibraryID != libraryID {
+			continue
+		}
+		for _, file := range m.files[id] {
+			var blocks []string
+			if err := json.Unmarshal(file.BlockIDs, &blocks); err != nil {
+				continue
+			}
+			if slices.Contains(blocks, hash) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// sortedSnapshots 按创建时间倒序返回满足条件的快照（调用方需持有读锁）
+func (m *MockSnapshotRepository) sortedSnapshots(match func(*model.Snapshot) bool) []model.Snapshot {
 	snapshots := make([]model.Snapshot, 0, len(m.snapshots))
-	i := 0
 	for _, snapshot := range m.snapshots {
-		if i >= offset {
-			if limit <= 0 || len(snapshots) < limit {
-				snapshots = append(snapshots, *snapshot)
-			} else {
-				break
-			}
+		if match(snapshot) {
+			snapshots = append(snapshots, *snapshot)
 		}
-		i++
 	}
-	return snapshots, nil
+	sort.Slice(snapshots, func(i, j int) bool {
+		if snapshots[i].CreatedAt.Equal(snapshots[j].CreatedAt) {
+			return snapshots[i].ID > snapshots[j].ID
+		}
+		return snapshots[i].CreatedAt.After(snapshots[j].CreatedAt)
+	})
+	return snapshots
 }
 
-func (m *MockSnapshotRepository) ListSnapshotFiles(ctx context.Context, snapshotID uint, limit, offset int) ([]model.SnapshotFile, error) {
-	// 简化实现：返回空列表
-	return []model.SnapshotFile{}, nil
+func paginateSnapshots(snapshots []model.Snapshot, limit, offset int) []model.Snapshot {
+	if offset > len(snapshots) {
+		offset = len(snapshots)
+	}
+	snapshots = snapshots[offset:]
+	if limit > 0 && limit < len(snapshots) {
+		snapshots = snapshots[:limit]
+	}
+	return snapshots
 }
 
-func (m *MockSnapshotRepository) CreateSnapshotFile(ctx context.Context, snapshotFile *model.SnapshotFile) error {
-	// 简化实现：不实际存储
+// MockRetentionPolicyRepository 内存中的保留策略仓库实现，用于测试
+type MockRetentionPolicyRepository struct {
+	policies map[uint]*model.RetentionPolicy
+	nextID   uint
+	mutex    sync.RWMutex
+}
+
+// NewMockRetentionPolicyRepository 创建新的 Mock 保留策略仓库
+func NewMockRetentionPolicyRepository() RetentionPolicyRepository {
+	return &MockRetentionPolicyRepository{
+		policies: make(map[uint]*model.RetentionPolicy),
+		nextID:   1,
+	}
+}
+
+func (m *MockRetentionPolicyRepository) GetPolicy(ctx context.Context, libraryID uint) (*model.RetentionPolicy, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	policy, exists := m.policies[libraryID]
+	if !exists {
+		return nil, nil
+	}
+	copied := *policy
+	return &copied, nil
+}
+
+func (m *MockRetentionPolicyRepository) SavePolicy(ctx context.Context, policy *model.RetentionPolicy) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if existing, exists := m.policies[policy.LibraryID]; exists {
+		policy.ID = existing.ID
+	} else {
+		policy.ID = m.nextID
+		m.nextID++
+	}
+	copied := *policy
+	m.policies[policy.LibraryID] = &copied
+	return nil
+}
+
+func (m *MockRetentionPolicyRepository) ListPolicies(ctx context.Context) ([]model.RetentionPolicy, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	policies := make([]model.RetentionPolicy, 0, len(m.policies))
+	for _, policy := range m.policies {
+		policies = append(policies, *policy)
+	}
+	return policies, nil
+}
+
+// MockConflictRepository 内存中的同步冲突仓库实现，用于测试
+type MockConflictRepository struct {
+	conflicts map[uint]*model.SyncConflict
+	settings  map[uint]*model.SyncSettings
+	nextID    uint
+	mutex     sync.RWMutex
+}
+
+// NewMockConflictRepository 创建新的 Mock 同步冲突仓库
+func NewMockConflictRepository() ConflictRepository {
+	return &MockConflictRepository{
+		conflicts: make(map[uint]*model.SyncConflict),
+		settings:  make(map[uint]*model.SyncSettings),
+		nextID:    1,
+	}
+}
+
+func (m *MockConflictRepository) CreateConflict(ctx context.Context, conflict *model.SyncConflict) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	conflict.ID = m.nextID
+	m.nextID++
+	if conflict.CreatedAt.IsZero() {
+		conflict.CreatedAt = time.Now()
+	}
+	copied := *conflict
+	m.conflicts[conflict.ID] = &copied
+	return nil
+}
+
+func (m *MockConflictRepository) GetConflict(ctx context.Context, id uint) (*model.SyncConflict, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	conflict, exists := m.conflicts[id]
+	if !exists {
+		return nil, nil
+	}
+	copied := *conflict
+	return &copied, nil
+}
+
+func (m *MockConflictRepository) ListConflicts(ctx context.Context, libraryID uint, status string) ([]model.SyncConflict, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	var conflicts []model.SyncConflict
+	for _, conflict := range m.conflicts {
+		if conflict.LibraryID == libraryID && (status == "" || conflict.Status == status) {
+			conflicts = append(conflicts, *conflict)
+		}
+	}
+	sort.Slice(conflicts, func(i, j int) bool { return conflicts[i].ID > conflicts[j].ID })
+	return conflicts, nil
+}
+
+func (m *MockConflictRepository) UpdateConflict(ctx context.Context, conflict *model.SyncConflict) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	copied := *conflict
+	m.conflicts[conflict.ID] = &copied
+	return nil
+}
+
+func (m *MockConflictRepository) GetSettings(ctx context.Context, libraryID uint) (*model.SyncSettings, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	settings, exists := m.settings[libraryID]
+	if !exists {
+		return nil, nil
+	}
+	copied := *settings
+	return &copied, nil
+}
+
+func (m *MockConflictRepository) SaveSettings(ctx context.Context, settings *model.SyncSettings) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	copied := *settings
+	m.settings[settings.LibraryID] = &copied
+	return nil
+}
+
+// MockReplicationRepository 内存中的复制状态仓库实现，用于测试
+type MockReplicationRepository struct {
+	replications map[uint]*model.Replication
+	nextID       uint
+	mutex        sync.RWMutex
+}
+
+// NewMockReplicationRepository 创建新的 Mock 复制状态仓库
+func NewMockReplicationRepository() ReplicationRepository {
+	return &MockReplicationRepository{
+		replications: make(map[uint]*model.Replication),
+		nextID:       1,
+	}
+}
+
+func (m *MockReplicationRepository) GetReplication(ctx context.Context, libraryID uint) (*model.Replication, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	replication, exists := m.replications[libraryID]
+	if !exists {
+		return nil, nil
+	}
+	copied := *replication
+	return &copied, nil
+}
+
+func (m *MockReplicationRepository) ListReplications(ctx context.Context) ([]model.Replication, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	replications := make([]model.Replication, 0, len(m.replications))
+	for _, replication := range m.replications {
+		replications = append(replications, *replication)
+	}
+	sort.Slice(replications, func(i, j int) bool { return replications[i].LibraryID < replications[j].LibraryID })
+	return replications, nil
+}
+
+func (m *MockReplicationRepository) SaveReplication(ctx context.Context, replication *model.Replication) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if existing, exists := m.replications[replication.LibraryID]; exists {
+		replication.ID = existing.ID
+	} else {
+		replication.ID = m.nextID
+		m.nextID++
+	}
+	copied := *replication
+	m.replications[replication.LibraryID] = &copied
+	return nil
+}
+
+func (m *MockReplicationRepository) DeleteReplication(ctx context.Context, libraryID uint) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	delete(m.replications, libraryID)
+	return nil
+}
+
+// MockS3KeyRepository 内存中的 S3 访问密钥仓库实现，用于测试
+type MockS3KeyRepository struct {
+	keys   map[string]*model.S3AccessKey
+	nextID uint
+	mutex  sync.RWMutex
+}
+
+// NewMockS3KeyRepository 创建新的 Mock S3 访问密钥仓库
+func NewMockS3KeyRepository() S3KeyRepository {
+	return &MockS3KeyRepository{
+		keys:   make(map[string]*model.S3AccessKey),
+		nextID: 1,
+	}
+}
+
+func (m *MockS3KeyRepository) CreateKey(ctx context.Context, key *model.S3AccessKey) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if _, exists := m.keys[key.AccessKeyID]; exists {
+		return fmt.Errorf("access key %s already exists", key.AccessKeyID)
+	}
+	key.ID = m.nextID
+	m.nextID++
+	key.CreatedAt = time.Now()
+	copied := *key
+	m.keys[key.AccessKeyID] = &copied
 	return nil
-}
\ No newline at end of file
+}
+
+func (m *MockS3KeyRepository) GetKey(ctx context.Context, accessKeyID string) (*model.S3AccessKey, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	key, exists := m.keys[accessKeyID]
+	if !exists {
+		return nil, nil
+	}
+	copied := *key
+	return &copied, nil
+}
+
+func (m *MockS3KeyRepository) ListKeys(ctx context.Context, userID uint) ([]model.S3AccessKey, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	keys := make([]model.S3AccessKey, 0)
+	for _, key := range m.keys {
+		if key.UserID == userID {
+			keys = append(keys, *key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].ID < keys[j].ID })
+	return keys, nil
+}
+
+func (m *MockS3KeyRepository) DeleteKey(ctx context.Context, userID uint, accessKeyID string) (bool, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	key, exists := m.keys[accessKeyID]
+	if !exists || key.UserID != userID {
+		return false, nil
+	}
+	delete(m.keys, accessKeyID)
+	return true, nil
+}
+
+// MockLibraryRepository 内存中的库仓库实现，用于测试
+type MockLibraryRepository struct {
+	libraries map[uint]*model.Library
+	nextID    uint
+	mutex     sync.RWMutex
+}
+
+// NewMockLibraryRepository 创建新的 Mock 库仓库
+func NewMockLibraryRepository() LibraryRepository {
+	return &MockLibraryRepository{
+		libraries: make(map[uint]*model.Library),
+		nextID:    1,
+	}
+}
+
+func (m *MockLibraryRepository) CreateLibrary(ctx context.Context, lib *model.Library) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	lib.ID = m.nextID
+	m.nextID++
+	now := time.Now()
+	lib.CreatedAt, lib.UpdatedAt = now, now
+	copied := *lib
+	m.libraries[lib.ID] = &copied
+	return nil
+}
+
+func (m *MockLibraryRepository) GetLibraryByID(ctx context.Context, id uint) (*model.Library, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	lib, exists := m.libraries[id]
+	if !exists {
+		return nil, fmt.Errorf("%w: %d", ErrLibraryNotFound, id)
+	}
+	copied := *lib
+	return &copied, nil
+}
+
+func (m *MockLibraryRepository) ListLibrariesByOwner(ctx context.Context, ownerID uint) ([]*model.Library, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	var libs []*model.Library
+	for _, lib := range m.libraries {
+		if lib.OwnerID == ownerID {
+			copied := *lib
+			libs = append(libs, &copied)
+		}
+	}
+	sort.Slice(libs, func(i, j int) bool { return libs[i].ID < libs[j].ID })
+	return libs, nil
+}
+
+func (m *MockLibraryRepository) UpdateLibrary(ctx context.Context, lib *model.Library) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	lib.UpdatedAt = time.Now()
+	copied := *lib
+	m.libraries[lib.ID] = &copied
+	return nil
+}
+
+func (m *MockLibraryRepository) DeleteLibrary(ctx context.Context, id uint) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	delete(m.libraries, id)
+	return nil
+}
+
+// MockLibraryVersionRepository 内存中的版本仓库实现，用于测试
+type MockLibraryVersionRepository struct {
+	versions []*model.LibraryVersion
+	nextID   uint
+	mutex    sync.RWMutex
+}
+
+// NewMockLibraryVersionRepository 创建新的 Mock 版本仓库
+func NewMockLibraryVersionRepository() LibraryVersionRepository {
+	return &MockLibraryVersionRepository{nextID: 1}
+}
+
+func (m *MockLibraryVersionRepository) CreateVersion(ctx context.Context, version *model.LibraryVersion) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for _, existing := range m.versions {
+		if existing.CommitID == version.CommitID {
+			return fmt.Errorf("failed to create version: duplicate commit %s", version.CommitID)
+		}
+	}
+	version.ID = m.nextID
+	m.nextID++
+	if version.CreatedAt.IsZero() {
+		version.CreatedAt = time.Now()
+	}
+	copied := *version
+	m.versions = append(m.versions, &copied)
+	return nil
+}
+
+func (m *MockLibraryVersionRepository) GetVersionByCommitID(ctx context.Context, commitID string) (*model.LibraryVersion, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	for _, version := range m.versions {
+		if version.CommitID == commitID {
+			copied := *version
+			return &copied, nil
+		}
+	}
+	return nil, fmt.Errorf("version not found: %s", commitID)
+}
+
+func (m *MockLibraryVersionRepository) ListVersionsByLibrary(ctx context.Context, libraryID uint) ([]*model.LibraryVersion, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	var versions []*model.LibraryVersion
+	for _, version := range m.versions {
+		if version.LibraryID == libraryID {
+			copied := *version
+			versions = append(versions, &copied)
+		}
+	}
+	// 与 GORM 实现一致，按创建时间倒序
+	sort.SliceStable(versions, func(i, j int) bool {
+		if versions[i].CreatedAt.Equal(versions[j].CreatedAt) {
+			return versions[i].ID > versions[j].ID
+		}
+		return versions[i].CreatedAt.After(versions[j].CreatedAt)
+	})
+	return versions, nil
+}
+
+func (m *MockLibraryVersionRepository) GetLatestVersion(ctx context.Context, libraryID uint) (*model.LibraryVersion, error) {
+	versions, err := m.ListVersionsByLibrary(ctx, libraryID)
+	if err != nil {
+		return nil, err
+	}
+	if len(versions) == 0 {
+		return nil, fmt.Errorf("no version found for library: %d", libraryID)
+	}
+	return versions[0], nil
+}
+
+func (m *MockLibraryVersionRepository) DeleteVersionsByLibrary(ctx context.Context, libraryID uint) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	kept := m.versions[:0]
+	for _, version := range m.versions {
+		if version.LibraryID != libraryID {
+			kept = append(kept, version)
+		}
+	}
+	m.versions = kept
+	return nil
+}
+
+func (m *MockLibraryVersionRepository) DeleteVersion(ctx context.Context, libraryID uint, commitID string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	kept := m.versions[:0]
+	for _, version := range m.versions {
+		if version.LibraryID != libraryID || version.CommitID != commitID {
+			kept = append(kept, version)
+		}
+	}
+	m.versions = kept
+	return nil
+}
+
+// MockTransactor 不开启事务、直接执行函数的 Transactor，用于测试
+// 内存仓库没有回滚能力，失败时已写入的数据会保留
+type MockTransactor struct{}
+
+// NewMockTransactor 创建新的 Mock Transactor
+func NewMockTransactor() Transactor {
+	return MockTransactor{}
+}
+
+func (MockTransactor) InTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
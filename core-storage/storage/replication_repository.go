@@ -0,0 +1,54 @@
+package storage
+
+import (
+	"context"
+	"errors"
+
+	"github.com/sealock/core-storage/model"
+	"gorm.io/gorm"
+)
+
+type replicationRepository struct {
+	db *gorm.DB
+}
+
+// NewReplicationRepository creates a new library replication repository
+func NewReplicationRepository(db *gorm.DB) ReplicationRepository {
+	return &replicationRepository{db: db}
+}
+
+func (r *replicationRepository) GetReplication(ctx context.Context, libraryID uint) (*model.Replication, error) {
+	var replication model.Replication
+	err := conn(ctx, r.db).Where("library_id = ?", libraryID).First(&replication).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &replication, nil
+}
+
+func (r *replicationRepository) ListReplications(ctx context.Context) ([]model.Replication, error) {
+	var replications []model.Replication
+	if err := conn(ctx, r.db).Order("library_id").Find(&replications).Error; err != nil {
+		return nil, err
+	}
+	return replications, nil
+}
+
+func (r *replicationRepository) SaveReplication(ctx context.Context, replication *model.Replication) error {
+	existing, err := r.GetReplication(ctx, replication.LibraryID)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		replication.ID = existing.ID
+		replication.CreatedAt = existing.CreatedAt
+	}
+	return conn(ctx, r.db).Save(replication).Error
+}
+
+func (r *replicationRepository) DeleteReplication(ctx context.Context, libraryID uint) error {
+	return conn(ctx, r.db).Where("library_id = ?", libraryID).Delete(&model.Replication{}).Error
+}
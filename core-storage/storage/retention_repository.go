@@ -0,0 +1,50 @@
+package storage
+
+import (
+	"context"
+	"errors"
+
+	"github.com/sealock/core-storage/model"
+	"gorm.io/gorm"
+)
+
+type retentionPolicyRepository struct {
+	db *gorm.DB
+}
+
+// NewRetentionPolicyRepository creates a new retention policy repository
+func NewRetentionPolicyRepository(db *gorm.DB) RetentionPolicyRepository {
+	return &retentionPolicyRepository{db: db}
+}
+
+func (r *retentionPolicyRepository) GetPolicy(ctx context.Context, libraryID uint) (*model.RetentionPolicy, error) {
+	var policy model.RetentionPolicy
+	err := conn(ctx, r.db).Where("library_id = ?", libraryID).First(&policy).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+func (r *retentionPolicyRepository) SavePolicy(ctx context.Context, policy *model.RetentionPolicy) error {
+	existing, err := r.GetPolicy(ctx, policy.LibraryID)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		policy.ID = existing.ID
+		policy.CreatedAt = existing.CreatedAt
+	}
+	return conn(ctx, r.db).Save(policy).Error
+}
+
+func (r *retentionPolicyRepository) ListPolicies(ctx context.Context) ([]model.RetentionPolicy, error) {
+	var policies []model.RetentionPolicy
+	if err := conn(ctx, r.db).Find(&policies).Error; err != nil {
+		return nil, err
+	}
+	return policies, nil
+}
@@ -0,0 +1,47 @@
+package storage
+
+import (
+	"context"
+	"errors"
+
+	"github.com/sealock/core-storage/model"
+	"gorm.io/gorm"
+)
+
+type s3KeyRepository struct {
+	db *gorm.DB
+}
+
+// NewS3KeyRepository creates a new S3 access key repository
+func NewS3KeyRepository(db *gorm.DB) S3KeyRepository {
+	return &s3KeyRepository{db: db}
+}
+
+func (r *s3KeyRepository) CreateKey(ctx context.Context, key *model.S3AccessKey) error {
+	return conn(ctx, r.db).Create(key).Error
+}
+
+func (r *s3KeyRepository) GetKey(ctx context.Context, accessKeyID string) (*model.S3AccessKey, error) {
+	var key model.S3AccessKey
+	err := conn(ctx, r.db).Where("access_key_id = ?", accessKeyID).First(&key).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+func (r *s3KeyRepository) ListKeys(ctx context.Context, userID uint) ([]model.S3AccessKey, error) {
+	var keys []model.S3AccessKey
+	if err := conn(ctx, r.db).Where("user_id = ?", userID).Order("id").Find(&keys).Error; err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+func (r *s3KeyRepository) DeleteKey(ctx context.Context, userID uint, accessKeyID string) (bool, error) {
+	result := conn(ctx, r.db).Where("user_id = ? AND access_key_id = ?", userID, accessKeyID).Delete(&model.S3AccessKey{})
+	return result.RowsAffected > 0, result.Error
+}
@@ -16,12 +16,12 @@ func NewSnapshotRepository(db *gorm.DB) SnapshotRepository {
 }
 
 func (r *snapshotRepository) CreateSnapshot(ctx context.Context, snapshot *model.Snapshot) error {
-	return r.db.WithContext(ctx).Create(snapshot).Error
+	return conn(ctx, r.db).Create(snapshot).Error
 }
 
 func (r *snapshotRepository) GetSnapshotByID(ctx context.Context, id uint) (*model.Snapshot, error) {
 	var snapshot model.Snapshot
-	if err := r.db.WithContext(ctx).First(&snapshot, id).Error; err != nil {
+	if err := conn(ctx, r.db).First(&snapshot, id).Error; err != nil {
 		return nil, err
 	}
 	return &snapshot, nil
@@ -29,7 +29,7 @@ func (r *snapshotRepository) GetSnapshotByID(ctx context.Context, id uint) (*mod
 
 func (r *snapshotRepository) GetSnapshotByUUID(ctx context.Context, uuid string) (*model.Snapshot, error) {
 	var snapshot model.Snapshot
-	if err := r.db.WithContext(ctx).Where("uuid = ?", uuid).First(&snapshot).Error; err != nil {
+	if err := conn(ctx, r.db).Where("uuid = ?", uuid).First(&snapshot).Error; err != nil {
 		return nil, err
 	}
 	return &snapshot, nil
@@ -37,9 +37,7 @@ func (r *snapshotRepository) GetSnapshotByUUID(ctx context.Context, uuid string)
 
 func (r *snapshotRepository) ListSnapshots(ctx context.Context, limit, offset int) ([]model.Snapshot, error) {
 	var snapshots []model.Snapshot
-	err := r.db.WithContext(ctx).
-		Limit(limit).
-		Offset(offset).
+	err := paginate(conn(ctx, r.db), limit, offset).
 		Order("created_at DESC").
 		Find(&snapshots).Error
 	if err != nil {
@@ -50,10 +48,8 @@ func (r *snapshotRepository) ListSnapshots(ctx context.Context, limit, offset in
 
 func (r *snapshotRepository) ListSnapshotFiles(ctx context.Context, snapshotID uint, limit, offset int) ([]model.SnapshotFile, error) {
 	var snapshotFiles []model.SnapshotFile
-	err := r.db.WithContext(ctx).
+	err := paginate(conn(ctx, r.db), limit, offset).
 		Where("snapshot_id = ?", snapshotID).
-		Limit(limit).
-		Offset(offset).
 		Find(&snapshotFiles).Error
 	if err != nil {
 		return nil, err
@@ -62,5 +58,65 @@ func (r *snapshotRepository) ListSnapshotFiles(ctx context.Context, snapshotID u
 }
 
 func (r *snapshotRepository) CreateSnapshotFile(ctx context.Context, snapshotFile *model.SnapshotFile) error {
-	return r.db.WithContext(ctx).Create(snapshotFile).Error
-}
\ No newline at end of file
+	return conn(ctx, r.db).Create(snapshotFile).Error
+}
+
+func (r *snapshotRepository) ListSnapshotsByLibrary(ctx context.Context, libraryID uint) ([]model.Snapshot, error) {
+	var snapshots []model.Snapshot
+	err := conn(ctx, r.db).
+		Where("library_id = ?", libraryID).
+		Order("created_at DESC").
+		Find(&snapshots).Error
+	if err != nil {
+		return nil, err
+	}
+	return snapshots, nil
+}
+
+func (r *snapshotRepository) PageSnapshotsByLibrary(ctx context.Context, libraryID uint, limit, offset int) ([]model.Snapshot, int64, error) {
+	var total int64
+	if err := conn(ctx, r.db).Model(&model.Snapshot{}).Where("library_id = ?", libraryID).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var snapshots []model.Snapshot
+	err := paginate(conn(ctx, r.db), limit, offset).
+		Where("library_id = ?", libraryID).
+		Order("created_at DESC, id DESC").
+		Find(&snapshots).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	return snapshots, total, nil
+}
+
+func (r *snapshotRepository) DeleteSnapshot(ctx context.Context, id uint) error {
+	return conn(ctx, r.db).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("snapshot_id = ?", id).Delete(&model.SnapshotFile{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&model.Snapshot{}, id).Error
+	})
+}
+
+func (r *snapshotRepository) SnapshotsReferenceBlock(ctx context.Context, libraryID uint, hash string) (bool, error) {
+	var exists bool
+	err := conn(ctx, r.db).Raw(`SELECT EXISTS (SELECT 1 FROM snapshot_files
+		JOIN snapshots ON snapshots.id = snapshot_files.snapshot_id,
+		jsonb_array_elements_text(snapshot_files.block_ids) AS b(hash)
+		WHERE snapshots.library_id = ? AND b.hash = ?)`, libraryID, hash).Scan(&exists).Error
+	if err != nil {
+		return false, err
+	}
+	return exists, nil
+}
+
+// paginate 仅在 limit/offset 为正数时追加分页条件（0 表示不分页）
+func paginate(db *gorm.DB, limit, offset int) *gorm.DB {
+	if limit > 0 {
+		db = db.Limit(limit)
+	}
+	if offset > 0 {
+		db = db.Offset(offset)
+	}
+	return db
+}
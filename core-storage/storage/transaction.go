@@ -0,0 +1,43 @@
+package storage
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+)
+
+// Transactor runs a function in a database transaction
+type Transactor interface {
+	// InTransaction 在一个数据库事务中执行 fn，fn 返回错误时回滚
+	// fn 中用它收到的 ctx 调用的仓库方法都在该事务中执行；ctx 已在事务中时直接复用外层事务
+	InTransaction(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+// txKey is the context key of the running transaction
+type txKey struct{}
+
+type gormTransactor struct {
+	db *gorm.DB
+}
+
+// NewTransactor creates a transactor whose transactions are seen by every GORM repository of db
+func NewTransactor(db *gorm.DB) Transactor {
+	return &gormTransactor{db: db}
+}
+
+func (t *gormTransactor) InTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(txKey{}).(*gorm.DB); ok {
+		return fn(ctx)
+	}
+	return t.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return fn(context.WithValue(ctx, txKey{}, tx))
+	})
+}
+
+// conn returns the transaction running in ctx, or db when there is none
+func conn(ctx context.Context, db *gorm.DB) *gorm.DB {
+	if tx, ok := ctx.Value(txKey{}).(*gorm.DB); ok {
+		return tx.WithContext(ctx)
+	}
+	return db.WithContext(ctx)
+}
@@ -15,7 +15,7 @@ func ExampleSyncService() {
 	blockStore := &mockBlockStore{}
 
 	// Create sync service
-	syncSvc := service.NewSyncService(fileRepo, blockStore)
+	syncSvc := service.NewSyncService(fileRepo, blockStore, nil, nil, nil)
 
 	// Create test files
 	files := []model.File{
@@ -143,6 +143,30 @@ func (m *mockFileRepository) UpdateFile(ctx context.Context, file *model.File) e
 	return nil
 }
 
+func (m *mockFileRepository) GetFileByID(ctx context.Context, fileID uint) (*model.File, error) {
+	return nil, nil
+}
+
+func (m *mockFileRepository) GetFileByPath(ctx context.Context, libraryID uint, path string) (*model.File, error) {
+	return nil, nil
+}
+
+func (m *mockFileRepository) ListFilesByLibrary(ctx context.Context, libraryID uint) ([]model.File, error) {
+	return []model.File{}, nil
+}
+
+func (m *mockFileRepository) HashExistsInLibraries(ctx context.Context, libraryIDs []uint, hash string) (bool, error) {
+	return false, nil
+}
+
+func (m *mockFileRepository) SumFileSizes(ctx context.Context, libraryIDs []uint) (int64, error) {
+	return 0, nil
+}
+
+func (m *mockFileRepository) FindBlocksInLibraries(ctx context.Context, libraryIDs []uint, hashes []string) (map[string]bool, error) {
+	return map[string]bool{}, nil
+}
+
 // mockBlockStore is a mock implementation of BlockStore for testing
 type mockBlockStore struct{}
 
@@ -0,0 +1,137 @@
+package syncclient
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sealock/core-storage/chunker"
+	"github.com/sealock/core-storage/ignore"
+)
+
+const (
+	// StateDirName 同步目录下存放客户端状态的目录，不参与同步
+	StateDirName = ".sealock"
+	// ClientIgnoreFile 状态目录下只对本客户端生效的忽略规则文件，不参与同步
+	ClientIgnoreFile = "ignore"
+	// tempPrefix 下载过程中的临时文件前缀，不参与同步
+	tempPrefix = ".sealock-"
+)
+
+// ignored 判断库内路径是否属于客户端自身的文件
+func ignored(rel string) bool {
+	if rel == StateDirName || strings.HasPrefix(rel, StateDirName+"/") {
+		return true
+	}
+	return strings.HasPrefix(filepath.Base(rel), tempPrefix)
+}
+
+// Scan 扫描本地目录，返回库内路径 → 文件状态
+// 大小和修改时间与 known 中记录一致的文件直接复用记录，不重新分块；
+// 被 filter 排除的文件和目录不会被读取
+func Scan(root string, known map[string]FileState, c *chunker.FixedSizeChunker, filter *ignore.Filter) (map[string]FileState, error) {
+	files := make(map[string]FileState)
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel == "." {
+			return nil
+		}
+		if ignored(rel) || (d.IsDir() && filter.ExcludedDir(rel)) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || filter.Excluded(rel) {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if prev, ok := known[rel]; ok && prev.Size == info.Size() && prev.ModTime.Equal(info.ModTime()) {
+			files[rel] = prev
+			return nil
+		}
+
+		state, err := hashFile(p, c)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		files[rel] = *state
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan %s: %w", root, err)
+	}
+	return files, nil
+}
+
+// hashFile 对文件分块并计算文件哈希
+func hashFile(path string, c *chunker.FixedSizeChunker) (*FileState, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	blocks := []string{}
+	err = readBlocks(path, c, func(hash string, data []byte) error {
+		blocks = append(blocks, hash)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	fileHash, err := chunker.ComputeFileMerkleHash(blocks)
+	if err != nil {
+		return nil, err
+	}
+	return &FileState{Hash: fileHash, Size: info.Size(), ModTime: info.ModTime(), Blocks: blocks}, nil
+}
+
+// readBlocks 按块流式读取文件，对每个块调用 fn
+// 不会把整个文件读入内存
+func readBlocks(path string, c *chunker.FixedSizeChunker, fn func(hash string, data []byte) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	buf := make([]byte, c.ChunkSize())
+	for {
+		n, err := io.ReadFull(f, buf)
+		if n > 0 {
+			hashes, chunkErr := c.Chunk(buf[:n])
+			if chunkErr != nil {
+				return chunkErr
+			}
+			if err := fn(hashes[0], buf[:n]); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package syncclient
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// StateVersion 本地状态文件格式版本
+const StateVersion = 1
+
+// FileState 文件在上次同步完成时的状态
+// Size 和 ModTime 用于判断本地文件是否变化：两者都未变时直接复用 Hash 和 Blocks，不再重新分块
+type FileState struct {
+	Hash    string    `json:"hash"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+	Blocks  []string  `json:"blocks"`
+}
+
+// State 本地状态数据库：记录上次同步完成时的文件列表和目录树哈希
+// 重启后据此只处理真正变化的文件，并直接用目录哈希向服务端请求差异
+type State struct {
+	Version    int                  `json:"version"`
+	LibraryID  uint                 `json:"libraryId"`
+	ServerRoot string               `json:"serverRoot"` // 上次同步时服务端的根哈希
+	Trees      map[string]string    `json:"trees"`      // 目录路径 → 目录哈希
+	Files      map[string]FileState `json:"files"`      // 文件路径 → 文件状态
+	SyncedAt   time.Time            `json:"syncedAt"`
+}
+
+// NewState 创建空的同步状态
+func NewState(libraryID uint) *State {
+	return &State{
+		Version:   StateVersion,
+		LibraryID: libraryID,
+		Trees:     make(map[string]string),
+		Files:     make(map[string]FileState),
+	}
+}
+
+// LoadState 读取状态文件，文件不存在时返回空状态
+// 状态文件属于其他库时返回错误，避免把两个库的内容混在一起
+func LoadState(path string, libraryID uint) (*State, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return NewState(libraryID), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state file: %w", err)
+	}
+
+	state := NewState(libraryID)
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("failed to parse state file %s: %w", path, err)
+	}
+	if state.Version != StateVersion {
+		return nil, fmt.Errorf("unsupported state file version %d", state.Version)
+	}
+	if state.LibraryID != libraryID {
+		return nil, fmt.Errorf("state file %s belongs to library %d, not %d", path, state.LibraryID, libraryID)
+	}
+	if state.Trees == nil {
+		state.Trees = make(map[string]string)
+	}
+	if state.Files == nil {
+		state.Files = make(map[string]FileState)
+	}
+	return state, nil
+}
+
+// Save 原子地写入状态文件（先写临时文件再重命名）
+func (s *State) Save(path string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal state: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".state-*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temp state file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write state: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to sync state: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close state: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace state file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package syncclient
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStateSaveAndLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), StateDirName, "state.json")
+
+	// 状态文件不存在时返回空状态
+	state, err := LoadState(path, 7)
+	if err != nil {
+		t.Fatalf("load missing state: %v", err)
+	}
+	if state.LibraryID != 7 || len(state.Files) != 0 || state.Trees == nil {
+		t.Fatalf("empty state = %+v", state)
+	}
+
+	modTime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	state.ServerRoot = "root"
+	state.Trees[""] = "root"
+	state.Files["docs/a.txt"] = FileState{Hash: "h1", Size: 5, ModTime: modTime, Blocks: []string{"b1"}}
+	if err := state.Save(path); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	loaded, err := LoadState(path, 7)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	f := loaded.Files["docs/a.txt"]
+	if loaded.ServerRoot != "root" || f.Hash != "h1" || f.Size != 5 || !f.ModTime.Equal(modTime) || len(f.Blocks) != 1 {
+		t.Fatalf("loaded state = %+v", loaded)
+	}
+	// 写入时不留下临时文件
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	if len(entries) != 1 {
+		t.Fatalf("state directory has %d entries, want only the state file", len(entries))
+	}
+
+	// 属于其他库或版本不符的状态文件被拒绝
+	if _, err := LoadState(path, 8); err == nil || !strings.Contains(err.Error(), "belongs to library 7") {
+		t.Fatalf("load for another library: err = %v", err)
+	}
+	if err := os.WriteFile(path, []byte(`{"version": 99, "libraryId": 7}`), 0o644); err != nil {
+		t.Fatalf("write state: %v", err)
+	}
+	if _, err := LoadState(path, 7); err == nil {
+		t.Fatal("unsupported state version accepted")
+	}
+	if err := os.WriteFile(path, []byte("{"), 0o644); err != nil {
+		t.Fatalf("write state: %v", err)
+	}
+	if _, err := LoadState(path, 7); err == nil {
+		t.Fatal("corrupt state file accepted")
+	}
+}
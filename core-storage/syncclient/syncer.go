@@ -0,0 +1,689 @@
+package syncclient
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sealock/core-storage/api"
+	"github.com/sealock/core-storage/chunker"
+	"github.com/sealock/core-storage/client"
+	"github.com/sealock/core-storage/ignore"
+	"github.com/sealock/core-storage/syncproto"
+)
+
+const (
+	// DefaultBlockSize 客户端默认块大小
+	DefaultBlockSize = 1 << 20
+	// maxSyncAttempts 本地文件在同步过程中变化时的最大重试次数
+	maxSyncAttempts = 5
+)
+
+var (
+	// errLocalChanged 本地文件在同步过程中被修改
+	errLocalChanged = errors.New("local file changed during sync")
+	// ErrUnsafePath 服务端返回的路径是绝对路径或跳出了同步目录
+	ErrUnsafePath = errors.New("path escapes the sync directory")
+	// ErrIntegrity 下载的块或文件与服务端声明的哈希不一致
+	ErrIntegrity = errors.New("downloaded content failed hash verification")
+)
+
+// Options 同步客户端配置
+type Options struct {
+	Root      string // 本地同步目录
+	LibraryID uint   // 远端库ID
+	StatePath string // 状态文件路径，缺省为 <Root>/.sealock/state.json
+	BlockSize int    // 固定分块大小，缺省为 DefaultBlockSize
+	ClientID  string // 客户端标识，用于服务端命名冲突副本，缺省为主机名
+
+	// Ignore 本客户端额外的忽略规则（gitignore 语法），与 <Root>/.sealock/ignore 中的规则合并，
+	// 排在库的 .sealockignore 之后
+	Ignore []string
+	// Include 选择性同步的子树，为空表示同步整个库；范围外的本地文件保持不动
+	Include []string
+}
+
+// Result 一轮同步的结果
+type Result struct {
+	Root          string
+	Uploaded      int // 推送到服务端的新增/修改文件数
+	DeletedRemote int // 在服务端删除的文件数
+	Downloaded    int // 从服务端拉取的文件数
+	DeletedLocal  int // 在本地删除的文件数
+	Conflicts     int // 双方都修改过、由服务端按冲突策略处理的文件数
+	BlocksSent    int // 实际上传的块数
+}
+
+// Changed 本轮同步是否有任何变化
+func (r *Result) Changed() bool {
+	return r.Uploaded+r.DeletedRemote+r.Downloaded+r.DeletedLocal > 0
+}
+
+// Syncer 本地目录与远端库之间的双向同步器
+// 以上次同步完成时的状态为共同基线做三方对比：只有一方变化的文件直接同步，
+// 双方都变化时连同共同祖先哈希一起推送，由服务端按库的冲突策略处理
+type Syncer struct {
+	root      string
+	libraryID uint
+	clientID  string
+	statePath string
+	ignore    []string
+	include   []string
+	api       *client.Client
+	chunker   *chunker.FixedSizeChunker
+
+	mu    sync.Mutex
+	state *State
+}
+
+// NewSyncer 创建同步器并加载本地状态
+func NewSyncer(c *client.Client, opts Options) (*Syncer, error) {
+	root, err := filepath.Abs(opts.Root)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sync directory: %w", err)
+	}
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create sync directory: %w", err)
+	}
+	if opts.StatePath == "" {
+		opts.StatePath = filepath.Join(root, StateDirName, "state.json")
+	}
+	if opts.BlockSize <= 0 {
+		opts.BlockSize = DefaultBlockSize
+	}
+	if opts.ClientID == "" {
+		opts.ClientID, _ = os.Hostname()
+	}
+
+	state, err := LoadState(opts.StatePath, opts.LibraryID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Syncer{
+		root:      root,
+		libraryID: opts.LibraryID,
+		clientID:  opts.ClientID,
+		statePath: opts.StatePath,
+		ignore:    opts.Ignore,
+		include:   opts.Include,
+		api:       c,
+		chunker:   chunker.NewFixedSizeChunker(opts.BlockSize),
+		state:     state,
+	}, nil
+}
+
+// Root 返回本地同步目录
+func (s *Syncer) Root() string {
+	return s.root
+}
+
+// SyncOnce 执行一轮完整同步：扫描本地、拉取差异、推送本地变更、下载远端变更
+// 服务端处理了冲突时再同步一轮，把处理结果（如冲突副本）拉回本地
+func (s *Syncer) SyncOnce(ctx context.Context) (*Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result, err := s.syncWithRetry(ctx)
+	if err != nil || result.Conflicts == 0 {
+		return result, err
+	}
+	followUp, err := s.syncWithRetry(ctx)
+	if err != nil {
+		return nil, err
+	}
+	result.Root = followUp.Root
+	result.Uploaded += followUp.Uploaded
+	result.DeletedRemote += followUp.DeletedRemote
+	result.Downloaded += followUp.Downloaded
+	result.DeletedLocal += followUp.DeletedLocal
+	result.Conflicts += followUp.Conflicts
+	result.BlocksSent += followUp.BlocksSent
+	return result, nil
+}
+
+// syncWithRetry 执行一轮同步，本地文件在同步过程中被修改时重新扫描
+func (s *Syncer) syncWithRetry(ctx context.Context) (*Result, error) {
+	var lastErr error
+	for attempt := 0; attempt < maxSyncAttempts; attempt++ {
+		result, err := s.syncOnce(ctx)
+		if err == nil {
+			return result, nil
+		}
+		if !errors.Is(err, errLocalChanged) {
+			return nil, err
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+// plan 一轮同步要执行的操作
+type plan struct {
+	upserts   map[string]FileState // 推送到服务端
+	deletes   []string             // 在服务端删除
+	bases     map[string]string    // 推送或删除的路径 → 共同祖先哈希
+	downloads map[string]FileState // 从服务端拉取
+	removes   []string             // 在本地删除
+}
+
+func (s *Syncer) syncOnce(ctx context.Context) (*Result, error) {
+	clientRules, err := s.clientIgnore()
+	if err != nil {
+		return nil, err
+	}
+	diff, err := s.api.SyncDiff(ctx, s.libraryID, &api.SyncDiffRequest{
+		Root:    s.state.ServerRoot,
+		Trees:   s.state.Trees,
+		Ignore:  clientRules,
+		Include: s.include,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// 使用服务端当前的 .sealockignore 计算同步范围，与服务端构建目录树时的规则保持一致
+	remote := applyDiff(s.state.Files, diff)
+	libraryRules, err := s.libraryIgnore(ctx, remote)
+	if err != nil {
+		return nil, err
+	}
+	filter := ignore.NewFilter(ignore.Merge(libraryRules, ignore.ParseLines(clientRules)), s.include)
+	base := filterFiles(s.state.Files, filter)
+	remote = filterFiles(remote, filter)
+	local, err := Scan(s.root, base, s.chunker, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	p := s.reconcile(base, local, remote)
+	result := &Result{}
+
+	// 1. 推送本地变更
+	if len(p.upserts) > 0 || len(p.deletes) > 0 {
+		sent, err := s.uploadBlocks(ctx, p.upserts)
+		if err != nil {
+			return nil, err
+		}
+		result.BlocksSent = sent
+
+		push := &api.SyncPushRequest{
+			BaseRoot: s.state.ServerRoot,
+			ClientID: s.clientID,
+			Files:    []api.SyncFile{},
+			Deleted:  []api.SyncDeletion{},
+		}
+		for _, filePath := range sortedKeys(p.upserts) {
+			f := p.upserts[filePath]
+			push.Files = append(push.Files, api.SyncFile{
+				Path:     filePath,
+				Hash:     f.Hash,
+				Size:     f.Size,
+				Blocks:   f.Blocks,
+				BaseHash: p.bases[filePath],
+				ModTime:  f.ModTime,
+			})
+		}
+		for _, filePath := range p.deletes {
+			push.Deleted = append(push.Deleted, api.SyncDeletion{Path: filePath, BaseHash: p.bases[filePath]})
+		}
+		resp, err := s.api.SyncPush(ctx, s.libraryID, push)
+		if err != nil {
+			return nil, err
+		}
+		for _, conflict := range resp.Conflicts {
+			log.Printf("sealock-sync: conflict on %s (%s %s)", conflict.Path, conflict.Status, conflict.Resolution)
+		}
+		// 服务端按库规则拒收的文件不记入基线，否则下一轮会被当作远端删除
+		for _, filePath := range resp.Ignored {
+			log.Printf("sealock-sync: %s is ignored by the library rules", filePath)
+			delete(p.upserts, filePath)
+		}
+		result.Uploaded = len(p.upserts)
+		result.DeletedRemote = len(p.deletes)
+		result.Conflicts = len(resp.Conflicts)
+	}
+
+	// 2. 应用远端变更
+	final := remote
+	for filePath, f := range p.upserts {
+		final[filePath] = f
+	}
+	for _, filePath := range p.deletes {
+		delete(final, filePath)
+	}
+	for _, filePath := range sortedKeys(p.downloads) {
+		f := p.downloads[filePath]
+		expected, exists := local[filePath]
+		modTime, err := s.download(ctx, filePath, f, expected, exists)
+		if err != nil {
+			return nil, err
+		}
+		f.ModTime = modTime
+		final[filePath] = f
+		result.Downloaded++
+	}
+	for _, filePath := range p.removes {
+		if err := s.removeLocal(filePath, local[filePath]); err != nil {
+			return nil, err
+		}
+		result.DeletedLocal++
+	}
+
+	// 3. 内容与本地一致的文件记录本地的修改时间，避免下次重新分块
+	for filePath, f := range final {
+		if l, ok := local[filePath]; ok && l.Hash == f.Hash {
+			f.ModTime = l.ModTime
+			final[filePath] = f
+		}
+	}
+
+	// 4. 保存新的基线
+	root, trees := syncproto.DirectoryHashes(syncproto.BuildTree(treeFiles(final)))
+	s.state.Files = final
+	s.state.ServerRoot = root
+	s.state.Trees = trees
+	s.state.SyncedAt = time.Now()
+	if err := s.state.Save(s.statePath); err != nil {
+		return nil, err
+	}
+	result.Root = root
+	return result, nil
+}
+
+// clientIgnore 返回本客户端的忽略规则：配置中的规则加上 .sealock/ignore 文件中的规则
+func (s *Syncer) clientIgnore() ([]string, error) {
+	rules := append([]string{}, s.ignore...)
+	data, err := os.ReadFile(filepath.Join(s.root, StateDirName, ClientIgnoreFile))
+	if os.IsNotExist(err) {
+		return rules, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client ignore file: %w", err)
+	}
+	return append(rules, ignore.Parse(data).Patterns()...), nil
+}
+
+// libraryIgnore 读取本轮同步生效的 .sealockignore
+// 服务端版本自上次同步后未变化时以本地副本为准（本地修改会随本轮推送），
+// 否则使用服务端当前版本：本地副本与之一致时直接读本地文件，不一致时下载
+func (s *Syncer) libraryIgnore(ctx context.Context, remote map[string]FileState) (*ignore.Matcher, error) {
+	f, ok := remote[ignore.FileName]
+	base, synced := s.state.Files[ignore.FileName]
+	target := filepath.Join(s.root, ignore.FileName)
+	local, localErr := hashFile(target, s.chunker)
+	if ok == synced && (!ok || f.Hash == base.Hash) {
+		if localErr != nil {
+			if errors.Is(localErr, fs.ErrNotExist) {
+				return ignore.ParseLines(nil), nil
+			}
+			return nil, localErr
+		}
+		data, err := os.ReadFile(target)
+		if err != nil {
+			return nil, err
+		}
+		return ignore.Parse(data), nil
+	}
+	if !ok {
+		return ignore.ParseLines(nil), nil
+	}
+
+	if localErr == nil && local.Hash == f.Hash {
+		data, err := os.ReadFile(target)
+		if err != nil {
+			return nil, err
+		}
+		return ignore.Parse(data), nil
+	}
+
+	if err := verifyFileHash(ignore.FileName, f); err != nil {
+		return nil, err
+	}
+	var data []byte
+	for _, hash := range f.Blocks {
+		block, err := s.getBlock(ctx, hash)
+		if err != nil {
+			return nil, err
+		}
+		data = append(data, block...)
+	}
+	return ignore.Parse(data), nil
+}
+
+// reconcile 对每个路径做三方对比，生成同步计划
+func (s *Syncer) reconcile(base, local, remote map[string]FileState) *plan {
+	p := &plan{
+		upserts:   make(map[string]FileState),
+		bases:     make(map[string]string),
+		downloads: make(map[string]FileState),
+	}
+
+	paths := make(map[string]bool)
+	for _, m := range []map[string]FileState{base, local, remote} {
+		for filePath := range m {
+			paths[filePath] = true
+		}
+	}
+
+	for filePath := range paths {
+		b, inBase := base[filePath]
+		l, inLocal := local[filePath]
+		r, inRemote := remote[filePath]
+
+		switch syncproto.ClassifyChange(hashOf(b, inBase), hashOf(l, inLocal), hashOf(r, inRemote)) {
+		case syncproto.ChangeLocal:
+			p.bases[filePath] = hashOf(b, inBase)
+			if inLocal {
+				p.upserts[filePath] = l
+			} else {
+				p.deletes = append(p.deletes, filePath)
+			}
+		case syncproto.ChangeConflict:
+			if !inLocal {
+				// 本地删除、远端修改：保留远端修改
+				p.downloads[filePath] = r
+				continue
+			}
+			// 两端都修改：连同共同祖先一起推送，由服务端按库的冲突策略处理
+			p.bases[filePath] = hashOf(b, inBase)
+			p.upserts[filePath] = l
+		case syncproto.ChangeRemote:
+			if inRemote {
+				p.downloads[filePath] = r
+			} else {
+				p.removes = append(p.removes, filePath)
+			}
+		}
+	}
+	sort.Strings(p.deletes)
+	sort.Strings(p.removes)
+	return p
+}
+
+// uploadBlocks 上传服务端缺少的块，返回实际上传的块数
+func (s *Syncer) uploadBlocks(ctx context.Context, files map[string]FileState) (int, error) {
+	var hashes []string
+	for _, f := range files {
+		hashes = append(hashes, f.Blocks...)
+	}
+	if len(hashes) == 0 {
+		return 0, nil
+	}
+	missingList, err := s.api.CheckBlocks(ctx, hashes)
+	if err != nil {
+		return 0, err
+	}
+	missing := make(map[string]bool, len(missingList))
+	for _, hash := range missingList {
+		missing[hash] = true
+	}
+
+	sent := 0
+	for _, filePath := range sortedKeys(files) {
+		if len(missing) == 0 {
+			break
+		}
+		f := files[filePath]
+		target, err := s.abs(filePath)
+		if err != nil {
+			return sent, err
+		}
+		index := 0
+		err = readBlocks(target, s.chunker, func(hash string, data []byte) error {
+			if index >= len(f.Blocks) || f.Blocks[index] != hash {
+				return errLocalChanged
+			}
+			index++
+			if !missing[hash] {
+				return nil
+			}
+			if err := s.api.PutBlock(ctx, hash, data); err != nil {
+				return err
+			}
+			delete(missing, hash)
+			sent++
+			return nil
+		})
+		if err != nil {
+			if os.IsNotExist(err) {
+				return sent, errLocalChanged
+			}
+			return sent, err
+		}
+		if index != len(f.Blocks) {
+			return sent, errLocalChanged
+		}
+	}
+	return sent, nil
+}
+
+// download 下载远端文件并原子地替换本地文件，返回写入后的修改时间
+// 每个块的 SHA-256、文件的 Merkle 哈希和大小都与服务端声明的一致后才替换本地文件，否则返回 ErrIntegrity；
+// 本地文件在扫描之后又被修改时放弃覆盖并返回 errLocalChanged
+func (s *Syncer) download(ctx context.Context, filePath string, f FileState, expected FileState, exists bool) (time.Time, error) {
+	target, err := s.abs(filePath)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if err := verifyFileHash(filePath, f); err != nil {
+		return time.Time{}, err
+	}
+	if err := s.checkUnchanged(target, expected, exists); err != nil {
+		return time.Time{}, err
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return time.Time{}, fmt.Errorf("failed to create directory for %s: %w", filePath, err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(target), tempPrefix+"*")
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	var size int64
+	for _, hash := range f.Blocks {
+		data, err := s.getBlock(ctx, hash)
+		if err != nil {
+			tmp.Close()
+			return time.Time{}, err
+		}
+		if _, err := tmp.Write(data); err != nil {
+			tmp.Close()
+			return time.Time{}, fmt.Errorf("failed to write %s: %w", filePath, err)
+		}
+		size += int64(len(data))
+	}
+	if size != f.Size {
+		tmp.Close()
+		return time.Time{}, fmt.Errorf("%w: %s is %d bytes, expected %d", ErrIntegrity, filePath, size, f.Size)
+	}
+	if err := tmp.Close(); err != nil {
+		return time.Time{}, fmt.Errorf("failed to write %s: %w", filePath, err)
+	}
+
+	if err := s.checkUnchanged(target, expected, exists); err != nil {
+		return time.Time{}, err
+	}
+	if err := os.Rename(tmp.Name(), target); err != nil {
+		return time.Time{}, fmt.Errorf("failed to replace %s: %w", filePath, err)
+	}
+	info, err := os.Stat(target)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return info.ModTime(), nil
+}
+
+// getBlock 下载一个块并校验其 SHA-256
+func (s *Syncer) getBlock(ctx context.Context, hash string) ([]byte, error) {
+	data, err := s.api.GetBlock(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+	if hex.EncodeToString(sum[:]) != hash {
+		return nil, fmt.Errorf("%w: block %s", ErrIntegrity, hash)
+	}
+	return data, nil
+}
+
+// verifyFileHash 确认文件哈希是其块列表的 Merkle 哈希
+func verifyFileHash(filePath string, f FileState) error {
+	fileHash, err := chunker.ComputeFileMerkleHash(f.Blocks)
+	if err != nil {
+		return err
+	}
+	if fileHash != f.Hash {
+		return fmt.Errorf("%w: %s has hash %s, blocks hash to %s", ErrIntegrity, filePath, f.Hash, fileHash)
+	}
+	return nil
+}
+
+// removeLocal 删除远端已删除的本地文件，并清理随之变空的目录
+func (s *Syncer) removeLocal(filePath string, expected FileState) error {
+	target, err := s.abs(filePath)
+	if err != nil {
+		return err
+	}
+	if err := s.checkUnchanged(target, expected, true); err != nil {
+		return err
+	}
+	if err := os.Remove(target); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove %s: %w", filePath, err)
+	}
+	for dir := filepath.Dir(target); dir != s.root && strings.HasPrefix(dir, s.root); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			break
+		}
+	}
+	return nil
+}
+
+// checkUnchanged 确认本地文件与扫描时一致
+func (s *Syncer) checkUnchanged(target string, expected FileState, exists bool) error {
+	info, err := os.Stat(target)
+	if os.IsNotExist(err) {
+		if exists {
+			return errLocalChanged
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !exists || info.Size() != expected.Size || !info.ModTime().Equal(expected.ModTime) {
+		return errLocalChanged
+	}
+	return nil
+}
+
+// abs 把库内路径转换为本地绝对路径
+// 库内路径来自服务端，绝对路径和清理后跳出同步目录的路径（如 a/../../x）返回 ErrUnsafePath
+func (s *Syncer) abs(filePath string) (string, error) {
+	native := filepath.FromSlash(filePath)
+	if path.IsAbs(filePath) || filepath.IsAbs(native) || filepath.VolumeName(native) != "" {
+		return "", fmt.Errorf("%w: %q", ErrUnsafePath, filePath)
+	}
+	target := filepath.Join(s.root, native)
+	rel, err := filepath.Rel(s.root, target)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%w: %q", ErrUnsafePath, filePath)
+	}
+	return target, nil
+}
+
+// applyDiff 在上次同步的基线上套用服务端返回的差异子树，得到服务端当前的文件列表
+func applyDiff(base map[string]FileState, diff *api.SyncDiffResponse) map[string]FileState {
+	remote := make(map[string]FileState, len(base))
+	for filePath, f := range base {
+		remote[filePath] = f
+	}
+	if diff.UpToDate {
+		return remote
+	}
+
+	for _, subtree := range diff.Subtrees {
+		entries := make(map[string]api.SyncEntry, len(subtree.Entries))
+		for _, entry := range subtree.Entries {
+			entries[entry.Name] = entry
+		}
+
+		prefix := ""
+		if subtree.Path != "" {
+			prefix = subtree.Path + "/"
+		}
+		for filePath := range remote {
+			if !strings.HasPrefix(filePath, prefix) {
+				continue
+			}
+			rest := strings.TrimPrefix(filePath, prefix)
+			name, _, nested := strings.Cut(rest, "/")
+			entry, ok := entries[name]
+			if !ok || (nested && entry.Type != "dir") || (!nested && entry.Type != "file") {
+				delete(remote, filePath)
+			}
+		}
+		for _, entry := range subtree.Entries {
+			if entry.Type != "file" {
+				continue
+			}
+			filePath := path.Join(subtree.Path, entry.Name)
+			if prev, ok := remote[filePath]; ok && prev.Hash == entry.Hash {
+				continue
+			}
+			remote[filePath] = FileState{Hash: entry.Hash, Size: entry.Size, Blocks: entry.Blocks}
+		}
+	}
+	return remote
+}
+
+// hashOf 返回文件哈希，不存在时为空
+func hashOf(f FileState, exists bool) string {
+	if !exists {
+		return ""
+	}
+	return f.Hash
+}
+
+// filterFiles 去掉不在同步范围内的文件
+func filterFiles(files map[string]FileState, filter *ignore.Filter) map[string]FileState {
+	filtered := make(map[string]FileState, len(files))
+	for filePath, f := range files {
+		if !filter.Excluded(filePath) {
+			filtered[filePath] = f
+		}
+	}
+	return filtered
+}
+
+// treeFiles 把文件状态转换为构建目录树所需的文件列表，用于计算目录树哈希
+func treeFiles(files map[string]FileState) []syncproto.File {
+	result := make([]syncproto.File, 0, len(files))
+	for filePath, f := range files {
+		result = append(result, syncproto.File{Path: filePath, Hash: f.Hash, Size: f.Size})
+	}
+	return result
+}
+
+// sortedKeys 返回按字典序排列的键
+func sortedKeys(m map[string]FileState) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,151 @@
+package syncclient
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sealock/core-storage/chunker"
+	"github.com/sealock/core-storage/client"
+)
+
+// newTestSyncer 返回连接到 handler 的同步器，块大小为 4 字节
+func newTestSyncer(t *testing.T, handler http.Handler) *Syncer {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	s, err := NewSyncer(client.New(server.URL, "token"), Options{Root: t.TempDir(), LibraryID: 1, BlockSize: 4, ClientID: "test"})
+	if err != nil {
+		t.Fatalf("new syncer: %v", err)
+	}
+	return s
+}
+
+// blockServer 按块哈希返回 blocks 中的块数据
+func blockServer(blocks map[string][]byte) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, ok := blocks[strings.TrimPrefix(r.URL.Path, "/api/v1/sync/blocks/")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(data)
+	})
+}
+
+// testFile 按 4 字节分块，返回文件状态和块数据
+func testFile(content string) (FileState, map[string][]byte) {
+	blocks := make(map[string][]byte)
+	state := FileState{Size: int64(len(content)), Blocks: []string{}}
+	for i := 0; i < len(content); i += 4 {
+		data := []byte(content[i:min(i+4, len(content))])
+		sum := sha256.Sum256(data)
+		hash := hex.EncodeToString(sum[:])
+		blocks[hash] = data
+		state.Blocks = append(state.Blocks, hash)
+	}
+	state.Hash, _ = chunker.ComputeFileMerkleHash(state.Blocks)
+	return state, blocks
+}
+
+func TestReconcile(t *testing.T) {
+	s := &Syncer{}
+	base := map[string]FileState{
+		"both.txt": {Hash: "b"}, "local.txt": {Hash: "b"}, "remote.txt": {Hash: "b"},
+		"deleted-local.txt": {Hash: "b"}, "deleted-remote.txt": {Hash: "b"}, "same.txt": {Hash: "b"},
+	}
+	local := map[string]FileState{
+		"both.txt": {Hash: "l"}, "local.txt": {Hash: "l"}, "remote.txt": {Hash: "b"},
+		"deleted-remote.txt": {Hash: "b"}, "same.txt": {Hash: "x"}, "new.txt": {Hash: "n"},
+	}
+	remote := map[string]FileState{
+		"both.txt": {Hash: "r"}, "local.txt": {Hash: "b"}, "remote.txt": {Hash: "r"},
+		"deleted-local.txt": {Hash: "r"}, "same.txt": {Hash: "x"},
+	}
+
+	p := s.reconcile(base, local, remote)
+	// 两端都修改：推送本地版本并带上共同祖先，由服务端处理冲突
+	if p.upserts["both.txt"].Hash != "l" || p.bases["both.txt"] != "b" {
+		t.Fatalf("conflict: upsert %+v, base %q", p.upserts["both.txt"], p.bases["both.txt"])
+	}
+	if p.upserts["local.txt"].Hash != "l" || p.upserts["new.txt"].Hash != "n" || p.bases["new.txt"] != "" {
+		t.Fatalf("local changes: %+v", p.upserts)
+	}
+	if len(p.upserts) != 3 {
+		t.Fatalf("upserts = %+v, want both.txt, local.txt and new.txt", p.upserts)
+	}
+	// 本地删除、远端修改：保留远端修改
+	if p.downloads["deleted-local.txt"].Hash != "r" || p.downloads["remote.txt"].Hash != "r" || len(p.downloads) != 2 {
+		t.Fatalf("downloads = %+v", p.downloads)
+	}
+	if len(p.removes) != 1 || p.removes[0] != "deleted-remote.txt" || len(p.deletes) != 0 {
+		t.Fatalf("removes = %v, deletes = %v", p.removes, p.deletes)
+	}
+}
+
+func TestDownloadVerifiesContent(t *testing.T) {
+	ctx := context.Background()
+	f, blocks := testFile("hello world")
+	s := newTestSyncer(t, blockServer(blocks))
+
+	if _, err := s.download(ctx, "docs/a.txt", f, FileState{}, false); err != nil {
+		t.Fatalf("download: %v", err)
+	}
+	if data, err := os.ReadFile(filepath.Join(s.Root(), "docs", "a.txt")); err != nil || string(data) != "hello world" {
+		t.Fatalf("downloaded %q, %v", data, err)
+	}
+
+	// 服务端返回的块与哈希不符、文件哈希与块列表不符时都不写入本地文件
+	tampered := make(map[string][]byte, len(blocks))
+	for hash, data := range blocks {
+		tampered[hash] = data
+	}
+	tampered[f.Blocks[1]] = []byte("WORL")
+	s = newTestSyncer(t, blockServer(tampered))
+	if _, err := s.download(ctx, "b.txt", f, FileState{}, false); !errors.Is(err, ErrIntegrity) {
+		t.Fatalf("tampered block: err = %v, want ErrIntegrity", err)
+	}
+	forged := f
+	forged.Hash = strings.Repeat("0", 64)
+	if _, err := s.download(ctx, "c.txt", forged, FileState{}, false); !errors.Is(err, ErrIntegrity) {
+		t.Fatalf("forged file hash: err = %v, want ErrIntegrity", err)
+	}
+	entries, _ := os.ReadDir(s.Root())
+	if len(entries) != 0 {
+		t.Fatalf("failed downloads left %d entries in the sync directory", len(entries))
+	}
+}
+
+func TestDownloadRejectsUnsafePaths(t *testing.T) {
+	ctx := context.Background()
+	f, blocks := testFile("evil")
+	s := newTestSyncer(t, blockServer(blocks))
+	outside := filepath.Join(filepath.Dir(s.Root()), "outside.txt")
+
+	for _, filePath := range []string{"../outside.txt", "docs/../../outside.txt", "/tmp/outside.txt", outside, "", "."} {
+		if _, err := s.download(ctx, filePath, f, FileState{}, false); !errors.Is(err, ErrUnsafePath) {
+			t.Fatalf("download %q: err = %v, want ErrUnsafePath", filePath, err)
+		}
+		if err := s.removeLocal(filePath, FileState{}); !errors.Is(err, ErrUnsafePath) {
+			t.Fatalf("remove %q: err = %v, want ErrUnsafePath", filePath, err)
+		}
+	}
+	if _, err := os.Stat(outside); !os.IsNotExist(err) {
+		t.Fatalf("file written outside the sync directory: %v", err)
+	}
+
+	// 清理后仍在同步目录内的路径照常写入
+	if _, err := s.download(ctx, "docs/../a.txt", f, FileState{}, false); err != nil {
+		t.Fatalf("download within root: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(s.Root(), "a.txt")); err != nil {
+		t.Fatalf("stat: %v", err)
+	}
+}
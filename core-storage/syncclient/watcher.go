@@ -0,0 +1,164 @@
+package syncclient
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/sealock/core-storage/api"
+)
+
+const (
+	// DefaultDebounce 本地变更后等待文件系统安静下来再同步的时间
+	DefaultDebounce = time.Second
+	// DefaultPollInterval 没有本地变更时拉取远端变更的间隔（事件流断开时的兜底）
+	DefaultPollInterval = 30 * time.Second
+	// eventRetryMin/eventRetryMax 事件流断开后的重连退避
+	eventRetryMin = time.Second
+	eventRetryMax = time.Minute
+)
+
+// Watch 持续同步：启动时先同步一次，之后在本地文件变化、服务端推送变更事件（均防抖后）
+// 或定时轮询时再同步；单轮同步失败只记录日志，在下一次触发时重试；ctx 取消时返回
+func Watch(ctx context.Context, s *Syncer, debounce, pollInterval time.Duration) error {
+	if debounce <= 0 {
+		debounce = DefaultDebounce
+	}
+	if pollInterval <= 0 {
+		pollInterval = DefaultPollInterval
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to create file watcher: %w", err)
+	}
+	defer watcher.Close()
+
+	if err := watchTree(watcher, s.Root()); err != nil {
+		return err
+	}
+
+	remote := make(chan struct{}, 1)
+	go followEvents(ctx, s, remote)
+
+	runSync(ctx, s)
+
+	timer := time.NewTimer(debounce)
+	timer.Stop()
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			rel, err := filepath.Rel(s.Root(), event.Name)
+			if err != nil || ignored(filepath.ToSlash(rel)) {
+				continue
+			}
+			// 新建的目录需要加入监听（fsnotify 不递归）
+			if event.Has(fsnotify.Create) {
+				if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+					if err := watchTree(watcher, event.Name); err != nil {
+						log.Printf("sealock-sync: %v", err)
+					}
+				}
+			}
+			timer.Reset(debounce)
+
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			log.Printf("sealock-sync: watcher error: %v", err)
+
+		case <-remote:
+			timer.Reset(debounce)
+
+		case <-timer.C:
+			runSync(ctx, s)
+
+		case <-ticker.C:
+			runSync(ctx, s)
+		}
+	}
+}
+
+// followEvents 订阅服务端的变更事件流，收到事件时通过 remote 通知同步
+// 断线后以最后收到的序号重连，服务端不支持事件流时退避重试，期间由轮询兜底
+func followEvents(ctx context.Context, s *Syncer, remote chan<- struct{}) {
+	var cursor uint64
+	backoff := eventRetryMin
+	for ctx.Err() == nil {
+		started := time.Now()
+		next, err := s.api.StreamEvents(ctx, s.libraryID, cursor, func(eventType string, event api.Event) {
+			select {
+			case remote <- struct{}{}:
+			default:
+			}
+		})
+		cursor = next
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			log.Printf("sealock-sync: event stream: %v", err)
+		}
+		if time.Since(started) > eventRetryMax {
+			backoff = eventRetryMin
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > eventRetryMax {
+			backoff = eventRetryMax
+		}
+	}
+}
+
+// runSync 执行一轮同步并记录结果
+func runSync(ctx context.Context, s *Syncer) {
+	result, err := s.SyncOnce(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Printf("sealock-sync: sync failed: %v", err)
+		}
+		return
+	}
+	if result.Changed() {
+		log.Printf("sealock-sync: synced (up %d, remote deletes %d, down %d, local deletes %d, conflicts %d, blocks sent %d)",
+			result.Uploaded, result.DeletedRemote, result.Downloaded, result.DeletedLocal, result.Conflicts, result.BlocksSent)
+	}
+}
+
+// watchTree 递归地把目录及其子目录加入监听
+func watchTree(watcher *fsnotify.Watcher, root string) error {
+	return filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if d.Name() == StateDirName {
+			return filepath.SkipDir
+		}
+		if err := watcher.Add(p); err != nil {
+			return fmt.Errorf("failed to watch %s: %w", p, err)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,53 @@
+package syncproto
+
+// ChangeType classifies how a path changed relative to a common ancestor
+type ChangeType int
+
+const (
+	// ChangeNone neither side changed the path
+	ChangeNone ChangeType = iota
+	// ChangeLocal only the local side changed the path
+	ChangeLocal
+	// ChangeRemote only the remote side changed the path
+	ChangeRemote
+	// ChangeConverged both sides changed the path to the same content
+	ChangeConverged
+	// ChangeConflict both sides changed the path to different content
+	ChangeConflict
+)
+
+// String returns the name of the change type
+func (c ChangeType) String() string {
+	switch c {
+	case ChangeNone:
+		return "none"
+	case ChangeLocal:
+		return "local"
+	case ChangeRemote:
+		return "remote"
+	case ChangeConverged:
+		return "converged"
+	default:
+		return "conflict"
+	}
+}
+
+// ClassifyChange performs a three-way comparison of one path.
+// baseHash is the common ancestor (the content both sides last agreed on),
+// localHash and remoteHash are the current contents; an empty hash means the
+// path does not exist on that side. Unlike a two-way tree comparison, which only
+// sees two versions, this can tell a conflicting edit from a normal update.
+func ClassifyChange(baseHash, localHash, remoteHash string) ChangeType {
+	switch {
+	case localHash == remoteHash && localHash == baseHash:
+		return ChangeNone
+	case localHash == remoteHash:
+		return ChangeConverged
+	case remoteHash == baseHash:
+		return ChangeLocal
+	case localHash == baseHash:
+		return ChangeRemote
+	default:
+		return ChangeConflict
+	}
+}
@@ -0,0 +1,35 @@
+package syncproto
+
+import "testing"
+
+func TestClassifyChange(t *testing.T) {
+	tests := []struct {
+		name                string
+		base, local, remote string
+		want                ChangeType
+	}{
+		{name: "unchanged", base: "a", local: "a", remote: "a", want: ChangeNone},
+		{name: "absent everywhere", want: ChangeNone},
+		{name: "local edit", base: "a", local: "b", remote: "a", want: ChangeLocal},
+		{name: "local create", local: "b", want: ChangeLocal},
+		{name: "local delete", base: "a", remote: "a", want: ChangeLocal},
+		{name: "remote edit", base: "a", local: "a", remote: "c", want: ChangeRemote},
+		{name: "remote create", remote: "c", want: ChangeRemote},
+		{name: "remote delete", base: "a", local: "a", want: ChangeRemote},
+		{name: "same edit on both sides", base: "a", local: "b", remote: "b", want: ChangeConverged},
+		{name: "same create on both sides", local: "b", remote: "b", want: ChangeConverged},
+		{name: "deleted on both sides", base: "a", want: ChangeConverged},
+		{name: "different edits", base: "a", local: "b", remote: "c", want: ChangeConflict},
+		{name: "different creates", local: "b", remote: "c", want: ChangeConflict},
+		{name: "local edit remote delete", base: "a", local: "b", want: ChangeConflict},
+		{name: "local delete remote edit", base: "a", remote: "c", want: ChangeConflict},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ClassifyChange(tt.base, tt.local, tt.remote); got != tt.want {
+				t.Errorf("ClassifyChange(%q, %q, %q) = %v, want %v", tt.base, tt.local, tt.remote, got, tt.want)
+			}
+		})
+	}
+}
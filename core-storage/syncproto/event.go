@@ -0,0 +1,28 @@
+package syncproto
+
+import "time"
+
+// EventType 变更事件类型
+type EventType string
+
+const (
+	EventFileCreated   EventType = "file.created"   // 新建文件
+	EventFileUpdated   EventType = "file.updated"   // 文件内容变化
+	EventFileDeleted   EventType = "file.deleted"   // 删除文件
+	EventFileMoved     EventType = "file.moved"     // 移动/重命名（同一次变更中删除旧路径并以相同内容创建新路径）
+	EventCommitCreated EventType = "commit.created" // 生成新提交
+)
+
+// Event 库的一次变更
+// Seq 在库内单调递增，客户端用它作为游标在重连后续传
+type Event struct {
+	Seq       uint64    `json:"seq"`
+	LibraryID uint      `json:"libraryId"`
+	Type      EventType `json:"type"`
+	Path      string    `json:"path,omitempty"`
+	OldPath   string    `json:"oldPath,omitempty"` // file.moved 的原路径
+	Hash      string    `json:"hash,omitempty"`    // 文件内容哈希或提交的根哈希
+	Size      int64     `json:"size,omitempty"`
+	CommitID  string    `json:"commitId,omitempty"` // commit.created 的提交 UUID
+	Time      time.Time `json:"time"`
+}
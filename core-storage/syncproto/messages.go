@@ -0,0 +1,82 @@
+package syncproto
+
+import "time"
+
+// ============ 增量同步协议消息 ============
+// 协议流程见服务端 service/sync_protocol.go：客户端先用 SyncDiffRequest 对比目录树哈希，
+// 补齐缺少的块后用 SyncPushRequest 提交变更
+
+// SyncEntry 同步协议中的目录条目
+type SyncEntry struct {
+	Name   string   `json:"name"`
+	Type   string   `json:"type"` // "file" 或 "dir"
+	Hash   string   `json:"hash"`
+	Size   int64    `json:"size"`
+	Blocks []string `json:"blocks,omitempty"` // 仅文件条目：按顺序排列的块哈希
+}
+
+// SyncSubtree 与客户端哈希不一致的目录及其直接子项
+type SyncSubtree struct {
+	Path    string      `json:"path"` // 目录路径，根目录为空字符串
+	Hash    string      `json:"hash"`
+	Entries []SyncEntry `json:"entries"`
+}
+
+// SyncDiffRequest 客户端上报的目录树哈希
+// 服务端按库的 .sealockignore 加上 Ignore、Include 过滤后再构建目录树，
+// 客户端必须用同样的规则计算自己的目录哈希
+type SyncDiffRequest struct {
+	Root    string            `json:"root"`
+	Trees   map[string]string `json:"trees"`             // 目录路径 → 目录哈希，根目录键为空字符串
+	Ignore  []string          `json:"ignore,omitempty"`  // 客户端自己的忽略规则（gitignore 语法）
+	Include []string          `json:"include,omitempty"` // 选择性同步的子树，为空表示整个库
+}
+
+// SyncDiffResponse 服务端返回的差异子树
+type SyncDiffResponse struct {
+	Root     string        `json:"root"`
+	UpToDate bool          `json:"upToDate"`
+	Subtrees []SyncSubtree `json:"subtrees"`
+}
+
+// SyncFile 客户端提交的文件
+type SyncFile struct {
+	Path     string    `json:"path"`
+	Hash     string    `json:"hash"`
+	Size     int64     `json:"size"`
+	Blocks   []string  `json:"blocks"`
+	BaseHash string    `json:"baseHash"`          // 共同祖先版本的哈希，新文件为空
+	ModTime  time.Time `json:"modTime,omitempty"` // 客户端的修改时间（newest_wins 策略使用）
+}
+
+// SyncDeletion 客户端提交的删除
+type SyncDeletion struct {
+	Path     string `json:"path"`
+	BaseHash string `json:"baseHash"` // 客户端删除前的版本
+}
+
+// SyncPushRequest 客户端提交的变更
+type SyncPushRequest struct {
+	BaseRoot string         `json:"baseRoot"` // 客户端最近一次同步时服务端的根哈希，与当前一致时不可能发生冲突
+	ClientID string         `json:"clientId"` // 客户端标识，用于命名冲突副本
+	Files    []SyncFile     `json:"files"`    // 新增或修改的文件
+	Deleted  []SyncDeletion `json:"deleted"`  // 删除的文件
+}
+
+// SyncConflictResult 提交中发生的冲突及其处理结果
+type SyncConflictResult struct {
+	ID         uint   `json:"id,omitempty"` // 冲突记录ID（未记录时为 0）
+	Path       string `json:"path"`
+	Status     string `json:"status"`     // open 或 resolved
+	Resolution string `json:"resolution"` // server、client 或 keep_both，open 时为空
+	CopyPath   string `json:"copyPath,omitempty"`
+}
+
+// SyncPushResponse 提交结果
+type SyncPushResponse struct {
+	Root      string               `json:"root"` // 整个库（未经过滤）的根哈希
+	Updated   int                  `json:"updated"`
+	Deleted   int                  `json:"deleted"`
+	Ignored   []string             `json:"ignored"` // 命中库忽略规则而未保存的文件
+	Conflicts []SyncConflictResult `json:"conflicts"`
+}
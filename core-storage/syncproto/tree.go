@@ -0,0 +1,173 @@
+// Package syncproto 是增量同步协议中服务端与客户端共用的部分：
+// 协议消息、目录树的 Merkle 哈希、三方对比和变更事件。
+// 只依赖标准库，同步客户端引用它时不会链接服务端的存储和数据库代码
+package syncproto
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DirectoryEntry 代表目录树中的一个条目（文件或目录）
+// 用于重建目录结构和计算 Merkle hash
+type DirectoryEntry struct {
+	Name     string            // 文件/目录名
+	IsDir    bool              // 是否为目录
+	Hash     string            // 目录条目的 hash（文件为 Block hash，目录为树 hash）
+	Size     int64             // 大小
+	Children []*DirectoryEntry // 子项（仅当 IsDir=true 时）
+	Metadata map[string]string // 额外元数据（权限、修改时间等）
+}
+
+// File 参与构建目录树的文件
+type File struct {
+	Path string // 库内路径
+	Hash string // 内容哈希
+	Size int64
+}
+
+// BuildTree 把扁平的文件路径列表组装成嵌套目录树
+// 目录条目的 Hash 为其子项的 Merkle 根（MerkleRoot），空路径的文件被忽略
+func BuildTree(files []File) []DirectoryEntry {
+	root := &DirectoryEntry{IsDir: true}
+	dirs := map[string]*DirectoryEntry{"": root}
+
+	var ensureDir func(dirPath string) *DirectoryEntry
+	ensureDir = func(dirPath string) *DirectoryEntry {
+		if dir, ok := dirs[dirPath]; ok {
+			return dir
+		}
+		parent := ensureDir(parentDir(dirPath))
+		dir := &DirectoryEntry{Name: path.Base(dirPath), IsDir: true, Children: []*DirectoryEntry{}}
+		parent.Children = append(parent.Children, dir)
+		dirs[dirPath] = dir
+		return dir
+	}
+
+	for _, file := range files {
+		filePath := CleanPath(file.Path)
+		if filePath == "" {
+			continue
+		}
+		parent := ensureDir(parentDir(filePath))
+		parent.Children = append(parent.Children, &DirectoryEntry{
+			Name: path.Base(filePath),
+			Hash: file.Hash,
+			Size: file.Size,
+		})
+	}
+
+	// 自底向上计算目录哈希和大小
+	var finalize func(dir *DirectoryEntry)
+	finalize = func(dir *DirectoryEntry) {
+		dir.Size = 0
+		for _, child := range dir.Children {
+			if child.IsDir {
+				finalize(child)
+			}
+			dir.Size += child.Size
+		}
+		sort.Slice(dir.Children, func(i, j int) bool { return dir.Children[i].Name < dir.Children[j].Name })
+		dir.Hash = MerkleRoot(Entries(dir.Children))
+	}
+	finalize(root)
+
+	return Entries(root.Children)
+}
+
+// MerkleRoot 计算一组目录条目的 Merkle 根，子目录递归计算
+// 空目录的哈希为空内容的 SHA-256
+func MerkleRoot(entries []DirectoryEntry) string {
+	if len(entries) == 0 {
+		emptyHash := sha256.Sum256([]byte{})
+		return hex.EncodeToString(emptyHash[:])
+	}
+
+	// 按名称排序确保一致性
+	sortedEntries := make([]DirectoryEntry, len(entries))
+	copy(sortedEntries, entries)
+	sort.Slice(sortedEntries, func(i, j int) bool {
+		return sortedEntries[i].Name < sortedEntries[j].Name
+	})
+
+	// 计算每个条目的哈希值
+	entryHashes := make([]string, len(sortedEntries))
+	for i, entry := range sortedEntries {
+		var contentHash string
+		if entry.IsDir && entry.Children != nil {
+			contentHash = MerkleRoot(Entries(entry.Children))
+		} else {
+			contentHash = entry.Hash
+		}
+
+		// 组合名称、类型和内容哈希
+		combined := entry.Name + strconv.FormatBool(entry.IsDir) + contentHash
+		h := sha256.Sum256([]byte(combined))
+		entryHashes[i] = hex.EncodeToString(h[:])
+	}
+
+	// 递归构建Merkle树
+	for len(entryHashes) > 1 {
+		if len(entryHashes)%2 == 1 {
+			entryHashes = append(entryHashes, entryHashes[len(entryHashes)-1])
+		}
+
+		var newLevel []string
+		for i := 0; i < len(entryHashes); i += 2 {
+			pairHash := sha256.Sum256([]byte(entryHashes[i] + entryHashes[i+1]))
+			newLevel = append(newLevel, hex.EncodeToString(pairHash[:]))
+		}
+		entryHashes = newLevel
+	}
+
+	return entryHashes[0]
+}
+
+// DirectoryHashes 计算目录树的根哈希和每个目录的哈希
+// 返回的 map 以目录路径为键，根目录键为空字符串
+func DirectoryHashes(entries []DirectoryEntry) (string, map[string]string) {
+	root := MerkleRoot(entries)
+	hashes := map[string]string{"": root}
+
+	var walk func(prefix string, children []DirectoryEntry)
+	walk = func(prefix string, children []DirectoryEntry) {
+		for _, child := range children {
+			if !child.IsDir {
+				continue
+			}
+			childPath := path.Join(prefix, child.Name)
+			sub := Entries(child.Children)
+			hashes[childPath] = MerkleRoot(sub)
+			walk(childPath, sub)
+		}
+	}
+	walk("", entries)
+	return root, hashes
+}
+
+// Entries 将子项的指针切片转换为值切片
+func Entries(children []*DirectoryEntry) []DirectoryEntry {
+	entries := make([]DirectoryEntry, len(children))
+	for i, child := range children {
+		entries[i] = *child
+	}
+	return entries
+}
+
+// CleanPath 规范化库内路径：去掉首尾的 /，折叠 . 和 ..，根目录为空字符串
+func CleanPath(p string) string {
+	return strings.Trim(path.Clean("/"+p), "/")
+}
+
+// parentDir 返回路径的父目录，顶层路径的父目录为空字符串
+func parentDir(p string) string {
+	parent := path.Dir(p)
+	if parent == "." {
+		return ""
+	}
+	return parent
+}